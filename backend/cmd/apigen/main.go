@@ -0,0 +1,47 @@
+// Command apigen writes the backend's OpenAPI document and the Go client
+// generated from it. Run it through go generate in pkg/client.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/api"
+	"github.com/KFN002/B-2-Torrent/backend/internal/openapi"
+)
+
+func main() {
+	specPath := flag.String("spec", "", "write the OpenAPI document to this file")
+	clientPath := flag.String("client", "", "write the generated Go client to this file")
+	pkg := flag.String("package", "client", "package name of the generated client")
+	flag.Parse()
+
+	if err := run(*specPath, *clientPath, *pkg); err != nil {
+		fmt.Fprintln(os.Stderr, "apigen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(specPath, clientPath, pkg string) error {
+	doc := api.OpenAPI()
+	if specPath != "" {
+		spec, err := doc.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(specPath, spec, 0o644); err != nil {
+			return err
+		}
+	}
+	if clientPath != "" {
+		source, err := openapi.GenerateClient(doc, pkg)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(clientPath, source, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+// Command b2ctl manages a B-2-Torrent backend over its REST API, for hosts
+// administered over SSH without the web UI.
+//
+// The backend URL and API token come from flags, the B2CTL_URL and
+// B2CTL_TOKEN environment variables (B2_API_TOKEN is accepted too), or a
+// JSON config file, in that order:
+//
+//	{"url": "https://b2.example:8080", "token": "b2t_..."}
+//
+// The config file defaults to b2ctl/config.json under the user config
+// directory and must not be readable by other users.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/pkg/client"
+)
+
+const defaultURL = "http://localhost:8080"
+
+// errUsage marks a command line error; the usage has already been printed.
+var errUsage = errors.New("usage")
+
+// Config is the content of the config file.
+type Config struct {
+	URL   string `json:"url"`
+	Token string `json:"token"`
+}
+
+// app is the state shared by every command.
+type app struct {
+	api     *client.Client
+	out     io.Writer
+	errOut  io.Writer
+	in      io.Reader
+	json    bool
+	timeout time.Duration
+	// cmd is the command being run.
+	cmd *command
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, a *app, args []string) error
+}
+
+// commands is kept in the order the usage lists them.
+var commands = []command{
+	{"add", "<magnet|file.torrent>...", "add torrents from magnet links or .torrent files", runAdd},
+	{"list", "[-status s] [-name text] [-favorite] [-sort key]", "list torrents", runList},
+	{"info", "<infohash>", "show one torrent", runInfo},
+	{"pause", "<infohash>...", "pause torrents", runPause},
+	{"resume", "<infohash>...", "resume torrents", runResume},
+	{"remove", "[-wipe [-passes n] [-wait]] <infohash>...", "remove torrents, optionally wiping their data", runRemove},
+	{"limits", "[-down rate] [-up rate] [infohash]", "set per-torrent or, without an infohash, global rate limits", runLimits},
+	{"files", "<infohash>", "list a torrent's files", runFiles},
+	{"priority", "<infohash> <skip|normal|high> <index>...", "set the priority of a torrent's files", runPriority},
+	{"watch", "[-interval d] [infohash]", "show live torrent progress until interrupted", runWatch},
+	{"security", "[status]", "show the security status", runSecurity},
+	{"killswitch", "[status | trigger [-mode soft|hard] [-reason text] | reset]", "show, trigger or reset the kill switch", runKillSwitch},
+	{"encrypt", "[-keyring | -password-file f] [-algorithm a] [-wait] <path>", "encrypt a file on the server", runEncrypt},
+	{"decrypt", "[-keyring | -password-file f] [-wait] <path>", "decrypt a file on the server", runDecrypt},
+	{"keygen", "<private-key-file>", "create a recipient key pair for automatic encryption", runKeygen},
+	{"open", "-key-file f <file.b2encrypted> <output>", "decrypt a file encrypted to a recipient key, locally", runOpen},
+	{"cleanup", "-yes [-delete-downloads] [-wait]", "remove every torrent and local record", runCleanup},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	switch {
+	case err == nil:
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "b2ctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, in io.Reader, out, errOut io.Writer) error {
+	flags := flag.NewFlagSet("b2ctl", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	urlFlag := flags.String("url", "", "backend URL (default $B2CTL_URL, the config file or "+defaultURL+")")
+	configPath := flags.String("config", "", "config file (default $B2CTL_CONFIG or "+filepath.Join("$CONFIG", "b2ctl", "config.json")+")")
+	jsonOutput := flags.Bool("json", false, "print JSON instead of tables")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of each request")
+	flags.Usage = func() { usage(errOut, flags) }
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return errUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errUsage
+	}
+
+	name := flags.Arg(0)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if name == "help" {
+		flags.Usage()
+		return nil
+	}
+	if cmd == nil {
+		fmt.Fprintf(errOut, "b2ctl: unknown command %q\n", name)
+		flags.Usage()
+		return errUsage
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *urlFlag != "" {
+		config.URL = *urlFlag
+	}
+	api, err := client.New(config.URL, client.WithToken(config.Token))
+	if err != nil {
+		return err
+	}
+
+	a := &app{api: api, out: out, errOut: errOut, in: in, json: *jsonOutput, timeout: *timeout, cmd: cmd}
+	err = cmd.run(ctx, a, flags.Args()[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: b2ctl [flags] <command> [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nFlags:")
+	flags.PrintDefaults()
+	fmt.Fprintln(w, "\nRun b2ctl <command> -h for the arguments of a command.")
+}
+
+// loadConfig reads the config file, if there is one, and applies the
+// environment on top of it.
+func loadConfig(path string) (Config, error) {
+	explicit := path != ""
+	if path == "" {
+		path = os.Getenv("B2CTL_CONFIG")
+		explicit = path != ""
+	}
+	if path == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			path = filepath.Join(dir, "b2ctl", "config.json")
+		}
+	}
+
+	var config Config
+	if path != "" {
+		if err := readConfig(path, &config); err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+			return Config{}, err
+		}
+	}
+
+	if url := os.Getenv("B2CTL_URL"); url != "" {
+		config.URL = url
+	}
+	for _, key := range []string{"B2CTL_TOKEN", "B2_API_TOKEN"} {
+		if token := strings.TrimSpace(os.Getenv(key)); token != "" {
+			config.Token = token
+			break
+		}
+	}
+	if config.URL == "" {
+		config.URL = defaultURL
+	}
+	return config, nil
+}
+
+func readConfig(path string, config *Config) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	// The file holds a token, so refuse it when others can read it, like
+	// ssh does with private keys.
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("config file %s is accessible by other users; chmod 600 it", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// request bounds one API call by the -timeout flag.
+func (a *app) request(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, a.timeout)
+}
+
+// newFlags returns the flag set of the command being run, printing its
+// usage line on errors.
+func (a *app) newFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet("b2ctl "+a.cmd.name, flag.ContinueOnError)
+	flags.SetOutput(a.errOut)
+	flags.Usage = func() {
+		fmt.Fprintf(a.errOut, "Usage: b2ctl %s %s\n\n%s.\n", a.cmd.name, a.cmd.args, capitalize(a.cmd.summary))
+		hasFlags := false
+		flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(a.errOut, "\nFlags:")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+// parse parses a command's arguments and checks how many positional
+// arguments remain; max < 0 means no upper bound. It returns flag.ErrHelp
+// for -h, which run treats as success.
+func parse(flags *flag.FlagSet, args []string, min, max int) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if flags.NArg() < min || (max >= 0 && flags.NArg() > max) {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/pkg/client"
+	"go.uber.org/zap"
+)
+
+// runAgainst runs b2ctl against handler and returns its standard output.
+func runAgainst(t *testing.T, handler http.HandlerFunc, stdin string, args ...string) (string, error) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	t.Setenv("B2CTL_CONFIG", "")
+	t.Setenv("B2CTL_TOKEN", "b2t_test")
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	var out, errOut bytes.Buffer
+	err := run(context.Background(), append([]string{"-url", server.URL}, args...), strings.NewReader(stdin), &out, &errOut)
+	return out.String(), err
+}
+
+func TestListFiltersAndPrintsJSON(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer b2t_test" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode([]client.TorrentInfo{
+			{InfoHash: "aaaa", Name: "Debian ISO", Status: "downloading", Progress: 40},
+			{InfoHash: "bbbb", Name: "debian source", Status: "paused", Favorite: true},
+			{InfoHash: "cccc", Name: "Arch ISO", Status: "downloading"},
+		})
+	}
+
+	out, err := runAgainst(t, handler, "", "-json", "list", "-name", "DEBIAN", "-status", "downloading,paused", "-favorite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var torrents []client.TorrentInfo
+	if err := json.Unmarshal([]byte(out), &torrents); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if len(torrents) != 1 || torrents[0].InfoHash != "bbbb" {
+		t.Fatalf("torrents = %+v", torrents)
+	}
+
+	out, err = runAgainst(t, handler, "", "list", "-sort", "progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "INFOHASH") || !strings.HasPrefix(lines[1], "aaaa") || !strings.Contains(lines[1], "40.0%") {
+		t.Fatalf("table:\n%s", out)
+	}
+}
+
+func TestAddSendsTorrentFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.torrent")
+	if err := os.WriteFile(path, []byte("d4:infod4:name3:abcee"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var got client.AddTorrentRequest
+	out, err := runAgainst(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(client.AddTorrentResponse{InfoHash: "abcd"})
+	}, "", "add", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.TorrentFile) != "d4:infod4:name3:abcee" || got.MagnetURI != "" {
+		t.Fatalf("request = %+v", got)
+	}
+	if !strings.Contains(out, "abcd") {
+		t.Fatalf("output = %q", out)
+	}
+}
+
+func TestRemoveWaitsForWipe(t *testing.T) {
+	defer func(interval time.Duration) { jobPollInterval = interval }(jobPollInterval)
+	jobPollInterval = time.Millisecond
+	polls := 0
+	out, err := runAgainst(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/torrents/abcd":
+			if r.URL.Query().Get("wipe") != "true" || r.URL.Query().Get("passes") != "7" {
+				t.Errorf("query = %s", r.URL.RawQuery)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(client.Job{ID: "job-1", Status: "queued"})
+		case r.URL.Path == "/api/jobs/job-1":
+			polls++
+			status := "running"
+			if polls == 2 {
+				status = "succeeded"
+			}
+			json.NewEncoder(w).Encode(client.Job{ID: "job-1", Status: status})
+		default:
+			http.NotFound(w, r)
+		}
+	}, "", "remove", "-wipe", "-passes", "7", "-wait", "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polls != 2 || !strings.Contains(out, "job job-1 succeeded") {
+		t.Fatalf("polls = %d, output = %q", polls, out)
+	}
+}
+
+func TestCommandsReportErrors(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(client.ErrorResponse{Error: "Torrent not found"})
+	}
+
+	if _, err := runAgainst(t, handler, "", "info", "abcd"); !client.IsStatus(err, http.StatusNotFound) {
+		t.Fatalf("info err = %v", err)
+	}
+	if _, err := runAgainst(t, handler, "", "cleanup"); err == nil || !strings.Contains(err.Error(), "-yes") {
+		t.Fatalf("cleanup without -yes err = %v", err)
+	}
+	if _, err := runAgainst(t, handler, "", "frobnicate"); err != errUsage {
+		t.Fatalf("unknown command err = %v", err)
+	}
+	if _, err := runAgainst(t, handler, "", "priority", "abcd", "high"); err != errUsage {
+		t.Fatalf("priority without indices err = %v", err)
+	}
+}
+
+func TestKeygenAndOpen(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "recipient.key")
+	out, err := runAgainst(t, nil, "", "keygen", keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := security.ParseRecipientKey(out)
+	if err != nil {
+		t.Fatalf("keygen printed %q: %v", out, err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("private key file = %v, %v", info, err)
+	}
+
+	plainPath := filepath.Join(dir, "file.bin")
+	if err := os.WriteFile(plainPath, []byte("recipient only"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	em := security.NewEncryptionManager(&security.EncryptionConfig{Algorithm: "AES-256-GCM", KeyDerivation: "Argon2id", HashAlgorithm: "SHA-256"}, zap.NewNop())
+	em.SetRecipient(public)
+	if err := em.EncryptFile(plainPath, plainPath+".b2encrypted", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	openedPath := filepath.Join(dir, "opened.bin")
+	if _, err := runAgainst(t, nil, "", "open", "-key-file", keyFile, plainPath+".b2encrypted", openedPath); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(openedPath); err != nil || string(data) != "recipient only" {
+		t.Fatalf("opened = %q, %v", data, err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"url": "https://b2.example", "token": "from-file"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("B2CTL_URL", "")
+	t.Setenv("B2CTL_TOKEN", "")
+	t.Setenv("B2_API_TOKEN", "")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.URL != "https://b2.example" || config.Token != "from-file" {
+		t.Fatalf("config = %+v", config)
+	}
+
+	t.Setenv("B2_API_TOKEN", "from-env")
+	if config, err = loadConfig(path); err != nil || config.Token != "from-env" {
+		t.Fatalf("config = %+v, err = %v", config, err)
+	}
+
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil {
+		t.Fatal("expected a world-readable config file to be refused")
+	}
+}
+
+func TestParseArguments(t *testing.T) {
+	for input, want := range map[string]int{"0": 0, "512": 512, "512K": 512 << 10, "2M": 2 << 20, "1.5MiB/s": 3 << 19, "1g": 1 << 30} {
+		if got, err := parseRate(input); err != nil || got != want {
+			t.Errorf("parseRate(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+	if _, err := parseRate("fast"); err == nil {
+		t.Error("expected an invalid rate to be rejected")
+	}
+
+	indices, err := parseIndices([]string{"0,2-4", "7"})
+	if err != nil || len(indices) != 5 || indices[1] != 2 || indices[4] != 7 {
+		t.Fatalf("parseIndices = %v, %v", indices, err)
+	}
+	if _, err := parseIndices([]string{"4-2"}); err == nil {
+		t.Error("expected a reversed range to be rejected")
+	}
+}
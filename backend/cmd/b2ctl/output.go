@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// print writes v as indented JSON with -json, and otherwise lets table
+// write it for people.
+func (a *app) print(v interface{}, table func(w io.Writer)) error {
+	if a.json {
+		encoder := json.NewEncoder(a.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// row writes tab-separated cells as one table line.
+func row(w io.Writer, cells ...interface{}) {
+	for i, cell := range cells {
+		if i > 0 {
+			io.WriteString(w, "\t")
+		}
+		fmt.Fprint(w, cell)
+	}
+	io.WriteString(w, "\n")
+}
+
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+
+// formatBytes renders a size with a binary unit, e.g. "1.5 GiB".
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(byteUnits)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", value, byteUnits[unit])
+}
+
+func formatRate(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return formatBytes(n) + "/s"
+}
+
+// formatLimit renders a rate limit, where zero means unlimited.
+func formatLimit(n int) string {
+	if n == 0 {
+		return "unlimited"
+	}
+	return formatBytes(int64(n)) + "/s"
+}
+
+func formatProgress(percent float64) string {
+	return fmt.Sprintf("%.1f%%", math.Min(percent, 100))
+}
+
+func formatETA(seconds int64) string {
+	if seconds <= 0 {
+		return "-"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// parseRate reads a rate in bytes per second with an optional binary unit:
+// "0" (unlimited), "512K", "2M" or "1.5G".
+func parseRate(value string) (int, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "/S"), "B")
+	text = strings.TrimSuffix(text, "I")
+	multiplier := 1.0
+	if text != "" {
+		switch text[len(text)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			text = text[:len(text)-1]
+		}
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || number < 0 || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("invalid rate %q: use bytes per second, optionally with K, M or G", value)
+	}
+	rate := number * multiplier
+	if rate >= 1<<53 {
+		return 0, fmt.Errorf("rate %q is too large", value)
+	}
+	return int(rate), nil
+}
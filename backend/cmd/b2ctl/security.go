@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/pkg/client"
+	"go.uber.org/zap"
+)
+
+// cleanupConfirmation is the phrase the backend requires before it deletes
+// local data.
+const cleanupConfirmation = "DELETE_ALL_LOCAL_DATA"
+
+// jobPollInterval is how often -wait checks on a background job.
+var jobPollInterval = time.Second
+
+func runSecurity(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	if err := parse(flags, args, 0, 1); err != nil {
+		return err
+	}
+	if flags.NArg() == 1 && flags.Arg(0) != "status" {
+		flags.Usage()
+		return errUsage
+	}
+
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+	status, err := a.api.GetSecurityStatus(reqCtx)
+	if err != nil {
+		return err
+	}
+	return a.print(status, func(w io.Writer) {
+		leaks := "unknown"
+		if status.LeaksDetected != nil {
+			leaks = fmt.Sprint(*status.LeaksDetected)
+		}
+		killSwitch := "off"
+		if status.KillSwitchActive {
+			killSwitch = status.KillSwitchMode
+			if status.KillSwitchTriggered {
+				killSwitch += ", triggered"
+			}
+		}
+		row(w, "Security score:", status.SecurityScore)
+		row(w, "Connection:", status.ConnectionType)
+		row(w, "Proxy:", fmt.Sprintf("required %s, available %s", yesNo(status.ProxyRequired), yesNo(status.ProxyAvailable)))
+		row(w, "Kill switch:", killSwitch)
+		row(w, "Network suspended:", yesNo(status.NetworkSuspended))
+		row(w, "Leaks detected:", leaks)
+		row(w, "DNS protection:", yesNo(status.DNSProtectionActive))
+		row(w, "IP obfuscation:", yesNo(status.IPObfuscationActive))
+		row(w, "DNS obfuscation:", yesNo(status.DNSObfuscationActive))
+		row(w, "DHT invisible:", yesNo(status.DHTInvisible))
+		row(w, "Sharing disabled:", yesNo(status.SharingDisabled))
+		row(w, "Forced encryption:", yesNo(status.ForceEncryptionActive))
+		row(w, "Plaintext peers rejected:", yesNo(status.RejectPlaintextActive))
+		row(w, "No-logs mode:", yesNo(status.NoLogsMode))
+		row(w, "Last check:", status.LastCheck)
+	})
+}
+
+func runKillSwitch(ctx context.Context, a *app, args []string) error {
+	action := "status"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+
+	flags := a.newFlags()
+	var mode, reason *string
+	if action == "trigger" {
+		mode = flags.String("mode", "hard", "soft suspends network activity; hard also removes every torrent")
+		reason = flags.String("reason", "", "reason recorded with the trigger")
+	}
+	if err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+	var response *client.KillSwitchResponse
+	var err error
+	switch action {
+	case "status":
+		response, err = a.api.GetKillSwitchStatus(reqCtx)
+	case "trigger":
+		response, err = a.api.TriggerKillSwitch(reqCtx, client.KillSwitchRequest{Mode: *mode, Reason: *reason})
+	case "reset":
+		response, err = a.api.ResetKillSwitch(reqCtx)
+	default:
+		flags.Usage()
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	return a.print(response, func(w io.Writer) {
+		status := response.KillSwitch
+		if response.Message != "" {
+			row(w, "Message:", response.Message)
+		}
+		row(w, "Enabled:", yesNo(status.Enabled))
+		row(w, "Mode:", status.Mode)
+		row(w, "Triggered:", yesNo(status.Triggered))
+		if status.Triggered {
+			row(w, "Triggered at:", formatTime(status.TriggeredAt))
+			row(w, "Triggered mode:", status.TriggeredMode)
+			row(w, "Reason:", status.Reason)
+		}
+		row(w, "Violations:", fmt.Sprintf("%d of %d", status.Violations, status.MaxViolations))
+		row(w, "Network suspended:", yesNo(response.NetworkSuspended))
+	})
+}
+
+func runEncrypt(ctx context.Context, a *app, args []string) error {
+	return runCrypt(ctx, a, args, true)
+}
+
+func runDecrypt(ctx context.Context, a *app, args []string) error {
+	return runCrypt(ctx, a, args, false)
+}
+
+// runCrypt submits an encryption or decryption job. The password is read
+// from a file, standard input or B2CTL_PASSWORD, never from the command
+// line, where other users could see it.
+func runCrypt(ctx context.Context, a *app, args []string, encrypt bool) error {
+	flags := a.newFlags()
+	keyring := flags.Bool("keyring", false, "use a keyring data key instead of a password")
+	passwordFile := flags.String("password-file", "", "read the password from this file, or from standard input for - (default $B2CTL_PASSWORD)")
+	wait := flags.Bool("wait", false, "wait for the job to finish")
+	var algorithm, keyDerivation, hashAlgorithm *string
+	if encrypt {
+		algorithm = flags.String("algorithm", "", "encryption algorithm (default: the server's)")
+		keyDerivation = flags.String("kdf", "", "key derivation function (default: the server's)")
+		hashAlgorithm = flags.String("hash", "", "integrity hash algorithm (default: the server's)")
+	}
+	if err := parse(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	req := client.EncryptRequest{FilePath: flags.Arg(0), UseKeyring: *keyring}
+	if encrypt {
+		req.Algorithm, req.KeyDerivation, req.HashAlgorithm = *algorithm, *keyDerivation, *hashAlgorithm
+	}
+	if !*keyring {
+		password, err := readPassword(a, *passwordFile)
+		if err != nil {
+			return err
+		}
+		req.Password = password
+	}
+
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+	submit := a.api.DecryptFile
+	if encrypt {
+		submit = a.api.EncryptFile
+	}
+	job, err := submit(reqCtx, req)
+	if err != nil {
+		return err
+	}
+	if *wait {
+		if job, err = a.waitJob(ctx, job); err != nil {
+			return err
+		}
+	}
+	return a.printJob(job)
+}
+
+func readPassword(a *app, path string) (string, error) {
+	var password string
+	switch path {
+	case "":
+		password = os.Getenv("B2CTL_PASSWORD")
+		if password == "" {
+			return "", fmt.Errorf("no password: use -keyring, -password-file or B2CTL_PASSWORD")
+		}
+		return password, nil
+	case "-":
+		line, err := bufio.NewReader(a.in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		password = line
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		password = string(data)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("the password is empty")
+	}
+	return password, nil
+}
+
+// runKeygen writes a new recipient private key to a file only the user can
+// read and prints the public key to set as auto_encrypt_recipient. The
+// private key never goes to the server.
+func runKeygen(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	if err := parse(flags, args, 1, 1); err != nil {
+		return err
+	}
+	public, private, err := security.GenerateRecipientKey()
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(flags.Arg(0), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(file, private.String()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintln(a.out, public.String())
+	return nil
+}
+
+// runOpen decrypts a recipient-encrypted file on this machine with the
+// private key written by keygen.
+func runOpen(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	keyFile := flags.String("key-file", "", "private key written by b2ctl keygen")
+	if err := parse(flags, args, 2, 2); err != nil {
+		return err
+	}
+	if *keyFile == "" {
+		flags.Usage()
+		return errUsage
+	}
+	data, err := os.ReadFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	private, err := security.ParseRecipientKey(string(data))
+	if err != nil {
+		return err
+	}
+	em := security.NewEncryptionManager(&security.EncryptionConfig{}, zap.NewNop())
+	em.SetRecipientPrivateKey(private)
+	return em.DecryptFileContext(ctx, flags.Arg(0), flags.Arg(1), "", nil)
+}
+
+func runCleanup(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	yes := flags.Bool("yes", false, "confirm that every torrent and local record should be deleted")
+	deleteDownloads := flags.Bool("delete-downloads", false, "also delete downloaded files")
+	wait := flags.Bool("wait", false, "wait for the cleanup to finish")
+	if err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if !*yes {
+		return fmt.Errorf("cleanup deletes every torrent and local record; pass -yes to confirm")
+	}
+
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+	job, err := a.api.CleanupData(reqCtx, client.CleanupRequest{Confirm: cleanupConfirmation, DeleteDownloads: *deleteDownloads})
+	if err != nil {
+		return err
+	}
+	if *wait {
+		if job, err = a.waitJob(ctx, job); err != nil {
+			return err
+		}
+	}
+	return a.printJob(job)
+}
+
+// waitJob polls a job until it stops running. A job that did not succeed is
+// returned with an error.
+func (a *app) waitJob(ctx context.Context, job *client.Job) (*client.Job, error) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for !jobDone(job) {
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+		reqCtx, cancel := a.request(ctx)
+		next, err := a.api.GetJob(reqCtx, job.ID)
+		cancel()
+		if err != nil {
+			return job, err
+		}
+		job = next
+	}
+	if job.Status != "succeeded" {
+		message := job.Status
+		if job.Error != "" {
+			message += ": " + job.Error
+		}
+		return job, fmt.Errorf("job %s %s", job.ID, message)
+	}
+	return job, nil
+}
+
+func jobDone(job *client.Job) bool {
+	switch job.Status {
+	case "succeeded", "failed", "cancelled":
+		return true
+	}
+	return false
+}
+
+func (a *app) printJob(job *client.Job) error {
+	return a.print(job, func(w io.Writer) {
+		row(w, "Job:", job.ID)
+		row(w, "Kind:", job.Kind)
+		row(w, "Status:", job.Status)
+		if job.TotalBytes > 0 {
+			row(w, "Progress:", fmt.Sprintf("%s of %s", formatBytes(job.ProgressBytes), formatBytes(job.TotalBytes)))
+		}
+		if job.Error != "" {
+			row(w, "Error:", job.Error)
+		}
+		if len(job.Result) > 0 {
+			row(w, "Result:", string(job.Result))
+		}
+	})
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/pkg/client"
+)
+
+// metadataTimeout covers the minute the backend waits for a magnet link's
+// metadata before it answers.
+const metadataTimeout = 90 * time.Second
+
+// torrentResult reports what a command did to one torrent.
+type torrentResult struct {
+	InfoHash string      `json:"infoHash"`
+	Message  string      `json:"message,omitempty"`
+	Job      *client.Job `json:"job,omitempty"`
+}
+
+func printResults(a *app, results []torrentResult) error {
+	return a.print(results, func(w io.Writer) {
+		for _, result := range results {
+			switch {
+			case result.Job != nil:
+				row(w, result.InfoHash, fmt.Sprintf("job %s %s", result.Job.ID, result.Job.Status))
+			default:
+				row(w, result.InfoHash, result.Message)
+			}
+		}
+	})
+}
+
+func runAdd(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	if err := parse(flags, args, 1, -1); err != nil {
+		return err
+	}
+
+	var results []torrentResult
+	for _, source := range flags.Args() {
+		var req client.AddTorrentRequest
+		if strings.HasPrefix(strings.ToLower(source), "magnet:") {
+			req.MagnetURI = source
+		} else {
+			data, err := readSource(a, source)
+			if err != nil {
+				return err
+			}
+			req.TorrentFile = data
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, max(a.timeout, metadataTimeout))
+		response, err := a.api.AddTorrent(reqCtx, req)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("add %s: %w", abbreviate(source), err)
+		}
+		results = append(results, torrentResult{InfoHash: response.InfoHash, Message: "added"})
+	}
+	return printResults(a, results)
+}
+
+// readSource reads a .torrent file, or standard input for "-".
+func readSource(a *app, path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(a.in)
+	}
+	return os.ReadFile(path)
+}
+
+// abbreviate shortens magnet links in error messages.
+func abbreviate(source string) string {
+	if len(source) > 60 {
+		return source[:57] + "..."
+	}
+	return source
+}
+
+func runList(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	status := flags.String("status", "", "only torrents with these comma-separated statuses, e.g. downloading,paused")
+	name := flags.String("name", "", "only torrents whose name contains this text")
+	favorite := flags.Bool("favorite", false, "only favorite torrents")
+	sortKey := flags.String("sort", "name", "sort by name, progress, size or status")
+	if err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	less, ok := torrentOrder[*sortKey]
+	if !ok {
+		return fmt.Errorf("unknown sort key %q: use name, progress, size or status", *sortKey)
+	}
+
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+	torrents, err := a.api.GetTorrents(reqCtx)
+	if err != nil {
+		return err
+	}
+	torrents = filterTorrents(torrents, *status, *name, *favorite)
+	sort.SliceStable(torrents, func(i, j int) bool { return less(torrents[i], torrents[j]) })
+	return a.print(torrents, func(w io.Writer) { torrentTable(w, torrents) })
+}
+
+var torrentOrder = map[string]func(a, b *client.TorrentInfo) bool{
+	"name":     func(a, b *client.TorrentInfo) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"progress": func(a, b *client.TorrentInfo) bool { return a.Progress > b.Progress },
+	"size":     func(a, b *client.TorrentInfo) bool { return a.Size > b.Size },
+	"status":   func(a, b *client.TorrentInfo) bool { return a.Status < b.Status },
+}
+
+func filterTorrents(torrents []*client.TorrentInfo, statuses, name string, favorite bool) []*client.TorrentInfo {
+	wanted := map[string]bool{}
+	for _, status := range strings.Split(statuses, ",") {
+		if status = strings.ToLower(strings.TrimSpace(status)); status != "" {
+			wanted[status] = true
+		}
+	}
+	name = strings.ToLower(name)
+
+	filtered := make([]*client.TorrentInfo, 0, len(torrents))
+	for _, t := range torrents {
+		switch {
+		case len(wanted) > 0 && !wanted[t.Status]:
+		case name != "" && !strings.Contains(strings.ToLower(t.Name), name):
+		case favorite && !t.Favorite:
+		default:
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
+
+func torrentTable(w io.Writer, torrents []*client.TorrentInfo) {
+	row(w, "INFOHASH", "NAME", "STATUS", "PROGRESS", "SIZE", "DOWN", "UP", "PEERS", "ETA")
+	for _, t := range torrents {
+		row(w, t.InfoHash, t.Name, t.Status, formatProgress(t.Progress), formatBytes(t.Size),
+			formatRate(t.DownloadSpeed), formatRate(t.UploadSpeed), t.Peers, formatETA(t.ETA))
+	}
+}
+
+func runInfo(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	if err := parse(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+	info, err := a.api.GetTorrent(reqCtx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return a.print(info, func(w io.Writer) { torrentDetails(w, info) })
+}
+
+func torrentDetails(w io.Writer, t *client.TorrentInfo) {
+	row(w, "Name:", t.Name)
+	row(w, "Info hash:", t.InfoHash)
+	row(w, "Status:", t.Status)
+	row(w, "Progress:", fmt.Sprintf("%s of %s", formatProgress(t.Progress), formatBytes(t.Size)))
+	row(w, "Downloaded:", formatBytes(t.Downloaded))
+	row(w, "Uploaded:", fmt.Sprintf("%s (ratio %.2f)", formatBytes(t.Uploaded), t.Ratio))
+	row(w, "Speed:", fmt.Sprintf("%s down, %s up", formatRate(t.DownloadSpeed), formatRate(t.UploadSpeed)))
+	row(w, "Peers:", fmt.Sprintf("%d (%d seeders)", t.Peers, t.Seeders))
+	row(w, "ETA:", formatETA(t.ETA))
+	row(w, "Limits:", fmt.Sprintf("%s down, %s up", formatLimit(t.DownloadLimit), formatLimit(t.UploadLimit)))
+	row(w, "Favorite:", yesNo(t.Favorite))
+	for _, file := range t.Files {
+		status := file.Status
+		if file.Error != "" {
+			status += ": " + file.Error
+		}
+		row(w, "Processed:", fmt.Sprintf("%s (%s)", file.Path, status))
+	}
+}
+
+func runPause(ctx context.Context, a *app, args []string) error {
+	return eachTorrent(ctx, a, args, a.api.PauseTorrent)
+}
+
+func runResume(ctx context.Context, a *app, args []string) error {
+	return eachTorrent(ctx, a, args, a.api.ResumeTorrent)
+}
+
+// eachTorrent calls action for every info hash in args, stopping at the
+// first error.
+func eachTorrent(ctx context.Context, a *app, args []string, action func(context.Context, string) (*client.MessageResponse, error)) error {
+	flags := a.newFlags()
+	if err := parse(flags, args, 1, -1); err != nil {
+		return err
+	}
+
+	var results []torrentResult
+	for _, infoHash := range flags.Args() {
+		reqCtx, cancel := a.request(ctx)
+		response, err := action(reqCtx, infoHash)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %w", infoHash, err)
+		}
+		results = append(results, torrentResult{InfoHash: infoHash, Message: response.Message})
+	}
+	return printResults(a, results)
+}
+
+func runRemove(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	wipe := flags.Bool("wipe", false, "securely delete the downloaded data")
+	passes := flags.Int("passes", 0, "overwrite passes for -wipe, from 3 to 35 (default: the server's)")
+	wait := flags.Bool("wait", false, "wait for the wipe to finish")
+	if err := parse(flags, args, 1, -1); err != nil {
+		return err
+	}
+	if !*wipe && (*passes != 0 || *wait) {
+		return fmt.Errorf("-passes and -wait only apply with -wipe")
+	}
+
+	var results []torrentResult
+	for _, infoHash := range flags.Args() {
+		reqCtx, cancel := a.request(ctx)
+		result, err := a.api.DeleteTorrent(reqCtx, infoHash, &client.DeleteTorrentParams{Wipe: *wipe, Passes: *passes})
+		cancel()
+		if err != nil {
+			return fmt.Errorf("%s: %w", infoHash, err)
+		}
+
+		entry := torrentResult{InfoHash: infoHash}
+		switch {
+		case result.Accepted != nil:
+			entry.Job = result.Accepted
+			if *wait {
+				if entry.Job, err = a.waitJob(ctx, result.Accepted); err != nil {
+					return fmt.Errorf("%s: %w", infoHash, err)
+				}
+			}
+		case result.OK != nil:
+			entry.Message = result.OK.Message
+		}
+		results = append(results, entry)
+	}
+	return printResults(a, results)
+}
+
+func runLimits(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	down := flags.String("down", "0", "download limit in bytes per second, e.g. 2M; 0 is unlimited")
+	up := flags.String("up", "0", "upload limit in bytes per second, e.g. 512K; 0 is unlimited")
+	if err := parse(flags, args, 0, 1); err != nil {
+		return err
+	}
+	var req client.RateLimitsRequest
+	var err error
+	if req.DownloadLimit, err = parseRate(*down); err != nil {
+		return err
+	}
+	if req.UploadLimit, err = parseRate(*up); err != nil {
+		return err
+	}
+
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+	var response *client.MessageResponse
+	target := "global"
+	if flags.NArg() == 1 {
+		target = flags.Arg(0)
+		response, err = a.api.SetTorrentLimits(reqCtx, target, req)
+	} else {
+		response, err = a.api.SetGlobalLimits(reqCtx, req)
+	}
+	if err != nil {
+		return err
+	}
+	return a.print(response, func(w io.Writer) {
+		row(w, target, fmt.Sprintf("%s down, %s up", formatLimit(req.DownloadLimit), formatLimit(req.UploadLimit)))
+	})
+}
+
+func runFiles(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	if err := parse(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+	files, err := a.api.GetTorrentFiles(reqCtx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return a.print(files, func(w io.Writer) { fileTable(w, files) })
+}
+
+func fileTable(w io.Writer, files []client.TorrentFile) {
+	row(w, "INDEX", "PRIORITY", "PROGRESS", "SIZE", "PATH")
+	for _, f := range files {
+		row(w, f.Index, f.Priority, formatProgress(f.Progress), formatBytes(f.Size), f.Path)
+	}
+}
+
+func runPriority(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	if err := parse(flags, args, 3, -1); err != nil {
+		return err
+	}
+	indices, err := parseIndices(flags.Args()[2:])
+	if err != nil {
+		return err
+	}
+
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+	req := client.FilePriorityRequest{Files: indices, Priority: flags.Arg(1)}
+	response, err := a.api.SetFilePriority(reqCtx, flags.Arg(0), req)
+	if err != nil {
+		return err
+	}
+	return printResults(a, []torrentResult{{InfoHash: flags.Arg(0), Message: response.Message}})
+}
+
+// parseIndices reads file indices given one by one, comma-separated or as
+// ranges such as 2-5.
+func parseIndices(args []string) ([]int, error) {
+	var indices []int
+	for _, arg := range args {
+		for _, part := range strings.Split(arg, ",") {
+			if part == "" {
+				continue
+			}
+			first, last, isRange := strings.Cut(part, "-")
+			start, err := strconv.Atoi(first)
+			end := start
+			if err == nil && isRange {
+				end, err = strconv.Atoi(last)
+			}
+			if err != nil || start < 0 || end < start {
+				return nil, fmt.Errorf("invalid file index %q", part)
+			}
+			for i := start; i <= end; i++ {
+				indices = append(indices, i)
+			}
+		}
+	}
+	return indices, nil
+}
+
+func runWatch(ctx context.Context, a *app, args []string) error {
+	flags := a.newFlags()
+	interval := flags.Duration("interval", 2*time.Second, "time between refreshes")
+	count := flags.Int("n", 0, "stop after this many refreshes; 0 runs until interrupted")
+	if err := parse(flags, args, 0, 1); err != nil {
+		return err
+	}
+	if *interval < 100*time.Millisecond {
+		return fmt.Errorf("-interval must be at least 100ms")
+	}
+	clear := !a.json && isTerminal(a.out)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for refresh := 1; ; refresh++ {
+		if clear {
+			io.WriteString(a.out, "\033[H\033[2J")
+		}
+		if err := a.watchOnce(ctx, flags.Arg(0)); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if *count > 0 && refresh >= *count {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchOnce prints one refresh of watch. With -json every refresh is a
+// single line, so the output can be read as a stream.
+func (a *app) watchOnce(ctx context.Context, infoHash string) error {
+	reqCtx, cancel := a.request(ctx)
+	defer cancel()
+
+	var v interface{}
+	var table func(io.Writer)
+	if infoHash == "" {
+		torrents, err := a.api.GetTorrents(reqCtx)
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(torrents, func(i, j int) bool { return torrentOrder["name"](torrents[i], torrents[j]) })
+		v, table = torrents, func(w io.Writer) { torrentTable(w, torrents) }
+	} else {
+		info, err := a.api.GetTorrent(reqCtx, infoHash)
+		if err != nil {
+			return err
+		}
+		files, err := a.api.GetTorrentFiles(reqCtx, infoHash)
+		if err != nil && !client.IsStatus(err, http.StatusNotFound) {
+			return err
+		}
+		v = struct {
+			*client.TorrentInfo
+			TorrentFiles []client.TorrentFile `json:"torrentFiles,omitempty"`
+		}{info, files}
+		table = func(w io.Writer) {
+			torrentDetails(w, info)
+			if len(files) > 0 {
+				io.WriteString(w, "\n")
+				fileTable(w, files)
+			}
+		}
+	}
+
+	if a.json {
+		return json.NewEncoder(a.out).Encode(v)
+	}
+	return a.print(v, table)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
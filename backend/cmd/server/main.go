@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,8 +14,20 @@ import (
 	"time"
 
 	"github.com/KFN002/B-2-Torrent/backend/internal/api"
+	"github.com/KFN002/B-2-Torrent/backend/internal/audit"
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
 	"github.com/KFN002/B-2-Torrent/backend/internal/database"
+	"github.com/KFN002/B-2-Torrent/backend/internal/feeds"
+	"github.com/KFN002/B-2-Torrent/backend/internal/jobs"
+	"github.com/KFN002/B-2-Torrent/backend/internal/metrics"
+	"github.com/KFN002/B-2-Torrent/backend/internal/middleware"
+	"github.com/KFN002/B-2-Torrent/backend/internal/search"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings"
+	"github.com/KFN002/B-2-Torrent/backend/internal/shutdown"
 	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"github.com/KFN002/B-2-Torrent/backend/internal/watchfolder"
+	"github.com/KFN002/B-2-Torrent/backend/pkg/cache"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -76,15 +89,45 @@ func getUserDownloadDir() string {
 	return downloadPath
 }
 
-func cleanupTempDirectories(logger *zap.Logger) {
+func cleanupTempDirectories() error {
+	var errs []error
 	for _, dir := range []string{tempDir, uploadDir} {
 		if dir == "" {
 			continue
 		}
 		if err := os.RemoveAll(dir); err != nil {
-			logger.Error("failed to remove temporary directory", zap.Error(err))
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// wipeDirectory securely wipes the contents of dir, keeping dir itself.
+func wipeDirectory(dir string, passes int) func(context.Context) error {
+	return func(ctx context.Context) error {
+		results, err := security.WipeDirContents(ctx, dir, passes, nil)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, result := range results {
+			if result.Error != "" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d file(s) could not be wiped", failed, len(results))
+		}
+		return nil
+	}
+}
+
+func envSeconds(key string, fallback int) time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || seconds <= 0 {
+		seconds = fallback
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 func getenvDefault(key, fallback string) string {
@@ -94,6 +137,70 @@ func getenvDefault(key, fallback string) string {
 	return fallback
 }
 
+// newRateLimiter builds the API rate limiter from RATE_LIMIT_DEFAULT,
+// RATE_LIMIT_ROUTES, TRUSTED_PROXIES and RATE_LIMIT_STORE. The returned cache is nil unless
+// buckets are kept in Redis.
+func newRateLimiter(logger *zap.Logger) (*middleware.RateLimiter, *cache.RedisCache, error) {
+	config := middleware.RateLimitConfig{Default: middleware.DefaultRateLimit}
+	if value := os.Getenv("RATE_LIMIT_DEFAULT"); value != "" {
+		limit, err := middleware.ParseRateLimit(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.Default = limit
+	}
+	routes, err := middleware.ParseRateLimitRoutes(os.Getenv("RATE_LIMIT_ROUTES"))
+	if err != nil {
+		return nil, nil, err
+	}
+	config.Routes = routes
+	if config.TrustedProxies, err = middleware.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES")); err != nil {
+		return nil, nil, err
+	}
+
+	switch store := getenvDefault("RATE_LIMIT_STORE", "memory"); store {
+	case "memory":
+		return middleware.NewRateLimiter(config, middleware.NewMemoryRateLimitStore(), logger), nil, nil
+	case "redis":
+		redisURL := os.Getenv("REDIS_URL")
+		if redisURL == "" {
+			return nil, nil, errors.New("RATE_LIMIT_STORE=redis requires REDIS_URL")
+		}
+		redisCache, err := cache.NewRedisCache(redisURL, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		store := middleware.NewRedisRateLimitStore(redisCache, logger)
+		return middleware.NewRateLimiter(config, store, logger), redisCache, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", store)
+	}
+}
+
+// newMetrics builds the /metrics registry unless METRICS_ENABLED is false.
+// Per-torrent series are off unless METRICS_PER_TORRENT is true, and are
+// dropped in no-logs mode unless METRICS_HIDE_TORRENTS_IN_NO_LOGS is false.
+func newMetrics(db *database.Database, tc *torrent.Client, ks *security.KillSwitch) (*metrics.Metrics, error) {
+	if getenvDefault("METRICS_ENABLED", "true") == "false" {
+		return nil, nil
+	}
+	registry := metrics.New()
+	collector := metrics.NewStateCollector(metrics.Sources{
+		Torrents:      tc,
+		KillSwitch:    ks.Status,
+		SecurityScore: func() int { return api.SecurityScore(tc) },
+		DBStats:       db.Stats,
+	}, metrics.Options{
+		PerTorrent:           getenvDefault("METRICS_PER_TORRENT", "false") == "true",
+		HideTorrentsInNoLogs: getenvDefault("METRICS_HIDE_TORRENTS_IN_NO_LOGS", "true") != "false",
+	})
+	if err := registry.Register(collector); err != nil {
+		return nil, err
+	}
+	tc.ObserveProxyDials(registry.ObserveProxyDial)
+	return registry, nil
+}
+
 func main() {
 	logger := initLogger()
 	defer logger.Sync()
@@ -140,7 +247,6 @@ func main() {
 	if err != nil {
 		logger.Fatal("failed to connect to database after bounded retries", zap.Error(err))
 	}
-	defer db.Close()
 
 	if os.Getenv("NO_LOGS_MODE") == "" {
 		_ = os.Setenv("NO_LOGS_MODE", "true")
@@ -166,10 +272,125 @@ func main() {
 	if err != nil {
 		logger.Fatal("failed to create torrent client", zap.Error(err))
 	}
-	defer torrentClient.Close()
 
-	router := api.SetupRouter(db, torrentClient, logger)
-	go api.StartSecurityMonitoring(db, torrentClient, logger)
+	storedSettings := settings.NewStore(db)
+	if mode, err := torrent.ParseEncryptionMode(storedSettings.String("encryption_mode")); err == nil {
+		torrentClient.SetEncryptionMode(mode)
+	}
+
+	killSwitch := security.NewKillSwitch(
+		logger,
+		api.KillSwitchTriggerAction(db, torrentClient, logger),
+		api.KillSwitchResetAction(torrentClient),
+	)
+	if !storedSettings.Bool("kill_switch_enabled") {
+		killSwitch.Disable()
+	}
+	if mode, err := security.ParseKillSwitchMode(storedSettings.String("kill_switch_mode")); err == nil {
+		killSwitch.SetMode(mode)
+	}
+	switch store := getenvDefault("SECURITY_EVENT_STORE", "memory"); store {
+	case "memory":
+		api.UseSecurityEventStore(security.NewMemoryEventStore(security.DefaultEventCapacity), logger)
+	case "postgres":
+		// Nothing reaches the table while no-logs mode is on, and what an
+		// earlier run stored is dropped once it is.
+		events := security.NewNoLogsEventStore(db, torrentClient.NoLogsMode)
+		if torrentClient.NoLogsMode() {
+			if err := events.PurgePersisted(); err != nil {
+				logger.Warn("failed to purge stored security events", zap.Error(err))
+			}
+		}
+		api.UseSecurityEventStore(events, logger)
+	default:
+		logger.Fatal("unknown SECURITY_EVENT_STORE", zap.String("store", store))
+	}
+	api.SubscribeSecurityEvents(api.KillSwitchEventFeed(killSwitch))
+	torrentClient.EgressGuard().OnRefusal(api.EgressLeakFeed)
+
+	keyring, err := security.NewKeyring(security.NewSettingsKeyringStore(db), logger)
+	if err != nil {
+		logger.Fatal("failed to load keyring", zap.Error(err))
+	}
+	duress, err := security.NewDuress(security.NewSettingsDuressStore(db))
+	if err != nil {
+		logger.Fatal("failed to load duress passphrase", zap.Error(err))
+	}
+	fields, _ := security.NewDataEncryption(keyring, logger)
+	db.SetFieldEncryption(fields)
+
+	sessionHours, _ := strconv.Atoi(getenvDefault("SESSION_TTL_HOURS", "12"))
+	accounts, err := auth.NewService(db, time.Duration(sessionHours)*time.Hour, logger)
+	if err != nil {
+		logger.Fatal("failed to load accounts", zap.Error(err))
+	}
+
+	auditLog, err := audit.NewLog(db, db, fields, torrentClient.NoLogsMode, logger)
+	if err != nil {
+		logger.Fatal("failed to load audit log", zap.Error(err))
+	}
+
+	feedManager := feeds.NewManager(db, db, torrentClient, torrentClient.HTTPClient(torrent.EgressCallerFeed), torrentClient.NoLogsMode, logger)
+	if torrentClient.NoLogsMode() {
+		if err := feedManager.KeepHistoryInMemory(); err != nil {
+			logger.Warn("failed to purge stored feed history", zap.Error(err))
+		}
+	}
+	searchManager := search.NewManager(db, torrentClient, torrentClient.HTTPClient(torrent.EgressCallerSearch), logger)
+
+	watchFolders, err := watchfolder.ParseFolders(os.Getenv("WATCH_FOLDERS"))
+	if err != nil {
+		logger.Fatal("invalid WATCH_FOLDERS", zap.Error(err))
+	}
+	var watcher *watchfolder.Watcher
+	if len(watchFolders) > 0 {
+		interval := envSeconds("WATCH_FOLDER_INTERVAL_SECONDS", int(watchfolder.DefaultInterval/time.Second))
+		if watcher, err = watchfolder.New(watchFolders, torrentClient, interval, logger); err != nil {
+			logger.Fatal("failed to start watch folders", zap.Error(err))
+		}
+	}
+
+	jobWorkers, _ := strconv.Atoi(getenvDefault("JOB_WORKERS", strconv.Itoa(jobs.DefaultWorkers)))
+	jobManager := jobs.NewManager(jobWorkers, jobs.DefaultQueueSize, logger)
+
+	rateLimiter, redisCache, err := newRateLimiter(logger)
+	if err != nil {
+		logger.Fatal("failed to configure rate limiting", zap.Error(err))
+	}
+
+	exitCheckURL := getenvDefault("TOR_EXIT_CHECK_URL", api.DefaultExitCheckURL)
+	if exitCheckURL == "off" {
+		exitCheckURL = ""
+	}
+	connectivity := api.NewConnectivityMonitor(api.ConnectivityConfig{
+		ExitCheckURL:      exitCheckURL,
+		ExitCheckInterval: envSeconds("TOR_EXIT_CHECK_INTERVAL_SECONDS", int(api.DefaultExitCheckInterval/time.Second)),
+		VPNInterface:      os.Getenv("VPN_INTERFACE"),
+	})
+
+	metricsRegistry, err := newMetrics(db, torrentClient, killSwitch)
+	if err != nil {
+		logger.Fatal("failed to configure metrics", zap.Error(err))
+	}
+
+	router := api.SetupRouter(api.Dependencies{
+		DB:            db,
+		TorrentClient: torrentClient,
+		KillSwitch:    killSwitch,
+		Connectivity:  connectivity,
+		Keyring:       keyring,
+		Duress:        duress,
+		Accounts:      accounts,
+		Audit:         auditLog,
+		Feeds:         feedManager,
+		Search:        searchManager,
+		WatchFolders:  watcher,
+		Jobs:          jobManager,
+		RateLimiter:   rateLimiter,
+		Metrics:       metricsRegistry,
+		Logger:        logger,
+	})
+	go api.StartSecurityMonitoring(db, torrentClient, killSwitch, connectivity, logger)
 
 	readTimeout, _ := strconv.Atoi(getenvDefault("HTTP_READ_TIMEOUT_SECONDS", "10"))
 	writeTimeout, _ := strconv.Atoi(getenvDefault("HTTP_WRITE_TIMEOUT_SECONDS", "10"))
@@ -186,6 +407,8 @@ func main() {
 		MaxHeaderBytes:    1 << 20,
 	}
 
+	server.RegisterOnShutdown(api.CloseSecurityEventStreams)
+
 	errCh := make(chan error, 1)
 	go func() {
 		logger.Info("server listening", zap.String("address", server.Addr))
@@ -204,17 +427,67 @@ func main() {
 		}
 	}
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Settings are read up front because the wipe steps remove them.
+	autoDelete := storedSettings.Bool("auto_delete_on_shutdown")
+	autoWipe := storedSettings.Bool("auto_wipe_on_exit")
+	passes := int(storedSettings.Int("secure_delete_passes"))
+
+	stepTimeout := envSeconds("SHUTDOWN_STEP_TIMEOUT_SECONDS", 10)
+	wipeTimeout := envSeconds("SHUTDOWN_WIPE_TIMEOUT_SECONDS", 120)
+	deadline := envSeconds("SHUTDOWN_TIMEOUT_SECONDS", 30)
+	if autoWipe {
+		deadline += wipeTimeout
+	}
 
-	autoDelete, _ := db.GetSetting("auto_delete_on_shutdown")
-	if autoDelete == "true" {
-		_ = db.ClearActiveTorrents()
-		_ = db.ClearUserSettings()
+	steps := shutdown.NewManager(deadline, logger)
+	steps.Add("drain-http", stepTimeout, server.Shutdown)
+	steps.Add("stop-jobs", stepTimeout, jobManager.Shutdown)
+	steps.Add("stop-feeds", stepTimeout, feedManager.Shutdown)
+	if watcher != nil {
+		steps.Add("stop-watch-folders", stepTimeout, watcher.Shutdown)
+	}
+	steps.Add("stop-torrents", stepTimeout, func(context.Context) error {
+		return torrentClient.Close()
+	})
+	steps.Add("flush-state", stepTimeout, func(context.Context) error {
+		if !autoDelete {
+			return nil
+		}
+		return errors.Join(db.ClearActiveTorrents(), db.ClearUserSettings())
+	})
+	if autoWipe {
+		logger.Warn("auto wipe on exit is enabled; wiping app data", zap.Int("passes", passes))
+		steps.Add("wipe-downloads", wipeTimeout, wipeDirectory(downloadDir, passes))
+		steps.Add("wipe-temp", stepTimeout, wipeDirectory(tempDir, passes))
+		steps.Add("wipe-uploads", stepTimeout, wipeDirectory(uploadDir, passes))
+		steps.Add("wipe-sessions", stepTimeout, func(context.Context) error {
+			return accounts.EndAllSessions()
+		})
+		steps.Add("wipe-settings", stepTimeout, func(context.Context) error {
+			return db.ClearUserSettings()
+		})
+	}
+	steps.Add("remove-temp-dirs", stepTimeout, func(context.Context) error {
+		return cleanupTempDirectories()
+	})
+	steps.Add("lock-keyring", stepTimeout, func(context.Context) error {
+		keyring.Lock()
+		return nil
+	})
+	steps.Add("close-database", stepTimeout, func(context.Context) error {
+		return db.Close()
+	})
+	if redisCache != nil {
+		steps.Add("close-redis", stepTimeout, func(context.Context) error {
+			return redisCache.Close()
+		})
 	}
 
-	cleanupTempDirectories(logger)
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		logger.Error("server shutdown error", zap.Error(err))
+	report := steps.Run(context.Background())
+	if err := report.Err(); err != nil {
+		logger.Error("shutdown completed with failures", zap.Error(err))
+		_ = logger.Sync()
+		os.Exit(1)
 	}
+	logger.Info("shutdown complete", zap.Int("steps", len(report.Steps)))
 }
@@ -40,24 +40,113 @@ INSERT INTO settings (key, value) VALUES
     ('max_connections', '200'),
     ('enable_tor', 'true'),
     ('download_path', '/data/downloads'),
-	('kill_switch_enabled', 'false'),
+	('kill_switch_enabled', 'true'),
+	('kill_switch_mode', 'soft'),
 	('dns_protection_enabled', 'false'),
 	('force_encryption', 'false'),
+	('encryption_mode', 'prefer'),
 	('reject_plaintext', 'false'),
+	('auto_encrypt_downloads', 'false'),
+	('auto_encrypt_algorithm', 'AES-256-GCM'),
+	('auto_encrypt_recipient', ''),
+	('secure_delete_passes', '3'),
     ('no_logs_mode', 'true'),
     ('obfuscate_traffic', 'true'),
     ('vpn_type', 'none')
 ON CONFLICT (key) DO NOTHING;
 
 -- These controls were previously stored as enabled although the runtime did
--- not enforce them. Fail closed for existing installations as well.
+-- not enforce them. Fail closed for existing installations as well. The kill
+-- switch is enforced and keeps whatever was stored.
 UPDATE settings SET value = 'false', updated_at = CURRENT_TIMESTAMP
-WHERE key IN ('kill_switch_enabled', 'dns_protection_enabled', 'force_encryption', 'reject_plaintext');
+WHERE key IN ('dns_protection_enabled', 'force_encryption', 'reject_plaintext');
 
 -- Magnet URIs can contain tracker URLs and user-supplied metadata. The client
 -- only needs the info hash after activation, so erase legacy values.
 UPDATE active_torrents SET magnet_uri = '' WHERE magnet_uri <> '';
 
+-- Torrent names are stored as b2k1 records once the keyring exists, which
+-- can exceed the original column width.
+ALTER TABLE active_torrents ALTER COLUMN name TYPE TEXT;
+
+-- User accounts. Passwords are stored as Argon2id hashes only.
+CREATE TABLE IF NOT EXISTS users (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(64) UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    role VARCHAR(16) NOT NULL CHECK (role IN ('admin', 'operator', 'viewer')),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Login sessions, keyed by the SHA-256 of the session cookie value.
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    csrf_token TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Scoped API tokens for automation, keyed by the SHA-256 of the secret.
+-- Revoking a token deletes its row.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    secret_hash CHAR(64) UNIQUE NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ
+);
+
+-- Security events, kept only when SECURITY_EVENT_STORE=postgres and pruned
+-- according to the retention settings.
+CREATE TABLE IF NOT EXISTS security_events (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(64) NOT NULL,
+    severity VARCHAR(16) NOT NULL,
+    message TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_created_at ON security_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_security_events_severity ON security_events(severity);
+
+-- Opt-in audit log of administrative actions. Payloads are sealed to the
+-- audit public key and each row is chained to the previous one by hash.
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq BIGINT PRIMARY KEY,
+    payload TEXT NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL
+);
+
+-- Items matched by feed rules. Nothing is written in no-logs mode; titles
+-- are sealed like torrent names and items are deduplicated by the SHA-256
+-- of their episode or GUID.
+CREATE TABLE IF NOT EXISTS feed_history (
+    id BIGSERIAL PRIMARY KEY,
+    feed_id VARCHAR(32) NOT NULL,
+    rule_id VARCHAR(32) NOT NULL,
+    title TEXT NOT NULL,
+    item_key CHAR(64) NOT NULL,
+    info_hash VARCHAR(40) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_feed_history_item_key ON feed_history(item_key);
+CREATE INDEX IF NOT EXISTS idx_feed_history_feed_id ON feed_history(feed_id);
+
 -- Add function to automatically clear old data periodically
 CREATE OR REPLACE FUNCTION cleanup_old_torrents()
 RETURNS void AS $$
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/audit"
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"go.uber.org/zap"
+)
+
+type UpdateAuditLogRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// AuditLogResponse is a page of decrypted entries, newest first.
+type AuditLogResponse struct {
+	audit.Status
+	Entries []audit.Entry `json:"entries"`
+}
+
+// recordAudit adds an entry for an administrative action taken by the
+// caller of r. It is a no-op while the audit log is off or no-logs mode is
+// on. Failures are reported but never undo the action.
+func recordAudit(auditLog *audit.Log, logger *zap.Logger, r *http.Request, action, target string, details map[string]string) {
+	if auditLog == nil {
+		return
+	}
+	actor := audit.Actor{Name: "anonymous"}
+	if id, ok := auth.IdentityFromContext(r.Context()); ok {
+		actor = audit.Actor{Name: id.User.Username, Method: id.Method}
+	}
+	if err := auditLog.Record(actor, action, target, details); err != nil {
+		logger.Error("Failed to write audit entry", zap.String("action", action), zap.Error(err))
+	}
+}
+
+func (h *Handlers) recordAudit(r *http.Request, action, target string, details map[string]string) {
+	recordAudit(h.auditLog, h.logger, r, action, target, details)
+}
+
+// GetAuditLog returns a page of audit entries, newest first. ?before= takes
+// the sequence number to page back from. Reading needs an unlocked keyring.
+func (h *Handlers) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	before, _ := strconv.ParseInt(r.URL.Query().Get("before"), 10, 64)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	entries, err := h.auditLog.Entries(before, limit)
+	if err != nil {
+		h.writeAuditError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, AuditLogResponse{Status: h.auditLog.Status(), Entries: entries})
+}
+
+// UpdateAuditLog turns the audit log on or off. Turning it on is refused
+// while no-logs mode is on, and the first time needs an unlocked keyring.
+func (h *Handlers) UpdateAuditLog(w http.ResponseWriter, r *http.Request) {
+	var req UpdateAuditLogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Enabled {
+		if err := h.auditLog.Enable(); err != nil {
+			h.writeAuditError(w, err)
+			return
+		}
+		h.recordAudit(r, "audit.enable", "", nil)
+	} else {
+		h.recordAudit(r, "audit.disable", "", nil)
+		if err := h.auditLog.Disable(); err != nil {
+			h.writeAuditError(w, err)
+			return
+		}
+	}
+	h.writeJSON(w, http.StatusOK, h.auditLog.Status())
+}
+
+// VerifyAuditLog checks the hash chain of the whole log.
+func (h *Handlers) VerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	result, err := h.auditLog.Verify()
+	if err != nil {
+		h.writeAuditError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+func (h *Handlers) writeAuditError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, audit.ErrNoLogsMode):
+		h.writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, security.ErrKeyringLocked):
+		h.writeError(w, http.StatusLocked, "Unlock the keyring to use the audit log")
+	case errors.Is(err, security.ErrKeyringNotInitialized):
+		h.writeError(w, http.StatusConflict, "Initialize the keyring to use the audit log")
+	default:
+		h.logger.Error("Audit log operation failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Audit log operation failed")
+	}
+}
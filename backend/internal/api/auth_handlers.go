@@ -0,0 +1,321 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+	"github.com/KFN002/B-2-Torrent/backend/internal/middleware"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// UpdateUserRequest changes a user's role, password or both; empty fields
+// are left unchanged.
+type UpdateUserRequest struct {
+	Role     string `json:"role"`
+	Password string `json:"password"`
+}
+
+// CreateTokenRequest describes a new API token. ExpiresAt is optional.
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// TokenSecretResponse carries a token secret, which is shown only once.
+type TokenSecretResponse struct {
+	Secret string         `json:"secret"`
+	Prefix string         `json:"prefix"`
+	Token  *auth.APIToken `json:"token,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// SessionResponse describes the caller of a request.
+type SessionResponse struct {
+	User      auth.User `json:"user"`
+	Method    string    `json:"method"`
+	CSRFToken string    `json:"csrfToken,omitempty"`
+	Accounts  bool      `json:"accounts"`
+}
+
+// SetupAccounts creates the first admin account. It is only reachable with
+// the legacy access rules, which end once an account exists.
+func (h *Handlers) SetupAccounts(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	user, err := h.accounts.Setup(req.Username, req.Password)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.recordAudit(r, "user.setup", user.Username, nil)
+	h.writeJSON(w, http.StatusCreated, user)
+}
+
+// Login checks the credentials and sets the session and CSRF cookies.
+func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	token, session, user, err := h.accounts.Login(req.Username, req.Password)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	middleware.SetSessionCookies(w, r, token, session)
+	h.writeJSON(w, http.StatusOK, SessionResponse{
+		User:      *user,
+		Method:    auth.MethodSession,
+		CSRFToken: session.CSRFToken,
+		Accounts:  true,
+	})
+}
+
+// Logout ends the caller's session and clears its cookies.
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	if id, ok := auth.IdentityFromContext(r.Context()); ok && id.Session != nil {
+		if err := h.accounts.Logout(id.Session); err != nil {
+			h.logger.Error("Failed to end session", zap.Error(err))
+			h.writeError(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+	middleware.ClearSessionCookies(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSession reports who the caller is and how they authenticated.
+func (h *Handlers) GetSession(w http.ResponseWriter, r *http.Request) {
+	id, _ := auth.IdentityFromContext(r.Context())
+	response := SessionResponse{User: id.User, Method: id.Method, Accounts: h.accounts.HasUsers()}
+	if id.Session != nil {
+		response.CSRFToken = id.Session.CSRFToken
+	}
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// ChangePassword lets a logged-in user replace their own password. Their
+// other sessions are ended.
+func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	id, _ := auth.IdentityFromContext(r.Context())
+	if id.Session == nil {
+		h.writeError(w, http.StatusBadRequest, "Password changes require a login session")
+		return
+	}
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := h.accounts.ChangePassword(id.Session, req.CurrentPassword, req.NewPassword); err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.recordAudit(r, "user.password", id.User.Username, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUsers returns every account.
+func (h *Handlers) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.accounts.ListUsers()
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, users)
+}
+
+// CreateUser adds an account with the given role.
+func (h *Handlers) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	user, err := h.accounts.CreateUser(req.Username, req.Password, role)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.recordAudit(r, "user.create", user.Username, map[string]string{"role": string(user.Role)})
+	h.writeJSON(w, http.StatusCreated, user)
+}
+
+// UpdateUser changes an account's role or password.
+func (h *Handlers) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.userID(w, r)
+	if !ok {
+		return
+	}
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	var role auth.Role
+	if req.Role != "" {
+		parsed, err := auth.ParseRole(req.Role)
+		if err != nil {
+			h.writeAccountError(w, err)
+			return
+		}
+		role = parsed
+	}
+	user, err := h.accounts.UpdateUser(id, role, req.Password)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.recordAudit(r, "user.update", user.Username, map[string]string{
+		"role":            string(user.Role),
+		"passwordChanged": strconv.FormatBool(req.Password != ""),
+	})
+	h.writeJSON(w, http.StatusOK, user)
+}
+
+// DeleteUser removes an account and ends its sessions.
+func (h *Handlers) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.userID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.accounts.DeleteUser(id); err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.recordAudit(r, "user.delete", strconv.FormatInt(id, 10), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListTokens returns every API token without its secret.
+func (h *Handlers) ListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.accounts.ListTokens()
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, tokens)
+}
+
+// GetTokenScopes lists the scopes a token can be granted.
+func (h *Handlers) GetTokenScopes(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, auth.Scopes())
+}
+
+// CreateToken issues an API token. The secret is only in this response.
+func (h *Handlers) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	scopes, err := auth.ParseScopes(req.Scopes)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	var createdBy int64
+	if id, ok := auth.IdentityFromContext(r.Context()); ok {
+		createdBy = id.User.ID
+	}
+	secret, token, err := h.accounts.CreateToken(req.Name, scopes, req.ExpiresAt, createdBy)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.recordAudit(r, "token.create", token.Name, map[string]string{
+		"id":     strconv.FormatInt(token.ID, 10),
+		"scopes": strings.Join(req.Scopes, " "),
+	})
+	h.writeJSON(w, http.StatusCreated, TokenSecretResponse{Secret: secret, Prefix: token.Prefix, Token: token})
+}
+
+// RotateToken replaces a token's secret and returns the new one.
+func (h *Handlers) RotateToken(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r, "Invalid token id")
+	if !ok {
+		return
+	}
+	secret, prefix, err := h.accounts.RotateToken(id)
+	if err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.recordAudit(r, "token.rotate", strconv.FormatInt(id, 10), nil)
+	h.writeJSON(w, http.StatusOK, TokenSecretResponse{Secret: secret, Prefix: prefix})
+}
+
+// RevokeToken deletes an API token; it stops working immediately.
+func (h *Handlers) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.pathID(w, r, "Invalid token id")
+	if !ok {
+		return
+	}
+	if err := h.accounts.RevokeToken(id); err != nil {
+		h.writeAccountError(w, err)
+		return
+	}
+	h.recordAudit(r, "token.revoke", strconv.FormatInt(id, 10), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) userID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	return h.pathID(w, r, "Invalid user id")
+}
+
+func (h *Handlers) pathID(w http.ResponseWriter, r *http.Request, message string) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id < 1 {
+		h.writeError(w, http.StatusBadRequest, message)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handlers) writeAccountError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		h.writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, auth.ErrInvalidUsername), errors.Is(err, auth.ErrWeakPassword), errors.Is(err, auth.ErrInvalidRole),
+		errors.Is(err, auth.ErrInvalidScope), errors.Is(err, auth.ErrNoScopes), errors.Is(err, auth.ErrTokenName), errors.Is(err, auth.ErrTokenExpiry):
+		h.writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, auth.ErrUserNotFound), errors.Is(err, auth.ErrTokenNotFound):
+		h.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, auth.ErrUserExists), errors.Is(err, auth.ErrLastAdmin), errors.Is(err, auth.ErrAlreadySetUp):
+		h.writeError(w, http.StatusConflict, err.Error())
+	default:
+		h.logger.Error("Account operation failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Account operation failed")
+	}
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/jobs"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"go.uber.org/zap"
+)
+
+// Settings that control the post-completion encryption pipeline.
+const (
+	autoEncryptSetting          = "auto_encrypt_downloads"
+	autoEncryptAlgorithmSetting = "auto_encrypt_algorithm"
+	autoEncryptRecipientSetting = "auto_encrypt_recipient"
+)
+
+type autoEncryptRequest struct {
+	InfoHash string `json:"infoHash"`
+}
+
+// autoEncryptCompleted starts the auto-encrypt job for a torrent that has
+// just finished downloading, when the pipeline is enabled.
+func (h *Handlers) autoEncryptCompleted(infoHash string) {
+	if !h.settings.Bool(autoEncryptSetting) {
+		return
+	}
+
+	params, _ := json.Marshal(autoEncryptRequest{InfoHash: infoHash})
+	fn, err := h.autoEncryptJob(params)
+	if err == nil {
+		_, err = h.jobs.jobs.Submit(jobKindAutoEncrypt, fn)
+	}
+	if err != nil {
+		h.logger.Warn("Automatic encryption not started", zap.String("infoHash", infoHash), zap.Error(err))
+		files, _ := h.torrentClient.CompletedFiles(infoHash)
+		for _, file := range files {
+			h.torrentClient.SetFileStatus(infoHash, torrent.FileStatus{
+				Path:   file.Path,
+				Size:   file.Size,
+				Status: torrent.FileStatusPending,
+				Error:  err.Error(),
+			})
+		}
+	}
+}
+
+// autoEncryptJob encrypts every file of a completed torrent with a keyring
+// data key, or to the configured recipient public key, verifies each output
+// and only then wipes the plaintext. It can also be submitted through
+// POST /jobs to retry a failed or skipped run.
+func (h *Handlers) autoEncryptJob(body json.RawMessage) (jobs.Func, error) {
+	var req autoEncryptRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.InfoHash == "" {
+		return nil, badJobRequest("infoHash is required")
+	}
+	files, err := h.torrentClient.CompletedFiles(req.InfoHash)
+	if err != nil {
+		return nil, &jobRequestError{status: http.StatusConflict, message: err.Error()}
+	}
+	var recipient *security.RecipientKey
+	if value := h.settings.String(autoEncryptRecipientSetting); value != "" {
+		if recipient, err = security.ParseRecipientKey(value); err != nil {
+			return nil, &jobRequestError{status: http.StatusConflict, message: autoEncryptRecipientSetting + ": " + err.Error()}
+		}
+	} else if !h.keyring.IsUnlocked() {
+		return nil, &jobRequestError{status: http.StatusLocked, message: "Keyring is locked"}
+	}
+
+	algorithm := h.settings.String(autoEncryptAlgorithmSetting)
+	em := security.NewEncryptionManager(&security.EncryptionConfig{
+		Algorithm:     algorithm,
+		KeyDerivation: "Argon2id",
+		HashAlgorithm: "SHA-256",
+	}, h.logger)
+	if recipient != nil {
+		em.SetRecipient(recipient)
+	} else {
+		em.SetKeyring(h.keyring)
+	}
+
+	return func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		defer em.ForgetRecipientKeys()
+		return h.runAutoEncrypt(ctx, req.InfoHash, files, em, progress)
+	}, nil
+}
+
+// runAutoEncrypt leaves every plaintext file in place unless all of them
+// were encrypted and verified; the torrent is released before any wipe so
+// the client neither serves nor re-downloads the removed data.
+func (h *Handlers) runAutoEncrypt(ctx context.Context, infoHash string, files []torrent.CompletedFile, em *security.EncryptionManager, progress *jobs.Progress) (interface{}, error) {
+	passes := h.wipePasses(0)
+	statuses := make([]torrent.FileStatus, len(files))
+	var total int64
+	for i, file := range files {
+		statuses[i] = torrent.FileStatus{Path: file.Path, Size: file.Size, Status: torrent.FileStatusPending}
+		h.torrentClient.SetFileStatus(infoHash, statuses[i])
+		total += file.Size * int64(1+passes)
+	}
+	progress.SetTotal(total)
+
+	update := func(i int, status string, err error) {
+		statuses[i].Status = status
+		statuses[i].Error = ""
+		if err != nil {
+			statuses[i].Error = err.Error()
+		}
+		h.torrentClient.SetFileStatus(infoHash, statuses[i])
+	}
+
+	failed := 0
+	plaintextPaths := make([]string, len(files))
+	for i, file := range files {
+		path, err := h.encryptCompletedFile(ctx, em, &statuses[i], file, progress, func(status string) { update(i, status, nil) })
+		if err != nil {
+			update(i, torrent.FileStatusFailed, err)
+			failed++
+			continue
+		}
+		plaintextPaths[i] = path
+	}
+	if failed > 0 {
+		h.logger.Warn("Automatic encryption incomplete, plaintext kept",
+			zap.String("infoHash", infoHash),
+			zap.Int("failed", failed),
+		)
+		return statuses, fmt.Errorf("%d of %d file(s) could not be encrypted; plaintext was kept", failed, len(files))
+	}
+
+	if err := h.torrentClient.ReleaseTorrent(infoHash); err != nil {
+		return statuses, fmt.Errorf("failed to release torrent before wiping: %w", err)
+	}
+
+	for i, path := range plaintextPaths {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			update(i, torrent.FileStatusEncrypted, nil)
+			progress.Add(files[i].Size * int64(passes))
+			continue
+		}
+		update(i, torrent.FileStatusWiping, nil)
+		if err := security.WipeFile(ctx, path, passes, progress.Add); err != nil {
+			update(i, torrent.FileStatusFailed, fmt.Errorf("encrypted but failed to wipe plaintext: %w", err))
+			failed++
+			continue
+		}
+		update(i, torrent.FileStatusEncrypted, nil)
+	}
+	if failed > 0 {
+		return statuses, fmt.Errorf("%d of %d plaintext file(s) could not be wiped", failed, len(files))
+	}
+
+	h.logger.Info("Completed download encrypted", zap.String("infoHash", infoHash), zap.Int("files", len(files)))
+	return statuses, nil
+}
+
+// encryptCompletedFile writes and verifies the .b2encrypted output for one
+// file and returns the plaintext path to wipe. An output left by an earlier
+// run is reused only if it verifies; a fresh output that fails verification
+// is removed so a retry starts over. A recipient-encrypted output from an
+// earlier run cannot be verified without the private key: it is replaced
+// while the plaintext exists, and otherwise kept, since the plaintext is
+// only wiped after every output verified.
+func (h *Handlers) encryptCompletedFile(ctx context.Context, em *security.EncryptionManager, status *torrent.FileStatus, file torrent.CompletedFile, progress *jobs.Progress, setStatus func(string)) (string, error) {
+	path, err := normalizeUserFilePath(file.Path)
+	if err != nil {
+		return "", err
+	}
+	outputPath := path + ".b2encrypted"
+	status.EncryptedPath = outputPath
+
+	created := false
+	_, plainErr := os.Lstat(path)
+	_, outErr := os.Lstat(outputPath)
+	switch {
+	case outErr == nil:
+		progress.Add(file.Size)
+	case os.IsNotExist(plainErr):
+		return "", fmt.Errorf("downloaded file is missing")
+	default:
+		if err := encryptOutput(ctx, em, path, outputPath, progress, setStatus); err != nil {
+			return "", err
+		}
+		created = true
+	}
+
+	setStatus(torrent.FileStatusVerifying)
+	size, err := em.VerifyFile(ctx, outputPath, "")
+	if !created && errors.Is(err, security.ErrRecipientKeyUnavailable) {
+		if os.IsNotExist(plainErr) {
+			return path, nil
+		}
+		if err := os.Remove(outputPath); err != nil {
+			return "", fmt.Errorf("failed to replace earlier output: %w", err)
+		}
+		progress.Add(-file.Size)
+		if err := encryptOutput(ctx, em, path, outputPath, progress, setStatus); err != nil {
+			return "", err
+		}
+		created = true
+		setStatus(torrent.FileStatusVerifying)
+		size, err = em.VerifyFile(ctx, outputPath, "")
+	}
+	if err == nil && size != file.Size {
+		err = fmt.Errorf("holds %d bytes, expected %d", size, file.Size)
+	}
+	if err != nil {
+		if created && ctx.Err() == nil {
+			_ = os.Remove(outputPath)
+		}
+		return "", fmt.Errorf("encrypted output failed verification: %w", err)
+	}
+	return path, nil
+}
+
+func encryptOutput(ctx context.Context, em *security.EncryptionManager, path, outputPath string, progress *jobs.Progress, setStatus func(string)) error {
+	setStatus(torrent.FileStatusEncrypting)
+	if err := em.EncryptFileContext(ctx, path, outputPath, "", progress.Add); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("encryption failed: %w", err)
+	}
+	return nil
+}
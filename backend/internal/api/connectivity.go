@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/database"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultExitCheckURL answers with the caller's address and whether it
+	// is a Tor exit.
+	DefaultExitCheckURL      = "https://check.torproject.org/api/ip"
+	DefaultExitCheckInterval = 5 * time.Minute
+	connectivityCheckTimeout = 10 * time.Second
+)
+
+// ConnectivityConfig controls the Tor and VPN checks run by
+// StartSecurityMonitoring. An empty ExitCheckURL turns the exit check off,
+// and an empty VPNInterface leaves the VPN unchecked.
+type ConnectivityConfig struct {
+	ExitCheckURL      string
+	ExitCheckInterval time.Duration
+	VPNInterface      string
+}
+
+// ConnectivityStatus is the latest settled result of each check.
+type ConnectivityStatus struct {
+	Tor           security.LinkStatus `json:"tor"`
+	VPN           security.LinkStatus `json:"vpn"`
+	VPNInterface  string              `json:"vpnInterface,omitempty"`
+	Exit          *torrent.ExitInfo   `json:"exit,omitempty"`
+	ExitError     string              `json:"exitError,omitempty"`
+	ExitCheckedAt *time.Time          `json:"exitCheckedAt,omitempty"`
+}
+
+// ConnectivityMonitor turns raw check results into events on state
+// changes. Every failed round still counts against the kill switch, so a
+// link that stays down trips it as before.
+type ConnectivityMonitor struct {
+	config ConnectivityConfig
+	tor    *security.LinkMonitor
+	vpn    *security.LinkMonitor
+
+	mu            sync.RWMutex
+	exit          *torrent.ExitInfo
+	exitError     string
+	exitCheckedAt time.Time
+}
+
+func NewConnectivityMonitor(config ConnectivityConfig) *ConnectivityMonitor {
+	if config.ExitCheckInterval <= 0 {
+		config.ExitCheckInterval = DefaultExitCheckInterval
+	}
+	return &ConnectivityMonitor{
+		config: config,
+		tor:    security.NewLinkMonitor(security.DefaultFailuresToDown, security.DefaultSuccessesToUp),
+		vpn:    security.NewLinkMonitor(security.DefaultFailuresToDown, security.DefaultSuccessesToUp),
+	}
+}
+
+// check runs one round of checks and reports whether every required link
+// worked.
+func (m *ConnectivityMonitor) check(db *database.Database, tc *torrent.Client, ks *security.KillSwitch, logger *zap.Logger) bool {
+	healthy := true
+	now := time.Now()
+
+	if tc.IsTorEnabled() {
+		ctx, cancel := context.WithTimeout(context.Background(), connectivityCheckTimeout)
+		err := tc.CheckProxyChain(ctx)
+		cancel()
+		if err != nil {
+			healthy = false
+			ks.RecordViolation("Tor connection lost")
+		}
+		previous := m.tor.Status().State
+		switch state, changed := m.tor.Observe(err, now); {
+		case changed && state == security.LinkDown:
+			AddSecurityEvent("tor_disconnected", "critical", "Tor connection lost", err.Error())
+		case changed && previous == security.LinkDown:
+			AddSecurityEvent("tor_reconnected", "info", "Tor connection restored", "The canary is reachable through the proxy chain again")
+		}
+		if err == nil {
+			m.checkExit(tc, now, logger)
+		}
+	} else {
+		m.tor.Reset()
+	}
+
+	vpnType := settings.NewStore(db).String("vpn_type")
+	if vpnType != "" && vpnType != "none" && m.config.VPNInterface != "" {
+		err := security.CheckInterface(m.config.VPNInterface)
+		if err != nil {
+			healthy = false
+			ks.RecordViolation("VPN connection lost")
+		}
+		previous := m.vpn.Status().State
+		switch state, changed := m.vpn.Observe(err, now); {
+		case changed && state == security.LinkDown:
+			AddSecurityEvent("vpn_disconnected", "critical", "VPN connection lost", err.Error())
+		case changed && previous == security.LinkDown:
+			AddSecurityEvent("vpn_reconnected", "info", "VPN connection restored", fmt.Sprintf("Interface %s is up", m.config.VPNInterface))
+		}
+	} else {
+		m.vpn.Reset()
+	}
+
+	return healthy
+}
+
+// checkExit asks the exit check endpoint, through the chain, where traffic
+// leaves it. It runs at most once per ExitCheckInterval and raises an event
+// when the exit stops or starts being a known Tor exit.
+func (m *ConnectivityMonitor) checkExit(tc *torrent.Client, now time.Time, logger *zap.Logger) {
+	m.mu.RLock()
+	due := m.config.ExitCheckURL != "" && now.Sub(m.exitCheckedAt) >= m.config.ExitCheckInterval
+	previous := m.exit
+	m.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectivityCheckTimeout)
+	info, err := tc.TorExit(ctx, m.config.ExitCheckURL)
+	cancel()
+
+	m.mu.Lock()
+	m.exitCheckedAt = now
+	if err != nil {
+		m.exitError = err.Error()
+		m.mu.Unlock()
+		logger.Warn("Tor exit check failed", zap.Error(err))
+		return
+	}
+	m.exit = &info
+	m.exitError = ""
+	m.mu.Unlock()
+
+	wasTor := previous == nil || previous.IsTor == nil || *previous.IsTor
+	switch isTor := info.IsTor == nil || *info.IsTor; {
+	case wasTor && !isTor:
+		AddSecurityEvent("tor_exit_unverified", "critical", "Traffic is not leaving through Tor", "The exit check did not recognise the exit address as a Tor exit")
+	case !wasTor && isTor:
+		AddSecurityEvent("tor_exit_verified", "info", "Traffic is leaving through Tor again", "The exit check recognised the exit address as a Tor exit")
+	}
+}
+
+func (m *ConnectivityMonitor) Status() ConnectivityStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := ConnectivityStatus{
+		Tor:          m.tor.Status(),
+		VPN:          m.vpn.Status(),
+		VPNInterface: m.config.VPNInterface,
+		Exit:         m.exit,
+		ExitError:    m.exitError,
+	}
+	if !m.exitCheckedAt.IsZero() {
+		checkedAt := m.exitCheckedAt
+		status.ExitCheckedAt = &checkedAt
+	}
+	return status
+}
+
+// monitorCountedEvent reports whether the monitor already counts every
+// failed round of this event's check against the kill switch.
+func monitorCountedEvent(eventType string) bool {
+	return eventType == "tor_disconnected" || eventType == "vpn_disconnected"
+}
+
+// GetConnectivityStatus reports the latest Tor, exit and VPN check results.
+func (h *Handlers) GetConnectivityStatus(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.connectivity.Status())
+}
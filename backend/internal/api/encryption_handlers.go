@@ -1,30 +1,40 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/KFN002/B-2-Torrent/backend/internal/jobs"
 	"github.com/KFN002/B-2-Torrent/backend/internal/security"
 	"go.uber.org/zap"
 )
 
-const maxEncryptionFileSize = 512 << 20
+// maxEncryptedRangeLength caps a single /encryption/read response, which is
+// buffered so a failed chunk never produces a partial 200 body.
+const maxEncryptedRangeLength = 16 << 20
 
 var supportedEncryptionAlgorithms = map[string]bool{"AES-256-GCM": true, "ChaCha20-Poly1305": true}
 var supportedKDFs = map[string]bool{"PBKDF2": true, "Argon2id": true, "scrypt": true}
 var supportedHashes = map[string]bool{"SHA-256": true, "SHA-512": true}
 
 type EncryptionHandlers struct {
-	logger *zap.Logger
+	jobs    *JobHandlers
+	keyring *security.Keyring
+	logger  *zap.Logger
 }
 
-func NewEncryptionHandlers(logger *zap.Logger) *EncryptionHandlers {
+func NewEncryptionHandlers(jobs *JobHandlers, keyring *security.Keyring, logger *zap.Logger) *EncryptionHandlers {
 	return &EncryptionHandlers{
-		logger: logger,
+		jobs:    jobs,
+		keyring: keyring,
+		logger:  logger,
 	}
 }
 
@@ -34,6 +44,24 @@ type EncryptRequest struct {
 	Algorithm     string `json:"algorithm"`
 	KeyDerivation string `json:"keyDerivation"`
 	HashAlgorithm string `json:"hashAlgorithm"`
+	// UseKeyring encrypts with a keyring data key instead of Password.
+	// Keyring-encrypted files are recognised from their header on decrypt.
+	UseKeyring bool `json:"useKeyring"`
+}
+
+type EncryptedRangeRequest struct {
+	FilePath string `json:"filePath"`
+	Password string `json:"password"`
+	Offset   int64  `json:"offset"`
+	Length   int64  `json:"length"`
+}
+
+// SupportedAlgorithms lists the algorithms accepted by the encryption
+// endpoints.
+type SupportedAlgorithms struct {
+	Encryption    []string `json:"encryption"`
+	KeyDerivation []string `json:"keyDerivation"`
+	Hashing       []string `json:"hashing"`
 }
 
 type EncryptResponse struct {
@@ -43,7 +71,11 @@ type EncryptResponse struct {
 }
 
 func validateEncryptionRequest(req EncryptRequest) error {
-	if len(req.Password) < 12 || len(req.Password) > 1024 {
+	if req.UseKeyring {
+		if req.Password != "" {
+			return fmt.Errorf("password must be empty when useKeyring is set")
+		}
+	} else if len(req.Password) < 12 || len(req.Password) > 1024 {
 		return fmt.Errorf("password must be between 12 and 1024 characters")
 	}
 	if !supportedEncryptionAlgorithms[req.Algorithm] {
@@ -58,94 +90,162 @@ func validateEncryptionRequest(req EncryptRequest) error {
 	return nil
 }
 
-func validateEncryptionInput(filePath string) error {
+func validateEncryptionInput(filePath string) (int64, error) {
 	info, err := os.Stat(filePath)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if !info.Mode().IsRegular() {
-		return fmt.Errorf("only regular files are supported")
+		return 0, fmt.Errorf("only regular files are supported")
 	}
-	if info.Size() > maxEncryptionFileSize {
-		return fmt.Errorf("file exceeds the 512 MiB in-memory encryption limit")
+	return info.Size(), nil
+}
+
+// ensureOutputAbsent rejects requests whose output file already exists.
+func ensureOutputAbsent(outputPath, message string) error {
+	if _, err := os.Lstat(outputPath); err == nil {
+		return &jobRequestError{status: http.StatusConflict, message: message}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("unable to validate output path: %w", err)
 	}
 	return nil
 }
 
+// EncryptFile queues an encryption job and returns it with 202 Accepted.
 func (h *EncryptionHandlers) EncryptFile(w http.ResponseWriter, r *http.Request) {
+	h.jobs.submitRequest(w, r, jobKindEncrypt)
+}
+
+// DecryptFile queues a decryption job and returns it with 202 Accepted.
+func (h *EncryptionHandlers) DecryptFile(w http.ResponseWriter, r *http.Request) {
+	h.jobs.submitRequest(w, r, jobKindDecrypt)
+}
+
+func (h *EncryptionHandlers) encryptJob(body json.RawMessage) (jobs.Func, error) {
 	var req EncryptRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request", zap.Error(err))
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, badJobRequest("Invalid request")
 	}
 	if err := validateEncryptionRequest(req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return nil, badJobRequest("%s", err.Error())
 	}
 
 	filePath, err := normalizeUserFilePath(req.FilePath)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return nil, badJobRequest("%s", err.Error())
+	}
+	size, err := validateEncryptionInput(filePath)
+	if err != nil {
+		return nil, badJobRequest("Invalid input file: %s", err.Error())
+	}
+	if req.UseKeyring && !h.keyring.IsUnlocked() {
+		return nil, &jobRequestError{status: http.StatusLocked, message: "Keyring is locked"}
 	}
 
-	if err := validateEncryptionInput(filePath); err != nil {
-		http.Error(w, "Invalid input file: "+err.Error(), http.StatusBadRequest)
-		return
+	outputPath := filePath + ".b2encrypted"
+	if err := ensureOutputAbsent(outputPath, "Encrypted output already exists"); err != nil {
+		return nil, err
 	}
 
-	// Create encryption manager
-	config := &security.EncryptionConfig{
+	em := security.NewEncryptionManager(&security.EncryptionConfig{
 		Algorithm:     req.Algorithm,
 		KeyDerivation: req.KeyDerivation,
 		HashAlgorithm: req.HashAlgorithm,
-	}
+	}, h.logger)
+	em.SetKeyring(h.keyring)
 
-	em := security.NewEncryptionManager(config, h.logger)
+	return func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		progress.SetTotal(size)
+		if err := em.EncryptFileContext(ctx, filePath, outputPath, req.Password, progress.Add); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			h.logger.Error("Encryption failed", zap.Error(err))
+			return nil, fmt.Errorf("encryption failed")
+		}
 
-	// Generate output path
-	outputPath := filePath + ".b2encrypted"
-	if _, err := os.Lstat(outputPath); err == nil {
-		http.Error(w, "Encrypted output already exists", http.StatusConflict)
-		return
-	} else if !os.IsNotExist(err) {
-		http.Error(w, "Unable to validate output path", http.StatusInternalServerError)
-		return
+		// Remove the uploaded original once it has been encrypted.
+		uploadDir := os.Getenv("UPLOAD_DIR")
+		if uploadDir != "" && filepath.Dir(filePath) == uploadDir {
+			os.Remove(filePath)
+		}
+
+		h.logger.Info("File encrypted successfully", zap.String("output", outputPath))
+		return EncryptResponse{
+			Success:       true,
+			Message:       "File encrypted successfully",
+			EncryptedPath: outputPath,
+		}, nil
+	}, nil
+}
+
+func (h *EncryptionHandlers) decryptJob(body json.RawMessage) (jobs.Func, error) {
+	var req EncryptRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, badJobRequest("Invalid request")
+	}
+	if err := validateEncryptionRequest(req); err != nil {
+		return nil, badJobRequest("%s", err.Error())
 	}
 
-	// Encrypt file
-	if err := em.EncryptFile(filePath, outputPath, req.Password); err != nil {
-		h.logger.Error("Encryption failed", zap.Error(err))
-		http.Error(w, "Encryption failed", http.StatusInternalServerError)
-		return
+	filePath, err := normalizeUserFilePath(req.FilePath)
+	if err != nil {
+		return nil, badJobRequest("%s", err.Error())
+	}
+	if !strings.HasSuffix(filePath, ".b2encrypted") {
+		return nil, badJobRequest("Encrypted file must use the .b2encrypted suffix")
+	}
+	size, err := validateEncryptionInput(filePath)
+	if err != nil {
+		return nil, badJobRequest("Invalid encrypted file: %s", err.Error())
 	}
 
-	// Optionally remove original file (secure delete)
-	uploadDir := os.Getenv("UPLOAD_DIR")
-	if uploadDir != "" && filepath.Dir(filePath) == uploadDir {
-		os.Remove(filePath) // Remove original after encryption
+	outputPath := strings.TrimSuffix(filePath, ".b2encrypted")
+	if err := ensureOutputAbsent(outputPath, "Decrypted output already exists"); err != nil {
+		return nil, err
 	}
 
-	h.logger.Info("File encrypted successfully", zap.String("output", outputPath))
+	em := security.NewEncryptionManager(&security.EncryptionConfig{
+		Algorithm:     req.Algorithm,
+		KeyDerivation: req.KeyDerivation,
+		HashAlgorithm: req.HashAlgorithm,
+	}, h.logger)
+	em.SetKeyring(h.keyring)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(EncryptResponse{
-		Success:       true,
-		Message:       "File encrypted successfully",
-		EncryptedPath: outputPath,
-	})
+	return func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		progress.SetTotal(size)
+		if err := em.DecryptFileContext(ctx, filePath, outputPath, req.Password, progress.Add); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			h.logger.Error("Decryption failed", zap.Error(err))
+			return nil, fmt.Errorf("decryption failed - incorrect password or corrupted file")
+		}
+
+		h.logger.Info("File decrypted successfully", zap.String("output", outputPath))
+		return EncryptResponse{
+			Success:       true,
+			Message:       "File decrypted successfully",
+			EncryptedPath: outputPath,
+		}, nil
+	}, nil
 }
 
-func (h *EncryptionHandlers) DecryptFile(w http.ResponseWriter, r *http.Request) {
-	var req EncryptRequest
+// ReadEncryptedRange decrypts a byte range of a B2ENCRYPT:3 file without
+// writing any plaintext to disk.
+func (h *EncryptionHandlers) ReadEncryptedRange(w http.ResponseWriter, r *http.Request) {
+	var req EncryptedRangeRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("Failed to decode request", zap.Error(err))
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	if err := validateEncryptionRequest(req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Keyring-encrypted files need no password.
+	if req.Password != "" && (len(req.Password) < 12 || len(req.Password) > 1024) {
+		http.Error(w, "password must be between 12 and 1024 characters", http.StatusBadRequest)
+		return
+	}
+	if req.Offset < 0 || req.Length <= 0 || req.Length > maxEncryptedRangeLength {
+		http.Error(w, fmt.Sprintf("offset must be non-negative and length between 1 and %d", maxEncryptedRangeLength), http.StatusBadRequest)
 		return
 	}
 
@@ -154,64 +254,41 @@ func (h *EncryptionHandlers) DecryptFile(w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
 	if !strings.HasSuffix(filePath, ".b2encrypted") {
 		http.Error(w, "Encrypted file must use the .b2encrypted suffix", http.StatusBadRequest)
 		return
 	}
-	if err := validateEncryptionInput(filePath); err != nil {
+	if _, err := validateEncryptionInput(filePath); err != nil {
 		http.Error(w, "Invalid encrypted file: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Create encryption manager
-	config := &security.EncryptionConfig{
-		Algorithm:     req.Algorithm,
-		KeyDerivation: req.KeyDerivation,
-		HashAlgorithm: req.HashAlgorithm,
-	}
-
-	em := security.NewEncryptionManager(config, h.logger)
-
-	// Generate output path (remove .b2encrypted extension)
-	outputPath := strings.TrimSuffix(filePath, ".b2encrypted")
-	if _, err := os.Lstat(outputPath); err == nil {
-		http.Error(w, "Decrypted output already exists", http.StatusConflict)
-		return
-	} else if !os.IsNotExist(err) {
-		http.Error(w, "Unable to validate output path", http.StatusInternalServerError)
-		return
-	}
-
-	// Decrypt file
-	if err := em.DecryptFile(filePath, outputPath, req.Password); err != nil {
-		h.logger.Error("Decryption failed", zap.Error(err))
-		http.Error(w, "Decryption failed - incorrect password or corrupted file", http.StatusUnauthorized)
+	em := security.NewEncryptionManager(&security.EncryptionConfig{}, h.logger)
+	em.SetKeyring(h.keyring)
+	var plaintext bytes.Buffer
+	if _, err := em.DecryptRange(filePath, req.Password, req.Offset, req.Length, &plaintext); err != nil {
+		h.logger.Error("Range decryption failed", zap.Error(err))
+		http.Error(w, "Decryption failed - incorrect password, corrupted file or unsupported format", http.StatusUnauthorized)
 		return
 	}
 
-	h.logger.Info("File decrypted successfully", zap.String("output", outputPath))
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(EncryptResponse{
-		Success:       true,
-		Message:       "File decrypted successfully",
-		EncryptedPath: outputPath,
-	})
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(plaintext.Len()))
+	w.Write(plaintext.Bytes())
 }
 
 func (h *EncryptionHandlers) GetSupportedAlgorithms(w http.ResponseWriter, r *http.Request) {
-	algorithms := map[string]interface{}{
-		"encryption": []string{
+	algorithms := SupportedAlgorithms{
+		Encryption: []string{
 			"AES-256-GCM",
 			"ChaCha20-Poly1305",
 		},
-		"keyDerivation": []string{
+		KeyDerivation: []string{
 			"PBKDF2",
 			"Argon2id",
 			"scrypt",
 		},
-		"hashing": []string{
+		Hashing: []string{
 			"SHA-256",
 			"SHA-512",
 		},
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/feeds"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// FeedHistoryResponse is a page of matched feed items, newest first.
+// Enabled is false in no-logs mode, when nothing is recorded.
+type FeedHistoryResponse struct {
+	Enabled bool                `json:"enabled"`
+	Items   []feeds.HistoryItem `json:"items"`
+}
+
+// ClearFeedHistoryResponse reports how many history items were deleted.
+type ClearFeedHistoryResponse struct {
+	Cleared int `json:"cleared"`
+}
+
+// feedsAvailable answers 503 when the server runs without feeds.
+func (h *Handlers) feedsAvailable(w http.ResponseWriter) bool {
+	if h.feeds == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Feeds are not available")
+		return false
+	}
+	return true
+}
+
+func (h *Handlers) ListFeeds(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	list, err := h.feeds.Feeds()
+	if err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handlers) GetFeed(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	feed, err := h.feeds.Feed(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, feed)
+}
+
+// CreateFeed follows a new feed, with the rules in the request, and fetches
+// it right away.
+func (h *Handlers) CreateFeed(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	var req feeds.Feed
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	feed, err := h.feeds.CreateFeed(req)
+	if err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.recordAudit(r, "feed.create", feed.ID, map[string]string{"name": feed.Name})
+	h.writeJSON(w, http.StatusCreated, feed)
+}
+
+// UpdateFeed replaces a feed's settings; its rules are left alone.
+func (h *Handlers) UpdateFeed(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	var req feeds.Feed
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	feed, err := h.feeds.UpdateFeed(mux.Vars(r)["id"], req)
+	if err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.recordAudit(r, "feed.update", feed.ID, map[string]string{"name": feed.Name})
+	h.writeJSON(w, http.StatusOK, feed)
+}
+
+func (h *Handlers) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if err := h.feeds.DeleteFeed(id); err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.recordAudit(r, "feed.delete", id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RefreshFeed queues a fetch of the feed ahead of its schedule.
+func (h *Handlers) RefreshFeed(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	if err := h.feeds.Refresh(mux.Vars(r)["id"]); err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusAccepted, MessageResponse{Message: "Feed refresh queued"})
+}
+
+func (h *Handlers) AddFeedRule(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	var req feeds.Rule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	feedID := mux.Vars(r)["id"]
+	rule, err := h.feeds.AddRule(feedID, req)
+	if err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.recordAudit(r, "feed.rule.create", feedID, map[string]string{"rule": rule.ID})
+	h.writeJSON(w, http.StatusCreated, rule)
+}
+
+func (h *Handlers) UpdateFeedRule(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	var req feeds.Rule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	vars := mux.Vars(r)
+	rule, err := h.feeds.UpdateRule(vars["id"], vars["ruleId"], req)
+	if err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.recordAudit(r, "feed.rule.update", vars["id"], map[string]string{"rule": rule.ID})
+	h.writeJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handlers) DeleteFeedRule(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	vars := mux.Vars(r)
+	if err := h.feeds.DeleteRule(vars["id"], vars["ruleId"]); err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.recordAudit(r, "feed.rule.delete", vars["id"], map[string]string{"rule": vars["ruleId"]})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFeedHistory returns the newest matched items, of one feed with ?feed=.
+func (h *Handlers) GetFeedHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	items, err := h.feeds.History(r.URL.Query().Get("feed"), limit)
+	if err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, FeedHistoryResponse{Enabled: h.feeds.HistoryEnabled(), Items: items})
+}
+
+// ClearFeedHistory forgets matched items, of one feed with ?feed=, so that
+// they can be matched and added again.
+func (h *Handlers) ClearFeedHistory(w http.ResponseWriter, r *http.Request) {
+	if !h.feedsAvailable(w) {
+		return
+	}
+	feedID := r.URL.Query().Get("feed")
+	cleared, err := h.feeds.ClearHistory(feedID)
+	if err != nil {
+		h.writeFeedError(w, err)
+		return
+	}
+	h.recordAudit(r, "feed.history.clear", feedID, nil)
+	h.writeJSON(w, http.StatusOK, ClearFeedHistoryResponse{Cleared: cleared})
+}
+
+func (h *Handlers) writeFeedError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, feeds.ErrFeedNotFound), errors.Is(err, feeds.ErrRuleNotFound):
+		h.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, feeds.ErrInvalid):
+		h.writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, security.ErrKeyringLocked):
+		h.writeError(w, http.StatusLocked, "Unlock the keyring to manage feeds")
+	default:
+		h.logger.Error("Feed operation failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Feed operation failed")
+	}
+}
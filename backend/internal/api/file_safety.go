@@ -61,6 +61,16 @@ func allowedFileRoots() []string {
 	return roots
 }
 
+// isAllowedFileRoot reports whether path is one of the app roots itself.
+func isAllowedFileRoot(path string) bool {
+	for _, root := range allowedFileRoots() {
+		if path == root {
+			return true
+		}
+	}
+	return false
+}
+
 func isPathWithin(path, root string) bool {
 	rel, err := filepath.Rel(root, path)
 	if err != nil {
@@ -1,15 +1,25 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 
+	"github.com/KFN002/B-2-Torrent/backend/internal/audit"
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
 	"github.com/KFN002/B-2-Torrent/backend/internal/database"
+	"github.com/KFN002/B-2-Torrent/backend/internal/feeds"
+	"github.com/KFN002/B-2-Torrent/backend/internal/jobs"
+	"github.com/KFN002/B-2-Torrent/backend/internal/search"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings"
 	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"github.com/KFN002/B-2-Torrent/backend/internal/watchfolder"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
@@ -17,12 +27,32 @@ import (
 type Handlers struct {
 	db            *database.Database
 	torrentClient *torrent.Client
+	killSwitch    *security.KillSwitch
+	connectivity  *ConnectivityMonitor
+	keyring       *security.Keyring
+	duress        *security.Duress
+	accounts      *auth.Service
+	auditLog      *audit.Log
+	feeds         *feeds.Manager
+	search        *search.Manager
+	watcher       *watchfolder.Watcher
+	settings      *settings.Store
+	jobs          *JobHandlers
 	logger        *zap.Logger
 }
 
 type AddTorrentRequest struct {
 	MagnetURI  string `json:"magnetUri"`
 	MagnetLink string `json:"magnetLink"`
+	// TorrentFile is the content of a .torrent file, used instead of a
+	// magnet URI.
+	TorrentFile []byte `json:"torrentFile,omitempty"`
+}
+
+// FilePriorityRequest sets the priority of the files at the given indices.
+type FilePriorityRequest struct {
+	Files    []int  `json:"files"`
+	Priority string `json:"priority"`
 }
 
 type UpdateSettingsRequest struct {
@@ -31,6 +61,68 @@ type UpdateSettingsRequest struct {
 	MaxConnections  string `json:"maxConnections"`
 	EnableTor       string `json:"enableTor"`
 	DownloadPath    string `json:"downloadPath"`
+	// AutoEncryptDownloads ("true"/"false") encrypts completed torrents
+	// with the keyring and wipes the plaintext.
+	AutoEncryptDownloads string `json:"autoEncryptDownloads"`
+}
+
+// AddTorrentResponse identifies the torrent that was added.
+type AddTorrentResponse struct {
+	InfoHash string `json:"infoHash"`
+}
+
+// TorrentPeersResponse lists a torrent's peers with the client's protocol
+// encryption mode.
+type TorrentPeersResponse struct {
+	EncryptionMode torrent.EncryptionMode `json:"encryptionMode"`
+	Peers          []torrent.PeerInfo     `json:"peers"`
+}
+
+// FavoriteRequest marks or unmarks a torrent as a favorite.
+type FavoriteRequest struct {
+	Favorite bool `json:"favorite"`
+}
+
+// RateLimitsRequest sets download and upload limits in bytes per second;
+// zero means unlimited.
+type RateLimitsRequest struct {
+	DownloadLimit int `json:"downloadLimit"`
+	UploadLimit   int `json:"uploadLimit"`
+}
+
+// TorrentScheduleRequest is stored as the torrent's schedule.
+type TorrentScheduleRequest struct {
+	Enabled            bool   `json:"enabled"`
+	StartDate          string `json:"startDate"`
+	StartTime          string `json:"startTime"`
+	PauseWhenComplete  bool   `json:"pauseWhenComplete"`
+	DeleteWhenComplete bool   `json:"deleteWhenComplete"`
+}
+
+// CleanupRequest confirms the cleanup job and selects whether downloads are
+// deleted too.
+type CleanupRequest struct {
+	Confirm         string `json:"confirm"`
+	DeleteDownloads bool   `json:"deleteDownloads"`
+}
+
+// TorrentEvent reports something the backend did to a torrent on its own.
+type TorrentEvent struct {
+	Type        string `json:"type"`
+	TorrentName string `json:"torrentName"`
+	Message     string `json:"message"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// HealthResponse reports whether the backend is up and Tor is usable.
+type HealthResponse struct {
+	Status string `json:"status"`
+	Tor    string `json:"tor"`
+}
+
+// MessageResponse confirms an action that has no other result.
+type MessageResponse struct {
+	Message string `json:"message"`
 }
 
 // ErrorResponse represents an API error
@@ -112,6 +204,11 @@ func (h *Handlers) AddTorrent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(req.TorrentFile) > 0 {
+		h.addTorrentFile(w, req.TorrentFile)
+		return
+	}
+
 	magnetURI := req.MagnetURI
 	if magnetURI == "" {
 		magnetURI = req.MagnetLink
@@ -133,7 +230,25 @@ func (h *Handlers) AddTorrent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.logger.Info("Torrent added successfully", zap.String("infoHash", infoHash))
-	h.writeJSON(w, http.StatusOK, map[string]string{"infoHash": infoHash})
+	h.writeJSON(w, http.StatusOK, AddTorrentResponse{InfoHash: infoHash})
+}
+
+func (h *Handlers) addTorrentFile(w http.ResponseWriter, data []byte) {
+	h.logger.Info("Adding new torrent from file")
+
+	infoHash, err := h.torrentClient.AddTorrentFile(data)
+	if errors.Is(err, torrent.ErrNetworkSuspended) {
+		h.writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		h.logger.Warn("Rejected torrent file", zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.logger.Info("Torrent added successfully", zap.String("infoHash", infoHash))
+	h.writeJSON(w, http.StatusOK, AddTorrentResponse{InfoHash: infoHash})
 }
 
 func (h *Handlers) GetTorrents(w http.ResponseWriter, r *http.Request) {
@@ -159,6 +274,28 @@ func (h *Handlers) GetTorrent(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, http.StatusOK, torrent)
 }
 
+// GetTorrentPeers lists a torrent's peer connections and the protocol
+// encryption each one negotiated.
+func (h *Handlers) GetTorrentPeers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	infoHash := vars["infoHash"]
+	if !h.validateInfoHash(w, infoHash) {
+		return
+	}
+
+	peers, err := h.torrentClient.GetPeers(infoHash)
+	if err != nil {
+		h.logger.Warn("Torrent not found", zap.String("infoHash", infoHash))
+		h.writeError(w, http.StatusNotFound, "Torrent not found")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, TorrentPeersResponse{
+		EncryptionMode: h.torrentClient.EncryptionMode(),
+		Peers:          peers,
+	})
+}
+
 func (h *Handlers) DeleteTorrent(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	infoHash := vars["infoHash"]
@@ -168,18 +305,100 @@ func (h *Handlers) DeleteTorrent(w http.ResponseWriter, r *http.Request) {
 
 	h.logger.Info("Deleting torrent", zap.String("infoHash", infoHash))
 
+	var wipe *SecureDeleteRequest
+	if r.URL.Query().Get("wipe") == "true" {
+		request, err := h.torrentWipeRequest(infoHash)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		request.Passes, _ = strconv.Atoi(r.URL.Query().Get("passes"))
+		wipe = &request
+	}
+
+	// The wipe job is queued before the torrent is removed, so that a full
+	// queue or invalid request leaves the torrent in place; it waits for the
+	// removal before touching any file.
+	var wipeJob *jobs.Job
+	removed := make(chan error, 1)
+	if wipe != nil && len(wipe.FilePaths) > 0 {
+		body, _ := json.Marshal(wipe)
+		fn, ok := h.jobs.build(w, jobKindSecureDelete, body)
+		if !ok {
+			return
+		}
+		job, ok := h.jobs.enqueue(w, r, jobKindSecureDelete, afterRemoval(removed, fn))
+		if !ok {
+			return
+		}
+		wipeJob = &job
+	}
+
 	if err := h.torrentClient.RemoveTorrent(infoHash); err != nil {
+		removed <- err
 		h.logger.Error("Failed to remove torrent", zap.String("infoHash", infoHash), zap.Error(err))
 		h.writeError(w, http.StatusInternalServerError, "Failed to remove torrent")
 		return
 	}
+	removed <- nil
 
 	if err := h.db.DeleteTorrent(infoHash); err != nil {
 		h.logger.Warn("Failed to delete torrent from database", zap.String("infoHash", infoHash), zap.Error(err))
 	}
 
+	if wipeJob != nil {
+		h.logger.Info("Torrent removed, wiping its data", zap.String("infoHash", infoHash))
+		h.jobs.accepted(w, *wipeJob)
+		return
+	}
+
 	h.logger.Info("Torrent deleted successfully", zap.String("infoHash", infoHash))
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Torrent removed"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Torrent removed"})
+}
+
+// afterRemoval holds a wipe job until its torrent has been removed from the
+// client, and fails it if the removal did.
+func afterRemoval(removed <-chan error, fn jobs.Func) jobs.Func {
+	return func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		select {
+		case err := <-removed:
+			if err != nil {
+				return nil, fmt.Errorf("torrent was not removed, its data was kept: %w", err)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return fn(ctx, progress)
+	}
+}
+
+// torrentWipeRequest builds the secure-delete request covering a torrent's
+// data, including encrypted copies of single-file torrents. Paths are
+// validated up front so the torrent is only removed if its data can be
+// wiped.
+func (h *Handlers) torrentWipeRequest(infoHash string) (SecureDeleteRequest, error) {
+	paths, err := h.torrentClient.DataPaths(infoHash)
+	if err != nil {
+		return SecureDeleteRequest{}, err
+	}
+
+	request := SecureDeleteRequest{Recursive: true, Confirm: secureDeleteConfirmationKey}
+	for _, path := range paths {
+		for _, candidate := range []string{path, path + ".b2encrypted"} {
+			if _, err := os.Lstat(candidate); err != nil {
+				continue
+			}
+			safePath, err := normalizeUserFilePath(candidate)
+			if err != nil {
+				return SecureDeleteRequest{}, fmt.Errorf("cannot wipe torrent data: %w", err)
+			}
+			if isAllowedFileRoot(safePath) {
+				return SecureDeleteRequest{}, fmt.Errorf("cannot wipe torrent data: refusing to wipe an app root directory")
+			}
+			request.FilePaths = append(request.FilePaths, safePath)
+		}
+	}
+	return request, nil
 }
 
 func (h *Handlers) PauseTorrent(w http.ResponseWriter, r *http.Request) {
@@ -198,7 +417,7 @@ func (h *Handlers) PauseTorrent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.logger.Info("Torrent paused successfully", zap.String("infoHash", infoHash))
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Torrent paused"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Torrent paused"})
 }
 
 func (h *Handlers) ResumeTorrent(w http.ResponseWriter, r *http.Request) {
@@ -217,23 +436,86 @@ func (h *Handlers) ResumeTorrent(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.logger.Info("Torrent resumed successfully", zap.String("infoHash", infoHash))
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Torrent resumed"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Torrent resumed"})
 }
 
-func (h *Handlers) GetSettings(w http.ResponseWriter, r *http.Request) {
-	settings := make(map[string]string)
+// GetTorrentFiles lists a torrent's files with their progress and priority.
+func (h *Handlers) GetTorrentFiles(w http.ResponseWriter, r *http.Request) {
+	infoHash := mux.Vars(r)["infoHash"]
+	if !h.validateInfoHash(w, infoHash) {
+		return
+	}
 
-	keys := []string{"max_download_rate", "max_upload_rate", "max_connections", "enable_tor", "download_path", "auto_stop_seeding"}
-	for _, key := range keys {
-		if value, err := h.db.GetSetting(key); err == nil {
-			settings[key] = value
+	files, err := h.torrentClient.Files(infoHash)
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, "Torrent not found")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, files)
+}
+
+// SetFilePriority changes which files of a torrent are downloaded first, or
+// at all.
+func (h *Handlers) SetFilePriority(w http.ResponseWriter, r *http.Request) {
+	infoHash := mux.Vars(r)["infoHash"]
+	if !h.validateInfoHash(w, infoHash) {
+		return
+	}
+
+	var req FilePriorityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, err := h.torrentClient.GetTorrent(infoHash); err != nil {
+		h.writeError(w, http.StatusNotFound, "Torrent not found")
+		return
+	}
+	if err := h.torrentClient.SetFilePriority(infoHash, req.Files, req.Priority); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.logger.Info("File priority updated",
+		zap.String("infoHash", infoHash),
+		zap.Int("files", len(req.Files)),
+		zap.String("priority", req.Priority),
+	)
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "File priority updated"})
+}
+
+// legacySettings maps the fields of UpdateSettingsRequest to their keys, in
+// the order GET /settings returns them.
+var legacySettings = []struct{ key, field string }{
+	{"max_download_rate", "maxDownloadRate"},
+	{"max_upload_rate", "maxUploadRate"},
+	{"max_connections", "maxConnections"},
+	{"enable_tor", "enableTor"},
+	{"download_path", "downloadPath"},
+	{"auto_stop_seeding", ""},
+	{autoEncryptSetting, "autoEncryptDownloads"},
+}
+
+// GetSettings returns the legacy settings as strings, defaults included.
+// It answers 423 Locked while the keyring is locked, since the download path
+// cannot be read then.
+func (h *Handlers) GetSettings(w http.ResponseWriter, r *http.Request) {
+	values := make(map[string]string)
+	for _, setting := range legacySettings {
+		value, err := h.settings.Get(setting.key)
+		if err != nil {
+			h.writeSettingsError(w, err)
+			return
 		}
+		values[setting.key] = fmt.Sprint(value)
 	}
 
-	h.logger.Debug("Retrieved settings", zap.Int("count", len(settings)))
-	h.writeJSON(w, http.StatusOK, settings)
+	h.logger.Debug("Retrieved settings", zap.Int("count", len(values)))
+	h.writeJSON(w, http.StatusOK, values)
 }
 
+// UpdateSettings stores the legacy settings that are not empty, validated
+// like PUT /settings/values.
 func (h *Handlers) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	var req UpdateSettingsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -242,30 +524,27 @@ func (h *Handlers) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.logger.Info("Updating settings",
-		zap.String("maxDownloadRate", req.MaxDownloadRate),
-		zap.String("maxUploadRate", req.MaxUploadRate),
-		zap.String("enableTor", req.EnableTor),
-	)
-
-	if req.MaxDownloadRate != "" {
-		h.db.SetSetting("max_download_rate", req.MaxDownloadRate)
-	}
-	if req.MaxUploadRate != "" {
-		h.db.SetSetting("max_upload_rate", req.MaxUploadRate)
-	}
-	if req.MaxConnections != "" {
-		h.db.SetSetting("max_connections", req.MaxConnections)
+	fields := map[string]string{
+		"maxDownloadRate":      req.MaxDownloadRate,
+		"maxUploadRate":        req.MaxUploadRate,
+		"maxConnections":       req.MaxConnections,
+		"enableTor":            req.EnableTor,
+		"downloadPath":         req.DownloadPath,
+		"autoEncryptDownloads": req.AutoEncryptDownloads,
 	}
-	if req.EnableTor != "" {
-		h.db.SetSetting("enable_tor", req.EnableTor)
+	values := make(map[string]json.RawMessage)
+	for _, setting := range legacySettings {
+		if value := fields[setting.field]; setting.field != "" && value != "" {
+			values[setting.key], _ = json.Marshal(value)
+		}
 	}
-	if req.DownloadPath != "" {
-		h.db.SetSetting("download_path", req.DownloadPath)
+	if len(values) > 0 {
+		if _, ok := h.updateSettings(w, r, values); !ok {
+			return
+		}
 	}
 
-	h.logger.Info("Settings updated successfully")
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Settings updated"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Settings updated"})
 }
 
 type InitialConfigRequest struct {
@@ -306,34 +585,26 @@ func (h *Handlers) ApplyInitialConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.DownloadPath != "" {
-		_ = h.db.SetSetting("download_path", req.DownloadPath)
+	// VPNs are refused above, so the backend routes through Tor or nothing.
+	values := map[string]string{
+		"max_connections":   strconv.Itoa(req.MaxConnections),
+		"listen_port":       strconv.Itoa(req.PortNumber),
+		"vpn_type":          "none",
+		"tor_enabled":       strconv.FormatBool(req.EnableTor),
+		"no_logs_mode":      strconv.FormatBool(req.EnableNoLogs),
+		"obfuscate_traffic": "true",
 	}
-	if req.MaxConnections > 0 {
-		_ = h.db.SetSetting("max_connections", fmt.Sprintf("%d", req.MaxConnections))
-	}
-	if req.PortNumber > 0 {
-		_ = h.db.SetSetting("listen_port", fmt.Sprintf("%d", req.PortNumber))
+	if req.DownloadPath != "" {
+		values["download_path"] = req.DownloadPath
 	}
-
-	vpnType := "none"
-	if req.EnableVPN {
-		vpnType = req.VPNProtocol
-		if vpnType != "vless" && vpnType != "outline" {
-			vpnType = "none"
-		}
+	if _, err := h.settings.Set(rawSettings(values), allowsSecuritySettings(r)); err != nil {
+		h.writeSettingsError(w, err)
+		return
 	}
-
-	_ = h.db.SetSetting("vpn_type", vpnType)
-	_ = h.db.SetSetting("tor_enabled", fmt.Sprintf("%t", req.EnableTor))
-	_ = h.db.SetSetting("force_encryption", fmt.Sprintf("%t", req.EnableEncryption))
-	_ = h.db.SetSetting("reject_plaintext", fmt.Sprintf("%t", req.EnableEncryption))
-	_ = h.db.SetSetting("no_logs_mode", fmt.Sprintf("%t", req.EnableNoLogs))
-	_ = h.db.SetSetting("obfuscate_traffic", "true")
-	h.torrentClient.SetNoLogsMode(req.EnableNoLogs)
+	h.setNoLogsMode(req.EnableNoLogs)
 	h.torrentClient.SetTrafficObfuscation(true)
 
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Initial configuration saved"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Initial configuration saved"})
 }
 
 func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
@@ -347,66 +618,81 @@ func (h *Handlers) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		h.logger.Warn("Tor proxy chain not working", zap.Error(err))
 	}
 
-	h.writeJSON(w, http.StatusOK, map[string]string{
-		"status": status,
-		"tor":    torStatus,
+	h.writeJSON(w, http.StatusOK, HealthResponse{
+		Status: status,
+		Tor:    torStatus,
 	})
 }
 
+// CleanupData queues a cleanup job and returns it with 202 Accepted.
 func (h *Handlers) CleanupData(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		Confirm         string `json:"confirm"`
-		DeleteDownloads bool   `json:"deleteDownloads"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Confirm != "DELETE_ALL_LOCAL_DATA" {
-		h.writeError(w, http.StatusBadRequest, "Cleanup requires confirm=DELETE_ALL_LOCAL_DATA")
-		return
+	h.jobs.submitRequest(w, r, jobKindCleanup)
+}
+
+func (h *Handlers) cleanupJob(body json.RawMessage) (jobs.Func, error) {
+	var request CleanupRequest
+	if err := json.Unmarshal(body, &request); err != nil || request.Confirm != "DELETE_ALL_LOCAL_DATA" {
+		return nil, badJobRequest("Cleanup requires confirm=DELETE_ALL_LOCAL_DATA")
 	}
-	h.logger.Warn("Cleaning local application state", zap.Bool("deleteDownloads", request.DeleteDownloads))
 
-	// Stop and remove all active torrents
-	torrents := h.torrentClient.GetAllTorrents()
-	for _, t := range torrents {
-		if err := h.torrentClient.RemoveTorrent(t.InfoHash); err != nil {
-			h.logger.Warn("Failed to remove torrent during cleanup",
-				zap.String("infoHash", t.InfoHash),
-				zap.Error(err))
+	return func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		h.logger.Warn("Cleaning local application state", zap.Bool("deleteDownloads", request.DeleteDownloads))
+
+		// Stop and remove all active torrents
+		torrents := h.torrentClient.GetAllTorrents()
+		for _, t := range torrents {
+			if err := h.torrentClient.RemoveTorrent(t.InfoHash); err != nil {
+				h.logger.Warn("Failed to remove torrent during cleanup",
+					zap.String("infoHash", t.InfoHash),
+					zap.Error(err))
+			}
 		}
-	}
 
-	// Clear all torrents from database
-	if err := h.db.ClearActiveTorrents(); err != nil {
-		h.logger.Error("Failed to cleanup torrents", zap.Error(err))
-		h.writeError(w, http.StatusInternalServerError, "Failed to cleanup data")
-		return
-	}
+		// Clear all torrents from database
+		if err := h.db.ClearActiveTorrents(); err != nil {
+			h.logger.Error("Failed to cleanup torrents", zap.Error(err))
+			return nil, fmt.Errorf("failed to cleanup data")
+		}
 
-	// Clear all settings (except system settings)
-	if err := h.db.ClearUserSettings(); err != nil {
-		h.logger.Error("Failed to cleanup user settings", zap.Error(err))
-		h.writeError(w, http.StatusInternalServerError, "Torrent state was cleared, but settings cleanup failed")
-		return
-	}
+		// Clear all settings (except system settings)
+		if err := h.db.ClearUserSettings(); err != nil {
+			h.logger.Error("Failed to cleanup user settings", zap.Error(err))
+			return nil, fmt.Errorf("torrent state was cleared, but settings cleanup failed")
+		}
+		if h.feeds != nil {
+			if err := h.feeds.Reset(); err != nil {
+				h.logger.Error("Failed to cleanup feed history", zap.Error(err))
+				return nil, fmt.Errorf("settings were cleared, but feed history cleanup failed")
+			}
+		}
+		if h.search != nil {
+			h.search.Reset()
+		}
 
-	for _, key := range []string{"TEMP_DIR", "UPLOAD_DIR"} {
-		if err := removeDirectoryContents(os.Getenv(key)); err != nil {
-			h.logger.Error("Failed to clear temporary data", zap.String("directory", key), zap.Error(err))
-			h.writeError(w, http.StatusInternalServerError, "Database state was cleared, but temporary file cleanup failed")
-			return
+		for _, key := range []string{"TEMP_DIR", "UPLOAD_DIR"} {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if err := removeDirectoryContents(os.Getenv(key)); err != nil {
+				h.logger.Error("Failed to clear temporary data", zap.String("directory", key), zap.Error(err))
+				return nil, fmt.Errorf("database state was cleared, but temporary file cleanup failed")
+			}
 		}
-	}
-	if request.DeleteDownloads {
-		if err := removeDirectoryContents(os.Getenv("DOWNLOAD_DIR")); err != nil {
-			h.logger.Error("Failed to clear downloads", zap.Error(err))
-			h.writeError(w, http.StatusInternalServerError, "Application state was cleared, but download cleanup failed")
-			return
+		if request.DeleteDownloads {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if err := removeDirectoryContents(os.Getenv("DOWNLOAD_DIR")); err != nil {
+				h.logger.Error("Failed to clear downloads", zap.Error(err))
+				return nil, fmt.Errorf("application state was cleared, but download cleanup failed")
+			}
 		}
-	}
 
-	h.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"message":          "Local application state deleted",
-		"downloadsDeleted": request.DeleteDownloads,
-	})
+		return map[string]interface{}{
+			"message":          "Local application state deleted",
+			"downloadsDeleted": request.DeleteDownloads,
+		}, nil
+	}, nil
 }
 
 func removeDirectoryContents(root string) error {
@@ -441,9 +727,7 @@ func (h *Handlers) ToggleFavorite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Favorite bool `json:"favorite"`
-	}
+	var req FavoriteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Warn("Invalid request body for toggle favorite", zap.Error(err))
 		h.writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -464,7 +748,7 @@ func (h *Handlers) ToggleFavorite(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.logger.Info("Favorite status updated successfully")
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Favorite status updated"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Favorite status updated"})
 }
 
 func (h *Handlers) SetTorrentLimits(w http.ResponseWriter, r *http.Request) {
@@ -474,10 +758,7 @@ func (h *Handlers) SetTorrentLimits(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		DownloadLimit int `json:"downloadLimit"`
-		UploadLimit   int `json:"uploadLimit"`
-	}
+	var req RateLimitsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Warn("Invalid request body for set limits", zap.Error(err))
 		h.writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -513,7 +794,7 @@ func (h *Handlers) SetTorrentLimits(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.logger.Info("Torrent limits updated successfully")
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Limits updated"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Limits updated"})
 }
 
 func (h *Handlers) SetTorrentSchedule(w http.ResponseWriter, r *http.Request) {
@@ -523,13 +804,7 @@ func (h *Handlers) SetTorrentSchedule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var req struct {
-		Enabled            bool   `json:"enabled"`
-		StartDate          string `json:"startDate"`
-		StartTime          string `json:"startTime"`
-		PauseWhenComplete  bool   `json:"pauseWhenComplete"`
-		DeleteWhenComplete bool   `json:"deleteWhenComplete"`
-	}
+	var req TorrentScheduleRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Warn("Invalid request body for set schedule", zap.Error(err))
 		h.writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -549,14 +824,11 @@ func (h *Handlers) SetTorrentSchedule(w http.ResponseWriter, r *http.Request) {
 	h.db.SetSetting(schedKey, string(schedData))
 
 	h.logger.Info("Torrent schedule updated successfully")
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Schedule updated"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Schedule updated"})
 }
 
 func (h *Handlers) SetGlobalLimits(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		DownloadLimit int `json:"downloadLimit"`
-		UploadLimit   int `json:"uploadLimit"`
-	}
+	var req RateLimitsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Warn("Invalid request body for global limits", zap.Error(err))
 		h.writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -579,8 +851,13 @@ func (h *Handlers) SetGlobalLimits(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Store global limits in database
-	h.db.SetSetting("global_download_limit", strconv.Itoa(downloadLimit))
-	h.db.SetSetting("global_upload_limit", strconv.Itoa(uploadLimit))
+	if _, err := h.settings.Set(rawSettings(map[string]string{
+		"global_download_limit": strconv.Itoa(downloadLimit),
+		"global_upload_limit":   strconv.Itoa(uploadLimit),
+	}), allowsSecuritySettings(r)); err != nil {
+		h.writeSettingsError(w, err)
+		return
+	}
 
 	// Apply global limits to torrent client
 	if err := h.torrentClient.SetGlobalLimits(downloadLimit, uploadLimit); err != nil {
@@ -588,16 +865,14 @@ func (h *Handlers) SetGlobalLimits(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.logger.Info("Global limits updated successfully")
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Global limits updated"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Global limits updated"})
 }
 
 func (h *Handlers) GetTorrentEvents(w http.ResponseWriter, r *http.Request) {
 	// This endpoint returns recent torrent events (completed, failed, etc.)
-	events := []map[string]interface{}{}
-
-	autoStopSeeding, _ := h.db.GetSetting("auto_stop_seeding")
+	events := []TorrentEvent{}
 
-	if autoStopSeeding == "true" {
+	if h.settings.Bool("auto_stop_seeding") {
 		torrents := h.torrentClient.GetAllTorrents()
 		for _, torrent := range torrents {
 			// If torrent just completed (100% progress) and is seeding
@@ -618,11 +893,11 @@ func (h *Handlers) GetTorrentEvents(w http.ResponseWriter, r *http.Request) {
 						h.db.SetSetting(key, "true")
 
 						// Add event
-						events = append(events, map[string]interface{}{
-							"type":        "auto_stopped",
-							"torrentName": torrent.Name,
-							"message":     "Seeding automatically stopped",
-							"timestamp":   fmt.Sprintf("%d", int64(0)),
+						events = append(events, TorrentEvent{
+							Type:        "auto_stopped",
+							TorrentName: torrent.Name,
+							Message:     "Seeding automatically stopped",
+							Timestamp:   fmt.Sprintf("%d", int64(0)),
 						})
 					}
 				}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/audit"
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+	"github.com/KFN002/B-2-Torrent/backend/internal/jobs"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// Job kinds accepted by POST /jobs.
+const (
+	jobKindEncrypt      = "encrypt"
+	jobKindDecrypt      = "decrypt"
+	jobKindSecureDelete = "secure-delete"
+	jobKindCleanup      = "cleanup"
+	jobKindAutoEncrypt  = "auto-encrypt"
+)
+
+// jobBuilder validates a request body and returns the work it describes.
+// Errors of type *jobRequestError are reported to the client before anything
+// is queued.
+type jobBuilder func(body json.RawMessage) (jobs.Func, error)
+
+type jobRequestError struct {
+	status  int
+	message string
+}
+
+func (e *jobRequestError) Error() string {
+	return e.message
+}
+
+func badJobRequest(format string, args ...interface{}) error {
+	return &jobRequestError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+// JobHandlers exposes the background job manager and the file operations
+// that run on it. Every job submitted over the API is audited.
+type JobHandlers struct {
+	jobs     *jobs.Manager
+	builders map[string]jobBuilder
+	scopes   map[string]auth.Scope
+	auditLog *audit.Log
+	logger   *zap.Logger
+}
+
+func NewJobHandlers(manager *jobs.Manager, auditLog *audit.Log, logger *zap.Logger) *JobHandlers {
+	return &JobHandlers{
+		jobs:     manager,
+		builders: make(map[string]jobBuilder),
+		scopes:   make(map[string]auth.Scope),
+		auditLog: auditLog,
+		logger:   logger,
+	}
+}
+
+// Register makes kind submittable through POST /jobs by admins and by API
+// tokens granted scope.
+func (jh *JobHandlers) Register(kind string, scope auth.Scope, build jobBuilder) {
+	jh.builders[kind] = build
+	jh.scopes[kind] = scope
+}
+
+type SubmitJobRequest struct {
+	Kind   string          `json:"kind"`
+	Params json.RawMessage `json:"params"`
+}
+
+// SubmitJob queues any registered job kind.
+func (jh *JobHandlers) SubmitJob(w http.ResponseWriter, r *http.Request) {
+	var req SubmitJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jh.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Params) == 0 {
+		req.Params = json.RawMessage("{}")
+	}
+	if scope, ok := jh.scopes[req.Kind]; ok {
+		if id, _ := auth.IdentityFromContext(r.Context()); id == nil || !id.Allows(auth.RoleAdmin, scope) {
+			jh.writeError(w, http.StatusForbidden, fmt.Sprintf("Job kind %s needs the %s scope", req.Kind, scope))
+			return
+		}
+	}
+	jh.submit(w, r, req.Kind, req.Params)
+}
+
+// submitRequest queues kind using the raw request body as its parameters.
+func (jh *JobHandlers) submitRequest(w http.ResponseWriter, r *http.Request, kind string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		jh.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	jh.submit(w, r, kind, body)
+}
+
+func (jh *JobHandlers) submit(w http.ResponseWriter, r *http.Request, kind string, params json.RawMessage) {
+	fn, ok := jh.build(w, kind, params)
+	if !ok {
+		return
+	}
+	if job, ok := jh.enqueue(w, r, kind, fn); ok {
+		jh.accepted(w, job)
+	}
+}
+
+// build validates params for kind and returns the job function, writing the
+// error response when it fails.
+func (jh *JobHandlers) build(w http.ResponseWriter, kind string, params json.RawMessage) (jobs.Func, bool) {
+	build, ok := jh.builders[kind]
+	if !ok {
+		jh.writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown job kind: %s", kind))
+		return nil, false
+	}
+
+	fn, err := build(params)
+	if err != nil {
+		var reqErr *jobRequestError
+		if errors.As(err, &reqErr) {
+			jh.writeError(w, reqErr.status, reqErr.message)
+			return nil, false
+		}
+		jh.logger.Error("Failed to prepare job", zap.String("kind", kind), zap.Error(err))
+		jh.writeError(w, http.StatusInternalServerError, "Failed to prepare job")
+		return nil, false
+	}
+	return fn, true
+}
+
+// enqueue queues fn and audits the submission, writing the error response
+// when the queue refuses it.
+func (jh *JobHandlers) enqueue(w http.ResponseWriter, r *http.Request, kind string, fn jobs.Func) (jobs.Job, bool) {
+	job, err := jh.jobs.Submit(kind, fn)
+	switch {
+	case errors.Is(err, jobs.ErrQueueFull), errors.Is(err, jobs.ErrClosed):
+		jh.writeError(w, http.StatusServiceUnavailable, err.Error())
+		return job, false
+	case err != nil:
+		jh.logger.Error("Failed to submit job", zap.String("kind", kind), zap.Error(err))
+		jh.writeError(w, http.StatusInternalServerError, "Failed to submit job")
+		return job, false
+	}
+
+	recordAudit(jh.auditLog, jh.logger, r, "job.submit", kind, map[string]string{"job": job.ID})
+	return job, true
+}
+
+func (jh *JobHandlers) accepted(w http.ResponseWriter, job jobs.Job) {
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	jh.writeJSON(w, http.StatusAccepted, job)
+}
+
+func (jh *JobHandlers) ListJobs(w http.ResponseWriter, r *http.Request) {
+	jh.writeJSON(w, http.StatusOK, jh.jobs.List())
+}
+
+func (jh *JobHandlers) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := jh.jobs.Get(mux.Vars(r)["id"])
+	if err != nil {
+		jh.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	jh.writeJSON(w, http.StatusOK, job)
+}
+
+func (jh *JobHandlers) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := jh.jobs.Cancel(mux.Vars(r)["id"])
+	if err == nil {
+		recordAudit(jh.auditLog, jh.logger, r, "job.cancel", job.Kind, map[string]string{"job": job.ID})
+	}
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		jh.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrFinished):
+		jh.writeError(w, http.StatusConflict, err.Error())
+	default:
+		jh.writeJSON(w, http.StatusOK, job)
+	}
+}
+
+func (jh *JobHandlers) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		jh.logger.Error("Failed to encode JSON response", zap.Error(err))
+	}
+}
+
+func (jh *JobHandlers) writeError(w http.ResponseWriter, status int, message string) {
+	jh.writeJSON(w, status, ErrorResponse{Error: message})
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"go.uber.org/zap"
+)
+
+type KeyringPassphraseRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+// KeyringDuressRequest sets the duress passphrase and what it triggers.
+type KeyringDuressRequest struct {
+	Passphrase string `json:"passphrase"`
+	WipeData   bool   `json:"wipeData"`
+}
+
+// DuressResponse reports whether a duress passphrase is configured. WipeData
+// is only returned when one has just been set.
+type DuressResponse struct {
+	Configured bool  `json:"configured"`
+	WipeData   *bool `json:"wipeData,omitempty"`
+}
+
+type KeyringChangePassphraseRequest struct {
+	CurrentPassphrase string `json:"currentPassphrase"`
+	NewPassphrase     string `json:"newPassphrase"`
+}
+
+// GetKeyringStatus reports whether the keyring exists and is unlocked.
+func (h *Handlers) GetKeyringStatus(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.keyring.Status())
+}
+
+// InitializeKeyring creates the keyring and leaves it unlocked.
+func (h *Handlers) InitializeKeyring(w http.ResponseWriter, r *http.Request) {
+	var req KeyringPassphraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := h.keyring.Initialize(req.Passphrase); err != nil {
+		h.writeKeyringError(w, err)
+		return
+	}
+	h.encryptExistingFields()
+	h.writeJSON(w, http.StatusCreated, h.keyring.Status())
+}
+
+// UnlockKeyring unwraps the master keys with the supplied passphrase. The
+// duress passphrase instead starts the panic action in the background and
+// answers exactly like a wrong passphrase, after the same key derivation.
+func (h *Handlers) UnlockKeyring(w http.ResponseWriter, r *http.Request) {
+	var req KeyringPassphraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if matched, wipeData := h.duress.Match(req.Passphrase); matched {
+		go h.runPanic(wipeData)
+		_ = h.keyring.VerifyPassphrase(req.Passphrase)
+		h.writeKeyringError(w, security.ErrKeyringPassphrase)
+		return
+	}
+	if err := h.keyring.Unlock(req.Passphrase); err != nil {
+		h.writeKeyringError(w, err)
+		return
+	}
+	h.encryptExistingFields()
+	if h.auditLog != nil {
+		if err := h.auditLog.Flush(); err != nil {
+			h.logger.Error("Failed to write held audit entries", zap.Error(err))
+		}
+	}
+	h.writeJSON(w, http.StatusOK, h.keyring.Status())
+}
+
+// LockKeyring drops all unwrapped key material from memory.
+func (h *Handlers) LockKeyring(w http.ResponseWriter, r *http.Request) {
+	h.keyring.Lock()
+	h.writeJSON(w, http.StatusOK, h.keyring.Status())
+}
+
+// ChangeKeyringPassphrase re-wraps the master keys without touching data.
+func (h *Handlers) ChangeKeyringPassphrase(w http.ResponseWriter, r *http.Request) {
+	var req KeyringChangePassphraseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if matched, _ := h.duress.Match(req.NewPassphrase); matched {
+		h.writeError(w, http.StatusBadRequest, security.ErrDuressMatchesPassphrase.Error())
+		return
+	}
+	if err := h.keyring.ChangePassphrase(req.CurrentPassphrase, req.NewPassphrase); err != nil {
+		h.writeKeyringError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, h.keyring.Status())
+}
+
+// RotateKeyring makes a new master key active for new data keys.
+func (h *Handlers) RotateKeyring(w http.ResponseWriter, r *http.Request) {
+	keyID, err := h.keyring.Rotate()
+	if err != nil {
+		h.writeKeyringError(w, err)
+		return
+	}
+	h.logger.Info("Keyring rotated", zap.String("keyId", keyID))
+	h.writeJSON(w, http.StatusOK, h.keyring.Status())
+}
+
+// SetDuressPassphrase configures the passphrase that triggers the panic
+// action when entered on unlock. The keyring must be unlocked.
+func (h *Handlers) SetDuressPassphrase(w http.ResponseWriter, r *http.Request) {
+	var req KeyringDuressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !h.keyring.IsUnlocked() {
+		h.writeKeyringError(w, security.ErrKeyringLocked)
+		return
+	}
+	if err := h.keyring.VerifyPassphrase(req.Passphrase); err == nil {
+		h.writeError(w, http.StatusBadRequest, security.ErrDuressMatchesPassphrase.Error())
+		return
+	}
+	if err := h.duress.Configure(req.Passphrase, req.WipeData); err != nil {
+		h.writeKeyringError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, DuressResponse{Configured: true, WipeData: &req.WipeData})
+}
+
+// ClearDuressPassphrase removes the duress passphrase. The keyring must be
+// unlocked.
+func (h *Handlers) ClearDuressPassphrase(w http.ResponseWriter, r *http.Request) {
+	if !h.keyring.IsUnlocked() {
+		h.writeKeyringError(w, security.ErrKeyringLocked)
+		return
+	}
+	if err := h.duress.Clear(); err != nil {
+		h.writeKeyringError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, DuressResponse{Configured: false})
+}
+
+// encryptExistingFields runs the one-time migration of plaintext settings
+// and torrent names once master keys are available.
+func (h *Handlers) encryptExistingFields() {
+	count, err := h.db.EncryptExistingFields()
+	if err != nil {
+		h.logger.Error("Failed to encrypt existing fields", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		h.logger.Info("Encrypted existing fields at rest", zap.Int("count", count))
+	}
+}
+
+func (h *Handlers) writeKeyringError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, security.ErrKeyringWeakPassphrase):
+		h.writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, security.ErrKeyringPassphrase):
+		h.writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, security.ErrKeyringLocked):
+		h.writeError(w, http.StatusLocked, err.Error())
+	case errors.Is(err, security.ErrKeyringNotInitialized), errors.Is(err, security.ErrKeyringInitialized):
+		h.writeError(w, http.StatusConflict, err.Error())
+	default:
+		h.logger.Error("Keyring operation failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Keyring operation failed")
+	}
+}
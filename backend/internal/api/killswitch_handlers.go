@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/database"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"go.uber.org/zap"
+)
+
+// KillSwitchRequest selects how a manual kill switch trigger behaves.
+type KillSwitchRequest struct {
+	Mode   string `json:"mode"`
+	Reason string `json:"reason"`
+}
+
+// KillSwitchResponse reports the kill switch and whether the network is
+// suspended. Message is set after a trigger or reset.
+type KillSwitchResponse struct {
+	KillSwitch       security.KillSwitchStatus `json:"killSwitch"`
+	NetworkSuspended bool                      `json:"networkSuspended"`
+	Message          string                    `json:"message,omitempty"`
+}
+
+// KillSwitchTriggerAction returns the action the kill switch runs when it
+// fires. A soft kill suspends all network activity and keeps torrents; a hard
+// kill additionally removes every torrent and its persisted state.
+func KillSwitchTriggerAction(db *database.Database, tc *torrent.Client, logger *zap.Logger) func(security.KillSwitchMode, string) error {
+	return func(mode security.KillSwitchMode, reason string) error {
+		tc.SuspendNetwork()
+
+		if mode == security.KillSwitchHard {
+			removed := tc.RemoveAllTorrents()
+			if err := db.ClearActiveTorrents(); err != nil {
+				logger.Error("Failed to clear active torrents after kill switch", zap.Error(err))
+				return fmt.Errorf("failed to clear active torrents: %w", err)
+			}
+			logger.Warn("Hard kill completed", zap.Int("removedTorrents", removed))
+		}
+
+		AddSecurityEvent(
+			"killswitch_triggered",
+			"critical",
+			fmt.Sprintf("Kill switch triggered (%s)", mode),
+			reason,
+		)
+		return nil
+	}
+}
+
+// KillSwitchResetAction returns the action that lets network activity resume
+// after the kill switch is reset.
+func KillSwitchResetAction(tc *torrent.Client) func() error {
+	return func() error {
+		tc.ResumeNetwork()
+		AddSecurityEvent("killswitch_reset", "info", "Kill switch reset", "Network activity resumed")
+		return nil
+	}
+}
+
+// KillSwitchEventFeed counts critical security events as kill switch
+// violations. Lost connections are skipped: the connectivity monitor counts
+// every failed check itself.
+func KillSwitchEventFeed(ks *security.KillSwitch) func(SecurityEvent) {
+	return func(event SecurityEvent) {
+		if event.Severity != "critical" || event.Type == "killswitch_triggered" || monitorCountedEvent(event.Type) {
+			return
+		}
+		ks.RecordViolation(event.Message)
+	}
+}
+
+// GetKillSwitchStatus reports whether the kill switch is armed or has fired.
+func (h *Handlers) GetKillSwitchStatus(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.killSwitchStatus())
+}
+
+func (h *Handlers) killSwitchStatus() KillSwitchResponse {
+	return KillSwitchResponse{
+		KillSwitch:       h.killSwitch.Status(),
+		NetworkSuspended: h.torrentClient.IsNetworkSuspended(),
+	}
+}
+
+// TriggerKillSwitch manually triggers the kill switch. Without a body it
+// performs a hard kill, matching the original emergency-stop behaviour.
+func (h *Handlers) TriggerKillSwitch(w http.ResponseWriter, r *http.Request) {
+	var req KillSwitchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = string(security.KillSwitchHard)
+	}
+	mode, err := security.ParseKillSwitchMode(req.Mode)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Kill switch mode must be soft or hard")
+		return
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = "manual trigger"
+	}
+
+	h.logger.Warn("Kill switch manually triggered", zap.String("mode", string(mode)))
+	if err := h.killSwitch.Trigger(mode, reason); err != nil {
+		h.logger.Error("Kill switch trigger failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Kill switch trigger failed")
+		return
+	}
+
+	h.recordAudit(r, "killswitch.trigger", string(mode), map[string]string{"reason": reason})
+	h.logger.Info("Kill switch activated - all connections terminated")
+	response := h.killSwitchStatus()
+	response.Message = "Kill switch activated"
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// ResetKillSwitch re-arms the kill switch and resumes network activity.
+func (h *Handlers) ResetKillSwitch(w http.ResponseWriter, r *http.Request) {
+	if err := h.killSwitch.Reset(); err != nil {
+		h.logger.Error("Kill switch reset failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Kill switch reset failed")
+		return
+	}
+
+	response := h.killSwitchStatus()
+	response.Message = "Kill switch reset"
+	h.writeJSON(w, http.StatusOK, response)
+}
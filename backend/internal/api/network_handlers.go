@@ -33,3 +33,8 @@ func (h *Handlers) GetNetworkStats(w http.ResponseWriter, r *http.Request) {
 		zap.String("quality", stats.ConnectionQuality),
 		zap.Float64("avgLatency", stats.AverageLatency))
 }
+
+// GetEgressStats reports what the egress guard has allowed and refused.
+func (h *Handlers) GetEgressStats(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.torrentClient.EgressGuard().Stats())
+}
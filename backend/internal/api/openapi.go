@@ -0,0 +1,444 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/audit"
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+	"github.com/KFN002/B-2-Torrent/backend/internal/feeds"
+	"github.com/KFN002/B-2-Torrent/backend/internal/jobs"
+	"github.com/KFN002/B-2-Torrent/backend/internal/middleware"
+	"github.com/KFN002/B-2-Torrent/backend/internal/openapi"
+	"github.com/KFN002/B-2-Torrent/backend/internal/search"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"go.uber.org/zap"
+)
+
+// apiVersion is reported in the OpenAPI document.
+const apiVersion = "1.0.0"
+
+// operation documents one route registered in SetupRouter. Request and
+// response are zero values of the Go types the handler decodes and writes;
+// a nil response means the handler answers with status and no body.
+type operation struct {
+	method   string
+	path     string
+	id       string
+	summary  string
+	tag      string
+	role     auth.Role
+	scope    auth.Scope
+	params   []openapi.Parameter
+	request  interface{}
+	response interface{}
+	status   int
+	// contentType is set for responses that are not JSON.
+	contentType string
+	// alternatives are other success responses, by status.
+	alternatives map[int]interface{}
+}
+
+func pathParam(name string, schema *openapi.Schema, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "path", Required: true, Schema: schema, Description: description}
+}
+
+func queryParam(name string, schema *openapi.Schema, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Schema: schema, Description: description}
+}
+
+func stringSchema() *openapi.Schema { return &openapi.Schema{Type: "string"} }
+func boolSchema() *openapi.Schema   { return &openapi.Schema{Type: "boolean"} }
+func intSchema() *openapi.Schema    { return &openapi.Schema{Type: "integer", Format: "int32"} }
+func int64Schema() *openapi.Schema  { return &openapi.Schema{Type: "integer", Format: "int64"} }
+func timeSchema() *openapi.Schema   { return &openapi.Schema{Type: "string", Format: "date-time"} }
+
+var (
+	infoHashParam  = pathParam("infoHash", stringSchema(), "Hex-encoded info hash of the torrent.")
+	accountIDParam = func(what string) openapi.Parameter {
+		return pathParam("id", int64Schema(), "ID of the "+what+".")
+	}
+	feedIDParam     = pathParam("id", stringSchema(), "ID of the feed.")
+	feedRuleIDParam = pathParam("ruleId", stringSchema(), "ID of the rule.")
+	indexerIDParam  = pathParam("id", stringSchema(), "ID of the indexer.")
+	eventTypeParams = []openapi.Parameter{
+		queryParam("severity", stringSchema(), "Comma-separated severities to include."),
+		queryParam("type", stringSchema(), "Comma-separated event types to include."),
+	}
+)
+
+// apiOperations lists every route SetupRouter registers, in the same order.
+// TestOpenAPIMatchesRouter keeps the two in step.
+var apiOperations = []operation{
+	{method: http.MethodGet, path: "/metrics", id: "GetMetrics", summary: "returns metrics in the Prometheus text format", tag: "system",
+		role: auth.RoleViewer, scope: auth.ScopeMetricsRead, contentType: "text/plain", status: http.StatusOK},
+
+	{method: http.MethodPost, path: "/api/auth/login", id: "Login", summary: "checks credentials and starts a session", tag: "auth",
+		request: LoginRequest{}, response: SessionResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/auth/setup", id: "SetupAccounts", summary: "creates the first admin account", tag: "auth",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, request: LoginRequest{}, response: auth.User{}, status: http.StatusCreated},
+	{method: http.MethodPost, path: "/api/auth/logout", id: "Logout", summary: "ends the caller's session", tag: "auth",
+		role: auth.RoleViewer, status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/api/auth/session", id: "GetSession", summary: "describes the caller", tag: "auth",
+		role: auth.RoleViewer, response: SessionResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/auth/password", id: "ChangePassword", summary: "changes the caller's password", tag: "auth",
+		role: auth.RoleViewer, request: ChangePasswordRequest{}, status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/api/users", id: "ListUsers", summary: "lists user accounts", tag: "users",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, response: []auth.User{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/users", id: "CreateUser", summary: "creates a user account", tag: "users",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, request: CreateUserRequest{}, response: auth.User{}, status: http.StatusCreated},
+	{method: http.MethodPut, path: "/api/users/{id}", id: "UpdateUser", summary: "changes a user's role or password", tag: "users",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, params: []openapi.Parameter{accountIDParam("user")},
+		request: UpdateUserRequest{}, response: auth.User{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/users/{id}", id: "DeleteUser", summary: "deletes a user account", tag: "users",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, params: []openapi.Parameter{accountIDParam("user")}, status: http.StatusNoContent},
+	{method: http.MethodGet, path: "/api/tokens", id: "ListTokens", summary: "lists API tokens", tag: "tokens",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, response: []auth.APIToken{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/tokens", id: "CreateToken", summary: "creates an API token and returns its secret once", tag: "tokens",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, request: CreateTokenRequest{}, response: TokenSecretResponse{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/api/tokens/scopes", id: "GetTokenScopes", summary: "lists the scopes a token can be granted", tag: "tokens",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, response: []auth.Scope{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/tokens/{id}/rotate", id: "RotateToken", summary: "replaces a token's secret", tag: "tokens",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, params: []openapi.Parameter{accountIDParam("token")},
+		response: TokenSecretResponse{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/tokens/{id}", id: "RevokeToken", summary: "revokes an API token", tag: "tokens",
+		role: auth.RoleAdmin, scope: auth.ScopeAccountsAdmin, params: []openapi.Parameter{accountIDParam("token")}, status: http.StatusNoContent},
+
+	{method: http.MethodPost, path: "/api/torrents", id: "AddTorrent", summary: "adds a torrent from a magnet link or a .torrent file", tag: "torrents",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, request: AddTorrentRequest{}, response: AddTorrentResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/torrents", id: "GetTorrents", summary: "lists every torrent", tag: "torrents",
+		role: auth.RoleViewer, scope: auth.ScopeTorrentsRead, response: []*torrent.TorrentInfo{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/torrents/{infoHash}", id: "GetTorrent", summary: "returns one torrent", tag: "torrents",
+		role: auth.RoleViewer, scope: auth.ScopeTorrentsRead, params: []openapi.Parameter{infoHashParam},
+		response: torrent.TorrentInfo{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/torrents/{infoHash}/peers", id: "GetTorrentPeers", summary: "lists a torrent's peers and their encryption", tag: "torrents",
+		role: auth.RoleViewer, scope: auth.ScopeTorrentsRead, params: []openapi.Parameter{infoHashParam},
+		response: TorrentPeersResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/torrents/{infoHash}/files", id: "GetTorrentFiles", summary: "lists a torrent's files with their progress and priority", tag: "torrents",
+		role: auth.RoleViewer, scope: auth.ScopeTorrentsRead, params: []openapi.Parameter{infoHashParam},
+		response: []torrent.TorrentFile{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/torrents/{infoHash}/files/priority", id: "SetFilePriority", summary: "sets the priority of some of a torrent's files", tag: "torrents",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{infoHashParam},
+		request: FilePriorityRequest{}, response: MessageResponse{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/torrents/{infoHash}", id: "DeleteTorrent", summary: "removes a torrent and, with wipe, queues a job wiping its data", tag: "torrents",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{
+			infoHashParam,
+			queryParam("wipe", boolSchema(), "Securely delete the torrent's data."),
+			queryParam("passes", intSchema(), "Overwrite passes for the wipe, from 3 to 35."),
+		},
+		response: MessageResponse{}, status: http.StatusOK, alternatives: map[int]interface{}{http.StatusAccepted: jobs.Job{}}},
+	{method: http.MethodPost, path: "/api/torrents/{infoHash}/pause", id: "PauseTorrent", summary: "pauses a torrent", tag: "torrents",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{infoHashParam}, response: MessageResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/torrents/{infoHash}/resume", id: "ResumeTorrent", summary: "resumes a paused torrent", tag: "torrents",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{infoHashParam}, response: MessageResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/torrents/{infoHash}/favorite", id: "ToggleFavorite", summary: "marks or unmarks a torrent as a favorite", tag: "torrents",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{infoHashParam},
+		request: FavoriteRequest{}, response: MessageResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/torrents/{infoHash}/limits", id: "SetTorrentLimits", summary: "sets a torrent's rate limits", tag: "torrents",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{infoHashParam},
+		request: RateLimitsRequest{}, response: MessageResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/torrents/{infoHash}/schedule", id: "SetTorrentSchedule", summary: "stores a torrent's schedule", tag: "torrents",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{infoHashParam},
+		request: TorrentScheduleRequest{}, response: MessageResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/torrents/events", id: "GetTorrentEvents", summary: "stops seeding completed torrents when configured and reports it", tag: "torrents",
+		role: auth.RoleViewer, scope: auth.ScopeTorrentsRead, response: []TorrentEvent{}, status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/api/feeds", id: "ListFeeds", summary: "lists followed RSS and Atom feeds with their rules", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, response: []feeds.Feed{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/feeds", id: "CreateFeed", summary: "follows a feed and fetches it", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, request: feeds.Feed{}, response: feeds.Feed{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/api/feeds/history", id: "GetFeedHistory", summary: "lists items feed rules matched, newest first", tag: "feeds",
+		role: auth.RoleViewer, scope: auth.ScopeTorrentsRead, params: []openapi.Parameter{
+			queryParam("feed", stringSchema(), "Only items of this feed."),
+			queryParam("limit", intSchema(), "Maximum number of items, up to 1000."),
+		},
+		response: FeedHistoryResponse{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/feeds/history", id: "ClearFeedHistory", summary: "forgets matched items so they can be added again", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{queryParam("feed", stringSchema(), "Only items of this feed.")},
+		response: ClearFeedHistoryResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/feeds/{id}", id: "GetFeed", summary: "returns one feed", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{feedIDParam}, response: feeds.Feed{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/api/feeds/{id}", id: "UpdateFeed", summary: "replaces a feed's settings, keeping its rules", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{feedIDParam},
+		request: feeds.Feed{}, response: feeds.Feed{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/feeds/{id}", id: "DeleteFeed", summary: "stops following a feed", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{feedIDParam}, status: http.StatusNoContent},
+	{method: http.MethodPost, path: "/api/feeds/{id}/refresh", id: "RefreshFeed", summary: "queues a fetch of a feed ahead of its schedule", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{feedIDParam}, response: MessageResponse{}, status: http.StatusAccepted},
+	{method: http.MethodPost, path: "/api/feeds/{id}/rules", id: "AddFeedRule", summary: "adds a rule to a feed", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{feedIDParam},
+		request: feeds.Rule{}, response: feeds.Rule{}, status: http.StatusCreated},
+	{method: http.MethodPut, path: "/api/feeds/{id}/rules/{ruleId}", id: "UpdateFeedRule", summary: "replaces a rule of a feed", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{feedIDParam, feedRuleIDParam},
+		request: feeds.Rule{}, response: feeds.Rule{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/feeds/{id}/rules/{ruleId}", id: "DeleteFeedRule", summary: "removes a rule from a feed", tag: "feeds",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{feedIDParam, feedRuleIDParam}, status: http.StatusNoContent},
+
+	{method: http.MethodGet, path: "/api/search", id: "Search", summary: "searches the configured indexers, merging results by info hash", tag: "search",
+		role: auth.RoleViewer, scope: auth.ScopeTorrentsRead, params: []openapi.Parameter{
+			{Name: "q", In: "query", Required: true, Schema: stringSchema(), Description: "What to search for."},
+			queryParam("cat", stringSchema(), "Comma-separated Torznab categories, instead of each indexer's."),
+			queryParam("indexers", stringSchema(), "Comma-separated IDs of the indexers to search; all enabled ones by default."),
+			queryParam("sort", stringSchema(), "seeders (default) or size."),
+			queryParam("order", stringSchema(), "desc (default) or asc."),
+			queryParam("limit", intSchema(), "Maximum number of results, up to 500."),
+		},
+		response: search.Response{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/search/results/{id}/add", id: "AddSearchResult", summary: "adds a result of a recent search", tag: "search",
+		role: auth.RoleOperator, scope: auth.ScopeTorrentsWrite, params: []openapi.Parameter{pathParam("id", stringSchema(), "ID of the search result.")},
+		request: AddSearchResultRequest{}, response: AddTorrentResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/search/indexers", id: "ListIndexers", summary: "lists Torznab indexers, without their API keys", tag: "search",
+		role: auth.RoleViewer, scope: auth.ScopeSettingsRead, response: []search.Indexer{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/search/indexers", id: "CreateIndexer", summary: "adds a Torznab indexer", tag: "search",
+		role: auth.RoleAdmin, scope: auth.ScopeSettingsWrite, request: search.Indexer{}, response: search.Indexer{}, status: http.StatusCreated},
+	{method: http.MethodGet, path: "/api/search/indexers/{id}", id: "GetIndexer", summary: "returns one indexer, without its API key", tag: "search",
+		role: auth.RoleViewer, scope: auth.ScopeSettingsRead, params: []openapi.Parameter{indexerIDParam}, response: search.Indexer{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/api/search/indexers/{id}", id: "UpdateIndexer", summary: "replaces an indexer's settings, keeping its API key unless one is given", tag: "search",
+		role: auth.RoleAdmin, scope: auth.ScopeSettingsWrite, params: []openapi.Parameter{indexerIDParam},
+		request: search.Indexer{}, response: search.Indexer{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/search/indexers/{id}", id: "DeleteIndexer", summary: "removes an indexer", tag: "search",
+		role: auth.RoleAdmin, scope: auth.ScopeSettingsWrite, params: []openapi.Parameter{indexerIDParam}, status: http.StatusNoContent},
+
+	{method: http.MethodGet, path: "/api/settings", id: "GetSettings", summary: "returns the legacy settings as strings", tag: "settings",
+		role: auth.RoleViewer, scope: auth.ScopeSettingsRead, response: map[string]string{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/api/settings", id: "UpdateSettings", summary: "updates the legacy settings that are not empty", tag: "settings",
+		role: auth.RoleAdmin, scope: auth.ScopeSettingsWrite, request: UpdateSettingsRequest{}, response: MessageResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/settings/limits", id: "SetGlobalLimits", summary: "sets the global rate limits", tag: "settings",
+		role: auth.RoleAdmin, scope: auth.ScopeSettingsWrite, request: RateLimitsRequest{}, response: MessageResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/settings/schema", id: "GetSettingsSchema", summary: "describes every setting as a JSON Schema", tag: "settings",
+		role: auth.RoleViewer, scope: auth.ScopeSettingsRead, response: settings.SchemaDocument{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/settings/values", id: "GetSettingValues", summary: "returns the typed value of every setting", tag: "settings",
+		role: auth.RoleViewer, scope: auth.ScopeSettingsRead, response: settings.Values{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/api/settings/values", id: "UpdateSettingValues", summary: "validates and stores the given settings, all or none", tag: "settings",
+		role: auth.RoleAdmin, scope: auth.ScopeSettingsWrite, request: map[string]json.RawMessage{}, response: UpdateSettingValuesResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/settings/export", id: "ExportSettings", summary: "exports every setting, with secrets excluded, included or encrypted", tag: "settings",
+		role: auth.RoleAdmin, scope: auth.ScopeSettingsWrite, request: ExportSettingsRequest{}, response: settings.Export{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/settings/import", id: "ImportSettings", summary: "imports a settings export, all or none", tag: "settings",
+		role: auth.RoleAdmin, scope: auth.ScopeSettingsWrite, request: ImportSettingsRequest{}, response: settings.ImportResult{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/config/initial", id: "ApplyInitialConfig", summary: "applies the first-run configuration", tag: "settings",
+		role: auth.RoleAdmin, scope: auth.ScopeSettingsWrite, request: InitialConfigRequest{}, response: MessageResponse{}, status: http.StatusOK},
+
+	{method: http.MethodPost, path: "/api/encryption/encrypt", id: "EncryptFile", summary: "queues a job encrypting a file", tag: "encryption",
+		role: auth.RoleAdmin, scope: auth.ScopeFilesEncrypt, request: EncryptRequest{}, response: jobs.Job{}, status: http.StatusAccepted},
+	{method: http.MethodPost, path: "/api/encryption/decrypt", id: "DecryptFile", summary: "queues a job decrypting a file", tag: "encryption",
+		role: auth.RoleAdmin, scope: auth.ScopeFilesEncrypt, request: EncryptRequest{}, response: jobs.Job{}, status: http.StatusAccepted},
+	{method: http.MethodPost, path: "/api/encryption/read", id: "ReadEncryptedRange", summary: "decrypts and returns a byte range of an encrypted file", tag: "encryption",
+		role: auth.RoleAdmin, scope: auth.ScopeFilesEncrypt, request: EncryptedRangeRequest{}, contentType: "application/octet-stream", status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/encryption/algorithms", id: "GetSupportedAlgorithms", summary: "lists the supported algorithms", tag: "encryption",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: SupportedAlgorithms{}, status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/api/keyring", id: "GetKeyringStatus", summary: "reports whether the keyring exists and is unlocked", tag: "keyring",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: security.KeyringStatus{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/keyring/init", id: "InitializeKeyring", summary: "creates the keyring", tag: "keyring",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: KeyringPassphraseRequest{}, response: security.KeyringStatus{}, status: http.StatusCreated},
+	{method: http.MethodPost, path: "/api/keyring/unlock", id: "UnlockKeyring", summary: "unlocks the keyring", tag: "keyring",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: KeyringPassphraseRequest{}, response: security.KeyringStatus{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/keyring/lock", id: "LockKeyring", summary: "locks the keyring", tag: "keyring",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, response: security.KeyringStatus{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/keyring/passphrase", id: "ChangeKeyringPassphrase", summary: "changes the keyring passphrase", tag: "keyring",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: KeyringChangePassphraseRequest{}, response: security.KeyringStatus{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/keyring/rotate", id: "RotateKeyring", summary: "adds a new master key for new data", tag: "keyring",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, response: security.KeyringStatus{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/keyring/duress", id: "SetDuressPassphrase", summary: "sets the duress passphrase", tag: "keyring",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: KeyringDuressRequest{}, response: DuressResponse{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/keyring/duress", id: "ClearDuressPassphrase", summary: "removes the duress passphrase", tag: "keyring",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, response: DuressResponse{}, status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/api/security/status", id: "GetSecurityStatus", summary: "summarises the privacy protections in force", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: SecurityStatus{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/config", id: "GetSecurityConfig", summary: "returns the security settings", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: SecurityConfig{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/api/security/settings", id: "UpdateSecuritySettings", summary: "updates the security settings", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: SecurityConfig{}, response: MessageResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/killswitch", id: "GetKillSwitchStatus", summary: "reports whether the kill switch is armed or has fired", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: KillSwitchResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/security/killswitch", id: "TriggerKillSwitch", summary: "fires the kill switch", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: KillSwitchRequest{}, response: KillSwitchResponse{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/security/killswitch/reset", id: "ResetKillSwitch", summary: "re-arms the kill switch and resumes the network", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, response: KillSwitchResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/connectivity", id: "GetConnectivityStatus", summary: "reports Tor, VPN and exit checks", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: ConnectivityStatus{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/ip", id: "GetIPStatus", summary: "summarises how the IP address and DNS are protected", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: IPStatus{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/dns-test", id: "TestDNSLeak", summary: "reports the DNS leak test outcome", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: DNSLeakTestResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/metrics", id: "GetSecurityMetrics", summary: "returns the security score and what it is based on", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: SecurityMetrics{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/encryption", id: "GetEncryptionStatus", summary: "reports peer protocol encryption", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: torrent.EncryptionStatus{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/events", id: "GetSecurityEvents", summary: "lists stored security events, newest first", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, params: append(append([]openapi.Parameter{}, eventTypeParams...),
+			queryParam("since", timeSchema(), "Only events at or after this time."),
+			queryParam("until", timeSchema(), "Only events before this time."),
+			queryParam("unacknowledged", boolSchema(), "Only events not yet acknowledged."),
+			queryParam("before", int64Schema(), "Only events with a lower ID, for paging."),
+			queryParam("limit", intSchema(), "Maximum number of events."),
+		),
+		response: []SecurityEvent{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/events/stream", id: "StreamSecurityEvents", summary: "streams new security events as server-sent events", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, params: eventTypeParams, contentType: "text/event-stream", status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/security/events/ack", id: "AcknowledgeSecurityEvents", summary: "acknowledges security events", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: AcknowledgeEventsRequest{}, response: AcknowledgeEventsResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/events/retention", id: "GetEventRetention", summary: "returns how long security events are kept", tag: "security",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: EventRetention{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/api/security/events/retention", id: "UpdateEventRetention", summary: "changes how long security events are kept", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: EventRetention{}, response: EventRetention{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/security/secure-delete", id: "SecureDeleteFile", summary: "queues a secure-delete job, or validates the paths of a dry run", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: SecureDeleteRequest{}, response: jobs.Job{}, status: http.StatusAccepted,
+		alternatives: map[int]interface{}{http.StatusOK: SecureDeleteResponse{}}},
+	{method: http.MethodPost, path: "/api/panic", id: "Panic", summary: "stops all activity and optionally wipes local data", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: PanicRequest{}, response: PanicResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/audit", id: "GetAuditLog", summary: "returns audit log entries, newest first", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, params: []openapi.Parameter{
+			queryParam("before", int64Schema(), "Only entries with a lower sequence number, for paging."),
+			queryParam("limit", intSchema(), "Maximum number of entries."),
+		},
+		response: AuditLogResponse{}, status: http.StatusOK},
+	{method: http.MethodPut, path: "/api/security/audit", id: "UpdateAuditLog", summary: "enables or disables the audit log", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: UpdateAuditLogRequest{}, response: audit.Status{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/security/audit/verify", id: "VerifyAuditLog", summary: "checks the audit log hash chain", tag: "security",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, response: audit.Verification{}, status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/api/network/connections", id: "GetNetworkConnections", summary: "lists the configured proxies", tag: "network",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: []torrent.ProxyConnection{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/network/stats", id: "GetNetworkStats", summary: "summarises proxy connections", tag: "network",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: NetworkStats{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/network/egress", id: "GetEgressStats", summary: "reports what the egress guard allowed and refused", tag: "network",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: torrent.EgressStats{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/network/tor", id: "GetTorConnections", summary: "lists Tor proxies and live circuits", tag: "network",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: []torrent.ProxyConnection{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/network/tor/status", id: "GetTorControlStatus", summary: "reports bootstrap progress and circuits from the Tor control port", tag: "network",
+		role: auth.RoleViewer, scope: auth.ScopeSecurityRead, response: torrent.TorControlStatus{}, status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/network/tor/newnym", id: "RotateTorCircuits", summary: "asks Tor for new circuits", tag: "network",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, response: MessageResponse{}, status: http.StatusOK},
+
+	{method: http.MethodPost, path: "/api/jobs", id: "SubmitJob", summary: "queues a job of any registered kind", tag: "jobs",
+		role: auth.RoleAdmin, scope: auth.ScopeJobsWrite, request: SubmitJobRequest{}, response: jobs.Job{}, status: http.StatusAccepted},
+	{method: http.MethodGet, path: "/api/jobs", id: "ListJobs", summary: "lists jobs", tag: "jobs",
+		role: auth.RoleViewer, scope: auth.ScopeJobsRead, response: []jobs.Job{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/jobs/{id}", id: "GetJob", summary: "returns one job", tag: "jobs",
+		role: auth.RoleViewer, scope: auth.ScopeJobsRead, params: []openapi.Parameter{pathParam("id", stringSchema(), "ID of the job.")},
+		response: jobs.Job{}, status: http.StatusOK},
+	{method: http.MethodDelete, path: "/api/jobs/{id}", id: "CancelJob", summary: "cancels a queued or running job", tag: "jobs",
+		role: auth.RoleAdmin, scope: auth.ScopeJobsWrite, params: []openapi.Parameter{pathParam("id", stringSchema(), "ID of the job.")},
+		response: jobs.Job{}, status: http.StatusOK},
+
+	{method: http.MethodGet, path: "/api/health", id: "HealthCheck", summary: "reports whether the backend is up and Tor works", tag: "system",
+		response: HealthResponse{}, status: http.StatusOK},
+	{method: http.MethodGet, path: "/api/openapi.json", id: "GetOpenAPI", summary: "returns this OpenAPI document", tag: "system",
+		role: auth.RoleViewer, contentType: "application/vnd.oai.openapi+json", status: http.StatusOK},
+	{method: http.MethodPost, path: "/api/cleanup", id: "CleanupData", summary: "queues a job deleting all local application state", tag: "system",
+		role: auth.RoleAdmin, scope: auth.ScopeSecurityAdmin, request: CleanupRequest{}, response: jobs.Job{}, status: http.StatusAccepted},
+}
+
+// OpenAPI returns the OpenAPI 3 document describing every route
+// SetupRouter registers. Schemas are built from the Go types the handlers
+// use, so they cannot drift from them.
+func OpenAPI() *openapi.Document {
+	schemas := openapi.NewSchemas()
+	schemas.Name(reflect.TypeOf(audit.Status{}), "AuditStatus")
+	schemas.Name(reflect.TypeOf(audit.Entry{}), "AuditEntry")
+	schemas.Name(reflect.TypeOf(audit.Actor{}), "AuditActor")
+	schemas.Name(reflect.TypeOf(audit.Verification{}), "AuditVerification")
+	schemas.Name(reflect.TypeOf(feeds.Rule{}), "FeedRule")
+	schemas.Name(reflect.TypeOf(feeds.HistoryItem{}), "FeedHistoryItem")
+	schemas.Name(reflect.TypeOf(search.Response{}), "SearchResponse")
+	schemas.Name(reflect.TypeOf(search.Result{}), "SearchResult")
+	schemas.Name(reflect.TypeOf(search.IndexerStatus{}), "SearchIndexerStatus")
+	schemas.Name(reflect.TypeOf(settings.Values{}), "SettingValues")
+	schemas.Name(reflect.TypeOf(settings.SchemaDocument{}), "SettingsSchema")
+	schemas.Name(reflect.TypeOf(settings.Property{}), "SettingsSchemaProperty")
+	schemas.Name(reflect.TypeOf(settings.Export{}), "SettingsExport")
+	schemas.Name(reflect.TypeOf(settings.ImportResult{}), "SettingsImportResult")
+	errorSchema := schemas.For(reflect.TypeOf(ErrorResponse{}))
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "B-2-Torrent API",
+			Description: "The backend HTTP API. x-role is the role a signed-in user needs and x-scope the scope an API token needs.",
+			Version:     apiVersion,
+		},
+		Security: []openapi.SecurityRequirement{{"bearerAuth": {}}, {"apiKey": {}}, {"session": {}}},
+		Paths:    map[string]openapi.PathItem{},
+	}
+
+	for _, op := range apiOperations {
+		item := doc.Paths[op.path]
+		if item == nil {
+			item = openapi.PathItem{}
+			doc.Paths[op.path] = item
+		}
+		spec := &openapi.Operation{
+			OperationID: op.id,
+			Summary:     strings.ToUpper(op.summary[:1]) + op.summary[1:],
+			Tags:        []string{op.tag},
+			Parameters:  op.params,
+			Responses: map[string]*openapi.Response{
+				"default": {Description: "Error", Content: map[string]openapi.MediaType{openapi.JSON: {Schema: errorSchema}}},
+			},
+			Role:  string(op.role),
+			Scope: string(op.scope),
+		}
+		if op.role == "" {
+			spec.Security = &[]openapi.SecurityRequirement{}
+		}
+		if op.request != nil {
+			spec.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]openapi.MediaType{openapi.JSON: {Schema: schemas.For(reflect.TypeOf(op.request))}},
+			}
+		}
+		spec.Responses[strconv.Itoa(op.status)] = response(schemas, op.status, op.response, op.contentType)
+		for status, body := range op.alternatives {
+			spec.Responses[strconv.Itoa(status)] = response(schemas, status, body, "")
+		}
+		item[strings.ToLower(op.method)] = spec
+	}
+
+	doc.Components = openapi.Components{
+		Schemas: schemas.Components(),
+		SecuritySchemes: map[string]openapi.SecurityScheme{
+			"bearerAuth": {Type: "http", Scheme: "bearer", Description: "An API token, or B2_API_TOKEN for full access."},
+			"apiKey":     {Type: "apiKey", In: "header", Name: "X-B2-API-Key", Description: "Same as bearerAuth."},
+			"session": {Type: "apiKey", In: "cookie", Name: middleware.SessionCookie,
+				Description: fmt.Sprintf("Session cookie set by login. Other methods than GET must echo the %s cookie in %s.", middleware.CSRFCookie, middleware.CSRFHeader)},
+		},
+	}
+	return doc
+}
+
+func response(schemas *openapi.Schemas, status int, body interface{}, contentType string) *openapi.Response {
+	response := &openapi.Response{Description: http.StatusText(status)}
+	switch {
+	case contentType == "application/octet-stream":
+		response.Content = map[string]openapi.MediaType{contentType: {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}
+	case contentType != "":
+		response.Content = map[string]openapi.MediaType{contentType: {Schema: &openapi.Schema{Type: "string"}}}
+	case body != nil:
+		response.Content = map[string]openapi.MediaType{openapi.JSON: {Schema: schemas.For(reflect.TypeOf(body))}}
+	}
+	return response
+}
+
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	return OpenAPI().Marshal()
+})
+
+// GetOpenAPI serves the OpenAPI document of this API.
+func (h *Handlers) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	document, err := openAPIDocument()
+	if err != nil {
+		h.logger.Error("Failed to render OpenAPI document", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to render OpenAPI document")
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.oai.openapi+json")
+	w.Write(document)
+}
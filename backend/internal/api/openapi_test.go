@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/metrics"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	router := SetupRouter(Dependencies{Metrics: metrics.New(), Logger: zap.NewNop()}).(*mux.Router)
+
+	registered := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if method != http.MethodOptions {
+				registered[method+" "+path] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := map[string]bool{}
+	for path, item := range OpenAPI().Paths {
+		for method := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	var missing, stale []string
+	for route := range registered {
+		if !documented[route] {
+			missing = append(missing, route)
+		}
+	}
+	for route := range documented {
+		if !registered[route] {
+			stale = append(stale, route)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	if len(missing) > 0 {
+		t.Errorf("routes missing from apiOperations: %v", missing)
+	}
+	if len(stale) > 0 {
+		t.Errorf("apiOperations documents routes the router lacks: %v", stale)
+	}
+}
+
+func TestOpenAPIOperationsAreConsistent(t *testing.T) {
+	ids := map[string]bool{}
+	for _, op := range apiOperations {
+		if ids[op.id] {
+			t.Errorf("duplicate operation ID %s", op.id)
+		}
+		ids[op.id] = true
+
+		declared := map[string]bool{}
+		for _, param := range op.params {
+			if param.In == "path" {
+				declared[param.Name] = true
+			}
+		}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(op.path, -1) {
+			if !declared[match[1]] {
+				t.Errorf("%s %s: path parameter %s is not declared", op.method, op.path, match[1])
+			}
+			delete(declared, match[1])
+		}
+		for name := range declared {
+			t.Errorf("%s %s: declares path parameter %s not in the path", op.method, op.path, name)
+		}
+		if op.response != nil && op.status == http.StatusNoContent {
+			t.Errorf("%s %s: 204 responses have no body", op.method, op.path)
+		}
+	}
+}
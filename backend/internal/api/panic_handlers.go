@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"go.uber.org/zap"
+)
+
+// panicJobsTimeout bounds how long the panic action waits for cancelled jobs
+// to stop before it carries on.
+const panicJobsTimeout = 5 * time.Second
+
+// PanicRequest selects whether the panic action also wipes local data.
+type PanicRequest struct {
+	WipeData bool `json:"wipeData"`
+}
+
+// PanicStep reports the outcome of one panic step.
+type PanicStep struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// PanicResponse lists the steps the panic action ran.
+type PanicResponse struct {
+	Steps    []PanicStep `json:"steps"`
+	WipeData bool        `json:"wipeData"`
+}
+
+// Panic stops all network activity, feeds and watch folders, drops every
+// torrent, job, search result and feed history item, locks the keyring
+// and, if requested, wipes downloaded and temporary data. Unlike the kill
+// switch and cleanup it needs no confirmation and leaves no triggered state
+// or security events behind.
+func (h *Handlers) Panic(w http.ResponseWriter, r *http.Request) {
+	var req PanicRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	steps := h.runPanic(req.WipeData)
+	h.writeJSON(w, http.StatusOK, PanicResponse{
+		Steps:    steps,
+		WipeData: req.WipeData,
+	})
+}
+
+// runPanic runs every step even if an earlier one failed. The data wipe
+// runs in the background, outside the job manager, so it leaves no job
+// record; the network is resumed afterwards unless it was already
+// suspended, since no torrent is left to transfer anything. Feeds and watch
+// folders stay stopped until the backend restarts, so that nothing adds
+// torrents again once the network is back.
+func (h *Handlers) runPanic(wipeData bool) []PanicStep {
+	var steps []PanicStep
+	step := func(name string, run func() error) {
+		result := PanicStep{Name: name}
+		if err := run(); err != nil {
+			result.Error = err.Error()
+			h.logger.Debug("Panic step failed", zap.String("step", name), zap.Error(err))
+		}
+		steps = append(steps, result)
+	}
+
+	wasSuspended := h.torrentClient.IsNetworkSuspended()
+	step("suspend-network", func() error {
+		h.torrentClient.SuspendNetwork()
+		return nil
+	})
+	step("stop-imports", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), panicJobsTimeout)
+		defer cancel()
+		var errs []error
+		if h.feeds != nil {
+			errs = append(errs, h.feeds.Shutdown(ctx), h.feeds.Clear())
+		}
+		if h.watcher != nil {
+			errs = append(errs, h.watcher.Shutdown(ctx))
+		}
+		if h.search != nil {
+			h.search.Cancel()
+		}
+		return errors.Join(errs...)
+	})
+	step("cancel-jobs", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), panicJobsTimeout)
+		defer cancel()
+		return h.jobs.jobs.Purge(ctx)
+	})
+	step("drop-torrents", func() error {
+		h.torrentClient.RemoveAllTorrents()
+		return h.db.ClearActiveTorrents()
+	})
+	step("lock-keyring", func() error {
+		h.keyring.Lock()
+		return nil
+	})
+	step("clear-events", func() error {
+		h.torrentClient.EgressGuard().Reset()
+		return clearSecurityEvents()
+	})
+	if wipeData {
+		step("clear-settings", h.db.ClearUserSettings)
+		step("wipe-data", func() error {
+			go h.wipePanicData(h.wipePasses(0))
+			return nil
+		})
+	}
+	if !wasSuspended {
+		step("resume-network", func() error {
+			h.torrentClient.ResumeNetwork()
+			return nil
+		})
+	}
+	return steps
+}
+
+func (h *Handlers) wipePanicData(passes int) {
+	for _, key := range []string{"DOWNLOAD_DIR", "TEMP_DIR", "UPLOAD_DIR"} {
+		dir := os.Getenv(key)
+		if dir == "" {
+			continue
+		}
+		if _, err := security.WipeDirContents(context.Background(), dir, passes, nil); err != nil {
+			h.logger.Debug("Panic wipe incomplete", zap.String("directory", key), zap.Error(err))
+		}
+	}
+}
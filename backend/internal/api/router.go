@@ -3,75 +3,229 @@ package api
 import (
 	"net/http"
 
+	"github.com/KFN002/B-2-Torrent/backend/internal/audit"
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
 	"github.com/KFN002/B-2-Torrent/backend/internal/database"
+	"github.com/KFN002/B-2-Torrent/backend/internal/feeds"
+	"github.com/KFN002/B-2-Torrent/backend/internal/jobs"
+	"github.com/KFN002/B-2-Torrent/backend/internal/metrics"
 	"github.com/KFN002/B-2-Torrent/backend/internal/middleware"
+	"github.com/KFN002/B-2-Torrent/backend/internal/search"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings"
 	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"github.com/KFN002/B-2-Torrent/backend/internal/watchfolder"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 )
 
-func SetupRouter(db *database.Database, torrentClient *torrent.Client, logger *zap.Logger) http.Handler {
+// Dependencies holds the long-lived components the HTTP API is built on.
+type Dependencies struct {
+	DB            *database.Database
+	TorrentClient *torrent.Client
+	KillSwitch    *security.KillSwitch
+	Connectivity  *ConnectivityMonitor
+	Keyring       *security.Keyring
+	Duress        *security.Duress
+	Accounts      *auth.Service
+	Audit         *audit.Log
+	Feeds         *feeds.Manager
+	Search        *search.Manager
+	WatchFolders  *watchfolder.Watcher
+	Jobs          *jobs.Manager
+	RateLimiter   *middleware.RateLimiter
+	Metrics       *metrics.Metrics
+	Logger        *zap.Logger
+}
+
+func SetupRouter(deps Dependencies) http.Handler {
+	logger := deps.Logger
 	r := mux.NewRouter()
 
-	rateLimiter := middleware.NewRateLimiter()
+	rateLimiter := deps.RateLimiter
+	if rateLimiter == nil {
+		rateLimiter = middleware.NewRateLimiter(middleware.RateLimitConfig{}, nil, logger)
+	}
+	if deps.Metrics != nil {
+		r.Use(middleware.Metrics(deps.Metrics.ObserveHTTP))
+	}
 	r.Use(middleware.SecurityHeaders)
 	r.Use(middleware.AnonymityHeaders)
 	r.Use(middleware.LimitRequestBody(10 << 20))
 	r.Use(middleware.CORS)
-	r.Use(middleware.APIKey)
+	r.Use(middleware.Authenticate(deps.Accounts))
 	r.Use(rateLimiter.Middleware)
 	r.Use(recoverer(logger))
 
-	h := NewHandlers(db, torrentClient, logger)
-	eh := NewEncryptionHandlers(logger)
+	jh := NewJobHandlers(deps.Jobs, deps.Audit, logger)
+	h := NewHandlers(deps, jh)
+	eh := NewEncryptionHandlers(jh, deps.Keyring, logger)
+	jh.Register(jobKindEncrypt, auth.ScopeFilesEncrypt, eh.encryptJob)
+	jh.Register(jobKindDecrypt, auth.ScopeFilesEncrypt, eh.decryptJob)
+	jh.Register(jobKindSecureDelete, auth.ScopeSecurityAdmin, h.secureDeleteJob)
+	jh.Register(jobKindCleanup, auth.ScopeSecurityAdmin, h.cleanupJob)
+	jh.Register(jobKindAutoEncrypt, auth.ScopeFilesEncrypt, h.autoEncryptJob)
+	if deps.TorrentClient != nil {
+		deps.TorrentClient.OnComplete(h.autoEncryptCompleted)
+	}
+
+	// Each route needs a role from logged-in users and a scope from API
+	// tokens.
+	signedIn := middleware.Require(auth.RoleViewer, "")
+	torrentsRead := middleware.Require(auth.RoleViewer, auth.ScopeTorrentsRead)
+	torrentsWrite := middleware.Require(auth.RoleOperator, auth.ScopeTorrentsWrite)
+	settingsRead := middleware.Require(auth.RoleViewer, auth.ScopeSettingsRead)
+	settingsWrite := middleware.Require(auth.RoleAdmin, auth.ScopeSettingsWrite)
+	securityRead := middleware.Require(auth.RoleViewer, auth.ScopeSecurityRead)
+	securityAdmin := middleware.Require(auth.RoleAdmin, auth.ScopeSecurityAdmin)
+	filesEncrypt := middleware.Require(auth.RoleAdmin, auth.ScopeFilesEncrypt)
+	jobsRead := middleware.Require(auth.RoleViewer, auth.ScopeJobsRead)
+	jobsWrite := middleware.Require(auth.RoleAdmin, auth.ScopeJobsWrite)
+	accountsAdmin := middleware.Require(auth.RoleAdmin, auth.ScopeAccountsAdmin)
+	metricsRead := middleware.Require(auth.RoleViewer, auth.ScopeMetricsRead)
+
+	if deps.Metrics != nil {
+		r.Handle("/metrics", metricsRead(deps.Metrics.Handler().ServeHTTP)).Methods(http.MethodGet)
+	}
 
 	api := r.PathPrefix("/api").Subrouter()
 
-	api.HandleFunc("/torrents", h.AddTorrent).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/torrents", h.GetTorrents).Methods(http.MethodGet)
-	api.HandleFunc("/torrents/{infoHash}", h.GetTorrent).Methods(http.MethodGet)
-	api.HandleFunc("/torrents/{infoHash}", h.DeleteTorrent).Methods(http.MethodDelete, http.MethodOptions)
-	api.HandleFunc("/torrents/{infoHash}/pause", h.PauseTorrent).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/torrents/{infoHash}/resume", h.ResumeTorrent).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/torrents/{infoHash}/favorite", h.ToggleFavorite).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/torrents/{infoHash}/limits", h.SetTorrentLimits).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/torrents/{infoHash}/schedule", h.SetTorrentSchedule).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/torrents/events", h.GetTorrentEvents).Methods(http.MethodGet)
-
-	api.HandleFunc("/settings", h.GetSettings).Methods(http.MethodGet)
-	api.HandleFunc("/settings", h.UpdateSettings).Methods(http.MethodPut, http.MethodOptions)
-	api.HandleFunc("/settings/limits", h.SetGlobalLimits).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/config/initial", h.ApplyInitialConfig).Methods(http.MethodPost, http.MethodOptions)
-
-	api.HandleFunc("/encryption/encrypt", eh.EncryptFile).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/encryption/decrypt", eh.DecryptFile).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/encryption/algorithms", eh.GetSupportedAlgorithms).Methods(http.MethodGet)
-
-	api.HandleFunc("/security/status", h.GetSecurityStatus).Methods(http.MethodGet)
-	api.HandleFunc("/security/config", h.GetSecurityConfig).Methods(http.MethodGet)
-	api.HandleFunc("/security/settings", h.UpdateSecuritySettings).Methods(http.MethodPut, http.MethodOptions)
-	api.HandleFunc("/security/killswitch", h.TriggerKillSwitch).Methods(http.MethodPost, http.MethodOptions)
-	api.HandleFunc("/security/ip", h.GetIPStatus).Methods(http.MethodGet)
-	api.HandleFunc("/security/dns-test", h.TestDNSLeak).Methods(http.MethodGet)
-	api.HandleFunc("/security/metrics", h.GetSecurityMetrics).Methods(http.MethodGet)
-	api.HandleFunc("/security/events", h.GetSecurityEvents).Methods(http.MethodGet)
-	api.HandleFunc("/security/secure-delete", h.SecureDeleteFile).Methods(http.MethodPost, http.MethodOptions)
-
-	api.HandleFunc("/network/connections", h.GetNetworkConnections).Methods(http.MethodGet)
-	api.HandleFunc("/network/stats", h.GetNetworkStats).Methods(http.MethodGet)
-	api.HandleFunc("/network/tor", h.GetTorConnections).Methods(http.MethodGet)
+	api.HandleFunc("/auth/login", h.Login).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/auth/setup", accountsAdmin(h.SetupAccounts)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/auth/logout", signedIn(h.Logout)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/auth/session", signedIn(h.GetSession)).Methods(http.MethodGet)
+	api.Handle("/auth/password", signedIn(h.ChangePassword)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/users", accountsAdmin(h.ListUsers)).Methods(http.MethodGet)
+	api.Handle("/users", accountsAdmin(h.CreateUser)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/users/{id}", accountsAdmin(h.UpdateUser)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/users/{id}", accountsAdmin(h.DeleteUser)).Methods(http.MethodDelete, http.MethodOptions)
+	api.Handle("/tokens", accountsAdmin(h.ListTokens)).Methods(http.MethodGet)
+	api.Handle("/tokens", accountsAdmin(h.CreateToken)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/tokens/scopes", accountsAdmin(h.GetTokenScopes)).Methods(http.MethodGet)
+	api.Handle("/tokens/{id}/rotate", accountsAdmin(h.RotateToken)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/tokens/{id}", accountsAdmin(h.RevokeToken)).Methods(http.MethodDelete, http.MethodOptions)
+
+	api.Handle("/torrents", torrentsWrite(h.AddTorrent)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/torrents", torrentsRead(h.GetTorrents)).Methods(http.MethodGet)
+	api.Handle("/torrents/{infoHash}", torrentsRead(h.GetTorrent)).Methods(http.MethodGet)
+	api.Handle("/torrents/{infoHash}/peers", torrentsRead(h.GetTorrentPeers)).Methods(http.MethodGet)
+	api.Handle("/torrents/{infoHash}/files", torrentsRead(h.GetTorrentFiles)).Methods(http.MethodGet)
+	api.Handle("/torrents/{infoHash}/files/priority", torrentsWrite(h.SetFilePriority)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/torrents/{infoHash}", torrentsWrite(h.DeleteTorrent)).Methods(http.MethodDelete, http.MethodOptions)
+	api.Handle("/torrents/{infoHash}/pause", torrentsWrite(h.PauseTorrent)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/torrents/{infoHash}/resume", torrentsWrite(h.ResumeTorrent)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/torrents/{infoHash}/favorite", torrentsWrite(h.ToggleFavorite)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/torrents/{infoHash}/limits", torrentsWrite(h.SetTorrentLimits)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/torrents/{infoHash}/schedule", torrentsWrite(h.SetTorrentSchedule)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/torrents/events", torrentsRead(h.GetTorrentEvents)).Methods(http.MethodGet)
+
+	// Feed URLs often carry private passkeys, so even listing feeds needs
+	// write access to torrents.
+	api.Handle("/feeds", torrentsWrite(h.ListFeeds)).Methods(http.MethodGet)
+	api.Handle("/feeds", torrentsWrite(h.CreateFeed)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/feeds/history", torrentsRead(h.GetFeedHistory)).Methods(http.MethodGet)
+	api.Handle("/feeds/history", torrentsWrite(h.ClearFeedHistory)).Methods(http.MethodDelete, http.MethodOptions)
+	api.Handle("/feeds/{id}", torrentsWrite(h.GetFeed)).Methods(http.MethodGet)
+	api.Handle("/feeds/{id}", torrentsWrite(h.UpdateFeed)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/feeds/{id}", torrentsWrite(h.DeleteFeed)).Methods(http.MethodDelete, http.MethodOptions)
+	api.Handle("/feeds/{id}/refresh", torrentsWrite(h.RefreshFeed)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/feeds/{id}/rules", torrentsWrite(h.AddFeedRule)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/feeds/{id}/rules/{ruleId}", torrentsWrite(h.UpdateFeedRule)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/feeds/{id}/rules/{ruleId}", torrentsWrite(h.DeleteFeedRule)).Methods(http.MethodDelete, http.MethodOptions)
+
+	api.Handle("/search", torrentsRead(h.Search)).Methods(http.MethodGet)
+	api.Handle("/search/results/{id}/add", torrentsWrite(h.AddSearchResult)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/search/indexers", settingsRead(h.ListIndexers)).Methods(http.MethodGet)
+	api.Handle("/search/indexers", settingsWrite(h.CreateIndexer)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/search/indexers/{id}", settingsRead(h.GetIndexer)).Methods(http.MethodGet)
+	api.Handle("/search/indexers/{id}", settingsWrite(h.UpdateIndexer)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/search/indexers/{id}", settingsWrite(h.DeleteIndexer)).Methods(http.MethodDelete, http.MethodOptions)
+
+	api.Handle("/settings", settingsRead(h.GetSettings)).Methods(http.MethodGet)
+	api.Handle("/settings", settingsWrite(h.UpdateSettings)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/settings/limits", settingsWrite(h.SetGlobalLimits)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/settings/schema", settingsRead(h.GetSettingsSchema)).Methods(http.MethodGet)
+	api.Handle("/settings/values", settingsRead(h.GetSettingValues)).Methods(http.MethodGet)
+	api.Handle("/settings/values", settingsWrite(h.UpdateSettingValues)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/settings/export", settingsWrite(h.ExportSettings)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/settings/import", settingsWrite(h.ImportSettings)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/config/initial", settingsWrite(h.ApplyInitialConfig)).Methods(http.MethodPost, http.MethodOptions)
+
+	api.Handle("/encryption/encrypt", filesEncrypt(eh.EncryptFile)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/encryption/decrypt", filesEncrypt(eh.DecryptFile)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/encryption/read", filesEncrypt(eh.ReadEncryptedRange)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/encryption/algorithms", securityRead(eh.GetSupportedAlgorithms)).Methods(http.MethodGet)
+
+	api.Handle("/keyring", securityRead(h.GetKeyringStatus)).Methods(http.MethodGet)
+	api.Handle("/keyring/init", securityAdmin(h.InitializeKeyring)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/keyring/unlock", securityAdmin(h.UnlockKeyring)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/keyring/lock", securityAdmin(h.LockKeyring)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/keyring/passphrase", securityAdmin(h.ChangeKeyringPassphrase)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/keyring/rotate", securityAdmin(h.RotateKeyring)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/keyring/duress", securityAdmin(h.SetDuressPassphrase)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/keyring/duress", securityAdmin(h.ClearDuressPassphrase)).Methods(http.MethodDelete, http.MethodOptions)
+
+	api.Handle("/security/status", securityRead(h.GetSecurityStatus)).Methods(http.MethodGet)
+	api.Handle("/security/config", securityRead(h.GetSecurityConfig)).Methods(http.MethodGet)
+	api.Handle("/security/settings", securityAdmin(h.UpdateSecuritySettings)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/security/killswitch", securityRead(h.GetKillSwitchStatus)).Methods(http.MethodGet)
+	api.Handle("/security/killswitch", securityAdmin(h.TriggerKillSwitch)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/security/killswitch/reset", securityAdmin(h.ResetKillSwitch)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/security/connectivity", securityRead(h.GetConnectivityStatus)).Methods(http.MethodGet)
+	api.Handle("/security/ip", securityRead(h.GetIPStatus)).Methods(http.MethodGet)
+	api.Handle("/security/dns-test", securityRead(h.TestDNSLeak)).Methods(http.MethodGet)
+	api.Handle("/security/metrics", securityRead(h.GetSecurityMetrics)).Methods(http.MethodGet)
+	api.Handle("/security/encryption", securityRead(h.GetEncryptionStatus)).Methods(http.MethodGet)
+	api.Handle("/security/events", securityRead(h.GetSecurityEvents)).Methods(http.MethodGet)
+	api.Handle("/security/events/stream", securityRead(h.StreamSecurityEvents)).Methods(http.MethodGet)
+	api.Handle("/security/events/ack", securityAdmin(h.AcknowledgeSecurityEvents)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/security/events/retention", securityRead(h.GetEventRetention)).Methods(http.MethodGet)
+	api.Handle("/security/events/retention", securityAdmin(h.UpdateEventRetention)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/security/secure-delete", securityAdmin(h.SecureDeleteFile)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/panic", securityAdmin(h.Panic)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/security/audit", securityAdmin(h.GetAuditLog)).Methods(http.MethodGet)
+	api.Handle("/security/audit", securityAdmin(h.UpdateAuditLog)).Methods(http.MethodPut, http.MethodOptions)
+	api.Handle("/security/audit/verify", securityAdmin(h.VerifyAuditLog)).Methods(http.MethodGet)
+
+	api.Handle("/network/connections", securityRead(h.GetNetworkConnections)).Methods(http.MethodGet)
+	api.Handle("/network/stats", securityRead(h.GetNetworkStats)).Methods(http.MethodGet)
+	api.Handle("/network/egress", securityRead(h.GetEgressStats)).Methods(http.MethodGet)
+	api.Handle("/network/tor", securityRead(h.GetTorConnections)).Methods(http.MethodGet)
+	api.Handle("/network/tor/status", securityRead(h.GetTorControlStatus)).Methods(http.MethodGet)
+	api.Handle("/network/tor/newnym", securityAdmin(h.RotateTorCircuits)).Methods(http.MethodPost, http.MethodOptions)
+
+	api.Handle("/jobs", jobsWrite(jh.SubmitJob)).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/jobs", jobsRead(jh.ListJobs)).Methods(http.MethodGet)
+	api.Handle("/jobs/{id}", jobsRead(jh.GetJob)).Methods(http.MethodGet)
+	api.Handle("/jobs/{id}", jobsWrite(jh.CancelJob)).Methods(http.MethodDelete, http.MethodOptions)
 
 	api.HandleFunc("/health", h.HealthCheck).Methods(http.MethodGet)
-	api.HandleFunc("/cleanup", h.CleanupData).Methods(http.MethodPost, http.MethodOptions)
+	api.Handle("/openapi.json", signedIn(h.GetOpenAPI)).Methods(http.MethodGet)
+	api.Handle("/cleanup", securityAdmin(h.CleanupData)).Methods(http.MethodPost, http.MethodOptions)
 
 	return r
 }
 
-func NewHandlers(db *database.Database, torrentClient *torrent.Client, logger *zap.Logger) *Handlers {
+func NewHandlers(deps Dependencies, jobs *JobHandlers) *Handlers {
+	connectivity := deps.Connectivity
+	if connectivity == nil {
+		connectivity = NewConnectivityMonitor(ConnectivityConfig{})
+	}
 	return &Handlers{
-		db:            db,
-		torrentClient: torrentClient,
-		logger:        logger,
+		db:            deps.DB,
+		torrentClient: deps.TorrentClient,
+		killSwitch:    deps.KillSwitch,
+		connectivity:  connectivity,
+		keyring:       deps.Keyring,
+		duress:        deps.Duress,
+		accounts:      deps.Accounts,
+		auditLog:      deps.Audit,
+		feeds:         deps.Feeds,
+		search:        deps.Search,
+		watcher:       deps.WatchFolders,
+		settings:      settings.NewStore(deps.DB),
+		jobs:          jobs,
+		logger:        deps.Logger,
 	}
 }
 
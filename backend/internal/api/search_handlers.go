@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/search"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// AddSearchResultRequest picks where a search result is added.
+type AddSearchResultRequest struct {
+	Category string `json:"category,omitempty"`
+	SavePath string `json:"savePath,omitempty"`
+}
+
+// searchAvailable answers 503 when the server runs without search.
+func (h *Handlers) searchAvailable(w http.ResponseWriter) bool {
+	if h.search == nil {
+		h.writeError(w, http.StatusServiceUnavailable, "Search is not available")
+		return false
+	}
+	return true
+}
+
+// Search queries the configured indexers. Queries are neither logged nor
+// audited.
+func (h *Handlers) Search(w http.ResponseWriter, r *http.Request) {
+	if !h.searchAvailable(w) {
+		return
+	}
+	params := r.URL.Query()
+	q := search.Query{
+		Text:      params.Get("q"),
+		Sort:      params.Get("sort"),
+		Ascending: params.Get("order") == "asc",
+	}
+	if order := params.Get("order"); order != "" && order != "asc" && order != "desc" {
+		h.writeError(w, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "limit must be a number")
+			return
+		}
+		q.Limit = n
+	}
+	for _, category := range splitList(params.Get("cat")) {
+		n, err := strconv.Atoi(category)
+		if err != nil || n <= 0 {
+			h.writeError(w, http.StatusBadRequest, "cat must list positive category numbers")
+			return
+		}
+		q.Categories = append(q.Categories, n)
+	}
+	q.Indexers = splitList(params.Get("indexers"))
+
+	res, err := h.search.Search(r.Context(), q)
+	if err != nil {
+		h.writeSearchError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, res)
+}
+
+// AddSearchResult adds a result of a recent search by its ID.
+func (h *Handlers) AddSearchResult(w http.ResponseWriter, r *http.Request) {
+	if !h.searchAvailable(w) {
+		return
+	}
+	var req AddSearchResultRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	infoHash, err := h.search.Add(r.Context(), mux.Vars(r)["id"], torrent.AddOptions{Category: req.Category, SavePath: req.SavePath})
+	switch {
+	case errors.Is(err, search.ErrResultNotFound), errors.Is(err, search.ErrDownload), errors.Is(err, torrent.ErrNetworkSuspended):
+		h.writeSearchError(w, err)
+		return
+	case err != nil:
+		h.logger.Warn("Rejected search result", zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.logger.Info("Torrent added successfully", zap.String("infoHash", infoHash))
+	h.writeJSON(w, http.StatusOK, AddTorrentResponse{InfoHash: infoHash})
+}
+
+func (h *Handlers) ListIndexers(w http.ResponseWriter, r *http.Request) {
+	if !h.searchAvailable(w) {
+		return
+	}
+	list, err := h.search.Indexers()
+	if err != nil {
+		h.writeSearchError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, list)
+}
+
+func (h *Handlers) CreateIndexer(w http.ResponseWriter, r *http.Request) {
+	if !h.searchAvailable(w) {
+		return
+	}
+	var req search.Indexer
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	ix, err := h.search.CreateIndexer(req)
+	if err != nil {
+		h.writeSearchError(w, err)
+		return
+	}
+	h.recordAudit(r, "indexer.create", ix.ID, map[string]string{"name": ix.Name})
+	h.writeJSON(w, http.StatusCreated, ix)
+}
+
+func (h *Handlers) GetIndexer(w http.ResponseWriter, r *http.Request) {
+	if !h.searchAvailable(w) {
+		return
+	}
+	ix, err := h.search.Indexer(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeSearchError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, ix)
+}
+
+// UpdateIndexer replaces an indexer's settings; its API key is kept when
+// the request has none.
+func (h *Handlers) UpdateIndexer(w http.ResponseWriter, r *http.Request) {
+	if !h.searchAvailable(w) {
+		return
+	}
+	var req search.Indexer
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	ix, err := h.search.UpdateIndexer(mux.Vars(r)["id"], req)
+	if err != nil {
+		h.writeSearchError(w, err)
+		return
+	}
+	h.recordAudit(r, "indexer.update", ix.ID, map[string]string{"name": ix.Name})
+	h.writeJSON(w, http.StatusOK, ix)
+}
+
+func (h *Handlers) DeleteIndexer(w http.ResponseWriter, r *http.Request) {
+	if !h.searchAvailable(w) {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if err := h.search.DeleteIndexer(id); err != nil {
+		h.writeSearchError(w, err)
+		return
+	}
+	h.recordAudit(r, "indexer.delete", id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) writeSearchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, search.ErrIndexerNotFound), errors.Is(err, search.ErrResultNotFound):
+		h.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, search.ErrInvalid):
+		h.writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, search.ErrDownload):
+		h.writeError(w, http.StatusBadGateway, err.Error())
+	case errors.Is(err, torrent.ErrNetworkSuspended):
+		h.writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, security.ErrKeyringLocked):
+		h.writeError(w, http.StatusLocked, "Unlock the keyring to use indexers")
+	default:
+		h.logger.Error("Search operation failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Search operation failed")
+	}
+}
@@ -1,34 +1,74 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/KFN002/B-2-Torrent/backend/internal/database"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings"
 	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
 	"go.uber.org/zap"
 )
 
 // SecurityEvent represents a security-related event
-type SecurityEvent struct {
-	Type      string    `json:"type"`
-	Severity  string    `json:"severity"`
-	Message   string    `json:"message"`
-	Timestamp time.Time `json:"timestamp"`
-	Details   string    `json:"details,omitempty"`
-}
+type SecurityEvent = security.SecurityEvent
+
+const (
+	// recentEventsWindow is what GET /security/events returns without any
+	// query parameters, for clients that poll for new alerts.
+	recentEventsWindow    = 30 * time.Second
+	eventStreamBuffer     = 32
+	eventStreamHeartbeat  = 25 * time.Second
+	eventRetentionDaysKey = "security_event_retention_days"
+	eventMaxCountKey      = "security_event_max_count"
+	eventPruneInterval    = time.Hour
+)
 
 var (
-	securityEvents      []SecurityEvent
+	securityEventStore  security.SecurityEventStore = security.NewMemoryEventStore(security.DefaultEventCapacity)
+	securityEventLogger                             = zap.NewNop()
 	securityEventsMutex sync.RWMutex
+
+	securityEventSubscribers []func(SecurityEvent)
+	securityEventStreams     = make(map[chan SecurityEvent]struct{})
+
+	securityEventStreamsDone  = make(chan struct{})
+	closeSecurityEventStreams sync.Once
 )
 
-// AddSecurityEvent adds a new security event to the queue
-func AddSecurityEvent(eventType, severity, message, details string) {
+// UseSecurityEventStore replaces where events are kept. It is meant to be
+// called once at startup, before any event is added.
+func UseSecurityEventStore(store security.SecurityEventStore, logger *zap.Logger) {
 	securityEventsMutex.Lock()
 	defer securityEventsMutex.Unlock()
+	securityEventStore = store
+	securityEventLogger = logger
+}
+
+// SubscribeSecurityEvents registers fn to be called for every new event.
+func SubscribeSecurityEvents(fn func(SecurityEvent)) {
+	securityEventsMutex.Lock()
+	defer securityEventsMutex.Unlock()
+	securityEventSubscribers = append(securityEventSubscribers, fn)
+}
+
+// CloseSecurityEventStreams ends every live event stream so the HTTP server
+// can shut down.
+func CloseSecurityEventStreams() {
+	closeSecurityEventStreams.Do(func() { close(securityEventStreamsDone) })
+}
 
+// AddSecurityEvent stores a new security event and hands it to subscribers
+// and live streams. Streams that fall behind miss events rather than block.
+func AddSecurityEvent(eventType, severity, message, details string) {
 	event := SecurityEvent{
 		Type:      eventType,
 		Severity:  severity,
@@ -37,80 +77,305 @@ func AddSecurityEvent(eventType, severity, message, details string) {
 		Details:   details,
 	}
 
-	securityEvents = append(securityEvents, event)
+	securityEventsMutex.RLock()
+	store, logger := securityEventStore, securityEventLogger
+	securityEventsMutex.RUnlock()
+	if err := store.AddSecurityEvent(&event); err != nil {
+		logger.Warn("Failed to store security event", zap.String("type", eventType), zap.Error(err))
+	}
+
+	securityEventsMutex.RLock()
+	subscribers := make([]func(SecurityEvent), len(securityEventSubscribers))
+	copy(subscribers, securityEventSubscribers)
+	for stream := range securityEventStreams {
+		select {
+		case stream <- event:
+		default:
+		}
+	}
+	securityEventsMutex.RUnlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(event)
+	}
+}
+
+// clearSecurityEvents drops every stored event. Subscribers are kept.
+func clearSecurityEvents() error {
+	securityEventsMutex.RLock()
+	defer securityEventsMutex.RUnlock()
+	return securityEventStore.ClearSecurityEvents()
+}
+
+// purgePersistedSecurityEvents drops the events a persistent store has kept
+// on disk. Stores that keep nothing on disk are left alone.
+func purgePersistedSecurityEvents() error {
+	securityEventsMutex.RLock()
+	defer securityEventsMutex.RUnlock()
+	if store, ok := securityEventStore.(interface{ PurgePersisted() error }); ok {
+		return store.PurgePersisted()
+	}
+	return nil
+}
+
+func subscribeSecurityEventStream() (<-chan SecurityEvent, func()) {
+	stream := make(chan SecurityEvent, eventStreamBuffer)
+	securityEventsMutex.Lock()
+	securityEventStreams[stream] = struct{}{}
+	securityEventsMutex.Unlock()
+	return stream, func() {
+		securityEventsMutex.Lock()
+		delete(securityEventStreams, stream)
+		securityEventsMutex.Unlock()
+	}
+}
+
+// EventRetention controls how long stored security events are kept.
+type EventRetention struct {
+	Days      int `json:"days"`
+	MaxEvents int `json:"maxEvents"`
+}
+
+type AcknowledgeEventsRequest struct {
+	// IDs lists the events to acknowledge; empty acknowledges all of them.
+	IDs []int64 `json:"ids"`
+}
+
+// AcknowledgeEventsResponse reports how many events were acknowledged.
+type AcknowledgeEventsResponse struct {
+	Acknowledged int `json:"acknowledged"`
+}
+
+// parseEventFilter reads severity, type, since, until, unacknowledged,
+// before and limit from the query string. Without any parameters only the
+// last recentEventsWindow is returned.
+func parseEventFilter(r *http.Request) (security.EventFilter, error) {
+	query := r.URL.Query()
+	filter := security.EventFilter{
+		Severities:     splitList(query.Get("severity")),
+		Types:          splitList(query.Get("type")),
+		Unacknowledged: query.Get("unacknowledged") == "true",
+	}
+	if len(query) == 0 {
+		filter.Since = time.Now().Add(-recentEventsWindow)
+		return filter, nil
+	}
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+			*target = parsed
+		}
+	}
+	if value := query.Get("before"); value != "" {
+		before, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || before < 1 {
+			return filter, fmt.Errorf("before must be a positive number")
+		}
+		filter.Before = before
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return filter, fmt.Errorf("limit must be a positive number")
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
 
-	// Keep only last 100 events
-	if len(securityEvents) > 100 {
-		securityEvents = securityEvents[len(securityEvents)-100:]
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
 
-// GetSecurityEvents returns recent security events
+// GetSecurityEvents returns stored security events, newest first, filtered
+// by the query string. Without parameters only the last 30 seconds are
+// returned, for clients that poll for new alerts.
 func (h *Handlers) GetSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	securityEventsMutex.RLock()
+	store := securityEventStore
+	securityEventsMutex.RUnlock()
+	events, err := store.ListSecurityEvents(filter)
+	if err != nil {
+		h.logger.Error("Failed to list security events", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to list security events")
+		return
+	}
+
+	h.logger.Debug("Returning security events", zap.Int("count", len(events)))
+	h.writeJSON(w, http.StatusOK, events)
+}
+
+// AcknowledgeSecurityEvents marks events as seen.
+func (h *Handlers) AcknowledgeSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	var req AcknowledgeEventsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
 	securityEventsMutex.RLock()
-	events := make([]SecurityEvent, len(securityEvents))
-	copy(events, securityEvents)
+	store := securityEventStore
 	securityEventsMutex.RUnlock()
+	count, err := store.AcknowledgeSecurityEvents(req.IDs, time.Now())
+	if err != nil {
+		h.logger.Error("Failed to acknowledge security events", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Failed to acknowledge security events")
+		return
+	}
+	h.writeJSON(w, http.StatusOK, AcknowledgeEventsResponse{Acknowledged: count})
+}
+
+// StreamSecurityEvents pushes new events as server-sent events until the
+// client goes away. The severity and type filters apply.
+func (h *Handlers) StreamSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	filter := security.EventFilter{
+		Severities: splitList(r.URL.Query().Get("severity")),
+		Types:      splitList(r.URL.Query().Get("type")),
+	}
+	controller := http.NewResponseController(w)
+	// The stream outlives the server's write timeout.
+	_ = controller.SetWriteDeadline(time.Time{})
 
-	// Only return events from last 30 seconds
-	cutoff := time.Now().Add(-30 * time.Second)
-	recentEvents := []SecurityEvent{}
-	for _, event := range events {
-		if event.Timestamp.After(cutoff) {
-			recentEvents = append(recentEvents, event)
+	stream, unsubscribe := subscribeSecurityEventStream()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		h.logger.Warn("Event streaming is not supported by the connection", zap.Error(err))
+		return
+	}
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-securityEventStreamsDone:
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case event := <-stream:
+			if !filter.Matches(event) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: security\ndata: %s\n\n", event.ID, data); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
 		}
 	}
+}
 
-	h.logger.Debug("Returning security events", zap.Int("count", len(recentEvents)))
-	h.writeJSON(w, http.StatusOK, recentEvents)
+// GetEventRetention reports how long security events are kept.
+func (h *Handlers) GetEventRetention(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, eventRetention(h.db))
 }
 
-// StartSecurityMonitoring continuously monitors security status and generates alerts
-func StartSecurityMonitoring(db *database.Database, tc *torrent.Client, logger *zap.Logger) {
+// UpdateEventRetention changes how long security events are kept and prunes
+// right away.
+func (h *Handlers) UpdateEventRetention(w http.ResponseWriter, r *http.Request) {
+	var req EventRetention
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Days < 1 || req.Days > 365 || req.MaxEvents < 1 || req.MaxEvents > 1000000 {
+		h.writeError(w, http.StatusBadRequest, "Retention must be 1-365 days and 1-1000000 events")
+		return
+	}
+	if _, err := h.settings.Set(rawSettings(map[string]string{
+		eventRetentionDaysKey: strconv.Itoa(req.Days),
+		eventMaxCountKey:      strconv.Itoa(req.MaxEvents),
+	}), allowsSecuritySettings(r)); err != nil {
+		h.writeSettingsError(w, err)
+		return
+	}
+	pruneSecurityEvents(h.db, h.logger)
+	h.writeJSON(w, http.StatusOK, req)
+}
+
+func eventRetention(db *database.Database) EventRetention {
+	store := settings.NewStore(db)
+	return EventRetention{
+		Days:      int(store.Int(eventRetentionDaysKey)),
+		MaxEvents: int(store.Int(eventMaxCountKey)),
+	}
+}
+
+// pruneSecurityEvents drops events outside the retention settings.
+func pruneSecurityEvents(db *database.Database, logger *zap.Logger) {
+	retention := eventRetention(db)
+	securityEventsMutex.RLock()
+	store := securityEventStore
+	securityEventsMutex.RUnlock()
+	olderThan := time.Now().Add(-time.Duration(retention.Days) * 24 * time.Hour)
+	if _, err := store.PruneSecurityEvents(olderThan, retention.MaxEvents); err != nil {
+		logger.Warn("Failed to prune security events", zap.Error(err))
+	}
+}
+
+// StartSecurityMonitoring continuously monitors security status and generates
+// alerts. Critical alerts reach the kill switch through KillSwitchEventFeed,
+// and cm counts failed Tor and VPN checks itself; a round without any clears
+// the violation count. Connectivity checks pause while the network is
+// suspended.
+func StartSecurityMonitoring(db *database.Database, tc *torrent.Client, ks *security.KillSwitch, cm *ConnectivityMonitor, logger *zap.Logger) {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
 	logger.Info("Security monitoring started")
 
+	pruneSecurityEvents(db, logger)
+	lastPrune := time.Now()
+	lastLeaks := checkForLeaks(db, tc)
 	for range ticker.C {
-		// Check for leaks
-		leaks := checkForLeaks(db, tc)
-		if leaks > 0 {
-			AddSecurityEvent(
-				"leak_detected",
-				"critical",
-				"IP or DNS leak detected during connection",
-				"Your real IP may be exposed to peers",
-			)
+		if time.Since(lastPrune) >= eventPruneInterval {
+			pruneSecurityEvents(db, logger)
+			lastPrune = time.Now()
 		}
 
-		// Check VPN/Tor status
-		vpnType, _ := db.GetSetting("vpn_type")
-		if vpnType == "" {
-			vpnType = "none"
-		}
-		torEnabled := tc.IsTorEnabled()
+		healthy := true
 
-		if vpnType != "none" && !isVPNConnected(vpnType) {
-			AddSecurityEvent(
-				"vpn_disconnected",
-				"critical",
-				"VPN connection lost",
-				"Reconnecting to restore privacy protection",
-			)
+		// Each refusal already raised its own leak event through
+		// EgressLeakFeed; new ones only keep this round from counting as healthy.
+		leaks := checkForLeaks(db, tc)
+		if leaks > lastLeaks {
+			healthy = false
 		}
+		lastLeaks = leaks
 
-		if torEnabled && !tc.IsTorConnected() {
-			AddSecurityEvent(
-				"tor_disconnected",
-				"critical",
-				"Tor connection lost",
-				"Privacy protection interrupted",
-			)
+		if tc.IsNetworkSuspended() {
+			healthy = false
+		} else if !cm.check(db, tc, ks, logger) {
+			healthy = false
 		}
 
 		// Calculate security score
-		score := calculateSecurityScore(db, tc)
+		score := SecurityScore(tc)
 		if score < 60 {
 			AddSecurityEvent(
 				"security_score_low",
@@ -119,23 +384,31 @@ func StartSecurityMonitoring(db *database.Database, tc *torrent.Client, logger *
 				"Enable additional security features to improve protection",
 			)
 		}
+
+		if healthy {
+			ks.RecordHealthy()
+		}
 	}
 }
 
 // Helper functions
-func checkForLeaks(db *database.Database, tc *torrent.Client) int {
-	// Implement leak detection logic
-	// This is a placeholder - actual implementation would check real IP exposure
-	return 0
+func checkForLeaks(_ *database.Database, tc *torrent.Client) int {
+	return int(tc.EgressGuard().LeaksDetected())
 }
 
-func isVPNConnected(vpnType string) bool {
-	// Implement VPN connectivity check
-	// This is a placeholder
-	return true
+// EgressLeakFeed turns every connection refused by the egress guard into a
+// leak event.
+func EgressLeakFeed(record torrent.EgressRecord) {
+	AddSecurityEvent(
+		"leak_detected",
+		"critical",
+		fmt.Sprintf("Blocked direct %s connection while a proxy is required", record.Caller),
+		"The connection was refused before leaving the host",
+	)
 }
 
-func calculateSecurityScore(_ *database.Database, tc *torrent.Client) int {
+// SecurityScore rates the active privacy protections from 0 to 100.
+func SecurityScore(tc *torrent.Client) int {
 	score := 0
 	privacy := tc.PrivacyStatus()
 	if privacy.ProxyAvailable && privacy.IPObfuscation {
@@ -1,25 +1,33 @@
 package api
 
 import (
-	"crypto/rand"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
+	"github.com/KFN002/B-2-Torrent/backend/internal/jobs"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
 	"go.uber.org/zap"
 )
 
 const (
 	maxSecureDeleteFiles        = 25
 	secureDeleteConfirmationKey = "SECURE_DELETE"
+	minWipePasses               = 3
+	maxWipePasses               = 35
 )
 
 // SecurityConfig represents security settings
 type SecurityConfig struct {
 	KillSwitchEnabled     bool   `json:"killSwitchEnabled"`
+	KillSwitchMode        string `json:"killSwitchMode"`
 	DNSProtectionEnabled  bool   `json:"dnsProtectionEnabled"`
 	DNSObfuscationEnabled bool   `json:"dnsObfuscationEnabled"`
 	IPObfuscationEnabled  bool   `json:"ipObfuscationEnabled"`
@@ -33,6 +41,7 @@ type SecurityConfig struct {
 	NoLogsMode            bool   `json:"noLogsMode"`
 	ObfuscateTraffic      bool   `json:"obfuscateTraffic"`
 	ForceEncryption       bool   `json:"forceEncryption"`
+	EncryptionMode        string `json:"encryptionMode"`
 	EncryptionLevel       string `json:"encryptionLevel"`
 	MinEncryptionProtocol string `json:"minEncryptionProtocol"`
 	RejectPlaintext       bool   `json:"rejectPlaintext"`
@@ -50,6 +59,9 @@ type SecurityConfig struct {
 // SecurityStatus represents the current security status for monitoring
 type SecurityStatus struct {
 	KillSwitchActive           bool   `json:"killSwitchActive"`
+	KillSwitchTriggered        bool   `json:"killSwitchTriggered"`
+	KillSwitchMode             string `json:"killSwitchMode"`
+	NetworkSuspended           bool   `json:"networkSuspended"`
 	DNSProtectionActive        bool   `json:"dnsProtectionActive"`
 	DNSObfuscationActive       bool   `json:"dnsObfuscationActive"`
 	IPObfuscationActive        bool   `json:"ipObfuscationActive"`
@@ -83,11 +95,64 @@ type SecurityStatus struct {
 	LastCheck                  string `json:"lastCheck"`
 }
 
-func boolSettingOrDefault(value string, fallback bool) bool {
-	if value == "" {
-		return fallback
+// encryptionLevelFor describes a protocol encryption mode with the legacy
+// encryptionLevel and minEncryptionProtocol values.
+func encryptionLevelFor(mode torrent.EncryptionMode) (level, minProtocol string) {
+	switch mode {
+	case torrent.EncryptionRequire:
+		return "rc4-required", "MSE/PE RC4"
+	case torrent.EncryptionDisabled:
+		return "disabled", "none"
+	default:
+		return "rc4-preferred", "none"
+	}
+}
+
+// encryptionSettings returns the stored form of an encryption mode and of
+// the legacy settings that mirror it.
+func encryptionSettings(mode torrent.EncryptionMode) map[string]string {
+	level, minProtocol := encryptionLevelFor(mode)
+	require := strconv.FormatBool(mode == torrent.EncryptionRequire)
+	return map[string]string{
+		"encryption_mode":         string(mode),
+		"force_encryption":        require,
+		"reject_plaintext":        require,
+		"encryption_level":        level,
+		"min_encryption_protocol": minProtocol,
 	}
-	return value == "true"
+}
+
+// securitySettingValues returns the stored form of every setting
+// UpdateSecuritySettings writes. Each of them is a security setting in the
+// registry, so PUT /api/settings/values and imports need the same scope.
+func securitySettingValues(config SecurityConfig, mode torrent.EncryptionMode) map[string]string {
+	values := map[string]string{
+		"kill_switch_enabled":     strconv.FormatBool(config.KillSwitchEnabled),
+		"kill_switch_mode":        config.KillSwitchMode,
+		"dns_protection_enabled":  strconv.FormatBool(config.DNSProtectionEnabled),
+		"dns_obfuscation_enabled": strconv.FormatBool(config.DNSObfuscationEnabled),
+		"ip_obfuscation_enabled":  strconv.FormatBool(config.IPObfuscationEnabled),
+		"dht_invisibility":        strconv.FormatBool(config.DHTInvisibility),
+		"sharing_disabled":        strconv.FormatBool(config.SharingDisabled),
+		"data_encryption_enabled": strconv.FormatBool(config.DataEncryptionEnabled),
+		"tor_enabled":             strconv.FormatBool(config.TorEnabled),
+		"vpn_type":                config.VPNType,
+		"no_logs_mode":            strconv.FormatBool(config.NoLogsMode),
+		"obfuscate_traffic":       strconv.FormatBool(config.ObfuscateTraffic),
+		"mac_randomization":       strconv.FormatBool(config.MACRandomization),
+		"anti_fingerprint":        strconv.FormatBool(config.AntiFingerprint),
+		"secure_delete":           strconv.FormatBool(config.SecureDelete),
+		"peer_verification":       strconv.FormatBool(config.PeerVerification),
+		"block_malicious_peers":   strconv.FormatBool(config.BlockMaliciousPeers),
+		"sandbox_mode":            strconv.FormatBool(config.SandboxMode),
+		"memory_encryption":       strconv.FormatBool(config.MemoryEncryption),
+		"auto_wipe_on_exit":       strconv.FormatBool(config.AutoWipeOnExit),
+		"stealth_mode":            strconv.FormatBool(config.StealthMode),
+	}
+	for key, value := range encryptionSettings(mode) {
+		values[key] = value
+	}
+	return values
 }
 
 func connectionTypeFor(vpnType string, torEnabled bool) string {
@@ -108,10 +173,7 @@ func connectionTypeFor(vpnType string, torEnabled bool) string {
 func (h *Handlers) GetSecurityStatus(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("Fetching security status for monitoring")
 
-	vpnType, _ := h.db.GetSetting("vpn_type")
-	if vpnType == "" {
-		vpnType = "none"
-	}
+	vpnType := h.settings.String("vpn_type")
 	privacy := h.torrentClient.PrivacyStatus()
 	torrents := h.torrentClient.GetAllTorrents()
 	var downloadSpeed int64
@@ -127,8 +189,14 @@ func (h *Handlers) GetSecurityStatus(w http.ResponseWriter, r *http.Request) {
 		connectionType = "Tor Proxy Unavailable"
 	}
 
+	killSwitch := h.killSwitch.Status()
+	encryptionMode := h.torrentClient.EncryptionMode()
+	leaks := checkForLeaks(h.db, h.torrentClient)
 	status := SecurityStatus{
-		KillSwitchActive:           false,
+		KillSwitchActive:           killSwitch.Enabled,
+		KillSwitchTriggered:        killSwitch.Triggered,
+		KillSwitchMode:             string(killSwitch.Mode),
+		NetworkSuspended:           h.torrentClient.IsNetworkSuspended(),
 		DNSProtectionActive:        privacy.DNSObfuscation,
 		DNSObfuscationActive:       privacy.DNSObfuscation,
 		IPObfuscationActive:        privacy.IPObfuscation,
@@ -136,8 +204,8 @@ func (h *Handlers) GetSecurityStatus(w http.ResponseWriter, r *http.Request) {
 		SharingDisabled:            privacy.SharingDisabled,
 		TrafficObfuscationActive:   privacy.TrafficObfuscation,
 		DataEncryptionActive:       false,
-		ForceEncryptionActive:      false,
-		RejectPlaintextActive:      false,
+		ForceEncryptionActive:      encryptionMode == torrent.EncryptionRequire,
+		RejectPlaintextActive:      encryptionMode == torrent.EncryptionRequire,
 		NoLogsMode:                 privacy.NoLogsMode,
 		MACRandomizationActive:     false,
 		AntiFingerprintActive:      false,
@@ -146,7 +214,7 @@ func (h *Handlers) GetSecurityStatus(w http.ResponseWriter, r *http.Request) {
 		BlockMaliciousPeersActive:  false,
 		SandboxModeActive:          false,
 		MemoryEncryptionActive:     false,
-		AutoWipeOnExitActive:       false,
+		AutoWipeOnExitActive:       h.settings.Bool("auto_wipe_on_exit"),
 		StealthModeActive:          false,
 		PeerExchangeDisabled:       privacy.PeerExchangeDisabled,
 		InboundConnectionsDisabled: privacy.InboundConnectionsDisabled,
@@ -157,8 +225,8 @@ func (h *Handlers) GetSecurityStatus(w http.ResponseWriter, r *http.Request) {
 		ConnectionType:             connectionType,
 		DownloadSpeed:              downloadSpeed,
 		UploadSpeed:                uploadSpeed,
-		SecurityScore:              calculateSecurityScore(h.db, h.torrentClient),
-		LeaksDetected:              nil,
+		SecurityScore:              SecurityScore(h.torrentClient),
+		LeaksDetected:              &leaks,
 		LastCheck:                  time.Now().UTC().Format(time.RFC3339),
 	}
 
@@ -169,62 +237,46 @@ func (h *Handlers) GetSecurityStatus(w http.ResponseWriter, r *http.Request) {
 func (h *Handlers) GetSecurityConfig(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("Fetching security configuration")
 
-	vpnType, _ := h.db.GetSetting("vpn_type")
-	if vpnType == "" {
-		vpnType = "none"
-	}
+	vpnType := h.settings.String("vpn_type")
 	if h.torrentClient.IsTorEnabled() && vpnType == "none" {
 		vpnType = "tor"
 	}
-	killSwitch, _ := h.db.GetSetting("kill_switch_enabled")
-	dnsProtection, _ := h.db.GetSetting("dns_protection_enabled")
-	dataEncryption, _ := h.db.GetSetting("data_encryption_enabled")
-	noLogsMode, _ := h.db.GetSetting("no_logs_mode")
-	obfuscateTraffic, _ := h.db.GetSetting("obfuscate_traffic")
-	dnsObfuscation, _ := h.db.GetSetting("dns_obfuscation_enabled")
-	ipObfuscation, _ := h.db.GetSetting("ip_obfuscation_enabled")
-	dhtInvisibility, _ := h.db.GetSetting("dht_invisibility")
-	sharingDisabled, _ := h.db.GetSetting("sharing_disabled")
-
-	macRandomization, _ := h.db.GetSetting("mac_randomization")
-	antiFingerprint, _ := h.db.GetSetting("anti_fingerprint")
-	secureDelete, _ := h.db.GetSetting("secure_delete")
-	peerVerification, _ := h.db.GetSetting("peer_verification")
-	blockMaliciousPeers, _ := h.db.GetSetting("block_malicious_peers")
-	sandboxMode, _ := h.db.GetSetting("sandbox_mode")
-	memoryEncryption, _ := h.db.GetSetting("memory_encryption")
-	autoWipeOnExit, _ := h.db.GetSetting("auto_wipe_on_exit")
-	stealthMode, _ := h.db.GetSetting("stealth_mode")
 	privacy := h.torrentClient.PrivacyStatus()
+	encryptionMode := h.torrentClient.EncryptionMode()
+	level, minProtocol := encryptionLevelFor(encryptionMode)
 
 	config := SecurityConfig{
-		KillSwitchEnabled:     boolSettingOrDefault(killSwitch, true),
-		DNSProtectionEnabled:  boolSettingOrDefault(dnsProtection, true),
-		DNSObfuscationEnabled: boolSettingOrDefault(dnsObfuscation, privacy.DNSObfuscation),
-		IPObfuscationEnabled:  boolSettingOrDefault(ipObfuscation, privacy.IPObfuscation),
-		DHTInvisibility:       dhtInvisibility == "true" || dhtInvisibility == "",
-		SharingDisabled:       sharingDisabled == "true" || sharingDisabled == "",
-		DataEncryptionEnabled: boolSettingOrDefault(dataEncryption, true),
+		KillSwitchEnabled:    h.killSwitch.IsEnabled(),
+		KillSwitchMode:       string(h.killSwitch.Mode()),
+		DNSProtectionEnabled: h.settings.Bool("dns_protection_enabled"),
+		// Obfuscation is reported as applied, which depends on the proxy
+		// chain as well as on the stored settings.
+		DNSObfuscationEnabled: privacy.DNSObfuscation,
+		IPObfuscationEnabled:  privacy.IPObfuscation,
+		DHTInvisibility:       h.settings.Bool("dht_invisibility"),
+		SharingDisabled:       h.settings.Bool("sharing_disabled"),
+		DataEncryptionEnabled: h.settings.Bool("data_encryption_enabled"),
 		TorEnabled:            h.torrentClient.IsTorEnabled(),
 		VPNType:               vpnType,
 		// Secrets are intentionally write-only and never returned by the API.
 		VLESSKey:              "",
 		OutlineKey:            "",
-		NoLogsMode:            noLogsMode == "true",
-		ObfuscateTraffic:      obfuscateTraffic == "true",
-		ForceEncryption:       false,
-		EncryptionLevel:       "not-enforced",
-		MinEncryptionProtocol: "not-enforced",
-		RejectPlaintext:       false,
-		MACRandomization:      macRandomization == "true",
-		AntiFingerprint:       antiFingerprint == "true",
-		SecureDelete:          secureDelete == "true" || secureDelete == "",
-		PeerVerification:      boolSettingOrDefault(peerVerification, true),
-		BlockMaliciousPeers:   boolSettingOrDefault(blockMaliciousPeers, true),
-		SandboxMode:           sandboxMode == "true",
-		MemoryEncryption:      boolSettingOrDefault(memoryEncryption, true),
-		AutoWipeOnExit:        autoWipeOnExit == "true",
-		StealthMode:           stealthMode == "true",
+		NoLogsMode:            h.settings.Bool("no_logs_mode"),
+		ObfuscateTraffic:      h.settings.Bool("obfuscate_traffic"),
+		ForceEncryption:       encryptionMode == torrent.EncryptionRequire,
+		EncryptionMode:        string(encryptionMode),
+		EncryptionLevel:       level,
+		MinEncryptionProtocol: minProtocol,
+		RejectPlaintext:       encryptionMode == torrent.EncryptionRequire,
+		MACRandomization:      h.settings.Bool("mac_randomization"),
+		AntiFingerprint:       h.settings.Bool("anti_fingerprint"),
+		SecureDelete:          h.settings.Bool("secure_delete"),
+		PeerVerification:      h.settings.Bool("peer_verification"),
+		BlockMaliciousPeers:   h.settings.Bool("block_malicious_peers"),
+		SandboxMode:           h.settings.Bool("sandbox_mode"),
+		MemoryEncryption:      h.settings.Bool("memory_encryption"),
+		AutoWipeOnExit:        h.settings.Bool("auto_wipe_on_exit"),
+		StealthMode:           h.settings.Bool("stealth_mode"),
 	}
 
 	h.writeJSON(w, http.StatusOK, config)
@@ -245,22 +297,36 @@ func (h *Handlers) UpdateSecuritySettings(w http.ResponseWriter, r *http.Request
 		h.writeError(w, http.StatusBadRequest, "The backend only supports its configured Tor proxy. Use the standalone VPN client for VLESS or Outline.")
 		return
 	}
+	killSwitchMode, err := security.ParseKillSwitchMode(config.KillSwitchMode)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Kill switch mode must be soft or hard")
+		return
+	}
+	config.KillSwitchMode = string(killSwitchMode)
 	config.TorEnabled = config.VPNType == "tor"
 	if config.NoLogsMode {
 		config.DHTInvisibility = true
 		config.SharingDisabled = true
 		config.SecureDelete = true
 	}
-	// The torrent library does not expose transport-encryption enforcement.
-	// Keep these compatibility fields explicitly disabled instead of persisting
-	// a setting that would give users a false sense of protection.
-	config.ForceEncryption = false
-	config.EncryptionLevel = "not-enforced"
-	config.MinEncryptionProtocol = "not-enforced"
-	config.RejectPlaintext = false
+	// The legacy boolean fields are kept for older clients and always reflect
+	// the encryption mode that is actually applied to the torrent client.
+	if config.EncryptionMode == "" && (config.ForceEncryption || config.RejectPlaintext) {
+		config.EncryptionMode = string(torrent.EncryptionRequire)
+	}
+	encryptionMode, err := torrent.ParseEncryptionMode(config.EncryptionMode)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Encryption mode must be prefer, require or disabled")
+		return
+	}
+	config.EncryptionMode = string(encryptionMode)
+	config.ForceEncryption = encryptionMode == torrent.EncryptionRequire
+	config.RejectPlaintext = encryptionMode == torrent.EncryptionRequire
+	config.EncryptionLevel, config.MinEncryptionProtocol = encryptionLevelFor(encryptionMode)
 
 	h.logger.Info("Updating security settings",
 		zap.Bool("killSwitch", config.KillSwitchEnabled),
+		zap.String("killSwitchMode", config.KillSwitchMode),
 		zap.Bool("dnsProtection", config.DNSProtectionEnabled),
 		zap.Bool("dnsObfuscation", config.DNSObfuscationEnabled),
 		zap.Bool("ipObfuscation", config.IPObfuscationEnabled),
@@ -271,6 +337,7 @@ func (h *Handlers) UpdateSecuritySettings(w http.ResponseWriter, r *http.Request
 		zap.Bool("noLogsMode", config.NoLogsMode),
 		zap.Bool("obfuscateTraffic", config.ObfuscateTraffic),
 		zap.Bool("forceEncryption", config.ForceEncryption),
+		zap.String("encryptionMode", config.EncryptionMode),
 		zap.String("encryptionLevel", config.EncryptionLevel),
 		zap.String("minProtocol", config.MinEncryptionProtocol),
 		zap.Bool("rejectPlaintext", config.RejectPlaintext),
@@ -292,41 +359,25 @@ func (h *Handlers) UpdateSecuritySettings(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Store all settings in database
-	h.db.SetSetting("kill_switch_enabled", fmt.Sprintf("%t", config.KillSwitchEnabled))
-	h.db.SetSetting("dns_protection_enabled", fmt.Sprintf("%t", config.DNSProtectionEnabled))
-	h.db.SetSetting("dns_obfuscation_enabled", fmt.Sprintf("%t", config.DNSObfuscationEnabled))
-	h.db.SetSetting("ip_obfuscation_enabled", fmt.Sprintf("%t", config.IPObfuscationEnabled))
-	h.db.SetSetting("dht_invisibility", fmt.Sprintf("%t", config.DHTInvisibility))
-	h.db.SetSetting("sharing_disabled", fmt.Sprintf("%t", config.SharingDisabled))
-	h.db.SetSetting("data_encryption_enabled", fmt.Sprintf("%t", config.DataEncryptionEnabled))
-	h.db.SetSetting("tor_enabled", fmt.Sprintf("%t", config.TorEnabled))
-
-	h.db.SetSetting("vpn_type", config.VPNType)
-
-	h.db.SetSetting("no_logs_mode", fmt.Sprintf("%t", config.NoLogsMode))
-	h.db.SetSetting("obfuscate_traffic", fmt.Sprintf("%t", config.ObfuscateTraffic))
-
-	h.db.SetSetting("force_encryption", fmt.Sprintf("%t", config.ForceEncryption))
-	h.db.SetSetting("encryption_level", config.EncryptionLevel)
-	h.db.SetSetting("min_encryption_protocol", config.MinEncryptionProtocol)
-	h.db.SetSetting("reject_plaintext", fmt.Sprintf("%t", config.RejectPlaintext))
-	h.db.SetSetting("mac_randomization", fmt.Sprintf("%t", config.MACRandomization))
-	h.db.SetSetting("anti_fingerprint", fmt.Sprintf("%t", config.AntiFingerprint))
-	h.db.SetSetting("secure_delete", fmt.Sprintf("%t", config.SecureDelete))
-	h.db.SetSetting("peer_verification", fmt.Sprintf("%t", config.PeerVerification))
-	h.db.SetSetting("block_malicious_peers", fmt.Sprintf("%t", config.BlockMaliciousPeers))
-	h.db.SetSetting("sandbox_mode", fmt.Sprintf("%t", config.SandboxMode))
-	h.db.SetSetting("memory_encryption", fmt.Sprintf("%t", config.MemoryEncryption))
-	h.db.SetSetting("auto_wipe_on_exit", fmt.Sprintf("%t", config.AutoWipeOnExit))
-	h.db.SetSetting("stealth_mode", fmt.Sprintf("%t", config.StealthMode))
+	// Store all settings through the registry
+	values := securitySettingValues(config, encryptionMode)
+	if _, err := h.settings.Set(rawSettings(values), allowsSecuritySettings(r)); err != nil {
+		h.writeSettingsError(w, err)
+		return
+	}
+
+	h.torrentClient.SetEncryptionMode(encryptionMode)
+	h.killSwitch.SetMode(killSwitchMode)
+	if config.KillSwitchEnabled {
+		h.killSwitch.Enable()
+	} else {
+		h.killSwitch.Disable()
+	}
 
 	if config.NoLogsMode {
 		h.logger.Info("No-logs mode enabled - disabling DHT and metadata persistence")
-		h.torrentClient.SetNoLogsMode(true)
-	} else {
-		h.torrentClient.SetNoLogsMode(false)
 	}
+	h.setNoLogsMode(config.NoLogsMode)
 
 	if config.ObfuscateTraffic {
 		h.logger.Info("Traffic obfuscation enabled")
@@ -339,8 +390,8 @@ func (h *Handlers) UpdateSecuritySettings(w http.ResponseWriter, r *http.Request
 	actualDNSObfuscation := h.torrentClient.SetDNSObfuscation(config.DNSObfuscationEnabled)
 	h.torrentClient.SetDHTInvisibility(config.DHTInvisibility)
 	h.torrentClient.SetSharingDisabled(config.SharingDisabled)
-	_ = h.db.SetSetting("ip_obfuscation_enabled", fmt.Sprintf("%t", actualIPObfuscation))
-	_ = h.db.SetSetting("dns_obfuscation_enabled", fmt.Sprintf("%t", actualDNSObfuscation))
+	_ = h.settings.SetString("ip_obfuscation_enabled", strconv.FormatBool(actualIPObfuscation))
+	_ = h.settings.SetString("dns_obfuscation_enabled", strconv.FormatBool(actualDNSObfuscation))
 
 	if config.DHTInvisibility {
 		h.logger.Info("DHT invisibility enabled - DHT announce/query participation and PEX remain disabled")
@@ -358,25 +409,20 @@ func (h *Handlers) UpdateSecuritySettings(w http.ResponseWriter, r *http.Request
 		h.logger.Info("Anti-fingerprinting enabled - protocol signatures will be obfuscated")
 	}
 
+	h.recordAudit(r, "security.update", "", map[string]string{
+		"killSwitch":       strconv.FormatBool(config.KillSwitchEnabled),
+		"killSwitchMode":   config.KillSwitchMode,
+		"vpnType":          config.VPNType,
+		"encryptionMode":   config.EncryptionMode,
+		"dhtInvisibility":  strconv.FormatBool(config.DHTInvisibility),
+		"sharingDisabled":  strconv.FormatBool(config.SharingDisabled),
+		"ipObfuscation":    strconv.FormatBool(actualIPObfuscation),
+		"dnsObfuscation":   strconv.FormatBool(actualDNSObfuscation),
+		"obfuscateTraffic": strconv.FormatBool(config.ObfuscateTraffic),
+		"autoWipeOnExit":   strconv.FormatBool(config.AutoWipeOnExit),
+	})
 	h.logger.Info("Security settings updated successfully")
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Security settings updated"})
-}
-
-// TriggerKillSwitch manually triggers the kill switch
-func (h *Handlers) TriggerKillSwitch(w http.ResponseWriter, r *http.Request) {
-	h.logger.Warn("Kill switch manually triggered")
-
-	// Stop all torrents
-	torrents := h.torrentClient.GetAllTorrents()
-	for _, t := range torrents {
-		h.torrentClient.RemoveTorrent(t.InfoHash)
-	}
-
-	// Clear database
-	h.db.ClearActiveTorrents()
-
-	h.logger.Info("Kill switch activated - all connections terminated")
-	h.writeJSON(w, http.StatusOK, map[string]string{"message": "Kill switch activated"})
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "Security settings updated"})
 }
 
 // GetIPStatus returns current IP information
@@ -384,26 +430,23 @@ func (h *Handlers) GetIPStatus(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("Fetching IP status")
 
 	torEnabled := h.torrentClient.IsTorEnabled()
-	vpnType, _ := h.db.GetSetting("vpn_type")
-	if vpnType == "" {
-		vpnType = "none"
-	}
+	vpnType := h.settings.String("vpn_type")
 
 	privacy := h.torrentClient.PrivacyStatus()
 	connectionType := connectionTypeFor(vpnType, torEnabled)
 	if (vpnType == "tor" || torEnabled) && !privacy.ProxyAvailable {
 		connectionType = "Tor Proxy Unavailable"
 	}
-	status := map[string]interface{}{
-		"torEnabled":         torEnabled,
-		"vpnType":            vpnType,
-		"ipObfuscated":       privacy.IPObfuscation || vpnType != "none",
-		"dnsProtected":       true,
-		"dnsObfuscated":      privacy.DNSObfuscation,
-		"dhtInvisible":       privacy.DHTInvisibility,
-		"sharingDisabled":    privacy.SharingDisabled,
-		"udpTrackersBlocked": privacy.UDPTrackersBlocked,
-		"connectionType":     connectionType,
+	status := IPStatus{
+		TorEnabled:         torEnabled,
+		VPNType:            vpnType,
+		IPObfuscated:       privacy.IPObfuscation || vpnType != "none",
+		DNSProtected:       true,
+		DNSObfuscated:      privacy.DNSObfuscation,
+		DHTInvisible:       privacy.DHTInvisibility,
+		SharingDisabled:    privacy.SharingDisabled,
+		UDPTrackersBlocked: privacy.UDPTrackersBlocked,
+		ConnectionType:     connectionType,
 	}
 
 	h.writeJSON(w, http.StatusOK, status)
@@ -412,234 +455,262 @@ func (h *Handlers) GetIPStatus(w http.ResponseWriter, r *http.Request) {
 // TestDNSLeak tests for DNS leaks
 func (h *Handlers) TestDNSLeak(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("DNS leak test requested")
-	h.writeJSON(w, http.StatusOK, map[string]interface{}{
-		"checked":         false,
-		"dnsLeakDetected": nil,
-		"message":         "A DNS leak test requires an external resolver probe and is not performed by the local API. No safety conclusion was made.",
+	h.writeJSON(w, http.StatusOK, DNSLeakTestResponse{
+		Checked: false,
+		Message: "A DNS leak test requires an external resolver probe and is not performed by the local API. No safety conclusion was made.",
 	})
 }
 
-// SecureDeleteFile securely deletes files with multiple random data overwrites
-func (h *Handlers) SecureDeleteFile(w http.ResponseWriter, r *http.Request) {
-	var request struct {
-		FilePaths []string `json:"filePaths"`
-		Passes    int      `json:"passes"`
-		DryRun    bool     `json:"dryRun"`
-		Confirm   string   `json:"confirm"`
-	}
+// IPStatus summarises how the client's IP address and DNS are protected.
+type IPStatus struct {
+	TorEnabled         bool   `json:"torEnabled"`
+	VPNType            string `json:"vpnType"`
+	IPObfuscated       bool   `json:"ipObfuscated"`
+	DNSProtected       bool   `json:"dnsProtected"`
+	DNSObfuscated      bool   `json:"dnsObfuscated"`
+	DHTInvisible       bool   `json:"dhtInvisible"`
+	SharingDisabled    bool   `json:"sharingDisabled"`
+	UDPTrackersBlocked bool   `json:"udpTrackersBlocked"`
+	ConnectionType     string `json:"connectionType"`
+}
 
-	type secureDeleteResult struct {
-		Path    string `json:"path"`
-		Name    string `json:"name"`
-		Size    int64  `json:"size"`
-		Deleted bool   `json:"deleted"`
-		Error   string `json:"error,omitempty"`
-	}
+// DNSLeakTestResponse is the outcome of a DNS leak test. DNSLeakDetected is
+// null when no test was run.
+type DNSLeakTestResponse struct {
+	Checked         bool   `json:"checked"`
+	DNSLeakDetected *bool  `json:"dnsLeakDetected"`
+	Message         string `json:"message"`
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		h.logger.Warn("Invalid secure delete request", zap.Error(err))
-		h.writeError(w, http.StatusBadRequest, "Invalid request body")
-		return
+// SecureDeleteResponse reports a secure deletion or, for dry runs, which
+// paths would be wiped.
+type SecureDeleteResponse struct {
+	DeletedFiles []string              `json:"deletedFiles"`
+	Errors       []string              `json:"errors"`
+	Passes       int                   `json:"passes"`
+	DryRun       bool                  `json:"dryRun"`
+	Results      []security.WipeResult `json:"results"`
+	Message      string                `json:"message"`
+}
+
+// SecureDeleteRequest lists the paths to wipe.
+type SecureDeleteRequest struct {
+	FilePaths []string `json:"filePaths"`
+	// Passes overrides the configured secure_delete_passes setting.
+	Passes int `json:"passes"`
+	// Recursive allows directories, whose whole tree is wiped.
+	Recursive bool   `json:"recursive"`
+	DryRun    bool   `json:"dryRun"`
+	Confirm   string `json:"confirm"`
+}
+
+func parseSecureDeleteRequest(body json.RawMessage) (SecureDeleteRequest, error) {
+	var request SecureDeleteRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return request, badJobRequest("Invalid request body")
 	}
 
 	if len(request.FilePaths) == 0 {
-		h.writeError(w, http.StatusBadRequest, "No files specified")
-		return
+		return request, badJobRequest("No files specified")
 	}
 
 	if len(request.FilePaths) > maxSecureDeleteFiles {
-		h.writeError(w, http.StatusBadRequest, fmt.Sprintf("A maximum of %d files can be processed at once", maxSecureDeleteFiles))
-		return
+		return request, badJobRequest("A maximum of %d paths can be processed at once", maxSecureDeleteFiles)
 	}
 
-	if request.Passes < 3 || request.Passes > 35 {
-		request.Passes = 3 // Default to triple overwrite
+	if !request.DryRun && request.Confirm != secureDeleteConfirmationKey {
+		return request, badJobRequest("Secure deletion requires confirm=SECURE_DELETE")
 	}
+	return request, nil
+}
 
-	if !request.DryRun && request.Confirm != secureDeleteConfirmationKey {
-		h.writeError(w, http.StatusBadRequest, "Secure deletion requires confirm=SECURE_DELETE")
+// wipePasses returns requested when it is within 3 to 35 passes, and
+// otherwise the configured secure_delete_passes setting.
+func (h *Handlers) wipePasses(requested int) int {
+	if requested >= minWipePasses && requested <= maxWipePasses {
+		return requested
+	}
+	return int(h.settings.Int("secure_delete_passes"))
+}
+
+// SecureDeleteFile validates files synchronously for dry runs and otherwise
+// queues a secure-delete job, returning it with 202 Accepted.
+func (h *Handlers) SecureDeleteFile(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	request, err := parseSecureDeleteRequest(body)
+	if err != nil {
+		h.logger.Warn("Invalid secure delete request", zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if !request.DryRun {
+		h.jobs.submit(w, r, jobKindSecureDelete, body)
+		return
+	}
+
+	response, _ := h.runSecureDelete(r.Context(), request, &jobs.Progress{})
+	h.writeJSON(w, http.StatusOK, response)
+}
 
+func (h *Handlers) secureDeleteJob(body json.RawMessage) (jobs.Func, error) {
+	request, err := parseSecureDeleteRequest(body)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, progress *jobs.Progress) (interface{}, error) {
+		return h.runSecureDelete(ctx, request, progress)
+	}, nil
+}
+
+// wipeTarget is a validated path queued for secure deletion.
+type wipeTarget struct {
+	path  string
+	dir   bool
+	size  int64
+	index int
+}
+
+// runSecureDelete overwrites and removes every requested file and, when
+// Recursive is set, every file below the requested directories, or only
+// validates them for a dry run. Progress counts overwritten bytes across all
+// passes.
+func (h *Handlers) runSecureDelete(ctx context.Context, request SecureDeleteRequest, progress *jobs.Progress) (SecureDeleteResponse, error) {
+	passes := h.wipePasses(request.Passes)
 	h.logger.Info("Preparing secure file deletion",
-		zap.Int("fileCount", len(request.FilePaths)),
-		zap.Int("passes", request.Passes),
+		zap.Int("pathCount", len(request.FilePaths)),
+		zap.Int("passes", passes),
+		zap.Bool("recursive", request.Recursive),
 		zap.Bool("dryRun", request.DryRun),
 	)
 
 	deletedFiles := []string{}
 	errors := []string{}
-	results := make([]secureDeleteResult, 0, len(request.FilePaths))
+	results := make([]security.WipeResult, 0, len(request.FilePaths))
+	targets := make([]wipeTarget, 0, len(request.FilePaths))
+
+	fail := func(result security.WipeResult, message string) {
+		result.Error = message
+		errors = append(errors, fmt.Sprintf("%s: %s", result.Name, message))
+		results = append(results, result)
+	}
 
 	for _, filePath := range request.FilePaths {
-		result := secureDeleteResult{
+		result := security.WipeResult{
 			Path: filePath,
 			Name: filepath.Base(filePath),
 		}
 
 		safePath, err := normalizeUserFilePath(filePath)
 		if err != nil {
-			result.Error = err.Error()
-			errors = append(errors, fmt.Sprintf("%s: %v", result.Name, err))
-			results = append(results, result)
+			fail(result, err.Error())
 			continue
 		}
-
 		result.Path = safePath
 
 		info, err := os.Stat(safePath)
 		if err != nil {
-			result.Error = fmt.Sprintf("failed to stat file: %v", err)
-			errors = append(errors, fmt.Sprintf("%s: %s", result.Name, result.Error))
-			results = append(results, result)
+			fail(result, fmt.Sprintf("failed to stat file: %v", err))
 			continue
 		}
 		result.Name = info.Name()
-		result.Size = info.Size()
 
-		if !info.Mode().IsRegular() {
-			result.Error = "secure deletion only supports regular files"
-			errors = append(errors, fmt.Sprintf("%s: %s", result.Name, result.Error))
-			results = append(results, result)
-			continue
-		}
-
-		if request.DryRun {
-			results = append(results, result)
+		target := wipeTarget{path: safePath, index: len(results)}
+		switch {
+		case info.IsDir():
+			if !request.Recursive {
+				fail(result, "path is a directory; set recursive to wipe it")
+				continue
+			}
+			if isAllowedFileRoot(safePath) {
+				fail(result, "refusing to wipe an app root directory")
+				continue
+			}
+			target.dir = true
+			target.size = security.WipeTreeSize(safePath)
+		case info.Mode().IsRegular():
+			target.size = info.Size()
+		default:
+			fail(result, "secure deletion only supports regular files and directories")
 			continue
 		}
-
-		if err := secureDeleteFile(safePath, request.Passes, h.logger); err != nil {
-			h.logger.Error("Failed to securely delete file",
-				zap.Error(err),
-			)
-			result.Error = err.Error()
-			errors = append(errors, fmt.Sprintf("%s: %v", result.Name, err))
-		} else {
-			h.logger.Info("File securely deleted",
-				zap.Int("passes", request.Passes),
-			)
-			result.Deleted = true
-			deletedFiles = append(deletedFiles, safePath)
-		}
+		result.Size = target.size
 		results = append(results, result)
+		targets = append(targets, target)
 	}
 
-	message := fmt.Sprintf("Securely deleted %d file(s) with %d overwrites", len(deletedFiles), request.Passes)
-	if request.DryRun {
-		message = fmt.Sprintf("Validated %d file(s) for secure deletion", len(results)-len(errors))
-	}
-
-	response := map[string]interface{}{
-		"deletedFiles": deletedFiles,
-		"errors":       errors,
-		"passes":       request.Passes,
-		"dryRun":       request.DryRun,
-		"results":      results,
-		"message":      message,
-	}
-
-	h.writeJSON(w, http.StatusOK, response)
-}
-
-// secureDeleteFile performs secure file deletion with multiple random overwrites
-func secureDeleteFile(filePath string, passes int, logger *zap.Logger) error {
-	// Open file for reading to get size
-	// #nosec G304 -- filePath is the normalized result of normalizeUserFilePath.
-	file, err := os.OpenFile(filePath, os.O_RDWR, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
-	}
-
-	fileInfo, err := file.Stat()
-	if err != nil {
-		file.Close()
-		return fmt.Errorf("failed to stat file: %w", err)
-	}
-
-	fileSize := fileInfo.Size()
-	logger.Debug("File opened for secure deletion",
-		zap.Int64("size", fileSize),
-	)
-
-	// Perform multiple overwrite passes
-	for pass := 1; pass <= passes; pass++ {
-		// Seek to beginning of file
-		if _, err := file.Seek(0, 0); err != nil {
-			file.Close()
-			return fmt.Errorf("failed to seek to start (pass %d): %w", pass, err)
-		}
-
-		// Generate random data buffer
-		bufferSize := int64(4096) // 4KB buffer
-		if fileSize < bufferSize {
-			bufferSize = fileSize
+	if !request.DryRun {
+		var total int64
+		for _, target := range targets {
+			total += target.size
 		}
-
-		buffer := make([]byte, bufferSize)
-		written := int64(0)
-
-		for written < fileSize {
-			// Fill buffer with cryptographically secure random data
-			if _, err := rand.Read(buffer); err != nil {
-				file.Close()
-				return fmt.Errorf("failed to generate random data (pass %d): %w", pass, err)
-			}
-
-			// Determine how much to write
-			toWrite := bufferSize
-			if fileSize-written < bufferSize {
-				toWrite = fileSize - written
+		progress.SetTotal(total * int64(passes))
+
+		wiped := make([][]security.WipeResult, len(results))
+		for _, target := range targets {
+			result := results[target.index]
+			if err := ctx.Err(); err != nil {
+				result.Error = "cancelled before deletion"
+				wiped[target.index] = []security.WipeResult{result}
+				continue
 			}
-
-			// Write random data
-			n, err := file.Write(buffer[:toWrite])
-			if err != nil {
-				file.Close()
-				return fmt.Errorf("failed to write random data (pass %d): %w", pass, err)
+			if target.dir {
+				tree, err := security.WipeTree(ctx, target.path, passes, progress.Add)
+				if err != nil && len(tree) == 0 {
+					result.Error = err.Error()
+					tree = []security.WipeResult{result}
+				}
+				wiped[target.index] = tree
+				continue
 			}
-			if n == 0 {
-				file.Close()
-				return fmt.Errorf("failed to write random data (pass %d): no bytes written", pass)
+			if err := security.WipeFile(ctx, target.path, passes, progress.Add); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Deleted = true
 			}
-
-			written += int64(n)
+			wiped[target.index] = []security.WipeResult{result}
 		}
 
-		// Sync to disk to ensure data is written
-		if err := file.Sync(); err != nil {
-			file.Close()
-			return fmt.Errorf("failed to sync to disk (pass %d): %w", pass, err)
+		// Replace each target with its per-file outcome, keeping validation
+		// failures in request order.
+		expanded := make([]security.WipeResult, 0, len(results))
+		for i, result := range results {
+			if wiped[i] == nil {
+				expanded = append(expanded, result)
+				continue
+			}
+			for _, fileResult := range wiped[i] {
+				if fileResult.Deleted {
+					deletedFiles = append(deletedFiles, fileResult.Path)
+				} else if fileResult.Error != "" {
+					errors = append(errors, fmt.Sprintf("%s: %s", fileResult.Name, fileResult.Error))
+				}
+				expanded = append(expanded, fileResult)
+			}
 		}
-
-		logger.Debug("Overwrite pass completed",
-			zap.Int("pass", pass),
-			zap.Int("totalPasses", passes),
+		results = expanded
+		h.logger.Info("Secure deletion finished",
+			zap.Int("deleted", len(deletedFiles)),
+			zap.Int("errors", len(errors)),
+			zap.Int("passes", passes),
 		)
 	}
 
-	// Close the file
-	if err := file.Close(); err != nil {
-		return fmt.Errorf("failed to close file: %w", err)
-	}
-
-	// Finally, remove the file
-	if err := os.Remove(filePath); err != nil {
-		return fmt.Errorf("failed to remove file: %w", err)
-	}
-
-	if err := syncParentDir(filePath); err != nil {
-		logger.Debug("Failed to sync parent directory after secure deletion", zap.Error(err))
+	message := fmt.Sprintf("Securely deleted %d file(s) with %d overwrites", len(deletedFiles), passes)
+	if request.DryRun {
+		message = fmt.Sprintf("Validated %d path(s) for secure deletion", len(targets))
 	}
 
-	return nil
-}
-
-func syncParentDir(filePath string) error {
-	dir, err := os.Open(filepath.Dir(filePath))
-	if err != nil {
-		return err
+	response := SecureDeleteResponse{
+		DeletedFiles: deletedFiles,
+		Errors:       errors,
+		Passes:       passes,
+		DryRun:       request.DryRun,
+		Results:      results,
+		Message:      message,
 	}
-	defer dir.Close()
-	return dir.Sync()
+	return response, ctx.Err()
 }
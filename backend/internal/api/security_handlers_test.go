@@ -0,0 +1,22 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+)
+
+func TestSecuritySettingsNeedTheSecurityScope(t *testing.T) {
+	written := securitySettingValues(SecurityConfig{}, torrent.EncryptionPrefer)
+	for key := range written {
+		if d, ok := settings.Lookup(key); !ok || !d.Security {
+			t.Errorf("%s is written by PUT /api/security/settings but is not a security setting", key)
+		}
+	}
+	for _, d := range settings.Definitions() {
+		if _, ok := written[d.Key]; d.Security && !ok {
+			t.Errorf("%s is a security setting that PUT /api/security/settings does not write", d.Key)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
-	"go.uber.org/zap"
 	"net/http"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"go.uber.org/zap"
 )
 
 // SecurityMetrics represents detailed security analytics
@@ -40,6 +42,12 @@ type ObfuscationMetrics struct {
 	Score   int  `json:"score"`
 }
 
+// GetEncryptionStatus reports the live protocol encryption mode and how many
+// peers negotiated each crypto method.
+func (h *Handlers) GetEncryptionStatus(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.torrentClient.EncryptionStatus())
+}
+
 // GetSecurityMetrics returns comprehensive security analytics
 func (h *Handlers) GetSecurityMetrics(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("Fetching security metrics")
@@ -47,7 +55,15 @@ func (h *Handlers) GetSecurityMetrics(w http.ResponseWriter, r *http.Request) {
 	privacy := h.torrentClient.PrivacyStatus()
 
 	// Scores only reflect controls confirmed by the live torrent client.
+	encryptionMode := h.torrentClient.EncryptionMode()
+	encryptionLevel, _ := encryptionLevelFor(encryptionMode)
 	encryptionScore := 0
+	switch encryptionMode {
+	case torrent.EncryptionRequire:
+		encryptionScore = 100
+	case torrent.EncryptionPrefer:
+		encryptionScore = 50
+	}
 	anonymityScore := 0
 	anonymityType := "Direct Connection"
 	if privacy.ProxyAvailable && privacy.IPObfuscation {
@@ -71,13 +87,15 @@ func (h *Handlers) GetSecurityMetrics(w http.ResponseWriter, r *http.Request) {
 		obfuscationScore = 100
 	}
 
+	leaks := checkForLeaks(h.db, h.torrentClient)
+
 	overallScore := (encryptionScore + anonymityScore + leakScore + obfuscationScore) / 4
 
 	metrics := SecurityMetrics{
 		OverallScore: overallScore,
 		Encryption: EncryptionMetrics{
-			Enabled: false,
-			Level:   "not enforced by torrent client",
+			Enabled: encryptionMode != torrent.EncryptionDisabled,
+			Level:   encryptionLevel,
 			Score:   encryptionScore,
 		},
 		Anonymity: AnonymityMetrics{
@@ -87,7 +105,7 @@ func (h *Handlers) GetSecurityMetrics(w http.ResponseWriter, r *http.Request) {
 		},
 		LeakProtection: LeakMetrics{
 			Active:        privacy.DNSObfuscation,
-			LeaksDetected: nil,
+			LeaksDetected: &leaks,
 			Score:         leakScore,
 		},
 		TrafficObfuscation: ObfuscationMetrics{
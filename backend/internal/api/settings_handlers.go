@@ -0,0 +1,254 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+	"github.com/KFN002/B-2-Torrent/backend/internal/feeds"
+	"github.com/KFN002/B-2-Torrent/backend/internal/search"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"go.uber.org/zap"
+)
+
+// UpdateSettingValuesResponse lists the settings that were stored and those
+// of them that apply after a restart.
+type UpdateSettingValuesResponse struct {
+	Updated         []string `json:"updated"`
+	RestartRequired []string `json:"restartRequired,omitempty"`
+}
+
+// ExportSettingsRequest selects what happens to sensitive settings:
+// exclude (the default) or encrypt with Passphrase.
+type ExportSettingsRequest struct {
+	Secrets    string `json:"secrets,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// ImportSettingsRequest is an export document with the passphrase its
+// secrets were encrypted with, if any.
+type ImportSettingsRequest struct {
+	settings.Export
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// GetSettingsSchema describes every setting as a JSON Schema.
+func (h *Handlers) GetSettingsSchema(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, settings.Schema())
+}
+
+// GetSettingValues returns the typed value of every setting, defaults
+// included. Feeds and indexers are left to their own endpoints.
+func (h *Handlers) GetSettingValues(w http.ResponseWriter, r *http.Request) {
+	values, err := h.settings.Values()
+	if err != nil {
+		h.writeSettingsError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, values)
+}
+
+// UpdateSettingValues validates and stores the given settings, all or none,
+// and applies those the running client can take without a restart.
+func (h *Handlers) UpdateSettingValues(w http.ResponseWriter, r *http.Request) {
+	var req map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req) == 0 {
+		h.writeError(w, http.StatusBadRequest, "Request body must be an object of settings")
+		return
+	}
+	keys, ok := h.updateSettings(w, r, req)
+	if !ok {
+		return
+	}
+	h.writeJSON(w, http.StatusOK, UpdateSettingValuesResponse{
+		Updated:         keys,
+		RestartRequired: settings.RestartRequired(keys),
+	})
+}
+
+// ExportSettings returns every setting as an export document.
+func (h *Handlers) ExportSettings(w http.ResponseWriter, r *http.Request) {
+	var req ExportSettingsRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	secrets, err := settings.ParseSecrets(req.Secrets)
+	if err != nil {
+		h.writeSettingsError(w, err)
+		return
+	}
+	if secrets != settings.SecretsEncrypt && req.Passphrase != "" {
+		h.writeError(w, http.StatusBadRequest, "A passphrase is only used with secrets=encrypt")
+		return
+	}
+	doc, err := h.settings.Export(secrets, req.Passphrase)
+	if err != nil {
+		h.writeSettingsError(w, err)
+		return
+	}
+	h.recordAudit(r, "settings.export", "", map[string]string{"secrets": string(secrets)})
+	h.writeJSON(w, http.StatusOK, doc)
+}
+
+// ImportSettings stores the settings of an export document, all or none,
+// and applies them like UpdateSettingValues. Feeds and indexers are read
+// again.
+func (h *Handlers) ImportSettings(w http.ResponseWriter, r *http.Request) {
+	var req ImportSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	result, err := h.settings.Import(req.Export, req.Passphrase, allowsSecuritySettings(r))
+	if len(result.Imported) > 0 {
+		// A failed write may have stored part of the document.
+		h.applySettings(result.Imported)
+	}
+	if err != nil {
+		h.writeSettingsError(w, err)
+		return
+	}
+	h.recordAudit(r, "settings.import", "", map[string]string{
+		"imported": strconv.Itoa(len(result.Imported)),
+		"skipped":  strconv.Itoa(len(result.Skipped)),
+	})
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+// allowsSecuritySettings reports whether the caller may change security
+// settings, which takes what the security:admin routes take.
+func allowsSecuritySettings(r *http.Request) bool {
+	id, ok := auth.IdentityFromContext(r.Context())
+	return ok && id.Allows(auth.RoleAdmin, auth.ScopeSecurityAdmin)
+}
+
+// updateSettings stores values through the registry and applies them. It
+// writes the error response and returns false when they are refused.
+func (h *Handlers) updateSettings(w http.ResponseWriter, r *http.Request, values map[string]json.RawMessage) ([]string, bool) {
+	keys, err := h.settings.Set(values, allowsSecuritySettings(r))
+	if len(keys) > 0 {
+		h.applySettings(keys)
+	}
+	if err != nil {
+		h.writeSettingsError(w, err)
+		return nil, false
+	}
+	h.logger.Info("Settings updated", zap.Strings("keys", keys))
+	h.recordAudit(r, "settings.update", "", map[string]string{"keys": strings.Join(keys, ",")})
+	return keys, true
+}
+
+// rawSettings converts values in their stored form for Store.Set.
+func rawSettings(values map[string]string) map[string]json.RawMessage {
+	raw := make(map[string]json.RawMessage, len(values))
+	for key, value := range values {
+		raw[key], _ = json.Marshal(value)
+	}
+	return raw
+}
+
+// setNoLogsMode switches no-logs mode and, when it is turned on, drops the
+// history already kept on disk.
+func (h *Handlers) setNoLogsMode(enabled bool) {
+	h.torrentClient.SetNoLogsMode(enabled)
+	if !enabled {
+		return
+	}
+	if err := purgePersistedSecurityEvents(); err != nil {
+		h.logger.Warn("Failed to purge stored security events", zap.Error(err))
+	}
+	if h.feeds != nil {
+		if err := h.feeds.KeepHistoryInMemory(); err != nil {
+			h.logger.Warn("Failed to purge stored feed history", zap.Error(err))
+		}
+	}
+}
+
+// applySettings hands changed settings to the components that use them
+// while running. Settings marked Restart are only read at startup.
+func (h *Handlers) applySettings(keys []string) {
+	changed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		changed[key] = true
+	}
+	s := h.settings
+
+	if changed["no_logs_mode"] {
+		h.setNoLogsMode(s.Bool("no_logs_mode"))
+	}
+	if changed["obfuscate_traffic"] {
+		h.torrentClient.SetTrafficObfuscation(s.Bool("obfuscate_traffic"))
+	}
+	if changed["dht_invisibility"] {
+		h.torrentClient.SetDHTInvisibility(s.Bool("dht_invisibility"))
+	}
+	if changed["sharing_disabled"] {
+		h.torrentClient.SetSharingDisabled(s.Bool("sharing_disabled"))
+	}
+	// Obfuscation needs the proxy chain; what was actually applied is kept.
+	if changed["ip_obfuscation_enabled"] {
+		actual := h.torrentClient.SetIPObfuscation(s.Bool("ip_obfuscation_enabled"))
+		_ = s.SetString("ip_obfuscation_enabled", strconv.FormatBool(actual))
+	}
+	if changed["dns_obfuscation_enabled"] {
+		actual := h.torrentClient.SetDNSObfuscation(s.Bool("dns_obfuscation_enabled"))
+		_ = s.SetString("dns_obfuscation_enabled", strconv.FormatBool(actual))
+	}
+	if changed["encryption_mode"] {
+		mode, _ := torrent.ParseEncryptionMode(s.String("encryption_mode"))
+		h.torrentClient.SetEncryptionMode(mode)
+		for key, value := range encryptionSettings(mode) {
+			_ = s.SetString(key, value)
+		}
+	}
+	if changed["kill_switch_mode"] {
+		mode, _ := security.ParseKillSwitchMode(s.String("kill_switch_mode"))
+		h.killSwitch.SetMode(mode)
+	}
+	if changed["kill_switch_enabled"] {
+		if s.Bool("kill_switch_enabled") {
+			h.killSwitch.Enable()
+		} else {
+			h.killSwitch.Disable()
+		}
+	}
+	if changed["global_download_limit"] || changed["global_upload_limit"] {
+		if err := h.torrentClient.SetGlobalLimits(int(s.Int("global_download_limit")), int(s.Int("global_upload_limit"))); err != nil {
+			h.logger.Warn("Failed to apply global limits", zap.Error(err))
+		}
+	}
+	if changed[eventRetentionDaysKey] || changed[eventMaxCountKey] {
+		pruneSecurityEvents(h.db, h.logger)
+	}
+	if changed[feeds.SettingKey] && h.feeds != nil {
+		h.feeds.Reload()
+	}
+	if changed[search.SettingKey] && h.search != nil {
+		h.search.Reload()
+	}
+}
+
+func (h *Handlers) writeSettingsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, settings.ErrSecurity):
+		h.writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, settings.ErrUnknown), errors.Is(err, settings.ErrInvalid), errors.Is(err, settings.ErrManaged),
+		errors.Is(err, security.ErrWeakExportPassphrase):
+		h.writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, security.ErrPassphraseRecord):
+		h.writeError(w, http.StatusBadRequest, "Incorrect passphrase or damaged export")
+	case errors.Is(err, security.ErrKeyringLocked):
+		h.writeError(w, http.StatusLocked, "Unlock the keyring to read or change encrypted settings")
+	default:
+		h.logger.Error("Settings operation failed", zap.Error(err))
+		h.writeError(w, http.StatusInternalServerError, "Settings operation failed")
+	}
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -10,8 +12,11 @@ import (
 func (h *Handlers) GetTorConnections(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("Fetching Tor connections")
 
-	// Get actual Tor connections from torrent client
-	connections := h.torrentClient.GetProxyConnections()
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Configured proxies plus live circuits when the control port is available
+	connections := h.torrentClient.GetTorConnections(ctx)
 
 	h.logger.Info("Tor connections fetched successfully",
 		zap.Int("count", len(connections)),
@@ -19,3 +24,26 @@ func (h *Handlers) GetTorConnections(w http.ResponseWriter, r *http.Request) {
 
 	h.writeJSON(w, http.StatusOK, connections)
 }
+
+// GetTorControlStatus returns bootstrap progress and circuit details from the Tor control port
+func (h *Handlers) GetTorControlStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	h.writeJSON(w, http.StatusOK, h.torrentClient.TorControlStatus(ctx))
+}
+
+// RotateTorCircuits asks Tor for fresh circuits (NEWNYM)
+func (h *Handlers) RotateTorCircuits(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := h.torrentClient.RotateTorCircuits(ctx); err != nil {
+		h.logger.Warn("Tor circuit rotation failed", zap.Error(err))
+		h.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	h.logger.Info("Tor circuits rotated")
+	h.writeJSON(w, http.StatusOK, MessageResponse{Message: "New Tor circuits requested"})
+}
@@ -0,0 +1,557 @@
+// Package audit keeps an opt-in, tamper-evident record of administrative
+// actions.
+//
+// Each entry is sealed to the audit public key, so entries can be written
+// while the keyring is locked but only read once it is unlocked: the
+// matching private key is kept encrypted by the keyring. Entries form an
+// HMAC-SHA256 chain over their sealed payloads, keyed by a chain key that
+// the keyring also encrypts, and a head record sealed with the same key
+// holds the number of entries and the newest hash. Verify uses both to
+// detect edited, removed, reordered or truncated entries without decrypting
+// them; without the chain key a rewritten chain cannot be made to verify.
+// The log is never written while no-logs mode is on.
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// SettingKey is the settings row the audit configuration is kept in. The
+// system_ prefix keeps it out of ClearUserSettings.
+const SettingKey = "system_audit_log"
+
+// HeadSettingKey holds the sealed head record.
+const HeadSettingKey = "system_audit_head"
+
+// GenesisHash is the previous hash of the first entry.
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+	verifyPageSize  = 500
+	// maxPendingEntries bounds the entries held in memory while the chain
+	// key cannot be read yet.
+	maxPendingEntries = 1000
+	chainKeySize      = 32
+)
+
+// ErrNoLogsMode is returned when enabling the log while no-logs mode is on.
+var ErrNoLogsMode = errors.New("the audit log cannot be enabled while no-logs mode is on")
+
+// Record is an entry as stored: the sealed payload and its place in the
+// hash chain.
+type Record struct {
+	Seq      int64
+	Payload  string
+	PrevHash string
+	Hash     string
+}
+
+// Store persists records. LastAuditRecord returns nil when the log is empty
+// and ListAuditRecords returns records with a sequence number above
+// afterSeq in ascending order.
+type Store interface {
+	AppendAuditRecord(record *Record) error
+	LastAuditRecord() (*Record, error)
+	ListAuditRecords(afterSeq int64, limit int) ([]Record, error)
+}
+
+type settingsStore interface {
+	GetSetting(key string) (string, error)
+	SetSetting(key, value string) error
+}
+
+// Actor is who performed an action and how they authenticated.
+type Actor struct {
+	Name   string `json:"name"`
+	Method string `json:"method"`
+}
+
+// Entry is a decrypted record.
+type Entry struct {
+	Seq     int64             `json:"seq"`
+	At      time.Time         `json:"at"`
+	Actor   Actor             `json:"actor"`
+	Action  string            `json:"action"`
+	Target  string            `json:"target,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+	Hash    string            `json:"hash"`
+}
+
+type payload struct {
+	At      time.Time         `json:"at"`
+	Actor   Actor             `json:"actor"`
+	Action  string            `json:"action"`
+	Target  string            `json:"target,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Verification is the result of walking the hash chain and comparing it
+// with the sealed head record. Head is the hash of the newest entry.
+type Verification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	Head     string `json:"head"`
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Status describes the audit log.
+type Status struct {
+	Enabled bool `json:"enabled"`
+	// Blocked is set while no-logs mode keeps an enabled log from being
+	// written.
+	Blocked bool `json:"blocked"`
+}
+
+type logState struct {
+	Enabled    bool   `json:"enabled"`
+	PublicKey  []byte `json:"publicKey,omitempty"`
+	PrivateKey string `json:"privateKey,omitempty"`
+	// ChainKey is the HMAC key of the hash chain, encrypted by the keyring.
+	ChainKey string `json:"chainKey,omitempty"`
+}
+
+// head is the sealed head record: the number of entries, the hash of the
+// newest one and an HMAC over both.
+type head struct {
+	Count int64  `json:"count"`
+	Hash  string `json:"hash"`
+	MAC   string `json:"mac"`
+}
+
+// Log writes, reads and verifies the audit log.
+type Log struct {
+	mu       sync.Mutex
+	store    Store
+	settings settingsStore
+	fields   *security.DataEncryption
+	noLogs   func() bool
+	logger   *zap.Logger
+	state    logState
+
+	// chainKey stays in memory once read, so that entries can still be
+	// chained after the keyring is locked again.
+	chainKey []byte
+	// pending holds sealed payloads recorded before the chain key could be
+	// read, oldest first. They are chained once the keyring is unlocked.
+	pending []string
+}
+
+// NewLog loads the audit configuration from settings. noLogs reports
+// whether no-logs mode is on; while it is, nothing is written.
+func NewLog(store Store, settings settingsStore, fields *security.DataEncryption, noLogs func() bool, logger *zap.Logger) (*Log, error) {
+	l := &Log{store: store, settings: settings, fields: fields, noLogs: noLogs, logger: logger}
+	value, err := settings.GetSetting(SettingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load audit log settings: %w", err)
+	}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &l.state); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log settings: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Status reports whether the log is enabled and whether no-logs mode is
+// holding it back.
+func (l *Log) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Status{Enabled: l.state.Enabled, Blocked: l.state.Enabled && l.noLogs()}
+}
+
+// Enable turns the log on. The first time, it creates the audit key pair
+// and the chain key, which needs an unlocked keyring.
+func (l *Log) Enable() error {
+	if l.noLogs() {
+		return ErrNoLogsMode
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.state
+	state.Enabled = true
+	if len(state.PublicKey) == 0 {
+		public, private, err := box.GenerateKey(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("failed to generate audit key: %w", err)
+		}
+		sealed, err := l.fields.Encrypt(base64.StdEncoding.EncodeToString(private[:]))
+		clear(private[:])
+		if err != nil {
+			return err
+		}
+		state.PublicKey = public[:]
+		state.PrivateKey = sealed
+	}
+	var chainKey []byte
+	if state.ChainKey == "" {
+		var err error
+		if chainKey, state.ChainKey, err = l.newChainKey(); err != nil {
+			return err
+		}
+	}
+	if err := l.saveLocked(state); err != nil {
+		return err
+	}
+	if chainKey != nil {
+		l.chainKey = chainKey
+	}
+	l.logger.Info("Audit log enabled")
+	return nil
+}
+
+// Disable stops new entries. Existing entries are kept.
+func (l *Log) Disable() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state := l.state
+	state.Enabled = false
+	return l.saveLocked(state)
+}
+
+func (l *Log) saveLocked(state logState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to serialize audit log settings: %w", err)
+	}
+	if err := l.settings.SetSetting(SettingKey, string(data)); err != nil {
+		return fmt.Errorf("failed to save audit log settings: %w", err)
+	}
+	l.state = state
+	return nil
+}
+
+func (l *Log) newChainKey() ([]byte, string, error) {
+	key := make([]byte, chainKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, "", fmt.Errorf("failed to generate audit chain key: %w", err)
+	}
+	sealed, err := l.fields.Encrypt(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		return nil, "", err
+	}
+	return key, sealed, nil
+}
+
+// loadKeyLocked reads the chain key, creating it for a log enabled before
+// chain keys existed. It fails with security.ErrKeyringLocked until the
+// keyring has been unlocked once.
+func (l *Log) loadKeyLocked() error {
+	if l.chainKey != nil {
+		return nil
+	}
+	if l.state.ChainKey == "" {
+		key, sealed, err := l.newChainKey()
+		if err != nil {
+			return err
+		}
+		state := l.state
+		state.ChainKey = sealed
+		if err := l.saveLocked(state); err != nil {
+			return err
+		}
+		l.chainKey = key
+		return nil
+	}
+	encoded, err := l.fields.Decrypt(l.state.ChainKey)
+	if err != nil {
+		return err
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != chainKeySize {
+		return fmt.Errorf("invalid audit chain key")
+	}
+	l.chainKey = key
+	return nil
+}
+
+// Flush chains the entries recorded before the chain key could be read. It
+// is called once the keyring is unlocked; Record and Verify also flush.
+func (l *Log) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) == 0 {
+		return nil
+	}
+	if err := l.loadKeyLocked(); err != nil {
+		return err
+	}
+	return l.flushLocked()
+}
+
+func (l *Log) flushLocked() error {
+	for len(l.pending) > 0 {
+		if err := l.appendLocked(l.pending[0]); err != nil {
+			return err
+		}
+		l.pending = l.pending[1:]
+	}
+	return nil
+}
+
+// appendLocked chains one sealed payload after the newest record and moves
+// the head record to it.
+func (l *Log) appendLocked(sealed string) error {
+	last, err := l.store.LastAuditRecord()
+	if err != nil {
+		return err
+	}
+	record := &Record{Seq: 1, PrevHash: GenesisHash, Payload: sealed}
+	if last != nil {
+		record.Seq = last.Seq + 1
+		record.PrevHash = last.Hash
+	}
+	record.Hash = chainHash(l.chainKey, record.Seq, record.PrevHash, record.Payload)
+	if err := l.store.AppendAuditRecord(record); err != nil {
+		return err
+	}
+	data, err := json.Marshal(head{Count: record.Seq, Hash: record.Hash, MAC: headMAC(l.chainKey, record.Seq, record.Hash)})
+	if err != nil {
+		return fmt.Errorf("failed to serialize audit head: %w", err)
+	}
+	if err := l.settings.SetSetting(HeadSettingKey, string(data)); err != nil {
+		return fmt.Errorf("failed to save audit head: %w", err)
+	}
+	return nil
+}
+
+// Record appends an entry when the log is enabled and no-logs mode is off,
+// and does nothing otherwise. Until the keyring has been unlocked once after
+// a restart, entries are held in memory and chained on unlock.
+func (l *Log) Record(actor Actor, action, target string, details map[string]string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.state.Enabled || l.noLogs() {
+		return nil
+	}
+
+	data, err := json.Marshal(payload{
+		At:      time.Now().UTC(),
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Details: details,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize audit entry: %w", err)
+	}
+	var public [32]byte
+	copy(public[:], l.state.PublicKey)
+	sealed, err := box.SealAnonymous(nil, data, &public, rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to seal audit entry: %w", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+	if err := l.loadKeyLocked(); err != nil {
+		if !errors.Is(err, security.ErrKeyringLocked) {
+			return err
+		}
+		if len(l.pending) >= maxPendingEntries {
+			return fmt.Errorf("%d audit entries are waiting for the keyring to be unlocked", len(l.pending))
+		}
+		l.pending = append(l.pending, encoded)
+		return nil
+	}
+	if err := l.flushLocked(); err != nil {
+		return err
+	}
+	return l.appendLocked(encoded)
+}
+
+// Entries decrypts up to limit entries older than before, newest first. A
+// before of 0 starts at the newest entry. Reading needs an unlocked keyring.
+func (l *Log) Entries(before int64, limit int) ([]Entry, error) {
+	if limit <= 0 || limit > MaxPageSize {
+		limit = DefaultPageSize
+	}
+	l.mu.Lock()
+	state := l.state
+	l.mu.Unlock()
+	if state.PrivateKey == "" {
+		return []Entry{}, nil
+	}
+
+	encoded, err := l.fields.Decrypt(state.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("invalid audit key")
+	}
+	var public, private [32]byte
+	copy(public[:], state.PublicKey)
+	copy(private[:], raw)
+	defer clear(private[:])
+	clear(raw)
+
+	if before <= 0 {
+		last, err := l.store.LastAuditRecord()
+		if err != nil || last == nil {
+			return []Entry{}, err
+		}
+		before = last.Seq + 1
+	}
+	records, err := l.store.ListAuditRecords(max(0, before-1-int64(limit)), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(records))
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if record.Seq >= before {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(record.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("audit entry %d is corrupt", record.Seq)
+		}
+		data, ok := box.OpenAnonymous(nil, sealed, &public, &private)
+		if !ok {
+			return nil, fmt.Errorf("audit entry %d cannot be decrypted", record.Seq)
+		}
+		var p payload
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("audit entry %d is corrupt", record.Seq)
+		}
+		entries = append(entries, Entry{
+			Seq:     record.Seq,
+			At:      p.At,
+			Actor:   p.Actor,
+			Action:  p.Action,
+			Target:  p.Target,
+			Details: p.Details,
+			Hash:    record.Hash,
+		})
+	}
+	return entries, nil
+}
+
+// Verify walks the whole chain, reports the first entry that does not
+// follow from the one before it and checks the chain against the sealed head
+// record. It needs the chain key, so the keyring must have been unlocked
+// since the backend started.
+func (l *Log) Verify() (Verification, error) {
+	l.mu.Lock()
+	err := l.loadKeyLocked()
+	if err == nil {
+		err = l.flushLocked()
+	}
+	key := l.chainKey
+	l.mu.Unlock()
+	if err != nil {
+		return Verification{}, err
+	}
+	sealedHead, err := l.settings.GetSetting(HeadSettingKey)
+	if err != nil {
+		return Verification{}, fmt.Errorf("failed to load audit head: %w", err)
+	}
+
+	result, err := l.walk(key)
+	if err != nil || !result.Valid {
+		return result, err
+	}
+	if sealedHead == "" {
+		if result.Entries > 0 {
+			return broken(result, 1, "head record is missing"), nil
+		}
+		return result, nil
+	}
+	var h head
+	if err := json.Unmarshal([]byte(sealedHead), &h); err != nil || !hmac.Equal([]byte(h.MAC), []byte(headMAC(key, h.Count, h.Hash))) {
+		return broken(result, 1, "head record does not match"), nil
+	}
+	// Entries appended after the head was read are authenticated by the
+	// chain itself; only a chain shorter than the head was truncated.
+	if result.Entries < h.Count {
+		return broken(result, result.Entries+1, "newest entries were removed"), nil
+	}
+	if hashAt, err := l.hashAt(h.Count); err != nil {
+		return Verification{}, err
+	} else if hashAt != h.Hash {
+		return broken(result, h.Count, "entry does not match the head record"), nil
+	}
+	return result, nil
+}
+
+// hashAt returns the hash of entry seq, or GenesisHash for 0.
+func (l *Log) hashAt(seq int64) (string, error) {
+	if seq == 0 {
+		return GenesisHash, nil
+	}
+	records, err := l.store.ListAuditRecords(seq-1, 1)
+	if err != nil {
+		return "", err
+	}
+	if len(records) == 0 || records[0].Seq != seq {
+		return "", nil
+	}
+	return records[0].Hash, nil
+}
+
+func (l *Log) walk(key []byte) (Verification, error) {
+	result := Verification{Valid: true, Head: GenesisHash}
+	var after int64
+	for {
+		records, err := l.store.ListAuditRecords(after, verifyPageSize)
+		if err != nil {
+			return Verification{}, err
+		}
+		for _, record := range records {
+			switch {
+			case record.Seq != after+1:
+				return broken(result, after+1, "entry is missing"), nil
+			case record.PrevHash != result.Head:
+				return broken(result, record.Seq, "previous hash does not match"), nil
+			case !hmac.Equal([]byte(record.Hash), []byte(chainHash(key, record.Seq, record.PrevHash, record.Payload))):
+				return broken(result, record.Seq, "entry hash does not match its contents"), nil
+			}
+			after = record.Seq
+			result.Entries++
+			result.Head = record.Hash
+		}
+		if len(records) < verifyPageSize {
+			return result, nil
+		}
+	}
+}
+
+func broken(result Verification, seq int64, reason string) Verification {
+	result.Valid = false
+	result.BrokenAt = seq
+	result.Reason = reason
+	return result
+}
+
+func chainHash(key []byte, seq int64, prevHash, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.FormatInt(seq, 10) + "\n" + prevHash + "\n" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func headMAC(key []byte, count int64, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("head\n" + strconv.FormatInt(count, 10) + "\n" + hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
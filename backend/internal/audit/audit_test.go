@@ -0,0 +1,221 @@
+package audit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings/settingstest"
+	"go.uber.org/zap"
+)
+
+type memoryStore struct {
+	records []Record
+}
+
+func (s *memoryStore) AppendAuditRecord(record *Record) error {
+	s.records = append(s.records, *record)
+	return nil
+}
+
+func (s *memoryStore) LastAuditRecord() (*Record, error) {
+	if len(s.records) == 0 {
+		return nil, nil
+	}
+	record := s.records[len(s.records)-1]
+	return &record, nil
+}
+
+func (s *memoryStore) ListAuditRecords(afterSeq int64, limit int) ([]Record, error) {
+	records := []Record{}
+	for _, record := range s.records {
+		if record.Seq > afterSeq && len(records) < limit {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+type memoryKeyringStore struct {
+	data []byte
+}
+
+func (s *memoryKeyringStore) Load() ([]byte, error) { return s.data, nil }
+
+func (s *memoryKeyringStore) Save(data []byte) error {
+	s.data = append([]byte(nil), data...)
+	return nil
+}
+
+func newTestLog(t *testing.T, noLogs *bool) (*Log, *memoryStore, *security.Keyring) {
+	t.Helper()
+	keyring, err := security.NewKeyring(&memoryKeyringStore{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	if err := keyring.Initialize("correct horse battery"); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	fields, err := security.NewDataEncryption(keyring, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewDataEncryption() error = %v", err)
+	}
+	store := &memoryStore{}
+	log, err := NewLog(store, &settingstest.Store{}, fields, func() bool { return *noLogs }, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewLog() error = %v", err)
+	}
+	return log, store, keyring
+}
+
+func TestAuditLogRecordsSealedChainedEntries(t *testing.T) {
+	noLogs := false
+	log, store, keyring := newTestLog(t, &noLogs)
+	admin := Actor{Name: "admin", Method: "session"}
+
+	if err := log.Record(admin, "killswitch.trigger", "hard", nil); err != nil || len(store.records) != 0 {
+		t.Fatalf("disabled log wrote %d records (err %v)", len(store.records), err)
+	}
+	if err := log.Enable(); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+
+	// Entries can be written while the keyring is locked, but not read.
+	keyring.Lock()
+	for _, action := range []string{"token.create", "user.delete", "killswitch.trigger"} {
+		if err := log.Record(admin, action, "target", map[string]string{"key": "value"}); err != nil {
+			t.Fatalf("Record(%s) error = %v", action, err)
+		}
+	}
+	if _, err := log.Entries(0, 10); !errors.Is(err, security.ErrKeyringLocked) {
+		t.Fatalf("Entries() while locked error = %v, want %v", err, security.ErrKeyringLocked)
+	}
+	if err := keyring.Unlock("correct horse battery"); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	entries, err := log.Entries(0, 2)
+	if err != nil {
+		t.Fatalf("Entries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Seq != 3 || entries[0].Action != "killswitch.trigger" || entries[1].Action != "user.delete" {
+		t.Fatalf("Entries() = %+v, want the two newest entries, newest first", entries)
+	}
+	if entries[0].Actor != admin || entries[0].Details["key"] != "value" {
+		t.Fatalf("entry = %+v, want actor and details preserved", entries[0])
+	}
+	older, err := log.Entries(entries[1].Seq, 10)
+	if err != nil || len(older) != 1 || older[0].Action != "token.create" {
+		t.Fatalf("Entries(before) = %+v, %v, want the oldest entry", older, err)
+	}
+
+	result, err := log.Verify()
+	if err != nil || !result.Valid || result.Entries != 3 || result.Head != store.records[2].Hash {
+		t.Fatalf("Verify() = %+v, %v, want a valid chain of 3", result, err)
+	}
+
+	store.records[1].Payload = store.records[0].Payload
+	result, err = log.Verify()
+	if err != nil || result.Valid || result.BrokenAt != 2 {
+		t.Fatalf("Verify() after edit = %+v, %v, want broken at 2", result, err)
+	}
+
+	store.records = append(store.records[:1], store.records[2:]...)
+	result, _ = log.Verify()
+	if result.Valid || result.BrokenAt != 2 {
+		t.Fatalf("Verify() after removal = %+v, want broken at 2", result)
+	}
+}
+
+func TestAuditLogNeverWritesInNoLogsMode(t *testing.T) {
+	noLogs := true
+	log, store, _ := newTestLog(t, &noLogs)
+	if err := log.Enable(); !errors.Is(err, ErrNoLogsMode) {
+		t.Fatalf("Enable() error = %v, want %v", err, ErrNoLogsMode)
+	}
+
+	noLogs = false
+	if err := log.Enable(); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+	noLogs = true
+	if status := log.Status(); !status.Enabled || !status.Blocked {
+		t.Fatalf("Status() = %+v, want enabled and blocked", status)
+	}
+	if err := log.Record(Actor{Name: "admin"}, "security.update", "", nil); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if len(store.records) != 0 {
+		t.Fatalf("no-logs mode wrote %d records", len(store.records))
+	}
+}
+
+func TestAuditLogDetectsTruncationAndRewrites(t *testing.T) {
+	noLogs := false
+	log, store, _ := newTestLog(t, &noLogs)
+	admin := Actor{Name: "admin", Method: "session"}
+	if err := log.Enable(); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+	for _, action := range []string{"token.create", "user.delete", "killswitch.trigger"} {
+		if err := log.Record(admin, action, "", nil); err != nil {
+			t.Fatalf("Record(%s) error = %v", action, err)
+		}
+	}
+
+	// Dropping the newest entry leaves a valid chain, which only the head
+	// record shows to be short.
+	store.records = store.records[:2]
+	result, err := log.Verify()
+	if err != nil || result.Valid || result.BrokenAt != 3 {
+		t.Fatalf("Verify() after truncation = %+v, %v, want broken at 3", result, err)
+	}
+
+	// A chain recomputed without the chain key does not verify.
+	store.records = store.records[:1]
+	store.records[0].Payload = "forged"
+	store.records[0].Hash = chainHash(make([]byte, chainKeySize), 1, GenesisHash, "forged")
+	if result, _ = log.Verify(); result.Valid || result.BrokenAt != 1 {
+		t.Fatalf("Verify() after rewrite = %+v, want broken at 1", result)
+	}
+}
+
+func TestAuditLogHoldsEntriesUntilUnlock(t *testing.T) {
+	noLogs := false
+	log, store, keyring := newTestLog(t, &noLogs)
+	admin := Actor{Name: "admin", Method: "session"}
+	if err := log.Enable(); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+	if err := log.Record(admin, "token.create", "", nil); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	// After a restart the chain key cannot be read until the keyring is
+	// unlocked, so new entries wait in memory.
+	keyring.Lock()
+	restarted, err := NewLog(store, log.settings, log.fields, func() bool { return noLogs }, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewLog() error = %v", err)
+	}
+	if err := restarted.Record(admin, "user.delete", "", nil); err != nil {
+		t.Fatalf("Record() while locked error = %v", err)
+	}
+	if len(store.records) != 1 {
+		t.Fatalf("locked log wrote %d records, want 1", len(store.records))
+	}
+	if _, err := restarted.Verify(); !errors.Is(err, security.ErrKeyringLocked) {
+		t.Fatalf("Verify() while locked error = %v, want %v", err, security.ErrKeyringLocked)
+	}
+
+	if err := keyring.Unlock("correct horse battery"); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := restarted.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	result, err := restarted.Verify()
+	if err != nil || !result.Valid || result.Entries != 2 {
+		t.Fatalf("Verify() = %+v, %v, want a valid chain of 2", result, err)
+	}
+}
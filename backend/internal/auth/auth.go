@@ -0,0 +1,412 @@
+// Package auth manages user accounts, their roles and login sessions.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Role grants a fixed set of permissions. Each role includes the
+// permissions of the roles below it.
+type Role string
+
+const (
+	// RoleViewer can only read state.
+	RoleViewer Role = "viewer"
+	// RoleOperator can also add, pause, resume and remove torrents.
+	RoleOperator Role = "operator"
+	// RoleAdmin can do everything, including settings, keys and accounts.
+	RoleAdmin Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ParseRole validates a role name.
+func ParseRole(value string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(value)))
+	if _, ok := roleRank[role]; !ok {
+		return "", ErrInvalidRole
+	}
+	return role, nil
+}
+
+// Allows reports whether r includes the permissions of required.
+func (r Role) Allows(required Role) bool {
+	rank, ok := roleRank[r]
+	return ok && rank >= roleRank[required]
+}
+
+const (
+	// DefaultSessionTTL is how long a session stays valid after login.
+	DefaultSessionTTL = 12 * time.Hour
+
+	minPasswordLength = 12
+	sessionTokenSize  = 32
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,64}$`)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrInvalidUsername    = errors.New("username must be 3-64 letters, digits, dots, dashes or underscores")
+	ErrWeakPassword       = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	ErrInvalidRole        = errors.New("role must be admin, operator or viewer")
+	ErrUserExists         = errors.New("username is already taken")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrSessionNotFound    = errors.New("session not found or expired")
+	ErrLastAdmin          = errors.New("at least one admin account must remain")
+	ErrAlreadySetUp       = errors.New("accounts have already been set up")
+)
+
+// User is an account. PasswordHash is never serialized.
+type User struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	Role         Role      `json:"role"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Session is a login session. Only the SHA-256 hash of the session token is
+// stored; the token itself is handed to the client once.
+type Session struct {
+	TokenHash string
+	UserID    int64
+	CSRFToken string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Store persists accounts, sessions and API tokens. Lookups return
+// ErrUserNotFound or ErrSessionNotFound when nothing matches, and CreateUser
+// returns ErrUserExists for a duplicate username.
+type Store interface {
+	TokenStore
+
+	CountUsers() (int, error)
+	CreateUser(user *User) error
+	GetUser(id int64) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	ListUsers() ([]User, error)
+	UpdateUser(user *User) error
+	DeleteUser(id int64) error
+
+	CreateSession(session *Session) error
+	GetSession(tokenHash string) (*Session, error)
+	DeleteSession(tokenHash string) error
+	DeleteUserSessions(userID int64, exceptTokenHash string) error
+	DeleteExpiredSessions(now time.Time) error
+	DeleteAllSessions() error
+}
+
+// Authentication methods reported in Identity.Method.
+const (
+	MethodSession = "session"
+	MethodToken   = "token"
+	MethodAPIKey  = "api-key"
+	MethodOpen    = "open"
+)
+
+// Identity is the authenticated caller of a request. Session is set only
+// for MethodSession and Token only for MethodToken.
+type Identity struct {
+	User    User
+	Method  string
+	Session *Session
+	Token   *APIToken
+}
+
+// Allows reports whether the caller may use a route that needs role from
+// users and scope from API tokens. Routes without a scope are for users
+// only; no token is admitted to them.
+func (id *Identity) Allows(role Role, scope Scope) bool {
+	if id.Token != nil {
+		return scope != "" && id.Token.HasScope(scope)
+	}
+	return id.User.Role.Allows(role)
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the caller stored by WithIdentity, if any.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok && id != nil
+}
+
+// Service implements account management and login on top of a Store.
+type Service struct {
+	store      Store
+	sessionTTL time.Duration
+	logger     *zap.Logger
+
+	hasUsers  atomic.Bool
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+// NewService loads whether any account exists yet. A zero sessionTTL means
+// DefaultSessionTTL.
+func NewService(store Store, sessionTTL time.Duration, logger *zap.Logger) (*Service, error) {
+	if sessionTTL <= 0 {
+		sessionTTL = DefaultSessionTTL
+	}
+	s := &Service{store: store, sessionTTL: sessionTTL, logger: logger}
+	count, err := store.CountUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	s.hasUsers.Store(count > 0)
+	return s, nil
+}
+
+// HasUsers reports whether any account exists. Until one does, access is
+// controlled by the legacy B2_API_TOKEN alone.
+func (s *Service) HasUsers() bool {
+	return s.hasUsers.Load()
+}
+
+// Setup creates the first account, which is always an admin.
+func (s *Service) Setup(username, password string) (*User, error) {
+	count, err := s.store.CountUsers()
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAlreadySetUp
+	}
+	return s.CreateUser(username, password, RoleAdmin)
+}
+
+// CreateUser adds an account.
+func (s *Service) CreateUser(username, password string, role Role) (*User, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if len(password) < minPasswordLength {
+		return nil, ErrWeakPassword
+	}
+	if _, ok := roleRank[role]; !ok {
+		return nil, ErrInvalidRole
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &User{Username: username, Role: role, PasswordHash: hash}
+	if err := s.store.CreateUser(user); err != nil {
+		return nil, err
+	}
+	s.hasUsers.Store(true)
+	s.logger.Info("User created", zap.Int64("userId", user.ID), zap.String("role", string(role)))
+	return user, nil
+}
+
+// ListUsers returns every account.
+func (s *Service) ListUsers() ([]User, error) {
+	return s.store.ListUsers()
+}
+
+// UpdateUser changes the role and, when password is not empty, the password
+// of an account. A password change ends all of the user's sessions.
+func (s *Service) UpdateUser(id int64, role Role, password string) (*User, error) {
+	user, err := s.store.GetUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if role != "" {
+		if _, ok := roleRank[role]; !ok {
+			return nil, ErrInvalidRole
+		}
+		if user.Role == RoleAdmin && role != RoleAdmin {
+			if err := s.ensureOtherAdmin(id); err != nil {
+				return nil, err
+			}
+		}
+		user.Role = role
+	}
+	if password != "" {
+		if len(password) < minPasswordLength {
+			return nil, ErrWeakPassword
+		}
+		if user.PasswordHash, err = HashPassword(password); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.store.UpdateUser(user); err != nil {
+		return nil, err
+	}
+	if password != "" {
+		if err := s.store.DeleteUserSessions(id, ""); err != nil {
+			return nil, err
+		}
+	}
+	s.logger.Info("User updated", zap.Int64("userId", id), zap.String("role", string(user.Role)))
+	return user, nil
+}
+
+// DeleteUser removes an account and its sessions.
+func (s *Service) DeleteUser(id int64) error {
+	user, err := s.store.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if user.Role == RoleAdmin {
+		if err := s.ensureOtherAdmin(id); err != nil {
+			return err
+		}
+	}
+	if err := s.store.DeleteUser(id); err != nil {
+		return err
+	}
+	count, err := s.store.CountUsers()
+	if err == nil {
+		s.hasUsers.Store(count > 0)
+	}
+	s.logger.Info("User deleted", zap.Int64("userId", id))
+	return nil
+}
+
+func (s *Service) ensureOtherAdmin(id int64) error {
+	users, err := s.store.ListUsers()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.ID != id && user.Role == RoleAdmin {
+			return nil
+		}
+	}
+	return ErrLastAdmin
+}
+
+// Login checks the credentials and starts a session. It returns the session
+// token, which is not stored anywhere else.
+func (s *Service) Login(username, password string) (string, *Session, *User, error) {
+	user, err := s.store.GetUserByUsername(username)
+	if errors.Is(err, ErrUserNotFound) {
+		// Spend the same time as a real check so usernames cannot be probed.
+		_, _ = VerifyPassword(s.dummy(), password)
+		return "", nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if ok, err := VerifyPassword(user.PasswordHash, password); err != nil || !ok {
+		return "", nil, nil, ErrInvalidCredentials
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	now := time.Now()
+	session := &Session{
+		TokenHash: HashToken(token),
+		UserID:    user.ID,
+		CSRFToken: csrf,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.sessionTTL),
+	}
+	if err := s.store.DeleteExpiredSessions(now); err != nil {
+		s.logger.Warn("Failed to remove expired sessions", zap.Error(err))
+	}
+	if err := s.store.CreateSession(session); err != nil {
+		return "", nil, nil, err
+	}
+	return token, session, user, nil
+}
+
+// Resolve returns the user and session for a session token.
+func (s *Service) Resolve(token string) (*User, *Session, error) {
+	session, err := s.store.GetSession(HashToken(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		_ = s.store.DeleteSession(session.TokenHash)
+		return nil, nil, ErrSessionNotFound
+	}
+	user, err := s.store.GetUser(session.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, session, nil
+}
+
+// Logout ends a session.
+func (s *Service) Logout(session *Session) error {
+	return s.store.DeleteSession(session.TokenHash)
+}
+
+// EndAllSessions signs every user out.
+func (s *Service) EndAllSessions() error {
+	return s.store.DeleteAllSessions()
+}
+
+// ChangePassword replaces the password of the session's user after
+// checking the current one, and ends the user's other sessions.
+func (s *Service) ChangePassword(session *Session, current, next string) error {
+	user, err := s.store.GetUser(session.UserID)
+	if err != nil {
+		return err
+	}
+	if ok, err := VerifyPassword(user.PasswordHash, current); err != nil || !ok {
+		return ErrInvalidCredentials
+	}
+	if len(next) < minPasswordLength {
+		return ErrWeakPassword
+	}
+	if user.PasswordHash, err = HashPassword(next); err != nil {
+		return err
+	}
+	if err := s.store.UpdateUser(user); err != nil {
+		return err
+	}
+	return s.store.DeleteUserSessions(user.ID, session.TokenHash)
+}
+
+func (s *Service) dummy() string {
+	s.dummyOnce.Do(func() {
+		s.dummyHash, _ = HashPassword("dummy password for timing")
+	})
+	return s.dummyHash
+}
+
+// HashToken returns the hex SHA-256 of a session token, as stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, sessionTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,386 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type memoryStore struct {
+	users    map[int64]*User
+	sessions map[string]*Session
+	tokens   map[int64]*APIToken
+	nextID   int64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		users:    make(map[int64]*User),
+		sessions: make(map[string]*Session),
+		tokens:   make(map[int64]*APIToken),
+	}
+}
+
+func (s *memoryStore) CountUsers() (int, error) { return len(s.users), nil }
+
+func (s *memoryStore) CreateUser(user *User) error {
+	for _, existing := range s.users {
+		if existing.Username == user.Username {
+			return ErrUserExists
+		}
+	}
+	s.nextID++
+	user.ID = s.nextID
+	user.CreatedAt = time.Now()
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) GetUser(id int64) (*User, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s *memoryStore) GetUserByUsername(username string) (*User, error) {
+	for _, user := range s.users {
+		if user.Username == username {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+func (s *memoryStore) ListUsers() ([]User, error) {
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+func (s *memoryStore) UpdateUser(user *User) error {
+	if _, ok := s.users[user.ID]; !ok {
+		return ErrUserNotFound
+	}
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) DeleteUser(id int64) error {
+	delete(s.users, id)
+	return s.DeleteUserSessions(id, "")
+}
+
+func (s *memoryStore) CreateSession(session *Session) error {
+	stored := *session
+	s.sessions[session.TokenHash] = &stored
+	return nil
+}
+
+func (s *memoryStore) GetSession(tokenHash string) (*Session, error) {
+	session, ok := s.sessions[tokenHash]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (s *memoryStore) DeleteSession(tokenHash string) error {
+	delete(s.sessions, tokenHash)
+	return nil
+}
+
+func (s *memoryStore) DeleteUserSessions(userID int64, exceptTokenHash string) error {
+	for hash, session := range s.sessions {
+		if session.UserID == userID && hash != exceptTokenHash {
+			delete(s.sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteAllSessions() error {
+	s.sessions = map[string]*Session{}
+	return nil
+}
+
+func (s *memoryStore) DeleteExpiredSessions(now time.Time) error {
+	for hash, session := range s.sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(s.sessions, hash)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) CreateToken(token *APIToken) error {
+	s.nextID++
+	token.ID = s.nextID
+	token.CreatedAt = time.Now()
+	stored := *token
+	s.tokens[token.ID] = &stored
+	return nil
+}
+
+func (s *memoryStore) GetTokenByHash(secretHash string) (*APIToken, error) {
+	for _, token := range s.tokens {
+		if token.SecretHash == secretHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, ErrTokenNotFound
+}
+
+func (s *memoryStore) ListTokens() ([]APIToken, error) {
+	tokens := make([]APIToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, *token)
+	}
+	return tokens, nil
+}
+
+func (s *memoryStore) UpdateTokenSecret(id int64, secretHash, prefix string) error {
+	token, ok := s.tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	token.SecretHash, token.Prefix, token.LastUsedAt = secretHash, prefix, nil
+	return nil
+}
+
+func (s *memoryStore) TouchToken(id int64, usedAt time.Time) error {
+	if token, ok := s.tokens[id]; ok {
+		token.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteToken(id int64) error {
+	if _, ok := s.tokens[id]; !ok {
+		return ErrTokenNotFound
+	}
+	delete(s.tokens, id)
+	return nil
+}
+
+func newTestService(t *testing.T, store Store) *Service {
+	t.Helper()
+	service, err := NewService(store, time.Hour, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	return service
+}
+
+func TestPasswordHashRoundTrip(t *testing.T) {
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$") || strings.Contains(hash, "correct horse") {
+		t.Fatalf("unexpected hash %q", hash)
+	}
+	if ok, err := VerifyPassword(hash, "correct horse battery"); err != nil || !ok {
+		t.Fatalf("VerifyPassword(correct) = %v, %v", ok, err)
+	}
+	if ok, _ := VerifyPassword(hash, "wrong horse battery"); ok {
+		t.Fatal("VerifyPassword accepted a wrong password")
+	}
+	if _, err := VerifyPassword("$argon2id$garbage", "x"); err == nil {
+		t.Fatal("VerifyPassword accepted a malformed hash")
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+	if !RoleAdmin.Allows(RoleOperator) || !RoleOperator.Allows(RoleViewer) || !RoleViewer.Allows(RoleViewer) {
+		t.Fatal("higher roles must include lower ones")
+	}
+	if RoleViewer.Allows(RoleOperator) || RoleOperator.Allows(RoleAdmin) || Role("root").Allows(RoleViewer) {
+		t.Fatal("lower or unknown roles must not be allowed")
+	}
+	if _, err := ParseRole("superuser"); !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("ParseRole(superuser) error = %v, want ErrInvalidRole", err)
+	}
+}
+
+func TestIdentityAllowsTokensOnlyWithScope(t *testing.T) {
+	token := &Identity{Method: MethodToken, Token: &APIToken{Scopes: []Scope{ScopeTorrentsRead}}}
+	if !token.Allows(RoleViewer, ScopeTorrentsRead) || token.Allows(RoleViewer, ScopeTorrentsWrite) {
+		t.Fatal("tokens must be admitted by their scopes only")
+	}
+	if token.Allows(RoleViewer, "") {
+		t.Fatal("tokens must not reach routes without a scope")
+	}
+	user := &Identity{Method: MethodSession, User: User{Role: RoleViewer}}
+	if !user.Allows(RoleViewer, "") {
+		t.Fatal("users must reach routes without a scope")
+	}
+}
+
+func TestServiceSetupLoginAndSessions(t *testing.T) {
+	store := newMemoryStore()
+	service := newTestService(t, store)
+	if service.HasUsers() {
+		t.Fatal("a new store must have no users")
+	}
+
+	admin, err := service.Setup("admin", "correct horse battery")
+	if err != nil || admin.Role != RoleAdmin {
+		t.Fatalf("Setup() = %+v, %v", admin, err)
+	}
+	if !service.HasUsers() {
+		t.Fatal("HasUsers() = false after setup")
+	}
+	if _, err := service.Setup("second", "correct horse battery"); !errors.Is(err, ErrAlreadySetUp) {
+		t.Fatalf("second Setup() error = %v, want ErrAlreadySetUp", err)
+	}
+
+	if _, _, _, err := service.Login("admin", "wrong password!!"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login(wrong) error = %v", err)
+	}
+	if _, _, _, err := service.Login("nobody", "correct horse battery"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login(unknown) error = %v", err)
+	}
+	token, session, _, err := service.Login("admin", "correct horse battery")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if _, ok := store.sessions[token]; ok {
+		t.Fatal("the raw session token must not be stored")
+	}
+	user, resolved, err := service.Resolve(token)
+	if err != nil || user.ID != admin.ID || resolved.CSRFToken != session.CSRFToken {
+		t.Fatalf("Resolve() = %+v, %+v, %v", user, resolved, err)
+	}
+
+	other, _, _, _ := service.Login("admin", "correct horse battery")
+	if err := service.ChangePassword(session, "correct horse battery", "a brand new passphrase"); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	if _, _, err := service.Resolve(other); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("other session after password change: %v, want ErrSessionNotFound", err)
+	}
+	if _, _, err := service.Resolve(token); err != nil {
+		t.Fatalf("current session after password change: %v", err)
+	}
+
+	if err := service.Logout(session); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if _, _, err := service.Resolve(token); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Resolve after Logout error = %v", err)
+	}
+
+	store.sessions[HashToken("expired")] = &Session{TokenHash: HashToken("expired"), UserID: admin.ID, ExpiresAt: time.Now().Add(-time.Minute)}
+	if _, _, err := service.Resolve("expired"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Resolve(expired) error = %v", err)
+	}
+
+	token, _, _, _ = service.Login("admin", "a brand new passphrase")
+	if err := service.EndAllSessions(); err != nil {
+		t.Fatalf("EndAllSessions() error = %v", err)
+	}
+	if _, _, err := service.Resolve(token); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Resolve after EndAllSessions error = %v", err)
+	}
+}
+
+func TestServiceKeepsAnAdmin(t *testing.T) {
+	service := newTestService(t, newMemoryStore())
+	admin, _ := service.Setup("admin", "correct horse battery")
+	viewer, err := service.CreateUser("viewer", "correct horse battery", RoleViewer)
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if _, err := service.CreateUser("viewer", "correct horse battery", RoleViewer); !errors.Is(err, ErrUserExists) {
+		t.Fatalf("duplicate CreateUser() error = %v", err)
+	}
+	if _, err := service.CreateUser("x", "correct horse battery", RoleViewer); !errors.Is(err, ErrInvalidUsername) {
+		t.Fatalf("CreateUser(short name) error = %v", err)
+	}
+	if _, err := service.CreateUser("weak", "short", RoleViewer); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("CreateUser(weak) error = %v", err)
+	}
+
+	if _, err := service.UpdateUser(admin.ID, RoleViewer, ""); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("demoting the last admin error = %v", err)
+	}
+	if err := service.DeleteUser(admin.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("deleting the last admin error = %v", err)
+	}
+	if _, err := service.UpdateUser(viewer.ID, RoleAdmin, ""); err != nil {
+		t.Fatalf("promoting a viewer error = %v", err)
+	}
+	if err := service.DeleteUser(admin.ID); err != nil {
+		t.Fatalf("deleting one of two admins error = %v", err)
+	}
+}
+
+func TestServiceAPITokens(t *testing.T) {
+	store := newMemoryStore()
+	service := newTestService(t, store)
+
+	if _, err := ParseScopes([]string{"torrents:read", "everything"}); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("ParseScopes(unknown) error = %v, want ErrInvalidScope", err)
+	}
+	scopes, err := ParseScopes([]string{"torrents:write", "TORRENTS:READ", "torrents:read"})
+	if err != nil || len(scopes) != 2 || scopes[0] != ScopeTorrentsRead {
+		t.Fatalf("ParseScopes() = %v, %v", scopes, err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if _, _, err := service.CreateToken("ci", scopes, &past, 0); !errors.Is(err, ErrTokenExpiry) {
+		t.Fatalf("CreateToken(past expiry) error = %v, want ErrTokenExpiry", err)
+	}
+
+	secret, token, err := service.CreateToken("ci", scopes, nil, 0)
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if !IsAPIToken(secret) || !strings.HasPrefix(secret, token.Prefix) || token.SecretHash == secret {
+		t.Fatalf("unexpected token %q / %+v", secret, token)
+	}
+	resolved, err := service.ResolveToken(secret)
+	if err != nil || !resolved.HasScope(ScopeTorrentsWrite) || resolved.HasScope(ScopeSecurityAdmin) {
+		t.Fatalf("ResolveToken() = %+v, %v", resolved, err)
+	}
+	if store.tokens[token.ID].LastUsedAt == nil {
+		t.Fatal("ResolveToken must record the last use")
+	}
+
+	rotated, _, err := service.RotateToken(token.ID)
+	if err != nil {
+		t.Fatalf("RotateToken() error = %v", err)
+	}
+	if _, err := service.ResolveToken(secret); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("old secret after rotation error = %v, want ErrTokenNotFound", err)
+	}
+	if _, err := service.ResolveToken(rotated); err != nil {
+		t.Fatalf("rotated secret error = %v", err)
+	}
+
+	if err := service.RevokeToken(token.ID); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if _, err := service.ResolveToken(rotated); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("revoked token error = %v, want ErrTokenNotFound", err)
+	}
+
+	soon := time.Now().Add(time.Hour)
+	secret, token, _ = service.CreateToken("short-lived", scopes, &soon, 0)
+	store.tokens[token.ID].ExpiresAt = &past
+	if _, err := service.ResolveToken(secret); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("expired token error = %v, want ErrTokenNotFound", err)
+	}
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Scope is a permission an API token can be granted. Session users are
+// checked by role instead.
+type Scope string
+
+const (
+	ScopeTorrentsRead  Scope = "torrents:read"
+	ScopeTorrentsWrite Scope = "torrents:write"
+	ScopeSettingsRead  Scope = "settings:read"
+	ScopeSettingsWrite Scope = "settings:write"
+	ScopeSecurityRead  Scope = "security:read"
+	ScopeSecurityAdmin Scope = "security:admin"
+	ScopeFilesEncrypt  Scope = "files:encrypt"
+	ScopeJobsRead      Scope = "jobs:read"
+	ScopeJobsWrite     Scope = "jobs:write"
+	ScopeAccountsAdmin Scope = "accounts:admin"
+	ScopeMetricsRead   Scope = "metrics:read"
+)
+
+var knownScopes = map[Scope]bool{
+	ScopeTorrentsRead:  true,
+	ScopeTorrentsWrite: true,
+	ScopeSettingsRead:  true,
+	ScopeSettingsWrite: true,
+	ScopeSecurityRead:  true,
+	ScopeSecurityAdmin: true,
+	ScopeFilesEncrypt:  true,
+	ScopeJobsRead:      true,
+	ScopeJobsWrite:     true,
+	ScopeAccountsAdmin: true,
+	ScopeMetricsRead:   true,
+}
+
+// Scopes lists every known scope in sorted order.
+func Scopes() []Scope {
+	scopes := make([]Scope, 0, len(knownScopes))
+	for scope := range knownScopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Slice(scopes, func(a, b int) bool { return scopes[a] < scopes[b] })
+	return scopes
+}
+
+// tokenPrefix marks managed API tokens so they are told apart from the
+// legacy B2_API_TOKEN.
+const (
+	tokenPrefix        = "b2t_"
+	tokenDisplayLength = len(tokenPrefix) + 8
+	tokenTouchInterval = time.Minute
+	maxTokenName       = 64
+)
+
+var (
+	ErrTokenNotFound = errors.New("API token not found, revoked or expired")
+	ErrInvalidScope  = errors.New("unknown API token scope")
+	ErrNoScopes      = errors.New("an API token needs at least one scope")
+	ErrTokenName     = fmt.Errorf("token name must be 1-%d characters", maxTokenName)
+	ErrTokenExpiry   = errors.New("token expiry must be in the future")
+)
+
+// APIToken is a named, scoped credential for automation. Only the SHA-256
+// of the secret is stored; Prefix keeps enough of it to recognise a token.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []Scope    `json:"scopes"`
+	CreatedBy  int64      `json:"createdBy,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	SecretHash string     `json:"-"`
+}
+
+// HasScope reports whether the token was granted scope.
+func (t *APIToken) HasScope(scope Scope) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenStore persists API tokens. Lookups return ErrTokenNotFound when
+// nothing matches.
+type TokenStore interface {
+	CreateToken(token *APIToken) error
+	GetTokenByHash(secretHash string) (*APIToken, error)
+	ListTokens() ([]APIToken, error)
+	UpdateTokenSecret(id int64, secretHash, prefix string) error
+	TouchToken(id int64, usedAt time.Time) error
+	DeleteToken(id int64) error
+}
+
+// IsAPIToken reports whether secret has the form of a managed API token.
+func IsAPIToken(secret string) bool {
+	return strings.HasPrefix(secret, tokenPrefix)
+}
+
+// ParseScopes validates and de-duplicates scope names.
+func ParseScopes(values []string) ([]Scope, error) {
+	seen := make(map[Scope]bool)
+	scopes := make([]Scope, 0, len(values))
+	for _, value := range values {
+		scope := Scope(strings.ToLower(strings.TrimSpace(value)))
+		if !knownScopes[scope] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidScope, value)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, ErrNoScopes
+	}
+	sort.Slice(scopes, func(a, b int) bool { return scopes[a] < scopes[b] })
+	return scopes, nil
+}
+
+// CreateToken issues a token and returns its secret, which is not stored
+// and cannot be shown again.
+func (s *Service) CreateToken(name string, scopes []Scope, expiresAt *time.Time, createdBy int64) (string, *APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxTokenName {
+		return "", nil, ErrTokenName
+	}
+	if len(scopes) == 0 {
+		return "", nil, ErrNoScopes
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, ErrTokenExpiry
+	}
+	secret, err := newTokenSecret()
+	if err != nil {
+		return "", nil, err
+	}
+	token := &APIToken{
+		Name:       name,
+		Prefix:     secret[:tokenDisplayLength],
+		Scopes:     scopes,
+		CreatedBy:  createdBy,
+		ExpiresAt:  expiresAt,
+		SecretHash: HashToken(secret),
+	}
+	if err := s.store.CreateToken(token); err != nil {
+		return "", nil, err
+	}
+	s.logger.Info("API token created", zap.Int64("tokenId", token.ID), zap.Int("scopes", len(scopes)))
+	return secret, token, nil
+}
+
+// ListTokens returns every token without its secret.
+func (s *Service) ListTokens() ([]APIToken, error) {
+	return s.store.ListTokens()
+}
+
+// RotateToken replaces a token's secret and returns the new secret and
+// prefix; the old secret stops working immediately.
+func (s *Service) RotateToken(id int64) (string, string, error) {
+	secret, err := newTokenSecret()
+	if err != nil {
+		return "", "", err
+	}
+	prefix := secret[:tokenDisplayLength]
+	if err := s.store.UpdateTokenSecret(id, HashToken(secret), prefix); err != nil {
+		return "", "", err
+	}
+	s.logger.Info("API token rotated", zap.Int64("tokenId", id))
+	return secret, prefix, nil
+}
+
+// RevokeToken deletes a token.
+func (s *Service) RevokeToken(id int64) error {
+	if err := s.store.DeleteToken(id); err != nil {
+		return err
+	}
+	s.logger.Info("API token revoked", zap.Int64("tokenId", id))
+	return nil
+}
+
+// ResolveToken returns the token for secret if it exists and has not
+// expired, and records when it was last used.
+func (s *Service) ResolveToken(secret string) (*APIToken, error) {
+	token, err := s.store.GetTokenByHash(HashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return nil, ErrTokenNotFound
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= tokenTouchInterval {
+		if err := s.store.TouchToken(token.ID, now); err != nil {
+			s.logger.Warn("Failed to record API token use", zap.Int64("tokenId", token.ID), zap.Error(err))
+		} else {
+			token.LastUsedAt = &now
+		}
+	}
+	return token, nil
+}
+
+func newTokenSecret() (string, error) {
+	random, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	return tokenPrefix + random, nil
+}
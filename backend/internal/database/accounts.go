@@ -0,0 +1,340 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+	"github.com/lib/pq"
+)
+
+const uniqueViolation = "23505"
+
+func (d *Database) CountUsers() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	if err := d.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+func (d *Database) CreateUser(user *auth.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := d.db.QueryRowContext(ctx,
+		"INSERT INTO users (username, password_hash, role) VALUES ($1, $2, $3) RETURNING id, created_at",
+		user.Username, user.PasswordHash, string(user.Role),
+	).Scan(&user.ID, &user.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return auth.ErrUserExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) GetUser(id int64) (*auth.User, error) {
+	return d.getUser("id = $1", id)
+}
+
+func (d *Database) GetUserByUsername(username string) (*auth.User, error) {
+	return d.getUser("username = $1", username)
+}
+
+func (d *Database) getUser(where string, arg interface{}) (*auth.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user auth.User
+	var role string
+	err := d.db.QueryRowContext(ctx,
+		"SELECT id, username, password_hash, role, created_at FROM users WHERE "+where, arg,
+	).Scan(&user.ID, &user.Username, &user.PasswordHash, &role, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	user.Role = auth.Role(role)
+	return &user, nil
+}
+
+func (d *Database) ListUsers() ([]auth.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, "SELECT id, username, role, created_at FROM users ORDER BY username")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]auth.User, 0)
+	for rows.Next() {
+		var user auth.User
+		var role string
+		if err := rows.Scan(&user.ID, &user.Username, &role, &user.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		user.Role = auth.Role(role)
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %w", err)
+	}
+	return users, nil
+}
+
+func (d *Database) UpdateUser(user *auth.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx,
+		"UPDATE users SET password_hash = $2, role = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1",
+		user.ID, user.PasswordHash, string(user.Role),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return auth.ErrUserNotFound
+	}
+	return nil
+}
+
+func (d *Database) DeleteUser(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return auth.ErrUserNotFound
+	}
+	return nil
+}
+
+func (d *Database) CreateSession(session *auth.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
+		"INSERT INTO sessions (token_hash, user_id, csrf_token, created_at, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		session.TokenHash, session.UserID, session.CSRFToken, session.CreatedAt, session.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) GetSession(tokenHash string) (*auth.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	session := auth.Session{TokenHash: tokenHash}
+	err := d.db.QueryRowContext(ctx,
+		"SELECT user_id, csrf_token, created_at, expires_at FROM sessions WHERE token_hash = $1", tokenHash,
+	).Scan(&session.UserID, &session.CSRFToken, &session.CreatedAt, &session.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return &session, nil
+}
+
+func (d *Database) DeleteSession(tokenHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx, "DELETE FROM sessions WHERE token_hash = $1", tokenHash); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions ends every session of a user except the one with
+// exceptTokenHash, which may be empty.
+func (d *Database) DeleteUserSessions(userID int64, exceptTokenHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1 AND token_hash <> $2", userID, exceptTokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to delete user sessions: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) DeleteExpiredSessions(now time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at <= $1", now); err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) DeleteAllSessions() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx, "DELETE FROM sessions"); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) CreateToken(token *auth.APIToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var createdBy sql.NullInt64
+	if token.CreatedBy > 0 {
+		createdBy = sql.NullInt64{Int64: token.CreatedBy, Valid: true}
+	}
+	err := d.db.QueryRowContext(ctx, `
+		INSERT INTO api_tokens (name, secret_hash, prefix, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		token.Name, token.SecretHash, token.Prefix, pq.Array(scopeStrings(token.Scopes)), createdBy, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API token: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) GetTokenByHash(secretHash string) (*auth.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := d.db.QueryRowContext(ctx, `
+		SELECT id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at
+		FROM api_tokens WHERE secret_hash = $1`, secretHash)
+	token, err := scanToken(row)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	token.SecretHash = secretHash
+	return token, nil
+}
+
+func (d *Database) ListTokens() ([]auth.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at
+		FROM api_tokens ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := make([]auth.APIToken, 0)
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API token row: %w", err)
+		}
+		tokens = append(tokens, *token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating API tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (d *Database) UpdateTokenSecret(id int64, secretHash, prefix string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx,
+		"UPDATE api_tokens SET secret_hash = $2, prefix = $3, last_used_at = NULL WHERE id = $1",
+		id, secretHash, prefix,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to rotate API token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return auth.ErrTokenNotFound
+	}
+	return nil
+}
+
+func (d *Database) TouchToken(id int64, usedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = $2 WHERE id = $1", id, usedAt); err != nil {
+		return fmt.Errorf("failed to update API token: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) DeleteToken(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return auth.ErrTokenNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row rowScanner) (*auth.APIToken, error) {
+	var token auth.APIToken
+	var scopes []string
+	var createdBy sql.NullInt64
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&token.ID, &token.Name, &token.Prefix, pq.Array(&scopes), &createdBy,
+		&token.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		token.Scopes = append(token.Scopes, auth.Scope(scope))
+	}
+	token.CreatedBy = createdBy.Int64
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return &token, nil
+}
+
+func scopeStrings(scopes []auth.Scope) []string {
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return values
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/audit"
+)
+
+func (d *Database) AppendAuditRecord(record *audit.Record) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx,
+		"INSERT INTO audit_log (seq, payload, prev_hash, hash) VALUES ($1, $2, $3, $4)",
+		record.Seq, record.Payload, record.PrevHash, record.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) LastAuditRecord() (*audit.Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var record audit.Record
+	err := d.db.QueryRowContext(ctx,
+		"SELECT seq, payload, prev_hash, hash FROM audit_log ORDER BY seq DESC LIMIT 1",
+	).Scan(&record.Seq, &record.Payload, &record.PrevHash, &record.Hash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last audit entry: %w", err)
+	}
+	return &record, nil
+}
+
+func (d *Database) ListAuditRecords(afterSeq int64, limit int) ([]audit.Record, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx,
+		"SELECT seq, payload, prev_hash, hash FROM audit_log WHERE seq > $1 ORDER BY seq LIMIT $2",
+		afterSeq, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	records := []audit.Record{}
+	for rows.Next() {
+		var record audit.Record
+		if err := rows.Scan(&record.Seq, &record.Payload, &record.PrevHash, &record.Hash); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
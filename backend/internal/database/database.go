@@ -8,13 +8,22 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
 	_ "github.com/lib/pq"
 )
 
 type Database struct {
-	db *sql.DB
+	db     *sql.DB
+	fields *security.DataEncryption
 }
 
+// fieldEncryptionMarker records that EncryptExistingFields has run. The
+// system_ prefix keeps it across ClearUserSettings.
+const (
+	fieldEncryptionMarker  = "system_field_encryption"
+	fieldEncryptionVersion = "v1"
+)
+
 type Torrent struct {
 	InfoHash     string    `json:"infoHash"`
 	Name         string    `json:"name"`
@@ -64,6 +73,25 @@ func boundedEnvInt(key string, fallback, minimum, maximum int) int {
 	return value
 }
 
+// SetFieldEncryption enables transparent encryption of sensitive settings
+// and torrent names.
+func (d *Database) SetFieldEncryption(fields *security.DataEncryption) {
+	d.fields = fields
+}
+
+// sealSetting encrypts value when key is marked sensitive.
+func (d *Database) sealSetting(key, value string) (string, error) {
+	if !security.IsSensitiveSetting(key) {
+		return value, nil
+	}
+	return d.fields.SealField(value)
+}
+
+// Stats reports connection pool statistics.
+func (d *Database) Stats() sql.DBStats {
+	return d.db.Stats()
+}
+
 func (d *Database) Close() error {
 	return d.db.Close()
 }
@@ -83,6 +111,11 @@ func (d *Database) SaveTorrent(t *Torrent) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	name, err := d.fields.SealField(t.Name)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt torrent name: %w", err)
+	}
+
 	query := `
 		INSERT INTO active_torrents 
 		(info_hash, name, total_size, downloaded, uploaded, download_rate, upload_rate, progress, status, magnet_uri)
@@ -96,7 +129,7 @@ func (d *Database) SaveTorrent(t *Torrent) error {
 			status = EXCLUDED.status,
 			updated_at = CURRENT_TIMESTAMP
 	`
-	_, err := d.db.ExecContext(ctx, query, t.InfoHash, t.Name, t.TotalSize, t.Downloaded,
+	_, err = d.db.ExecContext(ctx, query, t.InfoHash, name, t.TotalSize, t.Downloaded,
 		t.Uploaded, t.DownloadRate, t.UploadRate, t.Progress, t.Status, "")
 	if err != nil {
 		return fmt.Errorf("failed to save torrent: %w", err)
@@ -131,6 +164,9 @@ func (d *Database) GetAllTorrents() ([]Torrent, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan torrent row: %w", err)
 		}
+		if t.Name, err = d.fields.OpenField(t.Name); err != nil {
+			return nil, fmt.Errorf("failed to decrypt torrent name: %w", err)
+		}
 		torrents = append(torrents, t)
 	}
 
@@ -164,6 +200,10 @@ func (d *Database) GetSetting(key string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to get setting %s: %w", key, err)
 	}
+	value, err = d.fields.OpenField(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt setting %s: %w", key, err)
+	}
 	return value, nil
 }
 
@@ -171,13 +211,18 @@ func (d *Database) SetSetting(key, value string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	value, err := d.sealSetting(key, value)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt setting %s: %w", key, err)
+	}
+
 	query := `
 		INSERT INTO settings (key, value) VALUES ($1, $2)
 		ON CONFLICT (key) DO UPDATE SET 
 			value = EXCLUDED.value, 
 			updated_at = CURRENT_TIMESTAMP
 	`
-	_, err := d.db.ExecContext(ctx, query, key, value)
+	_, err = d.db.ExecContext(ctx, query, key, value)
 	if err != nil {
 		return fmt.Errorf("failed to set setting %s: %w", key, err)
 	}
@@ -206,3 +251,123 @@ func (d *Database) ClearAllSettings() error {
 	}
 	return nil
 }
+
+// EncryptExistingFields encrypts sensitive settings, torrent names and feed
+// item titles that were stored before field encryption was available. It runs once per
+// installation; later calls return immediately.
+func (d *Database) EncryptExistingFields() (int, error) {
+	if d.fields == nil {
+		return 0, nil
+	}
+	if done, err := d.GetSetting(fieldEncryptionMarker); err != nil || done == fieldEncryptionVersion {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin field encryption migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	updates := make(map[string]string)
+	rows, err := tx.QueryContext(ctx, "SELECT key, value FROM settings WHERE value IS NOT NULL")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query settings: %w", err)
+	}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan setting row: %w", err)
+		}
+		if security.IsSensitiveSetting(key) && value != "" && !security.IsEncryptedRecord(value) {
+			updates[key] = value
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating settings: %w", err)
+	}
+
+	names := make(map[string]string)
+	rows, err = tx.QueryContext(ctx, "SELECT info_hash, name FROM active_torrents WHERE name IS NOT NULL AND name <> ''")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query torrents: %w", err)
+	}
+	for rows.Next() {
+		var infoHash, name string
+		if err := rows.Scan(&infoHash, &name); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan torrent row: %w", err)
+		}
+		if !security.IsEncryptedRecord(name) {
+			names[infoHash] = name
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating torrents: %w", err)
+	}
+
+	titles := make(map[int64]string)
+	rows, err = tx.QueryContext(ctx, "SELECT id, title FROM feed_history WHERE title <> ''")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query feed history: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan feed history row: %w", err)
+		}
+		if !security.IsEncryptedRecord(title) {
+			titles[id] = title
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating feed history: %w", err)
+	}
+
+	for key, value := range updates {
+		sealed, err := d.fields.SealField(value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt setting %s: %w", key, err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE settings SET value = $2, updated_at = CURRENT_TIMESTAMP WHERE key = $1", key, sealed); err != nil {
+			return 0, fmt.Errorf("failed to update setting %s: %w", key, err)
+		}
+	}
+	for infoHash, name := range names {
+		sealed, err := d.fields.SealField(name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt torrent name: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE active_torrents SET name = $2 WHERE info_hash = $1", infoHash, sealed); err != nil {
+			return 0, fmt.Errorf("failed to update torrent name: %w", err)
+		}
+	}
+	for id, title := range titles {
+		sealed, err := d.fields.SealField(title)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt feed item title: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE feed_history SET title = $2 WHERE id = $1", id, sealed); err != nil {
+			return 0, fmt.Errorf("failed to update feed item title: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO settings (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+	`, fieldEncryptionMarker, fieldEncryptionVersion); err != nil {
+		return 0, fmt.Errorf("failed to record field encryption migration: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit field encryption migration: %w", err)
+	}
+	return len(updates) + len(names) + len(titles), nil
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/lib/pq"
+)
+
+func (d *Database) AddSecurityEvent(event *security.SecurityEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := d.db.QueryRowContext(ctx,
+		"INSERT INTO security_events (type, severity, message, details, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		event.Type, event.Severity, event.Message, event.Details, event.Timestamp,
+	).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to add security event: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) ListSecurityEvents(filter security.EventFilter) ([]security.SecurityEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if len(filter.Severities) > 0 {
+		where = append(where, "severity = ANY("+arg(pq.Array(filter.Severities))+")")
+	}
+	if len(filter.Types) > 0 {
+		where = append(where, "type = ANY("+arg(pq.Array(filter.Types))+")")
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "created_at <= "+arg(filter.Until))
+	}
+	if filter.Unacknowledged {
+		where = append(where, "acknowledged_at IS NULL")
+	}
+	if filter.Before > 0 {
+		where = append(where, "id < "+arg(filter.Before))
+	}
+	query := "SELECT id, type, severity, message, details, created_at, acknowledged_at FROM security_events"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT " + arg(filter.PageSize())
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query security events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []security.SecurityEvent{}
+	for rows.Next() {
+		var event security.SecurityEvent
+		var acknowledgedAt sql.NullTime
+		if err := rows.Scan(&event.ID, &event.Type, &event.Severity, &event.Message, &event.Details, &event.Timestamp, &acknowledgedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan security event: %w", err)
+		}
+		if acknowledgedAt.Valid {
+			event.Acknowledged = true
+			event.AcknowledgedAt = &acknowledgedAt.Time
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (d *Database) AcknowledgeSecurityEvents(ids []int64, at time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := "UPDATE security_events SET acknowledged_at = $1 WHERE acknowledged_at IS NULL"
+	args := []interface{}{at}
+	if len(ids) > 0 {
+		query += " AND id = ANY($2)"
+		args = append(args, pq.Array(ids))
+	}
+	result, err := d.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acknowledge security events: %w", err)
+	}
+	count, _ := result.RowsAffected()
+	return int(count), nil
+}
+
+func (d *Database) PruneSecurityEvents(olderThan time.Time, keep int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx, "DELETE FROM security_events WHERE created_at < $1", olderThan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune security events: %w", err)
+	}
+	pruned, _ := result.RowsAffected()
+	if keep > 0 {
+		result, err = d.db.ExecContext(ctx,
+			"DELETE FROM security_events WHERE id <= (SELECT id FROM security_events ORDER BY id DESC OFFSET $1 LIMIT 1)",
+			keep,
+		)
+		if err != nil {
+			return int(pruned), fmt.Errorf("failed to prune security events: %w", err)
+		}
+		extra, _ := result.RowsAffected()
+		pruned += extra
+	}
+	return int(pruned), nil
+}
+
+func (d *Database) ClearSecurityEvents() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := d.db.ExecContext(ctx, "TRUNCATE TABLE security_events"); err != nil {
+		return fmt.Errorf("failed to clear security events: %w", err)
+	}
+	return nil
+}
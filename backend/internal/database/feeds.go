@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/feeds"
+)
+
+func (d *Database) AddFeedHistory(item *feeds.HistoryItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	title, err := d.fields.SealField(item.Title)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt feed item title: %w", err)
+	}
+	err = d.db.QueryRowContext(ctx,
+		`INSERT INTO feed_history (feed_id, rule_id, title, item_key, info_hash, status, error, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+		item.FeedID, item.RuleID, title, item.Key, item.InfoHash, item.Status, item.Error, item.At,
+	).Scan(&item.ID)
+	if err != nil {
+		return fmt.Errorf("failed to add feed history: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) ListFeedHistory(feedID string, limit int) ([]feeds.HistoryItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, feed_id, rule_id, title, info_hash, status, error, created_at FROM feed_history
+		WHERE $1 = '' OR feed_id = $1 ORDER BY id DESC LIMIT $2`,
+		feedID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feed history: %w", err)
+	}
+	defer rows.Close()
+
+	items := []feeds.HistoryItem{}
+	for rows.Next() {
+		var item feeds.HistoryItem
+		if err := rows.Scan(&item.ID, &item.FeedID, &item.RuleID, &item.Title, &item.InfoHash, &item.Status, &item.Error, &item.At); err != nil {
+			return nil, fmt.Errorf("failed to scan feed history: %w", err)
+		}
+		if item.Title, err = d.fields.OpenField(item.Title); err != nil {
+			return nil, fmt.Errorf("failed to decrypt feed item title: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (d *Database) HasFeedHistory(key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var found bool
+	err := d.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM feed_history WHERE item_key = $1)", key).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("failed to query feed history: %w", err)
+	}
+	return found, nil
+}
+
+func (d *Database) FeedHistoryKeys() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, "SELECT item_key, feed_id FROM feed_history")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feed history: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[string]string)
+	for rows.Next() {
+		var key, feedID string
+		if err := rows.Scan(&key, &feedID); err != nil {
+			return nil, fmt.Errorf("failed to scan feed history: %w", err)
+		}
+		keys[key] = feedID
+	}
+	return keys, rows.Err()
+}
+
+func (d *Database) ClearFeedHistory(feedID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := d.db.ExecContext(ctx, "DELETE FROM feed_history WHERE $1 = '' OR feed_id = $1", feedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear feed history: %w", err)
+	}
+	count, _ := result.RowsAffected()
+	return int(count), nil
+}
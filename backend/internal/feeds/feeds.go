@@ -0,0 +1,263 @@
+// Package feeds follows RSS and Atom feeds and adds the items that match
+// their rules.
+//
+// Feeds are fetched through the torrent client's HTTP client, so through the
+// proxy chain when one is configured. Items are matched against each feed's
+// rules in order; the first enabled rule whose include pattern matches and
+// whose exclude pattern does not picks the item, and its category and save
+// path, or the feed's, are used to add it. Items that name an episode
+// ("Show S01E02", "Show 1x02" or "Show 2024.01.02") are added once per
+// episode across all feeds, whatever release they come from; others once
+// per GUID.
+//
+// Feeds and rules are kept in a settings row, encrypted at rest once the
+// keyring exists. Matched items are recorded in a history, except in no-logs
+// mode, where nothing about them outlives the process.
+package feeds
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SettingKey is the settings row feeds and their rules are stored in. The
+// rss_ prefix marks it sensitive: feed URLs often carry private passkeys.
+const SettingKey = "rss_feeds"
+
+// Feed intervals, in minutes.
+const (
+	DefaultInterval = 30
+	MinInterval     = 5
+	MaxInterval     = 24 * 60
+)
+
+const (
+	maxFeeds         = 100
+	maxRulesPerFeed  = 100
+	maxPatternLength = 1000
+)
+
+var (
+	ErrFeedNotFound = errors.New("feed not found")
+	ErrRuleNotFound = errors.New("rule not found")
+	// ErrInvalid wraps every validation error.
+	ErrInvalid = errors.New("invalid feed")
+)
+
+// Feed is a subscription.
+type Feed struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// IntervalMinutes is how often the feed is fetched.
+	IntervalMinutes int    `json:"intervalMinutes"`
+	Category        string `json:"category,omitempty"`
+	SavePath        string `json:"savePath,omitempty"`
+	Disabled        bool   `json:"disabled,omitempty"`
+	Rules           []Rule `json:"rules"`
+	// Status is reported by the API and never stored.
+	Status *FeedStatus `json:"status,omitempty"`
+}
+
+// FeedStatus describes the last fetch of a feed.
+type FeedStatus struct {
+	LastChecked *time.Time `json:"lastChecked,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	Items       int        `json:"items"`
+	Added       int        `json:"added"`
+}
+
+// Rule selects items of a feed. Patterns are regular expressions matched
+// case-insensitively against item titles; an empty include matches every
+// item. Category and SavePath override the feed's when set.
+type Rule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Include  string `json:"include"`
+	Exclude  string `json:"exclude,omitempty"`
+	Category string `json:"category,omitempty"`
+	SavePath string `json:"savePath,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+// Match reports whether the rule picks an item titled title.
+func (r *Rule) Match(title string) bool {
+	if r.Disabled {
+		return false
+	}
+	if r.include != nil && !r.include.MatchString(title) {
+		return false
+	}
+	return r.exclude == nil || !r.exclude.MatchString(title)
+}
+
+// HistoryItem is an item a rule matched.
+type HistoryItem struct {
+	ID     int64  `json:"id"`
+	FeedID string `json:"feedId"`
+	RuleID string `json:"ruleId"`
+	Title  string `json:"title"`
+	// Key is the SHA-256 of the item's deduplication key.
+	Key      string    `json:"-"`
+	InfoHash string    `json:"infoHash,omitempty"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// History statuses.
+const (
+	StatusAdded  = "added"
+	StatusFailed = "failed"
+)
+
+// HistoryStore persists matched items. ListFeedHistory returns the newest
+// items first, of every feed when feedID is empty, and ClearFeedHistory
+// likewise clears one feed or all of them.
+type HistoryStore interface {
+	AddFeedHistory(item *HistoryItem) error
+	ListFeedHistory(feedID string, limit int) ([]HistoryItem, error)
+	HasFeedHistory(key string) (bool, error)
+	// FeedHistoryKeys maps the key of every recorded item to its feed.
+	FeedHistoryKeys() (map[string]string, error)
+	ClearFeedHistory(feedID string) (int, error)
+}
+
+type settingsStore interface {
+	GetSetting(key string) (string, error)
+	SetSetting(key, value string) error
+}
+
+// prepare validates a feed and fills in defaults.
+func (f *Feed) prepare() error {
+	f.Name = strings.TrimSpace(f.Name)
+	f.URL = strings.TrimSpace(f.URL)
+	u, err := url.Parse(f.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an http or https URL", ErrInvalid)
+	}
+	if f.Name == "" {
+		f.Name = u.Hostname()
+	}
+	if len(f.Name) > 128 {
+		return fmt.Errorf("%w: name is longer than 128 characters", ErrInvalid)
+	}
+	if f.IntervalMinutes == 0 {
+		f.IntervalMinutes = DefaultInterval
+	}
+	if f.IntervalMinutes < MinInterval || f.IntervalMinutes > MaxInterval {
+		return fmt.Errorf("%w: intervalMinutes must be between %d and %d", ErrInvalid, MinInterval, MaxInterval)
+	}
+	if len(f.Rules) > maxRulesPerFeed {
+		return fmt.Errorf("%w: a feed has at most %d rules", ErrInvalid, maxRulesPerFeed)
+	}
+	for i := range f.Rules {
+		if err := f.Rules[i].prepare(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateFeeds checks a stored feed list, such as one being imported, the
+// way CreateFeed checks a new feed.
+func ValidateFeeds(value string) error {
+	var feeds []Feed
+	if err := json.Unmarshal([]byte(value), &feeds); err != nil {
+		return fmt.Errorf("%w: feeds must be a list of feeds", ErrInvalid)
+	}
+	if len(feeds) > maxFeeds {
+		return fmt.Errorf("%w: at most %d feeds can be followed", ErrInvalid, maxFeeds)
+	}
+	ids := make(map[string]bool, len(feeds))
+	for _, feed := range feeds {
+		if feed.ID == "" || ids[feed.ID] {
+			return fmt.Errorf("%w: every feed needs a unique id", ErrInvalid)
+		}
+		ids[feed.ID] = true
+		if err := feed.prepare(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepare validates a rule and compiles its patterns.
+func (r *Rule) prepare() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.ID == "" {
+		r.ID = newID()
+	}
+	var err error
+	if r.include, err = compile("include", r.Include); err != nil {
+		return err
+	}
+	if r.exclude, err = compile("exclude", r.Exclude); err != nil {
+		return err
+	}
+	return nil
+}
+
+func compile(field, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	if len(pattern) > maxPatternLength {
+		return nil, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalid, field, maxPatternLength)
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalid, field, err)
+	}
+	return re, nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// loadFeeds reads the stored feeds. Rules that no longer compile are kept
+// but disabled.
+func loadFeeds(settings settingsStore) ([]Feed, error) {
+	value, err := settings.GetSetting(SettingKey)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	var feeds []Feed
+	if err := json.Unmarshal([]byte(value), &feeds); err != nil {
+		return nil, fmt.Errorf("failed to read feeds: %w", err)
+	}
+	for i := range feeds {
+		for j := range feeds[i].Rules {
+			if err := feeds[i].Rules[j].prepare(); err != nil {
+				feeds[i].Rules[j].Disabled = true
+			}
+		}
+	}
+	return feeds, nil
+}
+
+func saveFeeds(settings settingsStore, feeds []Feed) error {
+	stored := make([]Feed, len(feeds))
+	for i, feed := range feeds {
+		feed.Status = nil
+		stored[i] = feed
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return settings.SetSetting(SettingKey, string(data))
+}
@@ -0,0 +1,340 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings/settingstest"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent/torrenttest"
+	"go.uber.org/zap"
+)
+
+const rssFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torznab="http://torznab.com/schemas/2015/feed">
+<channel>
+  <title>Releases</title>
+  <item>
+    <title>Show.Name.S01E02.720p.WEB</title>
+    <guid>one</guid>
+    <link>https://example.com/details/1</link>
+    <torznab:attr name="magneturl" value="magnet:?xt=urn:btih:aaaa"/>
+  </item>
+  <item>
+    <title>Show Name S01E02 1080p</title>
+    <guid>two</guid>
+    <enclosure url="magnet:?xt=urn:btih:bbbb" type="application/x-bittorrent"/>
+  </item>
+  <item>
+    <title>Show.Name.S01E03.CAM</title>
+    <guid>three</guid>
+    <link>magnet:?xt=urn:btih:cccc</link>
+  </item>
+  <item>
+    <title>Other Show 2x05</title>
+    <guid>four</guid>
+    <enclosure url="%s/files/other.torrent" type="application/x-bittorrent"/>
+  </item>
+  <item>
+    <title>No link</title>
+    <guid>five</guid>
+    <link>https://example.com/details/5</link>
+  </item>
+</channel>
+</rss>`
+
+type memoryHistory struct {
+	mu    sync.Mutex
+	items []HistoryItem
+}
+
+func (h *memoryHistory) AddFeedHistory(item *HistoryItem) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	item.ID = int64(len(h.items) + 1)
+	h.items = append(h.items, *item)
+	return nil
+}
+
+func (h *memoryHistory) ListFeedHistory(feedID string, limit int) ([]HistoryItem, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	items := []HistoryItem{}
+	for i := len(h.items) - 1; i >= 0 && len(items) < limit; i-- {
+		if feedID == "" || h.items[i].FeedID == feedID {
+			items = append(items, h.items[i])
+		}
+	}
+	return items, nil
+}
+
+func (h *memoryHistory) HasFeedHistory(key string) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, item := range h.items {
+		if item.Key == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (h *memoryHistory) FeedHistoryKeys() (map[string]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make(map[string]string, len(h.items))
+	for _, item := range h.items {
+		keys[item.Key] = item.FeedID
+	}
+	return keys, nil
+}
+
+func (h *memoryHistory) ClearFeedHistory(feedID string) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	kept := h.items[:0]
+	for _, item := range h.items {
+		if feedID != "" && item.FeedID != feedID {
+			kept = append(kept, item)
+		}
+	}
+	cleared := len(h.items) - len(kept)
+	h.items = kept
+	return cleared, nil
+}
+
+func feedServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var fetches atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			fetches.Add(1)
+			fmt.Fprintf(w, rssFeed, server.URL)
+		case "/files/other.torrent":
+			w.Write([]byte("d4:infod4:name3:abcee"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &fetches
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestParse(t *testing.T) {
+	items, err := Parse([]byte(fmt.Sprintf(rssFeed, "https://tracker.example")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Item{
+		{Title: "Show.Name.S01E02.720p.WEB", GUID: "one", Link: "magnet:?xt=urn:btih:aaaa"},
+		{Title: "Show Name S01E02 1080p", GUID: "two", Link: "magnet:?xt=urn:btih:bbbb"},
+		{Title: "Show.Name.S01E03.CAM", GUID: "three", Link: "magnet:?xt=urn:btih:cccc"},
+		{Title: "Other Show 2x05", GUID: "four", Link: "https://tracker.example/files/other.torrent"},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("items = %+v", items)
+	}
+	for i := range want {
+		if items[i] != want[i] {
+			t.Errorf("item %d = %+v, want %+v", i, items[i], want[i])
+		}
+	}
+
+	atom := `<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry><title>Daily Show 2024.03.05</title><id>urn:1</id>
+    <link rel="alternate" href="https://example.com/1"/>
+    <link rel="enclosure" type="application/x-bittorrent" href="https://example.com/1.torrent"/>
+  </entry>
+</feed>`
+	items, err = Parse([]byte(atom))
+	if err != nil || len(items) != 1 || items[0].Link != "https://example.com/1.torrent" || items[0].GUID != "urn:1" {
+		t.Fatalf("atom items = %+v, %v", items, err)
+	}
+
+	if _, err := Parse([]byte("<html><body>login</body></html>")); err == nil {
+		t.Error("expected an HTML page to be rejected")
+	}
+}
+
+func TestEpisodeKey(t *testing.T) {
+	for title, want := range map[string]string{
+		"Show.Name.S01E02.720p.WEB":      "show name|s01e02",
+		"Show Name - s1e2 [1080p]":       "show name|s01e02",
+		"Show Name S01E02E03 Proper":     "show name|s01e02",
+		"Show_Name 1x02 HDTV":            "show name|s01e02",
+		"The Daily Show 2024.03.05 720p": "the daily show|2024-03-05",
+	} {
+		if got, ok := EpisodeKey(title); !ok || got != want {
+			t.Errorf("EpisodeKey(%q) = %q, %v; want %q", title, got, ok, want)
+		}
+	}
+	for _, title := range []string{"Ubuntu 24.04 Desktop amd64", "S01E02", "Movie 1080p x264"} {
+		if key, ok := EpisodeKey(title); ok {
+			t.Errorf("EpisodeKey(%q) = %q, want none", title, key)
+		}
+	}
+}
+
+func TestManagerAddsMatchesOncePerEpisode(t *testing.T) {
+	server, fetches := feedServer(t)
+	settings := &settingstest.Store{}
+	history := &memoryHistory{}
+	adder := &torrenttest.Adder{FileInfoHash: "dddd"}
+	m := NewManager(settings, history, adder, server.Client(), func() bool { return false }, zap.NewNop())
+	t.Cleanup(func() { m.Shutdown(context.Background()) })
+
+	feed, err := m.CreateFeed(Feed{
+		URL:      server.URL + "/feed.xml",
+		Category: "tv",
+		Rules: []Rule{
+			{Name: "show", Include: `show\.?name`, Exclude: `\bcam\b`, SavePath: "shows"},
+			{Name: "other", Include: "other show"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first fetch", func() bool { return adder.Added() == 2 })
+
+	if magnets, files := adder.Magnets(), adder.Files(); magnets[0] != "magnet:?xt=urn:btih:aaaa" || files[0] != "d4:infod4:name3:abcee" {
+		t.Errorf("added magnets %v, files %v", magnets, files)
+	}
+	if opts := adder.Options(); opts[0] != (torrent.AddOptions{Category: "tv", SavePath: "shows"}) || opts[1] != (torrent.AddOptions{Category: "tv"}) {
+		t.Errorf("options = %+v", opts)
+	}
+
+	items, err := m.History("", 0)
+	if err != nil || len(items) != 2 || items[0].Title != "Other Show 2x05" || items[1].InfoHash != "aaaa" || items[1].RuleID != feed.Rules[0].ID {
+		t.Fatalf("history = %+v, %v", items, err)
+	}
+
+	// A new manager remembers what was added through the history.
+	m.Shutdown(context.Background())
+	adder = &torrenttest.Adder{FileInfoHash: "dddd"}
+	m = NewManager(settings, history, adder, server.Client(), func() bool { return false }, zap.NewNop())
+	before := fetches.Load()
+	if err := m.Refresh(feed.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the second fetch", func() bool {
+		feed, err := m.Feed(feed.ID)
+		return err == nil && feed.Status != nil && fetches.Load() > before
+	})
+	if adder.Added() != 0 {
+		t.Fatalf("items were added again: %v %v", adder.Magnets(), adder.Files())
+	}
+
+	if cleared, err := m.ClearHistory(feed.ID); err != nil || cleared != 2 {
+		t.Fatalf("ClearHistory = %d, %v", cleared, err)
+	}
+	m.Refresh(feed.ID)
+	waitFor(t, "the fetch after clearing", func() bool { return adder.Added() == 2 })
+}
+
+func TestNoLogsModeKeepsNoHistory(t *testing.T) {
+	server, _ := feedServer(t)
+	history := &memoryHistory{}
+	adder := &torrenttest.Adder{FileInfoHash: "dddd"}
+	m := NewManager(&settingstest.Store{}, history, adder, server.Client(), func() bool { return true }, zap.NewNop())
+	t.Cleanup(func() { m.Shutdown(context.Background()) })
+
+	feed, err := m.CreateFeed(Feed{URL: server.URL + "/feed.xml", Rules: []Rule{{Include: "show"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first fetch", func() bool { return adder.Added() == 3 })
+	m.Refresh(feed.ID)
+	time.Sleep(50 * time.Millisecond)
+
+	if adder.Added() != 3 {
+		t.Fatalf("added %d items, want each episode once", adder.Added())
+	}
+	if len(history.items) != 0 {
+		t.Fatalf("history was recorded in no-logs mode: %+v", history.items)
+	}
+	if items, err := m.History("", 0); err != nil || len(items) != 0 || m.HistoryEnabled() {
+		t.Fatalf("History = %+v, %v", items, err)
+	}
+}
+
+func TestHistoryLeavesDiskInNoLogsMode(t *testing.T) {
+	server, fetches := feedServer(t)
+	history := &memoryHistory{}
+	adder := &torrenttest.Adder{FileInfoHash: "dddd"}
+	var noLogs atomic.Bool
+	m := NewManager(&settingstest.Store{}, history, adder, server.Client(), noLogs.Load, zap.NewNop())
+	t.Cleanup(func() { m.Shutdown(context.Background()) })
+
+	feed, err := m.CreateFeed(Feed{URL: server.URL + "/feed.xml", Rules: []Rule{{Include: "show"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first fetch", func() bool { return adder.Added() == 3 })
+
+	noLogs.Store(true)
+	if err := m.KeepHistoryInMemory(); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.items) != 0 {
+		t.Fatalf("history left on disk: %+v", history.items)
+	}
+	before := fetches.Load()
+	m.Refresh(feed.ID)
+	waitFor(t, "the second fetch", func() bool { return fetches.Load() > before })
+	time.Sleep(50 * time.Millisecond)
+	if adder.Added() != 3 {
+		t.Fatalf("added %d items, want the earlier matches remembered", adder.Added())
+	}
+
+	if err := m.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	m.Refresh(feed.ID)
+	waitFor(t, "the fetch after clearing", func() bool { return adder.Added() == 6 })
+}
+
+func TestFeedValidation(t *testing.T) {
+	m := NewManager(&settingstest.Store{}, nil, &torrenttest.Adder{FileInfoHash: "dddd"}, http.DefaultClient, func() bool { return false }, zap.NewNop())
+	t.Cleanup(func() { m.Shutdown(context.Background()) })
+
+	for _, feed := range []Feed{
+		{URL: "ftp://example.com/feed"},
+		{URL: "https://example.com/feed", IntervalMinutes: 1},
+		{URL: "https://example.com/feed", Rules: []Rule{{Include: "(unclosed"}}},
+	} {
+		if _, err := m.CreateFeed(feed); !errors.Is(err, ErrInvalid) {
+			t.Errorf("CreateFeed(%+v) err = %v", feed, err)
+		}
+	}
+	if _, err := m.AddRule("missing", Rule{}); !errors.Is(err, ErrFeedNotFound) {
+		t.Errorf("AddRule err = %v", err)
+	}
+
+	feed, err := m.CreateFeed(Feed{URL: "https://example.com/feed?passkey=secret", Disabled: true})
+	if err != nil || feed.Name != "example.com" || feed.IntervalMinutes != DefaultInterval {
+		t.Fatalf("feed = %+v, %v", feed, err)
+	}
+	if err := m.DeleteRule(feed.ID, "missing"); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("DeleteRule err = %v", err)
+	}
+}
@@ -0,0 +1,641 @@
+package feeds
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultHistoryLimit = 100
+	MaxHistoryLimit     = 1000
+	maxFeedSize         = 5 << 20
+)
+
+// tickInterval is how often feeds are checked for being due.
+var tickInterval = time.Minute
+
+// fetchError marks a failure to download a feed or a .torrent file. Items
+// that fail this way are retried on the next fetch instead of recorded.
+type fetchError struct{ err error }
+
+func (e fetchError) Error() string { return e.err.Error() }
+func (e fetchError) Unwrap() error { return e.err }
+
+// Manager keeps the feed configuration and fetches due feeds in the
+// background until it is shut down.
+//
+// The feeds are stored encrypted, so after a restart they cannot be read
+// until the keyring is unlocked. Until then no feed is polled and every
+// call that needs them returns security.ErrKeyringLocked; nothing falls back
+// to an empty feed list that a later save could write over the stored one.
+type Manager struct {
+	mu sync.Mutex
+	// loaded is set once the stored feeds were read, which needs an
+	// unlocked keyring once they are encrypted.
+	loaded bool
+	feeds  []Feed
+	status map[string]*FeedStatus
+	// seen holds the deduplication keys matched since start, with the feed
+	// that matched them. It is all there is of the history in no-logs mode.
+	seen map[string]string
+
+	settings settingsStore
+	history  HistoryStore
+	adder    torrent.Adder
+	client   *http.Client
+	noLogs   func() bool
+	logger   *zap.Logger
+	now      func() time.Time
+
+	refresh chan string
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewManager starts fetching the stored feeds with client. Feeds that
+// cannot be read yet, because the keyring is locked, are read once it is
+// unlocked.
+func NewManager(settings settingsStore, history HistoryStore, adder torrent.Adder, client *http.Client, noLogs func() bool, logger *zap.Logger) *Manager {
+	m := &Manager{
+		status:   make(map[string]*FeedStatus),
+		seen:     make(map[string]string),
+		settings: settings,
+		history:  history,
+		adder:    adder,
+		client:   client,
+		noLogs:   noLogs,
+		logger:   logger,
+		now:      time.Now,
+		refresh:  make(chan string, maxFeeds),
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	m.stop = stop
+	m.wg.Add(1)
+	go m.run(ctx)
+	return m
+}
+
+// Shutdown stops fetching and waits for the fetch in progress, if any.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.stop()
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Feeds returns every feed with its status.
+func (m *Manager) Feeds() ([]Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(); err != nil {
+		return nil, err
+	}
+	feeds := make([]Feed, len(m.feeds))
+	for i := range m.feeds {
+		feeds[i] = m.reportLocked(m.feeds[i])
+	}
+	return feeds, nil
+}
+
+// Feed returns one feed with its status.
+func (m *Manager) Feed(id string) (Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.findLocked(id)
+	if err != nil {
+		return Feed{}, err
+	}
+	return m.reportLocked(m.feeds[i]), nil
+}
+
+// CreateFeed validates and stores a new feed, with its rules, and fetches
+// it.
+func (m *Manager) CreateFeed(feed Feed) (Feed, error) {
+	feed.ID = newID()
+	feed.Status = nil
+	for i := range feed.Rules {
+		feed.Rules[i].ID = ""
+	}
+	if err := feed.prepare(); err != nil {
+		return Feed{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(); err != nil {
+		return Feed{}, err
+	}
+	if len(m.feeds) >= maxFeeds {
+		return Feed{}, fmt.Errorf("%w: at most %d feeds can be followed", ErrInvalid, maxFeeds)
+	}
+	if err := m.saveLocked(append(copyFeeds(m.feeds), feed)); err != nil {
+		return Feed{}, err
+	}
+	m.queue(feed.ID)
+	return m.reportLocked(feed), nil
+}
+
+// UpdateFeed replaces a feed's settings. Its rules are kept; they are
+// changed with AddRule, UpdateRule and DeleteRule.
+func (m *Manager) UpdateFeed(id string, feed Feed) (Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.findLocked(id)
+	if err != nil {
+		return Feed{}, err
+	}
+	feed.ID = id
+	feed.Status = nil
+	feed.Rules = m.feeds[i].Rules
+	if err := feed.prepare(); err != nil {
+		return Feed{}, err
+	}
+	feeds := copyFeeds(m.feeds)
+	feeds[i] = feed
+	if err := m.saveLocked(feeds); err != nil {
+		return Feed{}, err
+	}
+	return m.reportLocked(feed), nil
+}
+
+// DeleteFeed stops following a feed. Its history is kept until cleared.
+func (m *Manager) DeleteFeed(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.findLocked(id)
+	if err != nil {
+		return err
+	}
+	feeds := copyFeeds(m.feeds)
+	feeds = append(feeds[:i], feeds[i+1:]...)
+	if err := m.saveLocked(feeds); err != nil {
+		return err
+	}
+	delete(m.status, id)
+	return nil
+}
+
+// AddRule appends a rule to a feed.
+func (m *Manager) AddRule(feedID string, rule Rule) (Rule, error) {
+	rule.ID = ""
+	if err := rule.prepare(); err != nil {
+		return Rule{}, err
+	}
+	return rule, m.changeRules(feedID, func(rules []Rule) ([]Rule, error) {
+		if len(rules) >= maxRulesPerFeed {
+			return nil, fmt.Errorf("%w: a feed has at most %d rules", ErrInvalid, maxRulesPerFeed)
+		}
+		return append(rules, rule), nil
+	})
+}
+
+// UpdateRule replaces a rule of a feed.
+func (m *Manager) UpdateRule(feedID, ruleID string, rule Rule) (Rule, error) {
+	rule.ID = ruleID
+	if err := rule.prepare(); err != nil {
+		return Rule{}, err
+	}
+	return rule, m.changeRules(feedID, func(rules []Rule) ([]Rule, error) {
+		for i := range rules {
+			if rules[i].ID == ruleID {
+				rules[i] = rule
+				return rules, nil
+			}
+		}
+		return nil, ErrRuleNotFound
+	})
+}
+
+// DeleteRule removes a rule from a feed.
+func (m *Manager) DeleteRule(feedID, ruleID string) error {
+	return m.changeRules(feedID, func(rules []Rule) ([]Rule, error) {
+		for i := range rules {
+			if rules[i].ID == ruleID {
+				return append(rules[:i], rules[i+1:]...), nil
+			}
+		}
+		return nil, ErrRuleNotFound
+	})
+}
+
+func (m *Manager) changeRules(feedID string, change func([]Rule) ([]Rule, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.findLocked(feedID)
+	if err != nil {
+		return err
+	}
+	feeds := copyFeeds(m.feeds)
+	rules, err := change(feeds[i].Rules)
+	if err != nil {
+		return err
+	}
+	feeds[i].Rules = rules
+	return m.saveLocked(feeds)
+}
+
+// Refresh fetches a feed now rather than when it is next due.
+func (m *Manager) Refresh(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.findLocked(id); err != nil {
+		return err
+	}
+	m.queue(id)
+	return nil
+}
+
+// HistoryEnabled reports whether matched items are recorded; they are not
+// in no-logs mode.
+func (m *Manager) HistoryEnabled() bool {
+	return m.history != nil && !m.noLogs()
+}
+
+// History returns the newest matched items of a feed, or of every feed when
+// feedID is empty. Nothing is returned in no-logs mode.
+func (m *Manager) History(feedID string, limit int) ([]HistoryItem, error) {
+	if !m.HistoryEnabled() {
+		return []HistoryItem{}, nil
+	}
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+	return m.history.ListFeedHistory(feedID, limit)
+}
+
+// ClearHistory forgets the items matched from a feed, or from every feed
+// when feedID is empty, so that they can be matched again.
+func (m *Manager) ClearHistory(feedID string) (int, error) {
+	m.mu.Lock()
+	for key, id := range m.seen {
+		if feedID == "" || id == feedID {
+			delete(m.seen, key)
+		}
+	}
+	m.mu.Unlock()
+	if m.history == nil {
+		return 0, nil
+	}
+	return m.history.ClearFeedHistory(feedID)
+}
+
+// Clear forgets the whole history, in memory and on disk, so that nothing
+// shows which items were matched. It is part of the panic action.
+func (m *Manager) Clear() error {
+	_, err := m.ClearHistory("")
+	return err
+}
+
+// KeepHistoryInMemory moves the stored history into memory and deletes it
+// from disk, so that items added before no-logs mode was turned on are still
+// not added again while it is on.
+func (m *Manager) KeepHistoryInMemory() error {
+	if m.history == nil {
+		return nil
+	}
+	keys, err := m.history.FeedHistoryKeys()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	for key, feedID := range keys {
+		m.seen[key] = feedID
+	}
+	m.mu.Unlock()
+	_, err = m.history.ClearFeedHistory("")
+	return err
+}
+
+// Reset forgets every feed and the whole history. The stored feeds are
+// expected to have been deleted with the other settings.
+func (m *Manager) Reset() error {
+	m.mu.Lock()
+	m.feeds = nil
+	m.loaded = true
+	m.status = make(map[string]*FeedStatus)
+	m.mu.Unlock()
+	_, err := m.ClearHistory("")
+	return err
+}
+
+// Reload reads the stored feeds again on next use, after they were
+// replaced by a settings import.
+func (m *Manager) Reload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.feeds = nil
+	m.loaded = false
+}
+
+// queue asks the run goroutine to fetch a feed. The caller holds m.mu.
+func (m *Manager) queue(id string) {
+	select {
+	case m.refresh <- id:
+	default:
+	}
+}
+
+// loadLocked reads the stored feeds the first time it succeeds. The caller
+// holds m.mu.
+func (m *Manager) loadLocked() error {
+	if m.loaded {
+		return nil
+	}
+	feeds, err := loadFeeds(m.settings)
+	if err != nil {
+		return err
+	}
+	m.feeds = feeds
+	m.loaded = true
+	return nil
+}
+
+// findLocked loads the feeds and returns the index of one. The caller holds
+// m.mu.
+func (m *Manager) findLocked(id string) (int, error) {
+	if err := m.loadLocked(); err != nil {
+		return -1, err
+	}
+	if i := m.indexLocked(id); i >= 0 {
+		return i, nil
+	}
+	return -1, ErrFeedNotFound
+}
+
+func (m *Manager) indexLocked(id string) int {
+	for i := range m.feeds {
+		if m.feeds[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// reportLocked returns a copy of feed with its status attached.
+func (m *Manager) reportLocked(feed Feed) Feed {
+	feed.Rules = append([]Rule{}, feed.Rules...)
+	if status, ok := m.status[feed.ID]; ok {
+		copied := *status
+		feed.Status = &copied
+	}
+	return feed
+}
+
+func (m *Manager) saveLocked(feeds []Feed) error {
+	if err := saveFeeds(m.settings, feeds); err != nil {
+		return fmt.Errorf("failed to save feeds: %w", err)
+	}
+	m.feeds = feeds
+	return nil
+}
+
+// copyFeeds copies feeds deeply enough that their rules can be changed.
+func copyFeeds(feeds []Feed) []Feed {
+	copied := make([]Feed, len(feeds))
+	for i, feed := range feeds {
+		feed.Rules = append([]Rule{}, feed.Rules...)
+		copied[i] = feed
+	}
+	return copied
+}
+
+func (m *Manager) run(ctx context.Context) {
+	defer m.wg.Done()
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	m.pollDue(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-m.refresh:
+			m.poll(ctx, id)
+		case <-ticker.C:
+			m.pollDue(ctx)
+		}
+	}
+}
+
+func (m *Manager) pollDue(ctx context.Context) {
+	now := m.now()
+	var due []string
+	m.mu.Lock()
+	if err := m.loadLocked(); err != nil {
+		m.mu.Unlock()
+		m.logger.Debug("Feeds not polled until they can be read", zap.Error(err))
+		return
+	}
+	for _, feed := range m.feeds {
+		status := m.status[feed.ID]
+		interval := time.Duration(feed.IntervalMinutes) * time.Minute
+		if !feed.Disabled && (status == nil || status.LastChecked == nil || now.Sub(*status.LastChecked) >= interval) {
+			due = append(due, feed.ID)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, id := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		m.poll(ctx, id)
+	}
+}
+
+// poll fetches a feed and adds the items its rules match.
+func (m *Manager) poll(ctx context.Context, id string) {
+	m.mu.Lock()
+	i := m.indexLocked(id)
+	if i < 0 {
+		m.mu.Unlock()
+		return
+	}
+	feed := m.reportLocked(m.feeds[i])
+	m.mu.Unlock()
+
+	items, err := m.fetchFeed(ctx, feed.URL)
+	added := 0
+	if err == nil {
+		added, err = m.apply(ctx, feed, items)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	checked := m.now()
+	status := &FeedStatus{LastChecked: &checked, Items: len(items), Added: added}
+	if err != nil {
+		status.LastError = errorText(err)
+		m.logger.Warn("Feed fetch failed", zap.String("feed", feed.ID), zap.String("error", status.LastError))
+	} else if added > 0 {
+		m.logger.Info("Feed items added", zap.String("feed", feed.ID), zap.Int("added", added))
+	}
+	m.mu.Lock()
+	if m.indexLocked(id) >= 0 {
+		m.status[id] = status
+	}
+	m.mu.Unlock()
+}
+
+// apply adds the items the feed's rules match and have not been added yet.
+func (m *Manager) apply(ctx context.Context, feed Feed, items []Item) (int, error) {
+	added := 0
+	var failures []error
+	for _, item := range items {
+		rule := matchRule(feed.Rules, item.Title)
+		if rule == nil {
+			continue
+		}
+		key := hashKey(dedupeKey(feed.ID, item))
+		if m.matched(key) {
+			continue
+		}
+
+		opts := torrent.AddOptions{Category: feed.Category, SavePath: feed.SavePath}
+		if rule.Category != "" {
+			opts.Category = rule.Category
+		}
+		if rule.SavePath != "" {
+			opts.SavePath = rule.SavePath
+		}
+		infoHash, err := m.add(ctx, item.Link, opts)
+		if ctx.Err() != nil {
+			return added, ctx.Err()
+		}
+		if errors.Is(err, torrent.ErrNetworkSuspended) {
+			return added, err
+		}
+		var fetchErr fetchError
+		if errors.As(err, &fetchErr) {
+			failures = append(failures, errors.New(errorText(err)))
+			continue
+		}
+
+		record := HistoryItem{FeedID: feed.ID, RuleID: rule.ID, Title: item.Title, Key: key, InfoHash: infoHash, Status: StatusAdded, At: m.now().UTC()}
+		if err != nil {
+			record.Status = StatusFailed
+			record.Error = errorText(err)
+			m.logger.Warn("Feed item could not be added", zap.String("feed", feed.ID), zap.String("rule", rule.ID), zap.String("error", record.Error))
+		} else {
+			added++
+		}
+		m.mu.Lock()
+		m.seen[key] = feed.ID
+		m.mu.Unlock()
+		if m.HistoryEnabled() {
+			if err := m.history.AddFeedHistory(&record); err != nil {
+				m.logger.Warn("Feed history not recorded", zap.Error(err))
+			}
+		}
+	}
+	return added, errors.Join(failures...)
+}
+
+func matchRule(rules []Rule, title string) *Rule {
+	for i := range rules {
+		if rules[i].Match(title) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// matched reports whether an item with this key was added before, in this
+// process or, going by the history, an earlier one.
+func (m *Manager) matched(key string) bool {
+	m.mu.Lock()
+	_, ok := m.seen[key]
+	m.mu.Unlock()
+	if ok || m.history == nil {
+		return ok
+	}
+	found, err := m.history.HasFeedHistory(key)
+	if err != nil {
+		m.logger.Warn("Feed history lookup failed", zap.Error(err))
+		return true
+	}
+	return found
+}
+
+func (m *Manager) add(ctx context.Context, link string, opts torrent.AddOptions) (string, error) {
+	if isMagnet(link) {
+		return m.adder.AddMagnetContext(ctx, link, opts)
+	}
+	data, err := m.download(ctx, link, torrent.MaxTorrentFileSize)
+	if err != nil {
+		return "", err
+	}
+	return m.adder.AddTorrentFileWithOptions(data, opts)
+}
+
+func (m *Manager) fetchFeed(ctx context.Context, feedURL string) ([]Item, error) {
+	data, err := m.download(ctx, feedURL, maxFeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// download fetches a URL with the manager's client. Failures are returned
+// as fetchError.
+func (m *Manager) download(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.client.Do(req)
+	if err != nil {
+		return nil, fetchError{err}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fetchError{fmt.Errorf("server returned %s", res.Status)}
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return nil, fetchError{err}
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response is larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// hashKey keeps titles out of the stored deduplication keys.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// errorText describes err without the URL a request failed for, which may
+// carry a passkey.
+func errorText(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
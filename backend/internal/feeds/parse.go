@@ -0,0 +1,180 @@
+package feeds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Item is a feed entry that links to a torrent.
+type Item struct {
+	Title string
+	GUID  string
+	// Link is a magnet link or the URL of a .torrent file.
+	Link string
+}
+
+type document struct {
+	XMLName xml.Name
+	Items   []rssItem   `xml:"channel>item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	GUID      string `xml:"guid"`
+	Enclosure struct {
+		URL  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	// Attrs are torznab:attr and newznab:attr elements; indexers put
+	// magnet links there.
+	Attrs []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"link"`
+}
+
+// Parse reads an RSS 2.0 or Atom document. Entries without a magnet link
+// or torrent URL are left out.
+func Parse(data []byte) ([]Item, error) {
+	var doc document
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	// Feeds declaring another charset are read as UTF-8: links are ASCII,
+	// and at worst a title is garbled.
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("not an RSS or Atom feed: %w", err)
+	}
+	switch doc.XMLName.Local {
+	case "rss", "feed":
+	default:
+		return nil, fmt.Errorf("not an RSS or Atom feed: root element is <%s>", doc.XMLName.Local)
+	}
+
+	var items []Item
+	for _, entry := range doc.Items {
+		item := Item{Title: clean(entry.Title), GUID: strings.TrimSpace(entry.GUID)}
+		for _, attr := range entry.Attrs {
+			if attr.Name == "magneturl" && isMagnet(attr.Value) {
+				item.Link = strings.TrimSpace(attr.Value)
+			}
+		}
+		for _, candidate := range []string{entry.Enclosure.URL, entry.Link} {
+			if item.Link == "" && isTorrentLink(candidate, entry.Enclosure.Type) {
+				item.Link = strings.TrimSpace(candidate)
+			}
+		}
+		items = appendItem(items, item)
+	}
+	for _, entry := range doc.Entries {
+		item := Item{Title: clean(entry.Title), GUID: strings.TrimSpace(entry.ID)}
+		for _, link := range entry.Links {
+			if item.Link == "" && isTorrentLink(link.Href, link.Type) {
+				item.Link = strings.TrimSpace(link.Href)
+			}
+		}
+		items = appendItem(items, item)
+	}
+	return items, nil
+}
+
+const torrentType = "application/x-bittorrent"
+
+func appendItem(items []Item, item Item) []Item {
+	if item.Link == "" || item.Title == "" {
+		return items
+	}
+	if item.GUID == "" {
+		item.GUID = item.Link
+	}
+	return append(items, item)
+}
+
+func isMagnet(link string) bool {
+	return strings.HasPrefix(strings.TrimSpace(link), "magnet:?")
+}
+
+// isTorrentLink reports whether link is a magnet link or an http(s) URL
+// that serves a .torrent file, judging by its type or its path.
+func isTorrentLink(link, mimeType string) bool {
+	link = strings.TrimSpace(link)
+	if isMagnet(link) {
+		return true
+	}
+	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+		return false
+	}
+	if mimeType == torrentType {
+		return true
+	}
+	path, _, _ := strings.Cut(link, "?")
+	return strings.HasSuffix(strings.ToLower(path), ".torrent")
+}
+
+func clean(title string) string {
+	return strings.Join(strings.Fields(title), " ")
+}
+
+var (
+	seasonEpisode = regexp.MustCompile(`(?i)^(.*?)[\s._\-\[(]+s(\d{1,3})[\s._\-]?e(\d{1,4})(?:[\s._\-]?e\d{1,4})*(?:$|[^a-z0-9])`)
+	crossEpisode  = regexp.MustCompile(`(?i)^(.*?)[\s._\-\[(]+(\d{1,2})x(\d{2,3})(?:$|[^a-z0-9])`)
+	dailyEpisode  = regexp.MustCompile(`^(.*?)[\s._\-\[(]+((?:19|20)\d{2})[\s._\-](\d{2})[\s._\-](\d{2})(?:$|[^0-9])`)
+	nonAlnum      = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// EpisodeKey returns a key shared by every release of the episode an item
+// title names, such as "show name|s01e02" for "Show.Name.S01E02.720p", and
+// false for titles that name no episode.
+func EpisodeKey(title string) (string, bool) {
+	if m := seasonEpisode.FindStringSubmatch(title); m != nil {
+		return episodeKey(m[1], "s%02de%02d", m[2], m[3])
+	}
+	if m := crossEpisode.FindStringSubmatch(title); m != nil {
+		return episodeKey(m[1], "s%02de%02d", m[2], m[3])
+	}
+	if m := dailyEpisode.FindStringSubmatch(title); m != nil {
+		return episodeKey(m[1], "%04d-%02d-%02d", m[2], m[3], m[4])
+	}
+	return "", false
+}
+
+func episodeKey(series, format string, numbers ...string) (string, bool) {
+	series = strings.TrimSpace(nonAlnum.ReplaceAllString(strings.ToLower(series), " "))
+	if series == "" {
+		return "", false
+	}
+	args := make([]interface{}, len(numbers))
+	for i, number := range numbers {
+		n, _ := strconv.Atoi(number)
+		args[i] = n
+	}
+	return series + "|" + fmt.Sprintf(format, args...), true
+}
+
+// dedupeKey is what an item is deduplicated by: its episode, or its GUID
+// within its feed.
+func dedupeKey(feedID string, item Item) string {
+	if key, ok := EpisodeKey(item.Title); ok {
+		return "episode:" + key
+	}
+	return "guid:" + feedID + ":" + item.GUID
+}
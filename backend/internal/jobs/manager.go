@@ -0,0 +1,394 @@
+// Package jobs runs long file operations outside the HTTP request cycle.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Status is the lifecycle state of a job.
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+const (
+	DefaultWorkers   = 2
+	DefaultQueueSize = 64
+	// maxFinishedJobs bounds how many completed jobs are kept for polling.
+	maxFinishedJobs = 200
+)
+
+var (
+	ErrNotFound  = errors.New("job not found")
+	ErrQueueFull = errors.New("job queue is full")
+	ErrFinished  = errors.New("job has already finished")
+	ErrClosed    = errors.New("job manager is shut down")
+)
+
+// Func is the work a job performs. It must return promptly once ctx is
+// cancelled and should report processed bytes through progress.
+type Func func(ctx context.Context, progress *Progress) (interface{}, error)
+
+// Progress tracks processed and expected bytes for a running job.
+type Progress struct {
+	done  atomic.Int64
+	total atomic.Int64
+}
+
+// Add records n more processed bytes.
+func (p *Progress) Add(n int64) {
+	p.done.Add(n)
+}
+
+// SetTotal sets the number of bytes the job expects to process.
+func (p *Progress) SetTotal(n int64) {
+	p.total.Store(n)
+}
+
+// Job is a point-in-time view of a job.
+type Job struct {
+	ID            string      `json:"id"`
+	Kind          string      `json:"kind"`
+	Status        Status      `json:"status"`
+	ProgressBytes int64       `json:"progressBytes"`
+	TotalBytes    int64       `json:"totalBytes"`
+	Result        interface{} `json:"result,omitempty"`
+	Error         string      `json:"error,omitempty"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	StartedAt     *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time  `json:"finishedAt,omitempty"`
+}
+
+// Finished reports whether the job reached a terminal state.
+func (j Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+type job struct {
+	mu       sync.Mutex
+	state    Job
+	progress Progress
+	ctx      context.Context
+	cancel   context.CancelFunc
+	fn       Func
+	done     chan struct{}
+}
+
+func (j *job) snapshot() Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	state := j.state
+	state.ProgressBytes = j.progress.done.Load()
+	state.TotalBytes = j.progress.total.Load()
+	return state
+}
+
+// finish moves the job to a terminal state unless it already has one.
+func (j *job) finish(status Status, result interface{}, err error) {
+	j.mu.Lock()
+	finished := j.finishLocked(status, result, err)
+	j.mu.Unlock()
+	if finished {
+		j.cancel()
+		close(j.done)
+	}
+}
+
+// finishLocked records a terminal state unless the job already has one and
+// reports whether it did; the caller then cancels the job and closes done.
+func (j *job) finishLocked(status Status, result interface{}, err error) bool {
+	if j.state.Finished() {
+		return false
+	}
+	now := time.Now()
+	j.state.Status = status
+	j.state.Result = result
+	if err != nil {
+		j.state.Error = err.Error()
+	}
+	j.state.FinishedAt = &now
+	return true
+}
+
+// requestCancel finishes a queued job at once, under the lock run takes to
+// start it, so that a worker cannot start it in between. A running job only
+// has its context cancelled; its worker finishes it once Func returns.
+func (j *job) requestCancel() error {
+	j.mu.Lock()
+	switch j.state.Status {
+	case StatusQueued:
+		j.finishLocked(StatusCancelled, nil, context.Canceled)
+		j.mu.Unlock()
+		j.cancel()
+		close(j.done)
+		return nil
+	case StatusRunning:
+		j.mu.Unlock()
+		j.cancel()
+		return nil
+	}
+	j.mu.Unlock()
+	return ErrFinished
+}
+
+// Manager runs submitted jobs on a fixed number of workers.
+type Manager struct {
+	mu     sync.RWMutex
+	jobs   map[string]*job
+	queue  chan *job
+	ctx    context.Context
+	stop   context.CancelFunc
+	wg     sync.WaitGroup
+	closed bool
+	logger *zap.Logger
+}
+
+// NewManager starts workers goroutines that take jobs from a queue holding
+// up to queueSize pending jobs.
+func NewManager(workers, queueSize int, logger *zap.Logger) *Manager {
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+	if queueSize < 1 {
+		queueSize = DefaultQueueSize
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	m := &Manager{
+		jobs:   make(map[string]*job),
+		queue:  make(chan *job, queueSize),
+		ctx:    ctx,
+		stop:   stop,
+		logger: logger,
+	}
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	return m
+}
+
+// Submit queues fn under kind and returns the queued job.
+func (m *Manager) Submit(kind string, fn Func) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	j := &job{
+		state: Job{
+			ID:        id,
+			Kind:      kind,
+			Status:    StatusQueued,
+			CreatedAt: time.Now(),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+		fn:     fn,
+		done:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		cancel()
+		return Job{}, ErrClosed
+	}
+	select {
+	case m.queue <- j:
+	default:
+		cancel()
+		return Job{}, ErrQueueFull
+	}
+	m.jobs[id] = j
+	m.pruneLocked()
+	return j.snapshot(), nil
+}
+
+// Get returns the job with the given ID.
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.RLock()
+	j, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// List returns all retained jobs, newest first.
+func (m *Manager) List() []Job {
+	m.mu.RLock()
+	list := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		list = append(list, j.snapshot())
+	}
+	m.mu.RUnlock()
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].CreatedAt.After(list[b].CreatedAt)
+	})
+	return list
+}
+
+// Cancel stops a queued or running job. A running job is marked cancelled
+// as soon as its Func returns.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.RLock()
+	j, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+
+	err := j.requestCancel()
+	return j.snapshot(), err
+}
+
+// Wait blocks until the job finishes or ctx is done.
+func (m *Manager) Wait(ctx context.Context, id string) (Job, error) {
+	m.mu.RLock()
+	j, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	select {
+	case <-j.done:
+		return j.snapshot(), nil
+	case <-ctx.Done():
+		return j.snapshot(), ctx.Err()
+	}
+}
+
+// Purge cancels every queued and running job, waits for them to finish or
+// ctx to expire, and then forgets all jobs so none of them can be listed.
+// Unlike Shutdown, the manager keeps accepting new jobs.
+func (m *Manager) Purge(ctx context.Context) error {
+	m.mu.Lock()
+	all := m.jobs
+	m.jobs = make(map[string]*job)
+	m.mu.Unlock()
+
+	for _, j := range all {
+		_ = j.requestCancel()
+	}
+	for _, j := range all {
+		select {
+		case <-j.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Shutdown refuses new jobs, cancels everything in flight and waits for the
+// workers to exit or ctx to expire.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+	m.stop()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for j := range m.queue {
+		m.run(j)
+	}
+}
+
+func (m *Manager) run(j *job) {
+	j.mu.Lock()
+	if j.state.Status != StatusQueued {
+		j.mu.Unlock()
+		return
+	}
+	if j.ctx.Err() != nil {
+		j.mu.Unlock()
+		j.finish(StatusCancelled, nil, context.Canceled)
+		return
+	}
+	now := time.Now()
+	j.state.Status = StatusRunning
+	j.state.StartedAt = &now
+	j.mu.Unlock()
+
+	result, err := m.call(j)
+	switch {
+	case err == nil:
+		j.finish(StatusSucceeded, result, nil)
+	case j.ctx.Err() != nil:
+		j.finish(StatusCancelled, result, err)
+	default:
+		m.logger.Warn("Job failed", zap.String("kind", j.state.Kind), zap.Error(err))
+		j.finish(StatusFailed, result, err)
+	}
+}
+
+// call runs the job function, turning a panic into a failure so one bad job
+// cannot take a worker down.
+func (m *Manager) call(j *job) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			m.logger.Error("Job panicked", zap.String("kind", j.state.Kind), zap.Any("panic", r))
+			err = errors.New("job panicked")
+		}
+	}()
+	return j.fn(j.ctx, &j.progress)
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxFinishedJobs.
+func (m *Manager) pruneLocked() {
+	finished := make([]Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		if snapshot := j.snapshot(); snapshot.Finished() {
+			finished = append(finished, snapshot)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[a].FinishedAt.Before(*finished[b].FinishedAt)
+	})
+	for _, snapshot := range finished[:len(finished)-maxFinishedJobs] {
+		delete(m.jobs, snapshot.ID)
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func waitFor(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	job, err := m.Wait(ctx, id)
+	if err != nil {
+		t.Fatalf("Wait(%s) error = %v", id, err)
+	}
+	return job
+}
+
+func TestManagerRunsJobToCompletion(t *testing.T) {
+	m := NewManager(1, 4, zap.NewNop())
+	defer m.Shutdown(context.Background())
+
+	job, err := m.Submit("copy", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		progress.SetTotal(10)
+		progress.Add(4)
+		progress.Add(6)
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if job.Status != StatusQueued || job.ID == "" {
+		t.Fatalf("unexpected submitted job %+v", job)
+	}
+
+	job = waitFor(t, m, job.ID)
+	if job.Status != StatusSucceeded || job.Result != "done" {
+		t.Fatalf("unexpected finished job %+v", job)
+	}
+	if job.ProgressBytes != 10 || job.TotalBytes != 10 {
+		t.Fatalf("progress = %d/%d, want 10/10", job.ProgressBytes, job.TotalBytes)
+	}
+	if job.StartedAt == nil || job.FinishedAt == nil {
+		t.Fatal("expected start and finish times to be recorded")
+	}
+}
+
+func TestManagerReportsFailuresAndPanics(t *testing.T) {
+	m := NewManager(1, 4, zap.NewNop())
+	defer m.Shutdown(context.Background())
+
+	failing, _ := m.Submit("fail", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		return nil, errors.New("disk full")
+	})
+	panicking, _ := m.Submit("panic", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		panic("boom")
+	})
+
+	if job := waitFor(t, m, failing.ID); job.Status != StatusFailed || job.Error != "disk full" {
+		t.Fatalf("unexpected failed job %+v", job)
+	}
+	if job := waitFor(t, m, panicking.ID); job.Status != StatusFailed {
+		t.Fatalf("unexpected panicked job %+v", job)
+	}
+}
+
+func TestManagerCancelsRunningAndQueuedJobs(t *testing.T) {
+	m := NewManager(1, 4, zap.NewNop())
+	defer m.Shutdown(context.Background())
+
+	started := make(chan struct{})
+	running, _ := m.Submit("block", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	queued, _ := m.Submit("never", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		t.Error("a cancelled queued job must not run")
+		return nil, nil
+	})
+	<-started
+
+	if job, err := m.Cancel(queued.ID); err != nil || job.Status != StatusCancelled {
+		t.Fatalf("Cancel(queued) = %+v, %v", job, err)
+	}
+	if _, err := m.Cancel(running.ID); err != nil {
+		t.Fatalf("Cancel(running) error = %v", err)
+	}
+	if job := waitFor(t, m, running.ID); job.Status != StatusCancelled {
+		t.Fatalf("running job status = %s, want cancelled", job.Status)
+	}
+	if _, err := m.Cancel(running.ID); !errors.Is(err, ErrFinished) {
+		t.Fatalf("Cancel(finished) error = %v, want ErrFinished", err)
+	}
+	if _, err := m.Cancel("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Cancel(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManagerCancelRacingWorkerStart(t *testing.T) {
+	m := NewManager(4, 64, zap.NewNop())
+	defer m.Shutdown(context.Background())
+
+	// A job cancelled while a worker picks it up either never runs or is
+	// reported finished only once its Func has returned. Cancelled jobs keep
+	// their queue slot until a worker skips them, so stay below the queue size.
+	for i := 0; i < 50; i++ {
+		var returned atomic.Bool
+		job, err := m.Submit("race", func(ctx context.Context, progress *Progress) (interface{}, error) {
+			<-ctx.Done()
+			returned.Store(true)
+			return nil, ctx.Err()
+		})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		if _, err := m.Cancel(job.ID); err != nil {
+			t.Fatalf("Cancel() error = %v", err)
+		}
+		finished := waitFor(t, m, job.ID)
+		if finished.Status != StatusCancelled {
+			t.Fatalf("status = %s, want cancelled", finished.Status)
+		}
+		if finished.StartedAt != nil && !returned.Load() {
+			t.Fatal("job reported cancelled while its Func was still running")
+		}
+	}
+}
+
+func TestManagerBoundsQueueAndRefusesAfterShutdown(t *testing.T) {
+	m := NewManager(1, 1, zap.NewNop())
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	block := func(ctx context.Context, progress *Progress) (interface{}, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil, nil
+	}
+
+	if _, err := m.Submit("first", block); err != nil {
+		t.Fatalf("Submit(first) error = %v", err)
+	}
+	<-started
+	if _, err := m.Submit("second", block); err != nil {
+		t.Fatalf("Submit(second) error = %v", err)
+	}
+	if _, err := m.Submit("third", block); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Submit(third) error = %v, want ErrQueueFull", err)
+	}
+	if got := len(m.List()); got != 2 {
+		t.Fatalf("List() returned %d jobs, want 2", got)
+	}
+
+	close(release)
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if _, err := m.Submit("late", block); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Submit after shutdown error = %v, want ErrClosed", err)
+	}
+}
+
+func TestManagerPurgeCancelsAndForgetsJobs(t *testing.T) {
+	m := NewManager(1, 4, zap.NewNop())
+	defer m.Shutdown(context.Background())
+
+	started := make(chan struct{})
+	running, _ := m.Submit("block", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	m.Submit("never", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		t.Error("a purged queued job must not run")
+		return nil, nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Purge(ctx); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if jobs := m.List(); len(jobs) != 0 {
+		t.Fatalf("List() after Purge = %+v, want none", jobs)
+	}
+	if _, err := m.Get(running.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(purged) error = %v, want ErrNotFound", err)
+	}
+
+	job, err := m.Submit("after", func(ctx context.Context, progress *Progress) (interface{}, error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Submit() after Purge error = %v", err)
+	}
+	if job := waitFor(t, m, job.ID); job.Status != StatusSucceeded {
+		t.Fatalf("job after Purge status = %s, want succeeded", job.Status)
+	}
+}
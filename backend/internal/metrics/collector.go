@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Options controls the optional, high-cardinality series.
+type Options struct {
+	// PerTorrent adds transfer and peer series labelled by info hash.
+	PerTorrent bool
+	// HideTorrentsInNoLogs drops the per-torrent series while no-logs mode
+	// is on, so scrapes never record which torrents were active.
+	HideTorrentsInNoLogs bool
+}
+
+// TorrentSource is what the collector reads from the torrent client.
+type TorrentSource interface {
+	GetAllTorrents() []*torrent.TorrentInfo
+	TransferStats() (downloaded, uploaded int64)
+	NoLogsMode() bool
+}
+
+// Sources are read at every scrape. Nil sources are skipped.
+type Sources struct {
+	Torrents      TorrentSource
+	KillSwitch    func() security.KillSwitchStatus
+	SecurityScore func() int
+	DBStats       func() sql.DBStats
+}
+
+// StateCollector reports torrent, kill switch, security and database pool
+// state as of the scrape.
+type StateCollector struct {
+	sources Sources
+	options Options
+
+	torrents          *prometheus.Desc
+	transferred       *prometheus.Desc
+	peers             *prometheus.Desc
+	torrentDownload   *prometheus.Desc
+	torrentUpload     *prometheus.Desc
+	torrentPeers      *prometheus.Desc
+	killSwitchEnabled *prometheus.Desc
+	killSwitchFired   *prometheus.Desc
+	violations        *prometheus.Desc
+	securityScore     *prometheus.Desc
+	dbOpen            *prometheus.Desc
+	dbInUse           *prometheus.Desc
+	dbIdle            *prometheus.Desc
+	dbMaxOpen         *prometheus.Desc
+	dbWaits           *prometheus.Desc
+	dbWaitSeconds     *prometheus.Desc
+}
+
+func NewStateCollector(sources Sources, options Options) *StateCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, labels, nil)
+	}
+	return &StateCollector{
+		sources:           sources,
+		options:           options,
+		torrents:          desc("torrents", "Torrents by status.", "status"),
+		transferred:       desc("transferred_bytes_total", "Payload bytes transferred since start.", "direction"),
+		peers:             desc("peers", "Connected peers across all torrents."),
+		torrentDownload:   desc("torrent_downloaded_bytes_total", "Payload bytes downloaded by one torrent.", "info_hash"),
+		torrentUpload:     desc("torrent_uploaded_bytes_total", "Payload bytes uploaded by one torrent.", "info_hash"),
+		torrentPeers:      desc("torrent_peers", "Connected peers of one torrent.", "info_hash"),
+		killSwitchEnabled: desc("killswitch_enabled", "Whether the kill switch is armed."),
+		killSwitchFired:   desc("killswitch_triggered", "Whether the kill switch has fired and not been reset."),
+		violations:        desc("killswitch_violations", "Violations counted toward the kill switch."),
+		securityScore:     desc("security_score", "Security score from 0 to 100."),
+		dbOpen:            desc("db_open_connections", "Open database connections."),
+		dbInUse:           desc("db_in_use_connections", "Database connections in use."),
+		dbIdle:            desc("db_idle_connections", "Idle database connections."),
+		dbMaxOpen:         desc("db_max_open_connections", "Maximum open database connections."),
+		dbWaits:           desc("db_wait_count_total", "Connections waited for since start."),
+		dbWaitSeconds:     desc("db_wait_duration_seconds_total", "Time spent waiting for a connection since start."),
+	}
+}
+
+func (c *StateCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.torrents, c.transferred, c.peers, c.torrentDownload, c.torrentUpload, c.torrentPeers,
+		c.killSwitchEnabled, c.killSwitchFired, c.violations, c.securityScore,
+		c.dbOpen, c.dbInUse, c.dbIdle, c.dbMaxOpen, c.dbWaits, c.dbWaitSeconds,
+	} {
+		ch <- d
+	}
+}
+
+func (c *StateCollector) Collect(ch chan<- prometheus.Metric) {
+	if c.sources.Torrents != nil {
+		c.collectTorrents(ch)
+	}
+	if c.sources.KillSwitch != nil {
+		status := c.sources.KillSwitch()
+		ch <- prometheus.MustNewConstMetric(c.killSwitchEnabled, prometheus.GaugeValue, boolValue(status.Enabled))
+		ch <- prometheus.MustNewConstMetric(c.killSwitchFired, prometheus.GaugeValue, boolValue(status.Triggered))
+		ch <- prometheus.MustNewConstMetric(c.violations, prometheus.GaugeValue, float64(status.Violations))
+	}
+	if c.sources.SecurityScore != nil {
+		ch <- prometheus.MustNewConstMetric(c.securityScore, prometheus.GaugeValue, float64(c.sources.SecurityScore()))
+	}
+	if c.sources.DBStats != nil {
+		stats := c.sources.DBStats()
+		ch <- prometheus.MustNewConstMetric(c.dbOpen, prometheus.GaugeValue, float64(stats.OpenConnections))
+		ch <- prometheus.MustNewConstMetric(c.dbInUse, prometheus.GaugeValue, float64(stats.InUse))
+		ch <- prometheus.MustNewConstMetric(c.dbIdle, prometheus.GaugeValue, float64(stats.Idle))
+		ch <- prometheus.MustNewConstMetric(c.dbMaxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+		ch <- prometheus.MustNewConstMetric(c.dbWaits, prometheus.CounterValue, float64(stats.WaitCount))
+		ch <- prometheus.MustNewConstMetric(c.dbWaitSeconds, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	}
+}
+
+func (c *StateCollector) collectTorrents(ch chan<- prometheus.Metric) {
+	source := c.sources.Torrents
+	infos := source.GetAllTorrents()
+	perTorrent := c.options.PerTorrent && !(c.options.HideTorrentsInNoLogs && source.NoLogsMode())
+
+	// Every status is reported, at zero when no torrent has it, so
+	// dashboards do not lose the series.
+	byStatus := make(map[string]int, len(torrent.Statuses))
+	for _, status := range torrent.Statuses {
+		byStatus[status] = 0
+	}
+	peers := 0
+	for _, info := range infos {
+		byStatus[info.Status]++
+		peers += info.Peers
+		if perTorrent {
+			// The client reports cumulative byte counts; rate() in the
+			// query turns them into per-torrent rates.
+			ch <- prometheus.MustNewConstMetric(c.torrentDownload, prometheus.CounterValue, float64(info.DownloadRate), info.InfoHash)
+			ch <- prometheus.MustNewConstMetric(c.torrentUpload, prometheus.CounterValue, float64(info.UploadRate), info.InfoHash)
+			ch <- prometheus.MustNewConstMetric(c.torrentPeers, prometheus.GaugeValue, float64(info.Peers), info.InfoHash)
+		}
+	}
+	for status, count := range byStatus {
+		ch <- prometheus.MustNewConstMetric(c.torrents, prometheus.GaugeValue, float64(count), status)
+	}
+	ch <- prometheus.MustNewConstMetric(c.peers, prometheus.GaugeValue, float64(peers))
+
+	downloaded, uploaded := source.TransferStats()
+	ch <- prometheus.MustNewConstMetric(c.transferred, prometheus.CounterValue, float64(downloaded), "download")
+	ch <- prometheus.MustNewConstMetric(c.transferred, prometheus.CounterValue, float64(uploaded), "upload")
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
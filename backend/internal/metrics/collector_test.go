@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeTorrents struct {
+	noLogs bool
+}
+
+func (f *fakeTorrents) GetAllTorrents() []*torrent.TorrentInfo {
+	return []*torrent.TorrentInfo{
+		{InfoHash: "aaaa", Status: "downloading", Peers: 3, DownloadRate: 100},
+		{InfoHash: "bbbb", Status: "completed", Peers: 1, UploadRate: 50},
+	}
+}
+
+func (f *fakeTorrents) TransferStats() (int64, int64) { return 100, 50 }
+
+func (f *fakeTorrents) NoLogsMode() bool { return f.noLogs }
+
+func TestStateCollectorReportsState(t *testing.T) {
+	torrents := &fakeTorrents{}
+	collector := NewStateCollector(Sources{
+		Torrents:      torrents,
+		KillSwitch:    func() security.KillSwitchStatus { return security.KillSwitchStatus{Enabled: true, Violations: 2} },
+		SecurityScore: func() int { return 80 },
+	}, Options{PerTorrent: true, HideTorrentsInNoLogs: true})
+
+	expected := `
+# HELP b2t_torrents Torrents by status.
+# TYPE b2t_torrents gauge
+b2t_torrents{status="completed"} 1
+b2t_torrents{status="downloading"} 1
+b2t_torrents{status="paused"} 0
+b2t_torrents{status="starting"} 0
+b2t_torrents{status="suspended"} 0
+# HELP b2t_peers Connected peers across all torrents.
+# TYPE b2t_peers gauge
+b2t_peers 4
+# HELP b2t_torrent_peers Connected peers of one torrent.
+# TYPE b2t_torrent_peers gauge
+b2t_torrent_peers{info_hash="aaaa"} 3
+b2t_torrent_peers{info_hash="bbbb"} 1
+# HELP b2t_killswitch_violations Violations counted toward the kill switch.
+# TYPE b2t_killswitch_violations gauge
+b2t_killswitch_violations 2
+# HELP b2t_security_score Security score from 0 to 100.
+# TYPE b2t_security_score gauge
+b2t_security_score 80
+`
+	names := []string{"b2t_torrents", "b2t_peers", "b2t_torrent_peers", "b2t_killswitch_violations", "b2t_security_score"}
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), names...); err != nil {
+		t.Fatal(err)
+	}
+
+	torrents.noLogs = true
+	if count := testutil.CollectAndCount(collector, "b2t_torrent_peers", "b2t_torrent_downloaded_bytes_total"); count != 0 {
+		t.Fatalf("no-logs mode exposed %d per-torrent series", count)
+	}
+	if count := testutil.CollectAndCount(collector, "b2t_peers"); count != 1 {
+		t.Fatalf("no-logs mode dropped the aggregate series")
+	}
+}
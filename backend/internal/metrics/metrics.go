@@ -0,0 +1,81 @@
+// Package metrics exposes backend state in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "b2t"
+
+// Metrics owns the registry served at /metrics and the series updated as
+// requests and proxy dials happen. Everything else is read at scrape time
+// by collectors added with Register.
+type Metrics struct {
+	registry      *prometheus.Registry
+	httpDuration  *prometheus.HistogramVec
+	proxyDial     *prometheus.HistogramVec
+	proxyFailures *prometheus.CounterVec
+}
+
+// New creates a registry with Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route template and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "code"}),
+		proxyDial: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "proxy_dial_duration_seconds",
+			Help:      "Time to connect through the proxy chain, by entry proxy.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+		}, []string{"proxy"}),
+		proxyFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "proxy_dial_failures_total",
+			Help:      "Failed attempts to connect through the proxy chain, by entry proxy.",
+		}, []string{"proxy"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpDuration,
+		m.proxyDial,
+		m.proxyFailures,
+	)
+	return m
+}
+
+// Register adds a collector read at every scrape.
+func (m *Metrics) Register(collector prometheus.Collector) error {
+	return m.registry.Register(collector)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTP records one served request. route must be a route template,
+// never a raw path, to keep the number of series bounded.
+func (m *Metrics) ObserveHTTP(method, route string, status int, elapsed time.Duration) {
+	m.httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(elapsed.Seconds())
+}
+
+// ObserveProxyDial records one attempt to dial through the proxy chain.
+func (m *Metrics) ObserveProxyDial(entry string, elapsed time.Duration, err error) {
+	if err != nil {
+		m.proxyFailures.WithLabelValues(entry).Inc()
+		return
+	}
+	m.proxyDial.WithLabelValues(entry).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+)
+
+// Cookies and header used by session authentication. The CSRF cookie is
+// readable by the frontend, which echoes it in CSRFHeader.
+const (
+	SessionCookie = "b2_session"
+	CSRFCookie    = "b2_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// apiKeyUser is the identity of a caller holding B2_API_TOKEN, or of every
+// caller while no token and no account exist.
+var apiKeyUser = auth.User{Username: "api-key", Role: auth.RoleAdmin}
+
+// Authenticate resolves the caller of every request and stores it with
+// auth.WithIdentity. A valid B2_API_TOKEN acts as an admin, and a managed
+// API token is limited to its scopes; an unknown or expired managed token is
+// rejected outright. Until the first account exists, other requests are
+// left to APIKey and treated as admin; afterwards a caller without a token
+// or a valid session is anonymous and Require turns it away. Session
+// callers must echo the CSRF cookie in CSRFHeader on anything but GET and
+// HEAD.
+func Authenticate(accounts *auth.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		open := APIKey(withIdentity(&auth.Identity{User: apiKeyUser, Method: auth.MethodOpen}, next))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if apiKeyMatches(r) {
+				withIdentity(&auth.Identity{User: apiKeyUser, Method: auth.MethodAPIKey}, next).ServeHTTP(w, r)
+				return
+			}
+			if key := providedAPIKey(r); auth.IsAPIToken(key) {
+				token, err := accounts.ResolveToken(key)
+				if err != nil {
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				id := &auth.Identity{User: auth.User{Username: token.Name}, Method: auth.MethodToken, Token: token}
+				withIdentity(id, next).ServeHTTP(w, r)
+				return
+			}
+			if cookie, err := r.Cookie(SessionCookie); err == nil && cookie.Value != "" {
+				if user, session, err := accounts.Resolve(cookie.Value); err == nil {
+					if !csrfValid(r, session) {
+						http.Error(w, "CSRF token missing or invalid", http.StatusForbidden)
+						return
+					}
+					withIdentity(&auth.Identity{User: *user, Method: auth.MethodSession, Session: session}, next).ServeHTTP(w, r)
+					return
+				}
+			}
+			if !accounts.HasUsers() {
+				open.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Require wraps a route so only users whose role includes role, and API
+// tokens granted scope, reach it.
+func Require(role auth.Role, scope auth.Scope) func(http.HandlerFunc) http.Handler {
+	return func(next http.HandlerFunc) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next(w, r)
+				return
+			}
+			id, ok := auth.IdentityFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !id.Allows(role, scope) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+		})
+	}
+}
+
+// SetSessionCookies hands a new session to the client.
+func SetSessionCookies(w http.ResponseWriter, r *http.Request, token string, session *auth.Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    session.CSRFToken,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearSessionCookies removes the session cookies from the client.
+func ClearSessionCookies(w http.ResponseWriter, r *http.Request) {
+	for _, name := range []string{SessionCookie, CSRFCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+			HttpOnly: name == SessionCookie,
+			Secure:   isHTTPS(r),
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+func withIdentity(id *auth.Identity, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	})
+}
+
+func csrfValid(r *http.Request, session *auth.Session) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	provided := strings.TrimSpace(r.Header.Get(CSRFHeader))
+	return provided != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(session.CSRFToken)) == 1
+}
+
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+	"go.uber.org/zap"
+)
+
+// sessionStore serves one user, one session and one API token; the
+// remaining auth.Store methods are not used by Authenticate.
+type sessionStore struct {
+	auth.Store
+	users   int
+	user    auth.User
+	session auth.Session
+	token   auth.APIToken
+}
+
+func (s *sessionStore) GetTokenByHash(secretHash string) (*auth.APIToken, error) {
+	if secretHash != s.token.SecretHash {
+		return nil, auth.ErrTokenNotFound
+	}
+	token := s.token
+	return &token, nil
+}
+
+func (s *sessionStore) TouchToken(id int64, usedAt time.Time) error { return nil }
+
+func (s *sessionStore) CountUsers() (int, error) { return s.users, nil }
+
+func (s *sessionStore) GetUser(id int64) (*auth.User, error) {
+	user := s.user
+	return &user, nil
+}
+
+func (s *sessionStore) GetSession(tokenHash string) (*auth.Session, error) {
+	if tokenHash != s.session.TokenHash {
+		return nil, auth.ErrSessionNotFound
+	}
+	session := s.session
+	return &session, nil
+}
+
+func serveAuthenticated(t *testing.T, store auth.Store, role auth.Role, req *http.Request) int {
+	t.Helper()
+	return serveScoped(t, store, role, "", req)
+}
+
+func serveScoped(t *testing.T, store auth.Store, role auth.Role, scope auth.Scope, req *http.Request) int {
+	t.Helper()
+	accounts, err := auth.NewService(store, time.Hour, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewService() error = %v", err)
+	}
+	handler := Authenticate(accounts)(Require(role, scope)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res.Code
+}
+
+func TestAuthenticateWithoutAccountsKeepsAPIKeyRules(t *testing.T) {
+	store := &sessionStore{}
+
+	t.Setenv("B2_API_TOKEN", "")
+	if code := serveAuthenticated(t, store, auth.RoleAdmin, httptest.NewRequest(http.MethodPost, "/api/panic", nil)); code != http.StatusNoContent {
+		t.Fatalf("open access status = %d, want %d", code, http.StatusNoContent)
+	}
+
+	t.Setenv("B2_API_TOKEN", "secret-token")
+	if code := serveAuthenticated(t, store, auth.RoleViewer, httptest.NewRequest(http.MethodGet, "/api/torrents", nil)); code != http.StatusUnauthorized {
+		t.Fatalf("missing token status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/panic", nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	if code := serveAuthenticated(t, store, auth.RoleAdmin, req); code != http.StatusNoContent {
+		t.Fatalf("valid token status = %d, want %d", code, http.StatusNoContent)
+	}
+}
+
+func TestAuthenticateSessionsEnforceRoleAndCSRF(t *testing.T) {
+	t.Setenv("B2_API_TOKEN", "")
+	store := &sessionStore{
+		users: 1,
+		user:  auth.User{ID: 1, Username: "op", Role: auth.RoleOperator},
+		session: auth.Session{
+			TokenHash: auth.HashToken("session-token"),
+			UserID:    1,
+			CSRFToken: "csrf-token",
+			ExpiresAt: time.Now().Add(time.Hour),
+		},
+	}
+	request := func(method, csrf string) *http.Request {
+		req := httptest.NewRequest(method, "/api/torrents", nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookie, Value: "session-token"})
+		if csrf != "" {
+			req.Header.Set(CSRFHeader, csrf)
+		}
+		return req
+	}
+
+	if code := serveAuthenticated(t, store, auth.RoleViewer, httptest.NewRequest(http.MethodGet, "/api/torrents", nil)); code != http.StatusUnauthorized {
+		t.Fatalf("anonymous status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := serveAuthenticated(t, store, auth.RoleViewer, request(http.MethodGet, "")); code != http.StatusNoContent {
+		t.Fatalf("session GET status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := serveAuthenticated(t, store, auth.RoleOperator, request(http.MethodPost, "")); code != http.StatusForbidden {
+		t.Fatalf("POST without CSRF status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := serveAuthenticated(t, store, auth.RoleOperator, request(http.MethodPost, "wrong")); code != http.StatusForbidden {
+		t.Fatalf("POST with wrong CSRF status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := serveAuthenticated(t, store, auth.RoleOperator, request(http.MethodPost, "csrf-token")); code != http.StatusNoContent {
+		t.Fatalf("POST with CSRF status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := serveAuthenticated(t, store, auth.RoleAdmin, request(http.MethodPost, "csrf-token")); code != http.StatusForbidden {
+		t.Fatalf("operator on admin route status = %d, want %d", code, http.StatusForbidden)
+	}
+}
+
+func TestAuthenticateAPITokensEnforceScopes(t *testing.T) {
+	t.Setenv("B2_API_TOKEN", "")
+	expired := time.Now().Add(-time.Minute)
+	store := &sessionStore{
+		users: 1,
+		token: auth.APIToken{ID: 1, Name: "script", SecretHash: auth.HashToken("b2t_valid"), Scopes: []auth.Scope{auth.ScopeTorrentsRead}},
+	}
+	request := func(secret string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/torrents", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		return req
+	}
+
+	if code := serveScoped(t, store, auth.RoleViewer, auth.ScopeTorrentsRead, request("b2t_valid")); code != http.StatusNoContent {
+		t.Fatalf("granted scope status = %d, want %d", code, http.StatusNoContent)
+	}
+	if code := serveScoped(t, store, auth.RoleOperator, auth.ScopeTorrentsWrite, request("b2t_valid")); code != http.StatusForbidden {
+		t.Fatalf("missing scope status = %d, want %d", code, http.StatusForbidden)
+	}
+	if code := serveScoped(t, store, auth.RoleViewer, auth.ScopeTorrentsRead, request("b2t_revoked")); code != http.StatusUnauthorized {
+		t.Fatalf("unknown token status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	store.token.ExpiresAt = &expired
+	if code := serveScoped(t, store, auth.RoleViewer, auth.ScopeTorrentsRead, request("b2t_valid")); code != http.StatusUnauthorized {
+		t.Fatalf("expired token status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMetricsObservesRouteTemplateAndStatus(t *testing.T) {
+	type observation struct {
+		method, route string
+		status        int
+	}
+	var seen []observation
+	router := mux.NewRouter()
+	router.Use(Metrics(func(method, route string, status int, _ time.Duration) {
+		seen = append(seen, observation{method, route, status})
+	}))
+	router.HandleFunc("/api/torrents/{infoHash}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	router.HandleFunc("/api/stream", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("the recorder hides http.Flusher")
+		}
+		w.Write([]byte("data"))
+	})
+
+	for _, path := range []string{"/api/torrents/0123456789abcdef0123456789abcdef01234567", "/api/stream"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	want := []observation{
+		{http.MethodGet, "/api/torrents/{infoHash}", http.StatusNotFound},
+		{http.MethodGet, "/api/stream", http.StatusOK},
+	}
+	if len(seen) != len(want) {
+		t.Fatalf("observed %d requests, want %d", len(seen), len(want))
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("observation %d = %+v, want %+v", i, seen[i], want[i])
+		}
+	}
+}
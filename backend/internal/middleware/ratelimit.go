@@ -0,0 +1,394 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+	"github.com/KFN002/B-2-Torrent/backend/pkg/cache"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	maxRateLimitBuckets = 4096
+	redisRateLimitWait  = 250 * time.Millisecond
+)
+
+// DefaultRateLimit is the budget of a route without its own entry.
+var DefaultRateLimit = RateLimit{Requests: 100, Per: time.Minute}
+
+// RateLimit allows Requests requests per Per. The bucket starts full and
+// refills continuously, so bursts up to Requests are allowed.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l RateLimit) perSecond() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+func (l RateLimit) String() string {
+	return strconv.Itoa(l.Requests) + "/" + l.Per.String()
+}
+
+// ParseRateLimit reads a budget such as "100/1m" or "5/30s".
+func ParseRateLimit(value string) (RateLimit, error) {
+	requests, period, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q: want <requests>/<duration>", value)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q: requests must be a positive number", value)
+	}
+	per, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || per <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q: invalid duration", value)
+	}
+	return RateLimit{Requests: n, Per: per}, nil
+}
+
+// RateLimitConfig holds the default budget and per-route overrides. Routes
+// are keyed by "METHOD /path/template" or by the bare template for every
+// method, e.g. "POST /api/auth/login" or "/api/torrents/{infoHash}".
+type RateLimitConfig struct {
+	Default RateLimit
+	Routes  map[string]RateLimit
+	// TrustedProxies are the networks whose X-Forwarded-For header is
+	// believed when anonymous callers are told apart by address.
+	TrustedProxies []netip.Prefix
+}
+
+// ParseRateLimitRoutes reads a comma separated list of route=budget pairs,
+// e.g. "POST /api/auth/login=10/1m,/api/search=30/1m".
+func ParseRateLimitRoutes(value string) (map[string]RateLimit, error) {
+	routes := make(map[string]RateLimit)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, budget, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("rate limit route %q: want <route>=<requests>/<duration>", entry)
+		}
+		limit, err := ParseRateLimit(budget)
+		if err != nil {
+			return nil, err
+		}
+		method, path, hasMethod := strings.Cut(strings.TrimSpace(route), " ")
+		if !hasMethod {
+			path, method = method, ""
+		}
+		path = strings.TrimSpace(path)
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("rate limit route %q: path must start with /", entry)
+		}
+		if method != "" {
+			path = strings.ToUpper(method) + " " + path
+		}
+		routes[path] = limit
+	}
+	return routes, nil
+}
+
+// ParseTrustedProxies reads a comma separated list of addresses and CIDR
+// networks, e.g. "127.0.0.1,10.0.0.0/8".
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func (c RateLimitConfig) trusted(addr netip.Addr) bool {
+	for _, prefix := range c.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the caller: the peer address, or, when
+// the peer is a trusted proxy, the nearest X-Forwarded-For entry that is
+// not one.
+func (c RateLimitConfig) clientAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if !c.trusted(addr) {
+		return addr, true
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !c.trusted(addr) {
+			break
+		}
+	}
+	return addr, true
+}
+
+func (c RateLimitConfig) limitFor(method, route string) RateLimit {
+	if limit, ok := c.Routes[method+" "+route]; ok {
+		return limit
+	}
+	if limit, ok := c.Routes[route]; ok {
+		return limit
+	}
+	return c.Default
+}
+
+// RateLimitStore keeps token buckets. Take removes one token from the bucket
+// at key and reports whether one was available and how many are left.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error)
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Duration
+}
+
+// MemoryRateLimitStore keeps buckets in process memory.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweepLocked(now)
+	capacity := float64(limit.Requests)
+	b := s.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	b.full = limit.Per
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed.Seconds()*limit.perSecond())
+	}
+	b.updated = now
+	if b.tokens < 1 {
+		return false, b.tokens, nil
+	}
+	b.tokens--
+	return true, b.tokens, nil
+}
+
+// sweepLocked drops buckets that have refilled completely, which behave
+// the same as a missing bucket.
+func (s *MemoryRateLimitStore) sweepLocked(now time.Time) {
+	if len(s.buckets) <= maxRateLimitBuckets && now.Sub(s.lastSweep) < 5*time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > b.full {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RedisRateLimitStore shares buckets between instances through Redis. When
+// Redis cannot be reached it falls back to per-instance buckets so the API
+// stays limited rather than failing open or closed.
+type RedisRateLimitStore struct {
+	cache    *cache.RedisCache
+	fallback *MemoryRateLimitStore
+	degraded atomic.Bool
+	logger   *zap.Logger
+}
+
+func NewRedisRateLimitStore(c *cache.RedisCache, logger *zap.Logger) *RedisRateLimitStore {
+	return &RedisRateLimitStore{cache: c, fallback: NewMemoryRateLimitStore(), logger: logger}
+}
+
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisRateLimitWait)
+	defer cancel()
+	allowed, remaining, err := s.cache.TakeToken(ctx, "ratelimit:"+key, float64(limit.Requests), limit.perSecond(), now)
+	if err != nil {
+		if !s.degraded.Swap(true) {
+			s.logger.Warn("redis rate limit unavailable; using local buckets", zap.Error(err))
+		}
+		return s.fallback.Take(ctx, key, limit, now)
+	}
+	if s.degraded.Swap(false) {
+		s.logger.Info("redis rate limit restored")
+	}
+	return allowed, remaining, nil
+}
+
+// RateLimiter applies a token bucket per route and per credential. Callers
+// are told apart by API token or session; callers without either are told
+// apart by address, resolved through trusted proxies. Addresses are keyed
+// with an HMAC under a key that never leaves the process and their buckets
+// stay in its memory, so no address reaches a shared store in any form.
+type RateLimiter struct {
+	config RateLimitConfig
+	store  RateLimitStore
+	// anonymous keeps the buckets of callers without credentials.
+	anonymous *MemoryRateLimitStore
+	addrKey   []byte
+	logger    *zap.Logger
+	now       func() time.Time
+}
+
+func NewRateLimiter(config RateLimitConfig, store RateLimitStore, logger *zap.Logger) *RateLimiter {
+	if config.Default.Requests <= 0 || config.Default.Per <= 0 {
+		config.Default = DefaultRateLimit
+	}
+	if store == nil {
+		store = NewMemoryRateLimitStore()
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	addrKey := make([]byte, sha256.Size)
+	if _, err := rand.Read(addrKey); err != nil {
+		panic(fmt.Sprintf("rate limiter: failed to generate address key: %v", err))
+	}
+	return &RateLimiter{
+		config:    config,
+		store:     store,
+		anonymous: NewMemoryRateLimitStore(),
+		addrKey:   addrKey,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := rateLimitRoute(r)
+		limit := rl.config.limitFor(r.Method, route)
+		client, anonymous := rl.client(r)
+		key := client + "|" + r.Method + " " + route
+		store := rl.store
+		if anonymous {
+			store = rl.anonymous
+		}
+
+		allowed, remaining, err := store.Take(r.Context(), key, limit, rl.now())
+		if err != nil {
+			rl.logger.Warn("rate limit check failed", zap.Error(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		perSecond := limit.perSecond()
+		reset := math.Ceil((float64(limit.Requests) - remaining) / perSecond)
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(remaining)))))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Max(0, reset))))
+		if !allowed {
+			retryAfter := math.Max(1, math.Ceil((1-remaining)/perSecond))
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitRoute names the matched route by its template so every torrent
+// shares the budget of its route. Unmatched paths have info hashes masked.
+func rateLimitRoute(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return normalizeRateLimitPath(r.URL.Path)
+}
+
+// client names the caller's bucket and reports whether the caller has no
+// credentials.
+func (rl *RateLimiter) client(r *http.Request) (string, bool) {
+	id, ok := auth.IdentityFromContext(r.Context())
+	switch {
+	case !ok || id.Method == auth.MethodOpen:
+		return rl.anonymousClient(r), true
+	case id.Token != nil:
+		return "token:" + strconv.FormatInt(id.Token.ID, 10), false
+	case id.Session != nil:
+		return "session:" + id.Session.TokenHash, false
+	default:
+		return id.Method, false
+	}
+}
+
+// anonymousClient keys a caller without credentials by an HMAC of its
+// address. A plain hash of an IPv4 address is reversed by trying them all;
+// the HMAC key is random per process. IPv6 callers are grouped by /64, the
+// block a single host is usually given.
+func (rl *RateLimiter) anonymousClient(r *http.Request) string {
+	addr, ok := rl.config.clientAddr(r)
+	if !ok {
+		return "anonymous"
+	}
+	if addr.Is6() {
+		addr = netip.PrefixFrom(addr, 64).Masked().Addr()
+	}
+	mac := hmac.New(sha256.New, rl.addrKey)
+	mac.Write(addr.AsSlice())
+	return "ip:" + hex.EncodeToString(mac.Sum(nil)[:12])
+}
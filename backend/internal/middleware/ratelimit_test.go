@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/auth"
+	"github.com/gorilla/mux"
+)
+
+func TestParseRateLimitRoutes(t *testing.T) {
+	routes, err := ParseRateLimitRoutes("POST /api/auth/login=10/1m, /api/torrents=5/30s")
+	if err != nil {
+		t.Fatalf("ParseRateLimitRoutes() error = %v", err)
+	}
+	config := RateLimitConfig{Default: DefaultRateLimit, Routes: routes}
+	for _, tc := range []struct {
+		method, route string
+		want          RateLimit
+	}{
+		{http.MethodPost, "/api/auth/login", RateLimit{Requests: 10, Per: time.Minute}},
+		{http.MethodGet, "/api/auth/login", DefaultRateLimit},
+		{http.MethodDelete, "/api/torrents", RateLimit{Requests: 5, Per: 30 * time.Second}},
+	} {
+		if got := config.limitFor(tc.method, tc.route); got != tc.want {
+			t.Fatalf("limitFor(%s %s) = %v, want %v", tc.method, tc.route, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"/api/torrents", "/api/torrents=0/1m", "api/torrents=1/1m", "/api/torrents=1/soon"} {
+		if _, err := ParseRateLimitRoutes(bad); err == nil {
+			t.Fatalf("ParseRateLimitRoutes(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestRateLimiterBucketsPerCredentialAndRefills(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	limiter := NewRateLimiter(RateLimitConfig{Default: RateLimit{Requests: 2, Per: time.Minute}}, nil, nil)
+	limiter.now = func() time.Time { return now }
+
+	r := mux.NewRouter()
+	r.Use(limiter.Middleware)
+	r.HandleFunc("/api/torrents/{infoHash}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	serve := func(path string, tokenID int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if tokenID != 0 {
+			id := &auth.Identity{Method: auth.MethodToken, Token: &auth.APIToken{ID: tokenID}}
+			req = req.WithContext(auth.WithIdentity(req.Context(), id))
+		}
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, req)
+		return res
+	}
+
+	// Different torrents share the route's bucket.
+	if res := serve("/api/torrents/a", 1); res.Code != http.StatusNoContent || res.Header().Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("first request = %d remaining %q", res.Code, res.Header().Get("RateLimit-Remaining"))
+	}
+	serve("/api/torrents/b", 1)
+	limited := serve("/api/torrents/c", 1)
+	if limited.Code != http.StatusTooManyRequests {
+		t.Fatalf("third request status = %d, want %d", limited.Code, http.StatusTooManyRequests)
+	}
+	if got := limited.Header().Get("Retry-After"); got != "30" {
+		t.Fatalf("Retry-After = %q, want 30", got)
+	}
+	if got := limited.Header().Get("RateLimit-Reset"); got != "60" {
+		t.Fatalf("RateLimit-Reset = %q, want 60", got)
+	}
+
+	if res := serve("/api/torrents/a", 2); res.Code != http.StatusNoContent {
+		t.Fatalf("other token status = %d, want %d", res.Code, http.StatusNoContent)
+	}
+	if res := serve("/api/torrents/a", 0); res.Code != http.StatusNoContent {
+		t.Fatalf("anonymous status = %d, want %d", res.Code, http.StatusNoContent)
+	}
+
+	now = now.Add(30 * time.Second)
+	if res := serve("/api/torrents/a", 1); res.Code != http.StatusNoContent {
+		t.Fatalf("refilled status = %d, want %d", res.Code, http.StatusNoContent)
+	}
+	if res := serve("/api/torrents/a", 1); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("drained status = %d, want %d", res.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimiterBucketsAnonymousCallersByAddress(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.1, 192.168.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := NewRateLimiter(RateLimitConfig{Default: RateLimit{Requests: 1, Per: time.Minute}, TrustedProxies: proxies}, nil, nil)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	if code := serve("203.0.113.1:1000", ""); code != http.StatusNoContent {
+		t.Fatalf("first caller = %d", code)
+	}
+	if code := serve("203.0.113.2:1000", ""); code != http.StatusNoContent {
+		t.Fatalf("second caller = %d, want its own bucket", code)
+	}
+	if code := serve("203.0.113.1:2000", "198.51.100.9"); code != http.StatusTooManyRequests {
+		t.Fatalf("untrusted peer spoofing X-Forwarded-For = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Behind the trusted proxies the nearest untrusted hop counts.
+	if code := serve("10.0.0.1:3000", "198.51.100.7, 203.0.113.5, 192.168.1.1"); code != http.StatusNoContent {
+		t.Fatalf("forwarded caller = %d", code)
+	}
+	if code := serve("10.0.0.1:3000", "203.0.113.5"); code != http.StatusTooManyRequests {
+		t.Fatalf("same forwarded caller = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := serve("[2001:db8::1]:1000", ""); code != http.StatusNoContent {
+		t.Fatalf("IPv6 caller = %d", code)
+	}
+	if code := serve("[2001:db8::2]:1000", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("IPv6 caller in the same /64 = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// Anonymous buckets never reach a shared store, and their keys are
+	// HMACs that differ between processes.
+	shared := &recordingStore{}
+	limiter = NewRateLimiter(RateLimitConfig{Default: RateLimit{Requests: 1, Per: time.Minute}}, shared, nil)
+	handler = limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve("203.0.113.1:1000", "")
+	if len(shared.keys) != 0 {
+		t.Fatalf("anonymous keys reached the shared store: %v", shared.keys)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.1:1000"
+	other := NewRateLimiter(RateLimitConfig{}, nil, nil)
+	if limiter.anonymousClient(req) == other.anonymousClient(req) {
+		t.Fatal("anonymous keys are the same in two processes")
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Fatal("ParseTrustedProxies accepted an invalid network")
+	}
+}
+
+type recordingStore struct {
+	keys []string
+}
+
+func (s *recordingStore) Take(_ context.Context, key string, limit RateLimit, _ time.Time) (bool, float64, error) {
+	s.keys = append(s.keys, key)
+	return true, float64(limit.Requests), nil
+}
@@ -8,13 +8,6 @@ import (
 	"os"
 	"regexp"
 	"strings"
-	"sync"
-	"time"
-)
-
-const (
-	defaultEndpointRateLimit = 100
-	maxRateLimitBuckets      = 512
 )
 
 var hashLikePathSegment = regexp.MustCompile(`(?i)/[a-f0-9]{40,64}(/|$)|/[a-z2-7]{32}(/|$)`)
@@ -38,7 +31,7 @@ func SecurityHeaders(next http.Handler) http.Handler {
 		w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'self'; connect-src 'self'; img-src 'self' data: blob:; style-src 'self' 'unsafe-inline'; font-src 'self'; base-uri 'self'; form-action 'self';")
 
 		// HSTS is only meaningful over HTTPS. The default local deployment is HTTP.
-		if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		if isHTTPS(r) {
 			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
 		}
 
@@ -64,66 +57,6 @@ func AnonymityHeaders(next http.Handler) http.Handler {
 	})
 }
 
-// RateLimiter implements token bucket rate limiting for fault tolerance
-type RateLimiter struct {
-	mu        sync.Mutex
-	requests  map[string]*bucket
-	lastSweep time.Time
-}
-
-type bucket struct {
-	tokens     int
-	lastRefill time.Time
-}
-
-func NewRateLimiter() *RateLimiter {
-	return &RateLimiter{
-		requests: make(map[string]*bucket),
-	}
-}
-
-func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Rate limit by endpoint, not IP for privacy
-		key := r.Method + " " + normalizeRateLimitPath(r.URL.Path)
-
-		rl.mu.Lock()
-		if rl.requests[key] == nil {
-			rl.requests[key] = &bucket{tokens: defaultEndpointRateLimit, lastRefill: time.Now()}
-		}
-		rl.sweepLocked(time.Now())
-
-		b := rl.requests[key]
-
-		// Refill tokens
-		if time.Since(b.lastRefill) > time.Minute {
-			b.tokens = defaultEndpointRateLimit
-			b.lastRefill = time.Now()
-		}
-
-		if b.tokens > 0 {
-			b.tokens--
-			rl.mu.Unlock()
-			next.ServeHTTP(w, r)
-		} else {
-			rl.mu.Unlock()
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-		}
-	})
-}
-
-func (rl *RateLimiter) sweepLocked(now time.Time) {
-	if len(rl.requests) <= maxRateLimitBuckets && now.Sub(rl.lastSweep) < 5*time.Minute {
-		return
-	}
-	rl.lastSweep = now
-	for key, bucket := range rl.requests {
-		if now.Sub(bucket.lastRefill) > 2*time.Minute {
-			delete(rl.requests, key)
-		}
-	}
-}
-
 func normalizeRateLimitPath(path string) string {
 	return hashLikePathSegment.ReplaceAllStringFunc(path, func(segment string) string {
 		if strings.HasSuffix(segment, "/") {
@@ -150,11 +83,12 @@ func CORS(next http.Handler) http.Handler {
 				return
 			}
 			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
 			w.Header().Add("Vary", "Origin")
 		}
 
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, PUT, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-B2-API-Key")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-B2-API-Key, "+CSRFHeader)
 		w.Header().Set("Access-Control-Max-Age", "3600")
 
 		if r.Method == "OPTIONS" {
@@ -168,18 +102,12 @@ func CORS(next http.Handler) http.Handler {
 
 func APIKey(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		expected := strings.TrimSpace(os.Getenv("B2_API_TOKEN"))
-		if expected == "" || r.Method == http.MethodOptions {
+		if strings.TrimSpace(os.Getenv("B2_API_TOKEN")) == "" || r.Method == http.MethodOptions {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		provided := strings.TrimSpace(r.Header.Get("X-B2-API-Key"))
-		if provided == "" {
-			provided = strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
-		}
-
-		if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+		if !apiKeyMatches(r) {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -188,6 +116,24 @@ func APIKey(next http.Handler) http.Handler {
 	})
 }
 
+// apiKeyMatches reports whether B2_API_TOKEN is set and the request carries
+// it.
+func apiKeyMatches(r *http.Request) bool {
+	expected := strings.TrimSpace(os.Getenv("B2_API_TOKEN"))
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(providedAPIKey(r)), []byte(expected)) == 1
+}
+
+// providedAPIKey returns the key sent in X-B2-API-Key or as a bearer token.
+func providedAPIKey(r *http.Request) string {
+	if provided := strings.TrimSpace(r.Header.Get("X-B2-API-Key")); provided != "" {
+		return provided
+	}
+	return strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+}
+
 func LimitRequestBody(maxBytes int64) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,386 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// JSON is the content type of every request body and of most responses.
+const JSON = "application/json"
+
+// GenerateClient renders the types and one method per operation of doc as
+// Go source in package pkg. The methods hang off a Client type, and rely on
+// helpers (do, stream and the query setters), written by hand in the same
+// package.
+func GenerateClient(doc *Document, pkg string) ([]byte, error) {
+	g := &clientGenerator{imports: map[string]bool{"context": true}}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g.writeType(name, doc.Components.Schemas[name])
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		methods := make([]string, 0, len(doc.Paths[p]))
+		for method := range doc.Paths[p] {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			if err := g.writeOperation(strings.ToUpper(method), p, doc.Paths[p][method]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by apigen from the backend's OpenAPI document. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	imports := make([]string, 0, len(g.imports))
+	for name := range g.imports {
+		imports = append(imports, name)
+	}
+	sort.Strings(imports)
+	for _, name := range imports {
+		fmt.Fprintf(&out, "\t%q\n", name)
+	}
+	out.WriteString(")\n")
+	out.Write(g.body.Bytes())
+
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated client: %w", err)
+	}
+	return source, nil
+}
+
+type clientGenerator struct {
+	body    bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *clientGenerator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+func (g *clientGenerator) writeType(name string, schema *Schema) {
+	g.printf("\n// %s is the %s schema.\ntype %s %s\n", name, name, name, g.goType(schema))
+}
+
+// goType returns the Go type of schema. Nullable values become pointers,
+// except where Go already has a nil value.
+func (g *clientGenerator) goType(schema *Schema) string {
+	if name := schema.RefName(); name != "" {
+		if schema.Nullable {
+			return "*" + name
+		}
+		return name
+	}
+
+	var base string
+	switch schema.Type {
+	case "string":
+		switch schema.Format {
+		case "date-time":
+			g.imports["time"] = true
+			base = "time.Time"
+		case "byte":
+			return "[]byte"
+		default:
+			base = "string"
+		}
+	case "integer":
+		base = "int"
+		if schema.Format == "int64" {
+			base = "int64"
+		}
+	case "number":
+		base = "float64"
+		if schema.Format == "float" {
+			base = "float32"
+		}
+	case "boolean":
+		base = "bool"
+	case "array":
+		return "[]" + g.goType(schema.Items)
+	case "object":
+		if schema.AdditionalProperties != nil {
+			return "map[string]" + g.goType(schema.AdditionalProperties)
+		}
+		return g.structType(schema)
+	default:
+		g.imports["encoding/json"] = true
+		return "json.RawMessage"
+	}
+	if schema.Nullable {
+		return "*" + base
+	}
+	return base
+}
+
+func (g *clientGenerator) structType(schema *Schema) string {
+	required := make(map[string]bool, len(schema.Required))
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, name := range names {
+		property := schema.Properties[name]
+		field := property.GoName
+		if field == "" {
+			field = exportedName(name)
+		}
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&b, "\t%s %s `json:%q`\n", field, g.goType(property), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// result describes how an operation's successful responses are returned.
+type result struct {
+	// goType is the returned type, or "" when only an error is returned.
+	goType string
+	// stream is set when the body is returned unread.
+	stream bool
+	// statuses holds the type of each success status when there are
+	// several of them; goType is then a generated struct.
+	statuses map[int]string
+}
+
+func (g *clientGenerator) writeOperation(method, path string, op *Operation) error {
+	res, err := g.operationResult(op)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+
+	var args []string
+	var pathParams, queryParams []Parameter
+	for _, param := range op.Parameters {
+		switch param.In {
+		case "path":
+			pathParams = append(pathParams, param)
+			args = append(args, fmt.Sprintf("%s %s", param.Name, g.goType(param.Schema)))
+		case "query":
+			queryParams = append(queryParams, param)
+		default:
+			return fmt.Errorf("%s %s: unsupported parameter location %q", method, path, param.In)
+		}
+	}
+	paramsType := op.OperationID + "Params"
+	if len(queryParams) > 0 {
+		g.writeParams(paramsType, queryParams)
+		args = append(args, "params *"+paramsType)
+	}
+	body := "nil"
+	if op.RequestBody != nil {
+		schema := op.RequestBody.Content[JSON].Schema
+		if schema == nil {
+			return fmt.Errorf("%s %s: request body is not JSON", method, path)
+		}
+		args = append(args, "body "+g.goType(schema))
+		body = "body"
+	}
+	query := "nil"
+	if len(queryParams) > 0 {
+		query = "params.values()"
+	}
+	urlPath := g.pathExpression(path, pathParams)
+
+	if len(res.statuses) > 0 {
+		g.writeResultType(op.OperationID+"Result", res.statuses)
+	}
+
+	g.printf("\n// %s %s.\n//\n// %s %s\n", op.OperationID, sentenceCase(op.Summary), method, path)
+	returns := "error"
+	if res.goType != "" {
+		returns = fmt.Sprintf("(%s, error)", res.goType)
+	}
+	g.printf("func (c *Client) %s(%s) %s {\n", op.OperationID, strings.Join(append([]string{"ctx context.Context"}, args...), ", "), returns)
+
+	switch {
+	case res.stream:
+		g.printf("return c.stream(ctx, %q, %s, %s, %s)\n", method, urlPath, query, body)
+	case len(res.statuses) > 0:
+		g.imports["encoding/json"] = true
+		g.printf("var raw json.RawMessage\nstatus, err := c.do(ctx, %q, %s, %s, %s, &raw)\nif err != nil {\nreturn nil, err\n}\n", method, urlPath, query, body)
+		g.printf("result := &%sResult{}\nswitch status {\n", op.OperationID)
+		for _, status := range sortedStatuses(res.statuses) {
+			field := statusField(status)
+			g.printf("case %d:\nresult.%s = new(%s)\nerr = json.Unmarshal(raw, result.%s)\n", status, field, res.statuses[status], field)
+		}
+		g.printf("}\nreturn result, err\n")
+	case res.goType == "":
+		g.printf("_, err := c.do(ctx, %q, %s, %s, %s, nil)\nreturn err\n", method, urlPath, query, body)
+	case strings.HasPrefix(res.goType, "*"):
+		g.printf("var result %s\nif _, err := c.do(ctx, %q, %s, %s, %s, &result); err != nil {\nreturn nil, err\n}\nreturn &result, nil\n",
+			strings.TrimPrefix(res.goType, "*"), method, urlPath, query, body)
+	default:
+		g.printf("var result %s\n_, err := c.do(ctx, %q, %s, %s, %s, &result)\nreturn result, err\n", res.goType, method, urlPath, query, body)
+	}
+	g.printf("}\n")
+	return nil
+}
+
+func (g *clientGenerator) operationResult(op *Operation) (result, error) {
+	types := map[int]string{}
+	streamed := false
+	for code, response := range op.Responses {
+		var status int
+		if _, err := fmt.Sscanf(code, "%d", &status); err != nil || status < 200 || status > 299 {
+			continue
+		}
+		if len(response.Content) == 0 {
+			types[status] = ""
+			continue
+		}
+		media, ok := response.Content[JSON]
+		if !ok {
+			streamed = true
+			types[status] = "io.ReadCloser"
+			continue
+		}
+		types[status] = g.goType(media.Schema)
+	}
+	if streamed {
+		if len(types) > 1 {
+			return result{}, fmt.Errorf("a streamed response must be the only success response")
+		}
+		g.imports["io"] = true
+		return result{goType: "io.ReadCloser", stream: true}, nil
+	}
+
+	switch len(types) {
+	case 0:
+		return result{}, fmt.Errorf("no success response")
+	case 1:
+		for _, goType := range types {
+			if goType == "" {
+				return result{}, nil
+			}
+			if isNamed(goType) {
+				goType = "*" + goType
+			}
+			return result{goType: goType}, nil
+		}
+	}
+	for status, goType := range types {
+		if goType == "" || !isNamed(goType) {
+			return result{}, fmt.Errorf("status %d: alternative responses must be named types", status)
+		}
+	}
+	return result{goType: "*" + op.OperationID + "Result", statuses: types}, nil
+}
+
+// isNamed reports whether goType is a generated struct type, returned by
+// pointer.
+func isNamed(goType string) bool {
+	return goType != "" && !strings.ContainsAny(goType, "[]*.{")
+}
+
+func (g *clientGenerator) writeResultType(name string, statuses map[int]string) {
+	g.printf("\n// %s holds the response of whichever status the server sent.\ntype %s struct {\n", name, name)
+	for _, status := range sortedStatuses(statuses) {
+		g.printf("%s *%s\n", statusField(status), statuses[status])
+	}
+	g.printf("}\n")
+}
+
+func (g *clientGenerator) writeParams(name string, params []Parameter) {
+	g.printf("\n// %s holds the optional query parameters; zero values are not sent.\ntype %s struct {\n", name, name)
+	for _, param := range params {
+		if param.Description != "" {
+			g.printf("// %s\n", param.Description)
+		}
+		schema := *param.Schema
+		schema.Nullable = false
+		g.printf("%s %s\n", exportedName(param.Name), g.goType(&schema))
+	}
+	g.printf("}\n\nfunc (p *%s) values() url.Values {\nq := url.Values{}\nif p == nil {\nreturn q\n}\n", name)
+	for _, param := range params {
+		schema := *param.Schema
+		schema.Nullable = false
+		setter := map[string]string{
+			"string":    "setString",
+			"int":       "setInt",
+			"int64":     "setInt64",
+			"bool":      "setBool",
+			"time.Time": "setTime",
+		}[g.goType(&schema)]
+		if setter == "" {
+			setter = "setString"
+		}
+		g.printf("%s(q, %q, p.%s)\n", setter, param.Name, exportedName(param.Name))
+	}
+	g.printf("return q\n}\n")
+	g.imports["net/url"] = true
+}
+
+// pathExpression returns a Go expression building path with escaped path
+// parameters.
+func (g *clientGenerator) pathExpression(path string, params []Parameter) string {
+	expression := fmt.Sprintf("%q", path)
+	for _, param := range params {
+		value := param.Name
+		switch g.goType(param.Schema) {
+		case "int64":
+			g.imports["strconv"] = true
+			value = fmt.Sprintf("strconv.FormatInt(%s, 10)", param.Name)
+		case "int":
+			g.imports["strconv"] = true
+			value = fmt.Sprintf("strconv.Itoa(%s)", param.Name)
+		default:
+			g.imports["net/url"] = true
+			value = fmt.Sprintf("url.PathEscape(%s)", param.Name)
+		}
+		expression = strings.Replace(expression, "{"+param.Name+"}", `"+`+value+`+"`, 1)
+	}
+	return strings.TrimSuffix(expression, `+""`)
+}
+
+func sortedStatuses(statuses map[int]string) []int {
+	codes := make([]int, 0, len(statuses))
+	for status := range statuses {
+		codes = append(codes, status)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// statusField names a result field after its status text, e.g. Accepted
+// for 202.
+func statusField(status int) string {
+	return exportedName(http.StatusText(status))
+}
+
+// sentenceCase lower-cases the first letter of a summary so it can follow
+// the method name, leaving acronyms alone.
+func sentenceCase(summary string) string {
+	if len(summary) < 2 || unicode.IsUpper(rune(summary[1])) {
+		return summary
+	}
+	return strings.ToLower(summary[:1]) + summary[1:]
+}
@@ -0,0 +1,299 @@
+// Package openapi describes the HTTP API as an OpenAPI 3.0 document built
+// from the Go request and response types, and generates the Go client in
+// pkg/client from that document.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Version is the OpenAPI version of generated documents.
+const Version = "3.0.3"
+
+// Document is an OpenAPI 3.0 document. Only the parts the backend uses are
+// modelled.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// SecurityRequirement maps a security scheme name to required scopes.
+type SecurityRequirement map[string][]string
+
+// PathItem maps a lower-case HTTP method to its operation.
+type PathItem map[string]*Operation
+
+// Operation is one method on one path. Role and Scope record what a
+// signed-in user and an API token need to call it.
+type Operation struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]*Response   `json:"responses"`
+	Security    *[]SecurityRequirement `json:"security,omitempty"`
+	Role        string                 `json:"x-role,omitempty"`
+	Scope       string                 `json:"x-scope,omitempty"`
+}
+
+// Parameter is a path or query parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is the subset of JSON Schema produced from Go types. GoName keeps
+// the Go field name so the generated client matches the server types.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	GoName               string             `json:"x-go-name,omitempty"`
+}
+
+// RefName returns the component name s refers to, directly or as the only
+// member of allOf, or "" if s is not a reference.
+func (s *Schema) RefName() string {
+	if s == nil {
+		return ""
+	}
+	ref := s.Ref
+	if ref == "" && len(s.AllOf) == 1 {
+		ref = s.AllOf[0].Ref
+	}
+	return strings.TrimPrefix(ref, "#/components/schemas/")
+}
+
+// Marshal renders the document as indented JSON with a trailing newline.
+// Map keys are sorted, so the output is stable.
+func (d *Document) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schemas turns Go types into schemas, collecting named structs as
+// components. Two structs with the same name in different packages are told
+// apart by prefixing the later one with its package name.
+type Schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func NewSchemas() *Schemas {
+	return &Schemas{components: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+// Name sets the component name of t, for types whose own name is too
+// generic once separated from their package. It must be called before t is
+// first used.
+func (s *Schemas) Name(t reflect.Type, name string) {
+	s.names[t] = name
+}
+
+// Components returns the named schemas collected so far.
+func (s *Schemas) Components() map[string]*Schema {
+	return s.components
+}
+
+// For returns the schema of t. Named structs are returned as references.
+func (s *Schemas) For(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(s.For(t.Elem()))
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.For(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.For(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+	}
+	panic(fmt.Sprintf("openapi: unsupported type %s", t))
+}
+
+// nullable marks a schema as accepting null. References cannot carry
+// siblings in OpenAPI 3.0, so they are wrapped in allOf.
+func nullable(schema *Schema) *Schema {
+	if schema.Ref != "" {
+		return &Schema{AllOf: []*Schema{schema}, Nullable: true}
+	}
+	schema.Nullable = true
+	return schema
+}
+
+func (s *Schemas) component(t reflect.Type) string {
+	name, named := s.names[t]
+	if _, built := s.components[name]; named && built {
+		return name
+	}
+	if !named {
+		name = t.Name()
+		if _, taken := s.components[name]; taken {
+			name = exportedName(path.Base(t.PkgPath())) + name
+		}
+		s.names[t] = name
+	}
+	// Reserve the name before building the schema so recursive types
+	// resolve to the reference.
+	s.components[name] = nil
+	s.components[name] = s.object(t)
+	return name
+}
+
+// object builds a struct schema following encoding/json: unexported and
+// "-" fields are skipped, embedded structs without a tag are inlined and
+// fields without omitempty are required.
+func (s *Schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.addFields(schema, t)
+	sort.Strings(schema.Required)
+	return schema
+}
+
+func (s *Schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(schema, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := s.For(field.Type)
+		if strings.Contains(","+options+",", ",string,") {
+			property = &Schema{Type: "string"}
+		}
+		if property.Ref != "" {
+			// Keep the reference untouched; x-go-name goes on a wrapper.
+			property = &Schema{AllOf: []*Schema{property}}
+		}
+		property.GoName = field.Name
+		schema.Properties[name] = property
+		if !strings.Contains(","+options+",", ",omitempty,") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// exportedName turns a package name or path segment into an exported Go
+// identifier, e.g. "secure-delete" becomes "SecureDelete".
+func exportedName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package openapi
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type base struct {
+	ID int64 `json:"id"`
+}
+
+type child struct {
+	Name string `json:"name"`
+}
+
+type sample struct {
+	base
+	Title    string            `json:"title"`
+	Note     string            `json:"note,omitempty"`
+	Child    *child            `json:"child,omitempty"`
+	Children []child           `json:"children"`
+	Labels   map[string]string `json:"labels"`
+	At       time.Time         `json:"at"`
+	Count    *int              `json:"count"`
+	Hidden   string            `json:"-"`
+	internal string
+}
+
+func TestSchemasFollowEncodingJSON(t *testing.T) {
+	schemas := NewSchemas()
+	ref := schemas.For(reflect.TypeOf(sample{}))
+	if ref.RefName() != "sample" {
+		t.Fatalf("ref = %+v", ref)
+	}
+	schema := schemas.Components()["sample"]
+
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "at,child,children,count,id,labels,note,title" {
+		t.Fatalf("properties = %s", got)
+	}
+	if got := strings.Join(schema.Required, ","); got != "at,children,count,id,labels,title" {
+		t.Fatalf("required = %s", got)
+	}
+	if child := schema.Properties["child"]; !child.Nullable || child.RefName() != "child" || child.GoName != "Child" {
+		t.Fatalf("child = %+v", child)
+	}
+	if count := schema.Properties["count"]; count.Type != "integer" || !count.Nullable {
+		t.Fatalf("count = %+v", count)
+	}
+	if at := schema.Properties["at"]; at.Format != "date-time" {
+		t.Fatalf("at = %+v", at)
+	}
+	if labels := schema.Properties["labels"]; labels.AdditionalProperties == nil || labels.AdditionalProperties.Type != "string" {
+		t.Fatalf("labels = %+v", labels)
+	}
+}
+
+func otherStatus() reflect.Type {
+	type Status struct {
+		Code int `json:"code"`
+	}
+	return reflect.TypeOf(Status{})
+}
+
+func TestSchemasNameComponents(t *testing.T) {
+	type Status struct {
+		OK bool `json:"ok"`
+	}
+	schemas := NewSchemas()
+	schemas.Name(reflect.TypeOf(child{}), "Renamed")
+
+	first := schemas.For(reflect.TypeOf(Status{}))
+	second := schemas.For(otherStatus())
+	renamed := schemas.For(reflect.TypeOf(child{}))
+
+	if first.RefName() != "Status" || second.RefName() != "OpenapiStatus" || renamed.RefName() != "Renamed" {
+		t.Fatalf("names = %s, %s, %s", first.RefName(), second.RefName(), renamed.RefName())
+	}
+}
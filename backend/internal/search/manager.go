@@ -0,0 +1,625 @@
+package search
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"go.uber.org/zap"
+)
+
+// Sort orders.
+const (
+	SortSeeders = "seeders"
+	SortSize    = "size"
+)
+
+const (
+	DefaultLimit   = 100
+	MaxLimit       = 500
+	maxQueryLength = 256
+	// maxResponseSize bounds an indexer's answer to one search.
+	maxResponseSize = 10 << 20
+	// maxCachedSearches is how many searches keep their results addable.
+	maxCachedSearches = 20
+	resultTTL         = time.Hour
+)
+
+// queryTimeout bounds each indexer's answer, so that one slow indexer does
+// not hold up the others' results.
+var queryTimeout = 30 * time.Second
+
+// Query is a search. Indexers narrows it to some indexers by ID and
+// Categories overrides their default categories.
+type Query struct {
+	Text       string
+	Categories []int
+	Indexers   []string
+	// Sort is SortSeeders, the default, or SortSize; Ascending reverses it.
+	Sort      string
+	Ascending bool
+	Limit     int
+}
+
+// Result is a torrent found by one or more indexers. Its links stay on the
+// server; add it with Manager.Add and its ID.
+type Result struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	InfoHash    string     `json:"infoHash,omitempty"`
+	Size        int64      `json:"size"`
+	Seeders     int        `json:"seeders"`
+	Leechers    int        `json:"leechers"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+	// Indexers are the IDs of the indexers that returned the torrent.
+	Indexers []string `json:"indexers"`
+
+	links []string
+}
+
+// IndexerStatus reports how one indexer answered a search.
+type IndexerStatus struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Results int    `json:"results"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Response is the outcome of a search. An indexer failing is reported in
+// Indexers rather than failing the search.
+type Response struct {
+	Results  []Result        `json:"results"`
+	Indexers []IndexerStatus `json:"indexers"`
+}
+
+type cachedSearch struct {
+	at    time.Time
+	links map[string][]string
+}
+
+// Manager keeps the indexer configuration and runs searches.
+//
+// The indexers are stored encrypted, so after a restart they cannot be read
+// until the keyring is unlocked. Until then every call that needs them
+// returns security.ErrKeyringLocked instead of searching no indexer at all.
+type Manager struct {
+	mu sync.Mutex
+	// loaded is set once the stored indexers were read, which needs an
+	// unlocked keyring once they are encrypted.
+	loaded   bool
+	indexers []Indexer
+	// searches hold the links of recent results, oldest first.
+	searches []cachedSearch
+	// base is cancelled by Cancel, stopping the searches and adds in flight.
+	base   context.Context
+	cancel context.CancelFunc
+
+	settings settingsStore
+	adder    torrent.Adder
+	client   *http.Client
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+// NewManager returns a manager that queries indexers with client.
+func NewManager(settings settingsStore, adder torrent.Adder, client *http.Client, logger *zap.Logger) *Manager {
+	m := &Manager{
+		settings: settings,
+		adder:    adder,
+		client:   client,
+		logger:   logger,
+		now:      time.Now,
+	}
+	m.base, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+// Indexers returns every indexer, without API keys.
+func (m *Manager) Indexers() ([]Indexer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(); err != nil {
+		return nil, err
+	}
+	indexers := make([]Indexer, len(m.indexers))
+	for i := range m.indexers {
+		indexers[i] = m.indexers[i].public()
+	}
+	return indexers, nil
+}
+
+// Indexer returns one indexer, without its API key.
+func (m *Manager) Indexer(id string) (Indexer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.findLocked(id)
+	if err != nil {
+		return Indexer{}, err
+	}
+	return m.indexers[i].public(), nil
+}
+
+// CreateIndexer validates and stores a new indexer.
+func (m *Manager) CreateIndexer(ix Indexer) (Indexer, error) {
+	ix.ID = newID()
+	if err := ix.prepare(); err != nil {
+		return Indexer{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(); err != nil {
+		return Indexer{}, err
+	}
+	if len(m.indexers) >= maxIndexers {
+		return Indexer{}, fmt.Errorf("%w: at most %d indexers can be configured", ErrInvalid, maxIndexers)
+	}
+	indexers := append(append([]Indexer{}, m.indexers...), ix)
+	if err := m.saveLocked(indexers); err != nil {
+		return Indexer{}, err
+	}
+	return ix.public(), nil
+}
+
+// UpdateIndexer replaces an indexer's settings. Its API key is kept unless
+// a new one is given.
+func (m *Manager) UpdateIndexer(id string, ix Indexer) (Indexer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.findLocked(id)
+	if err != nil {
+		return Indexer{}, err
+	}
+	ix.ID = id
+	if err := ix.prepare(); err != nil {
+		return Indexer{}, err
+	}
+	if ix.APIKey == "" {
+		ix.APIKey = m.indexers[i].APIKey
+		ix.HasAPIKey = ix.APIKey != ""
+	}
+	indexers := append([]Indexer{}, m.indexers...)
+	indexers[i] = ix
+	if err := m.saveLocked(indexers); err != nil {
+		return Indexer{}, err
+	}
+	return ix.public(), nil
+}
+
+// DeleteIndexer removes an indexer. Results it returned can still be added
+// until they expire.
+func (m *Manager) DeleteIndexer(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, err := m.findLocked(id)
+	if err != nil {
+		return err
+	}
+	indexers := append([]Indexer{}, m.indexers...)
+	return m.saveLocked(append(indexers[:i], indexers[i+1:]...))
+}
+
+// Reset forgets every indexer and result. The stored indexers are expected
+// to have been deleted with the other settings.
+func (m *Manager) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indexers = nil
+	m.loaded = true
+	m.searches = nil
+}
+
+// Cancel stops every search and add in flight and forgets recent results,
+// so that none of them can be added any more. Later calls work as usual.
+func (m *Manager) Cancel() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancel()
+	m.base, m.cancel = context.WithCancel(context.Background())
+	m.searches = nil
+}
+
+// bind derives a context that Cancel also ends.
+func (m *Manager) bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	m.mu.Lock()
+	base := m.base
+	m.mu.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(base, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Reload reads the stored indexers again on next use, after they were
+// replaced by a settings import. Recent results stay addable.
+func (m *Manager) Reload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indexers = nil
+	m.loaded = false
+}
+
+// Search queries the selected indexers in parallel and merges their results
+// by info hash.
+func (m *Manager) Search(ctx context.Context, q Query) (Response, error) {
+	q.Text = strings.TrimSpace(q.Text)
+	if q.Text == "" || len(q.Text) > maxQueryLength {
+		return Response{}, fmt.Errorf("%w: q must be 1 to %d characters", ErrInvalid, maxQueryLength)
+	}
+	if q.Sort == "" {
+		q.Sort = SortSeeders
+	}
+	if q.Sort != SortSeeders && q.Sort != SortSize {
+		return Response{}, fmt.Errorf("%w: sort must be %s or %s", ErrInvalid, SortSeeders, SortSize)
+	}
+	if len(q.Categories) > maxCategories {
+		return Response{}, fmt.Errorf("%w: at most %d categories can be searched", ErrInvalid, maxCategories)
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit > MaxLimit {
+		q.Limit = MaxLimit
+	}
+
+	indexers, err := m.selectIndexers(q.Indexers)
+	if err != nil {
+		return Response{}, err
+	}
+	ctx, cancel := m.bind(ctx)
+	defer cancel()
+
+	hits := make([][]hit, len(indexers))
+	statuses := make([]IndexerStatus, len(indexers))
+	var wg sync.WaitGroup
+	for i, ix := range indexers {
+		statuses[i] = IndexerStatus{ID: ix.ID, Name: ix.Name}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := m.query(ctx, ix, q)
+			if err != nil {
+				statuses[i].Error = errorText(err)
+				if ctx.Err() == nil {
+					m.logger.Warn("Indexer search failed", zap.String("indexer", ix.ID), zap.String("error", statuses[i].Error))
+				}
+				return
+			}
+			hits[i] = found
+			statuses[i].Results = len(found)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return Response{}, err
+	}
+
+	results := merge(indexers, hits)
+	sortResults(results, q.Sort, q.Ascending)
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+	m.remember(results)
+	return Response{Results: results, Indexers: statuses}, nil
+}
+
+// Add adds a result of a recent search, trying each indexer's link until
+// one can be downloaded.
+func (m *Manager) Add(ctx context.Context, id string, opts torrent.AddOptions) (string, error) {
+	ctx, cancel := m.bind(ctx)
+	defer cancel()
+	links := m.links(id)
+	if len(links) == 0 {
+		return "", ErrResultNotFound
+	}
+	var failures []error
+	for _, link := range links {
+		if isMagnet(link) {
+			return m.adder.AddMagnetContext(ctx, link, opts)
+		}
+		data, magnet, err := m.download(ctx, link)
+		if errors.Is(err, ErrDownload) {
+			failures = append(failures, err)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if magnet != "" {
+			return m.adder.AddMagnetContext(ctx, magnet, opts)
+		}
+		return m.adder.AddTorrentFileWithOptions(data, opts)
+	}
+	return "", errors.Join(failures...)
+}
+
+// selectIndexers returns the enabled indexers among ids, or all of them.
+func (m *Manager) selectIndexers(ids []string) ([]Indexer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.loadLocked(); err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if m.indexLocked(id) < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrIndexerNotFound, id)
+		}
+	}
+	var selected []Indexer
+	for _, ix := range m.indexers {
+		if ix.Disabled || (len(ids) > 0 && !contains(ids, ix.ID)) {
+			continue
+		}
+		ix.Categories = append([]int(nil), ix.Categories...)
+		selected = append(selected, ix)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("%w: no enabled indexer to search", ErrInvalid)
+	}
+	return selected, nil
+}
+
+// query runs a search on one indexer.
+func (m *Manager) query(ctx context.Context, ix Indexer, q Query) ([]hit, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	u, err := url.Parse(ix.URL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api"
+	params := u.Query()
+	params.Set("t", "search")
+	params.Set("q", q.Text)
+	params.Set("extended", "1")
+	params.Set("limit", strconv.Itoa(q.Limit))
+	if ix.APIKey != "" {
+		params.Set("apikey", ix.APIKey)
+	}
+	categories := q.Categories
+	if len(categories) == 0 {
+		categories = ix.Categories
+	}
+	if len(categories) > 0 {
+		cats := make([]string, len(categories))
+		for i, category := range categories {
+			cats[i] = strconv.Itoa(category)
+		}
+		params.Set("cat", strings.Join(cats, ","))
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("response is larger than %d bytes", maxResponseSize)
+	}
+	hits, err := parseResponse(data)
+	var indexerErr *indexerError
+	if res.StatusCode != http.StatusOK && !errors.As(err, &indexerErr) {
+		return nil, fmt.Errorf("indexer returned %s", res.Status)
+	}
+	return hits, err
+}
+
+// download fetches a result's .torrent file. Indexers such as Jackett
+// answer with a redirect to a magnet link for magnet-only trackers, which
+// is returned instead.
+func (m *Manager) download(ctx context.Context, link string) ([]byte, string, error) {
+	client := *m.client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme == "magnet" {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrDownload, errorText(err))
+	}
+	defer res.Body.Close()
+	if location := res.Header.Get("Location"); isMagnet(location) {
+		return nil, location, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%w: indexer returned %s", ErrDownload, res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, torrent.MaxTorrentFileSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrDownload, errorText(err))
+	}
+	if len(data) > torrent.MaxTorrentFileSize {
+		return nil, "", fmt.Errorf("torrent file is larger than %d bytes", torrent.MaxTorrentFileSize)
+	}
+	return data, "", nil
+}
+
+// merge folds the indexers' hits into results, one per info hash. Hits
+// without an info hash are kept apart.
+func merge(indexers []Indexer, hits [][]hit) []Result {
+	results := []Result{}
+	byHash := make(map[string]int)
+	for i, found := range hits {
+		for _, h := range found {
+			if j, ok := byHash[h.InfoHash]; ok && h.InfoHash != "" {
+				r := &results[j]
+				if h.Seeders > r.Seeders {
+					r.Title = h.Title
+					r.Seeders = h.Seeders
+				}
+				r.Leechers = max(r.Leechers, h.Leechers)
+				if r.Size == 0 {
+					r.Size = h.Size
+				}
+				if r.PublishedAt == nil {
+					r.PublishedAt = h.PublishedAt
+				}
+				if !contains(r.Indexers, indexers[i].ID) {
+					r.Indexers = append(r.Indexers, indexers[i].ID)
+				}
+				for _, link := range h.Links {
+					if !contains(r.links, link) {
+						r.links = append(r.links, link)
+					}
+				}
+				continue
+			}
+			id := h.InfoHash
+			if id == "" {
+				sum := sha256.Sum256([]byte(indexers[i].ID + "\x00" + h.Links[0]))
+				id = hex.EncodeToString(sum[:16])
+			} else {
+				byHash[h.InfoHash] = len(results)
+			}
+			results = append(results, Result{
+				ID:          id,
+				Title:       h.Title,
+				InfoHash:    h.InfoHash,
+				Size:        h.Size,
+				Seeders:     h.Seeders,
+				Leechers:    h.Leechers,
+				PublishedAt: h.PublishedAt,
+				Indexers:    []string{indexers[i].ID},
+				links:       append([]string(nil), h.Links...),
+			})
+		}
+	}
+	return results
+}
+
+func sortResults(results []Result, by string, ascending bool) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if ascending {
+			a, b = b, a
+		}
+		if by == SortSize && a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.Seeders > b.Seeders
+	})
+}
+
+// remember keeps the links of results so that they can be added.
+func (m *Manager) remember(results []Result) {
+	links := make(map[string][]string, len(results))
+	for _, r := range results {
+		links[r.ID] = r.links
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked()
+	m.searches = append(m.searches, cachedSearch{at: m.now(), links: links})
+	if len(m.searches) > maxCachedSearches {
+		m.searches = m.searches[len(m.searches)-maxCachedSearches:]
+	}
+}
+
+// links returns the links of a result from the newest search that found it.
+func (m *Manager) links(id string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked()
+	for i := len(m.searches) - 1; i >= 0; i-- {
+		if links, ok := m.searches[i].links[id]; ok {
+			return links
+		}
+	}
+	return nil
+}
+
+func (m *Manager) pruneLocked() {
+	now := m.now()
+	for len(m.searches) > 0 && now.Sub(m.searches[0].at) > resultTTL {
+		m.searches = m.searches[1:]
+	}
+}
+
+// loadLocked reads the stored indexers the first time it succeeds. The
+// caller holds m.mu.
+func (m *Manager) loadLocked() error {
+	if m.loaded {
+		return nil
+	}
+	indexers, err := loadIndexers(m.settings)
+	if err != nil {
+		return err
+	}
+	m.indexers = indexers
+	m.loaded = true
+	return nil
+}
+
+// findLocked loads the indexers and returns the index of one. The caller
+// holds m.mu.
+func (m *Manager) findLocked(id string) (int, error) {
+	if err := m.loadLocked(); err != nil {
+		return -1, err
+	}
+	if i := m.indexLocked(id); i >= 0 {
+		return i, nil
+	}
+	return -1, ErrIndexerNotFound
+}
+
+func (m *Manager) indexLocked(id string) int {
+	for i := range m.indexers {
+		if m.indexers[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Manager) saveLocked(indexers []Indexer) error {
+	if err := saveIndexers(m.settings, indexers); err != nil {
+		return fmt.Errorf("failed to save indexers: %w", err)
+	}
+	m.indexers = indexers
+	return nil
+}
+
+// errorText describes err without the URL a request failed for, which
+// carries the API key.
+func errorText(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
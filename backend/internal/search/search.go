@@ -0,0 +1,160 @@
+// Package search queries Torznab and Newznab compatible indexers, such as a
+// Jackett or Prowlarr instance, for torrents.
+//
+// Indexers are queried in parallel through the torrent client's HTTP client,
+// so through the proxy chain when one is configured. Their results are
+// merged by info hash and kept in memory for a while, so that a result can
+// be added by its ID without its download link, which usually carries the
+// indexer's API key, ever reaching the API.
+//
+// Indexers are kept in a settings row, encrypted at rest once the keyring
+// exists. API keys are write-only: the API reports whether an indexer has
+// one, never the key.
+package search
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// SettingKey is the settings row indexers are stored in. The torznab_
+// prefix marks it sensitive.
+const SettingKey = "torznab_indexers"
+
+const (
+	maxIndexers   = 50
+	maxCategories = 50
+)
+
+var (
+	ErrIndexerNotFound = errors.New("indexer not found")
+	// ErrResultNotFound is returned for results that expired or never
+	// existed; search again to add them.
+	ErrResultNotFound = errors.New("search result not found or expired")
+	// ErrInvalid wraps every validation error.
+	ErrInvalid = errors.New("invalid search")
+	// ErrDownload wraps failures to fetch a result's .torrent file.
+	ErrDownload = errors.New("download from indexer failed")
+)
+
+// Indexer is a Torznab or Newznab endpoint, such as
+// http://jackett:9117/api/v2.0/indexers/all/results/torznab/. Queries go to
+// its api path.
+type Indexer struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// APIKey is accepted but never returned; HasAPIKey reports it.
+	APIKey    string `json:"apiKey,omitempty"`
+	HasAPIKey bool   `json:"hasApiKey"`
+	// Categories restrict searches that name none, e.g. 2000 for movies.
+	Categories []int `json:"categories,omitempty"`
+	Disabled   bool  `json:"disabled,omitempty"`
+}
+
+type settingsStore interface {
+	GetSetting(key string) (string, error)
+	SetSetting(key, value string) error
+}
+
+// prepare validates an indexer. An apikey parameter pasted with the URL is
+// moved to APIKey.
+func (ix *Indexer) prepare() error {
+	ix.Name = strings.TrimSpace(ix.Name)
+	ix.URL = strings.TrimSpace(ix.URL)
+	ix.APIKey = strings.TrimSpace(ix.APIKey)
+	u, err := url.Parse(ix.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return fmt.Errorf("%w: url must be an http or https URL without credentials", ErrInvalid)
+	}
+	query := u.Query()
+	if key := query.Get("apikey"); key != "" {
+		if ix.APIKey == "" {
+			ix.APIKey = key
+		}
+		query.Del("apikey")
+		u.RawQuery = query.Encode()
+		ix.URL = u.String()
+	}
+	if ix.Name == "" {
+		ix.Name = u.Hostname()
+	}
+	if len(ix.Name) > 128 {
+		return fmt.Errorf("%w: name is longer than 128 characters", ErrInvalid)
+	}
+	if len(ix.APIKey) > 256 {
+		return fmt.Errorf("%w: apiKey is longer than 256 characters", ErrInvalid)
+	}
+	if len(ix.Categories) > maxCategories {
+		return fmt.Errorf("%w: an indexer has at most %d categories", ErrInvalid, maxCategories)
+	}
+	for _, category := range ix.Categories {
+		if category <= 0 {
+			return fmt.Errorf("%w: categories must be positive numbers", ErrInvalid)
+		}
+	}
+	ix.HasAPIKey = ix.APIKey != ""
+	return nil
+}
+
+// ValidateIndexers checks a stored indexer list, such as one being
+// imported, the way CreateIndexer checks a new indexer.
+func ValidateIndexers(value string) error {
+	var indexers []Indexer
+	if err := json.Unmarshal([]byte(value), &indexers); err != nil {
+		return fmt.Errorf("%w: indexers must be a list of indexers", ErrInvalid)
+	}
+	if len(indexers) > maxIndexers {
+		return fmt.Errorf("%w: at most %d indexers can be configured", ErrInvalid, maxIndexers)
+	}
+	ids := make(map[string]bool, len(indexers))
+	for _, ix := range indexers {
+		if ix.ID == "" || ids[ix.ID] {
+			return fmt.Errorf("%w: every indexer needs a unique id", ErrInvalid)
+		}
+		ids[ix.ID] = true
+		if err := ix.prepare(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// public returns the indexer without its API key.
+func (ix Indexer) public() Indexer {
+	ix.HasAPIKey = ix.APIKey != ""
+	ix.APIKey = ""
+	ix.Categories = append([]int(nil), ix.Categories...)
+	return ix
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func loadIndexers(settings settingsStore) ([]Indexer, error) {
+	value, err := settings.GetSetting(SettingKey)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	var indexers []Indexer
+	if err := json.Unmarshal([]byte(value), &indexers); err != nil {
+		return nil, fmt.Errorf("failed to read indexers: %w", err)
+	}
+	return indexers, nil
+}
+
+func saveIndexers(settings settingsStore, indexers []Indexer) error {
+	data, err := json.Marshal(indexers)
+	if err != nil {
+		return err
+	}
+	return settings.SetSetting(SettingKey, string(data))
+}
@@ -0,0 +1,191 @@
+package search
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hit is one item of an indexer's response.
+type hit struct {
+	Title       string
+	InfoHash    string
+	Size        int64
+	Seeders     int
+	Leechers    int
+	PublishedAt *time.Time
+	// Links are magnet links and .torrent URLs, best first.
+	Links []string
+}
+
+type torznabResponse struct {
+	XMLName     xml.Name
+	Code        string        `xml:"code,attr"`
+	Description string        `xml:"description,attr"`
+	Items       []torznabItem `xml:"channel>item"`
+}
+
+type torznabItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	Size      string `xml:"size"`
+	PubDate   string `xml:"pubDate"`
+	Enclosure struct {
+		URL    string `xml:"url,attr"`
+		Length string `xml:"length,attr"`
+	} `xml:"enclosure"`
+	Attrs []struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"attr"`
+}
+
+// indexerError is an error the indexer answered with, such as a wrong API
+// key.
+type indexerError struct {
+	code        string
+	description string
+}
+
+func (e *indexerError) Error() string {
+	return fmt.Sprintf("indexer error %s: %s", e.code, e.description)
+}
+
+// parseResponse reads a Torznab or Newznab search response. Items without
+// a usable link are left out.
+func parseResponse(data []byte) ([]hit, error) {
+	var doc torznabResponse
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("not a Torznab response: %w", err)
+	}
+	switch doc.XMLName.Local {
+	case "rss":
+	case "error":
+		return nil, &indexerError{code: doc.Code, description: doc.Description}
+	default:
+		return nil, fmt.Errorf("not a Torznab response: root element is <%s>", doc.XMLName.Local)
+	}
+
+	var hits []hit
+	for _, item := range doc.Items {
+		h := hit{Title: strings.Join(strings.Fields(item.Title), " ")}
+		h.Size = parseInt64(item.Size)
+		if h.Size == 0 {
+			h.Size = parseInt64(item.Enclosure.Length)
+		}
+		if t, err := time.Parse(time.RFC1123Z, strings.TrimSpace(item.PubDate)); err == nil {
+			t = t.UTC()
+			h.PublishedAt = &t
+		}
+		peers := -1
+		var magnet string
+		for _, attr := range item.Attrs {
+			value := strings.TrimSpace(attr.Value)
+			switch attr.Name {
+			case "seeders":
+				h.Seeders, _ = strconv.Atoi(value)
+			case "peers":
+				peers, _ = strconv.Atoi(value)
+			case "leechers":
+				if peers < 0 {
+					h.Leechers, _ = strconv.Atoi(value)
+				}
+			case "size":
+				if h.Size == 0 {
+					h.Size = parseInt64(value)
+				}
+			case "infohash":
+				h.InfoHash = normalizeInfoHash(value)
+			case "magneturl":
+				magnet = value
+			}
+		}
+		// Torznab peers count seeders too.
+		if peers >= 0 {
+			h.Leechers = max(peers-h.Seeders, 0)
+		}
+		for _, link := range []string{magnet, item.Enclosure.URL, item.Link} {
+			link = strings.TrimSpace(link)
+			if !usableLink(link) || contains(h.Links, link) {
+				continue
+			}
+			h.Links = append(h.Links, link)
+			if h.InfoHash == "" && isMagnet(link) {
+				h.InfoHash = magnetInfoHash(link)
+			}
+		}
+		if h.Title == "" || len(h.Links) == 0 {
+			continue
+		}
+		hits = append(hits, h)
+	}
+	return hits, nil
+}
+
+func parseInt64(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func isMagnet(link string) bool {
+	return strings.HasPrefix(link, "magnet:?")
+}
+
+func usableLink(link string) bool {
+	return isMagnet(link) || strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://")
+}
+
+func contains(links []string, link string) bool {
+	for _, existing := range links {
+		if existing == link {
+			return true
+		}
+	}
+	return false
+}
+
+// magnetInfoHash returns the BitTorrent v1 info hash of a magnet link, in
+// lowercase hex, or "".
+func magnetInfoHash(magnet string) string {
+	query, err := url.ParseQuery(strings.TrimPrefix(magnet, "magnet:?"))
+	if err != nil {
+		return ""
+	}
+	for _, xt := range query["xt"] {
+		if hash, ok := strings.CutPrefix(strings.ToLower(xt), "urn:btih:"); ok {
+			return normalizeInfoHash(hash)
+		}
+	}
+	return ""
+}
+
+// normalizeInfoHash accepts a hex or base32 info hash and returns it in
+// lowercase hex, or "" when it is neither.
+func normalizeInfoHash(hash string) string {
+	switch len(hash) {
+	case 40:
+		if _, err := hex.DecodeString(hash); err == nil {
+			return strings.ToLower(hash)
+		}
+	case 32:
+		if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash)); err == nil {
+			return hex.EncodeToString(b)
+		}
+	}
+	return ""
+}
@@ -1,10 +1,10 @@
 package security
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"os"
 
 	"go.uber.org/zap"
@@ -162,50 +162,8 @@ func (ae *AdvancedEncryption) SecureDeleteFile(filePath string) error {
 		return os.Remove(filePath)
 	}
 
-	// Open file
-	// #nosec G304 -- this internal helper only accepts paths already confined by its caller.
-	file, err := os.OpenFile(filePath, os.O_WRONLY, 0)
-	if err != nil {
-		ae.logger.Error("Failed to open file for secure deletion", zap.Error(err))
-		return err
-	}
-	defer file.Close()
-
-	// Get file size
-	info, err := file.Stat()
-	if err != nil {
-		return err
-	}
-	size := info.Size()
-
-	// Overwrite with random data (3 passes)
-	for pass := 0; pass < 3; pass++ {
-		file.Seek(0, 0)
-
-		// Write random data
-		written := int64(0)
-		buf := make([]byte, 4096)
-		for written < size {
-			toWrite := size - written
-			if toWrite > int64(len(buf)) {
-				toWrite = int64(len(buf))
-			}
-
-			io.ReadFull(rand.Reader, buf[:toWrite])
-			n, err := file.Write(buf[:toWrite])
-			if err != nil {
-				return err
-			}
-			written += int64(n)
-		}
-
-		file.Sync()
-	}
-
-	// Finally remove the file
-	err = os.Remove(filePath)
-	if err != nil {
-		ae.logger.Error("Failed to remove file after secure wipe", zap.Error(err))
+	if err := WipeFile(context.Background(), filePath, DefaultWipePasses, nil); err != nil {
+		ae.logger.Error("Failed to securely delete file", zap.Error(err))
 		return err
 	}
 
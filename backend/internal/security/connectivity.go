@@ -0,0 +1,133 @@
+package security
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailuresToDown is how many failed checks in a row mark a link
+	// down.
+	DefaultFailuresToDown = 3
+	// DefaultSuccessesToUp is how many good checks in a row mark it up again.
+	DefaultSuccessesToUp = 2
+)
+
+// LinkState is the settled state of a monitored link.
+type LinkState string
+
+const (
+	LinkUnknown LinkState = "unknown"
+	LinkUp      LinkState = "up"
+	LinkDown    LinkState = "down"
+)
+
+// LinkStatus is a snapshot of a monitored link.
+type LinkStatus struct {
+	State       LinkState `json:"state"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastChecked time.Time `json:"lastChecked,omitempty"`
+	Since       time.Time `json:"since,omitempty"`
+}
+
+// LinkMonitor debounces check results so a single dropped probe does not
+// flap the link: the state only changes once enough results in a row
+// disagree with it. A new monitor starts unknown.
+type LinkMonitor struct {
+	mu             sync.Mutex
+	failuresToDown int
+	successesToUp  int
+	state          LinkState
+	// streak counts the results in a row that equal last and disagree
+	// with state.
+	streak      int
+	last        LinkState
+	lastError   string
+	lastChecked time.Time
+	since       time.Time
+}
+
+func NewLinkMonitor(failuresToDown, successesToUp int) *LinkMonitor {
+	if failuresToDown <= 0 {
+		failuresToDown = DefaultFailuresToDown
+	}
+	if successesToUp <= 0 {
+		successesToUp = DefaultSuccessesToUp
+	}
+	return &LinkMonitor{failuresToDown: failuresToDown, successesToUp: successesToUp, state: LinkUnknown}
+}
+
+// Observe records one check result and reports the settled state and
+// whether this result changed it.
+func (m *LinkMonitor) Observe(err error, at time.Time) (LinkState, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastChecked = at
+	m.lastError = ""
+	next := LinkUp
+	if err != nil {
+		m.lastError = err.Error()
+		next = LinkDown
+	}
+
+	if next != m.last {
+		m.streak = 0
+	}
+	m.last = next
+	if next == m.state {
+		m.streak = 0
+		return m.state, false
+	}
+	m.streak++
+	needed := m.successesToUp
+	if next == LinkDown {
+		needed = m.failuresToDown
+	}
+	if m.streak < needed {
+		return m.state, false
+	}
+	m.state = next
+	m.streak = 0
+	m.since = at
+	return m.state, true
+}
+
+// Reset forgets the settled state, e.g. when the link stops being required.
+func (m *LinkMonitor) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = LinkUnknown
+	m.streak = 0
+	m.last = ""
+	m.lastError = ""
+	m.since = time.Time{}
+}
+
+func (m *LinkMonitor) Status() LinkStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return LinkStatus{State: m.state, LastError: m.lastError, LastChecked: m.lastChecked, Since: m.since}
+}
+
+// CheckInterface reports an error unless the named network interface exists,
+// is up, and has an address.
+func CheckInterface(name string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("interface %s not found: %w", name, err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("interface %s is down", name)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return fmt.Errorf("failed to read addresses of %s: %w", name, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("interface %s has no address", name)
+	}
+	return nil
+}
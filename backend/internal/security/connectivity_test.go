@@ -0,0 +1,93 @@
+package security
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkMonitorChangesStateOnlyOnSettledTransitions(t *testing.T) {
+	monitor := NewLinkMonitor(3, 2)
+	now := time.Now()
+	failed := errors.New("canary unreachable")
+
+	state, changed := monitor.Observe(nil, now)
+	assert.Equal(t, LinkUnknown, state)
+	assert.False(t, changed)
+	state, changed = monitor.Observe(nil, now)
+	assert.Equal(t, LinkUp, state)
+	assert.True(t, changed)
+
+	for i := 0; i < 2; i++ {
+		state, changed = monitor.Observe(failed, now)
+		assert.Equal(t, LinkUp, state)
+		assert.False(t, changed)
+	}
+	_, changed = monitor.Observe(nil, now)
+	assert.False(t, changed, "a good check breaks the failure streak")
+
+	for i := 0; i < 3; i++ {
+		state, changed = monitor.Observe(failed, now.Add(time.Minute))
+	}
+	assert.Equal(t, LinkDown, state)
+	assert.True(t, changed)
+	_, changed = monitor.Observe(failed, now)
+	assert.False(t, changed, "staying down is not a transition")
+
+	status := monitor.Status()
+	assert.Equal(t, "canary unreachable", status.LastError)
+	assert.Equal(t, now.Add(time.Minute), status.Since)
+
+	_, changed = monitor.Observe(nil, now)
+	assert.False(t, changed)
+	state, changed = monitor.Observe(nil, now)
+	assert.Equal(t, LinkUp, state)
+	assert.True(t, changed)
+}
+
+func TestLinkMonitorNeedsResultsInARowWhileUnknown(t *testing.T) {
+	monitor := NewLinkMonitor(3, 2)
+	now := time.Now()
+	failed := errors.New("canary unreachable")
+
+	// fail, success: one success in a row is not enough to settle up.
+	monitor.Observe(failed, now)
+	state, changed := monitor.Observe(nil, now)
+	assert.Equal(t, LinkUnknown, state)
+	assert.False(t, changed)
+
+	// success, fail, fail: two failures in a row are not enough to settle
+	// down.
+	monitor.Observe(failed, now)
+	state, changed = monitor.Observe(failed, now)
+	assert.Equal(t, LinkUnknown, state)
+	assert.False(t, changed)
+	state, changed = monitor.Observe(failed, now)
+	assert.Equal(t, LinkDown, state)
+	assert.True(t, changed)
+
+	monitor.Reset()
+	monitor.Observe(failed, now)
+	monitor.Observe(nil, now)
+	state, changed = monitor.Observe(nil, now)
+	assert.Equal(t, LinkUp, state)
+	assert.True(t, changed)
+}
+
+func TestCheckInterface(t *testing.T) {
+	assert.Error(t, CheckInterface("b2t-missing0"))
+
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			assert.NoError(t, CheckInterface(iface.Name))
+			return
+		}
+	}
+	t.Skip("no loopback interface to check")
+}
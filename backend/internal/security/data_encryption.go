@@ -1,94 +1,129 @@
 package security
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
 	"fmt"
-	"io"
+	"strings"
 
 	"go.uber.org/zap"
 )
 
-// DataEncryption handles encryption of user data
+// dataRecordPrefix marks values produced by DataEncryption.Encrypt:
+// b2k1.<key id>.<wrapped data key>.<ciphertext>, with unpadded base64url
+// fields. The ciphertext is AES-256-GCM nonce || sealed data.
+const dataRecordPrefix = "b2k1"
+
+// DataEncryption encrypts individual records, each under its own data key
+// wrapped by the keyring's active master key.
 type DataEncryption struct {
-	key    []byte
-	logger *zap.Logger
+	keyring *Keyring
+	logger  *zap.Logger
 }
 
-func NewDataEncryption(encryptionKey string, logger *zap.Logger) (*DataEncryption, error) {
-	// Ensure key is 32 bytes for AES-256
-	key := []byte(encryptionKey)
-	if len(key) < 32 {
-		// Pad key if too short
-		paddedKey := make([]byte, 32)
-		copy(paddedKey, key)
-		key = paddedKey
-	} else if len(key) > 32 {
-		// Truncate if too long
-		key = key[:32]
+func NewDataEncryption(keyring *Keyring, logger *zap.Logger) (*DataEncryption, error) {
+	if keyring == nil {
+		return nil, fmt.Errorf("data encryption requires a keyring")
 	}
-
 	return &DataEncryption{
-		key:    key,
-		logger: logger,
+		keyring: keyring,
+		logger:  logger,
 	}, nil
 }
 
 func (de *DataEncryption) Encrypt(plaintext string) (string, error) {
-	block, err := aes.NewCipher(de.key)
+	keyID, key, wrapped, err := de.keyring.NewDataKey()
 	if err != nil {
-		de.logger.Error("Failed to create cipher", zap.Error(err))
 		return "", err
 	}
+	defer wipeBytes(key)
 
-	gcm, err := cipher.NewGCM(block)
+	sealed, err := sealGCM(key, []byte(plaintext), []byte(keyID))
 	if err != nil {
-		de.logger.Error("Failed to create GCM", zap.Error(err))
+		de.logger.Error("Failed to encrypt record", zap.Error(err))
 		return "", err
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		de.logger.Error("Failed to generate nonce", zap.Error(err))
-		return "", err
-	}
-
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return strings.Join([]string{
+		dataRecordPrefix,
+		keyID,
+		base64.RawURLEncoding.EncodeToString(wrapped),
+		base64.RawURLEncoding.EncodeToString(sealed),
+	}, "."), nil
 }
 
 func (de *DataEncryption) Decrypt(ciphertext string) (string, error) {
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	parts := strings.Split(ciphertext, ".")
+	if len(parts) != 4 || parts[0] != dataRecordPrefix {
+		return "", fmt.Errorf("invalid encrypted record")
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[2])
 	if err != nil {
-		de.logger.Error("Failed to decode base64", zap.Error(err))
-		return "", err
+		return "", fmt.Errorf("invalid encrypted record key")
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted record payload")
 	}
 
-	block, err := aes.NewCipher(de.key)
+	key, err := de.keyring.UnwrapDataKey(parts[1], wrapped)
 	if err != nil {
-		de.logger.Error("Failed to create cipher", zap.Error(err))
 		return "", err
 	}
+	defer wipeBytes(key)
 
-	gcm, err := cipher.NewGCM(block)
+	plaintext, err := openGCM(key, sealed, []byte(parts[1]))
 	if err != nil {
-		de.logger.Error("Failed to create GCM", zap.Error(err))
-		return "", err
+		de.logger.Error("Failed to decrypt record", zap.Error(err))
+		return "", fmt.Errorf("failed to decrypt record: %w", err)
 	}
+	return string(plaintext), nil
+}
 
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short")
+// SealField encrypts a column or setting value for storage. Empty values, and
+// values written before a keyring exists, are stored as-is. A nil receiver
+// disables field encryption.
+func (de *DataEncryption) SealField(value string) (string, error) {
+	if de == nil || value == "" || !de.keyring.IsInitialized() {
+		return value, nil
 	}
+	return de.Encrypt(value)
+}
 
-	nonce, encryptedPayload := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, encryptedPayload, nil)
-	if err != nil {
-		de.logger.Error("Failed to decrypt", zap.Error(err))
-		return "", err
+// OpenField reverses SealField. Plaintext values that predate field
+// encryption are returned unchanged.
+func (de *DataEncryption) OpenField(value string) (string, error) {
+	if !IsEncryptedRecord(value) {
+		return value, nil
+	}
+	if de == nil {
+		return "", fmt.Errorf("encrypted value found but field encryption is not configured")
 	}
+	return de.Decrypt(value)
+}
 
-	return string(plaintext), nil
+// sensitiveSettingPrefixes mark whole families of settings, such as future
+// VLESS or Outline credentials, feed URLs and indexer API keys, as encrypted
+// at rest.
+var sensitiveSettingPrefixes = []string{"vless_", "outline_", "rss_", "torznab_"}
+
+var sensitiveSettings = map[string]bool{
+	"download_path": true,
+}
+
+// IsSensitiveSetting reports whether a settings key is encrypted at rest.
+func IsSensitiveSetting(key string) bool {
+	if sensitiveSettings[key] {
+		return true
+	}
+	for _, prefix := range sensitiveSettingPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEncryptedRecord reports whether value was produced by Encrypt.
+func IsEncryptedRecord(value string) bool {
+	return strings.HasPrefix(value, dataRecordPrefix+".")
 }
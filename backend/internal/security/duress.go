@@ -0,0 +1,117 @@
+package security
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DuressSettingKey is the settings row the duress passphrase hash is kept
+// in. The system_ prefix keeps it out of ClearUserSettings.
+const DuressSettingKey = "system_duress"
+
+// ErrDuressMatchesPassphrase is returned when the duress passphrase is the
+// same as the keyring passphrase.
+var ErrDuressMatchesPassphrase = errors.New("duress passphrase must differ from the keyring passphrase")
+
+type duressState struct {
+	KDF      keyringKDF `json:"kdf"`
+	Hash     []byte     `json:"hash"`
+	WipeData bool       `json:"wipeData"`
+}
+
+// Duress holds an Argon2id hash of a second passphrase that, entered in
+// place of the keyring passphrase, triggers the panic action instead of
+// unlocking anything. Only the salted hash is stored.
+type Duress struct {
+	mu    sync.RWMutex
+	store KeyringStore
+	state *duressState
+}
+
+// NewSettingsDuressStore stores the duress hash in the settings table under
+// DuressSettingKey.
+func NewSettingsDuressStore(settings settingsStore) KeyringStore {
+	return &settingsKeyringStore{settings: settings, key: DuressSettingKey}
+}
+
+// NewDuress loads any configured duress passphrase from store.
+func NewDuress(store KeyringStore) (*Duress, error) {
+	d := &Duress{store: store}
+	data, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load duress passphrase: %w", err)
+	}
+	if len(data) == 0 {
+		return d, nil
+	}
+	var state duressState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse duress passphrase: %w", err)
+	}
+	d.state = &state
+	return d, nil
+}
+
+// Configure replaces the duress passphrase. wipeData selects whether the
+// panic it triggers also wipes downloaded data.
+func (d *Duress) Configure(passphrase string, wipeData bool) error {
+	if len(passphrase) < minKeyringPassphrase {
+		return ErrKeyringWeakPassphrase
+	}
+	kdf, err := newKeyringKDF()
+	if err != nil {
+		return err
+	}
+	state := &duressState{KDF: kdf, Hash: kdf.derive(passphrase), WipeData: wipeData}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to serialize duress passphrase: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.store.Save(data); err != nil {
+		return fmt.Errorf("failed to persist duress passphrase: %w", err)
+	}
+	d.state = state
+	return nil
+}
+
+// Clear removes the duress passphrase.
+func (d *Duress) Clear() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.store.Save(nil); err != nil {
+		return fmt.Errorf("failed to clear duress passphrase: %w", err)
+	}
+	d.state = nil
+	return nil
+}
+
+// IsConfigured reports whether a duress passphrase is set.
+func (d *Duress) IsConfigured() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.state != nil
+}
+
+// Match reports whether passphrase is the duress passphrase and, if so,
+// whether data should be wiped.
+func (d *Duress) Match(passphrase string) (matched, wipeData bool) {
+	d.mu.RLock()
+	state := d.state
+	d.mu.RUnlock()
+	if state == nil {
+		return false, false
+	}
+
+	hash := state.KDF.derive(passphrase)
+	defer wipeBytes(hash)
+	if subtle.ConstantTimeCompare(hash, state.Hash) != 1 {
+		return false, false
+	}
+	return true, state.WipeData
+}
@@ -1,16 +1,15 @@
 package security
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
+	"bufio"
+	"context"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
-	"strings"
 
 	"go.uber.org/zap"
 	"golang.org/x/crypto/argon2"
@@ -27,11 +26,19 @@ type EncryptionConfig struct {
 	MemoryCost    uint32 // For Argon2
 	Parallelism   uint8  // For Argon2
 	TimeCost      uint32 // For Argon2
+	ChunkSize     int    // Plaintext bytes per B2ENCRYPT:3 chunk
 }
 
 type EncryptionManager struct {
-	config *EncryptionConfig
-	logger *zap.Logger
+	config  *EncryptionConfig
+	keyring *Keyring
+	logger  *zap.Logger
+
+	recipient        *RecipientKey
+	recipientPrivate *RecipientKey
+	// recipientKeys holds the data keys of files encrypted to recipient,
+	// keyed by their sealed form, until ForgetRecipientKeys.
+	recipientKeys map[string][]byte
 }
 
 func NewEncryptionManager(config *EncryptionConfig, logger *zap.Logger) *EncryptionManager {
@@ -54,6 +61,12 @@ func NewEncryptionManager(config *EncryptionConfig, logger *zap.Logger) *Encrypt
 	}
 }
 
+// SetKeyring lets em encrypt with keyring data keys, selected by an empty
+// password, and decrypt files whose header names a keyring key.
+func (em *EncryptionManager) SetKeyring(keyring *Keyring) {
+	em.keyring = keyring
+}
+
 func (em *EncryptionManager) DeriveKey(password string, salt []byte, keySize int) ([]byte, error) {
 	if keySize < 1 || keySize > 64 {
 		return nil, fmt.Errorf("invalid derived key size")
@@ -78,85 +91,23 @@ func (em *EncryptionManager) DeriveKey(password string, salt []byte, keySize int
 	}
 }
 
+// EncryptFile writes inputPath to outputPath in the chunked B2ENCRYPT:3
+// format. Memory use is bounded by the chunk size regardless of file size.
 func (em *EncryptionManager) EncryptFile(inputPath, outputPath, password string) error {
-	// Generate random salt
-	salt := make([]byte, 32)
-	if _, err := rand.Read(salt); err != nil {
-		return fmt.Errorf("failed to generate salt: %w", err)
-	}
-
-	// Derive key from password
-	var key []byte
-	var err error
-
-	switch em.config.Algorithm {
-	case "ChaCha20-Poly1305":
-		key, err = em.DeriveKey(password, salt, chacha20poly1305.KeySize)
-	default: // AES variants
-		key, err = em.DeriveKey(password, salt, 32) // 256-bit key
-	}
-
-	if err != nil {
-		return fmt.Errorf("key derivation failed: %w", err)
-	}
+	return em.EncryptFileContext(context.Background(), inputPath, outputPath, password, nil)
+}
 
-	// Read input file
+// EncryptFileContext is EncryptFile with cancellation. onProgress, when set,
+// receives the number of plaintext bytes consumed after every read.
+func (em *EncryptionManager) EncryptFileContext(ctx context.Context, inputPath, outputPath, password string, onProgress func(int64)) error {
 	// #nosec G304 -- API callers normalize and confine inputPath to app-owned roots.
-	plaintext, err := os.ReadFile(inputPath)
+	file, err := os.Open(inputPath)
 	if err != nil {
 		return fmt.Errorf("failed to read input file: %w", err)
 	}
+	defer file.Close()
+	input := &contextReader{ctx: ctx, r: file, onRead: onProgress}
 
-	header := fmt.Sprintf(
-		"B2ENCRYPT:2:%s:%s:%s:%d:%d:%d:%d\n",
-		em.config.Algorithm,
-		em.config.KeyDerivation,
-		em.config.HashAlgorithm,
-		em.config.Iterations,
-		em.config.MemoryCost,
-		em.config.Parallelism,
-		em.config.TimeCost,
-	)
-
-	// Encrypt based on algorithm. The v2 header is authenticated as associated
-	// data so algorithm and KDF parameters cannot be changed undetected.
-	var ciphertext []byte
-	var nonce []byte
-
-	switch em.config.Algorithm {
-	case "ChaCha20-Poly1305":
-		aead, err := chacha20poly1305.New(key)
-		if err != nil {
-			return fmt.Errorf("failed to create ChaCha20-Poly1305 cipher: %w", err)
-		}
-
-		nonce = make([]byte, aead.NonceSize())
-		if _, err := rand.Read(nonce); err != nil {
-			return fmt.Errorf("failed to generate nonce: %w", err)
-		}
-
-		ciphertext = aead.Seal(nil, nonce, plaintext, []byte(header))
-
-	default: // AES-256-GCM
-		block, err := aes.NewCipher(key)
-		if err != nil {
-			return fmt.Errorf("failed to create AES cipher: %w", err)
-		}
-
-		gcm, err := cipher.NewGCM(block)
-		if err != nil {
-			return fmt.Errorf("failed to create GCM: %w", err)
-		}
-
-		nonce = make([]byte, gcm.NonceSize())
-		if _, err := rand.Read(nonce); err != nil {
-			return fmt.Errorf("failed to generate nonce: %w", err)
-		}
-
-		ciphertext = gcm.Seal(nil, nonce, plaintext, []byte(header))
-	}
-
-	// Write encrypted file: salt + nonce + ciphertext
 	// #nosec G304 -- outputPath is derived from a validated, confined input path.
 	output, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
 	if err != nil {
@@ -170,23 +121,8 @@ func (em *EncryptionManager) EncryptFile(inputPath, outputPath, password string)
 		}
 	}()
 
-	if _, err := output.WriteString(header); err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
-	}
-
-	// Write salt
-	if _, err := output.Write(salt); err != nil {
-		return fmt.Errorf("failed to write salt: %w", err)
-	}
-
-	// Write nonce
-	if _, err := output.Write(nonce); err != nil {
-		return fmt.Errorf("failed to write nonce: %w", err)
-	}
-
-	// Write ciphertext
-	if _, err := output.Write(ciphertext); err != nil {
-		return fmt.Errorf("failed to write ciphertext: %w", err)
+	if err := em.EncryptStream(input, output, password); err != nil {
+		return err
 	}
 	if err := output.Close(); err != nil {
 		return fmt.Errorf("failed to finalize output file: %w", err)
@@ -196,33 +132,48 @@ func (em *EncryptionManager) EncryptFile(inputPath, outputPath, password string)
 	return nil
 }
 
+// maxLegacyPayload bounds legacy v1 and v2 files, which are decrypted in
+// memory. It matches the size limit encryption had before streaming.
+var maxLegacyPayload int64 = 512 << 20
+
+// DecryptFile restores a B2ENCRYPT file. Version 3 files are decrypted as a
+// stream; legacy v1 and v2 files are still read whole, up to
+// maxLegacyPayload.
 func (em *EncryptionManager) DecryptFile(inputPath, outputPath, password string) error {
-	// Read encrypted file
+	return em.DecryptFileContext(context.Background(), inputPath, outputPath, password, nil)
+}
+
+// DecryptFileContext is DecryptFile with cancellation. onProgress, when set,
+// receives the number of encrypted bytes consumed after every read.
+func (em *EncryptionManager) DecryptFileContext(ctx context.Context, inputPath, outputPath, password string, onProgress func(int64)) error {
 	// #nosec G304 -- API callers normalize and confine inputPath to app-owned roots.
-	data, err := os.ReadFile(inputPath)
+	file, err := os.Open(inputPath)
 	if err != nil {
 		return fmt.Errorf("failed to read input file: %w", err)
 	}
+	defer file.Close()
 
-	// Parse header
-	headerEnd := -1
-	for i, b := range data {
-		if i > 256 {
-			break
-		}
-		if b == '\n' {
-			headerEnd = i + 1
-			break
+	reader := bufio.NewReader(&contextReader{ctx: ctx, r: file, onRead: onProgress})
+	headerBytes, parts, err := readEncryptionHeader(reader)
+	if err != nil {
+		return err
+	}
+	if len(parts) > 4 && parts[1] == streamFormatVersion {
+		header, err := em.parseStreamHeader(headerBytes, parts, reader)
+		if err != nil {
+			return err
 		}
+		return writeDecrypted(outputPath, func(output io.Writer) error {
+			return em.decryptStream(header, reader, output, password)
+		})
 	}
-	if headerEnd < 0 {
-		return fmt.Errorf("invalid or missing encryption header")
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxLegacyPayload+1))
+	if err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
 	}
-	headerBytes := data[:headerEnd]
-	header := strings.TrimSuffix(string(headerBytes), "\n")
-	parts := strings.Split(header, ":")
-	if len(parts) < 4 || parts[0] != "B2ENCRYPT" {
-		return fmt.Errorf("invalid encryption header")
+	if int64(len(data)) > maxLegacyPayload {
+		return fmt.Errorf("legacy encrypted files larger than %d MiB are not supported", maxLegacyPayload>>20)
 	}
 	associatedData := headerBytes
 	switch {
@@ -235,43 +186,17 @@ func (em *EncryptionManager) DecryptFile(inputPath, outputPath, password string)
 		em.config.Parallelism = 4
 		em.config.TimeCost = 1
 		associatedData = nil
-	case len(parts) == 9 && parts[1] == "2":
-		em.config.Algorithm, em.config.KeyDerivation, em.config.HashAlgorithm = parts[2], parts[3], parts[4]
-		iterations, err := strconv.Atoi(parts[5])
-		if err != nil || iterations < 100000 || iterations > 10000000 {
-			return fmt.Errorf("invalid PBKDF2 iteration count in header")
+		if err := em.validateAlgorithms(); err != nil {
+			return err
 		}
-		memoryCost, err := strconv.ParseUint(parts[6], 10, 32)
-		if err != nil || memoryCost < 8192 || memoryCost > 1048576 {
-			return fmt.Errorf("invalid Argon2 memory cost in header")
-		}
-		parallelism, err := strconv.ParseUint(parts[7], 10, 8)
-		if err != nil || parallelism < 1 || parallelism > 32 {
-			return fmt.Errorf("invalid Argon2 parallelism in header")
-		}
-		timeCost, err := strconv.ParseUint(parts[8], 10, 32)
-		if err != nil || timeCost < 1 || timeCost > 10 {
-			return fmt.Errorf("invalid Argon2 time cost in header")
+	case len(parts) == 9 && parts[1] == "2":
+		if err := em.applyHeaderParams(parts[2:9]); err != nil {
+			return err
 		}
-		em.config.Iterations = iterations
-		em.config.MemoryCost = uint32(memoryCost)
-		em.config.Parallelism = uint8(parallelism)
-		em.config.TimeCost = uint32(timeCost)
 	default:
 		return fmt.Errorf("unsupported encryption header version")
 	}
 
-	if em.config.Algorithm != "AES-256-GCM" && em.config.Algorithm != "ChaCha20-Poly1305" {
-		return fmt.Errorf("unsupported encryption algorithm in header")
-	}
-	if em.config.KeyDerivation != "PBKDF2" && em.config.KeyDerivation != "Argon2id" && em.config.KeyDerivation != "scrypt" {
-		return fmt.Errorf("unsupported key derivation function in header")
-	}
-	if em.config.HashAlgorithm != "SHA-256" && em.config.HashAlgorithm != "SHA-512" {
-		return fmt.Errorf("unsupported hash algorithm in header")
-	}
-
-	data = data[headerEnd:] // Skip header
 	if len(data) < 32 {
 		return fmt.Errorf("encrypted payload is missing salt")
 	}
@@ -294,67 +219,137 @@ func (em *EncryptionManager) DecryptFile(inputPath, outputPath, password string)
 	nonce := data[:nonceSize]
 	ciphertext := data[nonceSize:]
 
-	// Derive key
-	var key []byte
-	switch em.config.Algorithm {
-	case "ChaCha20-Poly1305":
-		key, err = em.DeriveKey(password, salt, chacha20poly1305.KeySize)
-	default:
-		key, err = em.DeriveKey(password, salt, 32)
+	aead, err := em.streamKey(password, salt)
+	if err != nil {
+		return err
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, associatedData)
+	if err != nil {
+		return fmt.Errorf("decryption failed: %w", err)
 	}
 
+	return writeDecrypted(outputPath, func(output io.Writer) error {
+		_, err := output.Write(plaintext)
+		return err
+	})
+}
+
+// VerifyFile authenticates the header and every chunk of a B2ENCRYPT:3 file
+// without writing plaintext anywhere, and returns the plaintext length.
+func (em *EncryptionManager) VerifyFile(ctx context.Context, inputPath, password string) (int64, error) {
+	// #nosec G304 -- API callers normalize and confine inputPath to app-owned roots.
+	file, err := os.Open(inputPath)
 	if err != nil {
-		return fmt.Errorf("key derivation failed: %w", err)
+		return 0, fmt.Errorf("failed to read input file: %w", err)
 	}
+	defer file.Close()
 
-	// Decrypt
-	var plaintext []byte
+	reader := bufio.NewReader(&contextReader{ctx: ctx, r: file})
+	headerBytes, parts, err := readEncryptionHeader(reader)
+	if err != nil {
+		return 0, err
+	}
+	if len(parts) <= 4 || parts[1] != streamFormatVersion {
+		return 0, fmt.Errorf("only B2ENCRYPT:%s files can be verified", streamFormatVersion)
+	}
+	header, err := em.parseStreamHeader(headerBytes, parts, reader)
+	if err != nil {
+		return 0, err
+	}
+	counter := &countingWriter{}
+	if err := em.decryptStream(header, reader, counter, password); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
 
-	switch em.config.Algorithm {
-	case "ChaCha20-Poly1305":
-		aead, err := chacha20poly1305.New(key)
-		if err != nil {
-			return fmt.Errorf("failed to create ChaCha20-Poly1305 cipher: %w", err)
-		}
+// countingWriter discards writes and counts their length.
+type countingWriter struct {
+	n int64
+}
 
-		plaintext, err = aead.Open(nil, nonce, ciphertext, associatedData)
-		if err != nil {
-			return fmt.Errorf("decryption failed: %w", err)
-		}
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	return len(p), nil
+}
 
-	default: // AES-256-GCM
-		block, err := aes.NewCipher(key)
-		if err != nil {
-			return fmt.Errorf("failed to create AES cipher: %w", err)
-		}
+// contextReader stops reading once ctx is cancelled and reports consumed
+// bytes to onRead.
+type contextReader struct {
+	ctx    context.Context
+	r      io.Reader
+	onRead func(int64)
+}
 
-		gcm, err := cipher.NewGCM(block)
-		if err != nil {
-			return fmt.Errorf("failed to create GCM: %w", err)
-		}
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := cr.r.Read(p)
+	if n > 0 && cr.onRead != nil {
+		cr.onRead(int64(n))
+	}
+	return n, err
+}
 
-		plaintext, err = gcm.Open(nil, nonce, ciphertext, associatedData)
-		if err != nil {
-			return fmt.Errorf("decryption failed: %w", err)
-		}
+// applyHeaderParams validates the algorithm and KDF fields shared by the v2
+// and v3 headers (alg, kdf, hash, iterations, memory, parallelism, time) and
+// applies them to em.
+func (em *EncryptionManager) applyHeaderParams(fields []string) error {
+	em.config.Algorithm, em.config.KeyDerivation, em.config.HashAlgorithm = fields[0], fields[1], fields[2]
+	iterations, err := strconv.Atoi(fields[3])
+	if err != nil || iterations < 100000 || iterations > 10000000 {
+		return fmt.Errorf("invalid PBKDF2 iteration count in header")
+	}
+	memoryCost, err := strconv.ParseUint(fields[4], 10, 32)
+	if err != nil || memoryCost < 8192 || memoryCost > 1048576 {
+		return fmt.Errorf("invalid Argon2 memory cost in header")
+	}
+	parallelism, err := strconv.ParseUint(fields[5], 10, 8)
+	if err != nil || parallelism < 1 || parallelism > 32 {
+		return fmt.Errorf("invalid Argon2 parallelism in header")
+	}
+	timeCost, err := strconv.ParseUint(fields[6], 10, 32)
+	if err != nil || timeCost < 1 || timeCost > 10 {
+		return fmt.Errorf("invalid Argon2 time cost in header")
+	}
+	em.config.Iterations = iterations
+	em.config.MemoryCost = uint32(memoryCost)
+	em.config.Parallelism = uint8(parallelism)
+	em.config.TimeCost = uint32(timeCost)
+	return em.validateAlgorithms()
+}
+
+func (em *EncryptionManager) validateAlgorithms() error {
+	if em.config.Algorithm != "AES-256-GCM" && em.config.Algorithm != "ChaCha20-Poly1305" {
+		return fmt.Errorf("unsupported encryption algorithm in header")
+	}
+	if em.config.KeyDerivation != "PBKDF2" && em.config.KeyDerivation != "Argon2id" && em.config.KeyDerivation != "scrypt" {
+		return fmt.Errorf("unsupported key derivation function in header")
 	}
+	if em.config.HashAlgorithm != "SHA-256" && em.config.HashAlgorithm != "SHA-512" {
+		return fmt.Errorf("unsupported hash algorithm in header")
+	}
+	return nil
+}
 
-	// Write decrypted file
+// writeDecrypted creates outputPath exclusively and removes it again if
+// write fails, so a failed decryption never leaves partial plaintext behind.
+func writeDecrypted(outputPath string, write func(io.Writer) error) error {
 	// #nosec G304 -- outputPath is derived from a validated, confined input path.
 	output, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	if _, err := output.Write(plaintext); err != nil {
+	if err := write(output); err != nil {
 		output.Close()
 		_ = os.Remove(outputPath)
-		return fmt.Errorf("failed to write output file: %w", err)
+		return err
 	}
 	if err := output.Close(); err != nil {
 		_ = os.Remove(outputPath)
 		return fmt.Errorf("failed to finalize output file: %w", err)
 	}
-
 	return nil
 }
 
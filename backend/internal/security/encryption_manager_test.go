@@ -1,7 +1,13 @@
 package security
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -37,7 +43,7 @@ func TestEncryptDecryptFileRoundTrip(t *testing.T) {
 
 	encrypted, err := os.ReadFile(encryptedPath)
 	require.NoError(t, err)
-	assert.True(t, bytes.HasPrefix(encrypted, []byte("B2ENCRYPT:2:")))
+	assert.True(t, bytes.HasPrefix(encrypted, []byte("B2ENCRYPT:3:")))
 
 	require.NoError(t, manager.DecryptFile(encryptedPath, decryptedPath, "correct horse battery staple"))
 	decrypted, err := os.ReadFile(decryptedPath)
@@ -76,3 +82,208 @@ func TestDeriveKeyRejectsInvalidKeySize(t *testing.T) {
 	_, err = manager.DeriveKey("password", []byte("salt"), 65)
 	require.Error(t, err)
 }
+
+func TestDecryptReadsLegacyV2Files(t *testing.T) {
+	manager := testEncryptionManager()
+	tempDir := t.TempDir()
+	encryptedPath := filepath.Join(tempDir, "legacy.b2")
+	decryptedPath := filepath.Join(tempDir, "decrypted.txt")
+	plaintext := []byte("written before streaming encryption existed")
+
+	header := "B2ENCRYPT:2:AES-256-GCM:Argon2id:SHA-256:100000:8192:1:1\n"
+	salt := make([]byte, 32)
+	nonce := make([]byte, 12)
+	_, err := rand.Read(salt)
+	require.NoError(t, err)
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+	key, err := manager.DeriveKey("password", salt, 32)
+	require.NoError(t, err)
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	var file bytes.Buffer
+	file.WriteString(header)
+	file.Write(salt)
+	file.Write(nonce)
+	file.Write(gcm.Seal(nil, nonce, plaintext, []byte(header)))
+	require.NoError(t, os.WriteFile(encryptedPath, file.Bytes(), 0600))
+
+	require.NoError(t, manager.DecryptFile(encryptedPath, decryptedPath, "password"))
+	decrypted, err := os.ReadFile(decryptedPath)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// Legacy files are decrypted in memory, so oversized ones are refused
+	// instead of buffered.
+	limit := maxLegacyPayload
+	maxLegacyPayload = int64(file.Len() - len(header) - 1)
+	defer func() { maxLegacyPayload = limit }()
+	require.NoError(t, os.Remove(decryptedPath))
+	err = manager.DecryptFile(encryptedPath, decryptedPath, "password")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "larger than")
+}
+
+// encryptChunked encrypts plaintext with 4 KiB chunks and returns the
+// encrypted file contents.
+func encryptChunked(t *testing.T, manager *EncryptionManager, plaintext []byte) []byte {
+	t.Helper()
+	manager.config.ChunkSize = minStreamChunkSize
+	var encrypted bytes.Buffer
+	require.NoError(t, manager.EncryptStream(bytes.NewReader(plaintext), &encrypted, "password"))
+	return encrypted.Bytes()
+}
+
+func TestStreamRoundTripAcrossChunks(t *testing.T) {
+	manager := testEncryptionManager()
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.bin")
+	encryptedPath := filepath.Join(tempDir, "encrypted.b2")
+	decryptedPath := filepath.Join(tempDir, "decrypted.bin")
+
+	manager.config.ChunkSize = minStreamChunkSize
+	for _, size := range []int{0, minStreamChunkSize, 3*minStreamChunkSize + 17} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(inputPath, plaintext, 0600))
+
+		require.NoError(t, manager.EncryptFile(inputPath, encryptedPath, "password"))
+		require.NoError(t, manager.DecryptFile(encryptedPath, decryptedPath, "password"))
+		decrypted, err := os.ReadFile(decryptedPath)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, decrypted, "size %d", size)
+
+		require.NoError(t, os.Remove(encryptedPath))
+		require.NoError(t, os.Remove(decryptedPath))
+	}
+}
+
+func TestStreamDetectsTruncationAndReordering(t *testing.T) {
+	manager := testEncryptionManager()
+	plaintext := bytes.Repeat([]byte("0123456789abcdef"), 3*minStreamChunkSize/16+5)
+	encrypted := encryptChunked(t, manager, plaintext)
+
+	headerEnd := bytes.IndexByte(encrypted, '\n') + 1
+	preamble := headerEnd + streamSaltSize + streamPrefixSize
+	sealed := minStreamChunkSize + streamTagSize
+
+	decrypt := func(data []byte) error {
+		reader := bufio.NewReader(bytes.NewReader(data))
+		line, parts, err := readEncryptionHeader(reader)
+		require.NoError(t, err)
+		header, err := manager.parseStreamHeader(line, parts, reader)
+		require.NoError(t, err)
+		return manager.decryptStream(header, reader, io.Discard, "password")
+	}
+
+	require.NoError(t, decrypt(encrypted))
+
+	truncated := encrypted[:preamble+2*sealed]
+	assert.ErrorIs(t, decrypt(truncated), ErrTruncatedCiphertext)
+
+	reordered := append([]byte(nil), encrypted...)
+	copy(reordered[preamble:], encrypted[preamble+sealed:preamble+2*sealed])
+	copy(reordered[preamble+sealed:], encrypted[preamble:preamble+sealed])
+	assert.Error(t, decrypt(reordered))
+
+	trailing := append(append([]byte(nil), encrypted...), 0)
+	assert.Error(t, decrypt(trailing))
+}
+
+func TestVerifyFileAuthenticatesWithoutPlaintext(t *testing.T) {
+	manager := testEncryptionManager()
+	manager.config.ChunkSize = minStreamChunkSize
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.bin")
+	encryptedPath := filepath.Join(tempDir, "input.bin.b2encrypted")
+	plaintext := bytes.Repeat([]byte("verify me "), 1000)
+	require.NoError(t, os.WriteFile(inputPath, plaintext, 0600))
+	require.NoError(t, manager.EncryptFile(inputPath, encryptedPath, "password"))
+
+	size, err := manager.VerifyFile(context.Background(), encryptedPath, "password")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(plaintext)), size)
+
+	_, err = manager.VerifyFile(context.Background(), encryptedPath, "wrong password")
+	assert.Error(t, err)
+
+	encrypted, err := os.ReadFile(encryptedPath)
+	require.NoError(t, err)
+	encrypted[len(encrypted)-1] ^= 1
+	require.NoError(t, os.WriteFile(encryptedPath, encrypted, 0600))
+	_, err = manager.VerifyFile(context.Background(), encryptedPath, "password")
+	assert.Error(t, err)
+}
+
+func TestEncryptToRecipient(t *testing.T) {
+	public, private, err := GenerateRecipientKey()
+	require.NoError(t, err)
+
+	manager := testEncryptionManager()
+	manager.config.ChunkSize = minStreamChunkSize
+	manager.SetRecipient(public)
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.bin")
+	encryptedPath := filepath.Join(tempDir, "input.bin.b2encrypted")
+	decryptedPath := filepath.Join(tempDir, "decrypted.bin")
+	plaintext := bytes.Repeat([]byte("for the recipient "), 1000)
+	require.NoError(t, os.WriteFile(inputPath, plaintext, 0600))
+	require.NoError(t, manager.EncryptFile(inputPath, encryptedPath, ""))
+
+	encrypted, err := os.ReadFile(encryptedPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(encrypted, []byte("B2ENCRYPT:3:AES-256-GCM:Recipient:"+public.Fingerprint()+":")))
+
+	size, err := manager.VerifyFile(context.Background(), encryptedPath, "")
+	require.NoError(t, err, "the encrypting manager verifies with the data key it kept")
+	assert.Equal(t, int64(len(plaintext)), size)
+
+	manager.ForgetRecipientKeys()
+	_, err = manager.VerifyFile(context.Background(), encryptedPath, "")
+	assert.ErrorIs(t, err, ErrRecipientKeyUnavailable)
+
+	other, _, err := GenerateRecipientKey()
+	require.NoError(t, err)
+	reader := testEncryptionManager()
+	reader.SetRecipientPrivateKey(other)
+	assert.Error(t, reader.DecryptFile(encryptedPath, decryptedPath, ""))
+
+	parsed, err := ParseRecipientKey(private.String())
+	require.NoError(t, err)
+	reader.SetRecipientPrivateKey(parsed)
+	require.NoError(t, reader.DecryptFile(encryptedPath, decryptedPath, ""))
+	decrypted, err := os.ReadFile(decryptedPath)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+}
+
+func TestDecryptRangeAcrossChunkBoundaries(t *testing.T) {
+	manager := testEncryptionManager()
+	encryptedPath := filepath.Join(t.TempDir(), "encrypted.b2")
+	plaintext := make([]byte, 3*minStreamChunkSize+100)
+	_, err := rand.Read(plaintext)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(encryptedPath, encryptChunked(t, manager, plaintext), 0600))
+
+	cases := []struct{ offset, length int64 }{
+		{0, 10},
+		{minStreamChunkSize - 5, 10},
+		{minStreamChunkSize, 2*minStreamChunkSize + 50},
+		{3*minStreamChunkSize + 90, 100},
+	}
+	for _, tc := range cases {
+		var out bytes.Buffer
+		n, err := manager.DecryptRange(encryptedPath, "password", tc.offset, tc.length, &out)
+		require.NoError(t, err)
+		end := min(tc.offset+tc.length, int64(len(plaintext)))
+		assert.Equal(t, end-tc.offset, n)
+		assert.Equal(t, plaintext[tc.offset:end], out.Bytes(), "offset %d", tc.offset)
+	}
+
+	_, err = manager.DecryptRange(encryptedPath, "wrong", 0, 10, io.Discard)
+	require.Error(t, err)
+}
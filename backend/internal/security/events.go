@@ -0,0 +1,212 @@
+package security
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEventCapacity is how many events the in-memory store keeps.
+	DefaultEventCapacity = 1000
+	// DefaultEventRetention is how long events are kept before pruning.
+	DefaultEventRetention = 7 * 24 * time.Hour
+	// DefaultEventPageSize and MaxEventPageSize bound List results.
+	DefaultEventPageSize = 100
+	MaxEventPageSize     = 1000
+)
+
+// SecurityEvent represents a security-related event
+type SecurityEvent struct {
+	ID             int64      `json:"id"`
+	Type           string     `json:"type"`
+	Severity       string     `json:"severity"`
+	Message        string     `json:"message"`
+	Timestamp      time.Time  `json:"timestamp"`
+	Details        string     `json:"details,omitempty"`
+	Acknowledged   bool       `json:"acknowledged"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+}
+
+// EventFilter selects events. Empty fields match everything; Before pages
+// back from an event ID.
+type EventFilter struct {
+	Severities     []string
+	Types          []string
+	Since          time.Time
+	Until          time.Time
+	Unacknowledged bool
+	Before         int64
+	Limit          int
+}
+
+// PageSize returns Limit bounded to MaxEventPageSize, or the default page
+// size when unset.
+func (f EventFilter) PageSize() int {
+	if f.Limit <= 0 || f.Limit > MaxEventPageSize {
+		return DefaultEventPageSize
+	}
+	return f.Limit
+}
+
+// Matches reports whether event passes the filter, ignoring paging.
+func (f EventFilter) Matches(event SecurityEvent) bool {
+	switch {
+	case len(f.Severities) > 0 && !slices.Contains(f.Severities, event.Severity):
+		return false
+	case len(f.Types) > 0 && !slices.Contains(f.Types, event.Type):
+		return false
+	case !f.Since.IsZero() && event.Timestamp.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && event.Timestamp.After(f.Until):
+		return false
+	case f.Unacknowledged && event.Acknowledged:
+		return false
+	}
+	return true
+}
+
+// SecurityEventStore keeps security events. Add assigns the event its ID,
+// List returns matching events newest first, and Acknowledge marks the
+// given events, or every unacknowledged one when ids is empty.
+type SecurityEventStore interface {
+	AddSecurityEvent(event *SecurityEvent) error
+	ListSecurityEvents(filter EventFilter) ([]SecurityEvent, error)
+	AcknowledgeSecurityEvents(ids []int64, at time.Time) (int, error)
+	PruneSecurityEvents(olderThan time.Time, keep int) (int, error)
+	ClearSecurityEvents() error
+}
+
+// MemoryEventStore is a fixed-size ring of the newest events. Nothing
+// survives a restart.
+type MemoryEventStore struct {
+	mu       sync.RWMutex
+	events   []SecurityEvent
+	capacity int
+	nextID   int64
+}
+
+func NewMemoryEventStore(capacity int) *MemoryEventStore {
+	if capacity <= 0 {
+		capacity = DefaultEventCapacity
+	}
+	return &MemoryEventStore{capacity: capacity, nextID: 1}
+}
+
+func (s *MemoryEventStore) AddSecurityEvent(event *SecurityEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.ID = s.nextID
+	s.nextID++
+	s.events = append(s.events, *event)
+	if len(s.events) > s.capacity {
+		s.events = slices.Delete(s.events, 0, len(s.events)-s.capacity)
+	}
+	return nil
+}
+
+func (s *MemoryEventStore) ListSecurityEvents(filter EventFilter) ([]SecurityEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	limit := filter.PageSize()
+	events := []SecurityEvent{}
+	for i := len(s.events) - 1; i >= 0 && len(events) < limit; i-- {
+		event := s.events[i]
+		if filter.Before > 0 && event.ID >= filter.Before {
+			continue
+		}
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (s *MemoryEventStore) AcknowledgeSecurityEvents(ids []int64, at time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for i := range s.events {
+		event := &s.events[i]
+		if event.Acknowledged || (len(ids) > 0 && !slices.Contains(ids, event.ID)) {
+			continue
+		}
+		event.Acknowledged = true
+		event.AcknowledgedAt = &at
+		count++
+	}
+	return count, nil
+}
+
+func (s *MemoryEventStore) PruneSecurityEvents(olderThan time.Time, keep int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := len(s.events)
+	s.events = slices.DeleteFunc(s.events, func(event SecurityEvent) bool {
+		return event.Timestamp.Before(olderThan)
+	})
+	if keep > 0 && len(s.events) > keep {
+		s.events = slices.Delete(s.events, 0, len(s.events)-keep)
+	}
+	return before - len(s.events), nil
+}
+
+func (s *MemoryEventStore) ClearSecurityEvents() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = nil
+	return nil
+}
+
+// NoLogsEventStore writes to a persistent store only while no-logs mode is
+// off. While it is on, events go to a MemoryEventStore instead and are lost
+// on restart.
+type NoLogsEventStore struct {
+	persistent SecurityEventStore
+	memory     *MemoryEventStore
+	noLogs     func() bool
+}
+
+// NewNoLogsEventStore wraps persistent. noLogs reports whether no-logs mode
+// is on.
+func NewNoLogsEventStore(persistent SecurityEventStore, noLogs func() bool) *NoLogsEventStore {
+	return &NoLogsEventStore{
+		persistent: persistent,
+		memory:     NewMemoryEventStore(DefaultEventCapacity),
+		noLogs:     noLogs,
+	}
+}
+
+func (s *NoLogsEventStore) current() SecurityEventStore {
+	if s.noLogs() {
+		return s.memory
+	}
+	return s.persistent
+}
+
+func (s *NoLogsEventStore) AddSecurityEvent(event *SecurityEvent) error {
+	return s.current().AddSecurityEvent(event)
+}
+
+func (s *NoLogsEventStore) ListSecurityEvents(filter EventFilter) ([]SecurityEvent, error) {
+	return s.current().ListSecurityEvents(filter)
+}
+
+func (s *NoLogsEventStore) AcknowledgeSecurityEvents(ids []int64, at time.Time) (int, error) {
+	return s.current().AcknowledgeSecurityEvents(ids, at)
+}
+
+func (s *NoLogsEventStore) PruneSecurityEvents(olderThan time.Time, keep int) (int, error) {
+	return s.current().PruneSecurityEvents(olderThan, keep)
+}
+
+func (s *NoLogsEventStore) ClearSecurityEvents() error {
+	return errors.Join(s.memory.ClearSecurityEvents(), s.persistent.ClearSecurityEvents())
+}
+
+// PurgePersisted drops every event kept by the persistent store. It is
+// called when no-logs mode is turned on.
+func (s *NoLogsEventStore) PurgePersisted() error {
+	return s.persistent.ClearSecurityEvents()
+}
@@ -0,0 +1,82 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryEventStoreFiltersAndAcknowledges(t *testing.T) {
+	store := NewMemoryEventStore(3)
+	start := time.Now()
+	add := func(eventType, severity string, age time.Duration) *SecurityEvent {
+		event := &SecurityEvent{Type: eventType, Severity: severity, Timestamp: start.Add(-age)}
+		require.NoError(t, store.AddSecurityEvent(event))
+		return event
+	}
+
+	add("tor_disconnected", "critical", 4*time.Hour)
+	leak := add("leak_detected", "critical", 3*time.Hour)
+	add("security_score_low", "warning", 2*time.Hour)
+	latest := add("leak_detected", "critical", time.Hour)
+	assert.Equal(t, int64(4), latest.ID)
+
+	all, err := store.ListSecurityEvents(EventFilter{})
+	require.NoError(t, err)
+	require.Len(t, all, 3, "the ring keeps only its capacity")
+	assert.Equal(t, latest.ID, all[0].ID, "newest first")
+
+	leaks, err := store.ListSecurityEvents(EventFilter{Types: []string{"leak_detected"}, Severities: []string{"critical"}})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{latest.ID, leak.ID}, []int64{leaks[0].ID, leaks[1].ID})
+
+	recent, err := store.ListSecurityEvents(EventFilter{Since: start.Add(-150 * time.Minute)})
+	require.NoError(t, err)
+	assert.Len(t, recent, 2)
+
+	page, err := store.ListSecurityEvents(EventFilter{Before: latest.ID, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	assert.Equal(t, "security_score_low", page[0].Type)
+
+	count, err := store.AcknowledgeSecurityEvents([]int64{leak.ID}, start)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	open, err := store.ListSecurityEvents(EventFilter{Unacknowledged: true})
+	require.NoError(t, err)
+	assert.Len(t, open, 2)
+
+	count, err = store.AcknowledgeSecurityEvents(nil, start)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	pruned, err := store.PruneSecurityEvents(start.Add(-90*time.Minute), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pruned)
+
+	require.NoError(t, store.ClearSecurityEvents())
+	all, err = store.ListSecurityEvents(EventFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestNoLogsEventStoreKeepsEventsOffDisk(t *testing.T) {
+	persistent := NewMemoryEventStore(10)
+	noLogs := false
+	store := NewNoLogsEventStore(persistent, func() bool { return noLogs })
+
+	require.NoError(t, store.AddSecurityEvent(&SecurityEvent{Type: "tor_disconnected"}))
+	noLogs = true
+	require.NoError(t, store.PurgePersisted())
+	require.NoError(t, store.AddSecurityEvent(&SecurityEvent{Type: "leak_detected"}))
+
+	stored, err := persistent.ListSecurityEvents(EventFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, stored, "nothing is persisted while no-logs mode is on")
+	events, err := store.ListSecurityEvents(EventFilter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "leak_detected", events[0].Type)
+}
@@ -0,0 +1,522 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/argon2"
+)
+
+// The keyring holds one or more random 256-bit master keys. Each master key
+// is stored wrapped by a key-encryption key derived from the passphrase with
+// Argon2id, so changing the passphrase only re-wraps the master keys.
+// Files and records get their own random data key, wrapped by the active
+// master key and stored next to the ciphertext together with the master key
+// ID. Rotation adds a new active master key; older ones stay available to
+// unwrap existing data keys.
+const (
+	keyringVersion    = 1
+	keyringKeySize    = 32
+	keyringSaltSize   = 32
+	keyringKDFTime    = 3
+	keyringKDFMemory  = 64 * 1024
+	keyringKDFThreads = 4
+
+	// KeyringSettingKey is the settings row the keyring is persisted in. The
+	// system_ prefix keeps it out of ClearUserSettings.
+	KeyringSettingKey = "system_keyring"
+
+	minKeyringPassphrase = 12
+)
+
+var (
+	ErrKeyringLocked         = errors.New("keyring is locked")
+	ErrKeyringNotInitialized = errors.New("keyring has not been initialized")
+	ErrKeyringInitialized    = errors.New("keyring is already initialized")
+	ErrKeyringPassphrase     = errors.New("incorrect keyring passphrase")
+	ErrKeyringUnknownKey     = errors.New("unknown keyring key")
+	ErrKeyringWeakPassphrase = fmt.Errorf("keyring passphrase must be at least %d characters", minKeyringPassphrase)
+)
+
+// KeyringStore persists the serialized keyring. Load returns nil data when
+// no keyring has been created yet.
+type KeyringStore interface {
+	Load() ([]byte, error)
+	Save(data []byte) error
+}
+
+type settingsStore interface {
+	GetSetting(key string) (string, error)
+	SetSetting(key, value string) error
+}
+
+type settingsKeyringStore struct {
+	settings settingsStore
+	key      string
+}
+
+// NewSettingsKeyringStore stores the keyring in the settings table under
+// KeyringSettingKey.
+func NewSettingsKeyringStore(settings settingsStore) KeyringStore {
+	return &settingsKeyringStore{settings: settings, key: KeyringSettingKey}
+}
+
+func (s *settingsKeyringStore) Load() ([]byte, error) {
+	value, err := s.settings.GetSetting(s.key)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	return []byte(value), nil
+}
+
+func (s *settingsKeyringStore) Save(data []byte) error {
+	return s.settings.SetSetting(s.key, string(data))
+}
+
+type keyringKDF struct {
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+type keyringEntry struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Wrapped   []byte    `json:"wrapped"`
+}
+
+type keyringState struct {
+	Version int            `json:"version"`
+	KDF     keyringKDF     `json:"kdf"`
+	Active  string         `json:"active"`
+	Keys    []keyringEntry `json:"keys"`
+}
+
+// KeyringKeyInfo describes one master key without exposing it.
+type KeyringKeyInfo struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Active    bool      `json:"active"`
+}
+
+// KeyringStatus reports whether the keyring exists and is unlocked.
+type KeyringStatus struct {
+	Initialized bool             `json:"initialized"`
+	Unlocked    bool             `json:"unlocked"`
+	ActiveKeyID string           `json:"activeKeyId,omitempty"`
+	Keys        []KeyringKeyInfo `json:"keys"`
+}
+
+// Keyring manages the master keys and wraps per-file and per-record data
+// keys.
+type Keyring struct {
+	mu     sync.RWMutex
+	store  KeyringStore
+	state  *keyringState
+	kek    []byte
+	master map[string][]byte
+	logger *zap.Logger
+}
+
+// NewKeyring loads any persisted keyring from store. The keyring always
+// starts locked.
+func NewKeyring(store KeyringStore, logger *zap.Logger) (*Keyring, error) {
+	k := &Keyring{store: store, logger: logger}
+	data, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keyring: %w", err)
+	}
+	if len(data) == 0 {
+		return k, nil
+	}
+	var state keyringState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring: %w", err)
+	}
+	if state.Version != keyringVersion || len(state.Keys) == 0 {
+		return nil, fmt.Errorf("unsupported keyring version %d", state.Version)
+	}
+	k.state = &state
+	return k, nil
+}
+
+// Initialize creates the keyring with a first master key protected by
+// passphrase and leaves it unlocked.
+func (k *Keyring) Initialize(passphrase string) error {
+	if len(passphrase) < minKeyringPassphrase {
+		return ErrKeyringWeakPassphrase
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.state != nil {
+		return ErrKeyringInitialized
+	}
+
+	kdf, err := newKeyringKDF()
+	if err != nil {
+		return err
+	}
+	kek := kdf.derive(passphrase)
+	entry, key, err := newMasterKey(kek)
+	if err != nil {
+		return err
+	}
+	state := &keyringState{
+		Version: keyringVersion,
+		KDF:     kdf,
+		Active:  entry.ID,
+		Keys:    []keyringEntry{entry},
+	}
+	if err := k.save(state); err != nil {
+		return err
+	}
+
+	k.state = state
+	k.kek = kek
+	k.master = map[string][]byte{entry.ID: key}
+	k.logger.Info("Keyring initialized", zap.String("keyId", entry.ID))
+	return nil
+}
+
+// Unlock derives the key-encryption key from passphrase and unwraps every
+// master key.
+func (k *Keyring) Unlock(passphrase string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.state == nil {
+		return ErrKeyringNotInitialized
+	}
+	if k.master != nil {
+		return nil
+	}
+
+	kek := k.state.KDF.derive(passphrase)
+	master, err := unwrapMasterKeys(kek, k.state.Keys)
+	if err != nil {
+		wipeBytes(kek)
+		return err
+	}
+	k.kek = kek
+	k.master = master
+	return nil
+}
+
+// VerifyPassphrase reports whether passphrase unwraps the master keys,
+// without unlocking the keyring.
+func (k *Keyring) VerifyPassphrase(passphrase string) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.state == nil {
+		return ErrKeyringNotInitialized
+	}
+
+	kek := k.state.KDF.derive(passphrase)
+	defer wipeBytes(kek)
+	master, err := unwrapMasterKeys(kek, k.state.Keys)
+	if err != nil {
+		return err
+	}
+	for _, key := range master {
+		wipeBytes(key)
+	}
+	return nil
+}
+
+// Lock forgets the key-encryption key and all master keys.
+func (k *Keyring) Lock() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.lockLocked()
+}
+
+func (k *Keyring) lockLocked() {
+	wipeBytes(k.kek)
+	k.kek = nil
+	for _, key := range k.master {
+		wipeBytes(key)
+	}
+	k.master = nil
+}
+
+// IsInitialized reports whether a keyring has been created.
+func (k *Keyring) IsInitialized() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.state != nil
+}
+
+// IsUnlocked reports whether data keys can currently be wrapped and
+// unwrapped.
+func (k *Keyring) IsUnlocked() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.master != nil
+}
+
+// ChangePassphrase re-wraps the master keys under a new passphrase. Data
+// keys and the data they protect are untouched.
+func (k *Keyring) ChangePassphrase(current, next string) error {
+	if len(next) < minKeyringPassphrase {
+		return ErrKeyringWeakPassphrase
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.state == nil {
+		return ErrKeyringNotInitialized
+	}
+
+	oldKEK := k.state.KDF.derive(current)
+	defer wipeBytes(oldKEK)
+	master, err := unwrapMasterKeys(oldKEK, k.state.Keys)
+	if err != nil {
+		return err
+	}
+
+	kdf, err := newKeyringKDF()
+	if err != nil {
+		return err
+	}
+	kek := kdf.derive(next)
+	state := &keyringState{
+		Version: keyringVersion,
+		KDF:     kdf,
+		Active:  k.state.Active,
+		Keys:    make([]keyringEntry, 0, len(k.state.Keys)),
+	}
+	for _, entry := range k.state.Keys {
+		wrapped, err := sealGCM(kek, master[entry.ID], masterKeyAD(entry.ID))
+		if err != nil {
+			return err
+		}
+		state.Keys = append(state.Keys, keyringEntry{ID: entry.ID, CreatedAt: entry.CreatedAt, Wrapped: wrapped})
+	}
+	if err := k.save(state); err != nil {
+		return err
+	}
+
+	k.lockLocked()
+	k.state = state
+	k.kek = kek
+	k.master = master
+	k.logger.Info("Keyring passphrase changed")
+	return nil
+}
+
+// Rotate adds a new master key and makes it the one new data keys are
+// wrapped with.
+func (k *Keyring) Rotate() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.state == nil {
+		return "", ErrKeyringNotInitialized
+	}
+	if k.master == nil {
+		return "", ErrKeyringLocked
+	}
+
+	entry, key, err := newMasterKey(k.kek)
+	if err != nil {
+		return "", err
+	}
+	state := *k.state
+	state.Keys = append(append([]keyringEntry(nil), k.state.Keys...), entry)
+	state.Active = entry.ID
+	if err := k.save(&state); err != nil {
+		wipeBytes(key)
+		return "", err
+	}
+
+	k.state = &state
+	k.master[entry.ID] = key
+	k.logger.Info("Keyring master key rotated", zap.String("keyId", entry.ID))
+	return entry.ID, nil
+}
+
+// NewDataKey returns a random data key and its form wrapped by the active
+// master key.
+func (k *Keyring) NewDataKey() (keyID string, key, wrapped []byte, err error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.state == nil {
+		return "", nil, nil, ErrKeyringNotInitialized
+	}
+	if k.master == nil {
+		return "", nil, nil, ErrKeyringLocked
+	}
+
+	key = make([]byte, keyringKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	keyID = k.state.Active
+	wrapped, err = sealGCM(k.master[keyID], key, dataKeyAD(keyID))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return keyID, key, wrapped, nil
+}
+
+// UnwrapDataKey recovers a data key wrapped by master key keyID.
+func (k *Keyring) UnwrapDataKey(keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.state == nil {
+		return nil, ErrKeyringNotInitialized
+	}
+	if k.master == nil {
+		return nil, ErrKeyringLocked
+	}
+	master, ok := k.master[keyID]
+	if !ok {
+		return nil, ErrKeyringUnknownKey
+	}
+	key, err := openGCM(master, wrapped, dataKeyAD(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return key, nil
+}
+
+// Status describes the keyring without exposing key material.
+func (k *Keyring) Status() KeyringStatus {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	status := KeyringStatus{
+		Initialized: k.state != nil,
+		Unlocked:    k.master != nil,
+		Keys:        []KeyringKeyInfo{},
+	}
+	if k.state == nil {
+		return status
+	}
+	status.ActiveKeyID = k.state.Active
+	for _, entry := range k.state.Keys {
+		status.Keys = append(status.Keys, KeyringKeyInfo{
+			ID:        entry.ID,
+			CreatedAt: entry.CreatedAt,
+			Active:    entry.ID == k.state.Active,
+		})
+	}
+	sort.Slice(status.Keys, func(a, b int) bool {
+		return status.Keys[a].CreatedAt.After(status.Keys[b].CreatedAt)
+	})
+	return status
+}
+
+func (k *Keyring) save(state *keyringState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to serialize keyring: %w", err)
+	}
+	if err := k.store.Save(data); err != nil {
+		return fmt.Errorf("failed to persist keyring: %w", err)
+	}
+	return nil
+}
+
+func newKeyringKDF() (keyringKDF, error) {
+	kdf := keyringKDF{
+		Salt:    make([]byte, keyringSaltSize),
+		Time:    keyringKDFTime,
+		Memory:  keyringKDFMemory,
+		Threads: keyringKDFThreads,
+	}
+	if _, err := rand.Read(kdf.Salt); err != nil {
+		return kdf, fmt.Errorf("failed to generate keyring salt: %w", err)
+	}
+	return kdf, nil
+}
+
+func (kdf keyringKDF) derive(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, keyringKeySize)
+}
+
+func newMasterKey(kek []byte) (keyringEntry, []byte, error) {
+	id := make([]byte, 8)
+	key := make([]byte, keyringKeySize)
+	if _, err := rand.Read(id); err != nil {
+		return keyringEntry{}, nil, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	if _, err := rand.Read(key); err != nil {
+		return keyringEntry{}, nil, fmt.Errorf("failed to generate master key: %w", err)
+	}
+	entry := keyringEntry{ID: hex.EncodeToString(id), CreatedAt: time.Now().UTC()}
+	wrapped, err := sealGCM(kek, key, masterKeyAD(entry.ID))
+	if err != nil {
+		return keyringEntry{}, nil, err
+	}
+	entry.Wrapped = wrapped
+	return entry, key, nil
+}
+
+func unwrapMasterKeys(kek []byte, entries []keyringEntry) (map[string][]byte, error) {
+	master := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		key, err := openGCM(kek, entry.Wrapped, masterKeyAD(entry.ID))
+		if err != nil {
+			for _, unwrapped := range master {
+				wipeBytes(unwrapped)
+			}
+			return nil, ErrKeyringPassphrase
+		}
+		master[entry.ID] = key
+	}
+	return master, nil
+}
+
+func masterKeyAD(id string) []byte {
+	return []byte("b2-keyring-master:" + id)
+}
+
+func dataKeyAD(id string) []byte {
+	return []byte("b2-keyring-data:" + id)
+}
+
+// sealGCM encrypts plaintext with AES-256-GCM under key, binding it to ad.
+// The result is nonce || ciphertext || tag.
+func sealGCM(key, plaintext, ad []byte) ([]byte, error) {
+	gcm, err := gcmCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func openGCM(key, sealed, ad []byte) ([]byte, error) {
+	gcm, err := gcmCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], ad)
+}
+
+func gcmCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,240 @@
+package security
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type memoryKeyringStore struct {
+	data []byte
+}
+
+func (s *memoryKeyringStore) Load() ([]byte, error) { return s.data, nil }
+
+func (s *memoryKeyringStore) Save(data []byte) error {
+	s.data = append([]byte(nil), data...)
+	return nil
+}
+
+func newTestKeyring(t *testing.T, store KeyringStore) *Keyring {
+	t.Helper()
+	keyring, err := NewKeyring(store, zap.NewNop())
+	require.NoError(t, err)
+	return keyring
+}
+
+func TestKeyringLifecycle(t *testing.T) {
+	store := &memoryKeyringStore{}
+	keyring := newTestKeyring(t, store)
+
+	assert.False(t, keyring.Status().Initialized)
+	assert.ErrorIs(t, keyring.Unlock("correct horse battery"), ErrKeyringNotInitialized)
+	assert.ErrorIs(t, keyring.Initialize("short"), ErrKeyringWeakPassphrase)
+	require.NoError(t, keyring.Initialize("correct horse battery"))
+	assert.ErrorIs(t, keyring.Initialize("correct horse battery"), ErrKeyringInitialized)
+	assert.True(t, keyring.IsUnlocked())
+
+	keyID, key, wrapped, err := keyring.NewDataKey()
+	require.NoError(t, err)
+	assert.Len(t, key, keyringKeySize)
+	assert.NotContains(t, string(store.data), string(key))
+
+	keyring.Lock()
+	_, _, _, err = keyring.NewDataKey()
+	assert.ErrorIs(t, err, ErrKeyringLocked)
+
+	reloaded := newTestKeyring(t, store)
+	assert.False(t, reloaded.IsUnlocked())
+	assert.ErrorIs(t, reloaded.Unlock("wrong passphrase!"), ErrKeyringPassphrase)
+	require.NoError(t, reloaded.Unlock("correct horse battery"))
+	unwrapped, err := reloaded.UnwrapDataKey(keyID, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, key, unwrapped)
+}
+
+func TestKeyringPassphraseChangeAndRotation(t *testing.T) {
+	store := &memoryKeyringStore{}
+	keyring := newTestKeyring(t, store)
+	require.NoError(t, keyring.Initialize("first passphrase"))
+	oldID, oldKey, oldWrapped, err := keyring.NewDataKey()
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, keyring.ChangePassphrase("not the passphrase", "second passphrase"), ErrKeyringPassphrase)
+	require.NoError(t, keyring.ChangePassphrase("first passphrase", "second passphrase"))
+
+	newID, err := keyring.Rotate()
+	require.NoError(t, err)
+	assert.NotEqual(t, oldID, newID)
+	assert.Equal(t, newID, keyring.Status().ActiveKeyID)
+	assert.Len(t, keyring.Status().Keys, 2)
+
+	rotatedID, _, _, err := keyring.NewDataKey()
+	require.NoError(t, err)
+	assert.Equal(t, newID, rotatedID)
+
+	reloaded := newTestKeyring(t, store)
+	assert.ErrorIs(t, reloaded.Unlock("first passphrase"), ErrKeyringPassphrase)
+	require.NoError(t, reloaded.Unlock("second passphrase"))
+	unwrapped, err := reloaded.UnwrapDataKey(oldID, oldWrapped)
+	require.NoError(t, err)
+	assert.Equal(t, oldKey, unwrapped)
+
+	_, err = reloaded.UnwrapDataKey(newID, oldWrapped)
+	assert.Error(t, err, "a data key must only unwrap under the master key that wrapped it")
+}
+
+func TestEncryptFileWithKeyring(t *testing.T) {
+	keyring := newTestKeyring(t, &memoryKeyringStore{})
+	require.NoError(t, keyring.Initialize("keyring passphrase"))
+
+	manager := testEncryptionManager()
+	manager.config.ChunkSize = minStreamChunkSize
+	manager.SetKeyring(keyring)
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "input.bin")
+	encryptedPath := filepath.Join(tempDir, "input.bin.b2encrypted")
+	decryptedPath := filepath.Join(tempDir, "decrypted.bin")
+	plaintext := bytes.Repeat([]byte("keyring data "), 1000)
+	require.NoError(t, os.WriteFile(inputPath, plaintext, 0600))
+
+	require.NoError(t, manager.EncryptFile(inputPath, encryptedPath, ""))
+	encrypted, err := os.ReadFile(encryptedPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(encrypted, []byte("B2ENCRYPT:3:AES-256-GCM:Keyring:"+keyring.Status().ActiveKeyID+":")))
+
+	require.NoError(t, manager.DecryptFile(encryptedPath, decryptedPath, ""))
+	decrypted, err := os.ReadFile(decryptedPath)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	var part bytes.Buffer
+	_, err = manager.DecryptRange(encryptedPath, "", 4090, 20, &part)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext[4090:4110], part.Bytes())
+
+	keyring.Lock()
+	_, err = manager.DecryptRange(encryptedPath, "", 0, 10, io.Discard)
+	assert.ErrorIs(t, err, ErrKeyringLocked)
+}
+
+func TestDataEncryptionUsesPerRecordKeys(t *testing.T) {
+	keyring := newTestKeyring(t, &memoryKeyringStore{})
+	require.NoError(t, keyring.Initialize("keyring passphrase"))
+	de, err := NewDataEncryption(keyring, zap.NewNop())
+	require.NoError(t, err)
+
+	first, err := de.Encrypt("magnet:?xt=urn:btih:abc")
+	require.NoError(t, err)
+	second, err := de.Encrypt("magnet:?xt=urn:btih:abc")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.True(t, IsEncryptedRecord(first))
+
+	plaintext, err := de.Decrypt(first)
+	require.NoError(t, err)
+	assert.Equal(t, "magnet:?xt=urn:btih:abc", plaintext)
+
+	_, err = de.Decrypt(first[:len(first)-2] + "AA")
+	assert.Error(t, err)
+}
+
+func TestFieldEncryption(t *testing.T) {
+	keyring := newTestKeyring(t, &memoryKeyringStore{})
+	de, err := NewDataEncryption(keyring, zap.NewNop())
+	require.NoError(t, err)
+
+	value, err := de.SealField("/data/downloads")
+	require.NoError(t, err)
+	assert.Equal(t, "/data/downloads", value, "values written before the keyring exists stay plaintext")
+
+	require.NoError(t, keyring.Initialize("keyring passphrase"))
+	sealed, err := de.SealField("/data/downloads")
+	require.NoError(t, err)
+	assert.True(t, IsEncryptedRecord(sealed))
+	assert.Contains(t, sealed, "."+keyring.Status().ActiveKeyID+".")
+
+	opened, err := de.OpenField(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "/data/downloads", opened)
+	opened, err = de.OpenField("legacy plaintext")
+	require.NoError(t, err)
+	assert.Equal(t, "legacy plaintext", opened)
+
+	keyring.Lock()
+	_, err = de.OpenField(sealed)
+	assert.ErrorIs(t, err, ErrKeyringLocked)
+	_, err = de.SealField("/data/downloads")
+	assert.ErrorIs(t, err, ErrKeyringLocked)
+
+	var disabled *DataEncryption
+	_, err = disabled.OpenField(sealed)
+	assert.Error(t, err)
+
+	assert.True(t, IsSensitiveSetting("download_path"))
+	assert.True(t, IsSensitiveSetting("vless_uuid"))
+	assert.False(t, IsSensitiveSetting("max_connections"))
+}
+
+func TestDuressPassphrase(t *testing.T) {
+	store := &memoryKeyringStore{}
+	duress, err := NewDuress(store)
+	require.NoError(t, err)
+
+	matched, _ := duress.Match("anything at all")
+	assert.False(t, matched)
+	assert.ErrorIs(t, duress.Configure("short", true), ErrKeyringWeakPassphrase)
+	require.NoError(t, duress.Configure("under duress phrase", true))
+	assert.NotContains(t, string(store.data), "under duress phrase")
+
+	reloaded, err := NewDuress(store)
+	require.NoError(t, err)
+	assert.True(t, reloaded.IsConfigured())
+	matched, wipeData := reloaded.Match("under duress phrase")
+	assert.True(t, matched)
+	assert.True(t, wipeData)
+	matched, _ = reloaded.Match("correct horse battery")
+	assert.False(t, matched)
+
+	require.NoError(t, reloaded.Clear())
+	assert.False(t, reloaded.IsConfigured())
+	reloaded, err = NewDuress(store)
+	require.NoError(t, err)
+	assert.False(t, reloaded.IsConfigured())
+}
+
+func TestKeyringVerifyPassphraseKeepsItLocked(t *testing.T) {
+	keyring := newTestKeyring(t, &memoryKeyringStore{})
+	assert.ErrorIs(t, keyring.VerifyPassphrase("correct horse battery"), ErrKeyringNotInitialized)
+	require.NoError(t, keyring.Initialize("correct horse battery"))
+	keyring.Lock()
+
+	require.NoError(t, keyring.VerifyPassphrase("correct horse battery"))
+	assert.ErrorIs(t, keyring.VerifyPassphrase("wrong passphrase!"), ErrKeyringPassphrase)
+	assert.False(t, keyring.IsUnlocked())
+}
+
+func TestSealWithPassphrase(t *testing.T) {
+	_, err := SealWithPassphrase("short", []byte("secret"))
+	assert.ErrorIs(t, err, ErrWeakExportPassphrase)
+
+	record, err := SealWithPassphrase("correct horse battery", []byte("secret"))
+	require.NoError(t, err)
+	assert.NotContains(t, record, "secret")
+
+	plaintext, err := OpenWithPassphrase("correct horse battery", record)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	_, err = OpenWithPassphrase("wrong horse battery", record)
+	assert.ErrorIs(t, err, ErrPassphraseRecord)
+	_, err = OpenWithPassphrase("correct horse battery", record[:len(record)-2])
+	assert.ErrorIs(t, err, ErrPassphraseRecord)
+}
@@ -10,6 +10,41 @@ import (
 	"go.uber.org/zap"
 )
 
+// KillSwitchMode selects what happens to torrents when the kill switch fires.
+type KillSwitchMode string
+
+const (
+	// KillSwitchSoft suspends all network activity but keeps torrents so they
+	// can be resumed after the kill switch is reset.
+	KillSwitchSoft KillSwitchMode = "soft"
+	// KillSwitchHard removes every torrent and its persisted state.
+	KillSwitchHard KillSwitchMode = "hard"
+)
+
+// ParseKillSwitchMode validates a mode name, falling back to soft for empty input.
+func ParseKillSwitchMode(value string) (KillSwitchMode, error) {
+	switch KillSwitchMode(value) {
+	case "", KillSwitchSoft:
+		return KillSwitchSoft, nil
+	case KillSwitchHard:
+		return KillSwitchHard, nil
+	default:
+		return "", fmt.Errorf("invalid kill switch mode: %s", value)
+	}
+}
+
+// KillSwitchStatus is a point-in-time snapshot of the kill switch.
+type KillSwitchStatus struct {
+	Enabled       bool           `json:"enabled"`
+	Triggered     bool           `json:"triggered"`
+	Mode          KillSwitchMode `json:"mode"`
+	TriggeredMode KillSwitchMode `json:"triggeredMode,omitempty"`
+	Reason        string         `json:"reason,omitempty"`
+	TriggeredAt   *time.Time     `json:"triggeredAt,omitempty"`
+	Violations    int            `json:"violations"`
+	MaxViolations int            `json:"maxViolations"`
+}
+
 // KillSwitch monitors network connections and kills all traffic if privacy is compromised
 type KillSwitch struct {
 	enabled       bool
@@ -18,15 +53,22 @@ type KillSwitch struct {
 	violations    int
 	maxViolations int
 	isTriggered   bool
-	onTrigger     func()
+	mode          KillSwitchMode
+	triggeredMode KillSwitchMode
+	reason        string
+	triggeredAt   time.Time
+	onTrigger     func(mode KillSwitchMode, reason string) error
+	onReset       func() error
 }
 
-func NewKillSwitch(logger *zap.Logger, onTrigger func()) *KillSwitch {
+func NewKillSwitch(logger *zap.Logger, onTrigger func(KillSwitchMode, string) error, onReset func() error) *KillSwitch {
 	return &KillSwitch{
 		enabled:       true,
 		logger:        logger,
 		maxViolations: 3,
+		mode:          KillSwitchSoft,
 		onTrigger:     onTrigger,
+		onReset:       onReset,
 	}
 }
 
@@ -41,6 +83,7 @@ func (ks *KillSwitch) Disable() {
 	ks.mu.Lock()
 	defer ks.mu.Unlock()
 	ks.enabled = false
+	ks.violations = 0
 	ks.logger.Info("Kill switch disabled")
 }
 
@@ -56,25 +99,119 @@ func (ks *KillSwitch) IsTriggered() bool {
 	return ks.isTriggered
 }
 
-func (ks *KillSwitch) CheckConnection(ctx context.Context, testURL string) error {
-	if !ks.IsEnabled() {
-		return nil
+// SetMode sets the mode used when the kill switch fires automatically.
+func (ks *KillSwitch) SetMode(mode KillSwitchMode) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.mode = mode
+}
+
+func (ks *KillSwitch) Mode() KillSwitchMode {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.mode
+}
+
+func (ks *KillSwitch) Status() KillSwitchStatus {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	status := KillSwitchStatus{
+		Enabled:       ks.enabled,
+		Triggered:     ks.isTriggered,
+		Mode:          ks.mode,
+		Violations:    ks.violations,
+		MaxViolations: ks.maxViolations,
 	}
+	if ks.isTriggered {
+		triggeredAt := ks.triggeredAt
+		status.TriggeredMode = ks.triggeredMode
+		status.Reason = ks.reason
+		status.TriggeredAt = &triggeredAt
+	}
+	return status
+}
+
+// RecordViolation counts a failed health check or security event. Once the
+// violation budget is exhausted an enabled kill switch fires in its
+// configured mode.
+func (ks *KillSwitch) RecordViolation(reason string) {
+	ks.mu.Lock()
+	if !ks.enabled || ks.isTriggered {
+		ks.mu.Unlock()
+		return
+	}
+
+	ks.violations++
+	ks.logger.Warn("Kill switch violation recorded",
+		zap.Int("violations", ks.violations),
+		zap.Int("maxViolations", ks.maxViolations),
+	)
+	if ks.violations < ks.maxViolations {
+		ks.mu.Unlock()
+		return
+	}
+
+	mode := ks.mode
+	ks.markTriggeredLocked(mode, reason)
+	ks.mu.Unlock()
+
+	go func() {
+		if err := ks.runTrigger(mode, reason); err != nil {
+			ks.logger.Error("Kill switch trigger action failed", zap.Error(err))
+		}
+	}()
+}
 
+// RecordHealthy clears accumulated violations after a successful check.
+func (ks *KillSwitch) RecordHealthy() {
 	ks.mu.Lock()
 	defer ks.mu.Unlock()
+	ks.violations = 0
+}
+
+// Trigger fires the kill switch immediately. Manual triggers work even when
+// automatic triggering is disabled.
+func (ks *KillSwitch) Trigger(mode KillSwitchMode, reason string) error {
+	ks.mu.Lock()
+	if ks.isTriggered && ks.triggeredMode == KillSwitchHard {
+		ks.mu.Unlock()
+		return nil
+	}
+	ks.markTriggeredLocked(mode, reason)
+	ks.mu.Unlock()
+
+	return ks.runTrigger(mode, reason)
+}
+
+func (ks *KillSwitch) markTriggeredLocked(mode KillSwitchMode, reason string) {
+	ks.isTriggered = true
+	ks.triggeredMode = mode
+	ks.reason = reason
+	ks.triggeredAt = time.Now().UTC()
+}
+
+func (ks *KillSwitch) runTrigger(mode KillSwitchMode, reason string) error {
+	ks.logger.Error("KILL SWITCH TRIGGERED - All connections terminated for security",
+		zap.String("mode", string(mode)),
+	)
+	if ks.onTrigger == nil {
+		return nil
+	}
+	return ks.onTrigger(mode, reason)
+}
+
+func (ks *KillSwitch) CheckConnection(ctx context.Context, testURL string) error {
+	if !ks.IsEnabled() {
+		return nil
+	}
 
 	// Test if connection is going through proxy
-	conn, err := net.DialTimeout("tcp", testURL, 5*time.Second)
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", testURL)
 	if err != nil {
-		ks.violations++
-		ks.logger.Warn("Connection test failed",
-			zap.Int("violations", ks.violations),
-			zap.Int("maxViolations", ks.maxViolations),
-		)
-
-		if ks.violations >= ks.maxViolations {
-			ks.trigger()
+		ks.RecordViolation("connection test failed")
+		if ks.IsTriggered() {
 			return fmt.Errorf("kill switch triggered: too many connection violations")
 		}
 		return err
@@ -82,27 +219,23 @@ func (ks *KillSwitch) CheckConnection(ctx context.Context, testURL string) error
 	defer conn.Close()
 
 	// Reset violations on successful connection
-	ks.violations = 0
+	ks.RecordHealthy()
 	return nil
 }
 
-func (ks *KillSwitch) trigger() {
-	if ks.isTriggered {
-		return
-	}
-
-	ks.isTriggered = true
-	ks.logger.Error("KILL SWITCH TRIGGERED - All connections terminated for security")
-
-	if ks.onTrigger != nil {
-		go ks.onTrigger()
-	}
-}
-
-func (ks *KillSwitch) Reset() {
+// Reset re-arms the kill switch and lets network activity resume.
+func (ks *KillSwitch) Reset() error {
 	ks.mu.Lock()
-	defer ks.mu.Unlock()
 	ks.violations = 0
 	ks.isTriggered = false
+	ks.triggeredMode = ""
+	ks.reason = ""
+	ks.triggeredAt = time.Time{}
+	ks.mu.Unlock()
+
 	ks.logger.Info("Kill switch reset")
+	if ks.onReset == nil {
+		return nil
+	}
+	return ks.onReset()
 }
@@ -0,0 +1,88 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestKillSwitchTriggersAfterViolationBudget(t *testing.T) {
+	fired := make(chan KillSwitchMode, 1)
+	ks := NewKillSwitch(zap.NewNop(), func(mode KillSwitchMode, reason string) error {
+		fired <- mode
+		return nil
+	}, nil)
+
+	ks.RecordViolation("tor down")
+	ks.RecordViolation("tor down")
+	ks.RecordHealthy()
+	ks.RecordViolation("tor down")
+	ks.RecordViolation("tor down")
+	assert.False(t, ks.IsTriggered(), "a healthy check should clear earlier violations")
+
+	ks.RecordViolation("tor down")
+	select {
+	case mode := <-fired:
+		assert.Equal(t, KillSwitchSoft, mode)
+	case <-time.After(time.Second):
+		t.Fatal("kill switch did not fire")
+	}
+
+	status := ks.Status()
+	assert.True(t, status.Triggered)
+	assert.Equal(t, KillSwitchSoft, status.TriggeredMode)
+	assert.Equal(t, "tor down", status.Reason)
+	require.NotNil(t, status.TriggeredAt)
+}
+
+func TestKillSwitchDisabledIgnoresViolations(t *testing.T) {
+	ks := NewKillSwitch(zap.NewNop(), func(KillSwitchMode, string) error {
+		t.Fatal("disabled kill switch must not fire automatically")
+		return nil
+	}, nil)
+	ks.Disable()
+
+	for i := 0; i < 5; i++ {
+		ks.RecordViolation("leak")
+	}
+	assert.False(t, ks.IsTriggered())
+}
+
+func TestKillSwitchManualTriggerAndReset(t *testing.T) {
+	var triggered []KillSwitchMode
+	resets := 0
+	ks := NewKillSwitch(zap.NewNop(), func(mode KillSwitchMode, reason string) error {
+		triggered = append(triggered, mode)
+		return nil
+	}, func() error {
+		resets++
+		return nil
+	})
+	ks.Disable()
+
+	require.NoError(t, ks.Trigger(KillSwitchSoft, "manual"))
+	require.NoError(t, ks.Trigger(KillSwitchHard, "manual"))
+	require.NoError(t, ks.Trigger(KillSwitchSoft, "manual"))
+	assert.Equal(t, []KillSwitchMode{KillSwitchSoft, KillSwitchHard}, triggered, "a hard kill cannot be downgraded")
+
+	require.NoError(t, ks.Reset())
+	assert.Equal(t, 1, resets)
+	assert.False(t, ks.IsTriggered())
+	assert.Nil(t, ks.Status().TriggeredAt)
+}
+
+func TestParseKillSwitchMode(t *testing.T) {
+	mode, err := ParseKillSwitchMode("")
+	require.NoError(t, err)
+	assert.Equal(t, KillSwitchSoft, mode)
+
+	mode, err = ParseKillSwitchMode("hard")
+	require.NoError(t, err)
+	assert.Equal(t, KillSwitchHard, mode)
+
+	_, err = ParseKillSwitchMode("nuclear")
+	assert.Error(t, err)
+}
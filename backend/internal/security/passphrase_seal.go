@@ -0,0 +1,69 @@
+package security
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// passphraseRecordPrefix marks values produced by SealWithPassphrase:
+// b2p1.<salt>.<ciphertext>, with unpadded base64url fields. The key is
+// derived with Argon2id and the keyring's parameters, so that a record can
+// be opened on another installation with the passphrase alone.
+const passphraseRecordPrefix = "b2p1"
+
+var (
+	ErrPassphraseRecord     = errors.New("incorrect passphrase or damaged record")
+	ErrWeakExportPassphrase = fmt.Errorf("passphrase must be at least %d characters", minKeyringPassphrase)
+)
+
+// SealWithPassphrase encrypts plaintext under a key derived from
+// passphrase, for data that leaves the keyring, such as settings exports.
+func SealWithPassphrase(passphrase string, plaintext []byte) (string, error) {
+	if len(passphrase) < minKeyringPassphrase {
+		return "", ErrWeakExportPassphrase
+	}
+	kdf, err := newKeyringKDF()
+	if err != nil {
+		return "", err
+	}
+	key := kdf.derive(passphrase)
+	defer wipeBytes(key)
+
+	sealed, err := sealGCM(key, plaintext, []byte(passphraseRecordPrefix))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		passphraseRecordPrefix,
+		base64.RawURLEncoding.EncodeToString(kdf.Salt),
+		base64.RawURLEncoding.EncodeToString(sealed),
+	}, "."), nil
+}
+
+// OpenWithPassphrase reverses SealWithPassphrase.
+func OpenWithPassphrase(passphrase, record string) ([]byte, error) {
+	parts := strings.Split(record, ".")
+	if len(parts) != 3 || parts[0] != passphraseRecordPrefix {
+		return nil, ErrPassphraseRecord
+	}
+	salt, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(salt) != keyringSaltSize {
+		return nil, ErrPassphraseRecord
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrPassphraseRecord
+	}
+
+	kdf := keyringKDF{Salt: salt, Time: keyringKDFTime, Memory: keyringKDFMemory, Threads: keyringKDFThreads}
+	key := kdf.derive(passphrase)
+	defer wipeBytes(key)
+
+	plaintext, err := openGCM(key, sealed, []byte(passphraseRecordPrefix))
+	if err != nil {
+		return nil, ErrPassphraseRecord
+	}
+	return plaintext, nil
+}
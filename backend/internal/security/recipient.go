@@ -0,0 +1,164 @@
+package security
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Files encrypted to a recipient use the header
+// B2ENCRYPT:3:<alg>:Recipient:<fingerprint>:<sealed key>:<chunk>\n. The data
+// key is sealed with NaCl anonymous box to the recipient's X25519 public key,
+// so only the holder of the private key can decrypt the file; the server
+// keeps no copy.
+const (
+	recipientKDFName     = "Recipient"
+	recipientKeySize     = 32
+	recipientFingerprint = 8
+)
+
+// ErrRecipientKeyUnavailable is returned when a recipient-encrypted file is
+// read without the recipient's private key, and without the data key that
+// encrypted it in the same EncryptionManager.
+var ErrRecipientKeyUnavailable = errors.New("file is encrypted to a recipient key; the recipient's private key is required")
+
+// RecipientKey is an X25519 public or private key.
+type RecipientKey [recipientKeySize]byte
+
+// GenerateRecipientKey returns a new X25519 key pair.
+func GenerateRecipientKey() (public, private *RecipientKey, err error) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate recipient key: %w", err)
+	}
+	return (*RecipientKey)(pub), (*RecipientKey)(priv), nil
+}
+
+// ParseRecipientKey decodes a key written by RecipientKey.String. Standard
+// and URL-safe base64, padded or not, are accepted.
+func ParseRecipientKey(value string) (*RecipientKey, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "=")
+	var key RecipientKey
+	for _, encoding := range []*base64.Encoding{base64.RawStdEncoding, base64.RawURLEncoding} {
+		decoded, err := encoding.DecodeString(value)
+		if err == nil && len(decoded) == recipientKeySize {
+			copy(key[:], decoded)
+			return &key, nil
+		}
+	}
+	return nil, fmt.Errorf("recipient key must be %d bytes of base64", recipientKeySize)
+}
+
+// String encodes the key as standard base64.
+func (k *RecipientKey) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+// Public derives the public key of a private key.
+func (k *RecipientKey) Public() (*RecipientKey, error) {
+	public, err := curve25519.X25519(k[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient private key: %w", err)
+	}
+	var key RecipientKey
+	copy(key[:], public)
+	return &key, nil
+}
+
+// Fingerprint identifies a public key in file headers.
+func (k *RecipientKey) Fingerprint() string {
+	sum := sha256.Sum256(k[:])
+	return hex.EncodeToString(sum[:recipientFingerprint])
+}
+
+// SetRecipient makes an empty password encrypt to public instead of with a
+// keyring data key. Each file gets a fresh data key that em remembers until
+// ForgetRecipientKeys, so that its output can be verified before the
+// plaintext is wiped.
+func (em *EncryptionManager) SetRecipient(public *RecipientKey) {
+	em.recipient = public
+}
+
+// SetRecipientPrivateKey lets em decrypt files encrypted to the matching
+// public key.
+func (em *EncryptionManager) SetRecipientPrivateKey(private *RecipientKey) {
+	em.recipientPrivate = private
+}
+
+// ForgetRecipientKeys wipes the data keys of files em encrypted to a
+// recipient.
+func (em *EncryptionManager) ForgetRecipientKeys() {
+	for sealed, key := range em.recipientKeys {
+		wipeBytes(key)
+		delete(em.recipientKeys, sealed)
+	}
+}
+
+func (em *EncryptionManager) recipientStreamHeader(chunkSize int) (*streamHeader, cipher.AEAD, error) {
+	key := make([]byte, recipientKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	sealed, err := box.SealAnonymous(nil, key, (*[recipientKeySize]byte)(em.recipient), rand.Reader)
+	if err != nil {
+		wipeBytes(key)
+		return nil, nil, fmt.Errorf("failed to seal data key: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(sealed)
+	if em.recipientKeys == nil {
+		em.recipientKeys = make(map[string][]byte)
+	}
+	em.recipientKeys[encoded] = key
+
+	header := &streamHeader{
+		line: []byte(fmt.Sprintf(
+			"B2ENCRYPT:%s:%s:%s:%s:%s:%d\n",
+			streamFormatVersion,
+			em.config.Algorithm,
+			recipientKDFName,
+			em.recipient.Fingerprint(),
+			encoded,
+			chunkSize,
+		)),
+		chunkSize:  chunkSize,
+		keyID:      em.recipient.Fingerprint(),
+		wrappedKey: sealed,
+		recipient:  true,
+	}
+	aead, err := newAEAD(em.config.Algorithm, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, aead, nil
+}
+
+// recipientDataKey opens the sealed data key of a recipient-encrypted file.
+// The caller must not wipe the returned key when it came from the cache.
+func (em *EncryptionManager) recipientDataKey(header *streamHeader) ([]byte, bool, error) {
+	if key, ok := em.recipientKeys[base64.RawURLEncoding.EncodeToString(header.wrappedKey)]; ok {
+		return key, false, nil
+	}
+	if em.recipientPrivate == nil {
+		return nil, false, ErrRecipientKeyUnavailable
+	}
+	public, err := em.recipientPrivate.Public()
+	if err != nil {
+		return nil, false, err
+	}
+	if public.Fingerprint() != header.keyID {
+		return nil, false, fmt.Errorf("file is encrypted to a different recipient key")
+	}
+	key, ok := box.OpenAnonymous(nil, header.wrappedKey, (*[recipientKeySize]byte)(public), (*[recipientKeySize]byte)(em.recipientPrivate))
+	if !ok || len(key) != recipientKeySize {
+		return nil, false, fmt.Errorf("failed to open the file's data key")
+	}
+	return key, true, nil
+}
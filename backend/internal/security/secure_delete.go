@@ -0,0 +1,220 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DefaultWipePasses is the number of random overwrites used when no other
+// value is configured.
+const DefaultWipePasses = 3
+
+const wipeBufferSize = 4096
+
+// WipeResult reports the outcome of wiping one file.
+type WipeResult struct {
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// WipeFile overwrites a regular file with passes of random data, truncates
+// it, renames it to a random name and unlinks it, so neither its contents
+// nor its name stay in the directory. A symbolic link is refused rather than
+// followed. onWrite, when set, receives the number
+// of bytes overwritten after every write. A cancelled ctx stops the
+// overwrite and leaves the file in place.
+func WipeFile(ctx context.Context, filePath string, passes int, onWrite func(int64)) error {
+	if passes < 1 {
+		passes = DefaultWipePasses
+	}
+
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("secure deletion only supports regular files")
+	}
+
+	// #nosec G304 -- callers confine filePath to app-owned roots.
+	file, err := os.OpenFile(filePath, os.O_RDWR|openNoFollow, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	opened, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !os.SameFile(info, opened) {
+		return fmt.Errorf("file was replaced while it was being opened")
+	}
+	size := opened.Size()
+
+	buffer := make([]byte, wipeBufferSize)
+	for pass := 1; pass <= passes; pass++ {
+		if _, err := file.Seek(0, 0); err != nil {
+			return fmt.Errorf("failed to seek to start (pass %d): %w", pass, err)
+		}
+		for written := int64(0); written < size; {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			chunk := buffer
+			if remaining := size - written; remaining < int64(len(chunk)) {
+				chunk = chunk[:remaining]
+			}
+			if _, err := rand.Read(chunk); err != nil {
+				return fmt.Errorf("failed to generate random data (pass %d): %w", pass, err)
+			}
+			n, err := file.Write(chunk)
+			if err != nil {
+				return fmt.Errorf("failed to write random data (pass %d): %w", pass, err)
+			}
+			if n == 0 {
+				return fmt.Errorf("failed to write random data (pass %d): no bytes written", pass)
+			}
+			written += int64(n)
+			if onWrite != nil {
+				onWrite(int64(n))
+			}
+		}
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync to disk (pass %d): %w", pass, err)
+		}
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	return unlinkScrubbed(filePath)
+}
+
+// WipeTree wipes every regular file below root, which may itself be a
+// single file, and then removes the emptied directories. Symbolic links are
+// unlinked without being followed. Entries that could not be wiped are kept
+// along with their parent directories and reported in the results.
+func WipeTree(ctx context.Context, root string, passes int, onWrite func(int64)) ([]WipeResult, error) {
+	var results []WipeResult
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		result := WipeResult{Path: path, Name: filepath.Base(path)}
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			if entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case entry.IsDir():
+			dirs = append(dirs, path)
+			return nil
+		case entry.Type()&fs.ModeSymlink != 0:
+			if err := unlinkScrubbed(path); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Deleted = true
+			}
+		case entry.Type().IsRegular():
+			if info, err := entry.Info(); err == nil {
+				result.Size = info.Size()
+			}
+			if err := WipeFile(ctx, path, passes, onWrite); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Deleted = true
+			}
+		default:
+			result.Error = "secure deletion only supports regular files"
+		}
+		results = append(results, result)
+		return nil
+	})
+
+	// Remove directories deepest first; any that still hold a failed entry
+	// are left in place.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if entries, readErr := os.ReadDir(dirs[i]); readErr == nil && len(entries) == 0 {
+			_ = unlinkScrubbed(dirs[i])
+		}
+	}
+	return results, err
+}
+
+// WipeDirContents wipes everything inside dir but keeps dir itself.
+func WipeDirContents(ctx context.Context, dir string, passes int, onWrite func(int64)) ([]WipeResult, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var results []WipeResult
+	for _, entry := range entries {
+		tree, err := WipeTree(ctx, filepath.Join(dir, entry.Name()), passes, onWrite)
+		results = append(results, tree...)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// WipeTreeSize returns the total size of the regular files below root.
+func WipeTreeSize(root string) int64 {
+	var total int64
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// unlinkScrubbed renames path to a random name in the same directory before
+// removing it, so the original name is not left in a directory entry.
+func unlinkScrubbed(path string) error {
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return fmt.Errorf("failed to generate random name: %w", err)
+	}
+	scrubbed := filepath.Join(filepath.Dir(path), hex.EncodeToString(name))
+	if err := os.Rename(path, scrubbed); err != nil {
+		return fmt.Errorf("failed to rename before removal: %w", err)
+	}
+	if err := os.Remove(scrubbed); err != nil {
+		return fmt.Errorf("failed to remove file: %w", err)
+	}
+	_ = syncDir(filepath.Dir(path))
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
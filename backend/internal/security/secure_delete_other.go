@@ -0,0 +1,7 @@
+//go:build !unix
+
+package security
+
+// openNoFollow is not available here; WipeFile still compares the opened
+// file with the one it checked with Lstat.
+const openNoFollow = 0
@@ -0,0 +1,84 @@
+package security
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWipeFileScrubsNameAndContent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret-name.txt")
+	require.NoError(t, os.WriteFile(path, []byte("sensitive contents"), 0600))
+
+	var written int64
+	require.NoError(t, WipeFile(context.Background(), path, 2, func(n int64) { written += n }))
+	assert.Equal(t, int64(2*len("sensitive contents")), written)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestWipeFileRefusesSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	require.NoError(t, os.WriteFile(target, []byte("keep"), 0600))
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(target, link))
+
+	assert.Error(t, WipeFile(context.Background(), link, 1, nil))
+	kept, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(kept))
+}
+
+func TestWipeTreeRemovesNestedFilesAndDirectories(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "Some Torrent")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "disc1", "extras"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "disc1", "track.flac"), make([]byte, 5000), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "disc1", "extras", "cover.jpg"), make([]byte, 10), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "info.nfo"), nil, 0600))
+	outside := filepath.Join(parent, "outside.txt")
+	require.NoError(t, os.WriteFile(outside, []byte("keep"), 0600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "link")))
+
+	assert.Equal(t, int64(5010), WipeTreeSize(root))
+
+	results, err := WipeTree(context.Background(), root, 1, nil)
+	require.NoError(t, err)
+	assert.Len(t, results, 4)
+	for _, result := range results {
+		assert.True(t, result.Deleted, result.Path)
+	}
+
+	_, err = os.Stat(root)
+	assert.True(t, os.IsNotExist(err))
+	kept, err := os.ReadFile(outside)
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(kept), "symlink targets must not be followed")
+}
+
+func TestWipeDirContentsKeepsDirectory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "nested"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nested", "a.bin"), []byte("a"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.bin"), []byte("b"), 0600))
+
+	results, err := WipeDirContents(context.Background(), dir, 1, nil)
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	results, err = WipeDirContents(context.Background(), filepath.Join(dir, "missing"), 1, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
@@ -0,0 +1,9 @@
+//go:build unix
+
+package security
+
+import "syscall"
+
+// openNoFollow makes WipeFile fail instead of opening a symbolic link's
+// target.
+const openNoFollow = syscall.O_NOFOLLOW
@@ -0,0 +1,509 @@
+package security
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// B2ENCRYPT:3 layout:
+//
+//	header line  B2ENCRYPT:3:<alg>:<kdf>:<hash>:<iter>:<mem>:<par>:<time>:<chunk>\n
+//	salt         32 bytes
+//	nonce prefix 7 bytes
+//	chunks       ceil(size/chunk) sealed chunks, at least one
+//
+// Files encrypted with a keyring data key instead of a password use the
+// header B2ENCRYPT:3:<alg>:Keyring:<keyid>:<wrapped key>:<chunk>\n, where the
+// wrapped key is unpadded base64url, and carry no salt. Files encrypted to a
+// recipient public key use the same layout; see recipient.go.
+//
+// Every chunk holds <chunk> bytes of plaintext except the last, which may be
+// shorter or empty. Chunk i is sealed with nonce prefix||uint32(i)||last,
+// where last is 1 only for the final chunk, and the header, salt and prefix
+// as associated data. Reordering changes the counter, truncating at a chunk
+// boundary leaves no chunk sealed as last, and header edits break every tag.
+const (
+	streamFormatVersion = "3"
+	streamSaltSize      = 32
+	streamPrefixSize    = 7
+	streamTagSize       = 16
+	keyringKDFName      = "Keyring"
+
+	DefaultStreamChunkSize = 64 << 10
+	minStreamChunkSize     = 4 << 10
+	maxStreamChunkSize     = 16 << 20
+)
+
+var (
+	ErrTruncatedCiphertext = errors.New("encrypted file is truncated")
+	ErrTrailingCiphertext  = errors.New("encrypted file has data after its final chunk")
+)
+
+// streamHeader is a parsed B2ENCRYPT:3 preamble.
+type streamHeader struct {
+	line       []byte
+	salt       []byte
+	prefix     []byte
+	chunkSize  int
+	keyID      string
+	wrappedKey []byte
+	// recipient marks a data key sealed to a recipient public key, whose
+	// fingerprint keyID holds, rather than wrapped by the keyring.
+	recipient bool
+}
+
+func (h *streamHeader) preambleSize() int64 {
+	return int64(len(h.line) + len(h.salt) + len(h.prefix))
+}
+
+func (h *streamHeader) associatedData() []byte {
+	ad := make([]byte, 0, h.preambleSize())
+	ad = append(ad, h.line...)
+	ad = append(ad, h.salt...)
+	return append(ad, h.prefix...)
+}
+
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func newAEAD(algorithm string, key []byte) (cipher.AEAD, error) {
+	switch algorithm {
+	case "ChaCha20-Poly1305":
+		aead, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ChaCha20-Poly1305 cipher: %w", err)
+		}
+		return aead, nil
+	default: // AES-256-GCM
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCM: %w", err)
+		}
+		return gcm, nil
+	}
+}
+
+func (em *EncryptionManager) streamKey(password string, salt []byte) (cipher.AEAD, error) {
+	keySize := 32
+	if em.config.Algorithm == "ChaCha20-Poly1305" {
+		keySize = chacha20poly1305.KeySize
+	}
+	key, err := em.DeriveKey(password, salt, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("key derivation failed: %w", err)
+	}
+	return newAEAD(em.config.Algorithm, key)
+}
+
+// EncryptStream encrypts src into dst in the B2ENCRYPT:3 format using
+// constant memory. An empty password encrypts with a fresh data key, sealed
+// to the recipient set with SetRecipient or else wrapped by the keyring set
+// with SetKeyring.
+func (em *EncryptionManager) EncryptStream(src io.Reader, dst io.Writer, password string) error {
+	chunkSize := em.config.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultStreamChunkSize
+	}
+	if chunkSize < minStreamChunkSize || chunkSize > maxStreamChunkSize {
+		return fmt.Errorf("invalid chunk size")
+	}
+
+	var header *streamHeader
+	var aead cipher.AEAD
+	var err error
+	switch {
+	case password == "" && em.recipient != nil:
+		header, aead, err = em.recipientStreamHeader(chunkSize)
+	case password == "":
+		header, aead, err = em.keyringStreamHeader(chunkSize)
+	default:
+		header, aead, err = em.passwordStreamHeader(chunkSize, password)
+	}
+	if err != nil {
+		return err
+	}
+	header.prefix = make([]byte, streamPrefixSize)
+	if _, err := rand.Read(header.prefix); err != nil {
+		return fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
+
+	ad := header.associatedData()
+	if _, err := dst.Write(ad); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	reader := bufio.NewReaderSize(src, chunkSize)
+	plaintext := make([]byte, chunkSize)
+	sealed := make([]byte, 0, chunkSize+streamTagSize)
+	for counter := uint64(0); ; counter++ {
+		if counter > uint64(^uint32(0)) {
+			return fmt.Errorf("input exceeds the maximum number of chunks")
+		}
+		n, err := io.ReadFull(reader, plaintext)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		last := n < chunkSize
+		if !last {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				last = true
+			} else if peekErr != nil {
+				return fmt.Errorf("failed to read input: %w", peekErr)
+			}
+		}
+
+		sealed = aead.Seal(sealed[:0], streamNonce(header.prefix, uint32(counter), last), plaintext[:n], ad)
+		if _, err := dst.Write(sealed); err != nil {
+			return fmt.Errorf("failed to write ciphertext: %w", err)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+func (em *EncryptionManager) passwordStreamHeader(chunkSize int, password string) (*streamHeader, cipher.AEAD, error) {
+	header := &streamHeader{
+		line: []byte(fmt.Sprintf(
+			"B2ENCRYPT:%s:%s:%s:%s:%d:%d:%d:%d:%d\n",
+			streamFormatVersion,
+			em.config.Algorithm,
+			em.config.KeyDerivation,
+			em.config.HashAlgorithm,
+			em.config.Iterations,
+			em.config.MemoryCost,
+			em.config.Parallelism,
+			em.config.TimeCost,
+			chunkSize,
+		)),
+		salt:      make([]byte, streamSaltSize),
+		chunkSize: chunkSize,
+	}
+	if _, err := rand.Read(header.salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := em.streamKey(password, header.salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, aead, nil
+}
+
+func (em *EncryptionManager) keyringStreamHeader(chunkSize int) (*streamHeader, cipher.AEAD, error) {
+	if em.keyring == nil {
+		return nil, nil, fmt.Errorf("a password or keyring is required")
+	}
+	keyID, key, wrapped, err := em.keyring.NewDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer wipeBytes(key)
+
+	header := &streamHeader{
+		line: []byte(fmt.Sprintf(
+			"B2ENCRYPT:%s:%s:%s:%s:%s:%d\n",
+			streamFormatVersion,
+			em.config.Algorithm,
+			keyringKDFName,
+			keyID,
+			base64.RawURLEncoding.EncodeToString(wrapped),
+			chunkSize,
+		)),
+		chunkSize:  chunkSize,
+		keyID:      keyID,
+		wrappedKey: wrapped,
+	}
+	aead, err := newAEAD(em.config.Algorithm, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, aead, nil
+}
+
+// headerAEAD returns the cipher for a parsed header, unwrapping the data key
+// through the keyring for keyring-encrypted files and opening it with the
+// recipient's private key for recipient-encrypted ones.
+func (em *EncryptionManager) headerAEAD(header *streamHeader, password string) (cipher.AEAD, error) {
+	if header.keyID == "" {
+		return em.streamKey(password, header.salt)
+	}
+	if header.recipient {
+		key, opened, err := em.recipientDataKey(header)
+		if err != nil {
+			return nil, err
+		}
+		if opened {
+			defer wipeBytes(key)
+		}
+		return newAEAD(em.config.Algorithm, key)
+	}
+	if em.keyring == nil {
+		return nil, fmt.Errorf("file is encrypted with a keyring key but no keyring is available")
+	}
+	key, err := em.keyring.UnwrapDataKey(header.keyID, header.wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(key)
+	return newAEAD(em.config.Algorithm, key)
+}
+
+// parseStreamHeader reads the v3 preamble that follows an already consumed
+// header line and applies its parameters to em.
+func (em *EncryptionManager) parseStreamHeader(line []byte, parts []string, r io.Reader) (*streamHeader, error) {
+	if len(parts) == 7 && (parts[3] == keyringKDFName || parts[3] == recipientKDFName) {
+		return em.parseKeyringStreamHeader(line, parts, r)
+	}
+	if len(parts) != 10 {
+		return nil, fmt.Errorf("invalid encryption header")
+	}
+	if err := em.applyHeaderParams(parts[2:9]); err != nil {
+		return nil, err
+	}
+	chunkSize, err := strconv.Atoi(parts[9])
+	if err != nil || chunkSize < minStreamChunkSize || chunkSize > maxStreamChunkSize {
+		return nil, fmt.Errorf("invalid chunk size in header")
+	}
+
+	header := &streamHeader{
+		line:      line,
+		salt:      make([]byte, streamSaltSize),
+		prefix:    make([]byte, streamPrefixSize),
+		chunkSize: chunkSize,
+	}
+	if _, err := io.ReadFull(r, header.salt); err != nil {
+		return nil, fmt.Errorf("encrypted payload is missing salt")
+	}
+	if _, err := io.ReadFull(r, header.prefix); err != nil {
+		return nil, fmt.Errorf("encrypted payload is missing nonce prefix")
+	}
+	return header, nil
+}
+
+func (em *EncryptionManager) parseKeyringStreamHeader(line []byte, parts []string, r io.Reader) (*streamHeader, error) {
+	em.config.Algorithm = parts[2]
+	if em.config.Algorithm != "AES-256-GCM" && em.config.Algorithm != "ChaCha20-Poly1305" {
+		return nil, fmt.Errorf("unsupported encryption algorithm in header")
+	}
+	if _, err := hex.DecodeString(parts[4]); err != nil || parts[4] == "" {
+		return nil, fmt.Errorf("invalid key id in header")
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key in header")
+	}
+	chunkSize, err := strconv.Atoi(parts[6])
+	if err != nil || chunkSize < minStreamChunkSize || chunkSize > maxStreamChunkSize {
+		return nil, fmt.Errorf("invalid chunk size in header")
+	}
+
+	header := &streamHeader{
+		line:       line,
+		prefix:     make([]byte, streamPrefixSize),
+		chunkSize:  chunkSize,
+		keyID:      parts[4],
+		wrappedKey: wrapped,
+		recipient:  parts[3] == recipientKDFName,
+	}
+	if _, err := io.ReadFull(r, header.prefix); err != nil {
+		return nil, fmt.Errorf("encrypted payload is missing nonce prefix")
+	}
+	return header, nil
+}
+
+// decryptStream authenticates and writes every chunk of a v3 payload in
+// order, rejecting truncated, reordered or extended ciphertext.
+func (em *EncryptionManager) decryptStream(header *streamHeader, src io.Reader, dst io.Writer, password string) error {
+	aead, err := em.headerAEAD(header, password)
+	if err != nil {
+		return err
+	}
+
+	ad := header.associatedData()
+	reader := bufio.NewReaderSize(src, header.chunkSize+streamTagSize)
+	sealed := make([]byte, header.chunkSize+streamTagSize)
+	plaintext := make([]byte, 0, header.chunkSize)
+	for counter := uint64(0); ; counter++ {
+		if counter > uint64(^uint32(0)) {
+			return fmt.Errorf("encrypted file has too many chunks")
+		}
+		n, err := io.ReadFull(reader, sealed)
+		if err == io.EOF {
+			return ErrTruncatedCiphertext
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if n < streamTagSize {
+			return ErrTruncatedCiphertext
+		}
+		last := n < len(sealed)
+		if !last {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				last = true
+			} else if peekErr != nil {
+				return fmt.Errorf("failed to read input: %w", peekErr)
+			}
+		}
+
+		plaintext, err = aead.Open(plaintext[:0], streamNonce(header.prefix, uint32(counter), last), sealed[:n], ad)
+		if err != nil {
+			if last {
+				// A chunk that is not sealed as final at the end of the file
+				// means the ciphertext was cut at a chunk boundary.
+				if _, retryErr := aead.Open(nil, streamNonce(header.prefix, uint32(counter), false), sealed[:n], ad); retryErr == nil {
+					return ErrTruncatedCiphertext
+				}
+			}
+			return fmt.Errorf("decryption failed: %w", err)
+		}
+		if _, err := dst.Write(plaintext); err != nil {
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// DecryptRange writes length bytes of plaintext starting at offset from a
+// B2ENCRYPT:3 file to w. Only the chunks covering the range are read and
+// authenticated. It returns the number of bytes written, which is shorter
+// than length when the range runs past the end of the plaintext.
+func (em *EncryptionManager) DecryptRange(inputPath, password string, offset, length int64, w io.Writer) (int64, error) {
+	if offset < 0 || length < 0 {
+		return 0, fmt.Errorf("invalid range")
+	}
+
+	// #nosec G304 -- API callers normalize and confine inputPath to app-owned roots.
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat input file: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	line, parts, err := readEncryptionHeader(reader)
+	if err != nil {
+		return 0, err
+	}
+	if parts[1] != streamFormatVersion {
+		return 0, fmt.Errorf("range decryption requires the B2ENCRYPT:3 format")
+	}
+	header, err := em.parseStreamHeader(line, parts, reader)
+	if err != nil {
+		return 0, err
+	}
+	aead, err := em.headerAEAD(header, password)
+	if err != nil {
+		return 0, err
+	}
+
+	sealedChunk := int64(header.chunkSize + streamTagSize)
+	payload := info.Size() - header.preambleSize()
+	if payload < streamTagSize {
+		return 0, ErrTruncatedCiphertext
+	}
+	chunks := (payload + sealedChunk - 1) / sealedChunk
+	if chunks-1 > int64(^uint32(0)) {
+		return 0, fmt.Errorf("encrypted file has too many chunks")
+	}
+	lastSealed := payload - (chunks-1)*sealedChunk
+	if lastSealed < streamTagSize {
+		return 0, ErrTruncatedCiphertext
+	}
+	plaintextSize := (chunks-1)*int64(header.chunkSize) + lastSealed - streamTagSize
+
+	if offset >= plaintextSize || length == 0 {
+		return 0, nil
+	}
+	end := offset + length
+	if end > plaintextSize || end < offset {
+		end = plaintextSize
+	}
+
+	ad := header.associatedData()
+	sealed := make([]byte, sealedChunk)
+	plaintext := make([]byte, 0, header.chunkSize)
+	var written int64
+	for index := offset / int64(header.chunkSize); index*int64(header.chunkSize) < end; index++ {
+		last := index == chunks-1
+		size := sealedChunk
+		if last {
+			size = lastSealed
+		}
+		if _, err := file.ReadAt(sealed[:size], header.preambleSize()+index*sealedChunk); err != nil {
+			return written, fmt.Errorf("failed to read chunk: %w", err)
+		}
+		plaintext, err = aead.Open(plaintext[:0], streamNonce(header.prefix, uint32(index), last), sealed[:size], ad)
+		if err != nil {
+			return written, fmt.Errorf("decryption failed: %w", err)
+		}
+
+		chunkStart := index * int64(header.chunkSize)
+		from := int64(0)
+		if offset > chunkStart {
+			from = offset - chunkStart
+		}
+		to := int64(len(plaintext))
+		if end < chunkStart+to {
+			to = end - chunkStart
+		}
+		n, err := w.Write(plaintext[from:to])
+		written += int64(n)
+		if err != nil {
+			return written, fmt.Errorf("failed to write output: %w", err)
+		}
+	}
+	return written, nil
+}
+
+// readEncryptionHeader reads and splits the header line shared by all
+// B2ENCRYPT versions.
+func readEncryptionHeader(reader *bufio.Reader) ([]byte, []string, error) {
+	var line []byte
+	for len(line) <= 256 {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid or missing encryption header")
+		}
+		line = append(line, b)
+		if b == '\n' {
+			parts := strings.Split(strings.TrimSuffix(string(line), "\n"), ":")
+			if len(parts) < 4 || parts[0] != "B2ENCRYPT" {
+				return nil, nil, fmt.Errorf("invalid encryption header")
+			}
+			return line, parts, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("invalid or missing encryption header")
+}
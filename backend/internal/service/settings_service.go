@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/KFN002/B-2-Torrent/backend/internal/repository"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
 	"github.com/KFN002/B-2-Torrent/backend/pkg/cache"
 	"go.uber.org/zap"
 )
@@ -24,6 +25,11 @@ func NewSettingsService(repo *repository.SettingsRepository, cache *cache.RedisC
 }
 
 func (s *SettingsService) Get(ctx context.Context, key string) (string, error) {
+	// Sensitive settings are encrypted at rest and never cached in plaintext
+	if security.IsSensitiveSetting(key) {
+		return s.repo.Get(ctx, key)
+	}
+
 	// Try cache first
 	cacheKey := "setting:" + key
 	var value string
@@ -52,8 +58,10 @@ func (s *SettingsService) Set(ctx context.Context, key, value string) error {
 	}
 
 	// Update cache
-	cacheKey := "setting:" + key
-	s.cache.Set(ctx, cacheKey, value, 5*time.Minute)
+	if !security.IsSensitiveSetting(key) {
+		cacheKey := "setting:" + key
+		s.cache.Set(ctx, cacheKey, value, 5*time.Minute)
+	}
 
 	s.logger.Info("Setting updated", zap.String("key", key))
 	return nil
@@ -0,0 +1,163 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+)
+
+// ExportVersion is the version of the export document written by Export.
+const ExportVersion = 1
+
+// Secrets selects what an export does with sensitive settings.
+type Secrets string
+
+const (
+	// SecretsExclude leaves sensitive settings out, so that the export can
+	// be taken while the keyring is locked.
+	SecretsExclude Secrets = "exclude"
+	// SecretsEncrypt seals sensitive settings with a passphrase, see
+	// security.SealWithPassphrase.
+	SecretsEncrypt Secrets = "encrypt"
+)
+
+// Export is a settings export document. Values have the types of the
+// settings schema. Sensitive settings are never written in plaintext.
+type Export struct {
+	Version    int                        `json:"version"`
+	ExportedAt time.Time                  `json:"exportedAt"`
+	Settings   map[string]json.RawMessage `json:"settings"`
+	// EncryptedSecrets holds sensitive settings sealed with a passphrase.
+	EncryptedSecrets string `json:"encryptedSecrets,omitempty"`
+}
+
+// ImportResult lists the settings an import stored, the unknown ones it
+// skipped and the stored ones that apply after a restart.
+type ImportResult struct {
+	Imported        []string `json:"imported"`
+	Skipped         []string `json:"skipped,omitempty"`
+	RestartRequired []string `json:"restartRequired,omitempty"`
+}
+
+// ParseSecrets validates a secrets mode; empty means SecretsExclude.
+func ParseSecrets(value string) (Secrets, error) {
+	switch Secrets(value) {
+	case "", SecretsExclude:
+		return SecretsExclude, nil
+	case SecretsEncrypt:
+		return SecretsEncrypt, nil
+	}
+	return "", fmt.Errorf("%w: secrets must be exclude or encrypt", ErrInvalid)
+}
+
+// Export writes every setting. Sensitive settings are handled as secrets
+// says; passphrase is only used with SecretsEncrypt.
+func (s *Store) Export(secrets Secrets, passphrase string) (Export, error) {
+	doc := Export{
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Settings:   make(map[string]json.RawMessage),
+	}
+	hidden := make(map[string]json.RawMessage)
+	for _, d := range registry {
+		if d.Sensitive && secrets == SecretsExclude {
+			continue
+		}
+		value, err := s.Get(d.Key)
+		if err != nil {
+			return Export{}, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return Export{}, err
+		}
+		if d.Sensitive {
+			hidden[d.Key] = data
+		} else {
+			doc.Settings[d.Key] = data
+		}
+	}
+
+	if secrets == SecretsEncrypt {
+		data, err := json.Marshal(hidden)
+		if err != nil {
+			return Export{}, err
+		}
+		if doc.EncryptedSecrets, err = security.SealWithPassphrase(passphrase, data); err != nil {
+			return Export{}, err
+		}
+	}
+	return doc, nil
+}
+
+// Import validates every setting of doc before storing any of them.
+// Settings this version does not know are skipped; managed settings are
+// imported too. Sensitive settings are only taken from the encrypted
+// secrets, which need the export's passphrase. Changes to security settings
+// are refused with ErrSecurity unless allowSecurity is set.
+func (s *Store) Import(doc Export, passphrase string, allowSecurity bool) (ImportResult, error) {
+	if doc.Version != ExportVersion {
+		return ImportResult{}, fmt.Errorf("%w: unsupported export version %d", ErrInvalid, doc.Version)
+	}
+	values := make(map[string]json.RawMessage, len(doc.Settings))
+	for key, value := range doc.Settings {
+		if d, ok := Lookup(key); ok && d.Sensitive {
+			return ImportResult{}, fmt.Errorf("%w: %s is sensitive and can only be imported from encrypted secrets", ErrInvalid, key)
+		}
+		values[key] = value
+	}
+	if doc.EncryptedSecrets != "" {
+		if passphrase == "" {
+			return ImportResult{}, fmt.Errorf("%w: the export's secrets are encrypted; a passphrase is required", ErrInvalid)
+		}
+		data, err := security.OpenWithPassphrase(passphrase, doc.EncryptedSecrets)
+		if err != nil {
+			return ImportResult{}, err
+		}
+		var secrets map[string]json.RawMessage
+		if err := json.Unmarshal(data, &secrets); err != nil {
+			return ImportResult{}, fmt.Errorf("%w: encrypted secrets are not a settings object", ErrInvalid)
+		}
+		for key, value := range secrets {
+			values[key] = value
+		}
+	}
+
+	var result ImportResult
+	for key := range values {
+		if _, ok := Lookup(key); !ok {
+			result.Skipped = append(result.Skipped, key)
+			delete(values, key)
+		}
+	}
+	sort.Strings(result.Skipped)
+
+	parsed, err := parse(values, true)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	if err := s.checkSecurity(parsed, allowSecurity); err != nil {
+		return ImportResult{}, err
+	}
+	result.Imported, err = s.write(parsed)
+	if err != nil {
+		return result, err
+	}
+	result.RestartRequired = RestartRequired(result.Imported)
+	return result, nil
+}
+
+// RestartRequired returns the keys among keys whose change applies after a
+// restart.
+func RestartRequired(keys []string) []string {
+	var restart []string
+	for _, key := range keys {
+		if byKey[key].Restart {
+			restart = append(restart, key)
+		}
+	}
+	return restart
+}
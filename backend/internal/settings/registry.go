@@ -0,0 +1,300 @@
+// Package settings declares every user setting the backend stores, with its
+// type, default and limits, and reads, writes, exports and imports them
+// through the database's settings table.
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/feeds"
+	"github.com/KFN002/B-2-Torrent/backend/internal/search"
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+)
+
+var (
+	ErrUnknown = errors.New("unknown setting")
+	ErrInvalid = errors.New("invalid setting")
+	// ErrManaged is returned for settings that only their own endpoints
+	// change, such as the feed list.
+	ErrManaged = errors.New("setting is managed by its own endpoints")
+	// ErrSecurity is returned when a caller that may not change security
+	// settings tries to.
+	ErrSecurity = errors.New("setting needs the security:admin scope")
+)
+
+// Type is the JSON type of a setting's value.
+type Type string
+
+const (
+	TypeBoolean Type = "boolean"
+	TypeInteger Type = "integer"
+	TypeString  Type = "string"
+	// TypeJSON values are JSON arrays owned by another package, such as the
+	// feed list.
+	TypeJSON Type = "json"
+)
+
+// maxRateLimit matches the largest rate limit the API accepts, in bytes per
+// second.
+const maxRateLimit = 10 * 1024 * 1024 * 1024
+
+// maxStringLength bounds string settings without a tighter limit.
+const maxStringLength = 4096
+
+// Definition describes one setting. Values are stored as strings: "true" or
+// "false", decimal integers, plain strings and JSON arrays.
+type Definition struct {
+	Key         string
+	Type        Type
+	Description string
+	// Default is the stored form of the value used while none is stored.
+	Default string
+	// Min and Max bound integer settings.
+	Min int64
+	Max int64
+	// MaxLength bounds string settings.
+	MaxLength int
+	// Options lists the values a string setting accepts; any string within
+	// MaxLength is accepted when it is empty.
+	Options []string
+	// Sensitive settings are encrypted at rest and left out of exports
+	// unless secrets are encrypted.
+	Sensitive bool
+	// Security settings weaken the client's protection when changed, so
+	// API tokens need the security:admin scope to change them.
+	Security bool
+	// Restart marks settings that the torrent client only reads when it is
+	// created, so that a change applies after a restart.
+	Restart bool
+	// ManagedBy names the endpoint that changes a setting. Such settings are
+	// exported and imported but not set one by one.
+	ManagedBy string
+	// Validate checks a value given to Set, SetString or Import beyond its
+	// type, such as the feeds of a feed list. Stored values are not
+	// checked, so that one a later version refuses can still be read.
+	Validate func(value string) error
+}
+
+func boolean(key string, def bool, description string) Definition {
+	return Definition{Key: key, Type: TypeBoolean, Default: strconv.FormatBool(def), Description: description}
+}
+
+func integer(key string, def, min, max int64, description string) Definition {
+	return Definition{Key: key, Type: TypeInteger, Default: strconv.FormatInt(def, 10), Min: min, Max: max, Description: description}
+}
+
+func text(key string, maxLength int, description string) Definition {
+	return Definition{Key: key, Type: TypeString, MaxLength: maxLength, Description: description}
+}
+
+func enum(key, def string, options []string, description string) Definition {
+	return Definition{Key: key, Type: TypeString, Default: def, Options: options, MaxLength: maxStringLength, Description: description}
+}
+
+func document(key, def, managedBy, description string) Definition {
+	return Definition{Key: key, Type: TypeJSON, Default: def, ManagedBy: managedBy, Description: description}
+}
+
+func (d Definition) sensitive() Definition {
+	d.Sensitive = true
+	return d
+}
+
+func (d Definition) security() Definition {
+	d.Security = true
+	return d
+}
+
+func (d Definition) restart() Definition {
+	d.Restart = true
+	return d
+}
+
+func (d Definition) validatedBy(validate func(string) error) Definition {
+	d.Validate = validate
+	return d
+}
+
+// registry holds every user setting. Settings under the system_ prefix
+// (keyring, duress, audit log) and per-torrent settings are kept by their
+// own packages and are not part of it.
+var registry = []Definition{
+	integer("max_download_rate", 0, 0, maxRateLimit/1024, "Legacy download rate limit in KB/s; 0 means unlimited."),
+	integer("max_upload_rate", 0, 0, maxRateLimit/1024, "Legacy upload rate limit in KB/s; 0 means unlimited."),
+	integer("max_connections", 50, 1, 1000, "Established connections per torrent.").restart(),
+	integer("listen_port", 42069, 1, 65535, "Port the torrent client listens on.").restart(),
+	boolean("enable_tor", false, "Legacy switch for routing torrent traffic through Tor.").restart(),
+	text("download_path", maxStringLength, "Directory completed downloads are saved to.").sensitive().restart(),
+	boolean("auto_stop_seeding", false, "Stop seeding torrents once they complete."),
+	integer("global_download_limit", 0, 0, maxRateLimit, "Download limit for all torrents in bytes per second; 0 means unlimited."),
+	integer("global_upload_limit", 0, 0, maxRateLimit, "Upload limit for all torrents in bytes per second; 0 means unlimited."),
+
+	boolean("auto_encrypt_downloads", false, "Encrypt completed torrents with the keyring and wipe the plaintext."),
+	enum("auto_encrypt_algorithm", "AES-256-GCM", []string{"AES-256-GCM", "ChaCha20-Poly1305"}, "Cipher used for automatic encryption."),
+	text("auto_encrypt_recipient", 64, "Base64 X25519 public key that completed torrents are encrypted to instead of a keyring key; empty uses the keyring.").validatedBy(validateRecipient),
+	boolean("auto_delete_on_shutdown", false, "Delete every torrent and its data on shutdown."),
+	boolean("auto_wipe_on_exit", false, "Securely wipe downloads and settings on shutdown.").security(),
+	integer("secure_delete_passes", security.DefaultWipePasses, 3, 35, "Overwrite passes used by secure deletion."),
+	integer("security_event_retention_days", int64(security.DefaultEventRetention.Hours()/24), 1, 365, "Days security events are kept."),
+	integer("security_event_max_count", security.DefaultEventCapacity, 1, 1000000, "Security events kept at most."),
+
+	boolean("kill_switch_enabled", true, "Stop torrents when the proxy chain fails.").security(),
+	enum("kill_switch_mode", string(security.KillSwitchSoft), []string{string(security.KillSwitchSoft), string(security.KillSwitchHard)}, "Pause torrents (soft) or remove them (hard) when the kill switch trips.").security(),
+	boolean("tor_enabled", false, "Route torrent traffic through the Tor proxy chain.").security().restart(),
+	enum("vpn_type", "none", []string{"none", "tor"}, "Connection the backend routes traffic through.").security(),
+	enum("encryption_mode", string(torrent.EncryptionPrefer), []string{string(torrent.EncryptionPrefer), string(torrent.EncryptionRequire), string(torrent.EncryptionDisabled)}, "Peer protocol encryption.").security(),
+	boolean("force_encryption", false, "Legacy mirror of encryption_mode: true when it is require.").security(),
+	boolean("reject_plaintext", false, "Legacy mirror of encryption_mode: true when it is require.").security(),
+	enum("encryption_level", "rc4-preferred", []string{"rc4-preferred", "rc4-required", "disabled"}, "Legacy mirror of encryption_mode as a level name.").security(),
+	enum("min_encryption_protocol", "none", []string{"none", "MSE/PE RC4"}, "Legacy mirror of encryption_mode: the weakest peer encryption accepted.").security(),
+	boolean("dns_protection_enabled", true, "Resolve names through the proxy chain only.").security(),
+	boolean("dns_obfuscation_enabled", false, "Hide DNS lookups behind the proxy chain.").security(),
+	boolean("ip_obfuscation_enabled", false, "Hide the client's address behind the proxy chain.").security(),
+	boolean("dht_invisibility", true, "Stay out of the DHT and peer exchange.").security(),
+	boolean("sharing_disabled", true, "Never upload torrent data.").security(),
+	boolean("data_encryption_enabled", true, "Encrypt sensitive fields at rest.").security(),
+	boolean("no_logs_mode", false, "Keep no history or metadata on disk.").security(),
+	boolean("obfuscate_traffic", false, "Obfuscate the peer protocol handshake.").security(),
+	boolean("mac_randomization", false, "Randomize the network interface's MAC address.").security(),
+	boolean("anti_fingerprint", false, "Hide the client's protocol fingerprint.").security(),
+	boolean("secure_delete", true, "Overwrite files before deleting them.").security(),
+	boolean("peer_verification", true, "Verify peers before exchanging data.").security(),
+	boolean("block_malicious_peers", true, "Refuse peers known to be malicious.").security(),
+	boolean("sandbox_mode", false, "Run file handling in a sandbox.").security(),
+	boolean("memory_encryption", true, "Keep keys encrypted in memory.").security(),
+	boolean("stealth_mode", false, "Minimize the client's network footprint.").security(),
+
+	document("rss_feeds", "[]", "/api/feeds", "RSS and Atom feeds with their filter rules.").sensitive().validatedBy(feeds.ValidateFeeds),
+	document("torznab_indexers", "[]", "/api/search/indexers", "Torznab indexers with their API keys.").sensitive().validatedBy(search.ValidateIndexers),
+}
+
+var byKey = func() map[string]Definition {
+	m := make(map[string]Definition, len(registry))
+	for _, d := range registry {
+		m[d.Key] = d
+	}
+	return m
+}()
+
+// Definitions returns every setting sorted by key.
+func Definitions() []Definition {
+	defs := append([]Definition{}, registry...)
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Key < defs[j].Key })
+	return defs
+}
+
+// Lookup returns the definition of key.
+func Lookup(key string) (Definition, bool) {
+	d, ok := byKey[key]
+	return d, ok
+}
+
+// Parse validates a value given as JSON and returns its stored form.
+// Booleans and integers may also be given as strings, such as "true" or
+// "200", which is what older clients send.
+func (d Definition) Parse(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if d.Type == TypeJSON {
+		var compact bytes.Buffer
+		if len(raw) == 0 || raw[0] != '[' || json.Compact(&compact, raw) != nil {
+			return "", d.invalid("must be a JSON array")
+		}
+		return compact.String(), nil
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		// Not a JSON string: keep the literal, such as true or 200.
+		if len(raw) == 0 || raw[0] == '{' || raw[0] == '[' || raw[0] == '"' || string(raw) == "null" {
+			return "", d.invalid("must be a %s", d.Type)
+		}
+		value = string(raw)
+	}
+	return d.ParseString(value)
+}
+
+// ParseString validates a value in its stored form and returns it in
+// canonical form.
+func (d Definition) ParseString(value string) (string, error) {
+	switch d.Type {
+	case TypeBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", d.invalid("must be true or false")
+		}
+		return strconv.FormatBool(b), nil
+	case TypeInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", d.invalid("must be an integer")
+		}
+		if n < d.Min || n > d.Max {
+			return "", d.invalid("must be between %d and %d", d.Min, d.Max)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case TypeString:
+		if len(d.Options) > 0 {
+			for _, option := range d.Options {
+				if value == option {
+					return value, nil
+				}
+			}
+			return "", d.invalid("must be one of %s", strings.Join(d.Options, ", "))
+		}
+		if len(value) > d.MaxLength {
+			return "", d.invalid("must be at most %d characters", d.MaxLength)
+		}
+		return value, nil
+	case TypeJSON:
+		return d.Parse(json.RawMessage(value))
+	}
+	return "", d.invalid("has an unknown type")
+}
+
+// validate runs the definition's Validate on a parsed value.
+func (d Definition) validate(stored string) error {
+	if d.Validate == nil {
+		return nil
+	}
+	if err := d.Validate(stored); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalid, d.Key, err)
+	}
+	return nil
+}
+
+// Value converts a stored value to its JSON value: a bool, an int64, a
+// string or a json.RawMessage.
+func (d Definition) Value(stored string) (interface{}, error) {
+	stored, err := d.ParseString(stored)
+	if err != nil {
+		return nil, err
+	}
+	switch d.Type {
+	case TypeBoolean:
+		return stored == "true", nil
+	case TypeInteger:
+		return strconv.ParseInt(stored, 10, 64)
+	case TypeJSON:
+		return json.RawMessage(stored), nil
+	}
+	return stored, nil
+}
+
+func validateRecipient(value string) error {
+	if value == "" {
+		return nil
+	}
+	_, err := security.ParseRecipientKey(value)
+	return err
+}
+
+func (d Definition) invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s %s", ErrInvalid, d.Key, fmt.Sprintf(format, args...))
+}
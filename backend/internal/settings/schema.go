@@ -0,0 +1,66 @@
+package settings
+
+// SchemaDocument is a JSON Schema (draft 2020-12) for an object holding
+// settings by key, such as the body of PATCH /settings/values.
+type SchemaDocument struct {
+	Schema               string              `json:"$schema"`
+	Title                string              `json:"title"`
+	Type                 string              `json:"type"`
+	Properties           map[string]Property `json:"properties"`
+	AdditionalProperties bool                `json:"additionalProperties"`
+}
+
+// Property describes one setting. The x- keywords carry what JSON Schema
+// has no word for.
+type Property struct {
+	Type        string      `json:"type,omitempty"`
+	Description string      `json:"description"`
+	Default     interface{} `json:"default"`
+	Minimum     *int64      `json:"minimum,omitempty"`
+	Maximum     *int64      `json:"maximum,omitempty"`
+	MaxLength   int         `json:"maxLength,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	// ReadOnly marks settings changed through their own endpoints.
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+	Sensitive bool   `json:"x-sensitive,omitempty"`
+	Security  bool   `json:"x-security,omitempty"`
+	Restart   bool   `json:"x-restart-required,omitempty"`
+	ManagedBy string `json:"x-managed-by,omitempty"`
+}
+
+// Schema describes every setting.
+func Schema() SchemaDocument {
+	doc := SchemaDocument{
+		Schema:     "https://json-schema.org/draft/2020-12/schema",
+		Title:      "B-2 Torrent settings",
+		Type:       "object",
+		Properties: make(map[string]Property, len(registry)),
+	}
+	for _, d := range registry {
+		p := Property{
+			Description: d.Description,
+			ReadOnly:    d.ManagedBy != "",
+			Sensitive:   d.Sensitive,
+			Security:    d.Security,
+			Restart:     d.Restart,
+			ManagedBy:   d.ManagedBy,
+		}
+		p.Default, _ = d.Value(d.Default)
+		switch d.Type {
+		case TypeInteger:
+			min, max := d.Min, d.Max
+			p.Type, p.Minimum, p.Maximum = string(d.Type), &min, &max
+		case TypeString:
+			p.Type, p.Enum = string(d.Type), d.Options
+			if len(d.Options) == 0 {
+				p.MaxLength = d.MaxLength
+			}
+		case TypeJSON:
+			p.Type = "array"
+		default:
+			p.Type = string(d.Type)
+		}
+		doc.Properties[d.Key] = p
+	}
+	return doc
+}
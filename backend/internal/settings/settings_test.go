@@ -0,0 +1,260 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+	"github.com/KFN002/B-2-Torrent/backend/internal/settings/settingstest"
+)
+
+func raw(values map[string]string) map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage, len(values))
+	for key, value := range values {
+		out[key] = json.RawMessage(value)
+	}
+	return out
+}
+
+func TestRegistryMatchesEncryptionPolicy(t *testing.T) {
+	for _, d := range Definitions() {
+		if d.Sensitive != security.IsSensitiveSetting(d.Key) {
+			t.Errorf("%s: Sensitive = %t, but the database encrypts it: %t", d.Key, d.Sensitive, security.IsSensitiveSetting(d.Key))
+		}
+		if strings.HasPrefix(d.Key, "system_") {
+			t.Errorf("%s: system settings survive a cleanup and are not user settings", d.Key)
+		}
+		if _, err := d.ParseString(d.Default); err != nil || d.validate(d.Default) != nil {
+			t.Errorf("%s: default %q is invalid: %v", d.Key, d.Default, err)
+		}
+	}
+}
+
+func TestStoreValidatesBeforeWriting(t *testing.T) {
+	db := &settingstest.Store{}
+	s := NewStore(db)
+
+	if s.Int("max_connections") != 50 || !s.Bool("dht_invisibility") || s.String("encryption_mode") != "prefer" {
+		t.Fatal("defaults were not returned")
+	}
+
+	for name, values := range map[string]map[string]string{
+		"not a number":  {"max_download_rate": `"abc"`},
+		"out of range":  {"listen_port": `70000`},
+		"not an option": {"encryption_mode": `"maybe"`},
+		"not a bool":    {"no_logs_mode": `"yes please"`},
+		"null":          {"no_logs_mode": `null`},
+		"managed":       {"rss_feeds": `[]`},
+		"unknown":       {"max_download_rate": `1`, "nonsense": `1`},
+	} {
+		if _, err := s.Set(raw(values), true); err == nil {
+			t.Errorf("%s: Set(%v) succeeded", name, values)
+		}
+	}
+	if len(db.Values) != 0 {
+		t.Fatalf("invalid values were stored: %v", db.Values)
+	}
+	if _, err := s.Set(raw(map[string]string{"rss_feeds": `[]`}), true); !errors.Is(err, ErrManaged) {
+		t.Errorf("managed err = %v", err)
+	}
+	if _, err := s.Set(raw(map[string]string{"max_download_rate": `1`, "kill_switch_enabled": `false`}), false); !errors.Is(err, ErrSecurity) || len(db.Values) != 0 {
+		t.Errorf("security err = %v, stored %v", err, db.Values)
+	}
+
+	// JSON values and the strings older clients send are both accepted.
+	keys, err := s.Set(raw(map[string]string{
+		"max_download_rate": `"200"`,
+		"max_connections":   `80`,
+		"no_logs_mode":      `true`,
+		"secure_delete":     `"false"`,
+		"kill_switch_mode":  `"hard"`,
+	}), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "kill_switch_mode,max_connections,max_download_rate,no_logs_mode,secure_delete" {
+		t.Errorf("keys = %v", keys)
+	}
+	if db.Values["max_download_rate"] != "200" || db.Values["secure_delete"] != "false" {
+		t.Errorf("stored = %v", db.Values)
+	}
+	if s.Int("max_connections") != 80 || !s.Bool("no_logs_mode") || s.Bool("secure_delete") || s.String("kill_switch_mode") != "hard" {
+		t.Error("typed getters disagree with stored values")
+	}
+
+	// Values stored by older versions that no longer validate read as the
+	// default.
+	db.Values["listen_port"] = "junk"
+	if s.Int("listen_port") != 42069 {
+		t.Errorf("listen_port = %d", s.Int("listen_port"))
+	}
+	if err := s.SetString("listen_port", "0"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("SetString err = %v", err)
+	}
+}
+
+func TestStoreWritesSensitiveSettingsFirst(t *testing.T) {
+	db := &settingstest.Store{Values: map[string]string{"download_path": "/data"}, Locked: true}
+	s := NewStore(db)
+
+	values, err := s.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(values.Locked, ",") != "download_path" || values.Values["no_logs_mode"] != false {
+		t.Fatalf("values = %+v", values)
+	}
+	if _, ok := values.Values["rss_feeds"]; ok {
+		t.Error("managed settings are listed")
+	}
+
+	_, err = s.Set(raw(map[string]string{"no_logs_mode": `true`, "download_path": `"/other"`}), true)
+	if !errors.Is(err, security.ErrKeyringLocked) || db.Values["no_logs_mode"] != "" {
+		t.Fatalf("Set = %v, stored %v", err, db.Values)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	source := &settingstest.Store{}
+	s := NewStore(source)
+	if _, err := s.Set(raw(map[string]string{"download_path": `"/data"`, "listen_port": `6881`, "auto_stop_seeding": `true`}), true); err != nil {
+		t.Fatal(err)
+	}
+	source.Values["torznab_indexers"] = `[{"id":"a","url":"https://example.com","apiKey":"secret"}]`
+
+	excluded, err := s.Export(SecretsExclude, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := excluded.Settings["download_path"]; ok || excluded.EncryptedSecrets != "" {
+		t.Fatalf("secrets were exported: %+v", excluded)
+	}
+	if string(excluded.Settings["listen_port"]) != "6881" || string(excluded.Settings["auto_stop_seeding"]) != "true" || string(excluded.Settings["vpn_type"]) != `"none"` {
+		t.Fatalf("settings = %v", excluded.Settings)
+	}
+
+	if _, err := ParseSecrets("include"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("ParseSecrets(include) err = %v, want plaintext secrets refused", err)
+	}
+
+	if _, err := s.Export(SecretsEncrypt, "short"); !errors.Is(err, security.ErrWeakExportPassphrase) {
+		t.Fatalf("weak passphrase err = %v", err)
+	}
+	encrypted, err := s.Export(SecretsEncrypt, "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(encrypted)
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "/data") {
+		t.Fatalf("encrypted export leaks secrets: %s", data)
+	}
+
+	target := &settingstest.Store{}
+	imported := NewStore(target)
+	if _, err := imported.Import(encrypted, "", true); !errors.Is(err, ErrInvalid) {
+		t.Errorf("import without passphrase err = %v", err)
+	}
+	if _, err := imported.Import(encrypted, "wrong horse battery", true); !errors.Is(err, security.ErrPassphraseRecord) {
+		t.Errorf("import with wrong passphrase err = %v", err)
+	}
+	plaintext := Export{Version: ExportVersion, Settings: raw(map[string]string{"download_path": `"/data"`})}
+	if _, err := imported.Import(plaintext, "", true); !errors.Is(err, ErrInvalid) {
+		t.Errorf("import of a plaintext secret err = %v", err)
+	}
+	if len(target.Values) != 0 {
+		t.Fatalf("failed imports stored %v", target.Values)
+	}
+
+	encrypted.Settings["kill_switch_enabled"] = json.RawMessage(`false`)
+	if _, err := imported.Import(encrypted, "correct horse battery", false); !errors.Is(err, ErrSecurity) || len(target.Values) != 0 {
+		t.Fatalf("import of security settings without the scope err = %v, stored %v", err, target.Values)
+	}
+	encrypted.Settings["kill_switch_enabled"] = json.RawMessage(`true`)
+
+	encrypted.Settings["from_a_newer_version"] = json.RawMessage(`1`)
+	// Security settings that match the stored ones need no scope.
+	result, err := imported.Import(encrypted, "correct horse battery", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Values["download_path"] != "/data" || target.Values["listen_port"] != "6881" || target.Values["torznab_indexers"] != source.Values["torznab_indexers"] {
+		t.Errorf("imported = %v", target.Values)
+	}
+	if strings.Join(result.Skipped, ",") != "from_a_newer_version" || len(result.Imported) != len(Definitions()) {
+		t.Errorf("result = %+v", result)
+	}
+	for _, key := range []string{"download_path", "listen_port", "tor_enabled"} {
+		if !strings.Contains(","+strings.Join(result.RestartRequired, ",")+",", ","+key+",") {
+			t.Errorf("%s is not reported as needing a restart: %v", key, result.RestartRequired)
+		}
+	}
+
+	excluded.Settings["listen_port"] = json.RawMessage(`"abc"`)
+	if _, err := imported.Import(excluded, "", true); !errors.Is(err, ErrInvalid) {
+		t.Errorf("invalid import err = %v", err)
+	}
+	if _, err := imported.Import(Export{Version: 2}, "", true); !errors.Is(err, ErrInvalid) {
+		t.Errorf("unknown version err = %v", err)
+	}
+}
+
+func TestImportValidatesDocuments(t *testing.T) {
+	source := &settingstest.Store{}
+	s := NewStore(source)
+	target := &settingstest.Store{}
+	imported := NewStore(target)
+
+	for name, values := range map[string]map[string]string{
+		"indexer url":   {"torznab_indexers": `[{"id":"a","url":"ftp://example.com"}]`},
+		"indexer id":    {"torznab_indexers": `[{"id":"a","url":"https://a.example"},{"id":"a","url":"https://b.example"}]`},
+		"indexer list":  {"torznab_indexers": `[1]`},
+		"feed pattern":  {"rss_feeds": `[{"id":"a","url":"https://example.com/rss","rules":[{"include":"("}]}]`},
+		"feed interval": {"rss_feeds": `[{"id":"a","url":"https://example.com/rss","intervalMinutes":1}]`},
+		"recipient":     {"auto_encrypt_recipient": `"not a key"`},
+	} {
+		source.Values = values
+		doc, err := s.Export(SecretsEncrypt, "correct horse battery")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := imported.Import(doc, "correct horse battery", true); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: import err = %v", name, err)
+		}
+	}
+	if len(target.Values) != 0 {
+		t.Fatalf("invalid documents were stored: %v", target.Values)
+	}
+
+	if err := imported.SetString("auto_encrypt_recipient", "junk"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("SetString err = %v", err)
+	}
+	public, _, err := security.GenerateRecipientKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := imported.SetString("auto_encrypt_recipient", public.String()); err != nil {
+		t.Errorf("SetString of a valid key: %v", err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+	if len(schema.Properties) != len(Definitions()) {
+		t.Fatalf("properties = %d", len(schema.Properties))
+	}
+	port := schema.Properties["listen_port"]
+	if port.Type != "integer" || *port.Minimum != 1 || *port.Maximum != 65535 || port.Default != int64(42069) || !port.Restart {
+		t.Errorf("listen_port = %+v", port)
+	}
+	if mode := schema.Properties["encryption_mode"]; mode.Type != "string" || len(mode.Enum) != 3 || mode.Default != "prefer" {
+		t.Errorf("encryption_mode = %+v", mode)
+	}
+	if feeds := schema.Properties["rss_feeds"]; feeds.Type != "array" || !feeds.ReadOnly || !feeds.Sensitive || feeds.ManagedBy != "/api/feeds" {
+		t.Errorf("rss_feeds = %+v", feeds)
+	}
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,41 @@
+// Package settingstest provides an in-memory settings table for the tests
+// of packages that store settings.
+package settingstest
+
+import (
+	"sync"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+)
+
+// Store stands in for the database's settings table. While Locked,
+// sensitive settings fail like they do with a locked keyring. Tests may
+// read and seed Values directly.
+type Store struct {
+	Values map[string]string
+	Locked bool
+
+	mu sync.Mutex
+}
+
+func (s *Store) GetSetting(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Locked && security.IsSensitiveSetting(key) && s.Values[key] != "" {
+		return "", security.ErrKeyringLocked
+	}
+	return s.Values[key], nil
+}
+
+func (s *Store) SetSetting(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Locked && security.IsSensitiveSetting(key) {
+		return security.ErrKeyringLocked
+	}
+	if s.Values == nil {
+		s.Values = make(map[string]string)
+	}
+	s.Values[key] = value
+	return nil
+}
@@ -0,0 +1,219 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/security"
+)
+
+type settingsStore interface {
+	GetSetting(key string) (string, error)
+	SetSetting(key, value string) error
+}
+
+// Store reads and writes registered settings through the settings table.
+type Store struct {
+	settings settingsStore
+}
+
+func NewStore(settings settingsStore) *Store {
+	return &Store{settings: settings}
+}
+
+// Values holds the current value of settings, and the sensitive ones that
+// could not be read because the keyring is locked.
+type Values struct {
+	Values map[string]interface{} `json:"values"`
+	Locked []string               `json:"locked,omitempty"`
+}
+
+// Get returns the value of key, or its default when none is stored or the
+// stored value is no longer valid.
+func (s *Store) Get(key string) (interface{}, error) {
+	d, ok := Lookup(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknown, key)
+	}
+	stored, err := s.stored(d)
+	if err != nil {
+		return nil, err
+	}
+	return d.Value(stored)
+}
+
+// Bool returns a boolean setting, or its default when it cannot be read.
+// Bool, Int and String suit settings that are not sensitive; sensitive ones
+// cannot be read while the keyring is locked, which only Get reports, as
+// security.ErrKeyringLocked.
+func (s *Store) Bool(key string) bool {
+	value, _ := s.get(key, TypeBoolean).(bool)
+	return value
+}
+
+// Int returns an integer setting, or its default when it cannot be read.
+func (s *Store) Int(key string) int64 {
+	value, _ := s.get(key, TypeInteger).(int64)
+	return value
+}
+
+// String returns a string setting, or its default when it cannot be read.
+func (s *Store) String(key string) string {
+	value, _ := s.get(key, TypeString).(string)
+	return value
+}
+
+func (s *Store) get(key string, t Type) interface{} {
+	d, ok := Lookup(key)
+	if !ok || d.Type != t {
+		return nil
+	}
+	value, err := s.Get(key)
+	if err != nil {
+		value, _ = d.Value(d.Default)
+	}
+	return value
+}
+
+// Values returns every setting that is not managed by its own endpoints.
+// Sensitive settings are listed as locked while the keyring is locked.
+func (s *Store) Values() (Values, error) {
+	values := Values{Values: make(map[string]interface{})}
+	for _, d := range registry {
+		if d.ManagedBy != "" {
+			continue
+		}
+		value, err := s.Get(d.Key)
+		if errors.Is(err, security.ErrKeyringLocked) {
+			values.Locked = append(values.Locked, d.Key)
+			continue
+		}
+		if err != nil {
+			return Values{}, err
+		}
+		values.Values[d.Key] = value
+	}
+	sort.Strings(values.Locked)
+	return values, nil
+}
+
+// Set validates every value before storing any of them and returns the keys
+// that were stored, sorted. Changes to security settings are refused with
+// ErrSecurity unless allowSecurity is set.
+func (s *Store) Set(values map[string]json.RawMessage, allowSecurity bool) ([]string, error) {
+	parsed, err := parse(values, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSecurity(parsed, allowSecurity); err != nil {
+		return nil, err
+	}
+	return s.write(parsed)
+}
+
+// SetString validates and stores a single value given in its stored form.
+func (s *Store) SetString(key, value string) error {
+	d, ok := Lookup(key)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknown, key)
+	}
+	if d.ManagedBy != "" {
+		return fmt.Errorf("%w: %s is changed through %s", ErrManaged, key, d.ManagedBy)
+	}
+	stored, err := d.ParseString(value)
+	if err != nil {
+		return err
+	}
+	if err := d.validate(stored); err != nil {
+		return err
+	}
+	return s.settings.SetSetting(key, stored)
+}
+
+// parse validates values and returns their stored form.
+func parse(values map[string]json.RawMessage, allowManaged bool) (map[string]string, error) {
+	parsed := make(map[string]string, len(values))
+	for key, raw := range values {
+		d, ok := Lookup(key)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknown, key)
+		}
+		if d.ManagedBy != "" && !allowManaged {
+			return nil, fmt.Errorf("%w: %s is changed through %s", ErrManaged, key, d.ManagedBy)
+		}
+		stored, err := d.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.validate(stored); err != nil {
+			return nil, err
+		}
+		parsed[key] = stored
+	}
+	return parsed, nil
+}
+
+// checkSecurity refuses parsed values that change a security setting unless
+// allowed. Values equal to the stored ones pass, so that a whole export can
+// be imported again.
+func (s *Store) checkSecurity(parsed map[string]string, allowed bool) error {
+	if allowed {
+		return nil
+	}
+	for key, value := range parsed {
+		d := byKey[key]
+		if !d.Security {
+			continue
+		}
+		stored, err := s.stored(d)
+		if err != nil {
+			return err
+		}
+		if stored != value {
+			return fmt.Errorf("%w: %s", ErrSecurity, key)
+		}
+	}
+	return nil
+}
+
+// write stores parsed values, sensitive ones first so that a locked keyring
+// fails the write before anything changed.
+func (s *Store) write(parsed map[string]string) ([]string, error) {
+	keys := make([]string, 0, len(parsed))
+	for key := range parsed {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		si, sj := byKey[keys[i]].Sensitive, byKey[keys[j]].Sensitive
+		if si != sj {
+			return si
+		}
+		return keys[i] < keys[j]
+	})
+	for i, key := range keys {
+		if err := s.settings.SetSetting(key, parsed[key]); err != nil {
+			stored := keys[:i]
+			sort.Strings(stored)
+			return stored, err
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// stored returns the stored value of d, or its default.
+func (s *Store) stored(d Definition) (string, error) {
+	value, err := s.settings.GetSetting(d.Key)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return d.Default, nil
+	}
+	if _, err := d.ParseString(value); err != nil {
+		return d.Default, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,153 @@
+// Package shutdown runs the server's teardown steps in a fixed order, each
+// under its own deadline, and reports which of them failed.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrSkipped marks a step that did not run because the overall deadline
+	// had already passed.
+	ErrSkipped = errors.New("skipped: shutdown deadline exceeded")
+	// ErrTimedOut marks a step that had not returned when its deadline
+	// passed. It is left running and the next step starts.
+	ErrTimedOut = errors.New("timed out")
+)
+
+// Step is one teardown action. Run should return promptly once ctx is done;
+// a step that does not, such as one blocked closing a client, is abandoned
+// at its deadline.
+type Step struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// StepResult is the outcome of one step.
+type StepResult struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Err      error         `json:"-"`
+}
+
+// Report lists every step in the order it was run or skipped.
+type Report struct {
+	Steps []StepResult
+}
+
+// Failed returns the results of the steps that returned an error or were
+// skipped.
+func (r Report) Failed() []StepResult {
+	var failed []StepResult
+	for _, step := range r.Steps {
+		if step.Err != nil {
+			failed = append(failed, step)
+		}
+	}
+	return failed
+}
+
+// Err summarizes every failure, or returns nil if all steps succeeded.
+func (r Report) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	messages := make([]string, len(failed))
+	for i, step := range failed {
+		messages[i] = fmt.Sprintf("%s: %v", step.Name, step.Err)
+	}
+	return fmt.Errorf("%d shutdown step(s) failed: %s", len(failed), strings.Join(messages, "; "))
+}
+
+// Manager holds the ordered teardown steps.
+type Manager struct {
+	steps    []Step
+	deadline time.Duration
+	logger   *zap.Logger
+}
+
+// NewManager returns a Manager whose steps must all finish within deadline.
+func NewManager(deadline time.Duration, logger *zap.Logger) *Manager {
+	return &Manager{
+		deadline: deadline,
+		logger:   logger,
+	}
+}
+
+// Add appends a step. A zero timeout leaves the step bounded only by the
+// overall deadline.
+func (m *Manager) Add(name string, timeout time.Duration, run func(ctx context.Context) error) {
+	m.steps = append(m.steps, Step{Name: name, Timeout: timeout, Run: run})
+}
+
+// Run executes every step in order. A failing step does not stop the steps
+// after it; once the overall deadline passes, the remaining steps are
+// reported as skipped.
+func (m *Manager) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, m.deadline)
+	defer cancel()
+
+	report := Report{Steps: make([]StepResult, 0, len(m.steps))}
+	for _, step := range m.steps {
+		result := StepResult{Name: step.Name}
+		if ctx.Err() != nil {
+			result.Err = ErrSkipped
+			m.logger.Error("Shutdown step skipped", zap.String("step", step.Name))
+		} else {
+			started := time.Now()
+			result.Err = m.runStep(ctx, step)
+			result.Duration = time.Since(started)
+		}
+		report.Steps = append(report.Steps, result)
+	}
+	return report
+}
+
+func (m *Manager) runStep(ctx context.Context, step Step) (err error) {
+	stepCtx := ctx
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	defer func() {
+		if err != nil {
+			m.logger.Error("Shutdown step failed",
+				zap.String("step", step.Name),
+				zap.Duration("duration", time.Since(started)),
+				zap.Error(err),
+			)
+			return
+		}
+		m.logger.Info("Shutdown step completed",
+			zap.String("step", step.Name),
+			zap.Duration("duration", time.Since(started)),
+		)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- fmt.Errorf("panic: %v", recovered)
+			}
+		}()
+		done <- step.Run(stepCtx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-stepCtx.Done():
+		return fmt.Errorf("%w: %w", ErrTimedOut, stepCtx.Err())
+	}
+}
@@ -0,0 +1,102 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRunKeepsOrderAndContinuesAfterFailure(t *testing.T) {
+	m := NewManager(time.Second, zap.NewNop())
+	var order []string
+	m.Add("first", 0, func(ctx context.Context) error {
+		order = append(order, "first")
+		return errors.New("boom")
+	})
+	m.Add("second", 0, func(ctx context.Context) error {
+		order = append(order, "second")
+		panic("bad step")
+	})
+	m.Add("third", 0, func(ctx context.Context) error {
+		order = append(order, "third")
+		return nil
+	})
+
+	report := m.Run(context.Background())
+	if len(order) != 3 || order[0] != "first" || order[1] != "second" || order[2] != "third" {
+		t.Fatalf("unexpected order: %v", order)
+	}
+	failed := report.Failed()
+	if len(failed) != 2 || failed[0].Name != "first" || failed[1].Name != "second" {
+		t.Fatalf("unexpected failures: %+v", failed)
+	}
+	if report.Err() == nil {
+		t.Fatal("expected a summary error")
+	}
+}
+
+func TestStepTimeoutAndOverallDeadline(t *testing.T) {
+	m := NewManager(50*time.Millisecond, zap.NewNop())
+	m.Add("bounded", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	m.Add("slow", 0, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	ran := false
+	m.Add("late", 0, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+
+	report := m.Run(context.Background())
+	if !errors.Is(report.Steps[0].Err, context.DeadlineExceeded) {
+		t.Fatalf("bounded step error = %v", report.Steps[0].Err)
+	}
+	if !errors.Is(report.Steps[1].Err, context.DeadlineExceeded) {
+		t.Fatalf("slow step error = %v", report.Steps[1].Err)
+	}
+	if ran || !errors.Is(report.Steps[2].Err, ErrSkipped) {
+		t.Fatalf("late step should be skipped, ran=%v err=%v", ran, report.Steps[2].Err)
+	}
+}
+
+func TestStepThatIgnoresItsContextIsAbandoned(t *testing.T) {
+	m := NewManager(time.Second, zap.NewNop())
+	release := make(chan struct{})
+	defer close(release)
+	m.Add("stuck", 10*time.Millisecond, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	ran := false
+	m.Add("next", 0, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+
+	started := time.Now()
+	report := m.Run(context.Background())
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Fatalf("Run took %v", elapsed)
+	}
+	if !errors.Is(report.Steps[0].Err, ErrTimedOut) || !errors.Is(report.Steps[0].Err, context.DeadlineExceeded) {
+		t.Fatalf("stuck step error = %v", report.Steps[0].Err)
+	}
+	if !ran || report.Steps[1].Err != nil {
+		t.Fatalf("next step ran=%v err=%v", ran, report.Steps[1].Err)
+	}
+}
+
+func TestRunWithoutFailures(t *testing.T) {
+	m := NewManager(time.Second, zap.NewNop())
+	m.Add("ok", 0, func(ctx context.Context) error { return nil })
+	if err := m.Run(context.Background()).Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
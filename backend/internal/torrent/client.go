@@ -2,6 +2,7 @@ package torrent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -9,10 +10,13 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/dht/v2/krpc"
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/iplist"
+	"github.com/anacrolix/torrent/storage"
 	"go.uber.org/zap"
 )
 
@@ -26,8 +30,38 @@ type Client struct {
 	torEnabled       bool // Add Tor toggle flag
 	torrentLimits    map[string]*TorrentLimits
 	globalLimits     *TorrentLimits
+	torControl       *TorController
+	stopBackground   context.CancelFunc
+	// networkSuspended gates every dialer installed by NewClient. It is set by
+	// the kill switch and cleared when the kill switch is reset.
+	networkSuspended *atomic.Bool
+	suspendedLimits  map[string]int
+	egress           *EgressGuard
+	clientConfig     *torrent.ClientConfig
+	encryptionMode   atomic.Value
+	rejectedPeers    atomic.Int64
+	completionHooks  []func(infoHash string)
+	fileStatus       map[string][]FileStatus
+	released         map[string]*releasedTorrent
+	// filePriorities holds the priorities set with SetFilePriority, by
+	// torrent and file index; files not listed download normally.
+	filePriorities map[string]map[int]string
+	paused         map[string]bool
+	placement      map[string]placement
+	// peerSwarms resolves stream isolation keys, see isolationKeyForAddr.
+	peerSwarms peerSwarmIndex
 }
 
+const defaultEstablishedConnsPerTorrent = 50
+
+// ErrNetworkSuspended is returned by dialers and AddMagnet while the kill
+// switch holds network activity suspended.
+var ErrNetworkSuspended = errors.New("network activity is suspended by the kill switch")
+
+// ErrUDPDisabled is returned for UDP tracker sockets while traffic goes
+// through Tor.
+var ErrUDPDisabled = errors.New("UDP is disabled while traffic goes through Tor")
+
 type ClientConfig struct {
 	ProxyChain       []string
 	DataDir          string
@@ -42,6 +76,10 @@ type ClientConfig struct {
 	DisableSharing   bool
 	DisableHistory   bool
 	DisableMetadata  bool
+	StreamIsolation  bool
+	// ConnectivityCanary is the host:port dialed through the whole chain to
+	// confirm it still carries traffic.
+	ConnectivityCanary string
 }
 
 type TorrentLimits struct {
@@ -49,6 +87,18 @@ type TorrentLimits struct {
 	UploadLimit   int
 }
 
+// Torrent states reported in TorrentInfo.Status.
+const (
+	StatusStarting    = "starting"
+	StatusDownloading = "downloading"
+	StatusPaused      = "paused"
+	StatusSuspended   = "suspended"
+	StatusCompleted   = "completed"
+)
+
+// Statuses lists every state a torrent can report.
+var Statuses = []string{StatusStarting, StatusDownloading, StatusPaused, StatusSuspended, StatusCompleted}
+
 type TorrentInfo struct {
 	ID            string  `json:"id"`
 	InfoHash      string  `json:"infoHash"`
@@ -68,8 +118,12 @@ type TorrentInfo struct {
 	ETA           int64   `json:"eta"`
 	Ratio         float64 `json:"ratio"`
 	Favorite      bool    `json:"favorite,omitempty"`
+	Category      string  `json:"category,omitempty"`
 	DownloadLimit int     `json:"downloadLimit,omitempty"`
 	UploadLimit   int     `json:"uploadLimit,omitempty"`
+	// Files reports post-completion processing, such as automatic
+	// encryption, once it has started for this torrent.
+	Files []FileStatus `json:"files,omitempty"`
 }
 
 type ProxyConnection struct {
@@ -83,6 +137,18 @@ type ProxyConnection struct {
 	Uptime    int     `json:"uptime"`
 }
 
+// TorControlStatus summarizes what the Tor control port reports.
+type TorControlStatus struct {
+	Configured       bool                `json:"configured"`
+	Address          string              `json:"address,omitempty"`
+	StreamIsolation  bool                `json:"streamIsolation"`
+	RotationInterval string              `json:"rotationInterval,omitempty"`
+	LastNewNym       *time.Time          `json:"lastNewNym,omitempty"`
+	Bootstrap        *TorBootstrapStatus `json:"bootstrap,omitempty"`
+	Circuits         []TorCircuit        `json:"circuits"`
+	Error            string              `json:"error,omitempty"`
+}
+
 type PrivacyStatus struct {
 	IPObfuscation              bool `json:"ipObfuscation"`
 	DNSObfuscation             bool `json:"dnsObfuscation"`
@@ -107,6 +173,18 @@ func NewClient(proxyChainStr string, downloadDir string) (*Client, error) {
 	dnsObfuscation := envBoolDefault("DNS_OBFUSCATION", false)
 	dhtInvisibility := envBoolDefault("DHT_INVISIBILITY", true) || noLogsMode
 	disableSharing := envBoolDefault("DISABLE_SHARING", true) || noLogsMode
+	streamIsolation := envBoolDefault("TOR_STREAM_ISOLATION", true)
+	encryptionMode, err := ParseEncryptionMode(os.Getenv("ENCRYPTION_MODE"))
+	if err != nil {
+		return nil, err
+	}
+	canary := strings.TrimSpace(os.Getenv("CONNECTIVITY_CANARY"))
+	if canary == "" {
+		canary = DefaultCanary
+	}
+	if _, _, err := net.SplitHostPort(canary); err != nil {
+		return nil, fmt.Errorf("invalid CONNECTIVITY_CANARY %q: %w", canary, err)
+	}
 
 	if noLogsMode {
 		logger.Info("No-logs mode enabled - minimal data persistence")
@@ -142,7 +220,6 @@ func NewClient(proxyChainStr string, downloadDir string) (*Client, error) {
 	)
 
 	var multiDialer *MultiProxyDialer
-	var err error
 
 	if torEnabled && len(proxyChain) > 0 {
 		multiDialer, err = NewMultiProxyDialer(proxyChain)
@@ -152,6 +229,10 @@ func NewClient(proxyChainStr string, downloadDir string) (*Client, error) {
 		}
 	}
 
+	suspended := new(atomic.Bool)
+	proxied := torEnabled && multiDialer != nil
+	egress := NewEgressGuard(proxied || ipObfuscation || dnsObfuscation, logger)
+
 	cfg := torrent.NewDefaultClientConfig()
 	cfg.DataDir = downloadDir
 	cfg.NoUpload = disableSharing
@@ -164,6 +245,7 @@ func NewClient(proxyChainStr string, downloadDir string) (*Client, error) {
 	cfg.DisableWebseeds = true
 	cfg.NoDefaultPortForwarding = true
 	cfg.DisableIPv6 = ipObfuscation
+	cfg.IPBlocklist = suspendedBlocklist{suspended: suspended}
 	cfg.DisableAggressiveUpload = true
 	if dhtInvisibility {
 		cfg.DHTOnQuery = func(query *krpc.Msg, source net.Addr) bool {
@@ -179,21 +261,55 @@ func NewClient(proxyChainStr string, downloadDir string) (*Client, error) {
 			}, nil
 		}
 
-		cfg.HTTPDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		cfg.HTTPDialContext = egress.Wrap(EgressCallerHTTP, EgressRouteProxy, suspendableDial(suspended, func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if streamIsolation {
+				ctx = WithIsolationKey(ctx, "http:"+addr)
+			}
 			return multiDialer.DialContext(ctx, network, addr)
-		}
-		cfg.TrackerDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		}))
+		cfg.TrackerDialContext = egress.Wrap(EgressCallerTracker, EgressRouteProxy, suspendableDial(suspended, func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if streamIsolation {
+				ctx = WithIsolationKey(ctx, "tracker:"+addr)
+			}
 			return multiDialer.DialContext(ctx, network, addr)
-		}
+		}))
 		cfg.DialForPeerConns = false
 		cfg.AcceptPeerConnections = false
-		if dnsObfuscation {
-			cfg.LookupTrackerIp = proxyTrackerLookup(multiDialer, logger)
-		}
-	} else if ipObfuscation {
+		// DHT and uTP speak UDP, which SOCKS5 through Tor cannot carry.
+		cfg.NoDHT = true
+		cfg.DisableUTP = true
+		// anacrolix resolves every tracker host before announcing, HTTP ones
+		// included. A direct lookup would be refused as a leak, so names are
+		// resolved through the chain whether or not DNS obfuscation is on.
+		cfg.LookupTrackerIp = proxyTrackerLookup(egress.Wrap(EgressCallerDNS, EgressRouteProxy, suspendableDial(suspended, multiDialer.DialContext)), logger)
+	} else {
+		direct := &net.Dialer{Timeout: 30 * time.Second}
+		cfg.HTTPDialContext = egress.Wrap(EgressCallerHTTP, EgressRouteDirect, suspendableDial(suspended, direct.DialContext))
+		cfg.TrackerDialContext = egress.Wrap(EgressCallerTracker, EgressRouteDirect, suspendableDial(suspended, direct.DialContext))
+		cfg.LookupTrackerIp = directTrackerLookup(egress)
+		// Peer connections are dialed through the guard rather than from the
+		// client's listen sockets so that every outbound peer is recorded.
 		cfg.DialForPeerConns = false
-		cfg.AcceptPeerConnections = false
-		logger.Warn("IP obfuscation requested without an available proxy chain; direct peer traffic is disabled")
+		if ipObfuscation {
+			cfg.AcceptPeerConnections = false
+			logger.Warn("IP obfuscation requested without an available proxy chain; direct peer traffic is disabled")
+		}
+	}
+	// UDP tracker sockets cannot be carried over SOCKS5, so they always count
+	// as direct egress. Under Tor UDP is off altogether: addSpec strips UDP
+	// trackers, so a socket asked for anyway is refused without counting as
+	// a leak.
+	cfg.TrackerListenPacket = func(network, addr string) (net.PacketConn, error) {
+		if proxied {
+			return nil, ErrUDPDisabled
+		}
+		if err := egress.Check(EgressCallerTrackerUDP, network, addr, EgressRouteDirect); err != nil {
+			return nil, err
+		}
+		if suspended.Load() {
+			return nil, ErrNetworkSuspended
+		}
+		return net.ListenPacket(network, addr)
 	}
 
 	if noLogsMode {
@@ -210,14 +326,61 @@ func NewClient(proxyChainStr string, downloadDir string) (*Client, error) {
 		cfg.DisableAggressiveUpload = true
 	}
 
-	if obfuscateTraffic {
-		// Modify protocol header to avoid DPI detection
-		cfg.HeaderObfuscationPolicy.Preferred = true
-		cfg.HeaderObfuscationPolicy.RequirePreferred = false
+	var torControl *TorController
+	if torEnabled {
+		if controlConfig, ok := TorControlConfigFromEnv(); ok {
+			torControl = NewTorController(controlConfig, logger)
+		}
+	}
+
+	// c is built before the anacrolix client, which starts accepting peers
+	// as soon as it exists, so that the crypto selector, the handshake gate
+	// on the peer dialers and the PeerConnAdded hook read the configured
+	// encryption mode from the first handshake; all three follow
+	// SetEncryptionMode, which never touches the client config.
+	c := &Client{
+		torrents:         make(map[string]*torrent.Torrent),
+		multiProxyDialer: multiDialer,
+		logger:           logger,
+		torEnabled:       torEnabled,
+		torrentLimits:    make(map[string]*TorrentLimits),
+		globalLimits:     &TorrentLimits{DownloadLimit: 0, UploadLimit: 0},
+		torControl:       torControl,
+		networkSuspended: suspended,
+		suspendedLimits:  make(map[string]int),
+		fileStatus:       make(map[string][]FileStatus),
+		released:         make(map[string]*releasedTorrent),
+		filePriorities:   make(map[string]map[int]string),
+		paused:           make(map[string]bool),
+		placement:        make(map[string]placement),
+		egress:           egress,
+		config: &ClientConfig{
+			ProxyChain:         proxyChain,
+			DataDir:            downloadDir,
+			EnableDHT:          false,
+			MaxRetries:         3,
+			TorEnabled:         torEnabled,
+			NoLogsMode:         noLogsMode,
+			ObfuscateTraffic:   obfuscateTraffic,
+			IPObfuscation:      ipObfuscation,
+			DNSObfuscation:     dnsObfuscation,
+			DHTInvisibility:    dhtInvisibility,
+			DisableSharing:     disableSharing,
+			DisableHistory:     noLogsMode,
+			DisableMetadata:    noLogsMode,
+			StreamIsolation:    streamIsolation && multiDialer != nil,
+			ConnectivityCanary: canary,
+		},
+	}
+	c.encryptionMode.Store(encryptionMode)
+	applyEncryptionPolicy(cfg, encryptionMode)
+	cfg.CryptoSelector = cryptoSelector(c.EncryptionMode)
+	cfg.Callbacks.PeerConnAdded = append(cfg.Callbacks.PeerConnAdded, c.enforceEncryption)
+	if obfuscateTraffic && encryptionMode != EncryptionDisabled {
 		logger.Info("Traffic obfuscation enabled - altering protocol fingerprints")
 	}
 
-	cfg.EstablishedConnsPerTorrent = 50
+	cfg.EstablishedConnsPerTorrent = defaultEstablishedConnsPerTorrent
 	cfg.HalfOpenConnsPerTorrent = 25
 	cfg.TorrentPeersHighWater = 100
 	cfg.TorrentPeersLowWater = 50
@@ -226,36 +389,207 @@ func NewClient(proxyChainStr string, downloadDir string) (*Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create torrent client: %w", err)
 	}
-	if torEnabled && multiDialer != nil {
-		client.AddDialer(proxyPeerDialer{network: "tcp", dialer: multiDialer})
+	if proxied {
+		client.AddDialer(peerDialer{
+			network: "tcp",
+			dial:    egress.Wrap(EgressCallerPeer, EgressRouteProxy, suspendableDial(suspended, c.gateHandshake(multiDialer.DialContext))),
+		})
+	} else if !ipObfuscation {
+		direct := &net.Dialer{Timeout: 30 * time.Second}
+		client.AddDialer(peerDialer{
+			network: "tcp",
+			dial:    egress.Wrap(EgressCallerPeer, EgressRouteDirect, suspendableDial(suspended, c.gateHandshake(direct.DialContext))),
+		})
 	}
 
+	c.client = client
+	c.clientConfig = cfg
 	logger.Info("Torrent client initialized successfully")
 
-	return &Client{
-		client:           client,
-		torrents:         make(map[string]*torrent.Torrent),
-		multiProxyDialer: multiDialer,
-		logger:           logger,
-		torEnabled:       torEnabled,
-		torrentLimits:    make(map[string]*TorrentLimits),
-		globalLimits:     &TorrentLimits{DownloadLimit: 0, UploadLimit: 0},
-		config: &ClientConfig{
-			ProxyChain:       proxyChain,
-			DataDir:          downloadDir,
-			EnableDHT:        false,
-			MaxRetries:       3,
-			TorEnabled:       torEnabled,
-			NoLogsMode:       noLogsMode,
-			ObfuscateTraffic: obfuscateTraffic,
-			IPObfuscation:    ipObfuscation,
-			DNSObfuscation:   dnsObfuscation,
-			DHTInvisibility:  dhtInvisibility,
-			DisableSharing:   disableSharing,
-			DisableHistory:   noLogsMode,
-			DisableMetadata:  noLogsMode,
-		},
-	}, nil
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	c.stopBackground = stopBackground
+
+	if multiDialer != nil && streamIsolation {
+		multiDialer.SetIsolationResolver(c.isolationKeyForAddr)
+	}
+	if torControl != nil {
+		go torControl.StartRotation(backgroundCtx)
+	}
+
+	return c, nil
+}
+
+// isolationKeyForAddr maps a peer address to the swarm that knows about it so
+// that each torrent's peer connections leave Tor through its own circuits.
+func (c *Client) isolationKeyForAddr(network, addr string) string {
+	if infoHash, ok := c.peerSwarms.lookup(addr, c.knownSwarms); ok {
+		return "torrent:" + infoHash
+	}
+	// Unknown destinations still get a circuit of their own rather than
+	// sharing one with any swarm.
+	return "peer:" + network + ":" + addr
+}
+
+// knownSwarms returns the peer addresses each torrent knows, by infohash.
+// Torrents still waiting for metadata are included; their peers are dialed
+// too.
+func (c *Client) knownSwarms() map[string][]string {
+	swarms := make(map[string][]string)
+	for _, t := range c.client.Torrents() {
+		swarms[t.InfoHash().String()] = swarmAddrs(t)
+	}
+	return swarms
+}
+
+func swarmAddrs(t *torrent.Torrent) []string {
+	var addrs []string
+	for _, peer := range t.KnownSwarm() {
+		if peer.Addr != nil {
+			addrs = append(addrs, peer.Addr.String())
+		}
+	}
+	return addrs
+}
+
+// peerSwarmRebuildInterval is the least time between two rebuilds of the
+// peer swarm index. Addresses it still misses in between get a circuit of
+// their own.
+const peerSwarmRebuildInterval = 5 * time.Second
+
+// peerSwarmIndex maps peer addresses to the torrent whose swarm holds them.
+// Trackers add peers inside anacrolix without telling the client, and no
+// callback reports them before they are dialed, so the index is rebuilt
+// from the swarms when a dial asks for an address it does not hold, at
+// most once per peerSwarmRebuildInterval and outside its lock so that dials
+// do not wait on each other. An address known to several swarms belongs to
+// the lowest infohash, so that it keeps one isolation key whatever order
+// they are read in.
+type peerSwarmIndex struct {
+	mu         sync.Mutex
+	swarms     map[string]string
+	rebuilt    time.Time
+	rebuilding bool
+	// now is time.Now unless a test replaces it.
+	now func() time.Time
+}
+
+func (idx *peerSwarmIndex) lookup(addr string, known func() map[string][]string) (string, bool) {
+	idx.mu.Lock()
+	if infoHash, ok := idx.swarms[addr]; ok {
+		idx.mu.Unlock()
+		return infoHash, true
+	}
+	now := time.Now
+	if idx.now != nil {
+		now = idx.now
+	}
+	if idx.rebuilding || now().Sub(idx.rebuilt) < peerSwarmRebuildInterval {
+		idx.mu.Unlock()
+		return "", false
+	}
+	idx.rebuilding = true
+	idx.mu.Unlock()
+
+	swarms := known()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.rebuilding = false
+	idx.rebuilt = now()
+	idx.rebuildLocked(swarms)
+	infoHash, ok := idx.swarms[addr]
+	return infoHash, ok
+}
+
+// add indexes the peers a torrent was added with.
+func (idx *peerSwarmIndex) add(infoHash string, addrs []string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.swarms == nil {
+		idx.swarms = make(map[string]string)
+	}
+	for _, addr := range addrs {
+		if current, ok := idx.swarms[addr]; !ok || infoHash < current {
+			idx.swarms[addr] = infoHash
+		}
+	}
+}
+
+func (idx *peerSwarmIndex) reset() {
+	idx.mu.Lock()
+	idx.swarms = nil
+	idx.rebuilt = time.Time{}
+	idx.mu.Unlock()
+}
+
+// forget drops the addresses of a removed torrent. Other swarms may know
+// them too, so the next miss rebuilds the index whenever it was last
+// rebuilt.
+func (idx *peerSwarmIndex) forget(infoHash string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for addr, owner := range idx.swarms {
+		if owner == infoHash {
+			delete(idx.swarms, addr)
+		}
+	}
+	idx.rebuilt = time.Time{}
+}
+
+func (idx *peerSwarmIndex) rebuildLocked(swarms map[string][]string) {
+	idx.swarms = make(map[string]string)
+	for infoHash, addrs := range swarms {
+		for _, addr := range addrs {
+			if current, ok := idx.swarms[addr]; !ok || infoHash < current {
+				idx.swarms[addr] = infoHash
+			}
+		}
+	}
+}
+
+// suspendedBlocklist refuses every peer address while the kill switch holds
+// network activity suspended. anacrolix consults it for accepted connections,
+// which no dialer sees, so a soft kill also refuses inbound peers when the
+// client listens directly.
+type suspendedBlocklist struct {
+	suspended *atomic.Bool
+}
+
+func (b suspendedBlocklist) Lookup(ip net.IP) (iplist.Range, bool) {
+	if !b.suspended.Load() {
+		return iplist.Range{}, false
+	}
+	return iplist.Range{First: ip, Last: ip, Description: "network activity is suspended by the kill switch"}, true
+}
+
+func (b suspendedBlocklist) NumRanges() int {
+	return 1
+}
+
+// suspendableDial refuses new connections while the kill switch has network
+// activity suspended.
+func suspendableDial(suspended *atomic.Bool, dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if suspended.Load() {
+			return nil, ErrNetworkSuspended
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// directTrackerLookup resolves tracker hosts with the system resolver after
+// checking that direct DNS is allowed.
+func directTrackerLookup(egress *EgressGuard) func(*url.URL) ([]net.IP, error) {
+	return func(trackerURL *url.URL) ([]net.IP, error) {
+		host := strings.TrimSpace(trackerURL.Hostname())
+		if ip := net.ParseIP(host); ip != nil {
+			return []net.IP{ip}, nil
+		}
+		if err := egress.Check(EgressCallerDNS, "udp", host, EgressRouteDirect); err != nil {
+			return nil, err
+		}
+		return net.LookupIP(host)
+	}
 }
 
 func envBoolDefault(key string, fallback bool) bool {
@@ -271,7 +605,7 @@ func envBoolDefault(key string, fallback bool) bool {
 	}
 }
 
-func proxyTrackerLookup(dialer *MultiProxyDialer, logger *zap.Logger) func(*url.URL) ([]net.IP, error) {
+func proxyTrackerLookup(dial func(context.Context, string, string) (net.Conn, error), logger *zap.Logger) func(*url.URL) ([]net.IP, error) {
 	resolverAddress := strings.TrimSpace(os.Getenv("DNS_OBFUSCATION_RESOLVER"))
 	if resolverAddress == "" {
 		resolverAddress = "1.1.1.1:53"
@@ -281,7 +615,7 @@ func proxyTrackerLookup(dialer *MultiProxyDialer, logger *zap.Logger) func(*url.
 		PreferGo: true,
 		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
 			logger.Debug("Resolving tracker DNS through proxy chain", zap.String("resolver", resolverAddress))
-			return dialer.DialContext(ctx, "tcp", resolverAddress)
+			return dial(WithIsolationKey(ctx, "dns"), "tcp", resolverAddress)
 		},
 	}
 
@@ -319,13 +653,35 @@ func proxyTrackerLookup(dialer *MultiProxyDialer, logger *zap.Logger) func(*url.
 }
 
 func (c *Client) AddMagnet(magnetURI string) (string, error) {
+	return c.AddMagnetWithOptions(magnetURI, AddOptions{})
+}
+
+// AddMagnetWithOptions adds a magnet link with a category and save path.
+func (c *Client) AddMagnetWithOptions(magnetURI string, opts AddOptions) (string, error) {
+	return c.AddMagnetContext(context.Background(), magnetURI, opts)
+}
+
+// AddMagnetContext is AddMagnetWithOptions, except that it stops waiting
+// for metadata and drops the torrent once ctx is done.
+func (c *Client) AddMagnetContext(ctx context.Context, magnetURI string, opts AddOptions) (string, error) {
 	if err := c.ValidateMagnetURI(magnetURI); err != nil {
 		return "", err
 	}
+	dataDir, err := c.resolveSavePath(opts.SavePath)
+	if err != nil {
+		return "", err
+	}
+	if c.IsNetworkSuspended() {
+		return "", ErrNetworkSuspended
+	}
 
 	c.logger.Info("Adding magnet link")
 
-	t, err := c.client.AddMagnet(magnetURI)
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnetURI)
+	if err != nil {
+		return "", fmt.Errorf("failed to add magnet: %w", err)
+	}
+	t, err := c.addSpec(spec, dataDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to add magnet: %w", err)
 	}
@@ -333,23 +689,110 @@ func (c *Client) AddMagnet(magnetURI string) (string, error) {
 	select {
 	case <-t.GotInfo():
 		c.logger.Info("Torrent metadata received", zap.String("name", t.Name()))
+	case <-ctx.Done():
+		t.Drop()
+		return "", ctx.Err()
 	case <-time.After(60 * time.Second):
 		t.Drop()
 		c.logger.Error("Timeout waiting for torrent metadata")
 		return "", fmt.Errorf("timeout waiting for torrent metadata")
 	}
 
+	return c.track(t, opts.Category, dataDir), nil
+}
+
+// AddTorrentFile adds a torrent from the contents of a .torrent file. The
+// metadata is already known, so unlike AddMagnet it does not wait for peers.
+func (c *Client) AddTorrentFile(data []byte) (string, error) {
+	return c.AddTorrentFileWithOptions(data, AddOptions{})
+}
+
+// AddTorrentFileWithOptions adds a .torrent file with a category and save
+// path.
+func (c *Client) AddTorrentFileWithOptions(data []byte, opts AddOptions) (string, error) {
+	mi, err := ValidateTorrentFile(data, c.validationPolicy())
+	if err != nil {
+		return "", err
+	}
+	dataDir, err := c.resolveSavePath(opts.SavePath)
+	if err != nil {
+		return "", err
+	}
+	if c.IsNetworkSuspended() {
+		return "", ErrNetworkSuspended
+	}
+
+	c.logger.Info("Adding torrent file")
+
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+	if err != nil {
+		return "", fmt.Errorf("failed to add torrent file: %w", err)
+	}
+	t, err := c.addSpec(spec, dataDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to add torrent file: %w", err)
+	}
+	<-t.GotInfo()
+
+	return c.track(t, opts.Category, dataDir), nil
+}
+
+// addSpec adds a torrent, storing its data under dataDir when that is not
+// the download directory.
+func (c *Client) addSpec(spec *torrent.TorrentSpec, dataDir string) (*torrent.Torrent, error) {
+	if dataDir != c.config.DataDir {
+		spec.Storage = storage.NewFileOpts(storage.NewFileClientOpts{ClientBaseDir: dataDir})
+	}
+	if c.udpDisabled() {
+		spec.Trackers = withoutUDPTrackers(spec.Trackers)
+	}
+	t, _, err := c.client.AddTorrentSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	c.peerSwarms.add(t.InfoHash().String(), swarmAddrs(t))
+	return t, nil
+}
+
+// udpDisabled reports whether traffic goes through Tor, which carries no
+// UDP.
+func (c *Client) udpDisabled() bool {
+	return c.torEnabled && c.multiProxyDialer != nil
+}
+
+// withoutUDPTrackers drops udp:// announce URLs, and tiers left empty.
+func withoutUDPTrackers(tiers [][]string) [][]string {
+	var kept [][]string
+	for _, tier := range tiers {
+		var urls []string
+		for _, tracker := range tier {
+			if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(tracker)), "udp:") {
+				urls = append(urls, tracker)
+			}
+		}
+		if len(urls) > 0 {
+			kept = append(kept, urls)
+		}
+	}
+	return kept
+}
+
+// track registers a torrent whose metadata is known and starts downloading
+// it.
+func (c *Client) track(t *torrent.Torrent, category, dataDir string) string {
 	infoHash := t.InfoHash().String()
 	c.mu.Lock()
 	c.torrents[infoHash] = t
+	c.placement[infoHash] = placement{category: category, dataDir: dataDir}
 	disableSharing := c.config.DisableSharing
+	c.applyFilePriorities(infoHash, t)
 	c.mu.Unlock()
 
 	if disableSharing {
 		t.DisallowDataUpload()
 	}
 
-	t.DownloadAll()
+	go c.watchCompletion(infoHash, t)
 
 	c.logger.Info("Torrent added successfully",
 		zap.String("infoHash", infoHash),
@@ -357,7 +800,7 @@ func (c *Client) AddMagnet(magnetURI string) (string, error) {
 		zap.Int64("size", t.Length()),
 	)
 
-	return infoHash, nil
+	return infoHash
 }
 
 func (c *Client) GetTorrent(infoHash string) (*TorrentInfo, error) {
@@ -365,6 +808,9 @@ func (c *Client) GetTorrent(infoHash string) (*TorrentInfo, error) {
 	t, ok := c.torrents[infoHash]
 	if !ok {
 		c.mu.RUnlock()
+		if info, ok := c.releasedInfo(infoHash); ok {
+			return info, nil
+		}
 		return nil, fmt.Errorf("torrent not found: %s", infoHash)
 	}
 	limits := c.torrentLimits[infoHash]
@@ -380,11 +826,15 @@ func (c *Client) torrentInfo(infoHash string, t *torrent.Torrent, limits *Torren
 		progress = float64(t.BytesCompleted()) / float64(t.Length()) * 100
 	}
 
-	status := "downloading"
+	status := StatusDownloading
 	if progress >= 100 {
-		status = "completed"
+		status = StatusCompleted
+	} else if c.IsNetworkSuspended() {
+		status = StatusSuspended
+	} else if c.isPaused(infoHash) {
+		status = StatusPaused
 	} else if t.BytesCompleted() == 0 {
-		status = "starting"
+		status = StatusStarting
 	}
 
 	eta := int64(0)
@@ -398,6 +848,10 @@ func (c *Client) torrentInfo(infoHash string, t *torrent.Torrent, limits *Torren
 		ratio = float64(stats.BytesWrittenData.Int64()) / float64(t.BytesCompleted())
 	}
 
+	c.mu.RLock()
+	category := c.category(infoHash)
+	c.mu.RUnlock()
+
 	downloadLimit := 0
 	uploadLimit := 0
 	if limits != nil {
@@ -423,8 +877,10 @@ func (c *Client) torrentInfo(infoHash string, t *torrent.Torrent, limits *Torren
 		Seeders:       stats.ConnectedSeeders,
 		ETA:           eta,
 		Ratio:         ratio,
+		Category:      category,
 		DownloadLimit: downloadLimit,
 		UploadLimit:   uploadLimit,
+		Files:         c.fileStatuses(infoHash),
 	}
 }
 
@@ -440,12 +896,21 @@ func (c *Client) GetAllTorrents() []*TorrentInfo {
 			limits *TorrentLimits
 		}{t: t, limits: c.torrentLimits[infoHash]}
 	}
+	released := make([]string, 0, len(c.released))
+	for infoHash := range c.released {
+		released = append(released, infoHash)
+	}
 	c.mu.RUnlock()
 
 	var infos []*TorrentInfo
 	for infoHash, item := range snapshot {
 		infos = append(infos, c.torrentInfo(infoHash, item.t, item.limits))
 	}
+	for _, infoHash := range released {
+		if info, ok := c.releasedInfo(infoHash); ok {
+			infos = append(infos, info)
+		}
+	}
 	return infos
 }
 
@@ -455,6 +920,12 @@ func (c *Client) RemoveTorrent(infoHash string) error {
 
 	t, ok := c.torrents[infoHash]
 	if !ok {
+		if _, released := c.released[infoHash]; released {
+			delete(c.released, infoHash)
+			delete(c.fileStatus, infoHash)
+			delete(c.placement, infoHash)
+			return nil
+		}
 		return fmt.Errorf("torrent not found: %s", infoHash)
 	}
 
@@ -462,10 +933,87 @@ func (c *Client) RemoveTorrent(infoHash string) error {
 
 	t.Drop()
 	delete(c.torrents, infoHash)
+	delete(c.fileStatus, infoHash)
 	delete(c.torrentLimits, infoHash) // Remove limits for this torrent
+	delete(c.suspendedLimits, infoHash)
+	delete(c.filePriorities, infoHash)
+	delete(c.paused, infoHash)
+	delete(c.placement, infoHash)
+	c.peerSwarms.forget(infoHash)
 	return nil
 }
 
+// RemoveAllTorrents drops every torrent and returns how many were removed.
+func (c *Client) RemoveAllTorrents() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := len(c.torrents) + len(c.released)
+	for _, t := range c.torrents {
+		t.Drop()
+	}
+	c.torrents = make(map[string]*torrent.Torrent)
+	c.fileStatus = make(map[string][]FileStatus)
+	c.released = make(map[string]*releasedTorrent)
+	c.torrentLimits = make(map[string]*TorrentLimits)
+	c.suspendedLimits = make(map[string]int)
+	c.filePriorities = make(map[string]map[int]string)
+	c.paused = make(map[string]bool)
+	c.placement = make(map[string]placement)
+	c.peerSwarms.reset()
+
+	c.logger.Info("Removed all torrents", zap.Int("count", removed))
+	return removed
+}
+
+// SuspendNetwork blocks new connections, drops established peer connections
+// and stops data transfer while keeping every torrent for a later resume.
+func (c *Client) SuspendNetwork() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.networkSuspended.Swap(true) {
+		return
+	}
+	for infoHash, t := range c.torrents {
+		t.DisallowDataDownload()
+		t.DisallowDataUpload()
+		c.suspendedLimits[infoHash] = t.SetMaxEstablishedConns(0)
+	}
+
+	c.logger.Warn("Network activity suspended", zap.Int("torrents", len(c.torrents)))
+}
+
+// ResumeNetwork restores the connection limits and transfer state that were
+// in effect before SuspendNetwork.
+func (c *Client) ResumeNetwork() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.networkSuspended.Load() {
+		return
+	}
+	for infoHash, t := range c.torrents {
+		limit, ok := c.suspendedLimits[infoHash]
+		if !ok || limit <= 0 {
+			limit = defaultEstablishedConnsPerTorrent
+		}
+		t.SetMaxEstablishedConns(limit)
+		t.AllowDataDownload()
+		if !c.config.DisableSharing {
+			t.AllowDataUpload()
+		}
+	}
+	c.suspendedLimits = make(map[string]int)
+	c.networkSuspended.Store(false)
+
+	c.logger.Info("Network activity resumed", zap.Int("torrents", len(c.torrents)))
+}
+
+func (c *Client) IsNetworkSuspended() bool {
+	return c.networkSuspended.Load()
+}
+
 func (c *Client) PauseTorrent(infoHash string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -476,6 +1024,10 @@ func (c *Client) PauseTorrent(infoHash string) error {
 	}
 
 	t.CancelPieces(0, t.NumPieces())
+	for _, f := range t.Files() {
+		f.SetPriority(torrent.PiecePriorityNone)
+	}
+	c.paused[infoHash] = true
 	return nil
 }
 
@@ -488,7 +1040,8 @@ func (c *Client) ResumeTorrent(infoHash string) error {
 		return fmt.Errorf("torrent not found: %s", infoHash)
 	}
 
-	t.DownloadAll()
+	delete(c.paused, infoHash)
+	c.applyFilePriorities(infoHash, t)
 	return nil
 }
 
@@ -498,6 +1051,13 @@ func (c *Client) Close() error {
 
 	c.logger.Info("Closing torrent client", zap.Int("activeTorrents", len(c.torrents)))
 
+	if c.stopBackground != nil {
+		c.stopBackground()
+	}
+	if c.torControl != nil {
+		_ = c.torControl.Close()
+	}
+
 	for _, t := range c.torrents {
 		t.Drop()
 	}
@@ -525,10 +1085,43 @@ func (c *Client) GetTorStatus() (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	err := c.multiProxyDialer.TestProxyChain(ctx)
+	err := c.CheckProxyChain(ctx)
 	return err == nil, err
 }
 
+// ObserveProxyDials reports every dial through the proxy chain to fn.
+func (c *Client) ObserveProxyDials(fn DialObserver) {
+	if c.multiProxyDialer != nil {
+		c.multiProxyDialer.SetDialObserver(fn)
+	}
+}
+
+// TransferStats reports the payload bytes received and sent since start.
+func (c *Client) TransferStats() (downloaded, uploaded int64) {
+	stats := c.client.Stats()
+	return stats.BytesReadData.Int64(), stats.BytesWrittenData.Int64()
+}
+
+// CheckProxyChain dials the configured canary through the whole proxy chain.
+func (c *Client) CheckProxyChain(ctx context.Context) error {
+	if c.multiProxyDialer == nil {
+		return fmt.Errorf("no proxy chain configured")
+	}
+	c.mu.RLock()
+	canary := c.config.ConnectivityCanary
+	c.mu.RUnlock()
+	return c.multiProxyDialer.TestProxyChain(ctx, canary)
+}
+
+// TorExit reports the address traffic leaves the proxy chain from, as seen
+// by checkURL.
+func (c *Client) TorExit(ctx context.Context, checkURL string) (ExitInfo, error) {
+	if c.multiProxyDialer == nil {
+		return ExitInfo{}, fmt.Errorf("no proxy chain configured")
+	}
+	return c.multiProxyDialer.ExitIP(ctx, checkURL)
+}
+
 func (c *Client) GetProxyConnections() []ProxyConnection {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -559,6 +1152,99 @@ func (c *Client) GetProxyConnections() []ProxyConnection {
 	return connections
 }
 
+// GetTorConnections returns the configured proxies followed by the circuits
+// reported by the Tor control port, when one is configured.
+func (c *Client) GetTorConnections(ctx context.Context) []ProxyConnection {
+	connections := c.GetProxyConnections()
+	if c.torControl == nil {
+		return connections
+	}
+
+	circuits, err := c.torControl.Circuits(ctx)
+	if err != nil {
+		c.logger.Warn("Failed to read Tor circuit status", zap.Error(err))
+		return connections
+	}
+
+	for _, circuit := range circuits {
+		if circuit.Purpose != "" && circuit.Purpose != "GENERAL" {
+			continue
+		}
+		address := "unknown"
+		if len(circuit.Path) > 0 {
+			exit := circuit.Path[len(circuit.Path)-1]
+			address = exit.Nickname
+			if address == "" {
+				address = exit.Fingerprint
+			}
+		}
+		connections = append(connections, ProxyConnection{
+			ID:      "circuit-" + circuit.ID,
+			Address: address,
+			Country: "unknown",
+			Status:  circuitConnectionStatus(circuit.Status),
+		})
+	}
+	return connections
+}
+
+func circuitConnectionStatus(status string) string {
+	switch status {
+	case "BUILT":
+		return "connected"
+	case "LAUNCHED", "EXTENDED", "GUARD_WAIT":
+		return "connecting"
+	default:
+		return "disconnected"
+	}
+}
+
+// TorControlStatus reports bootstrap progress, circuits and isolation state.
+func (c *Client) TorControlStatus(ctx context.Context) TorControlStatus {
+	c.mu.RLock()
+	status := TorControlStatus{
+		StreamIsolation: c.config.StreamIsolation,
+		Circuits:        []TorCircuit{},
+	}
+	c.mu.RUnlock()
+
+	if c.torControl == nil {
+		return status
+	}
+
+	status.Configured = true
+	status.Address = c.torControl.Address()
+	if interval := c.torControl.RotationInterval(); interval > 0 {
+		status.RotationInterval = interval.String()
+	}
+	if last := c.torControl.LastNewNym(); !last.IsZero() {
+		status.LastNewNym = &last
+	}
+
+	bootstrap, err := c.torControl.BootstrapStatus(ctx)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Bootstrap = &bootstrap
+
+	circuits, err := c.torControl.Circuits(ctx)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Circuits = circuits
+	return status
+}
+
+// RotateTorCircuits sends NEWNYM so new streams use fresh circuits.
+func (c *Client) RotateTorCircuits(ctx context.Context) error {
+	if c.torControl == nil {
+		return fmt.Errorf("tor control port is not configured")
+	}
+	return c.torControl.NewNym(ctx)
+}
+
 func (c *Client) SetTorEnabled(enabled bool) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -583,6 +1269,13 @@ func (c *Client) IsTorConnected() bool {
 	return err == nil && connected
 }
 
+// NoLogsMode reports whether no-logs mode is on.
+func (c *Client) NoLogsMode() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config.NoLogsMode
+}
+
 func (c *Client) SetNoLogsMode(enabled bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -610,6 +1303,7 @@ func (c *Client) SetIPObfuscation(enabled bool) bool {
 		enabled = false
 	}
 	c.config.IPObfuscation = enabled
+	c.refreshEgressPolicyLocked()
 	return enabled
 }
 
@@ -621,9 +1315,19 @@ func (c *Client) SetDNSObfuscation(enabled bool) bool {
 		enabled = false
 	}
 	c.config.DNSObfuscation = enabled
+	c.refreshEgressPolicyLocked()
 	return enabled
 }
 
+func (c *Client) refreshEgressPolicyLocked() {
+	c.egress.SetRequireProxy(c.udpDisabled() || c.config.IPObfuscation || c.config.DNSObfuscation)
+}
+
+// EgressGuard returns the guard every outbound connection passes through.
+func (c *Client) EgressGuard() *EgressGuard {
+	return c.egress
+}
+
 func (c *Client) SetDHTInvisibility(enabled bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -641,13 +1345,16 @@ func (c *Client) SetSharingDisabled(enabled bool) {
 }
 
 func (c *Client) ValidateMagnetURI(magnetURI string) error {
+	return ValidateMagnetURIWithPolicy(magnetURI, c.validationPolicy())
+}
+
+func (c *Client) validationPolicy() MagnetValidationPolicy {
 	c.mu.RLock()
-	policy := MagnetValidationPolicy{
+	defer c.mu.RUnlock()
+	return MagnetValidationPolicy{
 		TorEnabled:       c.torEnabled,
 		AllowUDPTrackers: !(c.config.IPObfuscation || c.config.DNSObfuscation),
 	}
-	c.mu.RUnlock()
-	return ValidateMagnetURIWithPolicy(magnetURI, policy)
 }
 
 func (c *Client) PrivacyStatus() PrivacyStatus {
@@ -662,7 +1369,7 @@ func (c *Client) PrivacyStatus() PrivacyStatus {
 		PeerExchangeDisabled:       c.config.DHTInvisibility,
 		InboundConnectionsDisabled: c.config.IPObfuscation || proxyAvailable,
 		DirectPeerDialingDisabled:  c.config.IPObfuscation && !proxyAvailable,
-		UDPTrackersBlocked:         c.config.IPObfuscation || c.config.DNSObfuscation,
+		UDPTrackersBlocked:         c.config.IPObfuscation || c.config.DNSObfuscation || c.udpDisabled(),
 		ProxyRequired:              c.config.IPObfuscation || c.config.DNSObfuscation,
 		ProxyAvailable:             proxyAvailable,
 		NoLogsMode:                 c.config.NoLogsMode,
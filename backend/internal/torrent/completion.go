@@ -0,0 +1,217 @@
+package torrent
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+	"go.uber.org/zap"
+)
+
+// Per-file post-processing states reported in TorrentInfo.Files.
+const (
+	FileStatusPending    = "pending"
+	FileStatusEncrypting = "encrypting"
+	FileStatusVerifying  = "verifying"
+	FileStatusWiping     = "wiping"
+	FileStatusEncrypted  = "encrypted"
+	FileStatusFailed     = "failed"
+)
+
+// StatusReleased marks a torrent whose data was handed off after completion
+// and is no longer held by the torrent client.
+const StatusReleased = "released"
+
+// FileStatus reports what post-completion processing did to one file.
+type FileStatus struct {
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	Status        string `json:"status"`
+	EncryptedPath string `json:"encryptedPath,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// CompletedFile is one fully downloaded file of a torrent.
+type CompletedFile struct {
+	Path string
+	Size int64
+}
+
+// releasedTorrent keeps what is still reported about a torrent after
+// ReleaseTorrent dropped it from the client.
+type releasedTorrent struct {
+	info  TorrentInfo
+	files []CompletedFile
+}
+
+// OnComplete registers fn to run, on its own goroutine, once every piece of
+// a torrent added afterwards has been downloaded and verified.
+func (c *Client) OnComplete(fn func(infoHash string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.completionHooks = append(c.completionHooks, fn)
+}
+
+func (c *Client) watchCompletion(infoHash string, t *torrent.Torrent) {
+	select {
+	case <-t.Complete().On():
+	case <-t.Closed():
+		return
+	}
+
+	c.mu.RLock()
+	hooks := append([]func(string){}, c.completionHooks...)
+	c.mu.RUnlock()
+
+	c.logger.Info("Torrent download complete", zap.String("infoHash", infoHash))
+	for _, hook := range hooks {
+		hook(infoHash)
+	}
+}
+
+// CompletedFiles lists the on-disk files of a completed torrent, including
+// one that has already been released.
+func (c *Client) CompletedFiles(infoHash string) ([]CompletedFile, error) {
+	c.mu.RLock()
+	t, ok := c.torrents[infoHash]
+	released := c.released[infoHash]
+	dataDir := c.dataDir(infoHash)
+	c.mu.RUnlock()
+
+	if !ok {
+		if released == nil {
+			return nil, fmt.Errorf("torrent not found: %s", infoHash)
+		}
+		return append([]CompletedFile(nil), released.files...), nil
+	}
+	if !t.Complete().Bool() {
+		return nil, fmt.Errorf("torrent is not complete: %s", infoHash)
+	}
+
+	files := make([]CompletedFile, 0, len(t.Files()))
+	for _, f := range t.Files() {
+		files = append(files, CompletedFile{
+			Path: filepath.Join(dataDir, filepath.FromSlash(f.Path())),
+			Size: f.Length(),
+		})
+	}
+	return files, nil
+}
+
+// DataPaths returns the top-level files and directories a torrent stores
+// under its save path, whether or not it has completed.
+func (c *Client) DataPaths(infoHash string) ([]string, error) {
+	c.mu.RLock()
+	t, ok := c.torrents[infoHash]
+	released := c.released[infoHash]
+	dataDir := c.dataDir(infoHash)
+	c.mu.RUnlock()
+
+	var relPaths []string
+	switch {
+	case ok:
+		for _, f := range t.Files() {
+			relPaths = append(relPaths, filepath.FromSlash(f.Path()))
+		}
+	case released != nil:
+		for _, f := range released.files {
+			if rel, err := filepath.Rel(dataDir, f.Path); err == nil {
+				relPaths = append(relPaths, rel)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("torrent not found: %s", infoHash)
+	}
+
+	seen := make(map[string]bool)
+	paths := make([]string, 0, 1)
+	for _, rel := range relPaths {
+		top := strings.SplitN(rel, string(filepath.Separator), 2)[0]
+		if top == "" || top == "." || top == ".." {
+			continue
+		}
+		path := filepath.Join(dataDir, top)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// SetFileStatus records the post-processing state of one file, replacing
+// any earlier status for the same path.
+func (c *Client) SetFileStatus(infoHash string, status FileStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := c.fileStatus[infoHash]
+	for i := range statuses {
+		if statuses[i].Path == status.Path {
+			statuses[i] = status
+			return
+		}
+	}
+	c.fileStatus[infoHash] = append(statuses, status)
+}
+
+func (c *Client) fileStatuses(infoHash string) []FileStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]FileStatus(nil), c.fileStatus[infoHash]...)
+}
+
+// ReleaseTorrent drops a completed torrent from the client so its files can
+// be removed without being served or downloaded again. The torrent is still
+// listed, with status StatusReleased, until it is removed.
+func (c *Client) ReleaseTorrent(infoHash string) error {
+	files, err := c.CompletedFiles(infoHash)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, ok := c.torrents[infoHash]
+	if !ok {
+		return nil
+	}
+	stats := t.Stats()
+	info := TorrentInfo{
+		ID:         infoHash,
+		InfoHash:   infoHash,
+		Name:       t.Name(),
+		Size:       t.Length(),
+		TotalSize:  t.Length(),
+		Downloaded: t.BytesCompleted(),
+		Uploaded:   stats.BytesWrittenData.Int64(),
+		Progress:   100,
+		Status:     StatusReleased,
+		Category:   c.category(infoHash),
+	}
+
+	t.Drop()
+	delete(c.torrents, infoHash)
+	delete(c.torrentLimits, infoHash)
+	delete(c.suspendedLimits, infoHash)
+	delete(c.filePriorities, infoHash)
+	delete(c.paused, infoHash)
+	c.released[infoHash] = &releasedTorrent{info: info, files: files}
+
+	c.logger.Info("Released completed torrent", zap.String("infoHash", infoHash))
+	return nil
+}
+
+func (c *Client) releasedInfo(infoHash string) (*TorrentInfo, bool) {
+	c.mu.RLock()
+	released, ok := c.released[infoHash]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	info := released.info
+	info.Files = c.fileStatuses(infoHash)
+	return &info, true
+}
@@ -0,0 +1,55 @@
+package torrent
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestReleasedTorrentKeepsFileStatus(t *testing.T) {
+	c := &Client{
+		config:     &ClientConfig{DataDir: "/downloads"},
+		logger:     zap.NewNop(),
+		fileStatus: make(map[string][]FileStatus),
+		released: map[string]*releasedTorrent{
+			"abc": {
+				info:  TorrentInfo{ID: "abc", InfoHash: "abc", Name: "movie", Progress: 100, Status: StatusReleased},
+				files: []CompletedFile{{Path: "/downloads/movie.mkv", Size: 42}},
+			},
+		},
+	}
+
+	c.SetFileStatus("abc", FileStatus{Path: "/downloads/movie.mkv", Size: 42, Status: FileStatusEncrypting})
+	c.SetFileStatus("abc", FileStatus{Path: "/downloads/movie.mkv", Size: 42, Status: FileStatusEncrypted, EncryptedPath: "/downloads/movie.mkv.b2encrypted"})
+
+	info, err := c.GetTorrent("abc")
+	if err != nil {
+		t.Fatalf("GetTorrent: %v", err)
+	}
+	if info.Status != StatusReleased || len(info.Files) != 1 || info.Files[0].Status != FileStatusEncrypted {
+		t.Fatalf("unexpected released torrent info: %+v", info)
+	}
+	if all := c.GetAllTorrents(); len(all) != 1 || all[0].InfoHash != "abc" {
+		t.Fatalf("released torrent missing from listing: %+v", all)
+	}
+
+	files, err := c.CompletedFiles("abc")
+	if err != nil || len(files) != 1 || files[0].Size != 42 {
+		t.Fatalf("CompletedFiles = %+v, %v", files, err)
+	}
+
+	paths, err := c.DataPaths("abc")
+	if err != nil || len(paths) != 1 || paths[0] != "/downloads/movie.mkv" {
+		t.Fatalf("DataPaths = %v, %v", paths, err)
+	}
+
+	if err := c.RemoveTorrent("abc"); err != nil {
+		t.Fatalf("RemoveTorrent: %v", err)
+	}
+	if _, err := c.GetTorrent("abc"); err == nil {
+		t.Fatal("removed torrent is still reported")
+	}
+	if len(c.fileStatuses("abc")) != 0 {
+		t.Fatal("file status kept after removal")
+	}
+}
@@ -0,0 +1,218 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EgressRoute says whether a connection leaves through the proxy chain or
+// directly from the host.
+type EgressRoute string
+
+const (
+	EgressRouteProxy  EgressRoute = "proxy"
+	EgressRouteDirect EgressRoute = "direct"
+)
+
+// Callers of the egress guard, one per dialer the torrent client installs.
+const (
+	EgressCallerTracker    = "tracker"
+	EgressCallerTrackerUDP = "tracker-udp"
+	EgressCallerHTTP       = "http"
+	EgressCallerPeer       = "peer"
+	EgressCallerDNS        = "dns"
+	// EgressCallerFeed is used by HTTPClient for RSS and Atom feeds.
+	EgressCallerFeed = "feed"
+	// EgressCallerSearch is used by HTTPClient for Torznab indexers.
+	EgressCallerSearch = "search"
+)
+
+const maxEgressRecords = 200
+
+// ErrDirectEgressRefused is returned when a direct connection is attempted
+// while the configuration requires all traffic to go through a proxy.
+var ErrDirectEgressRefused = errors.New("direct egress refused: proxy required")
+
+// EgressRecord describes one outbound connection attempt.
+type EgressRecord struct {
+	Time        time.Time   `json:"time"`
+	Caller      string      `json:"caller"`
+	Network     string      `json:"network"`
+	Destination string      `json:"destination"`
+	Route       EgressRoute `json:"route"`
+	Allowed     bool        `json:"allowed"`
+}
+
+// EgressStats summarizes what the guard has seen since startup.
+type EgressStats struct {
+	RequireProxy bool           `json:"requireProxy"`
+	Total        int64          `json:"total"`
+	Proxied      int64          `json:"proxied"`
+	Direct       int64          `json:"direct"`
+	Refused      int64          `json:"refused"`
+	Recent       []EgressRecord `json:"recent"`
+}
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// EgressGuard wraps every dialer the torrent client uses. It records each
+// attempt in a bounded in-memory ring and refuses direct egress when a proxy
+// is required. Nothing is persisted.
+type EgressGuard struct {
+	mu           sync.Mutex
+	logger       *zap.Logger
+	requireProxy bool
+	records      []EgressRecord
+	next         int
+	total        int64
+	proxied      int64
+	direct       int64
+	refused      int64
+	onRefusal    []func(EgressRecord)
+}
+
+func NewEgressGuard(requireProxy bool, logger *zap.Logger) *EgressGuard {
+	return &EgressGuard{
+		logger:       logger,
+		requireProxy: requireProxy,
+		records:      make([]EgressRecord, 0, maxEgressRecords),
+	}
+}
+
+func (g *EgressGuard) SetRequireProxy(required bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.requireProxy = required
+}
+
+func (g *EgressGuard) RequireProxy() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.requireProxy
+}
+
+// OnRefusal registers fn to be called for every refused connection.
+func (g *EgressGuard) OnRefusal(fn func(EgressRecord)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.onRefusal = append(g.onRefusal, fn)
+}
+
+// Check records an attempt and reports whether it may proceed.
+func (g *EgressGuard) Check(caller, network, destination string, route EgressRoute) error {
+	record := EgressRecord{
+		Time:        time.Now().UTC(),
+		Caller:      caller,
+		Network:     network,
+		Destination: destination,
+		Route:       route,
+	}
+
+	g.mu.Lock()
+	record.Allowed = route == EgressRouteProxy || !g.requireProxy
+	g.total++
+	switch {
+	case !record.Allowed:
+		g.refused++
+	case route == EgressRouteProxy:
+		g.proxied++
+	default:
+		g.direct++
+	}
+	if len(g.records) < maxEgressRecords {
+		g.records = append(g.records, record)
+	} else {
+		g.records[g.next] = record
+	}
+	g.next = (g.next + 1) % maxEgressRecords
+	var callbacks []func(EgressRecord)
+	if !record.Allowed {
+		callbacks = make([]func(EgressRecord), len(g.onRefusal))
+		copy(callbacks, g.onRefusal)
+	}
+	g.mu.Unlock()
+
+	if record.Allowed {
+		return nil
+	}
+
+	g.logger.Warn("Refused direct egress while a proxy is required",
+		zap.String("caller", caller),
+		zap.String("network", network),
+	)
+	for _, callback := range callbacks {
+		callback(record)
+	}
+	return fmt.Errorf("%s %s: %w", caller, network, ErrDirectEgressRefused)
+}
+
+// Wrap returns a dialer that passes every attempt through Check first.
+func (g *EgressGuard) Wrap(caller string, route EgressRoute, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if err := g.Check(caller, network, addr, route); err != nil {
+			return nil, err
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// LeaksDetected is the number of direct connections refused so far.
+func (g *EgressGuard) LeaksDetected() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.refused
+}
+
+// Reset forgets the recorded attempts and zeroes the counters.
+func (g *EgressGuard) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.records = make([]EgressRecord, 0, maxEgressRecords)
+	g.next = 0
+	g.total, g.proxied, g.direct, g.refused = 0, 0, 0, 0
+}
+
+// Stats returns counters and the most recent attempts, newest first.
+func (g *EgressGuard) Stats() EgressStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	recent := make([]EgressRecord, 0, len(g.records))
+	for i := 1; i <= len(g.records); i++ {
+		index := (g.next - i + maxEgressRecords) % maxEgressRecords
+		if index >= len(g.records) {
+			continue
+		}
+		recent = append(recent, g.records[index])
+	}
+
+	return EgressStats{
+		RequireProxy: g.requireProxy,
+		Total:        g.total,
+		Proxied:      g.proxied,
+		Direct:       g.direct,
+		Refused:      g.refused,
+		Recent:       recent,
+	}
+}
+
+// peerDialer adapts a dial function to the anacrolix Dialer interface so peer
+// connections go through the same guard as tracker and HTTP traffic.
+type peerDialer struct {
+	network string
+	dial    dialFunc
+}
+
+func (d peerDialer) DialerNetwork() string {
+	return d.network
+}
+
+func (d peerDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return d.dial(ctx, d.network, addr)
+}
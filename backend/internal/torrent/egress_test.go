@@ -0,0 +1,152 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"go.uber.org/zap"
+)
+
+func TestEgressGuardRefusesDirectWhenProxyRequired(t *testing.T) {
+	guard := NewEgressGuard(true, zap.NewNop())
+	var refused []EgressRecord
+	guard.OnRefusal(func(record EgressRecord) {
+		refused = append(refused, record)
+	})
+
+	dialed := 0
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed++
+		return nil, errors.New("not connected in tests")
+	}
+
+	_, err := guard.Wrap(EgressCallerTracker, EgressRouteDirect, dial)(context.Background(), "tcp", "tracker.example:80")
+	if !errors.Is(err, ErrDirectEgressRefused) {
+		t.Fatalf("direct dial error = %v, want ErrDirectEgressRefused", err)
+	}
+	if dialed != 0 {
+		t.Fatal("a refused connection must never reach the underlying dialer")
+	}
+
+	_, _ = guard.Wrap(EgressCallerPeer, EgressRouteProxy, dial)(context.Background(), "tcp", "10.0.0.1:6881")
+	if dialed != 1 {
+		t.Fatalf("proxied dial reached the dialer %d times, want 1", dialed)
+	}
+
+	if guard.LeaksDetected() != 1 {
+		t.Fatalf("LeaksDetected() = %d, want 1", guard.LeaksDetected())
+	}
+	if len(refused) != 1 || refused[0].Caller != EgressCallerTracker || refused[0].Destination != "tracker.example:80" {
+		t.Fatalf("unexpected refusal callbacks %+v", refused)
+	}
+
+	stats := guard.Stats()
+	if stats.Total != 2 || stats.Proxied != 1 || stats.Direct != 0 || stats.Refused != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Recent[0].Caller != EgressCallerPeer || stats.Recent[0].Route != EgressRouteProxy {
+		t.Fatalf("expected newest record first, got %+v", stats.Recent[0])
+	}
+}
+
+func TestEgressGuardAllowsDirectWhenProxyOptional(t *testing.T) {
+	guard := NewEgressGuard(false, zap.NewNop())
+	if err := guard.Check(EgressCallerDNS, "udp", "tracker.example", EgressRouteDirect); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+
+	guard.SetRequireProxy(true)
+	if err := guard.Check(EgressCallerDNS, "udp", "tracker.example", EgressRouteDirect); err == nil {
+		t.Fatal("expected direct DNS to be refused once a proxy is required")
+	}
+	if stats := guard.Stats(); stats.Direct != 1 || stats.Refused != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestEgressGuardKeepsBoundedHistory(t *testing.T) {
+	guard := NewEgressGuard(false, zap.NewNop())
+	for i := 0; i < maxEgressRecords+5; i++ {
+		_ = guard.Check(EgressCallerPeer, "tcp", fmt.Sprintf("peer-%d", i), EgressRouteDirect)
+	}
+
+	stats := guard.Stats()
+	if len(stats.Recent) != maxEgressRecords {
+		t.Fatalf("kept %d records, want %d", len(stats.Recent), maxEgressRecords)
+	}
+	if want := fmt.Sprintf("peer-%d", maxEgressRecords+4); stats.Recent[0].Destination != want {
+		t.Fatalf("newest record = %s, want %s", stats.Recent[0].Destination, want)
+	}
+	if stats.Total != maxEgressRecords+5 {
+		t.Fatalf("Total = %d, want %d", stats.Total, maxEgressRecords+5)
+	}
+}
+
+func TestSuspendedBlocklistRefusesInboundPeers(t *testing.T) {
+	suspended := new(atomic.Bool)
+	blocklist := suspendedBlocklist{suspended: suspended}
+	peer := net.ParseIP("198.51.100.7")
+
+	if _, blocked := blocklist.Lookup(peer); blocked {
+		t.Fatal("peer blocked while the network is up")
+	}
+	suspended.Store(true)
+	if r, blocked := blocklist.Lookup(peer); !blocked || !r.First.Equal(peer) {
+		t.Fatalf("Lookup() = %+v, %t while suspended", r, blocked)
+	}
+}
+
+func TestTorStripsUDPTrackersWithoutRaisingLeaks(t *testing.T) {
+	t.Setenv("TOR_ENABLED", "true")
+	client, err := NewClient("127.0.0.1:9", t.TempDir())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	// Every refusal becomes a critical leak_detected event, which trips the
+	// kill switch.
+	var refusals atomic.Int64
+	client.EgressGuard().OnRefusal(func(EgressRecord) { refusals.Add(1) })
+
+	magnet := "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567" +
+		"&tr=udp://tracker.example:6969/announce&tr=https://tracker.example/announce"
+	if err := client.ValidateMagnetURI(magnet); err != nil {
+		t.Fatalf("ValidateMagnetURI() error = %v", err)
+	}
+	spec, err := torrent.TorrentSpecFromMagnetUri(magnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := client.addSpec(spec, client.config.DataDir)
+	if err != nil {
+		t.Fatalf("addSpec() error = %v", err)
+	}
+	defer tr.Drop()
+
+	for _, tier := range tr.Metainfo().AnnounceList {
+		for _, tracker := range tier {
+			if strings.HasPrefix(tracker, "udp:") {
+				t.Fatalf("UDP tracker %s kept under Tor", tracker)
+			}
+		}
+	}
+	if !client.PrivacyStatus().UDPTrackersBlocked {
+		t.Fatal("UDP trackers not reported as blocked under Tor")
+	}
+	if _, err := client.clientConfig.TrackerListenPacket("udp", ":0"); !errors.Is(err, ErrUDPDisabled) {
+		t.Fatalf("TrackerListenPacket() error = %v", err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if n := refusals.Load(); n != 0 || client.EgressGuard().LeaksDetected() != 0 {
+		t.Fatalf("%d refusals, %d leaks under Tor", n, client.EgressGuard().LeaksDetected())
+	}
+}
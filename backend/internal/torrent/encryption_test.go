@@ -0,0 +1,132 @@
+package torrent
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/mse"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestPeerCryptoMethod(t *testing.T) {
+	peer := func(headerEncrypted bool, method mse.CryptoMethod) *torrent.PeerConn {
+		pc := new(torrent.PeerConn)
+		conn := reflect.ValueOf(pc).Elem()
+		for name, value := range map[string]interface{}{"headerEncrypted": headerEncrypted, "cryptoMethod": method} {
+			field := conn.FieldByName(name)
+			if !field.IsValid() {
+				t.Fatalf("torrent.PeerConn has no %s field", name)
+			}
+			reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(value))
+		}
+		return pc
+	}
+
+	cases := []struct {
+		pc   *torrent.PeerConn
+		want string
+	}{
+		{peer(true, mse.CryptoMethodRC4), PeerCryptoRC4},
+		{peer(true, mse.CryptoMethodPlaintext), PeerCryptoObfuscate},
+		{peer(false, 0), PeerCryptoPlaintext},
+	}
+	for _, tc := range cases {
+		if got := peerCryptoMethod(tc.pc); got != tc.want {
+			t.Errorf("peerCryptoMethod() = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestHandshakeGateFollowsLiveMode(t *testing.T) {
+	c := new(Client)
+	dial := c.gateHandshake(func(context.Context, string, string) (net.Conn, error) {
+		local, remote := net.Pipe()
+		go io.Copy(io.Discard, remote)
+		return local, nil
+	})
+	write := func(first []byte) error {
+		conn, err := dial(context.Background(), "tcp", "peer:6881")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_, err = conn.Write(first)
+		return err
+	}
+	plaintext := []byte(pp.Protocol)
+	encrypted := make([]byte, 96)
+
+	for _, tc := range []struct {
+		mode                   EncryptionMode
+		plaintextOK, encryptOK bool
+	}{
+		{EncryptionPrefer, true, true},
+		{EncryptionRequire, false, true},
+		{EncryptionDisabled, true, false},
+	} {
+		c.encryptionMode.Store(tc.mode)
+		if err := write(plaintext); (err == nil) != tc.plaintextOK {
+			t.Errorf("%s: plaintext handshake err = %v", tc.mode, err)
+		}
+		if err := write(encrypted); (err == nil) != tc.encryptOK {
+			t.Errorf("%s: encrypted handshake err = %v", tc.mode, err)
+		}
+	}
+	if c.rejectedPeers.Load() != 2 {
+		t.Errorf("rejected = %d, want 2", c.rejectedPeers.Load())
+	}
+}
+
+func TestEncryptionModePolicy(t *testing.T) {
+	cfg := torrent.NewDefaultClientConfig()
+
+	applyEncryptionPolicy(cfg, EncryptionRequire)
+	if cfg.HeaderObfuscationPolicy.RequirePreferred || !cfg.HeaderObfuscationPolicy.Preferred || cfg.CryptoProvides != mse.CryptoMethodRC4 {
+		t.Fatalf("require mode policy = %+v provides=%v", cfg.HeaderObfuscationPolicy, cfg.CryptoProvides)
+	}
+	applyEncryptionPolicy(cfg, EncryptionDisabled)
+	if cfg.HeaderObfuscationPolicy.RequirePreferred || cfg.HeaderObfuscationPolicy.Preferred {
+		t.Fatalf("disabled mode policy = %+v", cfg.HeaderObfuscationPolicy)
+	}
+	applyEncryptionPolicy(cfg, EncryptionPrefer)
+	if cfg.HeaderObfuscationPolicy.RequirePreferred || cfg.CryptoProvides != mse.AllSupportedCrypto {
+		t.Fatalf("prefer mode policy = %+v provides=%v", cfg.HeaderObfuscationPolicy, cfg.CryptoProvides)
+	}
+
+	if encryptionAllows(EncryptionRequire, PeerCryptoObfuscate) || !encryptionAllows(EncryptionRequire, PeerCryptoRC4) {
+		t.Fatal("require mode must only accept RC4 peers")
+	}
+	if encryptionAllows(EncryptionDisabled, PeerCryptoRC4) || !encryptionAllows(EncryptionDisabled, PeerCryptoPlaintext) {
+		t.Fatal("disabled mode must only accept plaintext peers")
+	}
+
+	mode := EncryptionPrefer
+	selector := cryptoSelector(func() EncryptionMode { return mode })
+	if got := selector(mse.AllSupportedCrypto); got != mse.CryptoMethodRC4 {
+		t.Fatalf("prefer selector chose %v, want RC4", got)
+	}
+	if got := selector(mse.CryptoMethodPlaintext); got != mse.CryptoMethodPlaintext {
+		t.Fatalf("prefer selector chose %v for a plaintext-only peer", got)
+	}
+	mode = EncryptionDisabled
+	if got := selector(mse.AllSupportedCrypto); got != mse.CryptoMethodPlaintext {
+		t.Fatalf("disabled selector chose %v, want plaintext", got)
+	}
+}
+
+func TestParseEncryptionMode(t *testing.T) {
+	for input, want := range map[string]EncryptionMode{"": EncryptionPrefer, "Require": EncryptionRequire, "disabled": EncryptionDisabled} {
+		got, err := ParseEncryptionMode(input)
+		if err != nil || got != want {
+			t.Fatalf("ParseEncryptionMode(%q) = %q, %v", input, got, err)
+		}
+	}
+	if _, err := ParseEncryptionMode("rc4"); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,41 @@
+package torrent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTPClient returns a client for requests made on the user's behalf, such
+// as feed fetches, reported to the egress guard as caller. Requests go
+// through the proxy chain when one is configured, on a circuit of their own
+// per host with stream isolation, and fail while the network is suspended.
+func (c *Client) HTTPClient(caller string) *http.Client {
+	c.mu.RLock()
+	isolate := c.config.StreamIsolation
+	c.mu.RUnlock()
+
+	var dial dialFunc
+	if c.torEnabled && c.multiProxyDialer != nil {
+		dial = c.egress.Wrap(caller, EgressRouteProxy, suspendableDial(c.networkSuspended, func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if isolate {
+				ctx = WithIsolationKey(ctx, caller+":"+addr)
+			}
+			return c.multiProxyDialer.DialContext(ctx, network, addr)
+		}))
+	} else {
+		direct := &net.Dialer{Timeout: 30 * time.Second}
+		dial = c.egress.Wrap(caller, EgressRouteDirect, suspendableDial(c.networkSuspended, direct.DialContext))
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dial,
+			DisableKeepAlives:     true,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		Timeout: 60 * time.Second,
+	}
+}
@@ -0,0 +1,139 @@
+package torrent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+)
+
+// File priorities accepted by SetFilePriority.
+const (
+	FilePrioritySkip   = "skip"
+	FilePriorityNormal = "normal"
+	FilePriorityHigh   = "high"
+)
+
+// TorrentFile is one file of a torrent and how much of it is downloaded.
+type TorrentFile struct {
+	Index      int     `json:"index"`
+	Path       string  `json:"path"`
+	Size       int64   `json:"size"`
+	Downloaded int64   `json:"downloaded"`
+	Progress   float64 `json:"progress"`
+	Priority   string  `json:"priority"`
+}
+
+// ParseFilePriority normalizes a priority name.
+func ParseFilePriority(value string) (string, error) {
+	switch priority := strings.ToLower(strings.TrimSpace(value)); priority {
+	case FilePrioritySkip, FilePriorityNormal, FilePriorityHigh:
+		return priority, nil
+	case "none", "off":
+		return FilePrioritySkip, nil
+	}
+	return "", fmt.Errorf("invalid file priority %q: want skip, normal or high", value)
+}
+
+// Files lists the files of a torrent in the order of its metadata.
+func (c *Client) Files(infoHash string) ([]TorrentFile, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	t, ok := c.torrents[infoHash]
+	if !ok {
+		return nil, fmt.Errorf("torrent not found: %s", infoHash)
+	}
+
+	files := make([]TorrentFile, 0, len(t.Files()))
+	for i, f := range t.Files() {
+		progress := 0.0
+		if f.Length() > 0 {
+			progress = float64(f.BytesCompleted()) / float64(f.Length()) * 100
+		}
+		files = append(files, TorrentFile{
+			Index:      i,
+			Path:       f.DisplayPath(),
+			Size:       f.Length(),
+			Downloaded: f.BytesCompleted(),
+			Progress:   progress,
+			Priority:   c.filePriority(infoHash, i),
+		})
+	}
+	return files, nil
+}
+
+// SetFilePriority sets the priority of the files at indices. Skipped files
+// are not downloaded, so a torrent with skipped files never completes and
+// its completion hooks do not run. The priorities of a paused torrent take
+// effect when it is resumed.
+func (c *Client) SetFilePriority(infoHash string, indices []int, priority string) error {
+	priority, err := ParseFilePriority(priority)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, ok := c.torrents[infoHash]
+	if !ok {
+		return fmt.Errorf("torrent not found: %s", infoHash)
+	}
+	count := len(t.Files())
+	if len(indices) == 0 {
+		return fmt.Errorf("at least one file index is required")
+	}
+	for _, index := range indices {
+		if index < 0 || index >= count {
+			return fmt.Errorf("file index %d out of range: torrent has %d files", index, count)
+		}
+	}
+
+	priorities := c.filePriorities[infoHash]
+	if priorities == nil {
+		priorities = make(map[int]string)
+		c.filePriorities[infoHash] = priorities
+	}
+	for _, index := range indices {
+		if priority == FilePriorityNormal {
+			delete(priorities, index)
+		} else {
+			priorities[index] = priority
+		}
+	}
+
+	if !c.paused[infoHash] {
+		c.applyFilePriorities(infoHash, t)
+	}
+	return nil
+}
+
+// applyFilePriorities hands the stored priorities to the torrent. The
+// caller holds c.mu.
+func (c *Client) applyFilePriorities(infoHash string, t *torrent.Torrent) {
+	for i, f := range t.Files() {
+		switch c.filePriority(infoHash, i) {
+		case FilePrioritySkip:
+			f.SetPriority(torrent.PiecePriorityNone)
+		case FilePriorityHigh:
+			f.SetPriority(torrent.PiecePriorityHigh)
+		default:
+			f.SetPriority(torrent.PiecePriorityNormal)
+		}
+	}
+}
+
+// filePriority returns the stored priority of a file. The caller holds c.mu.
+func (c *Client) filePriority(infoHash string, index int) string {
+	if priority, ok := c.filePriorities[infoHash][index]; ok {
+		return priority
+	}
+	return FilePriorityNormal
+}
+
+func (c *Client) isPaused(infoHash string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.paused[infoHash]
+}
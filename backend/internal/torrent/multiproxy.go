@@ -2,10 +2,18 @@ package torrent
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/proxy"
@@ -15,19 +23,42 @@ import (
 type MultiProxyDialer struct {
 	proxyChain []string
 	baseDialer proxy.Dialer
+
+	// Stream isolation: Tor's IsolateSOCKSAuth (on by default) never lets
+	// streams with different SOCKS credentials share a circuit, so each
+	// isolation key is mapped to its own username/password pair.
+	isolationSecret   []byte
+	isolationResolver func(network, addr string) string
+
+	observer atomic.Pointer[DialObserver]
+}
+
+// DialObserver is told how long each attempt to dial through the chain
+// took and whether it failed. entry is the first proxy of the attempt.
+type DialObserver func(entry string, elapsed time.Duration, err error)
+
+// SetDialObserver installs fn to be called after every dial attempt.
+func (m *MultiProxyDialer) SetDialObserver(fn DialObserver) {
+	m.observer.Store(&fn)
 }
 
-type proxyPeerDialer struct {
-	network string
-	dialer  *MultiProxyDialer
+func (m *MultiProxyDialer) observe(entry string, started time.Time, err error) {
+	if fn := m.observer.Load(); fn != nil && *fn != nil {
+		(*fn)(entry, time.Since(started), err)
+	}
 }
 
-func (d proxyPeerDialer) DialerNetwork() string {
-	return d.network
+type isolationKeyContextKey struct{}
+
+// WithIsolationKey tags ctx so dials made with it use the credentials derived
+// for key, for example a torrent info hash.
+func WithIsolationKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, isolationKeyContextKey{}, key)
 }
 
-func (d proxyPeerDialer) Dial(ctx context.Context, addr string) (net.Conn, error) {
-	return d.dialer.DialContext(ctx, d.network, addr)
+func isolationKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(isolationKeyContextKey{}).(string)
+	return key
 }
 
 // NewMultiProxyDialer creates a dialer that routes through multiple proxies
@@ -37,12 +68,36 @@ func NewMultiProxyDialer(proxyAddresses []string) (*MultiProxyDialer, error) {
 		return nil, fmt.Errorf("at least one proxy address required")
 	}
 
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate stream isolation secret: %w", err)
+	}
+
 	return &MultiProxyDialer{
-		proxyChain: proxyAddresses,
-		baseDialer: proxy.Direct,
+		proxyChain:      proxyAddresses,
+		baseDialer:      proxy.Direct,
+		isolationSecret: secret,
 	}, nil
 }
 
+// SetIsolationResolver installs a fallback used to pick an isolation key for
+// dials whose context does not carry one.
+func (m *MultiProxyDialer) SetIsolationResolver(resolver func(network, addr string) string) {
+	m.isolationResolver = resolver
+}
+
+// isolationAuth derives stable per-key SOCKS credentials. The secret is
+// random per process so credentials cannot be linked across restarts.
+func (m *MultiProxyDialer) isolationAuth(key string) *proxy.Auth {
+	if key == "" || len(m.isolationSecret) == 0 {
+		return nil
+	}
+	mac := hmac.New(sha256.New, m.isolationSecret)
+	mac.Write([]byte(key))
+	sum := hex.EncodeToString(mac.Sum(nil))
+	return &proxy.Auth{User: "b2-" + sum[:16], Password: sum[16:48]}
+}
+
 // Dial establishes a connection through the proxy chain
 func (m *MultiProxyDialer) Dial(network, addr string) (net.Conn, error) {
 	return m.DialWithRetry(network, addr, 3)
@@ -50,17 +105,22 @@ func (m *MultiProxyDialer) Dial(network, addr string) (net.Conn, error) {
 
 // DialWithRetry attempts connection with retry logic for fault tolerance
 func (m *MultiProxyDialer) DialWithRetry(network, addr string, maxRetries int) (net.Conn, error) {
+	return m.dialWithRetry(network, addr, maxRetries, nil)
+}
+
+func (m *MultiProxyDialer) dialWithRetry(network, addr string, maxRetries int, auth *proxy.Auth) (net.Conn, error) {
 	var lastErr error
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		// Shuffle proxy order for each attempt to avoid patterns
 		shuffledProxies := m.shuffleProxies()
+		started := time.Now()
 
 		currentDialer := m.baseDialer
 
 		// Chain proxies together
 		for _, proxyAddr := range shuffledProxies {
-			nextDialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, currentDialer)
+			nextDialer, err := proxy.SOCKS5("tcp", proxyAddr, auth, currentDialer)
 			if err != nil {
 				lastErr = fmt.Errorf("failed to create proxy chain at %s: %w", proxyAddr, err)
 				break
@@ -69,6 +129,7 @@ func (m *MultiProxyDialer) DialWithRetry(network, addr string, maxRetries int) (
 		}
 
 		if lastErr != nil {
+			m.observe(shuffledProxies[0], started, lastErr)
 			// Wait before retry with exponential backoff
 			time.Sleep(time.Duration(attempt+1) * time.Second)
 			continue
@@ -76,6 +137,7 @@ func (m *MultiProxyDialer) DialWithRetry(network, addr string, maxRetries int) (
 
 		// Attempt connection through the chain
 		conn, err := currentDialer.Dial(network, addr)
+		m.observe(shuffledProxies[0], started, err)
 		if err != nil {
 			lastErr = fmt.Errorf("failed to dial through proxy chain: %w", err)
 			time.Sleep(time.Duration(attempt+1) * time.Second)
@@ -95,10 +157,16 @@ func (m *MultiProxyDialer) DialContext(ctx context.Context, network, addr string
 		err  error
 	}
 
+	key := isolationKeyFromContext(ctx)
+	if key == "" && m.isolationResolver != nil {
+		key = m.isolationResolver(network, addr)
+	}
+	auth := m.isolationAuth(key)
+
 	resultChan := make(chan result, 1)
 
 	go func() {
-		conn, err := m.Dial(network, addr)
+		conn, err := m.dialWithRetry(network, addr, 3, auth)
 		resultChan <- result{conn: conn, err: err}
 	}()
 
@@ -123,35 +191,94 @@ func (m *MultiProxyDialer) shuffleProxies() []string {
 	return shuffled
 }
 
-// TestProxyChain verifies all proxies in the chain are operational
-func (m *MultiProxyDialer) TestProxyChain(ctx context.Context) error {
+// DefaultCanary is dialed through the whole chain when no canary endpoint
+// is configured.
+const DefaultCanary = "1.1.1.1:443"
+
+// connectivityIsolationKey keeps health checks off the circuits used by
+// torrents.
+const connectivityIsolationKey = "connectivity-check"
+
+// dialChain connects to addr through every proxy in order, honouring ctx.
+func (m *MultiProxyDialer) dialChain(ctx context.Context, network, addr string, auth *proxy.Auth) (conn net.Conn, err error) {
+	started := time.Now()
+	defer func() { m.observe(m.proxyChain[0], started, err) }()
+
+	current := m.baseDialer
 	for _, proxyAddr := range m.proxyChain {
-		dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, proxy.Direct)
+		next, err := proxy.SOCKS5("tcp", proxyAddr, auth, current)
 		if err != nil {
-			return fmt.Errorf("proxy %s unreachable: %w", proxyAddr, err)
+			return nil, fmt.Errorf("failed to create proxy chain at %s: %w", proxyAddr, err)
 		}
+		current = next
+	}
+	if dialer, ok := current.(proxy.ContextDialer); ok {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return current.Dial(network, addr)
+}
 
-		type result struct {
-			conn net.Conn
-			err  error
-		}
+// TestProxyChain verifies that canary can be reached through the full
+// chain, exactly as torrent traffic would travel.
+func (m *MultiProxyDialer) TestProxyChain(ctx context.Context, canary string) error {
+	if canary == "" {
+		canary = DefaultCanary
+	}
+	conn, err := m.dialChain(ctx, "tcp", canary, m.isolationAuth(connectivityIsolationKey))
+	if err != nil {
+		return fmt.Errorf("canary %s unreachable through the proxy chain: %w", canary, err)
+	}
+	return conn.Close()
+}
 
-		resultChan := make(chan result, 1)
-		go func() {
-			conn, err := dialer.Dial("tcp", "1.1.1.1:80")
-			resultChan <- result{conn: conn, err: err}
-		}()
-
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("proxy test timeout for %s: %w", proxyAddr, ctx.Err())
-		case res := <-resultChan:
-			if res.err != nil {
-				return fmt.Errorf("proxy %s not working: %w", proxyAddr, res.err)
-			}
-			res.conn.Close()
-		}
+// ExitInfo is what an exit check endpoint reported about the address
+// traffic leaves the chain from. IsTor is nil when the endpoint does not say.
+type ExitInfo struct {
+	IP    string `json:"ip"`
+	IsTor *bool  `json:"isTor,omitempty"`
+}
+
+// ExitIP asks checkURL, through the chain, which address the request came
+// from. The endpoint may answer with the check.torproject.org JSON format
+// ({"IsTor": true, "IP": "..."}) or with the bare address.
+func (m *MultiProxyDialer) ExitIP(ctx context.Context, checkURL string) (ExitInfo, error) {
+	auth := m.isolationAuth(connectivityIsolationKey)
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: nil,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return m.dialChain(ctx, network, addr, auth)
+			},
+			DisableKeepAlives: true,
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err != nil {
+		return ExitInfo{}, fmt.Errorf("invalid exit check URL: %w", err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return ExitInfo{}, fmt.Errorf("exit check failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return ExitInfo{}, fmt.Errorf("exit check returned %s", res.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if err != nil {
+		return ExitInfo{}, fmt.Errorf("exit check failed: %w", err)
 	}
 
-	return nil
+	var reply struct {
+		IP    string `json:"IP"`
+		IsTor *bool  `json:"IsTor"`
+	}
+	info := ExitInfo{IP: strings.TrimSpace(string(body))}
+	if json.Unmarshal(body, &reply) == nil {
+		info = ExitInfo{IP: reply.IP, IsTor: reply.IsTor}
+	}
+	if net.ParseIP(info.IP) == nil {
+		return ExitInfo{}, fmt.Errorf("exit check returned no IP address")
+	}
+	return info, nil
 }
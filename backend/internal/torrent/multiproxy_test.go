@@ -0,0 +1,212 @@
+package torrent
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSOCKS5 is a minimal SOCKS5 proxy that accepts any credentials and
+// records where it was asked to connect.
+type fakeSOCKS5 struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	targets []string
+}
+
+func newFakeSOCKS5(t *testing.T) *fakeSOCKS5 {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	fake := &fakeSOCKS5{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go fake.serve()
+	return fake
+}
+
+func (f *fakeSOCKS5) addr() string { return f.listener.Addr().String() }
+
+func (f *fakeSOCKS5) seen() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.targets...)
+}
+
+func (f *fakeSOCKS5) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeSOCKS5) handle(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	method := byte(0x00)
+	for _, m := range methods {
+		if m == 0x02 {
+			method = 0x02
+		}
+	}
+	conn.Write([]byte{0x05, method})
+	if method == 0x02 {
+		// Username/password sub-negotiation: version, user, password.
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		user := make([]byte, buf[1]+1)
+		if _, err := io.ReadFull(conn, user); err != nil {
+			return
+		}
+		password := make([]byte, user[len(user)-1])
+		if _, err := io.ReadFull(conn, password); err != nil {
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+	}
+
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+	var host string
+	switch request[3] {
+	case 0x01:
+		ip := make([]byte, net.IPv4len)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 0x04:
+		ip := make([]byte, net.IPv6len)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 0x03:
+		length := make([]byte, 1)
+		io.ReadFull(conn, length)
+		name := make([]byte, length[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+	f.mu.Lock()
+	f.targets = append(f.targets, target)
+	f.mu.Unlock()
+
+	upstream, err := net.DialTimeout("tcp", target, time.Second)
+	if err != nil {
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func TestProxyChainDialsCanaryThroughEveryHop(t *testing.T) {
+	canary, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer canary.Close()
+	go func() {
+		for {
+			conn, err := canary.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	first, second := newFakeSOCKS5(t), newFakeSOCKS5(t)
+	dialer, err := NewMultiProxyDialer([]string{first.addr(), second.addr()})
+	if err != nil {
+		t.Fatalf("NewMultiProxyDialer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := dialer.TestProxyChain(ctx, canary.Addr().String()); err != nil {
+		t.Fatalf("TestProxyChain() error = %v", err)
+	}
+	if got := first.seen(); len(got) != 1 || got[0] != second.addr() {
+		t.Fatalf("first hop connected to %v, want the second hop %s", got, second.addr())
+	}
+	if got := second.seen(); len(got) != 1 || got[0] != canary.Addr().String() {
+		t.Fatalf("second hop connected to %v, want the canary %s", got, canary.Addr())
+	}
+
+	closed := canary.Addr().String()
+	canary.Close()
+	if err := dialer.TestProxyChain(ctx, closed); err == nil {
+		t.Fatal("TestProxyChain() succeeded with the canary down")
+	}
+}
+
+func TestExitIPThroughChain(t *testing.T) {
+	replies := map[string]string{
+		"/api/ip": `{"IsTor":false,"IP":"203.0.113.7"}`,
+		"/plain":  "198.51.100.4\n",
+		"/bogus":  "not an address",
+	}
+	standIn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, replies[r.URL.Path])
+	}))
+	defer standIn.Close()
+
+	hop := newFakeSOCKS5(t)
+	dialer, err := NewMultiProxyDialer([]string{hop.addr()})
+	if err != nil {
+		t.Fatalf("NewMultiProxyDialer() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	info, err := dialer.ExitIP(ctx, standIn.URL+"/api/ip")
+	if err != nil {
+		t.Fatalf("ExitIP() error = %v", err)
+	}
+	if info.IP != "203.0.113.7" || info.IsTor == nil || *info.IsTor {
+		t.Fatalf("ExitIP() = %+v, want a non-Tor exit at 203.0.113.7", info)
+	}
+	if len(hop.seen()) == 0 {
+		t.Fatal("exit check did not go through the proxy")
+	}
+
+	info, err = dialer.ExitIP(ctx, standIn.URL+"/plain")
+	if err != nil || info.IP != "198.51.100.4" || info.IsTor != nil {
+		t.Fatalf("ExitIP(plain) = %+v, %v, want 198.51.100.4 with no Tor verdict", info, err)
+	}
+
+	if _, err := dialer.ExitIP(ctx, standIn.URL+"/bogus"); err == nil {
+		t.Fatal("ExitIP() accepted a reply without an address")
+	}
+}
@@ -0,0 +1,65 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Adder adds torrents. *Client implements it; the feeds, search and watch
+// folder packages take an Adder so that their tests can record what they
+// add instead.
+type Adder interface {
+	AddMagnetContext(ctx context.Context, magnetURI string, opts AddOptions) (string, error)
+	AddTorrentFileWithOptions(data []byte, opts AddOptions) (string, error)
+	IsNetworkSuspended() bool
+}
+
+// AddOptions sets where an added torrent is filed and stored.
+type AddOptions struct {
+	// Category is a free-form label reported in TorrentInfo.
+	Category string
+	// SavePath is a directory relative to the download directory. Empty
+	// stores the torrent in the download directory itself.
+	SavePath string
+}
+
+// placement records the AddOptions a torrent was added with.
+type placement struct {
+	category string
+	dataDir  string
+}
+
+// resolveSavePath turns an AddOptions.SavePath into an absolute directory.
+// Save paths stay inside the download directory so that secure deletion and
+// encryption, which are confined to it, still cover every torrent.
+func (c *Client) resolveSavePath(savePath string) (string, error) {
+	savePath = strings.TrimSpace(savePath)
+	if savePath == "" {
+		return c.config.DataDir, nil
+	}
+	if filepath.IsAbs(savePath) {
+		return "", fmt.Errorf("save path %q must be relative to the download directory", savePath)
+	}
+	dir := filepath.Join(c.config.DataDir, savePath)
+	if rel, err := filepath.Rel(c.config.DataDir, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("save path %q leaves the download directory", savePath)
+	}
+	return dir, nil
+}
+
+// dataDir returns the directory a torrent's files are stored under. The
+// caller holds c.mu.
+func (c *Client) dataDir(infoHash string) string {
+	if p, ok := c.placement[infoHash]; ok && p.dataDir != "" {
+		return p.dataDir
+	}
+	return c.config.DataDir
+}
+
+// category returns the category a torrent was added with. The caller holds
+// c.mu.
+func (c *Client) category(infoHash string) string {
+	return c.placement[infoHash].category
+}
@@ -0,0 +1,469 @@
+package torrent
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Tor refuses NEWNYM signals sent more often than this and answers them with
+// a rate-limit notice, so requests inside the window are rejected locally.
+const minNewNymInterval = 10 * time.Second
+
+const maxTorControlLineLength = 64 << 10
+
+// TorControlConfig describes how to reach and authenticate to a Tor control port.
+type TorControlConfig struct {
+	Address          string
+	Password         string
+	CookiePath       string
+	RotationInterval time.Duration
+}
+
+// TorBootstrapStatus is the parsed form of GETINFO status/bootstrap-phase.
+type TorBootstrapStatus struct {
+	Progress int    `json:"progress"`
+	Tag      string `json:"tag"`
+	Summary  string `json:"summary"`
+	Warning  string `json:"warning,omitempty"`
+}
+
+// TorRelay identifies a single hop of a circuit.
+type TorRelay struct {
+	Fingerprint string `json:"fingerprint"`
+	Nickname    string `json:"nickname,omitempty"`
+}
+
+// TorCircuit is one entry from GETINFO circuit-status.
+type TorCircuit struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Path       []TorRelay `json:"path"`
+	Purpose    string     `json:"purpose,omitempty"`
+	BuildFlags []string   `json:"buildFlags,omitempty"`
+	Username   string     `json:"-"`
+}
+
+// TorController speaks the Tor control protocol over a single connection.
+// Commands are serialized; the connection is re-established lazily after an
+// error so a restarted Tor daemon does not require a backend restart.
+type TorController struct {
+	config TorControlConfig
+	logger *zap.Logger
+
+	mu         sync.Mutex
+	conn       net.Conn
+	reader     *bufio.Reader
+	lastNewNym time.Time
+}
+
+// TorControlConfigFromEnv reads TOR_CONTROL_* settings. It returns false when
+// no control address is configured.
+func TorControlConfigFromEnv() (TorControlConfig, bool) {
+	address := strings.TrimSpace(os.Getenv("TOR_CONTROL_ADDR"))
+	if address == "" {
+		return TorControlConfig{}, false
+	}
+
+	config := TorControlConfig{
+		Address:    address,
+		Password:   os.Getenv("TOR_CONTROL_PASSWORD"),
+		CookiePath: strings.TrimSpace(os.Getenv("TOR_CONTROL_COOKIE")),
+	}
+	if raw := strings.TrimSpace(os.Getenv("TOR_NEWNYM_INTERVAL")); raw != "" {
+		if interval, err := time.ParseDuration(raw); err == nil && interval >= minNewNymInterval {
+			config.RotationInterval = interval
+		}
+	}
+	return config, true
+}
+
+func NewTorController(config TorControlConfig, logger *zap.Logger) *TorController {
+	return &TorController{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Address returns the configured control port address.
+func (tc *TorController) Address() string {
+	return tc.config.Address
+}
+
+// RotationInterval returns the scheduled NEWNYM interval, or zero when
+// rotation only happens on demand.
+func (tc *TorController) RotationInterval() time.Duration {
+	return tc.config.RotationInterval
+}
+
+// LastNewNym returns when the last successful NEWNYM signal was sent.
+func (tc *TorController) LastNewNym() time.Time {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.lastNewNym
+}
+
+// NewNym asks Tor to switch to clean circuits for new streams.
+func (tc *TorController) NewNym(ctx context.Context) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if !tc.lastNewNym.IsZero() && time.Since(tc.lastNewNym) < minNewNymInterval {
+		return fmt.Errorf("circuit rotation is rate limited; retry in %s", (minNewNymInterval - time.Since(tc.lastNewNym)).Round(time.Second))
+	}
+	if _, err := tc.commandLocked(ctx, "SIGNAL NEWNYM"); err != nil {
+		return err
+	}
+	tc.lastNewNym = time.Now()
+	return nil
+}
+
+// BootstrapStatus reports how far Tor has progressed in building its first circuits.
+func (tc *TorController) BootstrapStatus(ctx context.Context) (TorBootstrapStatus, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	lines, err := tc.commandLocked(ctx, "GETINFO status/bootstrap-phase")
+	if err != nil {
+		return TorBootstrapStatus{}, err
+	}
+	for _, line := range lines {
+		if value, ok := strings.CutPrefix(line, "status/bootstrap-phase="); ok {
+			return parseBootstrapPhase(value), nil
+		}
+	}
+	return TorBootstrapStatus{}, fmt.Errorf("tor did not report a bootstrap phase")
+}
+
+// Circuits lists the circuits Tor currently knows about.
+func (tc *TorController) Circuits(ctx context.Context) ([]TorCircuit, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	lines, err := tc.commandLocked(ctx, "GETINFO circuit-status")
+	if err != nil {
+		return nil, err
+	}
+
+	circuits := make([]TorCircuit, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimPrefix(line, "circuit-status=")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if circuit, ok := parseCircuitLine(line); ok {
+			circuits = append(circuits, circuit)
+		}
+	}
+	return circuits, nil
+}
+
+// StartRotation sends NEWNYM on the configured schedule until ctx is done.
+func (tc *TorController) StartRotation(ctx context.Context) {
+	if tc.config.RotationInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(tc.config.RotationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rotateCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if err := tc.NewNym(rotateCtx); err != nil {
+				tc.logger.Warn("Scheduled Tor circuit rotation failed", zap.Error(err))
+			}
+			cancel()
+		}
+	}
+}
+
+func (tc *TorController) Close() error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.closeLocked()
+}
+
+func (tc *TorController) closeLocked() error {
+	if tc.conn == nil {
+		return nil
+	}
+	err := tc.conn.Close()
+	tc.conn = nil
+	tc.reader = nil
+	return err
+}
+
+func (tc *TorController) commandLocked(ctx context.Context, command string) ([]string, error) {
+	if err := tc.ensureConnectedLocked(ctx); err != nil {
+		return nil, err
+	}
+
+	lines, err := tc.roundTripLocked(ctx, command)
+	if err != nil {
+		_ = tc.closeLocked()
+		return nil, err
+	}
+	return lines, nil
+}
+
+func (tc *TorController) ensureConnectedLocked(ctx context.Context) error {
+	if tc.conn != nil {
+		return nil
+	}
+
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", tc.config.Address)
+	if err != nil {
+		return fmt.Errorf("failed to reach Tor control port: %w", err)
+	}
+	tc.conn = conn
+	tc.reader = bufio.NewReaderSize(conn, maxTorControlLineLength)
+
+	if err := tc.authenticateLocked(ctx); err != nil {
+		_ = tc.closeLocked()
+		return err
+	}
+	return nil
+}
+
+func (tc *TorController) authenticateLocked(ctx context.Context) error {
+	lines, err := tc.roundTripLocked(ctx, "PROTOCOLINFO 1")
+	if err != nil {
+		return fmt.Errorf("tor PROTOCOLINFO failed: %w", err)
+	}
+
+	methods := map[string]bool{}
+	cookieFile := tc.config.CookiePath
+	for _, line := range lines {
+		rest, ok := strings.CutPrefix(line, "AUTH ")
+		if !ok {
+			continue
+		}
+		for _, field := range splitControlFields(rest) {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "METHODS":
+				for _, method := range strings.Split(value, ",") {
+					methods[method] = true
+				}
+			case "COOKIEFILE":
+				if cookieFile == "" {
+					cookieFile = unquoteControlString(value)
+				}
+			}
+		}
+	}
+
+	var command string
+	switch {
+	case tc.config.Password != "" && methods["HASHEDPASSWORD"]:
+		command = "AUTHENTICATE " + quoteControlString(tc.config.Password)
+	case methods["COOKIE"] && cookieFile != "":
+		// #nosec G304 -- the cookie path comes from operator config or from Tor itself.
+		cookie, err := os.ReadFile(cookieFile)
+		if err != nil {
+			return fmt.Errorf("failed to read Tor control cookie: %w", err)
+		}
+		command = "AUTHENTICATE " + hex.EncodeToString(cookie)
+	case methods["NULL"]:
+		command = "AUTHENTICATE"
+	default:
+		return fmt.Errorf("no supported Tor control authentication method is configured")
+	}
+
+	if _, err := tc.roundTripLocked(ctx, command); err != nil {
+		return fmt.Errorf("tor control authentication failed: %w", err)
+	}
+	return nil
+}
+
+// roundTripLocked writes one command and collects the reply lines with their
+// status prefixes stripped. Data replies ("250+key=") are folded into the
+// returned slice line by line.
+func (tc *TorController) roundTripLocked(ctx context.Context, command string) ([]string, error) {
+	deadline := time.Now().Add(10 * time.Second)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := tc.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if _, err := tc.conn.Write([]byte(command + "\r\n")); err != nil {
+		return nil, fmt.Errorf("failed to write Tor control command: %w", err)
+	}
+
+	var lines []string
+	for {
+		line, err := tc.readLineLocked()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) < 4 {
+			return nil, fmt.Errorf("malformed Tor control reply")
+		}
+
+		code, separator, text := line[:3], line[3], line[4:]
+		if code == "650" {
+			// Asynchronous events are never subscribed to, but skip them defensively.
+			continue
+		}
+		if code[0] != '2' {
+			return nil, fmt.Errorf("tor control error %s: %s", code, text)
+		}
+
+		switch separator {
+		case '-':
+			lines = append(lines, text)
+		case '+':
+			lines = append(lines, text)
+			for {
+				dataLine, err := tc.readLineLocked()
+				if err != nil {
+					return nil, err
+				}
+				if dataLine == "." {
+					break
+				}
+				lines = append(lines, strings.TrimPrefix(dataLine, "."))
+			}
+		case ' ':
+			if text != "OK" {
+				lines = append(lines, text)
+			}
+			return lines, nil
+		default:
+			return nil, fmt.Errorf("malformed Tor control reply")
+		}
+	}
+}
+
+func (tc *TorController) readLineLocked() (string, error) {
+	// ReadSlice stops at the reader's buffer size, so an endless line is
+	// refused without being held in memory.
+	line, err := tc.reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("tor control reply line is too long")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read Tor control reply: %w", err)
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func parseBootstrapPhase(value string) TorBootstrapStatus {
+	var status TorBootstrapStatus
+	for _, field := range splitControlFields(value) {
+		key, raw, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "PROGRESS":
+			status.Progress, _ = strconv.Atoi(raw)
+		case "TAG":
+			status.Tag = raw
+		case "SUMMARY":
+			status.Summary = unquoteControlString(raw)
+		case "WARNING":
+			status.Warning = unquoteControlString(raw)
+		}
+	}
+	return status
+}
+
+func parseCircuitLine(line string) (TorCircuit, bool) {
+	fields := splitControlFields(line)
+	if len(fields) < 2 {
+		return TorCircuit{}, false
+	}
+
+	circuit := TorCircuit{ID: fields[0], Status: fields[1]}
+	rest := fields[2:]
+	if len(rest) > 0 && !strings.Contains(rest[0], "=") {
+		for _, hop := range strings.Split(rest[0], ",") {
+			fingerprint, nickname, _ := strings.Cut(hop, "~")
+			if nickname == "" {
+				fingerprint, nickname, _ = strings.Cut(hop, "=")
+			}
+			circuit.Path = append(circuit.Path, TorRelay{
+				Fingerprint: strings.TrimPrefix(fingerprint, "$"),
+				Nickname:    nickname,
+			})
+		}
+		rest = rest[1:]
+	}
+
+	for _, field := range rest {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "PURPOSE":
+			circuit.Purpose = value
+		case "BUILD_FLAGS":
+			circuit.BuildFlags = strings.Split(value, ",")
+		case "SOCKS_USERNAME":
+			circuit.Username = unquoteControlString(value)
+		}
+	}
+	return circuit, true
+}
+
+// splitControlFields splits on spaces while keeping quoted strings intact.
+func splitControlFields(value string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuotes := false
+	escaped := false
+
+	for _, r := range value {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && inQuotes:
+			current.WriteRune(r)
+			escaped = true
+		case r == '"':
+			current.WriteRune(r)
+			inQuotes = !inQuotes
+		case r == ' ' && !inQuotes:
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+func quoteControlString(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", "")
+	return `"` + replacer.Replace(value) + `"`
+}
+
+func unquoteControlString(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	replacer := strings.NewReplacer(`\\`, `\`, `\"`, `"`)
+	return replacer.Replace(value[1 : len(value)-1])
+}
@@ -0,0 +1,266 @@
+package torrent
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeControlPort answers a minimal subset of the Tor control protocol.
+type fakeControlPort struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	commands []string
+	// oversized makes circuit-status answer with a line longer than the
+	// controller accepts.
+	oversized bool
+}
+
+func newFakeControlPort(t *testing.T, password string) *fakeControlPort {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	fake := &fakeControlPort{listener: listener, password: password}
+	t.Cleanup(func() { listener.Close() })
+	go fake.serve()
+	return fake
+}
+
+func (f *fakeControlPort) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeControlPort) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := false
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		f.mu.Lock()
+		f.commands = append(f.commands, command)
+		oversized := f.oversized
+		f.mu.Unlock()
+
+		var reply string
+		switch {
+		case command == "PROTOCOLINFO 1":
+			reply = "250-PROTOCOLINFO 1\r\n250-AUTH METHODS=HASHEDPASSWORD\r\n250-VERSION Tor=\"0.4.8.0\"\r\n250 OK\r\n"
+		case strings.HasPrefix(command, "AUTHENTICATE"):
+			if command == "AUTHENTICATE "+quoteControlString(f.password) {
+				authenticated = true
+				reply = "250 OK\r\n"
+			} else {
+				reply = "515 Authentication failed: Password did not match\r\n"
+			}
+		case !authenticated:
+			reply = "514 Authentication required.\r\n"
+		case command == "SIGNAL NEWNYM":
+			reply = "250 OK\r\n"
+		case command == "GETINFO status/bootstrap-phase":
+			reply = "250-status/bootstrap-phase=NOTICE BOOTSTRAP PROGRESS=100 TAG=done SUMMARY=\"Done\"\r\n250 OK\r\n"
+		case command == "GETINFO circuit-status" && oversized:
+			reply = "250-circuit-status=" + strings.Repeat("7", 2*maxTorControlLineLength) + "\r\n250 OK\r\n"
+		case command == "GETINFO circuit-status":
+			reply = "250+circuit-status=\r\n" +
+				"7 BUILT $AAAA~guard,$BBBB~middle,$CCCC~exit BUILD_FLAGS=NEED_CAPACITY PURPOSE=GENERAL SOCKS_USERNAME=\"b2-x\"\r\n" +
+				"8 LAUNCHED PURPOSE=GENERAL\r\n" +
+				".\r\n250 OK\r\n"
+		default:
+			reply = "510 Unrecognized command\r\n"
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeControlPort) sent(command string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, c := range f.commands {
+		if c == command {
+			count++
+		}
+	}
+	return count
+}
+
+func TestTorControllerPasswordAuthAndQueries(t *testing.T) {
+	fake := newFakeControlPort(t, `pa"ss`)
+	controller := NewTorController(TorControlConfig{
+		Address:  fake.listener.Addr().String(),
+		Password: `pa"ss`,
+	}, zap.NewNop())
+	defer controller.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	bootstrap, err := controller.BootstrapStatus(ctx)
+	if err != nil {
+		t.Fatalf("BootstrapStatus() error = %v", err)
+	}
+	if bootstrap.Progress != 100 || bootstrap.Tag != "done" || bootstrap.Summary != "Done" {
+		t.Fatalf("unexpected bootstrap status %+v", bootstrap)
+	}
+
+	circuits, err := controller.Circuits(ctx)
+	if err != nil {
+		t.Fatalf("Circuits() error = %v", err)
+	}
+	if len(circuits) != 2 {
+		t.Fatalf("got %d circuits, want 2", len(circuits))
+	}
+	built := circuits[0]
+	if built.ID != "7" || built.Status != "BUILT" || built.Purpose != "GENERAL" || built.Username != "b2-x" {
+		t.Fatalf("unexpected circuit %+v", built)
+	}
+	if len(built.Path) != 3 || built.Path[2].Nickname != "exit" || built.Path[0].Fingerprint != "AAAA" {
+		t.Fatalf("unexpected circuit path %+v", built.Path)
+	}
+
+	if err := controller.NewNym(ctx); err != nil {
+		t.Fatalf("NewNym() error = %v", err)
+	}
+	if err := controller.NewNym(ctx); err == nil {
+		t.Fatal("expected a second NEWNYM inside the rate limit window to be rejected")
+	}
+	if got := fake.sent("SIGNAL NEWNYM"); got != 1 {
+		t.Fatalf("NEWNYM sent %d times, want 1", got)
+	}
+	if got := fake.sent("PROTOCOLINFO 1"); got != 1 {
+		t.Fatalf("expected a single authenticated session, PROTOCOLINFO sent %d times", got)
+	}
+}
+
+func TestTorControllerRejectsWrongPassword(t *testing.T) {
+	fake := newFakeControlPort(t, "correct")
+	controller := NewTorController(TorControlConfig{
+		Address:  fake.listener.Addr().String(),
+		Password: "wrong",
+	}, zap.NewNop())
+	defer controller.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := controller.BootstrapStatus(ctx); err == nil {
+		t.Fatal("expected authentication failure")
+	}
+}
+
+func TestTorControllerRejectsOverlongLines(t *testing.T) {
+	fake := newFakeControlPort(t, "secret")
+	fake.mu.Lock()
+	fake.oversized = true
+	fake.mu.Unlock()
+	controller := NewTorController(TorControlConfig{
+		Address:  fake.listener.Addr().String(),
+		Password: "secret",
+	}, zap.NewNop())
+	defer controller.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := controller.Circuits(ctx); err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Fatalf("Circuits() error = %v, want a too long error", err)
+	}
+}
+
+func TestPeerSwarmIndexPrefersLowestInfoHash(t *testing.T) {
+	swarms := map[string][]string{
+		"bbbb": {"10.0.0.1:6881", "10.0.0.2:6881"},
+		"aaaa": {"10.0.0.2:6881"},
+	}
+	scans := 0
+	known := func() map[string][]string {
+		scans++
+		return swarms
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	idx := peerSwarmIndex{now: func() time.Time { return now }}
+	idx.add("cccc", []string{"10.0.0.2:6881", "10.0.0.3:6881"})
+	if infoHash, ok := idx.lookup("10.0.0.3:6881", known); !ok || infoHash != "cccc" || scans != 0 {
+		t.Fatalf("lookup = %q, %t after %d scans", infoHash, ok, scans)
+	}
+	for i := 0; i < 3; i++ {
+		if infoHash, ok := idx.lookup("10.0.0.1:6881", known); !ok || infoHash != "bbbb" {
+			t.Fatalf("lookup = %q, %t", infoHash, ok)
+		}
+		if infoHash, _ := idx.lookup("10.0.0.2:6881", known); infoHash != "aaaa" {
+			t.Fatalf("shared peer went to %q, want the lowest infohash", infoHash)
+		}
+	}
+	if scans != 1 {
+		t.Fatalf("swarms scanned %d times, want once", scans)
+	}
+
+	idx.forget("aaaa")
+	swarms = map[string][]string{"bbbb": swarms["bbbb"]}
+	if infoHash, _ := idx.lookup("10.0.0.2:6881", known); infoHash != "bbbb" {
+		t.Fatalf("after forget lookup = %q", infoHash)
+	}
+	if _, ok := idx.lookup("10.0.0.9:6881", known); ok {
+		t.Fatal("unknown peer resolved to a swarm")
+	}
+
+	// Misses are not rebuilt again until the interval has passed.
+	scans = 0
+	swarms["dddd"] = []string{"10.0.0.9:6881"}
+	for i := 0; i < 3; i++ {
+		if _, ok := idx.lookup("10.0.0.9:6881", known); ok || scans != 0 {
+			t.Fatalf("miss rebuilt the index: ok %t after %d scans", ok, scans)
+		}
+	}
+	now = now.Add(peerSwarmRebuildInterval)
+	if infoHash, _ := idx.lookup("10.0.0.9:6881", known); infoHash != "dddd" || scans != 1 {
+		t.Fatalf("lookup after the interval = %q after %d scans", infoHash, scans)
+	}
+}
+
+func TestIsolationAuthSeparatesKeys(t *testing.T) {
+	dialer, err := NewMultiProxyDialer([]string{"127.0.0.1:9050"})
+	if err != nil {
+		t.Fatalf("NewMultiProxyDialer() error = %v", err)
+	}
+
+	first := dialer.isolationAuth("torrent:aaaa")
+	again := dialer.isolationAuth("torrent:aaaa")
+	second := dialer.isolationAuth("torrent:bbbb")
+	if first == nil || second == nil {
+		t.Fatal("expected credentials for non-empty isolation keys")
+	}
+	if *first != *again {
+		t.Fatal("expected stable credentials for the same torrent")
+	}
+	if first.User == second.User || first.Password == second.Password {
+		t.Fatal("expected distinct credentials for different torrents")
+	}
+	if dialer.isolationAuth("") != nil {
+		t.Fatal("expected no credentials without an isolation key")
+	}
+}
@@ -0,0 +1,96 @@
+// Package torrenttest provides a torrent.Adder that records what is added,
+// for the tests of packages that add torrents.
+package torrenttest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+)
+
+// Adder records added magnet links and torrent files instead of adding
+// them. A magnet link's info hash is its btih value and a file's is
+// FileInfoHash. While Suspended is set, adds fail like they do with the
+// network suspended.
+type Adder struct {
+	FileInfoHash string
+	Suspended    atomic.Bool
+	// Waiting, when set, makes magnet links wait for metadata until ctx is
+	// done, and is signalled each time one starts to.
+	Waiting chan struct{}
+
+	mu      sync.Mutex
+	magnets []string
+	files   []string
+	opts    []torrent.AddOptions
+}
+
+var _ torrent.Adder = (*Adder)(nil)
+
+func (a *Adder) AddMagnetContext(ctx context.Context, magnetURI string, opts torrent.AddOptions) (string, error) {
+	infoHash, ok := strings.CutPrefix(magnetURI, "magnet:?xt=urn:btih:")
+	if !ok {
+		return "", errors.New("invalid magnet URI")
+	}
+	if a.Suspended.Load() {
+		return "", torrent.ErrNetworkSuspended
+	}
+	if a.Waiting != nil {
+		a.Waiting <- struct{}{}
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.magnets = append(a.magnets, magnetURI)
+	a.opts = append(a.opts, opts)
+	infoHash, _, _ = strings.Cut(infoHash, "&")
+	return strings.ToLower(infoHash), nil
+}
+
+func (a *Adder) AddTorrentFileWithOptions(data []byte, opts torrent.AddOptions) (string, error) {
+	if a.Suspended.Load() {
+		return "", torrent.ErrNetworkSuspended
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.files = append(a.files, string(data))
+	a.opts = append(a.opts, opts)
+	return a.FileInfoHash, nil
+}
+
+func (a *Adder) IsNetworkSuspended() bool {
+	return a.Suspended.Load()
+}
+
+// Magnets returns the magnet links added so far.
+func (a *Adder) Magnets() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.magnets...)
+}
+
+// Files returns the contents of the torrent files added so far.
+func (a *Adder) Files() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.files...)
+}
+
+// Options returns the options of every add, in order.
+func (a *Adder) Options() []torrent.AddOptions {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]torrent.AddOptions(nil), a.opts...)
+}
+
+// Added returns how many magnet links and files were added.
+func (a *Adder) Added() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.magnets) + len(a.files)
+}
@@ -1,16 +1,23 @@
 package torrent
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
 	"regexp"
 	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
 )
 
 const MaxMagnetURILength = 8192
 
+// MaxTorrentFileSize bounds an uploaded .torrent file. Base64 encoded, it
+// still fits in the API's request body limit.
+const MaxTorrentFileSize = 5 << 20
+
 var infoHashPattern = regexp.MustCompile(`(?i)^([a-f0-9]{40}|[a-f0-9]{64}|[a-z2-7]{32})$`)
 
 type MagnetValidationPolicy struct {
@@ -65,6 +72,40 @@ func ValidateMagnetURIWithPolicy(raw string, policy MagnetValidationPolicy) erro
 	return nil
 }
 
+// ValidateTorrentFile parses a .torrent file and applies the same tracker
+// and web seed rules as ValidateMagnetURIWithPolicy.
+func ValidateTorrentFile(data []byte, policy MagnetValidationPolicy) (*metainfo.MetaInfo, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("torrent file is required")
+	}
+	if len(data) > MaxTorrentFileSize {
+		return nil, fmt.Errorf("torrent file is too large")
+	}
+
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid torrent file")
+	}
+	if _, err := mi.UnmarshalInfo(); err != nil {
+		return nil, fmt.Errorf("invalid torrent file info")
+	}
+
+	for _, tier := range mi.UpvertedAnnounceList() {
+		for _, tracker := range tier {
+			if err := validateMagnetEndpoint("tracker", tracker, policy); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, endpoint := range mi.UrlList {
+		if looksLikeRemoteURL(endpoint) {
+			return nil, fmt.Errorf("remote source and web seed URLs are disabled for torrent safety")
+		}
+	}
+
+	return mi, nil
+}
+
 func hasValidBtih(values []string) bool {
 	for _, value := range values {
 		lower := strings.ToLower(strings.TrimSpace(value))
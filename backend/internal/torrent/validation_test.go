@@ -1,6 +1,11 @@
 package torrent
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
 
 func TestValidateMagnetURI(t *testing.T) {
 	validHash := "0123456789abcdef0123456789abcdef01234567"
@@ -74,3 +79,77 @@ func TestIsValidInfoHash(t *testing.T) {
 		t.Fatal("expected path-like value to be invalid")
 	}
 }
+
+func torrentFile(t *testing.T, mi metainfo.MetaInfo) []byte {
+	t.Helper()
+	info, err := bencode.Marshal(metainfo.Info{
+		Name:        "example.iso",
+		PieceLength: 16 << 10,
+		Pieces:      make([]byte, 20),
+		Length:      1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi.InfoBytes = info
+	data, err := bencode.Marshal(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestValidateTorrentFile(t *testing.T) {
+	policy := MagnetValidationPolicy{TorEnabled: true, AllowUDPTrackers: true}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "valid", data: torrentFile(t, metainfo.MetaInfo{Announce: "udp://tracker.example:6969/announce"})},
+		{name: "empty", data: nil, wantErr: true},
+		{name: "not bencode", data: []byte("magnet:?xt=urn:btih:abc"), wantErr: true},
+		{name: "private tracker blocked", data: torrentFile(t, metainfo.MetaInfo{
+			AnnounceList: metainfo.AnnounceList{{"udp://tracker.example:6969/announce"}, {"http://192.168.1.10/announce"}},
+		}), wantErr: true},
+		{name: "web seed blocked", data: torrentFile(t, metainfo.MetaInfo{UrlList: []string{"https://example.com/example.iso"}}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mi, err := ValidateTorrentFile(tt.data, policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateTorrentFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && mi.HashInfoBytes().HexString() == "" {
+				t.Fatal("expected an info hash")
+			}
+		})
+	}
+}
+
+func TestParseFilePriority(t *testing.T) {
+	for input, want := range map[string]string{"skip": FilePrioritySkip, " High ": FilePriorityHigh, "none": FilePrioritySkip, "normal": FilePriorityNormal} {
+		if got, err := ParseFilePriority(input); err != nil || got != want {
+			t.Errorf("ParseFilePriority(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseFilePriority("urgent"); err == nil {
+		t.Error("expected unknown priority to be rejected")
+	}
+}
+
+func TestResolveSavePath(t *testing.T) {
+	c := &Client{config: &ClientConfig{DataDir: "/downloads"}}
+	for input, want := range map[string]string{"": "/downloads", " ": "/downloads", "isos": "/downloads/isos", "a/../b": "/downloads/b", "..data": "/downloads/..data"} {
+		if got, err := c.resolveSavePath(input); err != nil || got != want {
+			t.Errorf("resolveSavePath(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"/etc", "..", "../other", "isos/../../other"} {
+		if _, err := c.resolveSavePath(input); err == nil {
+			t.Errorf("resolveSavePath(%q) accepted", input)
+		}
+	}
+}
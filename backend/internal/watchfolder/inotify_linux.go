@@ -0,0 +1,73 @@
+//go:build linux
+
+package watchfolder
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// watchEvents reports files closed after writing or moved into dirs. The
+// channel is buffered and events that do not fit are dropped; the next scan
+// picks those files up.
+func watchEvents(ctx context.Context, dirs []string) (<-chan string, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	watches := make(map[int32]string, len(dirs))
+	for _, dir := range dirs {
+		wd, err := syscall.InotifyAddWatch(fd, dir, syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, os.NewSyscallError("inotify_add_watch", err)
+		}
+		watches[int32(wd)] = dir
+	}
+
+	// A non-blocking descriptor lets os.File use the runtime poller, so
+	// closing it unblocks the reader.
+	file := os.NewFile(uintptr(fd), "inotify")
+	events := make(chan string, 64)
+	go func() {
+		<-ctx.Done()
+		file.Close()
+	}()
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				if !errors.Is(err, os.ErrClosed) {
+					file.Close()
+				}
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+				nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+				start := offset + syscall.SizeofInotifyEvent
+				end := start + nameLen
+				if end > n {
+					break
+				}
+				name := string(bytes.TrimRight(buf[start:end], "\x00"))
+				offset = end
+				dir, ok := watches[wd]
+				if !ok || name == "" {
+					continue
+				}
+				select {
+				case events <- filepath.Join(dir, name):
+				default:
+				}
+			}
+		}
+	}()
+	return events, nil
+}
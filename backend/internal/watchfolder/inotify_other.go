@@ -0,0 +1,14 @@
+//go:build !linux
+
+package watchfolder
+
+import (
+	"context"
+	"errors"
+)
+
+// watchEvents is only implemented with inotify; elsewhere folders are
+// polled.
+func watchEvents(ctx context.Context, dirs []string) (<-chan string, error) {
+	return nil, errors.New("file notifications are not supported on this platform")
+}
@@ -0,0 +1,354 @@
+// Package watchfolder imports .torrent files and magnet link lists dropped
+// into watched directories.
+//
+// Each folder is watched with inotify where available and rescanned on an
+// interval, which is also the fallback when inotify is not. Files are added
+// through the torrent client, which applies the same validation policy as
+// links added through the API, with the folder's category and save path.
+// A processed file is moved to the folder's done subdirectory, or to failed
+// next to a note explaining why.
+package watchfolder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"go.uber.org/zap"
+)
+
+// Subdirectories processed files are moved to.
+const (
+	DoneDir   = "done"
+	FailedDir = "failed"
+)
+
+// DefaultInterval is how often folders are rescanned.
+const DefaultInterval = 10 * time.Second
+
+// maxMagnetListSize bounds a text file of magnet links.
+const maxMagnetListSize = 1 << 20
+
+// Folder is one watched directory and the defaults applied to what is
+// imported from it.
+type Folder struct {
+	Path     string
+	Category string
+	// SavePath is relative to the download directory; see
+	// torrent.AddOptions.
+	SavePath string
+}
+
+// ParseFolders reads a comma separated list of folders, each a path with
+// optional category and save path parameters, e.g.
+// "/watch/movies?category=movies&save=movies,/watch/other".
+func ParseFolders(value string) ([]Folder, error) {
+	var folders []Folder
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		path, rawQuery, _ := strings.Cut(entry, "?")
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, fmt.Errorf("watch folder %q: %w", entry, err)
+		}
+		for key := range query {
+			if key != "category" && key != "save" {
+				return nil, fmt.Errorf("watch folder %q: unknown parameter %q, want category or save", entry, key)
+			}
+		}
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("watch folder %q: path must be absolute", entry)
+		}
+		folders = append(folders, Folder{
+			Path:     filepath.Clean(path),
+			Category: query.Get("category"),
+			SavePath: query.Get("save"),
+		})
+	}
+	return folders, nil
+}
+
+// snapshot is what a scan saw of a file, to tell when it stopped changing.
+type snapshot struct {
+	size    int64
+	modTime time.Time
+}
+
+// Watcher imports files from a set of folders until it is shut down.
+type Watcher struct {
+	folders  map[string]Folder
+	adder    torrent.Adder
+	interval time.Duration
+	logger   *zap.Logger
+	now      func() time.Time
+
+	// seen holds the last scan of every pending file; it is only used by
+	// the run goroutine.
+	seen map[string]snapshot
+
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+// New creates the folders and their done and failed subdirectories, and
+// starts watching them.
+func New(folders []Folder, adder torrent.Adder, interval time.Duration, logger *zap.Logger) (*Watcher, error) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	w := &Watcher{
+		folders:  make(map[string]Folder, len(folders)),
+		adder:    adder,
+		interval: interval,
+		logger:   logger,
+		now:      time.Now,
+		seen:     make(map[string]snapshot),
+	}
+	for _, folder := range folders {
+		for _, dir := range []string{folder.Path, filepath.Join(folder.Path, DoneDir), filepath.Join(folder.Path, FailedDir)} {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return nil, fmt.Errorf("watch folder %s: %w", folder.Path, err)
+			}
+		}
+		w.folders[folder.Path] = folder
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	w.stop = stop
+	events, err := watchEvents(ctx, w.paths())
+	if err != nil {
+		logger.Warn("Watch folder notifications unavailable; polling", zap.Duration("interval", interval), zap.Error(err))
+	}
+	w.wg.Add(1)
+	go w.run(ctx, events)
+	return w, nil
+}
+
+// Shutdown stops watching and waits for the file being imported, if any.
+func (w *Watcher) Shutdown(ctx context.Context) error {
+	w.stop()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Watcher) paths() []string {
+	paths := make([]string, 0, len(w.folders))
+	for path := range w.folders {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// run imports files one at a time. Notified files are imported at once,
+// since inotify only reports them once they are closed or moved in; scanned
+// files wait until two scans agree on their size and modification time.
+func (w *Watcher) run(ctx context.Context, events <-chan string) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	w.scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case path := <-events:
+			if candidate(path) {
+				w.process(ctx, path)
+			}
+		case <-ticker.C:
+			w.scan(ctx)
+		}
+	}
+}
+
+func (w *Watcher) scan(ctx context.Context) {
+	present := make(map[string]bool)
+	for dir := range w.folders {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			w.logger.Warn("Watch folder unreadable", zap.String("folder", dir), zap.Error(err))
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if !entry.Type().IsRegular() || !candidate(path) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			present[path] = true
+			current := snapshot{size: info.Size(), modTime: info.ModTime()}
+			if previous, ok := w.seen[path]; !ok || previous != current {
+				w.seen[path] = current
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			w.process(ctx, path)
+		}
+	}
+	for path := range w.seen {
+		if !present[path] {
+			delete(w.seen, path)
+		}
+	}
+}
+
+// candidate reports whether a file name is one the watcher imports.
+// Hidden files are skipped so that tools can write to a temporary name
+// and rename it into place.
+func candidate(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".torrent", ".magnet", ".txt":
+		return true
+	}
+	return false
+}
+
+// process imports one file and moves it out of the folder. While the kill
+// switch holds the network suspended, and when the watcher is shut down
+// part way through, files are left in place and retried on a later scan.
+func (w *Watcher) process(ctx context.Context, path string) {
+	if w.adder.IsNetworkSuspended() {
+		return
+	}
+	folder, ok := w.folders[filepath.Dir(path)]
+	if !ok {
+		return
+	}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	delete(w.seen, path)
+
+	opts := torrent.AddOptions{Category: folder.Category, SavePath: folder.SavePath}
+	added, err := w.importFile(ctx, path, opts)
+	if errors.Is(err, torrent.ErrNetworkSuspended) || ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		w.logger.Warn("Watch folder import failed", zap.String("file", filepath.Base(path)), zap.Int("added", added), zap.Error(err))
+		w.finish(folder, path, FailedDir, err)
+		return
+	}
+	w.logger.Info("Watch folder import complete", zap.String("file", filepath.Base(path)), zap.Int("added", added))
+	w.finish(folder, path, DoneDir, nil)
+}
+
+// importFile adds every torrent in a file and returns how many were added.
+// It stops at the next magnet link once ctx is done.
+func (w *Watcher) importFile(ctx context.Context, path string, opts torrent.AddOptions) (int, error) {
+	limit := int64(maxMagnetListSize)
+	isTorrent := strings.EqualFold(filepath.Ext(path), ".torrent")
+	if isTorrent {
+		limit = torrent.MaxTorrentFileSize
+	}
+	data, err := readLimited(path, limit)
+	if err != nil {
+		return 0, err
+	}
+	if isTorrent {
+		if _, err := w.adder.AddTorrentFileWithOptions(data, opts); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	added := 0
+	var errs []error
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64<<10), torrent.MaxMagnetURILength+1)
+	for line := 1; scanner.Scan(); line++ {
+		magnetURI := strings.TrimSpace(scanner.Text())
+		if magnetURI == "" || strings.HasPrefix(magnetURI, "#") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return added, err
+		}
+		if _, err := w.adder.AddMagnetContext(ctx, magnetURI, opts); err != nil {
+			if errors.Is(err, torrent.ErrNetworkSuspended) || ctx.Err() != nil {
+				return added, err
+			}
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+		added++
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if added == 0 && len(errs) == 0 {
+		errs = append(errs, errors.New("no magnet links found"))
+	}
+	return added, errors.Join(errs...)
+}
+
+func readLimited(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("file is larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// finish moves a processed file into subdir and, for a failure, writes a
+// note next to it. Names already taken there get a timestamp suffix.
+func (w *Watcher) finish(folder Folder, path, subdir string, cause error) {
+	target := filepath.Join(folder.Path, subdir, filepath.Base(path))
+	if _, err := os.Lstat(target); err == nil {
+		ext := filepath.Ext(target)
+		target = strings.TrimSuffix(target, ext) + "-" + w.now().UTC().Format("20060102T150405.000000000") + ext
+	}
+	if err := os.Rename(path, target); err != nil {
+		w.logger.Error("Watch folder file could not be moved", zap.String("file", filepath.Base(path)), zap.Error(err))
+		return
+	}
+	if cause == nil {
+		return
+	}
+	note := fmt.Sprintf("%s\n%s\n", w.now().UTC().Format(time.RFC3339), cause)
+	if err := os.WriteFile(target+".error.txt", []byte(note), 0600); err != nil {
+		w.logger.Warn("Watch folder error note not written", zap.String("file", filepath.Base(target)), zap.Error(err))
+	}
+}
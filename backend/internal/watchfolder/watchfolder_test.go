@@ -0,0 +1,153 @@
+package watchfolder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent"
+	"github.com/KFN002/B-2-Torrent/backend/internal/torrent/torrenttest"
+	"go.uber.org/zap"
+)
+
+func startWatcher(t *testing.T, adder torrent.Adder, folders ...Folder) *Watcher {
+	t.Helper()
+	w, err := New(folders, adder, 10*time.Millisecond, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Shutdown(context.Background()) })
+	return w
+}
+
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s did not appear", path)
+}
+
+func TestParseFolders(t *testing.T) {
+	folders, err := ParseFolders(" /watch/movies?category=movies&save=films , /watch/other,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folders) != 2 || folders[0] != (Folder{Path: "/watch/movies", Category: "movies", SavePath: "films"}) || folders[1] != (Folder{Path: "/watch/other"}) {
+		t.Fatalf("folders = %+v", folders)
+	}
+	for _, value := range []string{"watch/relative", "/watch?label=x", "/watch?category=%zz"} {
+		if _, err := ParseFolders(value); err == nil {
+			t.Errorf("ParseFolders(%q) accepted", value)
+		}
+	}
+}
+
+func TestImportsFilesWithFolderDefaults(t *testing.T) {
+	dir := t.TempDir()
+	adder := &torrenttest.Adder{}
+	startWatcher(t, adder, Folder{Path: dir, Category: "linux", SavePath: "isos"})
+
+	if err := os.WriteFile(filepath.Join(dir, "debian.torrent"), []byte("d4:infod4:name3:abcee"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	list := "# weekly\nmagnet:?xt=urn:btih:aaaa\n\nmagnet:?xt=urn:btih:bbbb\n"
+	if err := os.WriteFile(filepath.Join(dir, "links.magnet"), []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.md"), []byte("ignored"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForFile(t, filepath.Join(dir, DoneDir, "debian.torrent"))
+	waitForFile(t, filepath.Join(dir, DoneDir, "links.magnet"))
+
+	if files, magnets := adder.Files(), adder.Magnets(); len(files) != 1 || len(magnets) != 2 {
+		t.Fatalf("files = %d, magnets = %v", len(files), magnets)
+	}
+	for _, opts := range adder.Options() {
+		if opts != (torrent.AddOptions{Category: "linux", SavePath: "isos"}) {
+			t.Fatalf("options = %+v", opts)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.md")); err != nil {
+		t.Fatalf("unrelated file was moved: %v", err)
+	}
+}
+
+func TestFailedImportLeavesNote(t *testing.T) {
+	dir := t.TempDir()
+	startWatcher(t, &torrenttest.Adder{}, Folder{Path: dir})
+
+	list := "magnet:?xt=urn:btih:aaaa\nhttp://example.com/not-a-magnet\n"
+	if err := os.WriteFile(filepath.Join(dir, "links.txt"), []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	note := filepath.Join(dir, FailedDir, "links.txt.error.txt")
+	waitForFile(t, note)
+	data, err := os.ReadFile(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "line 2: invalid magnet URI") || strings.Contains(string(data), "example.com") {
+		t.Fatalf("note = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, FailedDir, "links.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSuspendedNetworkDefersImport(t *testing.T) {
+	dir := t.TempDir()
+	adder := &torrenttest.Adder{}
+	adder.Suspended.Store(true)
+	startWatcher(t, adder, Folder{Path: dir})
+
+	path := filepath.Join(dir, "links.magnet")
+	if err := os.WriteFile(path, []byte("magnet:?xt=urn:btih:aaaa\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file was moved while the network was suspended: %v", err)
+	}
+
+	adder.Suspended.Store(false)
+	waitForFile(t, filepath.Join(dir, DoneDir, "links.magnet"))
+}
+
+func TestShutdownStopsWaitingForMetadata(t *testing.T) {
+	dir := t.TempDir()
+	adder := &torrenttest.Adder{Waiting: make(chan struct{}, 1)}
+	w := startWatcher(t, adder, Folder{Path: dir})
+
+	path := filepath.Join(dir, "links.magnet")
+	if err := os.WriteFile(path, []byte("magnet:?xt=urn:btih:aaaa\nmagnet:?xt=urn:btih:bbbb\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-adder.Waiting:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the import did not start")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if len(adder.Waiting) != 0 {
+		t.Fatal("the next magnet link was added after shutdown")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("interrupted file was moved: %v", err)
+	}
+}
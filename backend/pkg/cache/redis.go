@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -79,6 +80,52 @@ func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
 	return nil
 }
 
+// tokenBucketScript refills and takes from a token bucket stored as a hash,
+// atomically. Token counts are returned as strings because Redis truncates
+// Lua numbers to integers.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// TakeToken takes one token from the bucket at key, which holds up to
+// capacity tokens and refills at perSecond tokens per second. It returns
+// whether a token was available and how many are left.
+func (c *RedisCache) TakeToken(ctx context.Context, key string, capacity, perSecond float64, now time.Time) (bool, float64, error) {
+	result, err := tokenBucketScript.Run(ctx, c.client, []string{key},
+		capacity, perSecond/1000, now.UnixMilli()).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected token bucket reply")
+	}
+	allowed, _ := result[0].(int64)
+	remaining, _ := result[1].(string)
+	tokens, err := strconv.ParseFloat(remaining, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("unexpected token bucket reply: %w", err)
+	}
+	return allowed == 1, tokens, nil
+}
+
 func (c *RedisCache) Close() error {
 	return c.client.Close()
 }
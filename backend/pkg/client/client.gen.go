@@ -0,0 +1,2091 @@
+// Code generated by apigen from the backend's OpenAPI document. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// APIToken is the APIToken schema.
+type APIToken struct {
+	CreatedAt  time.Time  `json:"createdAt"`
+	CreatedBy  int64      `json:"createdBy,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	ID         int64      `json:"id"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+}
+
+// AcknowledgeEventsRequest is the AcknowledgeEventsRequest schema.
+type AcknowledgeEventsRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+// AcknowledgeEventsResponse is the AcknowledgeEventsResponse schema.
+type AcknowledgeEventsResponse struct {
+	Acknowledged int `json:"acknowledged"`
+}
+
+// AddSearchResultRequest is the AddSearchResultRequest schema.
+type AddSearchResultRequest struct {
+	Category string `json:"category,omitempty"`
+	SavePath string `json:"savePath,omitempty"`
+}
+
+// AddTorrentRequest is the AddTorrentRequest schema.
+type AddTorrentRequest struct {
+	MagnetLink  string `json:"magnetLink"`
+	MagnetURI   string `json:"magnetUri"`
+	TorrentFile []byte `json:"torrentFile,omitempty"`
+}
+
+// AddTorrentResponse is the AddTorrentResponse schema.
+type AddTorrentResponse struct {
+	InfoHash string `json:"infoHash"`
+}
+
+// AnonymityMetrics is the AnonymityMetrics schema.
+type AnonymityMetrics struct {
+	Enabled bool   `json:"enabled"`
+	Score   int    `json:"score"`
+	Type    string `json:"type"`
+}
+
+// AuditActor is the AuditActor schema.
+type AuditActor struct {
+	Method string `json:"method"`
+	Name   string `json:"name"`
+}
+
+// AuditEntry is the AuditEntry schema.
+type AuditEntry struct {
+	Action  string            `json:"action"`
+	Actor   AuditActor        `json:"actor"`
+	At      time.Time         `json:"at"`
+	Details map[string]string `json:"details,omitempty"`
+	Hash    string            `json:"hash"`
+	Seq     int64             `json:"seq"`
+	Target  string            `json:"target,omitempty"`
+}
+
+// AuditLogResponse is the AuditLogResponse schema.
+type AuditLogResponse struct {
+	Blocked bool         `json:"blocked"`
+	Enabled bool         `json:"enabled"`
+	Entries []AuditEntry `json:"entries"`
+}
+
+// AuditStatus is the AuditStatus schema.
+type AuditStatus struct {
+	Blocked bool `json:"blocked"`
+	Enabled bool `json:"enabled"`
+}
+
+// AuditVerification is the AuditVerification schema.
+type AuditVerification struct {
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Entries  int64  `json:"entries"`
+	Head     string `json:"head"`
+	Reason   string `json:"reason,omitempty"`
+	Valid    bool   `json:"valid"`
+}
+
+// ChangePasswordRequest is the ChangePasswordRequest schema.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// CleanupRequest is the CleanupRequest schema.
+type CleanupRequest struct {
+	Confirm         string `json:"confirm"`
+	DeleteDownloads bool   `json:"deleteDownloads"`
+}
+
+// ClearFeedHistoryResponse is the ClearFeedHistoryResponse schema.
+type ClearFeedHistoryResponse struct {
+	Cleared int `json:"cleared"`
+}
+
+// ConnectivityStatus is the ConnectivityStatus schema.
+type ConnectivityStatus struct {
+	Exit          *ExitInfo  `json:"exit,omitempty"`
+	ExitCheckedAt *time.Time `json:"exitCheckedAt,omitempty"`
+	ExitError     string     `json:"exitError,omitempty"`
+	Tor           LinkStatus `json:"tor"`
+	VPN           LinkStatus `json:"vpn"`
+	VPNInterface  string     `json:"vpnInterface,omitempty"`
+}
+
+// CreateTokenRequest is the CreateTokenRequest schema.
+type CreateTokenRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+}
+
+// CreateUserRequest is the CreateUserRequest schema.
+type CreateUserRequest struct {
+	Password string `json:"password"`
+	Role     string `json:"role"`
+	Username string `json:"username"`
+}
+
+// DNSLeakTestResponse is the DNSLeakTestResponse schema.
+type DNSLeakTestResponse struct {
+	Checked         bool   `json:"checked"`
+	DNSLeakDetected *bool  `json:"dnsLeakDetected"`
+	Message         string `json:"message"`
+}
+
+// DuressResponse is the DuressResponse schema.
+type DuressResponse struct {
+	Configured bool  `json:"configured"`
+	WipeData   *bool `json:"wipeData,omitempty"`
+}
+
+// EgressRecord is the EgressRecord schema.
+type EgressRecord struct {
+	Allowed     bool      `json:"allowed"`
+	Caller      string    `json:"caller"`
+	Destination string    `json:"destination"`
+	Network     string    `json:"network"`
+	Route       string    `json:"route"`
+	Time        time.Time `json:"time"`
+}
+
+// EgressStats is the EgressStats schema.
+type EgressStats struct {
+	Direct       int64          `json:"direct"`
+	Proxied      int64          `json:"proxied"`
+	Recent       []EgressRecord `json:"recent"`
+	Refused      int64          `json:"refused"`
+	RequireProxy bool           `json:"requireProxy"`
+	Total        int64          `json:"total"`
+}
+
+// EncryptRequest is the EncryptRequest schema.
+type EncryptRequest struct {
+	Algorithm     string `json:"algorithm"`
+	FilePath      string `json:"filePath"`
+	HashAlgorithm string `json:"hashAlgorithm"`
+	KeyDerivation string `json:"keyDerivation"`
+	Password      string `json:"password"`
+	UseKeyring    bool   `json:"useKeyring"`
+}
+
+// EncryptedRangeRequest is the EncryptedRangeRequest schema.
+type EncryptedRangeRequest struct {
+	FilePath string `json:"filePath"`
+	Length   int64  `json:"length"`
+	Offset   int64  `json:"offset"`
+	Password string `json:"password"`
+}
+
+// EncryptionMetrics is the EncryptionMetrics schema.
+type EncryptionMetrics struct {
+	Enabled bool   `json:"enabled"`
+	Level   string `json:"level"`
+	Score   int    `json:"score"`
+}
+
+// EncryptionStatus is the EncryptionStatus schema.
+type EncryptionStatus struct {
+	Encrypted  int    `json:"encrypted"`
+	Mode       string `json:"mode"`
+	Obfuscated int    `json:"obfuscated"`
+	Peers      int    `json:"peers"`
+	Plaintext  int    `json:"plaintext"`
+	Rejected   int64  `json:"rejected"`
+}
+
+// ErrorResponse is the ErrorResponse schema.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// EventRetention is the EventRetention schema.
+type EventRetention struct {
+	Days      int `json:"days"`
+	MaxEvents int `json:"maxEvents"`
+}
+
+// ExitInfo is the ExitInfo schema.
+type ExitInfo struct {
+	IP    string `json:"ip"`
+	IsTor *bool  `json:"isTor,omitempty"`
+}
+
+// ExportSettingsRequest is the ExportSettingsRequest schema.
+type ExportSettingsRequest struct {
+	Passphrase string `json:"passphrase,omitempty"`
+	Secrets    string `json:"secrets,omitempty"`
+}
+
+// FavoriteRequest is the FavoriteRequest schema.
+type FavoriteRequest struct {
+	Favorite bool `json:"favorite"`
+}
+
+// Feed is the Feed schema.
+type Feed struct {
+	Category        string      `json:"category,omitempty"`
+	Disabled        bool        `json:"disabled,omitempty"`
+	ID              string      `json:"id"`
+	IntervalMinutes int         `json:"intervalMinutes"`
+	Name            string      `json:"name"`
+	Rules           []FeedRule  `json:"rules"`
+	SavePath        string      `json:"savePath,omitempty"`
+	Status          *FeedStatus `json:"status,omitempty"`
+	URL             string      `json:"url"`
+}
+
+// FeedHistoryItem is the FeedHistoryItem schema.
+type FeedHistoryItem struct {
+	At       time.Time `json:"at"`
+	Error    string    `json:"error,omitempty"`
+	FeedID   string    `json:"feedId"`
+	ID       int64     `json:"id"`
+	InfoHash string    `json:"infoHash,omitempty"`
+	RuleID   string    `json:"ruleId"`
+	Status   string    `json:"status"`
+	Title    string    `json:"title"`
+}
+
+// FeedHistoryResponse is the FeedHistoryResponse schema.
+type FeedHistoryResponse struct {
+	Enabled bool              `json:"enabled"`
+	Items   []FeedHistoryItem `json:"items"`
+}
+
+// FeedRule is the FeedRule schema.
+type FeedRule struct {
+	Category string `json:"category,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	Exclude  string `json:"exclude,omitempty"`
+	ID       string `json:"id"`
+	Include  string `json:"include"`
+	Name     string `json:"name"`
+	SavePath string `json:"savePath,omitempty"`
+}
+
+// FeedStatus is the FeedStatus schema.
+type FeedStatus struct {
+	Added       int        `json:"added"`
+	Items       int        `json:"items"`
+	LastChecked *time.Time `json:"lastChecked,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// FilePriorityRequest is the FilePriorityRequest schema.
+type FilePriorityRequest struct {
+	Files    []int  `json:"files"`
+	Priority string `json:"priority"`
+}
+
+// FileStatus is the FileStatus schema.
+type FileStatus struct {
+	EncryptedPath string `json:"encryptedPath,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	Status        string `json:"status"`
+}
+
+// HealthResponse is the HealthResponse schema.
+type HealthResponse struct {
+	Status string `json:"status"`
+	Tor    string `json:"tor"`
+}
+
+// IPStatus is the IPStatus schema.
+type IPStatus struct {
+	ConnectionType     string `json:"connectionType"`
+	DHTInvisible       bool   `json:"dhtInvisible"`
+	DNSObfuscated      bool   `json:"dnsObfuscated"`
+	DNSProtected       bool   `json:"dnsProtected"`
+	IPObfuscated       bool   `json:"ipObfuscated"`
+	SharingDisabled    bool   `json:"sharingDisabled"`
+	TorEnabled         bool   `json:"torEnabled"`
+	UDPTrackersBlocked bool   `json:"udpTrackersBlocked"`
+	VPNType            string `json:"vpnType"`
+}
+
+// ImportSettingsRequest is the ImportSettingsRequest schema.
+type ImportSettingsRequest struct {
+	EncryptedSecrets string                     `json:"encryptedSecrets,omitempty"`
+	ExportedAt       time.Time                  `json:"exportedAt"`
+	Passphrase       string                     `json:"passphrase,omitempty"`
+	Settings         map[string]json.RawMessage `json:"settings"`
+	Version          int                        `json:"version"`
+}
+
+// Indexer is the Indexer schema.
+type Indexer struct {
+	APIKey     string `json:"apiKey,omitempty"`
+	Categories []int  `json:"categories,omitempty"`
+	Disabled   bool   `json:"disabled,omitempty"`
+	HasAPIKey  bool   `json:"hasApiKey"`
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+}
+
+// InitialConfigRequest is the InitialConfigRequest schema.
+type InitialConfigRequest struct {
+	DownloadPath     string `json:"downloadPath"`
+	EnableEncryption bool   `json:"enableEncryption"`
+	EnableNoLogs     bool   `json:"enableNoLogs"`
+	EnableTor        bool   `json:"enableTor"`
+	EnableVPN        bool   `json:"enableVPN"`
+	MaxConnections   int    `json:"maxConnections"`
+	PortNumber       int    `json:"portNumber"`
+	VPNProtocol      string `json:"vpnProtocol"`
+}
+
+// Job is the Job schema.
+type Job struct {
+	CreatedAt     time.Time       `json:"createdAt"`
+	Error         string          `json:"error,omitempty"`
+	FinishedAt    *time.Time      `json:"finishedAt,omitempty"`
+	ID            string          `json:"id"`
+	Kind          string          `json:"kind"`
+	ProgressBytes int64           `json:"progressBytes"`
+	Result        json.RawMessage `json:"result,omitempty"`
+	StartedAt     *time.Time      `json:"startedAt,omitempty"`
+	Status        string          `json:"status"`
+	TotalBytes    int64           `json:"totalBytes"`
+}
+
+// KeyringChangePassphraseRequest is the KeyringChangePassphraseRequest schema.
+type KeyringChangePassphraseRequest struct {
+	CurrentPassphrase string `json:"currentPassphrase"`
+	NewPassphrase     string `json:"newPassphrase"`
+}
+
+// KeyringDuressRequest is the KeyringDuressRequest schema.
+type KeyringDuressRequest struct {
+	Passphrase string `json:"passphrase"`
+	WipeData   bool   `json:"wipeData"`
+}
+
+// KeyringKeyInfo is the KeyringKeyInfo schema.
+type KeyringKeyInfo struct {
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	ID        string    `json:"id"`
+}
+
+// KeyringPassphraseRequest is the KeyringPassphraseRequest schema.
+type KeyringPassphraseRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+// KeyringStatus is the KeyringStatus schema.
+type KeyringStatus struct {
+	ActiveKeyID string           `json:"activeKeyId,omitempty"`
+	Initialized bool             `json:"initialized"`
+	Keys        []KeyringKeyInfo `json:"keys"`
+	Unlocked    bool             `json:"unlocked"`
+}
+
+// KillSwitchRequest is the KillSwitchRequest schema.
+type KillSwitchRequest struct {
+	Mode   string `json:"mode"`
+	Reason string `json:"reason"`
+}
+
+// KillSwitchResponse is the KillSwitchResponse schema.
+type KillSwitchResponse struct {
+	KillSwitch       KillSwitchStatus `json:"killSwitch"`
+	Message          string           `json:"message,omitempty"`
+	NetworkSuspended bool             `json:"networkSuspended"`
+}
+
+// KillSwitchStatus is the KillSwitchStatus schema.
+type KillSwitchStatus struct {
+	Enabled       bool       `json:"enabled"`
+	MaxViolations int        `json:"maxViolations"`
+	Mode          string     `json:"mode"`
+	Reason        string     `json:"reason,omitempty"`
+	Triggered     bool       `json:"triggered"`
+	TriggeredAt   *time.Time `json:"triggeredAt,omitempty"`
+	TriggeredMode string     `json:"triggeredMode,omitempty"`
+	Violations    int        `json:"violations"`
+}
+
+// LeakMetrics is the LeakMetrics schema.
+type LeakMetrics struct {
+	Active        bool `json:"active"`
+	LeaksDetected *int `json:"leaksDetected"`
+	Score         int  `json:"score"`
+}
+
+// LinkStatus is the LinkStatus schema.
+type LinkStatus struct {
+	LastChecked time.Time `json:"lastChecked,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	Since       time.Time `json:"since,omitempty"`
+	State       string    `json:"state"`
+}
+
+// LoginRequest is the LoginRequest schema.
+type LoginRequest struct {
+	Password string `json:"password"`
+	Username string `json:"username"`
+}
+
+// MessageResponse is the MessageResponse schema.
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// NetworkStats is the NetworkStats schema.
+type NetworkStats struct {
+	ActiveProxies     int     `json:"activeProxies"`
+	AverageLatency    float64 `json:"averageLatency"`
+	ConnectionQuality string  `json:"connectionQuality"`
+	TotalBytesIn      int64   `json:"totalBytesIn"`
+	TotalBytesOut     int64   `json:"totalBytesOut"`
+	TotalConnections  int     `json:"totalConnections"`
+}
+
+// ObfuscationMetrics is the ObfuscationMetrics schema.
+type ObfuscationMetrics struct {
+	Enabled bool `json:"enabled"`
+	Score   int  `json:"score"`
+}
+
+// PanicRequest is the PanicRequest schema.
+type PanicRequest struct {
+	WipeData bool `json:"wipeData"`
+}
+
+// PanicResponse is the PanicResponse schema.
+type PanicResponse struct {
+	Steps    []PanicStep `json:"steps"`
+	WipeData bool        `json:"wipeData"`
+}
+
+// PanicStep is the PanicStep schema.
+type PanicStep struct {
+	Error string `json:"error,omitempty"`
+	Name  string `json:"name"`
+}
+
+// PeerInfo is the PeerInfo schema.
+type PeerInfo struct {
+	Address  string `json:"address"`
+	Client   string `json:"client,omitempty"`
+	Crypto   string `json:"crypto"`
+	Network  string `json:"network"`
+	Outgoing bool   `json:"outgoing"`
+	Source   string `json:"source"`
+}
+
+// ProxyConnection is the ProxyConnection schema.
+type ProxyConnection struct {
+	Address   string  `json:"address"`
+	Bandwidth float64 `json:"bandwidth"`
+	Country   string  `json:"country"`
+	ID        string  `json:"id"`
+	Latency   int     `json:"latency"`
+	Port      int     `json:"port"`
+	Status    string  `json:"status"`
+	Uptime    int     `json:"uptime"`
+}
+
+// RateLimitsRequest is the RateLimitsRequest schema.
+type RateLimitsRequest struct {
+	DownloadLimit int `json:"downloadLimit"`
+	UploadLimit   int `json:"uploadLimit"`
+}
+
+// SearchIndexerStatus is the SearchIndexerStatus schema.
+type SearchIndexerStatus struct {
+	Error   string `json:"error,omitempty"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Results int    `json:"results"`
+}
+
+// SearchResponse is the SearchResponse schema.
+type SearchResponse struct {
+	Indexers []SearchIndexerStatus `json:"indexers"`
+	Results  []SearchResult        `json:"results"`
+}
+
+// SearchResult is the SearchResult schema.
+type SearchResult struct {
+	ID          string     `json:"id"`
+	Indexers    []string   `json:"indexers"`
+	InfoHash    string     `json:"infoHash,omitempty"`
+	Leechers    int        `json:"leechers"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+	Seeders     int        `json:"seeders"`
+	Size        int64      `json:"size"`
+	Title       string     `json:"title"`
+}
+
+// SecureDeleteRequest is the SecureDeleteRequest schema.
+type SecureDeleteRequest struct {
+	Confirm   string   `json:"confirm"`
+	DryRun    bool     `json:"dryRun"`
+	FilePaths []string `json:"filePaths"`
+	Passes    int      `json:"passes"`
+	Recursive bool     `json:"recursive"`
+}
+
+// SecureDeleteResponse is the SecureDeleteResponse schema.
+type SecureDeleteResponse struct {
+	DeletedFiles []string     `json:"deletedFiles"`
+	DryRun       bool         `json:"dryRun"`
+	Errors       []string     `json:"errors"`
+	Message      string       `json:"message"`
+	Passes       int          `json:"passes"`
+	Results      []WipeResult `json:"results"`
+}
+
+// SecurityConfig is the SecurityConfig schema.
+type SecurityConfig struct {
+	AntiFingerprint       bool   `json:"antiFingerprint"`
+	AutoWipeOnExit        bool   `json:"autoWipeOnExit"`
+	BlockMaliciousPeers   bool   `json:"blockMaliciousPeers"`
+	DataEncryptionEnabled bool   `json:"dataEncryptionEnabled"`
+	DHTInvisibility       bool   `json:"dhtInvisibility"`
+	DNSObfuscationEnabled bool   `json:"dnsObfuscationEnabled"`
+	DNSProtectionEnabled  bool   `json:"dnsProtectionEnabled"`
+	EncryptionLevel       string `json:"encryptionLevel"`
+	EncryptionMode        string `json:"encryptionMode"`
+	ForceEncryption       bool   `json:"forceEncryption"`
+	IPObfuscationEnabled  bool   `json:"ipObfuscationEnabled"`
+	KillSwitchEnabled     bool   `json:"killSwitchEnabled"`
+	KillSwitchMode        string `json:"killSwitchMode"`
+	MACRandomization      bool   `json:"macRandomization"`
+	MemoryEncryption      bool   `json:"memoryEncryption"`
+	MinEncryptionProtocol string `json:"minEncryptionProtocol"`
+	NoLogsMode            bool   `json:"noLogsMode"`
+	ObfuscateTraffic      bool   `json:"obfuscateTraffic"`
+	OutlineKey            string `json:"outlineKey"`
+	PeerVerification      bool   `json:"peerVerification"`
+	RejectPlaintext       bool   `json:"rejectPlaintext"`
+	SandboxMode           bool   `json:"sandboxMode"`
+	SecureDelete          bool   `json:"secureDelete"`
+	SharingDisabled       bool   `json:"sharingDisabled"`
+	StealthMode           bool   `json:"stealthMode"`
+	TorEnabled            bool   `json:"torEnabled"`
+	VLESSKey              string `json:"vlessKey"`
+	VPNType               string `json:"vpnType"`
+}
+
+// SecurityEvent is the SecurityEvent schema.
+type SecurityEvent struct {
+	Acknowledged   bool       `json:"acknowledged"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+	Details        string     `json:"details,omitempty"`
+	ID             int64      `json:"id"`
+	Message        string     `json:"message"`
+	Severity       string     `json:"severity"`
+	Timestamp      time.Time  `json:"timestamp"`
+	Type           string     `json:"type"`
+}
+
+// SecurityMetrics is the SecurityMetrics schema.
+type SecurityMetrics struct {
+	ActiveThreats        int                `json:"activeThreats"`
+	Anonymity            AnonymityMetrics   `json:"anonymity"`
+	BlockedPeers         int                `json:"blockedPeers"`
+	Encryption           EncryptionMetrics  `json:"encryption"`
+	LeakProtection       LeakMetrics        `json:"leakProtection"`
+	OverallScore         int                `json:"overallScore"`
+	ProtectedConnections int                `json:"protectedConnections"`
+	TrafficObfuscation   ObfuscationMetrics `json:"trafficObfuscation"`
+}
+
+// SecurityStatus is the SecurityStatus schema.
+type SecurityStatus struct {
+	AntiFingerprintActive      bool   `json:"antiFingerprintActive"`
+	AutoWipeOnExitActive       bool   `json:"autoWipeOnExitActive"`
+	BlockMaliciousPeersActive  bool   `json:"blockMaliciousPeersActive"`
+	ConnectionType             string `json:"connectionType"`
+	DataEncryptionActive       bool   `json:"dataEncryptionActive"`
+	DHTInvisible               bool   `json:"dhtInvisible"`
+	DirectPeerDialingDisabled  bool   `json:"directPeerDialingDisabled"`
+	DNSObfuscationActive       bool   `json:"dnsObfuscationActive"`
+	DNSProtectionActive        bool   `json:"dnsProtectionActive"`
+	DownloadSpeed              int64  `json:"downloadSpeed"`
+	ForceEncryptionActive      bool   `json:"forceEncryptionActive"`
+	InboundConnectionsDisabled bool   `json:"inboundConnectionsDisabled"`
+	IPObfuscationActive        bool   `json:"ipObfuscationActive"`
+	KillSwitchActive           bool   `json:"killSwitchActive"`
+	KillSwitchMode             string `json:"killSwitchMode"`
+	KillSwitchTriggered        bool   `json:"killSwitchTriggered"`
+	LastCheck                  string `json:"lastCheck"`
+	LeaksDetected              *int   `json:"leaksDetected"`
+	MACRandomizationActive     bool   `json:"macRandomizationActive"`
+	MemoryEncryptionActive     bool   `json:"memoryEncryptionActive"`
+	NetworkSuspended           bool   `json:"networkSuspended"`
+	NoLogsMode                 bool   `json:"noLogsMode"`
+	PeerExchangeDisabled       bool   `json:"peerExchangeDisabled"`
+	PeerVerificationActive     bool   `json:"peerVerificationActive"`
+	ProxyAvailable             bool   `json:"proxyAvailable"`
+	ProxyRequired              bool   `json:"proxyRequired"`
+	RejectPlaintextActive      bool   `json:"rejectPlaintextActive"`
+	SandboxModeActive          bool   `json:"sandboxModeActive"`
+	SecureDeleteActive         bool   `json:"secureDeleteActive"`
+	SecurityScore              int    `json:"securityScore"`
+	SharingDisabled            bool   `json:"sharingDisabled"`
+	StealthModeActive          bool   `json:"stealthModeActive"`
+	TrafficObfuscationActive   bool   `json:"trafficObfuscationActive"`
+	UDPTrackersBlocked         bool   `json:"udpTrackersBlocked"`
+	UploadSpeed                int64  `json:"uploadSpeed"`
+}
+
+// SessionResponse is the SessionResponse schema.
+type SessionResponse struct {
+	Accounts  bool   `json:"accounts"`
+	CSRFToken string `json:"csrfToken,omitempty"`
+	Method    string `json:"method"`
+	User      User   `json:"user"`
+}
+
+// SettingValues is the SettingValues schema.
+type SettingValues struct {
+	Locked []string                   `json:"locked,omitempty"`
+	Values map[string]json.RawMessage `json:"values"`
+}
+
+// SettingsExport is the SettingsExport schema.
+type SettingsExport struct {
+	EncryptedSecrets string                     `json:"encryptedSecrets,omitempty"`
+	ExportedAt       time.Time                  `json:"exportedAt"`
+	Settings         map[string]json.RawMessage `json:"settings"`
+	Version          int                        `json:"version"`
+}
+
+// SettingsImportResult is the SettingsImportResult schema.
+type SettingsImportResult struct {
+	Imported        []string `json:"imported"`
+	RestartRequired []string `json:"restartRequired,omitempty"`
+	Skipped         []string `json:"skipped,omitempty"`
+}
+
+// SettingsSchema is the SettingsSchema schema.
+type SettingsSchema struct {
+	Schema               string                            `json:"$schema"`
+	AdditionalProperties bool                              `json:"additionalProperties"`
+	Properties           map[string]SettingsSchemaProperty `json:"properties"`
+	Title                string                            `json:"title"`
+	Type                 string                            `json:"type"`
+}
+
+// SettingsSchemaProperty is the SettingsSchemaProperty schema.
+type SettingsSchemaProperty struct {
+	Default     json.RawMessage `json:"default"`
+	Description string          `json:"description"`
+	Enum        []string        `json:"enum,omitempty"`
+	MaxLength   int             `json:"maxLength,omitempty"`
+	Maximum     *int64          `json:"maximum,omitempty"`
+	Minimum     *int64          `json:"minimum,omitempty"`
+	ReadOnly    bool            `json:"readOnly,omitempty"`
+	Type        string          `json:"type,omitempty"`
+	ManagedBy   string          `json:"x-managed-by,omitempty"`
+	Restart     bool            `json:"x-restart-required,omitempty"`
+	Security    bool            `json:"x-security,omitempty"`
+	Sensitive   bool            `json:"x-sensitive,omitempty"`
+}
+
+// SubmitJobRequest is the SubmitJobRequest schema.
+type SubmitJobRequest struct {
+	Kind   string          `json:"kind"`
+	Params json.RawMessage `json:"params"`
+}
+
+// SupportedAlgorithms is the SupportedAlgorithms schema.
+type SupportedAlgorithms struct {
+	Encryption    []string `json:"encryption"`
+	Hashing       []string `json:"hashing"`
+	KeyDerivation []string `json:"keyDerivation"`
+}
+
+// TokenSecretResponse is the TokenSecretResponse schema.
+type TokenSecretResponse struct {
+	Prefix string    `json:"prefix"`
+	Secret string    `json:"secret"`
+	Token  *APIToken `json:"token,omitempty"`
+}
+
+// TorBootstrapStatus is the TorBootstrapStatus schema.
+type TorBootstrapStatus struct {
+	Progress int    `json:"progress"`
+	Summary  string `json:"summary"`
+	Tag      string `json:"tag"`
+	Warning  string `json:"warning,omitempty"`
+}
+
+// TorCircuit is the TorCircuit schema.
+type TorCircuit struct {
+	BuildFlags []string   `json:"buildFlags,omitempty"`
+	ID         string     `json:"id"`
+	Path       []TorRelay `json:"path"`
+	Purpose    string     `json:"purpose,omitempty"`
+	Status     string     `json:"status"`
+}
+
+// TorControlStatus is the TorControlStatus schema.
+type TorControlStatus struct {
+	Address          string              `json:"address,omitempty"`
+	Bootstrap        *TorBootstrapStatus `json:"bootstrap,omitempty"`
+	Circuits         []TorCircuit        `json:"circuits"`
+	Configured       bool                `json:"configured"`
+	Error            string              `json:"error,omitempty"`
+	LastNewNym       *time.Time          `json:"lastNewNym,omitempty"`
+	RotationInterval string              `json:"rotationInterval,omitempty"`
+	StreamIsolation  bool                `json:"streamIsolation"`
+}
+
+// TorRelay is the TorRelay schema.
+type TorRelay struct {
+	Fingerprint string `json:"fingerprint"`
+	Nickname    string `json:"nickname,omitempty"`
+}
+
+// TorrentEvent is the TorrentEvent schema.
+type TorrentEvent struct {
+	Message     string `json:"message"`
+	Timestamp   string `json:"timestamp"`
+	TorrentName string `json:"torrentName"`
+	Type        string `json:"type"`
+}
+
+// TorrentFile is the TorrentFile schema.
+type TorrentFile struct {
+	Downloaded int64   `json:"downloaded"`
+	Index      int     `json:"index"`
+	Path       string  `json:"path"`
+	Priority   string  `json:"priority"`
+	Progress   float64 `json:"progress"`
+	Size       int64   `json:"size"`
+}
+
+// TorrentInfo is the TorrentInfo schema.
+type TorrentInfo struct {
+	Category      string       `json:"category,omitempty"`
+	DownloadLimit int          `json:"downloadLimit,omitempty"`
+	DownloadRate  int64        `json:"downloadRate"`
+	DownloadSpeed int64        `json:"downloadSpeed"`
+	Downloaded    int64        `json:"downloaded"`
+	ETA           int64        `json:"eta"`
+	Favorite      bool         `json:"favorite,omitempty"`
+	Files         []FileStatus `json:"files,omitempty"`
+	ID            string       `json:"id"`
+	InfoHash      string       `json:"infoHash"`
+	Name          string       `json:"name"`
+	Peers         int          `json:"peers"`
+	Progress      float64      `json:"progress"`
+	Ratio         float64      `json:"ratio"`
+	Seeders       int          `json:"seeders"`
+	Size          int64        `json:"size"`
+	Status        string       `json:"status"`
+	TotalSize     int64        `json:"totalSize"`
+	UploadLimit   int          `json:"uploadLimit,omitempty"`
+	UploadRate    int64        `json:"uploadRate"`
+	UploadSpeed   int64        `json:"uploadSpeed"`
+	Uploaded      int64        `json:"uploaded"`
+}
+
+// TorrentPeersResponse is the TorrentPeersResponse schema.
+type TorrentPeersResponse struct {
+	EncryptionMode string     `json:"encryptionMode"`
+	Peers          []PeerInfo `json:"peers"`
+}
+
+// TorrentScheduleRequest is the TorrentScheduleRequest schema.
+type TorrentScheduleRequest struct {
+	DeleteWhenComplete bool   `json:"deleteWhenComplete"`
+	Enabled            bool   `json:"enabled"`
+	PauseWhenComplete  bool   `json:"pauseWhenComplete"`
+	StartDate          string `json:"startDate"`
+	StartTime          string `json:"startTime"`
+}
+
+// UpdateAuditLogRequest is the UpdateAuditLogRequest schema.
+type UpdateAuditLogRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// UpdateSettingValuesResponse is the UpdateSettingValuesResponse schema.
+type UpdateSettingValuesResponse struct {
+	RestartRequired []string `json:"restartRequired,omitempty"`
+	Updated         []string `json:"updated"`
+}
+
+// UpdateSettingsRequest is the UpdateSettingsRequest schema.
+type UpdateSettingsRequest struct {
+	AutoEncryptDownloads string `json:"autoEncryptDownloads"`
+	DownloadPath         string `json:"downloadPath"`
+	EnableTor            string `json:"enableTor"`
+	MaxConnections       string `json:"maxConnections"`
+	MaxDownloadRate      string `json:"maxDownloadRate"`
+	MaxUploadRate        string `json:"maxUploadRate"`
+}
+
+// UpdateUserRequest is the UpdateUserRequest schema.
+type UpdateUserRequest struct {
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// User is the User schema.
+type User struct {
+	CreatedAt time.Time `json:"createdAt"`
+	ID        int64     `json:"id"`
+	Role      string    `json:"role"`
+	Username  string    `json:"username"`
+}
+
+// WipeResult is the WipeResult schema.
+type WipeResult struct {
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+}
+
+// Login checks credentials and starts a session.
+//
+// POST /api/auth/login
+func (c *Client) Login(ctx context.Context, body LoginRequest) (*SessionResponse, error) {
+	var result SessionResponse
+	if _, err := c.do(ctx, "POST", "/api/auth/login", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Logout ends the caller's session.
+//
+// POST /api/auth/logout
+func (c *Client) Logout(ctx context.Context) error {
+	_, err := c.do(ctx, "POST", "/api/auth/logout", nil, nil, nil)
+	return err
+}
+
+// ChangePassword changes the caller's password.
+//
+// POST /api/auth/password
+func (c *Client) ChangePassword(ctx context.Context, body ChangePasswordRequest) error {
+	_, err := c.do(ctx, "POST", "/api/auth/password", nil, body, nil)
+	return err
+}
+
+// GetSession describes the caller.
+//
+// GET /api/auth/session
+func (c *Client) GetSession(ctx context.Context) (*SessionResponse, error) {
+	var result SessionResponse
+	if _, err := c.do(ctx, "GET", "/api/auth/session", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetupAccounts creates the first admin account.
+//
+// POST /api/auth/setup
+func (c *Client) SetupAccounts(ctx context.Context, body LoginRequest) (*User, error) {
+	var result User
+	if _, err := c.do(ctx, "POST", "/api/auth/setup", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CleanupData queues a job deleting all local application state.
+//
+// POST /api/cleanup
+func (c *Client) CleanupData(ctx context.Context, body CleanupRequest) (*Job, error) {
+	var result Job
+	if _, err := c.do(ctx, "POST", "/api/cleanup", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ApplyInitialConfig applies the first-run configuration.
+//
+// POST /api/config/initial
+func (c *Client) ApplyInitialConfig(ctx context.Context, body InitialConfigRequest) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/config/initial", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSupportedAlgorithms lists the supported algorithms.
+//
+// GET /api/encryption/algorithms
+func (c *Client) GetSupportedAlgorithms(ctx context.Context) (*SupportedAlgorithms, error) {
+	var result SupportedAlgorithms
+	if _, err := c.do(ctx, "GET", "/api/encryption/algorithms", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DecryptFile queues a job decrypting a file.
+//
+// POST /api/encryption/decrypt
+func (c *Client) DecryptFile(ctx context.Context, body EncryptRequest) (*Job, error) {
+	var result Job
+	if _, err := c.do(ctx, "POST", "/api/encryption/decrypt", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// EncryptFile queues a job encrypting a file.
+//
+// POST /api/encryption/encrypt
+func (c *Client) EncryptFile(ctx context.Context, body EncryptRequest) (*Job, error) {
+	var result Job
+	if _, err := c.do(ctx, "POST", "/api/encryption/encrypt", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ReadEncryptedRange decrypts and returns a byte range of an encrypted file.
+//
+// POST /api/encryption/read
+func (c *Client) ReadEncryptedRange(ctx context.Context, body EncryptedRangeRequest) (io.ReadCloser, error) {
+	return c.stream(ctx, "POST", "/api/encryption/read", nil, body)
+}
+
+// ListFeeds lists followed RSS and Atom feeds with their rules.
+//
+// GET /api/feeds
+func (c *Client) ListFeeds(ctx context.Context) ([]Feed, error) {
+	var result []Feed
+	_, err := c.do(ctx, "GET", "/api/feeds", nil, nil, &result)
+	return result, err
+}
+
+// CreateFeed follows a feed and fetches it.
+//
+// POST /api/feeds
+func (c *Client) CreateFeed(ctx context.Context, body Feed) (*Feed, error) {
+	var result Feed
+	if _, err := c.do(ctx, "POST", "/api/feeds", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ClearFeedHistoryParams holds the optional query parameters; zero values are not sent.
+type ClearFeedHistoryParams struct {
+	// Only items of this feed.
+	Feed string
+}
+
+func (p *ClearFeedHistoryParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	setString(q, "feed", p.Feed)
+	return q
+}
+
+// ClearFeedHistory forgets matched items so they can be added again.
+//
+// DELETE /api/feeds/history
+func (c *Client) ClearFeedHistory(ctx context.Context, params *ClearFeedHistoryParams) (*ClearFeedHistoryResponse, error) {
+	var result ClearFeedHistoryResponse
+	if _, err := c.do(ctx, "DELETE", "/api/feeds/history", params.values(), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetFeedHistoryParams holds the optional query parameters; zero values are not sent.
+type GetFeedHistoryParams struct {
+	// Only items of this feed.
+	Feed string
+	// Maximum number of items, up to 1000.
+	Limit int
+}
+
+func (p *GetFeedHistoryParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	setString(q, "feed", p.Feed)
+	setInt(q, "limit", p.Limit)
+	return q
+}
+
+// GetFeedHistory lists items feed rules matched, newest first.
+//
+// GET /api/feeds/history
+func (c *Client) GetFeedHistory(ctx context.Context, params *GetFeedHistoryParams) (*FeedHistoryResponse, error) {
+	var result FeedHistoryResponse
+	if _, err := c.do(ctx, "GET", "/api/feeds/history", params.values(), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteFeed stops following a feed.
+//
+// DELETE /api/feeds/{id}
+func (c *Client) DeleteFeed(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "DELETE", "/api/feeds/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
+
+// GetFeed returns one feed.
+//
+// GET /api/feeds/{id}
+func (c *Client) GetFeed(ctx context.Context, id string) (*Feed, error) {
+	var result Feed
+	if _, err := c.do(ctx, "GET", "/api/feeds/"+url.PathEscape(id), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateFeed replaces a feed's settings, keeping its rules.
+//
+// PUT /api/feeds/{id}
+func (c *Client) UpdateFeed(ctx context.Context, id string, body Feed) (*Feed, error) {
+	var result Feed
+	if _, err := c.do(ctx, "PUT", "/api/feeds/"+url.PathEscape(id), nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RefreshFeed queues a fetch of a feed ahead of its schedule.
+//
+// POST /api/feeds/{id}/refresh
+func (c *Client) RefreshFeed(ctx context.Context, id string) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/feeds/"+url.PathEscape(id)+"/refresh", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AddFeedRule adds a rule to a feed.
+//
+// POST /api/feeds/{id}/rules
+func (c *Client) AddFeedRule(ctx context.Context, id string, body FeedRule) (*FeedRule, error) {
+	var result FeedRule
+	if _, err := c.do(ctx, "POST", "/api/feeds/"+url.PathEscape(id)+"/rules", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteFeedRule removes a rule from a feed.
+//
+// DELETE /api/feeds/{id}/rules/{ruleId}
+func (c *Client) DeleteFeedRule(ctx context.Context, id string, ruleId string) error {
+	_, err := c.do(ctx, "DELETE", "/api/feeds/"+url.PathEscape(id)+"/rules/"+url.PathEscape(ruleId), nil, nil, nil)
+	return err
+}
+
+// UpdateFeedRule replaces a rule of a feed.
+//
+// PUT /api/feeds/{id}/rules/{ruleId}
+func (c *Client) UpdateFeedRule(ctx context.Context, id string, ruleId string, body FeedRule) (*FeedRule, error) {
+	var result FeedRule
+	if _, err := c.do(ctx, "PUT", "/api/feeds/"+url.PathEscape(id)+"/rules/"+url.PathEscape(ruleId), nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// HealthCheck reports whether the backend is up and Tor works.
+//
+// GET /api/health
+func (c *Client) HealthCheck(ctx context.Context) (*HealthResponse, error) {
+	var result HealthResponse
+	if _, err := c.do(ctx, "GET", "/api/health", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListJobs lists jobs.
+//
+// GET /api/jobs
+func (c *Client) ListJobs(ctx context.Context) ([]Job, error) {
+	var result []Job
+	_, err := c.do(ctx, "GET", "/api/jobs", nil, nil, &result)
+	return result, err
+}
+
+// SubmitJob queues a job of any registered kind.
+//
+// POST /api/jobs
+func (c *Client) SubmitJob(ctx context.Context, body SubmitJobRequest) (*Job, error) {
+	var result Job
+	if _, err := c.do(ctx, "POST", "/api/jobs", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CancelJob cancels a queued or running job.
+//
+// DELETE /api/jobs/{id}
+func (c *Client) CancelJob(ctx context.Context, id string) (*Job, error) {
+	var result Job
+	if _, err := c.do(ctx, "DELETE", "/api/jobs/"+url.PathEscape(id), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetJob returns one job.
+//
+// GET /api/jobs/{id}
+func (c *Client) GetJob(ctx context.Context, id string) (*Job, error) {
+	var result Job
+	if _, err := c.do(ctx, "GET", "/api/jobs/"+url.PathEscape(id), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetKeyringStatus reports whether the keyring exists and is unlocked.
+//
+// GET /api/keyring
+func (c *Client) GetKeyringStatus(ctx context.Context) (*KeyringStatus, error) {
+	var result KeyringStatus
+	if _, err := c.do(ctx, "GET", "/api/keyring", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ClearDuressPassphrase removes the duress passphrase.
+//
+// DELETE /api/keyring/duress
+func (c *Client) ClearDuressPassphrase(ctx context.Context) (*DuressResponse, error) {
+	var result DuressResponse
+	if _, err := c.do(ctx, "DELETE", "/api/keyring/duress", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetDuressPassphrase sets the duress passphrase.
+//
+// POST /api/keyring/duress
+func (c *Client) SetDuressPassphrase(ctx context.Context, body KeyringDuressRequest) (*DuressResponse, error) {
+	var result DuressResponse
+	if _, err := c.do(ctx, "POST", "/api/keyring/duress", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// InitializeKeyring creates the keyring.
+//
+// POST /api/keyring/init
+func (c *Client) InitializeKeyring(ctx context.Context, body KeyringPassphraseRequest) (*KeyringStatus, error) {
+	var result KeyringStatus
+	if _, err := c.do(ctx, "POST", "/api/keyring/init", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// LockKeyring locks the keyring.
+//
+// POST /api/keyring/lock
+func (c *Client) LockKeyring(ctx context.Context) (*KeyringStatus, error) {
+	var result KeyringStatus
+	if _, err := c.do(ctx, "POST", "/api/keyring/lock", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ChangeKeyringPassphrase changes the keyring passphrase.
+//
+// POST /api/keyring/passphrase
+func (c *Client) ChangeKeyringPassphrase(ctx context.Context, body KeyringChangePassphraseRequest) (*KeyringStatus, error) {
+	var result KeyringStatus
+	if _, err := c.do(ctx, "POST", "/api/keyring/passphrase", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RotateKeyring adds a new master key for new data.
+//
+// POST /api/keyring/rotate
+func (c *Client) RotateKeyring(ctx context.Context) (*KeyringStatus, error) {
+	var result KeyringStatus
+	if _, err := c.do(ctx, "POST", "/api/keyring/rotate", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UnlockKeyring unlocks the keyring.
+//
+// POST /api/keyring/unlock
+func (c *Client) UnlockKeyring(ctx context.Context, body KeyringPassphraseRequest) (*KeyringStatus, error) {
+	var result KeyringStatus
+	if _, err := c.do(ctx, "POST", "/api/keyring/unlock", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetNetworkConnections lists the configured proxies.
+//
+// GET /api/network/connections
+func (c *Client) GetNetworkConnections(ctx context.Context) ([]ProxyConnection, error) {
+	var result []ProxyConnection
+	_, err := c.do(ctx, "GET", "/api/network/connections", nil, nil, &result)
+	return result, err
+}
+
+// GetEgressStats reports what the egress guard allowed and refused.
+//
+// GET /api/network/egress
+func (c *Client) GetEgressStats(ctx context.Context) (*EgressStats, error) {
+	var result EgressStats
+	if _, err := c.do(ctx, "GET", "/api/network/egress", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetNetworkStats summarises proxy connections.
+//
+// GET /api/network/stats
+func (c *Client) GetNetworkStats(ctx context.Context) (*NetworkStats, error) {
+	var result NetworkStats
+	if _, err := c.do(ctx, "GET", "/api/network/stats", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTorConnections lists Tor proxies and live circuits.
+//
+// GET /api/network/tor
+func (c *Client) GetTorConnections(ctx context.Context) ([]ProxyConnection, error) {
+	var result []ProxyConnection
+	_, err := c.do(ctx, "GET", "/api/network/tor", nil, nil, &result)
+	return result, err
+}
+
+// RotateTorCircuits asks Tor for new circuits.
+//
+// POST /api/network/tor/newnym
+func (c *Client) RotateTorCircuits(ctx context.Context) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/network/tor/newnym", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTorControlStatus reports bootstrap progress and circuits from the Tor control port.
+//
+// GET /api/network/tor/status
+func (c *Client) GetTorControlStatus(ctx context.Context) (*TorControlStatus, error) {
+	var result TorControlStatus
+	if _, err := c.do(ctx, "GET", "/api/network/tor/status", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetOpenAPI returns this OpenAPI document.
+//
+// GET /api/openapi.json
+func (c *Client) GetOpenAPI(ctx context.Context) (io.ReadCloser, error) {
+	return c.stream(ctx, "GET", "/api/openapi.json", nil, nil)
+}
+
+// Panic stops all activity and optionally wipes local data.
+//
+// POST /api/panic
+func (c *Client) Panic(ctx context.Context, body PanicRequest) (*PanicResponse, error) {
+	var result PanicResponse
+	if _, err := c.do(ctx, "POST", "/api/panic", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SearchParams holds the optional query parameters; zero values are not sent.
+type SearchParams struct {
+	// What to search for.
+	Q string
+	// Comma-separated Torznab categories, instead of each indexer's.
+	Cat string
+	// Comma-separated IDs of the indexers to search; all enabled ones by default.
+	Indexers string
+	// seeders (default) or size.
+	Sort string
+	// desc (default) or asc.
+	Order string
+	// Maximum number of results, up to 500.
+	Limit int
+}
+
+func (p *SearchParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	setString(q, "q", p.Q)
+	setString(q, "cat", p.Cat)
+	setString(q, "indexers", p.Indexers)
+	setString(q, "sort", p.Sort)
+	setString(q, "order", p.Order)
+	setInt(q, "limit", p.Limit)
+	return q
+}
+
+// Search searches the configured indexers, merging results by info hash.
+//
+// GET /api/search
+func (c *Client) Search(ctx context.Context, params *SearchParams) (*SearchResponse, error) {
+	var result SearchResponse
+	if _, err := c.do(ctx, "GET", "/api/search", params.values(), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListIndexers lists Torznab indexers, without their API keys.
+//
+// GET /api/search/indexers
+func (c *Client) ListIndexers(ctx context.Context) ([]Indexer, error) {
+	var result []Indexer
+	_, err := c.do(ctx, "GET", "/api/search/indexers", nil, nil, &result)
+	return result, err
+}
+
+// CreateIndexer adds a Torznab indexer.
+//
+// POST /api/search/indexers
+func (c *Client) CreateIndexer(ctx context.Context, body Indexer) (*Indexer, error) {
+	var result Indexer
+	if _, err := c.do(ctx, "POST", "/api/search/indexers", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteIndexer removes an indexer.
+//
+// DELETE /api/search/indexers/{id}
+func (c *Client) DeleteIndexer(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "DELETE", "/api/search/indexers/"+url.PathEscape(id), nil, nil, nil)
+	return err
+}
+
+// GetIndexer returns one indexer, without its API key.
+//
+// GET /api/search/indexers/{id}
+func (c *Client) GetIndexer(ctx context.Context, id string) (*Indexer, error) {
+	var result Indexer
+	if _, err := c.do(ctx, "GET", "/api/search/indexers/"+url.PathEscape(id), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateIndexer replaces an indexer's settings, keeping its API key unless one is given.
+//
+// PUT /api/search/indexers/{id}
+func (c *Client) UpdateIndexer(ctx context.Context, id string, body Indexer) (*Indexer, error) {
+	var result Indexer
+	if _, err := c.do(ctx, "PUT", "/api/search/indexers/"+url.PathEscape(id), nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AddSearchResult adds a result of a recent search.
+//
+// POST /api/search/results/{id}/add
+func (c *Client) AddSearchResult(ctx context.Context, id string, body AddSearchResultRequest) (*AddTorrentResponse, error) {
+	var result AddTorrentResponse
+	if _, err := c.do(ctx, "POST", "/api/search/results/"+url.PathEscape(id)+"/add", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetAuditLogParams holds the optional query parameters; zero values are not sent.
+type GetAuditLogParams struct {
+	// Only entries with a lower sequence number, for paging.
+	Before int64
+	// Maximum number of entries.
+	Limit int
+}
+
+func (p *GetAuditLogParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	setInt64(q, "before", p.Before)
+	setInt(q, "limit", p.Limit)
+	return q
+}
+
+// GetAuditLog returns audit log entries, newest first.
+//
+// GET /api/security/audit
+func (c *Client) GetAuditLog(ctx context.Context, params *GetAuditLogParams) (*AuditLogResponse, error) {
+	var result AuditLogResponse
+	if _, err := c.do(ctx, "GET", "/api/security/audit", params.values(), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateAuditLog enables or disables the audit log.
+//
+// PUT /api/security/audit
+func (c *Client) UpdateAuditLog(ctx context.Context, body UpdateAuditLogRequest) (*AuditStatus, error) {
+	var result AuditStatus
+	if _, err := c.do(ctx, "PUT", "/api/security/audit", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// VerifyAuditLog checks the audit log hash chain.
+//
+// GET /api/security/audit/verify
+func (c *Client) VerifyAuditLog(ctx context.Context) (*AuditVerification, error) {
+	var result AuditVerification
+	if _, err := c.do(ctx, "GET", "/api/security/audit/verify", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSecurityConfig returns the security settings.
+//
+// GET /api/security/config
+func (c *Client) GetSecurityConfig(ctx context.Context) (*SecurityConfig, error) {
+	var result SecurityConfig
+	if _, err := c.do(ctx, "GET", "/api/security/config", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetConnectivityStatus reports Tor, VPN and exit checks.
+//
+// GET /api/security/connectivity
+func (c *Client) GetConnectivityStatus(ctx context.Context) (*ConnectivityStatus, error) {
+	var result ConnectivityStatus
+	if _, err := c.do(ctx, "GET", "/api/security/connectivity", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TestDNSLeak reports the DNS leak test outcome.
+//
+// GET /api/security/dns-test
+func (c *Client) TestDNSLeak(ctx context.Context) (*DNSLeakTestResponse, error) {
+	var result DNSLeakTestResponse
+	if _, err := c.do(ctx, "GET", "/api/security/dns-test", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetEncryptionStatus reports peer protocol encryption.
+//
+// GET /api/security/encryption
+func (c *Client) GetEncryptionStatus(ctx context.Context) (*EncryptionStatus, error) {
+	var result EncryptionStatus
+	if _, err := c.do(ctx, "GET", "/api/security/encryption", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSecurityEventsParams holds the optional query parameters; zero values are not sent.
+type GetSecurityEventsParams struct {
+	// Comma-separated severities to include.
+	Severity string
+	// Comma-separated event types to include.
+	Type string
+	// Only events at or after this time.
+	Since time.Time
+	// Only events before this time.
+	Until time.Time
+	// Only events not yet acknowledged.
+	Unacknowledged bool
+	// Only events with a lower ID, for paging.
+	Before int64
+	// Maximum number of events.
+	Limit int
+}
+
+func (p *GetSecurityEventsParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	setString(q, "severity", p.Severity)
+	setString(q, "type", p.Type)
+	setTime(q, "since", p.Since)
+	setTime(q, "until", p.Until)
+	setBool(q, "unacknowledged", p.Unacknowledged)
+	setInt64(q, "before", p.Before)
+	setInt(q, "limit", p.Limit)
+	return q
+}
+
+// GetSecurityEvents lists stored security events, newest first.
+//
+// GET /api/security/events
+func (c *Client) GetSecurityEvents(ctx context.Context, params *GetSecurityEventsParams) ([]SecurityEvent, error) {
+	var result []SecurityEvent
+	_, err := c.do(ctx, "GET", "/api/security/events", params.values(), nil, &result)
+	return result, err
+}
+
+// AcknowledgeSecurityEvents acknowledges security events.
+//
+// POST /api/security/events/ack
+func (c *Client) AcknowledgeSecurityEvents(ctx context.Context, body AcknowledgeEventsRequest) (*AcknowledgeEventsResponse, error) {
+	var result AcknowledgeEventsResponse
+	if _, err := c.do(ctx, "POST", "/api/security/events/ack", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetEventRetention returns how long security events are kept.
+//
+// GET /api/security/events/retention
+func (c *Client) GetEventRetention(ctx context.Context) (*EventRetention, error) {
+	var result EventRetention
+	if _, err := c.do(ctx, "GET", "/api/security/events/retention", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateEventRetention changes how long security events are kept.
+//
+// PUT /api/security/events/retention
+func (c *Client) UpdateEventRetention(ctx context.Context, body EventRetention) (*EventRetention, error) {
+	var result EventRetention
+	if _, err := c.do(ctx, "PUT", "/api/security/events/retention", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// StreamSecurityEventsParams holds the optional query parameters; zero values are not sent.
+type StreamSecurityEventsParams struct {
+	// Comma-separated severities to include.
+	Severity string
+	// Comma-separated event types to include.
+	Type string
+}
+
+func (p *StreamSecurityEventsParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	setString(q, "severity", p.Severity)
+	setString(q, "type", p.Type)
+	return q
+}
+
+// StreamSecurityEvents streams new security events as server-sent events.
+//
+// GET /api/security/events/stream
+func (c *Client) StreamSecurityEvents(ctx context.Context, params *StreamSecurityEventsParams) (io.ReadCloser, error) {
+	return c.stream(ctx, "GET", "/api/security/events/stream", params.values(), nil)
+}
+
+// GetIPStatus summarises how the IP address and DNS are protected.
+//
+// GET /api/security/ip
+func (c *Client) GetIPStatus(ctx context.Context) (*IPStatus, error) {
+	var result IPStatus
+	if _, err := c.do(ctx, "GET", "/api/security/ip", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetKillSwitchStatus reports whether the kill switch is armed or has fired.
+//
+// GET /api/security/killswitch
+func (c *Client) GetKillSwitchStatus(ctx context.Context) (*KillSwitchResponse, error) {
+	var result KillSwitchResponse
+	if _, err := c.do(ctx, "GET", "/api/security/killswitch", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TriggerKillSwitch fires the kill switch.
+//
+// POST /api/security/killswitch
+func (c *Client) TriggerKillSwitch(ctx context.Context, body KillSwitchRequest) (*KillSwitchResponse, error) {
+	var result KillSwitchResponse
+	if _, err := c.do(ctx, "POST", "/api/security/killswitch", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ResetKillSwitch re-arms the kill switch and resumes the network.
+//
+// POST /api/security/killswitch/reset
+func (c *Client) ResetKillSwitch(ctx context.Context) (*KillSwitchResponse, error) {
+	var result KillSwitchResponse
+	if _, err := c.do(ctx, "POST", "/api/security/killswitch/reset", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSecurityMetrics returns the security score and what it is based on.
+//
+// GET /api/security/metrics
+func (c *Client) GetSecurityMetrics(ctx context.Context) (*SecurityMetrics, error) {
+	var result SecurityMetrics
+	if _, err := c.do(ctx, "GET", "/api/security/metrics", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SecureDeleteFileResult holds the response of whichever status the server sent.
+type SecureDeleteFileResult struct {
+	OK       *SecureDeleteResponse
+	Accepted *Job
+}
+
+// SecureDeleteFile queues a secure-delete job, or validates the paths of a dry run.
+//
+// POST /api/security/secure-delete
+func (c *Client) SecureDeleteFile(ctx context.Context, body SecureDeleteRequest) (*SecureDeleteFileResult, error) {
+	var raw json.RawMessage
+	status, err := c.do(ctx, "POST", "/api/security/secure-delete", nil, body, &raw)
+	if err != nil {
+		return nil, err
+	}
+	result := &SecureDeleteFileResult{}
+	switch status {
+	case 200:
+		result.OK = new(SecureDeleteResponse)
+		err = json.Unmarshal(raw, result.OK)
+	case 202:
+		result.Accepted = new(Job)
+		err = json.Unmarshal(raw, result.Accepted)
+	}
+	return result, err
+}
+
+// UpdateSecuritySettings updates the security settings.
+//
+// PUT /api/security/settings
+func (c *Client) UpdateSecuritySettings(ctx context.Context, body SecurityConfig) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "PUT", "/api/security/settings", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSecurityStatus summarises the privacy protections in force.
+//
+// GET /api/security/status
+func (c *Client) GetSecurityStatus(ctx context.Context) (*SecurityStatus, error) {
+	var result SecurityStatus
+	if _, err := c.do(ctx, "GET", "/api/security/status", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSettings returns the legacy settings as strings.
+//
+// GET /api/settings
+func (c *Client) GetSettings(ctx context.Context) (map[string]string, error) {
+	var result map[string]string
+	_, err := c.do(ctx, "GET", "/api/settings", nil, nil, &result)
+	return result, err
+}
+
+// UpdateSettings updates the legacy settings that are not empty.
+//
+// PUT /api/settings
+func (c *Client) UpdateSettings(ctx context.Context, body UpdateSettingsRequest) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "PUT", "/api/settings", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ExportSettings exports every setting, with secrets excluded, included or encrypted.
+//
+// POST /api/settings/export
+func (c *Client) ExportSettings(ctx context.Context, body ExportSettingsRequest) (*SettingsExport, error) {
+	var result SettingsExport
+	if _, err := c.do(ctx, "POST", "/api/settings/export", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ImportSettings imports a settings export, all or none.
+//
+// POST /api/settings/import
+func (c *Client) ImportSettings(ctx context.Context, body ImportSettingsRequest) (*SettingsImportResult, error) {
+	var result SettingsImportResult
+	if _, err := c.do(ctx, "POST", "/api/settings/import", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetGlobalLimits sets the global rate limits.
+//
+// POST /api/settings/limits
+func (c *Client) SetGlobalLimits(ctx context.Context, body RateLimitsRequest) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/settings/limits", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSettingsSchema describes every setting as a JSON Schema.
+//
+// GET /api/settings/schema
+func (c *Client) GetSettingsSchema(ctx context.Context) (*SettingsSchema, error) {
+	var result SettingsSchema
+	if _, err := c.do(ctx, "GET", "/api/settings/schema", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetSettingValues returns the typed value of every setting.
+//
+// GET /api/settings/values
+func (c *Client) GetSettingValues(ctx context.Context) (*SettingValues, error) {
+	var result SettingValues
+	if _, err := c.do(ctx, "GET", "/api/settings/values", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UpdateSettingValues validates and stores the given settings, all or none.
+//
+// PUT /api/settings/values
+func (c *Client) UpdateSettingValues(ctx context.Context, body map[string]json.RawMessage) (*UpdateSettingValuesResponse, error) {
+	var result UpdateSettingValuesResponse
+	if _, err := c.do(ctx, "PUT", "/api/settings/values", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListTokens lists API tokens.
+//
+// GET /api/tokens
+func (c *Client) ListTokens(ctx context.Context) ([]APIToken, error) {
+	var result []APIToken
+	_, err := c.do(ctx, "GET", "/api/tokens", nil, nil, &result)
+	return result, err
+}
+
+// CreateToken creates an API token and returns its secret once.
+//
+// POST /api/tokens
+func (c *Client) CreateToken(ctx context.Context, body CreateTokenRequest) (*TokenSecretResponse, error) {
+	var result TokenSecretResponse
+	if _, err := c.do(ctx, "POST", "/api/tokens", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTokenScopes lists the scopes a token can be granted.
+//
+// GET /api/tokens/scopes
+func (c *Client) GetTokenScopes(ctx context.Context) ([]string, error) {
+	var result []string
+	_, err := c.do(ctx, "GET", "/api/tokens/scopes", nil, nil, &result)
+	return result, err
+}
+
+// RevokeToken revokes an API token.
+//
+// DELETE /api/tokens/{id}
+func (c *Client) RevokeToken(ctx context.Context, id int64) error {
+	_, err := c.do(ctx, "DELETE", "/api/tokens/"+strconv.FormatInt(id, 10), nil, nil, nil)
+	return err
+}
+
+// RotateToken replaces a token's secret.
+//
+// POST /api/tokens/{id}/rotate
+func (c *Client) RotateToken(ctx context.Context, id int64) (*TokenSecretResponse, error) {
+	var result TokenSecretResponse
+	if _, err := c.do(ctx, "POST", "/api/tokens/"+strconv.FormatInt(id, 10)+"/rotate", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTorrents lists every torrent.
+//
+// GET /api/torrents
+func (c *Client) GetTorrents(ctx context.Context) ([]*TorrentInfo, error) {
+	var result []*TorrentInfo
+	_, err := c.do(ctx, "GET", "/api/torrents", nil, nil, &result)
+	return result, err
+}
+
+// AddTorrent adds a torrent from a magnet link or a .torrent file.
+//
+// POST /api/torrents
+func (c *Client) AddTorrent(ctx context.Context, body AddTorrentRequest) (*AddTorrentResponse, error) {
+	var result AddTorrentResponse
+	if _, err := c.do(ctx, "POST", "/api/torrents", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTorrentEvents stops seeding completed torrents when configured and reports it.
+//
+// GET /api/torrents/events
+func (c *Client) GetTorrentEvents(ctx context.Context) ([]TorrentEvent, error) {
+	var result []TorrentEvent
+	_, err := c.do(ctx, "GET", "/api/torrents/events", nil, nil, &result)
+	return result, err
+}
+
+// DeleteTorrentParams holds the optional query parameters; zero values are not sent.
+type DeleteTorrentParams struct {
+	// Securely delete the torrent's data.
+	Wipe bool
+	// Overwrite passes for the wipe, from 3 to 35.
+	Passes int
+}
+
+func (p *DeleteTorrentParams) values() url.Values {
+	q := url.Values{}
+	if p == nil {
+		return q
+	}
+	setBool(q, "wipe", p.Wipe)
+	setInt(q, "passes", p.Passes)
+	return q
+}
+
+// DeleteTorrentResult holds the response of whichever status the server sent.
+type DeleteTorrentResult struct {
+	OK       *MessageResponse
+	Accepted *Job
+}
+
+// DeleteTorrent removes a torrent and, with wipe, queues a job wiping its data.
+//
+// DELETE /api/torrents/{infoHash}
+func (c *Client) DeleteTorrent(ctx context.Context, infoHash string, params *DeleteTorrentParams) (*DeleteTorrentResult, error) {
+	var raw json.RawMessage
+	status, err := c.do(ctx, "DELETE", "/api/torrents/"+url.PathEscape(infoHash), params.values(), nil, &raw)
+	if err != nil {
+		return nil, err
+	}
+	result := &DeleteTorrentResult{}
+	switch status {
+	case 200:
+		result.OK = new(MessageResponse)
+		err = json.Unmarshal(raw, result.OK)
+	case 202:
+		result.Accepted = new(Job)
+		err = json.Unmarshal(raw, result.Accepted)
+	}
+	return result, err
+}
+
+// GetTorrent returns one torrent.
+//
+// GET /api/torrents/{infoHash}
+func (c *Client) GetTorrent(ctx context.Context, infoHash string) (*TorrentInfo, error) {
+	var result TorrentInfo
+	if _, err := c.do(ctx, "GET", "/api/torrents/"+url.PathEscape(infoHash), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ToggleFavorite marks or unmarks a torrent as a favorite.
+//
+// POST /api/torrents/{infoHash}/favorite
+func (c *Client) ToggleFavorite(ctx context.Context, infoHash string, body FavoriteRequest) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/torrents/"+url.PathEscape(infoHash)+"/favorite", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTorrentFiles lists a torrent's files with their progress and priority.
+//
+// GET /api/torrents/{infoHash}/files
+func (c *Client) GetTorrentFiles(ctx context.Context, infoHash string) ([]TorrentFile, error) {
+	var result []TorrentFile
+	_, err := c.do(ctx, "GET", "/api/torrents/"+url.PathEscape(infoHash)+"/files", nil, nil, &result)
+	return result, err
+}
+
+// SetFilePriority sets the priority of some of a torrent's files.
+//
+// POST /api/torrents/{infoHash}/files/priority
+func (c *Client) SetFilePriority(ctx context.Context, infoHash string, body FilePriorityRequest) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/torrents/"+url.PathEscape(infoHash)+"/files/priority", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTorrentLimits sets a torrent's rate limits.
+//
+// POST /api/torrents/{infoHash}/limits
+func (c *Client) SetTorrentLimits(ctx context.Context, infoHash string, body RateLimitsRequest) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/torrents/"+url.PathEscape(infoHash)+"/limits", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PauseTorrent pauses a torrent.
+//
+// POST /api/torrents/{infoHash}/pause
+func (c *Client) PauseTorrent(ctx context.Context, infoHash string) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/torrents/"+url.PathEscape(infoHash)+"/pause", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTorrentPeers lists a torrent's peers and their encryption.
+//
+// GET /api/torrents/{infoHash}/peers
+func (c *Client) GetTorrentPeers(ctx context.Context, infoHash string) (*TorrentPeersResponse, error) {
+	var result TorrentPeersResponse
+	if _, err := c.do(ctx, "GET", "/api/torrents/"+url.PathEscape(infoHash)+"/peers", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ResumeTorrent resumes a paused torrent.
+//
+// POST /api/torrents/{infoHash}/resume
+func (c *Client) ResumeTorrent(ctx context.Context, infoHash string) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/torrents/"+url.PathEscape(infoHash)+"/resume", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTorrentSchedule stores a torrent's schedule.
+//
+// POST /api/torrents/{infoHash}/schedule
+func (c *Client) SetTorrentSchedule(ctx context.Context, infoHash string, body TorrentScheduleRequest) (*MessageResponse, error) {
+	var result MessageResponse
+	if _, err := c.do(ctx, "POST", "/api/torrents/"+url.PathEscape(infoHash)+"/schedule", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListUsers lists user accounts.
+//
+// GET /api/users
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	var result []User
+	_, err := c.do(ctx, "GET", "/api/users", nil, nil, &result)
+	return result, err
+}
+
+// CreateUser creates a user account.
+//
+// POST /api/users
+func (c *Client) CreateUser(ctx context.Context, body CreateUserRequest) (*User, error) {
+	var result User
+	if _, err := c.do(ctx, "POST", "/api/users", nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteUser deletes a user account.
+//
+// DELETE /api/users/{id}
+func (c *Client) DeleteUser(ctx context.Context, id int64) error {
+	_, err := c.do(ctx, "DELETE", "/api/users/"+strconv.FormatInt(id, 10), nil, nil, nil)
+	return err
+}
+
+// UpdateUser changes a user's role or password.
+//
+// PUT /api/users/{id}
+func (c *Client) UpdateUser(ctx context.Context, id int64, body UpdateUserRequest) (*User, error) {
+	var result User
+	if _, err := c.do(ctx, "PUT", "/api/users/"+strconv.FormatInt(id, 10), nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetMetrics returns metrics in the Prometheus text format.
+//
+// GET /metrics
+func (c *Client) GetMetrics(ctx context.Context) (io.ReadCloser, error) {
+	return c.stream(ctx, "GET", "/metrics", nil, nil)
+}
@@ -0,0 +1,307 @@
+// Package client is a typed Go client for the B-2-Torrent backend API.
+//
+// The types and one method per endpoint are generated from the backend's
+// OpenAPI document into client.gen.go; run go generate in this directory
+// after changing a route or a request or response type. This file holds
+// the transport they share: authentication, retries and error decoding.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cookie and header names used by session authentication.
+const (
+	csrfCookie = "b2_csrf"
+	csrfHeader = "X-CSRF-Token"
+)
+
+const (
+	defaultRetries = 2
+	defaultBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+	// maxErrorBody bounds how much of an error response is read.
+	maxErrorBody = 64 << 10
+)
+
+// Client calls the backend API. It is safe for concurrent use.
+//
+// Without a token the client authenticates with the session cookies Login
+// sets, and echoes the CSRF cookie on requests that change state.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+	retries    int
+	backoff    time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken authenticates every request with an API token, or with
+// B2_API_TOKEN, sent as a bearer token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient sends requests through httpClient. Give it a cookie jar to
+// use Login; the default client has one.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times a failed request is retried and the delay
+// before the first retry, which doubles on every further attempt. Zero
+// retries disables retrying.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// New returns a client for the backend at baseURL, e.g.
+// "http://localhost:8080".
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+
+	c := &Client{baseURL: parsed, retries: defaultRetries, backoff: defaultBackoff}
+	for _, option := range options {
+		option(c)
+	}
+	if c.httpClient == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		// No overall timeout: event streams stay open. Callers bound
+		// requests with their context.
+		c.httpClient = &http.Client{Jar: jar}
+	}
+	return c, nil
+}
+
+// Error is a response with a status code outside 2xx.
+type Error struct {
+	StatusCode int
+	// Message is the error field of the JSON body, or the body itself when
+	// it is not JSON.
+	Message string
+	// RetryAfter is the delay the server asked for, if any.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("b2 api: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("b2 api: %d %s", e.StatusCode, e.Message)
+}
+
+// IsStatus reports whether err is an *Error with the given status code.
+func IsStatus(err error, status int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// do sends a request and decodes a successful response into out, unless
+// out is nil or the response has no body. It returns the status code.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) (int, error) {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return resp.StatusCode, fmt.Errorf("decode %s %s response: %w", method, path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// stream sends a request and returns the successful response body unread.
+// The caller must close it.
+func (c *Client) stream(ctx context.Context, method, path string, query url.Values, body interface{}) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// send performs the request, retrying when it is safe to, and turns
+// non-2xx responses into *Error. Rate-limited requests are retried for any
+// method because the server turned them away before handling them; network
+// errors and 502, 503 and 504 only for idempotent methods.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("encode %s %s request: %w", method, path, err)
+		}
+	}
+	target := *c.baseURL
+	target.Path += path
+	if len(query) > 0 {
+		target.RawQuery = query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := c.newRequest(ctx, method, &target, payload)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.httpClient.Do(req)
+
+		var apiErr *Error
+		retry := false
+		switch {
+		case err != nil:
+			retry = idempotent(method) && ctx.Err() == nil
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			apiErr = decodeError(resp)
+			switch resp.StatusCode {
+			case http.StatusTooManyRequests:
+				retry = true
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				retry = idempotent(method)
+			}
+		default:
+			return resp, nil
+		}
+
+		if !retry || attempt >= c.retries {
+			if apiErr != nil {
+				return nil, apiErr
+			}
+			return nil, err
+		}
+		delay := c.backoff << attempt
+		if apiErr != nil && apiErr.RetryAfter > 0 {
+			delay = apiErr.RetryAfter
+		}
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, target *url.URL, payload []byte) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if method != http.MethodGet && method != http.MethodHead && c.httpClient.Jar != nil {
+		for _, cookie := range c.httpClient.Jar.Cookies(target) {
+			if cookie.Name == csrfCookie {
+				req.Header.Set(csrfHeader, cookie.Value)
+			}
+		}
+	}
+	return req, nil
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// decodeError reads an error response. The API answers with
+// {"error": "..."}, but middleware may answer in plain text.
+func decodeError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		apiErr.Message = body.Error
+	} else {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return apiErr
+}
+
+// Query parameter setters used by the generated code. Zero values are left
+// out so the server applies its defaults.
+
+func setString(q url.Values, name, value string) {
+	if value != "" {
+		q.Set(name, value)
+	}
+}
+
+func setInt(q url.Values, name string, value int) {
+	if value != 0 {
+		q.Set(name, strconv.Itoa(value))
+	}
+}
+
+func setInt64(q url.Values, name string, value int64) {
+	if value != 0 {
+		q.Set(name, strconv.FormatInt(value, 10))
+	}
+}
+
+func setBool(q url.Values, name string, value bool) {
+	if value {
+		q.Set(name, "true")
+	}
+}
+
+func setTime(q url.Values, name string, value time.Time) {
+	if !value.IsZero() {
+		q.Set(name, value.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KFN002/B-2-Torrent/backend/internal/api"
+	"github.com/KFN002/B-2-Torrent/backend/internal/openapi"
+)
+
+func TestGeneratedFilesAreCurrent(t *testing.T) {
+	doc := api.OpenAPI()
+	spec, err := doc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := openapi.GenerateClient(doc, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string][]byte{"../../../docs/openapi.json": spec, "client.gen.go": source} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date; run go generate ./pkg/client", path)
+		}
+	}
+}
+
+func newTestClient(t *testing.T, handler http.HandlerFunc, options ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c, err := New(server.URL, append([]Option{WithRetries(2, time.Millisecond)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientSendsTokenAndDecodesResponse(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer b2t_secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if r.URL.Path != "/api/torrents/abcd" || r.URL.Query().Get("wipe") != "true" || r.URL.Query().Has("passes") {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(Job{ID: "job-1", Kind: "secure-delete"})
+	}, WithToken("b2t_secret"))
+
+	result, err := c.DeleteTorrent(context.Background(), "abcd", &DeleteTorrentParams{Wipe: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OK != nil || result.Accepted == nil || result.Accepted.ID != "job-1" {
+		t.Fatalf("result = %+v", result)
+	}
+}
+
+func TestClientRetriesIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(HealthResponse{Status: "healthy"})
+	})
+
+	health, err := c.HealthCheck(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "healthy" || calls.Load() != 3 {
+		t.Fatalf("status %q after %d calls", health.Status, calls.Load())
+	}
+}
+
+func TestClientRetriesRateLimitedPosts(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	err := c.Logout(context.Background())
+	if !IsStatus(err, http.StatusServiceUnavailable) {
+		t.Fatalf("err = %v, want the 503 that POST must not retry", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("made %d calls, want 2", calls.Load())
+	}
+}
+
+func TestClientDecodesErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/settings" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "Torrent not found"})
+	})
+
+	_, err := c.GetTorrent(context.Background(), "abcd")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "Torrent not found" {
+		t.Fatalf("err = %#v", err)
+	}
+	_, err = c.GetSettings(context.Background())
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "Unauthorized" {
+		t.Fatalf("err = %#v", err)
+	}
+}
+
+func TestClientEchoesCSRFCookieAfterLogin(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/auth/login":
+			http.SetCookie(w, &http.Cookie{Name: "b2_session", Value: "session", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: csrfCookie, Value: "csrf-token", Path: "/"})
+			json.NewEncoder(w).Encode(SessionResponse{Method: "session"})
+		case "/api/torrents/abcd/pause":
+			if got := r.Header.Get(csrfHeader); got != "csrf-token" {
+				t.Errorf("%s = %q", csrfHeader, got)
+			}
+			json.NewEncoder(w).Encode(MessageResponse{Message: "Torrent paused"})
+		}
+	})
+
+	if _, err := c.Login(context.Background(), LoginRequest{Username: "admin", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	response, err := c.PauseTorrent(context.Background(), "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Message != "Torrent paused" {
+		t.Fatalf("message = %q", response.Message)
+	}
+}
@@ -0,0 +1,3 @@
+package client
+
+//go:generate go run ../../cmd/apigen -spec ../../../docs/openapi.json -client client.gen.go
@@ -10,6 +10,7 @@ import { Badge } from "@/components/ui/badge"
 import { Switch } from "@/components/ui/switch"
 import { Progress } from "@/components/ui/progress"
 import { useToast } from "@/hooks/use-toast"
+import { waitForJob } from "@/lib/jobs"
 import {
   Shield,
   Trash2,
@@ -157,10 +158,15 @@ export default function DeviceSecurityPage() {
         }),
       })
 
-      const data = await response.json()
+      const job = await response.json()
       if (!response.ok) {
-        throw new Error(data.error || "Secure deletion failed")
+        throw new Error(job.error || "Secure deletion failed")
       }
+      const data = await waitForJob<{ errors?: string[]; message?: string }>(API_URL, job, (current) => {
+        if (current.totalBytes > 0) {
+          setWipeProgress(Math.max(35, Math.round((current.progressBytes / current.totalBytes) * 100)))
+        }
+      })
 
       setSecureDeleteErrors(data.errors || [])
       setSelectedFiles([])
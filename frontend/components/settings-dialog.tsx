@@ -45,6 +45,7 @@ import { useToast } from "@/hooks/use-toast"
 import { Tabs, TabsContent, TabsList, TabsTrigger } from "@/components/ui/tabs"
 import { Card, CardContent } from "@/components/ui/card"
 import { useLanguage } from "@/lib/i18n"
+import { waitForJob } from "@/lib/jobs"
 import { Progress } from "@/components/ui/progress"
 import { Badge } from "@/components/ui/badge"
 
@@ -415,6 +416,7 @@ export function SettingsDialog({ open, onOpenChange }: SettingsDialogProps) {
       })
 
       if (response.ok) {
+        await waitForJob("/api", await response.json())
         toast({
           title: t("dataDeleted") || "Data deleted",
           description: deleteDownloads ? "Local state and downloaded files were deleted." : "Local settings, active state, and temporary files were deleted. Downloads were preserved.",
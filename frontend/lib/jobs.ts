@@ -0,0 +1,39 @@
+export type JobStatus = "queued" | "running" | "succeeded" | "failed" | "cancelled"
+
+export interface Job<T = unknown> {
+  id: string
+  kind: string
+  status: JobStatus
+  progressBytes: number
+  totalBytes: number
+  result?: T
+  error?: string
+}
+
+const finished: JobStatus[] = ["succeeded", "failed", "cancelled"]
+
+// waitForJob polls a background job until it reaches a terminal state and
+// returns its result, throwing if the job failed or was cancelled.
+export async function waitForJob<T>(
+  apiUrl: string,
+  job: Job<T>,
+  onProgress?: (job: Job<T>) => void,
+  intervalMs = 1000,
+): Promise<T> {
+  let current = job
+  while (!finished.includes(current.status)) {
+    onProgress?.(current)
+    await new Promise((resolve) => setTimeout(resolve, intervalMs))
+    const response = await fetch(`${apiUrl}/jobs/${current.id}`)
+    const data = await response.json()
+    if (!response.ok) {
+      throw new Error(data.error || "Failed to poll job")
+    }
+    current = data as Job<T>
+  }
+  onProgress?.(current)
+  if (current.status !== "succeeded") {
+    throw new Error(current.error || `Job ${current.status}`)
+  }
+  return current.result as T
+}